@@ -31,6 +31,8 @@ func init() {
 	bsCmd.Perform("public", &options.BasePublicOptions{})
 	bsCmd.Perform("private", &options.BaseIdOptions{})
 	bsCmd.Perform("syncstatus", &compute.DiskBackupSyncstatusOptions{})
+	bsCmd.Perform("verify", &compute.BackupStorageVerifyOptions{})
+	bsCmd.Perform("gc", &compute.BackupStorageGcOptions{})
 
 	dbCmd := shell.NewResourceCmd(&modules.DiskBackups)
 	dbCmd.List(&compute.DiskBackupListOptions{})
@@ -39,6 +41,7 @@ func init() {
 	dbCmd.Create(&compute.DiskBackupCreateOptions{})
 	dbCmd.Perform("recovery", &compute.DiskBackupRecoveryOptions{})
 	dbCmd.Perform("syncstatus", &compute.DiskBackupSyncstatusOptions{})
+	dbCmd.Perform("consolidate", &compute.DiskBackupConsolidateOptions{})
 
 	ibCmd := shell.NewResourceCmd(&modules.InstanceBackups)
 	ibCmd.List(&compute.InstanceBackupListOptions{})
@@ -64,6 +64,7 @@ func init() {
 	cmd.BatchPerform("ipmi-probe", &options.BaseIdsOptions{})
 	cmd.BatchPerform("reserve-cpus", &compute.HostReserveCpusOptions{})
 	cmd.BatchPerform("unreserve-cpus", &options.BaseIdsOptions{})
+	cmd.BatchPerform("set-io-qos", &compute.HostSetIoQosOptions{})
 	cmd.BatchPerform("auto-migrate-on-host-down", &compute.HostAutoMigrateOnHostDownOptions{})
 	cmd.BatchPerform("restart-host-agent", &options.BaseIdsOptions{})
 
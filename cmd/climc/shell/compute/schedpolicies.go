@@ -48,6 +48,7 @@ func init() {
 		STRATEGY  string `help:"strategy for the schedtag" choices:"require|prefer|avoid|exclude"`
 		SCHEDTAG  string `help:"ID or name of schedtag"`
 		CONDITION string `help:"condition that assign schedtag to hosts"`
+		Algorithm string `help:"schedule algorithm used by matched servers" choices:"default|binpack"`
 		Enable    bool   `help:"create the policy with enabled status"`
 		Disable   bool   `help:"create the policy with disabled status"`
 	}
@@ -57,6 +58,9 @@ func init() {
 		params.Add(jsonutils.NewString(args.STRATEGY), "strategy")
 		params.Add(jsonutils.NewString(args.CONDITION), "condition")
 		params.Add(jsonutils.NewString(args.SCHEDTAG), "schedtag")
+		if len(args.Algorithm) > 0 {
+			params.Add(jsonutils.NewString(args.Algorithm), "algorithm")
+		}
 
 		if args.Enable {
 			params.Add(jsonutils.JSONTrue, "enabled")
@@ -78,6 +82,7 @@ func init() {
 		Strategy  string `help:"schedtag strategy" choices:"require|prefer|avoid|exclude"`
 		SchedTag  string `help:"ID or name of schedtag"`
 		Condition string `help:"condition that assign schedtag to hosts"`
+		Algorithm string `help:"schedule algorithm used by matched servers" choices:"default|binpack"`
 		Enable    bool   `help:"make the sched policy enabled"`
 		Disable   bool   `help:"make the sched policy disabled"`
 	}
@@ -96,6 +101,9 @@ func init() {
 		if len(args.SchedTag) > 0 {
 			params.Add(jsonutils.NewString(args.SchedTag), "schedtag")
 		}
+		if len(args.Algorithm) > 0 {
+			params.Add(jsonutils.NewString(args.Algorithm), "algorithm")
+		}
 		if args.Enable {
 			params.Add(jsonutils.JSONTrue, "enabled")
 		} else if args.Disable {
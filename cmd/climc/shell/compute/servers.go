@@ -69,6 +69,7 @@ func init() {
 	cmd.PrintObjectYAML().Perform("migrate-forecast", new(options.ServerMigrateForecastOptions))
 	cmd.Perform("migrate", new(options.ServerMigrateOptions))
 	cmd.Perform("live-migrate", new(options.ServerLiveMigrateOptions))
+	cmd.Perform("relocate", new(options.ServerRelocateOptions))
 	cmd.BatchPerform("cancel-live-migrate", new(options.ServerIdsOptions))
 	cmd.Perform("set-live-migrate-params", new(options.ServerSetLiveMigrateParamsOptions))
 	cmd.Perform("modify-src-check", new(options.ServerModifySrcCheckOptions))
@@ -127,6 +128,8 @@ func init() {
 	cmd.BatchPerform("start-rescue", &options.ServerStartOptions{})
 	cmd.BatchPerform("stop-rescue", &options.ServerStartOptions{})
 	cmd.BatchPerform("sync-os-info", &options.ServerIdsOptions{})
+	cmd.Perform("attach-filesystem", &options.ServerAttachFilesystemOptions{})
+	cmd.Perform("detach-filesystem", &options.ServerDetachFilesystemOptions{})
 
 	cmd.Get("vnc", new(options.ServerVncOptions))
 	cmd.Get("desc", new(options.ServerIdOptions))
@@ -138,9 +141,11 @@ func init() {
 	cmd.Get("change-owner-candidate-domains", new(options.ServerChangeOwnerCandidateDomainsOptions))
 	cmd.Get("change-owner-candidate-domains", new(options.ServerChangeOwnerCandidateDomainsOptions))
 	cmd.Get("cpuset-cores", new(options.ServerIdOptions))
+	cmd.Get("filesystem-mounts", new(options.ServerIdOptions))
 	cmd.Get("sshport", new(options.ServerIdOptions))
 	cmd.Get("qemu-info", new(options.ServerIdOptions))
 	cmd.Get("hardware-info", new(options.ServerIdOptions))
+	cmd.Get("sched-decisions", new(options.ServerSchedDecisionsOptions))
 
 	cmd.GetProperty(&options.ServerStatusStatisticsOptions{})
 	cmd.GetProperty(&options.ServerProjectStatisticsOptions{})
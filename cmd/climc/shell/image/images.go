@@ -19,10 +19,12 @@ import (
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/cheggaaa/pb/v3"
 
 	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
 	"yunion.io/x/pkg/util/printutils"
 
 	"yunion.io/x/onecloud/cmd/climc/shell"
@@ -31,10 +33,11 @@ import (
 	modules "yunion.io/x/onecloud/pkg/mcclient/modules/image"
 	"yunion.io/x/onecloud/pkg/mcclient/options"
 	"yunion.io/x/onecloud/pkg/mcclient/options/glance"
+	"yunion.io/x/onecloud/pkg/util/ovfutils"
 )
 
 type ImageOptionalOptions struct {
-	Format             string   `help:"Image format" choices:"raw|qcow2|iso|vmdk|docker|vhd|tgz"`
+	Format             string   `help:"Image format" choices:"raw|qcow2|iso|vmdk|docker|vhd|tgz|ova|ovf"`
 	Protected          bool     `help:"Prevent image from being deleted"`
 	Unprotected        bool     `help:"Allow image to be deleted"`
 	Standard           bool     `help:"Mark image as a standard image"`
@@ -154,6 +157,15 @@ func addImageOptionalOptions(s *mcclient.ClientSession, params *jsonutils.JSONDi
 	return nil
 }
 
+func addImageSignatureOptions(params *jsonutils.JSONDict, signature, signingKey string) {
+	if len(signature) > 0 {
+		params.Add(jsonutils.NewString(signature), "signature")
+	}
+	if len(signingKey) > 0 {
+		params.Add(jsonutils.NewString(signingKey), "signing_key_id")
+	}
+}
+
 func init() {
 
 	cmd := shell.NewResourceCmd(&modules.Images)
@@ -256,6 +268,9 @@ func init() {
 
 		EncryptKey string `help:"encrypt key id"`
 
+		Signature  string `help:"base64 encoded signature of the SHA-256 digest of the image file"`
+		SigningKey string `help:"ID or name of the signing key"`
+
 		ImageOptionalOptions
 	}
 	R(&ImageUploadOptions{}, "image-upload", "Upload a local image", func(s *mcclient.ClientSession, args *ImageUploadOptions) error {
@@ -264,22 +279,36 @@ func init() {
 		if len(args.EncryptKey) > 0 {
 			params.Add(jsonutils.NewString(args.EncryptKey), "encrypt_key_id")
 		}
+		addImageSignatureOptions(params, args.Signature, args.SigningKey)
 		err := addImageOptionalOptions(s, params, args.ImageOptionalOptions)
 		if err != nil {
 			return err
 		}
-		f, err := os.Open(args.FILE)
-		if err != nil {
-			return err
-		}
-		defer f.Close()
-		finfo, err := f.Stat()
-		if err != nil {
-			return err
+		var reader io.Reader
+		var size int64
+		if strings.HasSuffix(strings.ToLower(args.FILE), ".ovf") {
+			// upload the descriptor and its disk files as one ova
+			ova, ovaSize, err := ovfutils.NewOvaReader(args.FILE)
+			if err != nil {
+				return err
+			}
+			defer ova.Close()
+			reader, size = ova, ovaSize
+			params.Set("disk-format", jsonutils.NewString("ova"))
+		} else {
+			f, err := os.Open(args.FILE)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			finfo, err := f.Stat()
+			if err != nil {
+				return err
+			}
+			reader, size = f, finfo.Size()
 		}
-		size := finfo.Size()
 		bar := pb.Full.Start64(size)
-		barReader := bar.NewProxyReader(f)
+		barReader := bar.NewProxyReader(reader)
 		img, err := modules.Images.Upload(s, params, barReader, size)
 		if err != nil {
 			return err
@@ -294,6 +323,8 @@ func init() {
 		COPYFROM       string `help:"Image external location url"`
 		CompressFormat string
 		EncryptKey     string `help:"encrypt key id"`
+		Signature      string `help:"base64 encoded signature of the SHA-256 digest of the image file"`
+		SigningKey     string `help:"ID or name of the signing key"`
 	}
 	R(&ImageImportOptions{}, "image-import", "Import a external image", func(s *mcclient.ClientSession, args *ImageImportOptions) error {
 		params := jsonutils.NewDict()
@@ -304,6 +335,7 @@ func init() {
 		if len(args.EncryptKey) > 0 {
 			params.Add(jsonutils.NewString(args.EncryptKey), "encrypt_key_id")
 		}
+		addImageSignatureOptions(params, args.Signature, args.SigningKey)
 		err := addImageOptionalOptions(s, params, args.ImageOptionalOptions)
 		if err != nil {
 			return err
@@ -367,6 +399,45 @@ func init() {
 		return nil
 	})
 
+	type ImageExportOptions struct {
+		ID     string `help:"ID or Name of image"`
+		Format string `help:"Export format, converted on the server on first request" choices:"qcow2|vmdk|vhd|vhdx|ova" required:"true"`
+		Output string `help:"Destination file" required:"true"`
+	}
+	R(&ImageExportOptions{}, "image-export", "Download image converted to another format, e.g. vhdx for Hyper-V or ova for vSphere", func(s *mcclient.ClientSession, args *ImageExportOptions) error {
+		imgId, err := modules.Images.GetId(s, args.ID, nil)
+		if err != nil {
+			return err
+		}
+		var src io.ReadCloser
+		var size int64
+		for {
+			src, size, err = modules.Images.Export(s, imgId, args.Format)
+			if errors.Cause(err) != modules.ErrImageExportConverting {
+				break
+			}
+			fmt.Printf("Converting to %s, %s\n", args.Format, err)
+			time.Sleep(10 * time.Second)
+		}
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		f, err := os.Create(args.Output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		bar := pb.Full.Start64(size)
+		_, err = io.Copy(f, bar.NewProxyReader(src))
+		bar.Finish()
+		if err != nil {
+			return err
+		}
+		fmt.Println("Image size: ", size)
+		return nil
+	})
+
 	R(&ImageOperationOptions{}, "image-private", "Make a image private", func(s *mcclient.ClientSession, args *ImageOperationOptions) error {
 		if len(args.ID) == 0 {
 			return fmt.Errorf("No image ID provided")
@@ -472,4 +543,20 @@ func init() {
 		printObject(img)
 		return nil
 	})
+
+	type ImageVerifySignatureOptions struct {
+		ID         string `help:"ID or name of image to verify"`
+		Signature  string `help:"replace the signature, base64 encoded"`
+		SigningKey string `help:"ID or name of the signing key of the new signature"`
+	}
+	R(&ImageVerifySignatureOptions{}, "image-verify-signature", "Verify image signature against its signing key", func(s *mcclient.ClientSession, opts *ImageVerifySignatureOptions) error {
+		params := jsonutils.NewDict()
+		addImageSignatureOptions(params, opts.Signature, opts.SigningKey)
+		img, err := modules.Images.PerformAction(s, opts.ID, "verify-signature", params)
+		if err != nil {
+			return err
+		}
+		printObject(img)
+		return nil
+	})
 }
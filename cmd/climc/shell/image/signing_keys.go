@@ -0,0 +1,31 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"yunion.io/x/onecloud/cmd/climc/shell"
+	modules "yunion.io/x/onecloud/pkg/mcclient/modules/image"
+	"yunion.io/x/onecloud/pkg/mcclient/options/glance"
+)
+
+func init() {
+	cmd := shell.NewResourceCmd(&modules.ImageSigningKeys)
+	cmd.List(&glance.ImageSigningKeyListOptions{})
+	cmd.Show(&glance.ImageSigningKeyIdOptions{})
+	cmd.Create(&glance.ImageSigningKeyCreateOptions{})
+	cmd.Delete(&glance.ImageSigningKeyIdOptions{})
+	cmd.Perform("enable", &glance.ImageSigningKeyIdOptions{})
+	cmd.Perform("disable", &glance.ImageSigningKeyIdOptions{})
+}
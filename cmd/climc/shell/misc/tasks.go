@@ -86,8 +86,36 @@ func init() {
 			printObject(result)
 			return nil
 		})
+
+		type TaskCancelOptions struct {
+			ID     string `help:"ID of the task"`
+			Reason string `help:"reason of cancellation"`
+		}
+		R(&TaskCancelOptions{}, fmt.Sprintf("%s-task-cancel", c.service), "Cancel an unfinished task and its subtasks", func(s *mcclient.ClientSession, args *TaskCancelOptions) error {
+			params := jsonutils.NewDict()
+			if len(args.Reason) > 0 {
+				params.Add(jsonutils.NewString(args.Reason), "reason")
+			}
+			result, err := c.manager.PerformAction(s, args.ID, "cancel", params)
+			if err != nil {
+				return err
+			}
+			printObject(result)
+			return nil
+		})
 	}
 
+	type TaskRecoveryReportOptions struct {
+	}
+	R(&TaskRecoveryReportOptions{}, "region-task-recovery-report", "Show the report of task recovery at the last region start", func(s *mcclient.ClientSession, args *TaskRecoveryReportOptions) error {
+		result, err := compute.ComputeTasks.Get(s, "recovery-report", nil)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+
 	/*type TaskListOptions struct {
 		ObjName     string `help:"object name"`
 		ObjId       string `help:"object id"`
@@ -16,6 +16,7 @@ package scheduler
 
 import (
 	"fmt"
+	"io/ioutil"
 
 	"yunion.io/x/jsonutils"
 
@@ -108,6 +109,18 @@ func init() {
 			return nil
 		})
 
+	type SchedulerSnapshotOptions struct {
+		OUTPUT string `help:"File to save the snapshot, the input of 'scheduler simulate'"`
+	}
+	R(&SchedulerSnapshotOptions{}, "scheduler-snapshot", "Export scheduler candidate cache snapshot",
+		func(s *mcclient.ClientSession, args *SchedulerSnapshotOptions) error {
+			result, err := modules.SchedManager.Snapshot(s)
+			if err != nil {
+				return err
+			}
+			return ioutil.WriteFile(args.OUTPUT, []byte(result.String()), 0644)
+		})
+
 	type SchedulerCleanCacheOptions struct {
 		HostId    string `help:"ID of host" short-token:"h"`
 		SessionId string `help:"Session id" short-token:"s"`
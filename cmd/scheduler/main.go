@@ -15,9 +15,12 @@
 package main
 
 import (
+	"os"
+
 	"yunion.io/x/log"
 
 	"yunion.io/x/onecloud/pkg/scheduler/service"
+	"yunion.io/x/onecloud/pkg/scheduler/simulate"
 	"yunion.io/x/onecloud/pkg/util/atexit"
 )
 
@@ -27,6 +30,14 @@ func main() {
 		atexit.Exit(exitCode)
 	}()
 
+	if len(os.Args) > 1 && os.Args[1] == "simulate" {
+		if err := simulate.Run(os.Args[2:]); err != nil {
+			log.Errorln(err)
+			exitCode = -1
+		}
+		return
+	}
+
 	if err := service.StartService(); err != nil {
 		log.Errorln(err)
 		exitCode = -1
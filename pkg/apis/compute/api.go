@@ -428,6 +428,20 @@ type ServerConfigs struct {
 	// 主机组列表, 参数可以是主机组名称或ID,建议使用ID
 	InstanceGroupIds []string `json:"groups"`
 
+	// 调度算法, 为空时使用调度策略指定的算法或默认算法
+	// enum: default, binpack
+	SchedAlgorithm string `json:"sched_algorithm"`
+
+	// 调度优先级类(ID或Name), 为空时使用项目的默认优先级类
+	PriorityClassId string `json:"priority_class_id"`
+
+	// 调度失败时仅计算并记录抢占方案, 不驱逐低优先级虚拟机
+	PreemptDryRun bool `json:"preempt_dry_run"`
+
+	// 抢占时可驱逐虚拟机的权限范围, 由region根据发起者的权限设置
+	// swagger:ignore
+	PreemptScope string `json:"preempt_scope"`
+
 	// DEPRECATE
 	Suggestion bool `json:"suggestion"`
 }
@@ -520,6 +534,15 @@ type ServerCreateInput struct {
 	// emulate: pc, q35
 	Machine string `json:"machine"`
 
+	// 是否启用vTPM(由swtpm模拟的TPM 2.0设备), 仅KVM支持
+	Vtpm bool `json:"vtpm"`
+
+	// 是否启用内存气球(virtio-balloon, 带free page reporting), 仅KVM支持
+	// 宿主机内存紧张时会通过内存气球回收虚拟机的空闲内存
+	MemBalloon bool `json:"mem_balloon"`
+	// 内存气球回收时虚拟机保留的最小内存, 单位MB, 0表示使用宿主机默认比例
+	MemBalloonFloor int `json:"mem_balloon_floor"`
+
 	// 启动顺序
 	// c: cdrome
 	// d: disk
@@ -25,6 +25,8 @@ type TBackupStorageType string
 const (
 	BACKUPSTORAGE_TYPE_NFS            = TBackupStorageType("nfs")
 	BACKUPSTORAGE_TYPE_OBJECT_STORAGE = TBackupStorageType("object")
+	// chunked and deduplicated repository on nfs or object storage
+	BACKUPSTORAGE_TYPE_REPOSITORY = TBackupStorageType("repository")
 
 	BACKUPSTORAGE_STATUS_ONLINE  = "online"
 	BACKUPSTORAGE_STATUS_OFFLINE = "offline"
@@ -42,6 +44,8 @@ const (
 	BACKUP_STATUS_READY                   = "ready"
 	BACKUP_STATUS_RECOVERY                = "recovery"
 	BACKUP_STATUS_RECOVERY_FAILED         = "recovery_failed"
+	BACKUP_STATUS_CONSOLIDATING           = "consolidating"
+	BACKUP_STATUS_CONSOLIDATE_FAILED      = "consolidate_failed"
 	BACKUP_STATUS_UNKNOWN                 = "unknown"
 
 	BACKUP_EXIST     = "exist"
@@ -52,11 +56,27 @@ const (
 	BackupStorageOffline = "backup storage offline"
 )
 
+const (
+	DISK_BACKUP_MODE_FULL         = "full"
+	DISK_BACKUP_MODE_INCREMENTAL  = "incremental"
+	DISK_BACKUP_MODE_DIFFERENTIAL = "differential"
+
+	// prefix of the dirty bitmaps tracking the changes of the backup chains
+	DISK_BACKUP_DIRTY_BITMAP_PREFIX = "backup-"
+
+	// the backup since which the dirty bitmap of the disk records changes
+	DISK_METADATA_BACKUP_CHAIN_TIP = "backup_chain_tip"
+
+	// results of the last verify and garbage collection of a repository
+	BACKUPSTORAGE_METADATA_REPOSITORY_VERIFY = "repository_verify_result"
+	BACKUPSTORAGE_METADATA_REPOSITORY_GC     = "repository_gc_result"
+)
+
 type BackupStorageCreateInput struct {
 	apis.EnabledStatusInfrasResourceBaseCreateInput
 
 	// description: storage type
-	// enum: nfs
+	// enum: nfs,object,repository
 	StorageType string `json:"storage_type"`
 
 	SBackupStorageAccessInfo
@@ -81,6 +101,33 @@ type BackupStorageDetails struct {
 	SBackupStorageAccessInfo
 }
 
+type BackupStorageVerifyInput struct {
+	// 读取并校验每个数据块的内容, 否则只检查数据块是否存在
+	CheckData bool `json:"check_data"`
+}
+
+type BackupStorageGcInput struct {
+	// 只统计可回收的数据块, 不删除
+	DryRun bool `json:"dry_run"`
+}
+
+// SBackupRepositoryVerifyResult is the result of verifying a backup repository
+type SBackupRepositoryVerifyResult struct {
+	Manifests     int      `json:"manifests"`
+	Chunks        int      `json:"chunks"`
+	MissingChunks int      `json:"missing_chunks"`
+	CorruptChunks int      `json:"corrupt_chunks"`
+	BrokenBackups []string `json:"broken_backups"`
+}
+
+// SBackupRepositoryGcResult is the result of collecting the unreferenced chunks
+type SBackupRepositoryGcResult struct {
+	Manifests     int   `json:"manifests"`
+	Chunks        int   `json:"chunks"`
+	RemovedChunks int   `json:"removed_chunks"`
+	RemovedBytes  int64 `json:"removed_bytes"`
+}
+
 type BackupStorageListInput struct {
 	apis.EnabledStatusInfrasResourceBaseListInput
 
@@ -103,6 +150,11 @@ type DiskBackupListInput struct {
 	IsInstanceBackup *bool `json:"is_instance_backup"`
 	// 按硬盘名称排序
 	OrderByDiskName string `json:"order_by_disk_name"`
+	// 备份模式
+	// enum: ["full", "incremental", "differential"]
+	BackupMode []string `json:"backup_mode"`
+	// 依赖的备份
+	ParentBackupId string `json:"parent_backup_id"`
 }
 
 type DiskBackupDetails struct {
@@ -117,6 +169,10 @@ type DiskBackupDetails struct {
 	BackupStorageName string `json:"backup_storage_name"`
 	// description: 是否是子备份
 	IsSubBackup bool `json:"is_sub_backup"`
+	// description: 依赖的备份名称
+	ParentBackup string `json:"parent_backup"`
+	// description: 依赖此备份的备份数量
+	DependentBackupCount int `json:"dependent_backup_count"`
 
 	SDiskBackup
 }
@@ -142,6 +198,15 @@ type DiskBackupCreateInput struct {
 	// swagger:ignore
 	ManagerId   string                `json:"manager_id"`
 	BackupAsTar *DiskBackupAsTarInput `json:"backup_as_tar"`
+
+	// description: 备份模式, 仅支持运行中的KVM虚拟机的qcow2磁盘, 通过脏位图只导出变化的数据;
+	// 增量备份依赖上一次全量或增量备份, 差异备份依赖上一次全量或增量备份且不重置脏位图;
+	// 备份链不可用时自动改为全量备份; 未指定时通过快照做全量备份
+	// enum: ["full", "incremental", "differential"]
+	BackupMode string `json:"backup_mode"`
+}
+
+type DiskBackupConsolidateInput struct {
 }
 
 type DiskBackupRecoveryInput struct {
@@ -177,6 +242,8 @@ type InstanceBackupPackMetadata struct {
 	EncryptKeyId string
 	// Instance Backup metadata
 	Metadata map[string]string `json:"metadata"`
+	// 备份包中是否包含vTPM状态
+	HasVtpm bool `json:"has_vtpm"`
 }
 
 type InstanceBackupManagerSyncstatusInput struct {
@@ -198,6 +265,12 @@ type SBackupStorageAccessInfo struct {
 	ObjectAccessKey string `json:"object_access_key"`
 	// description: secret of object storage
 	ObjectSecret string `json:"object_secret"`
+
+	// description: backend of repository, storage_type 为 repository 时, 此参数必传
+	// enum: nfs,object
+	RepositoryBackend string `json:"repository_backend"`
+	// description: key encrypting the chunks of repository, 不指定时自动生成
+	RepositoryKey string `json:"repository_key"`
 }
 
 func (ba *SBackupStorageAccessInfo) String() string {
@@ -0,0 +1,103 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compute
+
+import (
+	"time"
+
+	"yunion.io/x/onecloud/pkg/apis"
+)
+
+const (
+	// the window of reservation not started
+	CAPACITY_RESERVATION_STATUS_PENDING   = "pending"
+	CAPACITY_RESERVATION_STATUS_ACTIVE    = "active"
+	CAPACITY_RESERVATION_STATUS_EXPIRED   = "expired"
+	CAPACITY_RESERVATION_STATUS_CANCELLED = "cancelled"
+)
+
+type CapacityReservationCreateInput struct {
+	apis.VirtualResourceCreateInput
+
+	// 预留资源所在可用区(ID或Name), 未指定宿主机时预留整个可用区的资源
+	ZoneResourceInput
+
+	// 预留资源所在的宿主机(ID或Name)
+	Hosts []string `json:"hosts"`
+
+	// 预留的CPU核数
+	CpuCount int `json:"cpu_count"`
+	// 预留的内存大小, 单位MB
+	MemSize int `json:"mem_size"`
+	// 预留的本地存储大小, 单位MB
+	StorageSize int `json:"storage_size"`
+	// 预留的透传设备数量
+	IsolatedDeviceCount int `json:"isolated_device_count"`
+	// 预留的透传设备型号, 为空时不限型号
+	// example: GeForce GTX 1050 Ti
+	DevModel string `json:"dev_model"`
+
+	// 预留开始时间, 默认为当前时间
+	StartAt time.Time `json:"start_at"`
+	// 预留结束时间
+	EndAt time.Time `json:"end_at"`
+	// 预留时长, 未指定end_at时使用
+	// example: 24h
+	Duration string `json:"duration"`
+}
+
+type CapacityReservationUpdateInput struct {
+	apis.VirtualResourceBaseUpdateInput
+
+	// 延长或缩短预留结束时间
+	EndAt time.Time `json:"end_at"`
+}
+
+type CapacityReservationListInput struct {
+	apis.VirtualResourceListInput
+
+	ZonalFilterListInput
+
+	// 预留了此宿主机(ID或Name)的资源
+	HostId string `json:"host_id"`
+	// 仅列出当前生效的预留
+	Active *bool `json:"active"`
+}
+
+type CapacityReservationCancelInput struct {
+}
+
+type CapacityReservationUsage struct {
+	// 预留所有者已使用的CPU核数
+	UsedCpuCount int `json:"used_cpu_count"`
+	// 预留所有者已使用的内存大小, 单位MB
+	UsedMemSize int `json:"used_mem_size"`
+	// 预留所有者已使用的本地存储大小, 单位MB
+	UsedStorageSize int `json:"used_storage_size"`
+	// 预留所有者已使用的透传设备数量
+	UsedIsolatedDeviceCount int `json:"used_isolated_device_count"`
+}
+
+type CapacityReservationDetails struct {
+	apis.VirtualResourceDetails
+	ZoneResourceInfo
+
+	SCapacityReservation
+
+	CapacityReservationUsage
+
+	// 预留资源所在的宿主机名称
+	Hosts []string `json:"hosts"`
+}
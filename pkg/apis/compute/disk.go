@@ -315,6 +315,8 @@ type DiskAllocateFromBackupInput struct {
 	BackupStorageAccessInfo *jsonutils.JSONDict
 	DiskConfig              *DiskConfig           `json:"disk_config"`
 	BackupAsTar             *DiskBackupAsTarInput `json:"backup_as_tar"`
+	// 增量或差异备份所依赖的备份, 从全量备份开始
+	BackupChain []string `json:"backup_chain"`
 }
 
 type DiskDeleteInput struct {
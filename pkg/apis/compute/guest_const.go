@@ -23,6 +23,7 @@ const (
 	VM_UNKNOWN               = compute.VM_UNKNOWN
 	VM_SCHEDULE              = "schedule"
 	VM_SCHEDULE_FAILED       = "sched_fail"
+	VM_PREEMPTING            = "preempting"
 	VM_CREATE_NETWORK        = "network"
 	VM_NETWORK_FAILED        = "net_fail"
 	VM_DEVICE_FAILED         = "dev_fail"
@@ -161,6 +162,10 @@ const (
 	VM_CONVERT_FAILED = "convert_failed"
 	VM_CONVERTED      = "converted"
 
+	VM_RELOCATING      = "relocating"
+	VM_RELOCATE_FAILED = "relocate_failed"
+	VM_RELOCATED       = "relocated"
+
 	VM_TEMPLATE_SAVING      = "tempalte_saving"
 	VM_TEMPLATE_SAVE_FAILED = "template_save_failed"
 
@@ -75,6 +75,8 @@ type GuestdiskJsonDesc struct {
 	Iops          int    `json:"iops"`
 	Throughput    int    `json:"throughput"`
 	Bps           int    `json:"bps"`
+	IopsMin       int    `json:"iops_min"`
+	BpsMin        int    `json:"bps_min"`
 	Size          int    `json:"size"`
 	TemplateId    string `json:"template_id"`
 	ImagePath     string `json:"image_path"`
@@ -0,0 +1,66 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compute
+
+const (
+	GUEST_FILESYSTEM_SOURCE_HOST_PATH    = "host_path"
+	GUEST_FILESYSTEM_SOURCE_MOUNT_TARGET = "mount_target"
+
+	// virtiofs tag length limit of the guest kernel
+	GUEST_FILESYSTEM_TAG_MAX_LENGTH = 36
+)
+
+type ServerAttachFilesystemInput struct {
+	// 挂载标签, 虚拟机内通过 mount -t virtiofs <tag> <dir> 挂载
+	Tag string `json:"tag"`
+
+	// 共享目录来源
+	// enum: host_path, mount_target
+	SourceType string `json:"source_type"`
+
+	// 宿主机目录, source_type 为 host_path 时必填, 仅管理员可用
+	HostPath string `json:"host_path"`
+
+	// NAS挂载点Id或名称, source_type 为 mount_target 时必填, 仅支持NFS协议的文件系统
+	MountTargetId string `json:"mount_target_id"`
+	// NAS文件系统的子目录, 默认为 /
+	SubPath string `json:"sub_path"`
+
+	// 是否只读
+	ReadOnly bool `json:"read_only"`
+}
+
+type ServerDetachFilesystemInput struct {
+	// 挂载标签
+	Tag string `json:"tag"`
+}
+
+type GuestFilesystemMountDetails struct {
+	Tag           string `json:"tag"`
+	SourceType    string `json:"source_type"`
+	HostPath      string `json:"host_path"`
+	MountTargetId string `json:"mount_target_id"`
+	MountTarget   string `json:"mount_target"`
+	SubPath       string `json:"sub_path"`
+	ReadOnly      bool   `json:"read_only"`
+}
+
+type GuestFilesystemJsonDesc struct {
+	Tag        string `json:"tag"`
+	SourceType string `json:"source_type"`
+	// host_path 为宿主机目录, mount_target 为NFS地址, 例如 <domain_name>:/<sub_path>
+	Source   string `json:"source"`
+	ReadOnly bool   `json:"read_only"`
+}
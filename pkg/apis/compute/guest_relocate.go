@@ -0,0 +1,60 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compute
+
+import "yunion.io/x/onecloud/pkg/apis"
+
+const (
+	SERVER_META_RELOCATED_FROM = "__server_relocated_from"
+	SERVER_META_RELOCATED_TO   = "__server_relocated_to"
+
+	// 迁移前预拷贝的最大轮数, 超过后若预估停机时间仍超出限制则放弃迁移
+	GUEST_RELOCATE_MAX_PRECOPY_ROUNDS = 3
+	// 默认允许的最大停机时间(秒)
+	GUEST_RELOCATE_DEFAULT_MAX_DOWNTIME = 60
+)
+
+type ServerRelocateNetworkInput struct {
+	// 网卡序号, 从0开始
+	Index int `json:"index"`
+
+	// 目标区域的IP子网名称或ID
+	Network string `json:"network"`
+
+	// 指定目标IP地址, 不指定时若原IP在目标子网范围内则保留原IP, 否则自动分配
+	Address string `json:"address"`
+}
+
+type ServerRelocateInput struct {
+	apis.Meta
+
+	// 目标区域名称或ID
+	// required: true
+	TargetRegion string `json:"target_region"`
+
+	// 目标可用区名称或ID
+	TargetZone string `json:"target_zone"`
+
+	// 指定目标宿主机
+	PreferHost string `json:"prefer_host"`
+
+	// 每个网卡对应的目标IP子网, 必须覆盖虚拟机的所有网卡
+	// required: true
+	Networks []ServerRelocateNetworkInput `json:"networks"`
+
+	// 允许的最大停机时间(秒), 预估停机时间超出时不做切换
+	// default: 60
+	MaxDowntimeSeconds int `json:"max_downtime_seconds"`
+}
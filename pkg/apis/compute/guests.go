@@ -846,6 +846,12 @@ type ServerUpdateInput struct {
 	Vdi              *string `json:"vdi"`
 	Machine          *string `json:"machine"`
 	Bios             *string `json:"bios"`
+	// 是否启用vTPM, 仅关机状态可修改
+	Vtpm *bool `json:"vtpm"`
+	// 是否启用内存气球, 仅关机状态可修改
+	MemBalloon *bool `json:"mem_balloon"`
+	// 内存气球回收时虚拟机保留的最小内存, 单位MB
+	MemBalloonFloor *int `json:"mem_balloon_floor"`
 
 	SrcIpCheck  *bool `json:"src_ip_check"`
 	SrcMacCheck *bool `json:"src_mac_check"`
@@ -868,6 +874,7 @@ type GuestJsonDesc struct {
 	Vdi            string `json:"vdi"`
 	Machine        string `json:"machine"`
 	Bios           string `json:"bios"`
+	Vtpm           bool   `json:"vtpm"`
 	BootOrder      string `json:"boot_order"`
 	SrcIpCheck     bool   `json:"src_ip_check"`
 	SrcMacCheck    bool   `json:"src_mac_check"`
@@ -894,6 +901,13 @@ type GuestJsonDesc struct {
 
 	Floppys []*GuestfloppyJsonDesc `json:"floppys"`
 
+	// virtiofs 共享目录
+	Filesystems []*GuestFilesystemJsonDesc `json:"filesystems"`
+
+	// 内存气球
+	MemBalloon      bool `json:"mem_balloon"`
+	MemBalloonFloor int  `json:"mem_balloon_floor"`
+
 	Tenant        string `json:"tenant"`
 	TenantId      string `json:"tenant_id"`
 	DomainId      string `json:"domain_id"`
@@ -967,6 +981,10 @@ type ServerSetDiskIoThrottleInput struct {
 	Bps map[string]int `json:"bps"`
 	// key disk id, value iops
 	IOPS map[string]int `json:"iops"`
+	// 主机I/O QoS争用时保证的最低bps, key disk id
+	BpsMin map[string]int `json:"bps_min"`
+	// 主机I/O QoS争用时保证的最低iops, key disk id
+	IopsMin map[string]int `json:"iops_min"`
 }
 
 type ServerChangeStorageInput struct {
@@ -540,6 +540,8 @@ type SHostPingInput struct {
 	WithData bool `json:"with_data"`
 
 	MemoryUsedMb int `json:"memory_used_mb"`
+	// memory reclaimed from guests by balloon
+	MemBalloonReclaimedMb int `json:"mem_balloon_reclaimed_mb"`
 
 	RootPartitionUsedCapacityMb int `json:"root_partition_used_capacity_mb"`
 
@@ -554,6 +556,22 @@ type HostReserveCpusInput struct {
 	DisableSchedLoadBalance *bool `json:"disable_sched_load_balance"`
 }
 
+type HostIoQosBudget struct {
+	// 项目名称或ID
+	Project string `json:"project"`
+	// 项目ID
+	ProjectId string `json:"project_id"`
+	// 项目在该宿主机上所有磁盘的iops总和上限, 0表示不限制
+	Iops int `json:"iops"`
+	// 项目在该宿主机上所有磁盘的bps总和上限, 0表示不限制
+	Bps int `json:"bps"`
+}
+
+type HostSetIoQosInput struct {
+	// 项目I/O预算, 为空表示清除所有预算
+	Budgets []HostIoQosBudget `json:"budgets"`
+}
+
 type HostAutoMigrateInput struct {
 	AutoMigrateOnHostDown     string `json:"auto_migrate_on_host_down"`
 	AutoMigrateOnHostShutdown string `json:"auto_migrate_on_host_shutdown"`
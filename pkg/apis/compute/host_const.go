@@ -185,4 +185,5 @@ const (
 
 const (
 	HOSTMETA_RESERVED_CPUS_INFO = "reserved_cpus_info"
+	HOSTMETA_IO_QOS_BUDGETS     = "io_qos_budgets"
 )
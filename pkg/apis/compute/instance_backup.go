@@ -38,6 +38,9 @@ const (
 	INSTANCE_BACKUP_STATUS_SNAPSHOT_FAILED = "snapshot_failed"
 	INSTANCE_BACKUP_STATUS_SAVING          = "saving"
 	INSTANCE_BACKUP_STATUS_SAVE_FAILED     = "save_failed"
+
+	// id of the backup keeping the vTPM state of the guest
+	INSTANCE_BACKUP_METADATA_VTPM_BACKUP_ID = "vtpm_backup_id"
 )
 
 type InstanceBackupListInput struct {
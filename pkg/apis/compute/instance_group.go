@@ -14,7 +14,69 @@
 
 package compute
 
-import "yunion.io/x/onecloud/pkg/apis"
+import (
+	"reflect"
+	"strings"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/gotypes"
+
+	"yunion.io/x/onecloud/pkg/apis"
+)
+
+const (
+	// 以可用区为拓扑域
+	GROUP_TOPOLOGY_KEY_ZONE = "zone"
+	// 以拓扑键(topology_key)为指定值的宿主机调度标签为拓扑域, 例如 schedtag:rack
+	GROUP_TOPOLOGY_KEY_SCHEDTAG_PREFIX = "schedtag:"
+	// 以宿主机指定标签的值为拓扑域, 例如 metadata:power_domain
+	GROUP_TOPOLOGY_KEY_METADATA_PREFIX = "metadata:"
+
+	GROUP_SPREAD_DO_NOT_SCHEDULE = "do_not_schedule"
+	GROUP_SPREAD_SCHEDULE_ANYWAY = "schedule_anyway"
+)
+
+type GroupSpreadConstraint struct {
+	// 拓扑域
+	// example: zone, schedtag:rack, metadata:power_domain
+	TopologyKey string `json:"topology_key"`
+	// 各拓扑域之间实例数量允许的最大差值
+	MaxSkew int `json:"max_skew"`
+	// 无法满足约束时的处理方式, do_not_schedule 为强制约束, schedule_anyway 为尽量满足
+	// enum: do_not_schedule, schedule_anyway
+	WhenUnsatisfiable string `json:"when_unsatisfiable"`
+}
+
+func (c GroupSpreadConstraint) IsHard() bool {
+	return c.WhenUnsatisfiable != GROUP_SPREAD_SCHEDULE_ANYWAY
+}
+
+// ParseTopologyKey returns the kind (zone, schedtag or metadata) and the
+// argument of the topology key
+func (c GroupSpreadConstraint) ParseTopologyKey() (string, string) {
+	for _, prefix := range []string{GROUP_TOPOLOGY_KEY_SCHEDTAG_PREFIX, GROUP_TOPOLOGY_KEY_METADATA_PREFIX} {
+		if strings.HasPrefix(c.TopologyKey, prefix) {
+			return strings.TrimSuffix(prefix, ":"), c.TopologyKey[len(prefix):]
+		}
+	}
+	return c.TopologyKey, ""
+}
+
+type GroupSpreadConstraints []GroupSpreadConstraint
+
+func (cs GroupSpreadConstraints) String() string {
+	return jsonutils.Marshal(cs).String()
+}
+
+func (cs GroupSpreadConstraints) IsZero() bool {
+	return len(cs) == 0
+}
+
+func init() {
+	gotypes.RegisterSerializable(reflect.TypeOf(&GroupSpreadConstraints{}), func() gotypes.ISerializable {
+		return &GroupSpreadConstraints{}
+	})
+}
 
 type InstanceGroupListInput struct {
 	apis.VirtualResourceListInput
@@ -40,6 +102,20 @@ type InstanceGroupListInput struct {
 	OrderByGuestCount string `json:"order_by_guest_count"`
 }
 
+type InstanceGroupCreateInput struct {
+	apis.VirtualResourceCreateInput
+
+	// 拓扑分布约束
+	SpreadConstraints GroupSpreadConstraints `json:"spread_constraints"`
+}
+
+type InstanceGroupUpdateInput struct {
+	apis.VirtualResourceBaseUpdateInput
+
+	// 拓扑分布约束
+	SpreadConstraints GroupSpreadConstraints `json:"spread_constraints"`
+}
+
 type InstanceGroupDetail struct {
 	apis.VirtualResourceDetails
 	ZoneResourceInfo
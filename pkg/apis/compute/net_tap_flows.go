@@ -24,6 +24,11 @@ const (
 	TapFlowDirectionOut  = "OUT"
 	TapFlowDirectionBoth = "BOTH"
 
+	TapFlowProtocolAny  = "any"
+	TapFlowProtocolTcp  = "tcp"
+	TapFlowProtocolUdp  = "udp"
+	TapFlowProtocolIcmp = "icmp"
+
 	TapFlowIdMin = 0x10
 	TapFlowIdMax = 0x7fff
 )
@@ -34,6 +39,13 @@ var (
 		TapFlowDirectionOut,
 		TapFlowDirectionBoth,
 	}
+
+	TapFlowProtocols = []string{
+		TapFlowProtocolAny,
+		TapFlowProtocolTcp,
+		TapFlowProtocolUdp,
+		TapFlowProtocolIcmp,
+	}
 )
 
 type NetTapFlowListInput struct {
@@ -83,4 +95,14 @@ type NetTapFlowCreateInput struct {
 	SourceId string `json:"source_id" ignore:"true"`
 
 	Direction string `json:"direction" help:"flow direction" choices:"IN|OUT|BOTH"`
+
+	// 按协议过滤镜像流量, 可能值为 any|tcp|udp|icmp
+	// default: any
+	Protocol string `json:"protocol" help:"filter mirrored traffic by protocol" choices:"any|tcp|udp|icmp"`
+
+	// 按CIDR过滤镜像流量，匹配报文的源地址或目的地址
+	Cidr string `json:"cidr" help:"filter mirrored traffic by source or destination cidr"`
+
+	// swagger:ignore
+	OvnMirror bool `json:"ovn_mirror" ignore:"true"`
 }
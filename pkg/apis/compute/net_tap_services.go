@@ -19,6 +19,20 @@ import "yunion.io/x/onecloud/pkg/apis"
 const (
 	TapServiceHost  = "host"
 	TapServiceGuest = "guest"
+
+	TapServiceRemote = "remote"
+
+	TapServiceEncapGre    = "gre"
+	TapServiceEncapErspan = "erspan"
+
+	TapServiceErspanSessionIdMax = 0x3ff
+)
+
+var (
+	TapServiceEncaps = []string{
+		TapServiceEncapGre,
+		TapServiceEncapErspan,
+	}
 )
 
 type NetTapServiceListInput struct {
@@ -49,12 +63,22 @@ type NetTapServiceDetails struct {
 type NetTapServiceCreateInput struct {
 	apis.EnabledStatusStandaloneResourceCreateInput
 
-	// TAP服务类型，监听宿主机的网卡还是虚拟机的网卡, 可能值为 host|guest
-	Type string `json:"type" required:"true" choices:"host|guest" help:"type of tap service"`
+	// TAP服务类型，监听宿主机的网卡、虚拟机的网卡还是远端GRE/ERSPAN隧道端点, 可能值为 host|guest|remote
+	Type string `json:"type" required:"true" choices:"host|guest|remote" help:"type of tap service"`
 
-	// 资源ID，如果Type=host，该值为宿主机的ID，如果Type=guest，该值为虚拟机的ID
-	TargetId string `json:"target_id" required:"true" help:"id of target device"`
+	// 资源ID，如果Type=host，该值为宿主机的ID，如果Type=guest，该值为虚拟机的ID，Type=remote时无需指定
+	TargetId string `json:"target_id" help:"id of target device"`
 
 	// 监听网卡的Mac地址
 	MacAddr string `json:"mac_addr" help:"mac address of the device interface for tappping"`
+
+	// 远端隧道端点IP地址，仅Type=remote有效
+	RemoteIp string `json:"remote_ip" help:"ip address of remote tunnel endpoint"`
+
+	// 远端隧道封装协议，仅Type=remote有效, 可能值为 gre|erspan
+	// default: gre
+	Encap string `json:"encap" choices:"gre|erspan" help:"encapsulation of remote tunnel"`
+
+	// GRE key或ERSPAN session id，仅Type=remote有效
+	TunnelKey *int `json:"tunnel_key" help:"gre key or erspan session id of remote tunnel"`
 }
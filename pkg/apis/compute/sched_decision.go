@@ -0,0 +1,113 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compute
+
+import (
+	"reflect"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/gotypes"
+
+	"yunion.io/x/onecloud/pkg/apis"
+)
+
+const (
+	SCHED_DECISION_STATUS_SUCCESS = "success"
+	SCHED_DECISION_STATUS_FAILED  = "failed"
+)
+
+type SchedDecisionPriorityScore struct {
+	// priority name
+	Name string `json:"name"`
+	// score kind, prefer, avoid or normal
+	Kind string `json:"kind"`
+	// score already multiplied by the weight of the priority
+	Score int `json:"score"`
+	// configured weight of the priority, 0 if not set by a configured priority
+	Weight int `json:"weight"`
+}
+
+type SchedDecisionCandidate struct {
+	HostId   string `json:"host_id"`
+	HostName string `json:"host_name"`
+	// guest count placed on this candidate, 0 means not selected
+	Count int64 `json:"count"`
+	// guest count this candidate is able to hold
+	Capacity   int64                        `json:"capacity"`
+	Priorities []SchedDecisionPriorityScore `json:"priorities"`
+}
+
+type SchedDecisionCandidates []SchedDecisionCandidate
+
+func (cs SchedDecisionCandidates) String() string {
+	return jsonutils.Marshal(cs).String()
+}
+
+func (cs SchedDecisionCandidates) IsZero() bool {
+	return len(cs) == 0
+}
+
+type SchedDecisionPredicateElapsed struct {
+	Name string `json:"name"`
+	// total elapsed milliseconds of the predicate over all candidates
+	ElapsedMs float64 `json:"elapsed_ms"`
+}
+
+type SchedDecisionPredicates []SchedDecisionPredicateElapsed
+
+func (ps SchedDecisionPredicates) String() string {
+	return jsonutils.Marshal(ps).String()
+}
+
+func (ps SchedDecisionPredicates) IsZero() bool {
+	return len(ps) == 0
+}
+
+func init() {
+	gotypes.RegisterSerializable(reflect.TypeOf(&SchedDecisionCandidates{}), func() gotypes.ISerializable {
+		return &SchedDecisionCandidates{}
+	})
+	gotypes.RegisterSerializable(reflect.TypeOf(&SchedDecisionPredicates{}), func() gotypes.ISerializable {
+		return &SchedDecisionPredicates{}
+	})
+}
+
+type SchedDecisionListInput struct {
+	apis.StandaloneAnonResourceListInput
+
+	// 调度会话ID
+	SessionId []string `json:"session_id"`
+	// 调度结果状态
+	Status []string `json:"status"`
+	// 调度的虚拟机(ID或Name)
+	ServerId string `json:"server_id"`
+	// 调度选中的宿主机ID
+	HostId string `json:"host_id"`
+}
+
+type SchedDecisionDetails struct {
+	apis.StandaloneAnonResourceDetails
+
+	SSchedDecision
+}
+
+type ServerGetSchedDecisionsInput struct {
+	// 返回的调度记录数量, 默认为10
+	Limit *int `json:"limit"`
+}
+
+type ServerGetSchedDecisionsResp struct {
+	Decisions []SSchedDecision `json:"decisions"`
+}
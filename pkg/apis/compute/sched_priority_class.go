@@ -0,0 +1,136 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compute
+
+import (
+	"reflect"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/gotypes"
+
+	"yunion.io/x/onecloud/pkg/apis"
+)
+
+const (
+	// never preempt other guests
+	PREEMPTION_POLICY_NEVER = "never"
+	// preempt the guests with lower priority when no host fits
+	PREEMPTION_POLICY_PREEMPT_LOWER = "preempt_lower_priority"
+
+	PREEMPT_VICTIM_ACTION_STOP    = "stop"
+	PREEMPT_VICTIM_ACTION_MIGRATE = "migrate"
+
+	SCHED_PREEMPTION_STATUS_DRY_RUN  = "dry_run"
+	SCHED_PREEMPTION_STATUS_EVICTING = "evicting"
+	SCHED_PREEMPTION_STATUS_SUCCESS  = "success"
+	SCHED_PREEMPTION_STATUS_FAILED   = "failed"
+)
+
+var (
+	PREEMPTION_POLICIES    = []string{PREEMPTION_POLICY_NEVER, PREEMPTION_POLICY_PREEMPT_LOWER}
+	PREEMPT_VICTIM_ACTIONS = []string{PREEMPT_VICTIM_ACTION_STOP, PREEMPT_VICTIM_ACTION_MIGRATE}
+)
+
+type SchedPriorityClassCreateInput struct {
+	apis.StandaloneResourceCreateInput
+
+	// 优先级数值, 越大优先级越高
+	Value int `json:"value"`
+
+	// 抢占策略
+	// enum: never, preempt_lower_priority
+	// default: never
+	PreemptionPolicy string `json:"preemption_policy"`
+
+	// 被抢占虚拟机的处理方式
+	// enum: stop, migrate
+	// default: stop
+	VictimAction string `json:"victim_action"`
+
+	// 以此优先级类作为默认优先级的项目(ID或Name)
+	Projects []string `json:"projects"`
+}
+
+type SchedPriorityClassUpdateInput struct {
+	apis.StandaloneResourceBaseUpdateInput
+
+	Value            *int   `json:"value"`
+	PreemptionPolicy string `json:"preemption_policy"`
+	VictimAction     string `json:"victim_action"`
+
+	Projects []string `json:"projects"`
+}
+
+type SchedPriorityClassListInput struct {
+	apis.StandaloneResourceListInput
+
+	PreemptionPolicy []string `json:"preemption_policy"`
+	// 默认优先级作用于此项目(ID或Name)的优先级类
+	ProjectId string `json:"project_id"`
+}
+
+type SchedPriorityClassDetails struct {
+	apis.StandaloneResourceDetails
+
+	SSchedPriorityClass
+
+	// 使用此优先级类的虚拟机数量
+	GuestCount int `json:"guest_count"`
+}
+
+type SchedPreemptionVictim struct {
+	GuestId   string `json:"guest_id"`
+	Name      string `json:"name"`
+	Priority  int    `json:"priority"`
+	VcpuCount int    `json:"vcpu_count"`
+	VmemSize  int    `json:"vmem_size"`
+	// stop or migrate
+	Action string `json:"action"`
+}
+
+type SchedPreemptionVictims []SchedPreemptionVictim
+
+func (vs SchedPreemptionVictims) String() string {
+	return jsonutils.Marshal(vs).String()
+}
+
+func (vs SchedPreemptionVictims) IsZero() bool {
+	return len(vs) == 0
+}
+
+func init() {
+	gotypes.RegisterSerializable(reflect.TypeOf(&SchedPreemptionVictims{}), func() gotypes.ISerializable {
+		return &SchedPreemptionVictims{}
+	})
+}
+
+type SchedPreemptionListInput struct {
+	apis.StandaloneAnonResourceListInput
+
+	// 抢占发起的虚拟机(ID或Name)
+	ServerId string `json:"server_id"`
+	// 被抢占的宿主机ID
+	HostId string   `json:"host_id"`
+	Status []string `json:"status"`
+}
+
+type SchedPreemptionDetails struct {
+	apis.StandaloneAnonResourceDetails
+
+	SSchedPreemption
+
+	Server string `json:"server"`
+	Host   string `json:"host"`
+}
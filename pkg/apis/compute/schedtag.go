@@ -33,6 +33,10 @@ type SchedtagCreateInput struct {
 	// enum: servers, hosts, .....
 	// default: hosts
 	ResourceType string `json:"resource_type"`
+
+	// 拓扑键, 主机组分布约束 schedtag:<topology_key> 以带有该拓扑键的调度标签为拓扑域
+	// example: rack
+	TopologyKey string `json:"topology_key"`
 }
 
 type SchedtagResourceInput struct {
@@ -25,3 +25,12 @@ const (
 )
 
 var STRATEGY_LIST = []string{STRATEGY_REQUIRE, STRATEGY_EXCLUDE, STRATEGY_PREFER, STRATEGY_AVOID}
+
+const (
+	// spread guests across hosts, the default behaviour
+	SCHED_ALGORITHM_DEFAULT = "default"
+	// pack guests onto the most utilised hosts that still fit
+	SCHED_ALGORITHM_BINPACK = "binpack"
+)
+
+var SCHED_ALGORITHM_LIST = []string{SCHED_ALGORITHM_DEFAULT, SCHED_ALGORITHM_BINPACK}
@@ -81,6 +81,14 @@ type SSecgroupRuleResource struct {
 	// requried: false
 	// example: test to create rule
 	Description string `json:"description"`
+
+	// 记录规则命中日志, 仅对OVN VPC生效
+	// requried: false
+	AclLog bool `json:"acl_log"`
+
+	// 对端安全组ID, 规则匹配对端安全组内虚拟机的地址, 仅对OVN VPC生效
+	// requried: false
+	PeerSecgroupId string `json:"peer_secgroup_id"`
 }
 
 type SSecgroupRuleResourceSet []SSecgroupRuleResource
@@ -134,6 +142,9 @@ type SSecgroupRuleUpdateInput struct {
 	// requried: false
 	// example: test to create rule
 	Description string `json:"description"`
+
+	// 记录规则命中日志, 仅对OVN VPC生效
+	AclLog *bool `json:"acl_log"`
 }
 
 func (input *SSecgroupRuleResource) Check() error {
@@ -187,6 +198,10 @@ type SSecgroupCreateInput struct {
 	// 规则列表
 	// required: false
 	Rules []SSecgroupRuleCreateInput `json:"rules"`
+
+	// 记录所有规则的命中日志, 仅对OVN VPC生效
+	// required: false
+	AclLog bool `json:"acl_log"`
 }
 
 type SecgroupListInput struct {
@@ -40,4 +40,9 @@ const (
 
 	SNAPSHOT_EXIST     = "exist"
 	SNAPSHOT_NOT_EXIST = "not_exist"
+
+	// encrypted vTPM state of the guest at the time of the instance snapshot
+	INSTANCE_SNAPSHOT_METADATA_VTPM_STATE = "__vtpm_state"
+	// encrypt key created for the vTPM state of an unencrypted instance snapshot
+	INSTANCE_SNAPSHOT_METADATA_VTPM_KEY_ID = "__vtpm_key_id"
 )
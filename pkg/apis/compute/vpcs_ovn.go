@@ -71,6 +71,20 @@ func VpcInterExtIP2() netutils.IPV4Addr {
 	return vpcInterExtIP2
 }
 
+// vpc peering transit links are /30 subnets allocated from this range
+const (
+	sVpcInterPeerCidr = "100.65.64.0/18"
+	VpcInterPeerMask  = 30
+)
+
+var (
+	vpcInterPeerCidr netutils.IPV4Prefix
+)
+
+func VpcInterPeerCidr() netutils.IPV4Prefix {
+	return vpcInterPeerCidr
+}
+
 const (
 	sVpcMappedCidr      = "100.64.0.0/17"
 	VpcMappedIPMask     = 17
@@ -134,6 +148,7 @@ func init() {
 	vpcInterCidr = mp(netutils.NewIPV4Prefix(sVpcInterCidr))
 	vpcInterExtIP1 = mi(netutils.NewIPV4Addr(sVpcInterExtIP1))
 	vpcInterExtIP2 = mi(netutils.NewIPV4Addr(sVpcInterExtIP2))
+	vpcInterPeerCidr = mp(netutils.NewIPV4Prefix(sVpcInterPeerCidr))
 
 	vpcMappedCidr = mp(netutils.NewIPV4Prefix(sVpcMappedCidr))
 	vpcMappedGatewayIP = mi(netutils.NewIPV4Addr(sVpcMappedGatewayIP))
@@ -200,6 +200,28 @@ type SCachedimage struct {
 	ImageType string `json:"image_type"`
 }
 
+// SCapacityReservation is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SCapacityReservation.
+type SCapacityReservation struct {
+	apis.SVirtualResourceBase
+	SZoneResourceBase
+	// 预留资源所在的宿主机ID列表, 以','分隔, 为空时预留整个可用区
+	HostIds string `json:"host_ids"`
+	// 预留的CPU核数
+	CpuCount int `json:"cpu_count"`
+	// 预留的内存大小, 单位MB
+	MemSize int `json:"mem_size"`
+	// 预留的本地存储大小, 单位MB
+	StorageSize int `json:"storage_size"`
+	// 预留的透传设备数量
+	IsolatedDeviceCount int `json:"isolated_device_count"`
+	// 预留的透传设备型号
+	DevModel string `json:"dev_model"`
+	// 预留开始时间
+	StartAt time.Time `json:"start_at"`
+	// 预留结束时间
+	EndAt time.Time `json:"end_at"`
+}
+
 // SCloudaccount is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SCloudaccount.
 type SCloudaccount struct {
 	apis.SEnabledStatusInfrasResourceBase
@@ -619,6 +641,12 @@ type SDiskBackup struct {
 	// 操作系统类型
 	OsType     string             `json:"os_type"`
 	DiskConfig *SBackupDiskConfig `json:"disk_config"`
+	// 备份模式
+	BackupMode string `json:"backup_mode"`
+	// 依赖的备份
+	ParentBackupId string `json:"parent_backup_id"`
+	// 记录备份链变化的脏位图
+	DirtyBitmap string `json:"dirty_bitmap"`
 }
 
 // SDiskResourceBase is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SDiskResourceBase.
@@ -992,6 +1020,8 @@ type SGroup struct {
 	// the upper limit number of guests with this group in a host
 	Granularity     int   `json:"granularity"`
 	ForceDispersion *bool `json:"force_dispersion,omitempty"`
+	// 拓扑分布约束
+	SpreadConstraints []GroupSpreadConstraint `json:"spread_constraints"`
 }
 
 // SGroupJointsBase is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SGroupJointsBase.
@@ -1062,6 +1092,11 @@ type SGuest struct {
 	Vdi          string  `json:"vdi"`
 	Machine      string  `json:"machine"`
 	Bios         string  `json:"bios"`
+	Vtpm         bool    `json:"vtpm"`
+	// 是否启用内存气球
+	MemBalloon bool `json:"mem_balloon"`
+	// 内存气球回收时保留的最小内存, 单位MB
+	MemBalloonFloor int `json:"mem_balloon_floor"`
 	// 操作系统类型
 	OsType   string `json:"os_type"`
 	FlavorId string `json:"flavor_id"`
@@ -1076,7 +1111,9 @@ type SGuest struct {
 	// example: kvm
 	Hypervisor string `json:"hypervisor"`
 	// 套餐名称
-	InstanceType     string `json:"instance_type"`
+	InstanceType string `json:"instance_type"`
+	// 调度优先级类Id
+	PriorityClassId  string `json:"priority_class_id"`
 	SshableLastState *bool  `json:"sshable_last_state,omitempty"`
 	IsDaemon         *bool  `json:"is_daemon,omitempty"`
 	// 最大内网带宽
@@ -1139,8 +1176,11 @@ type SGuestdisk struct {
 	// Column(VARCHAR(32, charset='ascii'), nullable=True)
 	AioMode string `json:"aio_mode"`
 	// Column(VARCHAR(32, charset='ascii'), nullable=True)
-	Iops       int    `json:"iops"`
-	Bps        int    `json:"bps"`
+	Iops int `json:"iops"`
+	Bps  int `json:"bps"`
+	// minimum iops and bps kept by host io qos controller
+	IopsMin    int    `json:"iops_min"`
+	BpsMin     int    `json:"bps_min"`
 	Mountpoint string `json:"mountpoint"`
 	Index      byte   `json:"index"`
 	// Column(TINYINT(4), nullable=False, default=0)
@@ -1239,6 +1279,8 @@ type SHost struct {
 	MemReserved int `json:"mem_reserved"`
 	// 内存超分比
 	MemCmtbound float32 `json:"mem_cmtbound"`
+	// 内存气球从虚拟机回收的内存大小,单位Mb
+	MemBalloonReclaimed int `json:"mem_balloon_reclaimed"`
 	// 页大小
 	PageSizeKB         int  `json:"page_size_kb"`
 	EnableNumaAllocate bool `json:"enable_numa_allocate"`
@@ -2174,19 +2216,31 @@ type SNetTapFlow struct {
 	VlanId    int    `json:"vlan_id"`
 	Direction string `json:"direction"`
 	FlowId    uint16 `json:"flow_id"`
+	// 按协议过滤镜像流量
+	Protocol string `json:"protocol"`
+	// 按CIDR过滤镜像流量，匹配源地址或目的地址
+	Cidr string `json:"cidr"`
+	// 是否由vpcagent以OVN Mirror镜像，否则由宿主机在br-vpc上镜像
+	OvnMirror bool `json:"ovn_mirror"`
 }
 
 // SNetTapService is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SNetTapService.
 type SNetTapService struct {
 	apis.SEnabledStatusStandaloneResourceBase
-	// 流量采集端类型，虚拟机(guest)还是宿主机(host)
+	// 流量采集端类型，虚拟机(guest)、宿主机(host)还是远端隧道端点(remote)
 	Type string `json:"type"`
-	// 接受流量的目标ID，如果type=host，是hostId，如果type=guest，是guestId
+	// 接受流量的目标ID，如果type=host，是hostId，如果type=guest，是guestId，如果type=remote，为空
 	TargetId string `json:"target_id"`
 	// 接受流量的Mac地址
 	MacAddr string `json:"mac_addr"`
 	// 网卡名称
 	Ifname string `json:"ifname"`
+	// 远端隧道端点IP地址，仅type=remote有效
+	RemoteIp string `json:"remote_ip"`
+	// 远端隧道封装协议，gre或erspan
+	Encap string `json:"encap"`
+	// GRE key或ERSPAN session id
+	TunnelKey int `json:"tunnel_key"`
 }
 
 // SNetwork is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SNetwork.
@@ -2524,12 +2578,74 @@ type SScalingTimer struct {
 	STimer
 }
 
+// SSchedDecision is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SSchedDecision.
+type SSchedDecision struct {
+	apis.SStandaloneAnonResourceBase
+	// 调度会话ID
+	SessionId string `json:"session_id"`
+	// 调度的虚拟机ID列表, 以','分隔
+	GuestIds string `json:"guest_ids"`
+	// 选中的宿主机ID列表, 以','分隔
+	HostIds    string `json:"host_ids"`
+	Hypervisor string `json:"hypervisor"`
+	// 调度算法
+	Algorithm string `json:"algorithm"`
+	// 调度结果, success 或 failed
+	Status string `json:"status"`
+	// 调度失败原因
+	Error string `json:"error"`
+	// 调度请求
+	Request jsonutils.JSONObject `json:"request"`
+	// 通过所有过滤器的候选宿主机及各优先级得分
+	Candidates []SchedDecisionCandidate `json:"candidates"`
+	// 各过滤器耗时
+	Predicates []SchedDecisionPredicateElapsed `json:"predicates"`
+	// 调度总耗时, 单位毫秒
+	ElapsedMs int64 `json:"elapsed_ms"`
+}
+
+// SSchedPreemption is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SSchedPreemption.
+type SSchedPreemption struct {
+	apis.SStandaloneAnonResourceBase
+	// 发起抢占的虚拟机ID
+	PreemptorId string `json:"preemptor_id"`
+	// 发起抢占的虚拟机的优先级类ID
+	PriorityClassId string `json:"priority_class_id"`
+	// 发起抢占的虚拟机的优先级
+	Priority int `json:"priority"`
+	// 驱逐被抢占虚拟机后放置的宿主机ID
+	HostId string `json:"host_id"`
+	// 被抢占的虚拟机
+	Victims []SchedPreemptionVictim `json:"victims"`
+	// 是否仅演练
+	DryRun bool `json:"dry_run"`
+	// dry_run, evicting, success 或 failed
+	Status string `json:"status"`
+	// 失败原因
+	Reason string `json:"reason"`
+}
+
+// SSchedPriorityClass is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SSchedPriorityClass.
+type SSchedPriorityClass struct {
+	apis.SStandaloneResourceBase
+	// 优先级数值, 越大优先级越高
+	Value int `json:"value"`
+	// 抢占策略
+	PreemptionPolicy string `json:"preemption_policy"`
+	// 被抢占虚拟机的处理方式, stop 或 migrate
+	VictimAction string `json:"victim_action"`
+	// 以此优先级类作为默认优先级的项目ID列表, 以','分隔
+	ProjectIds string `json:"project_ids"`
+}
+
 // SSchedpolicy is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SSchedpolicy.
 type SSchedpolicy struct {
 	apis.SStandaloneResourceBase
 	SSchedtagResourceBase
 	Condition string `json:"condition"`
 	Strategy  string `json:"strategy"`
+	// 匹配的虚拟机使用的调度算法, 为空时不改变调度算法
+	Algorithm string `json:"algorithm"`
 	Enabled   *bool  `json:"enabled,omitempty"`
 }
 
@@ -2540,6 +2656,8 @@ type SSchedtag struct {
 	DefaultStrategy string `json:"default_strategy"`
 	// Column(VARCHAR(16, charset='ascii'), nullable=True, default=”)
 	ResourceType string `json:"resource_type"`
+	// 拓扑键, 主机组分布约束 schedtag:<topology_key> 以带有该拓扑键的调度标签为拓扑域
+	TopologyKey string `json:"topology_key"`
 }
 
 // SSchedtagJointsBase is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SSchedtagJointsBase.
@@ -2563,6 +2681,8 @@ type SSecurityGroup struct {
 	SCloudregionResourceBase
 	SGlobalVpcResourceBase
 	SVpcResourceBase
+	// 记录所有规则的命中日志, 仅对OVN VPC生效
+	AclLog bool `json:"acl_log"`
 }
 
 // SSecurityGroupResourceBase is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SSecurityGroupResourceBase.
@@ -2585,6 +2705,10 @@ type SSecurityGroupRule struct {
 	CIDR        string `json:"cidr"`
 	Action      string `json:"action"`
 	Description string `json:"description"`
+	// 记录规则命中日志, 仅对OVN VPC生效
+	AclLog bool `json:"acl_log"`
+	// 对端安全组ID, 仅对OVN VPC生效
+	PeerSecgroupId string `json:"peer_secgroup_id"`
 }
 
 // SServerSku is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SServerSku.
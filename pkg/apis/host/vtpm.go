@@ -0,0 +1,29 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package host
+
+import "yunion.io/x/jsonutils"
+
+// GuestVtpmState carries the TPM state of a guest, a base64 encoded gzipped
+// tarball of the swtpm state directory
+type GuestVtpmState struct {
+	State string `json:"state"`
+}
+
+type GuestVtpmBackupRequest struct {
+	BackupId                string              `json:"backup_id"`
+	BackupStorageId         string              `json:"backup_storage_id"`
+	BackupStorageAccessInfo *jsonutils.JSONDict `json:"backup_storage_access_info"`
+}
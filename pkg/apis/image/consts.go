@@ -46,6 +46,7 @@ const (
 	ImageTypeTemplate = TImageType("image")
 	ImageTypeISO      = TImageType("iso")
 	ImageTypeTarGzip  = TImageType("tgz")
+	ImageTypeOvf      = TImageType("ovf")
 
 	LocalFilePrefix = "file://"
 	S3Prefix        = "s3://"
@@ -82,4 +83,29 @@ const (
 	IMAGE_DISK_FORMAT_DOCKER = "docker"
 	IMAGE_DISK_FORMAT_VHD    = "vhd"
 	IMAGE_DISK_FORMAT_TGZ    = "tgz"
+	IMAGE_DISK_FORMAT_OVA    = "ova"
+	IMAGE_DISK_FORMAT_OVF    = "ovf"
+	IMAGE_DISK_FORMAT_VHDX   = "vhdx"
+)
+
+var (
+	// formats an image can be downloaded as, converted on demand and cached as subformats
+	ImageExportFormats = []string{
+		IMAGE_DISK_FORMAT_QCOW2,
+		IMAGE_DISK_FORMAT_VMDK,
+		IMAGE_DISK_FORMAT_VHD,
+		IMAGE_DISK_FORMAT_VHDX,
+		IMAGE_DISK_FORMAT_OVA,
+	}
+)
+
+const (
+	// metadata of guest image imported from ova/ovf
+	GUEST_IMAGE_OVF_PRODUCT     = "ovf_product"
+	GUEST_IMAGE_OVF_VENDOR      = "ovf_vendor"
+	GUEST_IMAGE_OVF_VERSION     = "ovf_version"
+	GUEST_IMAGE_OVF_PRODUCT_URL = "ovf_product_url"
+	GUEST_IMAGE_OVF_VENDOR_URL  = "ovf_vendor_url"
+	GUEST_IMAGE_OVF_SOURCE      = "ovf_source_image"
+	GUEST_IMAGE_GUEST_TEMPLATE  = "ovf_guest_template_id"
 )
@@ -58,6 +58,9 @@ type ImageListInput struct {
 	Distributions []string `json:"distributions"`
 	// 发行版精确匹配
 	DistributionPreciseMatch bool `json:"distribution_precise_match`
+
+	// 以签名校验状态过滤, 可能值为: unsigned, verified, untrusted, invalid
+	SignatureStatus []string `json:"signature_status"`
 }
 
 type GuestImageListInput struct {
@@ -90,7 +93,7 @@ type ImageCreateInput struct {
 
 	// 镜像大小, 单位Byte
 	Size *int64 `json:"size"`
-	// 镜像格式
+	// 镜像格式, ova/ovf 格式会被解析并导入为主机镜像及主机模板
 	DiskFormat string `json:"disk_format"`
 	// 最小系统盘要求
 	MinDiskMB *int32 `json:"min_disk"`
@@ -107,6 +110,11 @@ type ImageCreateInput struct {
 
 	apis.EncryptedResourceCreateInput
 
+	// 镜像签名, 镜像文件 SHA-256 摘要的签名, base64 编码
+	Signature string `json:"signature"`
+	// 签名密钥ID, 需为镜像所在域已启用的密钥
+	SigningKeyId string `json:"signing_key_id"`
+
 	// 镜像属性
 	Properties map[string]string `json:"properties"`
 }
@@ -122,3 +130,9 @@ type ImageUpdateStatusInput struct {
 
 type PerformProbeInput struct {
 }
+
+type ImageDownloadInput struct {
+	// 导出格式，未缓存的格式会先转换再下载
+	// enum: qcow2, vmdk, vhd, vhdx, ova
+	Format string `json:"format"`
+}
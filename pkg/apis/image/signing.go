@@ -0,0 +1,75 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"yunion.io/x/onecloud/pkg/apis"
+)
+
+const (
+	IMAGE_SIGNING_ALGORITHM_ED25519 = "ed25519"
+	IMAGE_SIGNING_ALGORITHM_X509    = "x509"
+
+	// image properties maintained by the image service, not settable by users
+	IMAGE_SIGNATURE_STATUS = "signature_status"
+
+	// no signature attached
+	IMAGE_SIGNATURE_STATUS_UNSIGNED = "unsigned"
+	// signature matches an enabled key of the image domain
+	IMAGE_SIGNATURE_STATUS_VERIFIED = "verified"
+	// signing key missing, disabled, expired or from another domain
+	IMAGE_SIGNATURE_STATUS_UNTRUSTED = "untrusted"
+	// signature does not match image content
+	IMAGE_SIGNATURE_STATUS_INVALID = "invalid"
+)
+
+type ImageSigningKeyCreateInput struct {
+	apis.EnabledStatusDomainLevelResourceCreateInput
+
+	// 签名算法, 可能值为: ed25519, x509
+	// ed25519 需提供 PEM 格式的公钥, x509 需提供 PEM 格式的证书
+	Algorithm string `json:"algorithm"`
+	// PEM 格式的公钥或证书
+	PublicKey string `json:"public_key"`
+}
+
+type ImageSigningKeyListInput struct {
+	apis.EnabledStatusDomainLevelResourceListInput
+
+	// 以签名算法过滤
+	Algorithm []string `json:"algorithm"`
+	// 以公钥指纹过滤
+	Fingerprint []string `json:"fingerprint"`
+}
+
+type ImageSigningKeyDetails struct {
+	apis.EnabledStatusDomainLevelResourceDetails
+
+	SImageSigningKey
+
+	// 使用此密钥签名的镜像数量
+	ImageCount int `json:"image_count"`
+}
+
+type ImageSigningKeyUpdateInput struct {
+	apis.EnabledStatusDomainLevelResourceBaseUpdateInput
+}
+
+type PerformVerifySignatureInput struct {
+	// 新的签名, base64 编码, 为空则重新校验已有签名
+	Signature string `json:"signature"`
+	// 签名密钥
+	SigningKeyId string `json:"signing_key_id"`
+}
@@ -66,6 +66,10 @@ type SImage struct {
 	OssChecksum string `json:"oss_checksum"`
 	// 加密状态, "",encrypting,encrypted
 	EncryptStatus string `json:"encrypt_status"`
+	// 镜像签名, base64 编码
+	Signature string `json:"signature"`
+	// 签名密钥ID
+	SigningKeyId string `json:"signing_key_id"`
 }
 
 // SImagePeripheral is an autogenerated struct via yunion.io/x/onecloud/pkg/image/models.SImagePeripheral.
@@ -74,3 +78,14 @@ type SImagePeripheral struct {
 	Id      int    `json:"id"`
 	ImageId string `json:"image_id"`
 }
+
+// SImageSigningKey is an autogenerated struct via yunion.io/x/onecloud/pkg/image/models.SImageSigningKey.
+type SImageSigningKey struct {
+	apis.SEnabledStatusDomainLevelResourceBase
+	// 签名算法
+	Algorithm string `json:"algorithm"`
+	// PEM 格式的公钥或证书
+	PublicKey string `json:"public_key"`
+	// 公钥指纹
+	Fingerprint string `json:"fingerprint"`
+}
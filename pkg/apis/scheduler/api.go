@@ -223,3 +223,18 @@ type ScheduleOutput struct {
 
 	Candidates []*CandidateResource `json:"candidates"`
 }
+
+// PreemptOutput is the preemption plan of a schedule input which has no
+// fitting candidate
+type PreemptOutput struct {
+	apis.Meta
+
+	// Priority is the priority value of the preemptor
+	Priority int `json:"priority"`
+	// HostId is the host the preemptor is able to place on after the
+	// victims evicted, empty means no plan found
+	HostId  string                          `json:"host_id"`
+	Victims []compute.SchedPreemptionVictim `json:"victims"`
+	// Error is the reason why no plan found
+	Error string `json:"error"`
+}
@@ -64,3 +64,41 @@ type TaskDetails struct {
 	Stage        string
 	ParentTaskId string
 }
+
+type TaskCancelInput struct {
+	// 取消原因
+	Reason string `json:"reason"`
+}
+
+type TaskRecoveryRecord struct {
+	Id       string `json:"id"`
+	TaskName string `json:"task_name"`
+	ObjType  string `json:"obj_type"`
+	ObjId    string `json:"obj_id"`
+	Object   string `json:"object"`
+	// 服务重启时任务所处的阶段
+	Stage string `json:"stage"`
+	// 恢复方式
+	// enum: resume,requery,fail,wait
+	Action string `json:"action"`
+	// 恢复失败或任务被置为失败的原因
+	Reason string `json:"reason"`
+}
+
+type TaskRecoveryReport struct {
+	// 恢复开始时间
+	StartAt time.Time `json:"start_at"`
+	// 恢复结束时间
+	EndAt time.Time `json:"end_at"`
+
+	// 重新驱动的任务数量
+	Resumed int `json:"resumed"`
+	// 重新查询状态的任务数量
+	Requeried int `json:"requeried"`
+	// 置为失败的任务数量
+	Failed int `json:"failed"`
+	// 保持原状等待回调或子任务完成的任务数量
+	Waiting int `json:"waiting"`
+
+	Tasks []TaskRecoveryRecord `json:"tasks"`
+}
@@ -78,6 +78,8 @@ type Application struct {
 	isTLS bool
 
 	enableProfiling bool
+
+	metrics *sAppMetrics
 }
 
 const (
@@ -106,6 +108,7 @@ func NewApplication(name string, connMax int, db bool) *Application {
 		readHeaderTimeout: DEFAULT_READ_HEADER_TIMEOUT,
 		writeTimeout:      DEFAULT_WRITE_TIMEOUT,
 		processTimeout:    DEFAULT_PROCESS_TIMEOUT,
+		metrics:           newAppMetrics(name),
 	}
 	app.SetContext(appctx.APP_CONTEXT_KEY_APP, &app)
 	app.SetContext(appctx.APP_CONTEXT_KEY_APPNAME, app.name)
@@ -273,8 +276,10 @@ func (app *Application) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	} else {
 		counter = &hi.counter5XX
 	}
-	duration := float64(time.Since(start).Nanoseconds()) / 1000000
+	elapsed := time.Since(start)
+	duration := float64(elapsed.Nanoseconds()) / 1000000
 	counter.hit += 1
+	app.metrics.observe(r.Method, hi, lrw.status, elapsed)
 	counter.duration += duration
 	skipLog := false
 	if params != nil {
@@ -460,6 +465,17 @@ func (app *Application) addDefaultHandlers() {
 	app.AddDefaultHandler("GET", "/ping", PingHandler, "ping")
 	app.AddDefaultHandler("GET", "/worker_stats", WorkerStatsHandler, "worker_stats")
 	app.AddDefaultHandler("GET", "/process_stats", ProcessStatsHandler, "process_stats")
+	app.addMetricsHandler()
+}
+
+func (app *Application) addMetricsHandler() {
+	hi := newHandlerInfo("GET", SplitPath("/metrics"), MetricsHandler, nil, "metrics", nil)
+	hi.SetSkipLog(true).SetWorkerManager(app.systemSession)
+	// resources named metrics, e.g. of monitor service, take precedence
+	err := app.getRoot(hi.method).Add(hi.path, hi)
+	if err != nil {
+		log.Warningf("metrics handler not added: %s", err)
+	}
 }
 
 func timeoutHandle(h http.Handler) http.HandlerFunc {
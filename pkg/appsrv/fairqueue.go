@@ -0,0 +1,229 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appsrv
+
+import (
+	"container/list"
+	"sync"
+)
+
+type TWorkerPriority int
+
+const (
+	// background jobs, e.g. syncing with cloud providers
+	WORKER_PRIORITY_BACKGROUND = TWorkerPriority(-1)
+	WORKER_PRIORITY_NORMAL     = TWorkerPriority(0)
+	// interactive API requests and operator tasks
+	WORKER_PRIORITY_INTERACTIVE = TWorkerPriority(1)
+
+	workerPriorityCount = int(WORKER_PRIORITY_INTERACTIVE-WORKER_PRIORITY_BACKGROUND) + 1
+)
+
+// IFairWorkerTask is optionally implemented by the worker tasks to be queued
+// by key, e.g. project id, when fair queuing is enabled, the tasks of
+// different keys are served in weighted round robin
+type IFairWorkerTask interface {
+	GetFairQueueKey() string
+}
+
+// IPriorityWorkerTask is optionally implemented by the worker tasks to be
+// queued in a priority lane when fair queuing is enabled, a higher lane is
+// always served before the lower ones, WORKER_PRIORITY_NORMAL if not
+// implemented
+type IPriorityWorkerTask interface {
+	GetWorkerPriority() TWorkerPriority
+}
+
+type SFairQueueOptions struct {
+	// weight of a key, the key is served weight tasks in each round, 1 if
+	// not set or non-positive
+	Weight func(key string) int
+	// max queued tasks of each key, the tasks over limit are dropped, only
+	// limited by the queue capacity if zero
+	KeyLimit int
+}
+
+func (opts *SFairQueueOptions) getWeight(key string) int {
+	if opts.Weight == nil {
+		return 1
+	}
+	if weight := opts.Weight(key); weight > 0 {
+		return weight
+	}
+	return 1
+}
+
+type iWorkerQueue interface {
+	Push(val interface{}) bool
+	Pop() interface{}
+	Capacity() int
+	Size() int
+	Range(proc func(obj interface{}) bool)
+}
+
+// sFairLane queues the tasks of a priority by key
+type sFairLane struct {
+	queues map[string]*list.List
+	// keys having queued tasks in round robin order
+	keys   *list.List
+	cursor *list.Element
+	credit int
+	size   int
+}
+
+func newFairLane() *sFairLane {
+	return &sFairLane{
+		queues: make(map[string]*list.List),
+		keys:   list.New(),
+	}
+}
+
+func (lane *sFairLane) push(key string, val interface{}) {
+	q, ok := lane.queues[key]
+	if !ok {
+		q = list.New()
+		lane.queues[key] = q
+		lane.keys.PushBack(key)
+	}
+	q.PushBack(val)
+	lane.size += 1
+}
+
+func (lane *sFairLane) pop(opts *SFairQueueOptions) interface{} {
+	if lane.cursor == nil {
+		lane.cursor = lane.keys.Front()
+		lane.credit = opts.getWeight(lane.cursor.Value.(string))
+	}
+	key := lane.cursor.Value.(string)
+	q := lane.queues[key]
+	val := q.Remove(q.Front())
+	lane.size -= 1
+	lane.credit -= 1
+	next := lane.cursor
+	if q.Len() == 0 {
+		next = lane.cursor.Next()
+		lane.keys.Remove(lane.cursor)
+		delete(lane.queues, key)
+	} else if lane.credit <= 0 {
+		next = lane.cursor.Next()
+	}
+	if next != lane.cursor {
+		lane.cursor = next
+		if next != nil {
+			lane.credit = opts.getWeight(next.Value.(string))
+		}
+	}
+	return val
+}
+
+// sFairQueue serves the priority lanes strictly, and the keys in a lane
+// in weighted round robin
+type sFairQueue struct {
+	lanes    [workerPriorityCount]*sFairLane
+	capacity int
+	size     int
+	opts     SFairQueueOptions
+	classify func(val interface{}) (TWorkerPriority, string)
+	lock     *sync.Mutex
+}
+
+func newFairQueue(capacity int, opts SFairQueueOptions, classify func(val interface{}) (TWorkerPriority, string)) *sFairQueue {
+	q := &sFairQueue{
+		capacity: capacity,
+		opts:     opts,
+		classify: classify,
+		lock:     &sync.Mutex{},
+	}
+	for i := range q.lanes {
+		q.lanes[i] = newFairLane()
+	}
+	return q
+}
+
+func (q *sFairQueue) Push(val interface{}) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.size >= q.capacity {
+		return false
+	}
+	prio, key := q.classify(val)
+	if prio < WORKER_PRIORITY_BACKGROUND {
+		prio = WORKER_PRIORITY_BACKGROUND
+	} else if prio > WORKER_PRIORITY_INTERACTIVE {
+		prio = WORKER_PRIORITY_INTERACTIVE
+	}
+	lane := q.lanes[prio-WORKER_PRIORITY_BACKGROUND]
+	if q.opts.KeyLimit > 0 {
+		if kq, ok := lane.queues[key]; ok && kq.Len() >= q.opts.KeyLimit {
+			return false
+		}
+	}
+	lane.push(key, val)
+	q.size += 1
+	return true
+}
+
+func (q *sFairQueue) Pop() interface{} {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for i := len(q.lanes) - 1; i >= 0; i-- {
+		if q.lanes[i].size > 0 {
+			q.size -= 1
+			return q.lanes[i].pop(&q.opts)
+		}
+	}
+	return nil
+}
+
+func (q *sFairQueue) Capacity() int {
+	return q.capacity
+}
+
+func (q *sFairQueue) Size() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.size
+}
+
+func (q *sFairQueue) Range(proc func(obj interface{}) bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for i := len(q.lanes) - 1; i >= 0; i-- {
+		for k := q.lanes[i].keys.Front(); k != nil; k = k.Next() {
+			for e := q.lanes[i].queues[k.Value.(string)].Front(); e != nil; e = e.Next() {
+				if !proc(e.Value) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func classifyWorkerTask(val interface{}) (TWorkerPriority, string) {
+	task := val.(*sWorkerTask).task
+	prio := WORKER_PRIORITY_NORMAL
+	if t, ok := task.(IPriorityWorkerTask); ok {
+		prio = t.GetWorkerPriority()
+	}
+	var key string
+	if t, ok := task.(IFairWorkerTask); ok {
+		key = t.GetFairQueueKey()
+	}
+	return prio, key
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appsrv
+
+import (
+	"strings"
+	"testing"
+)
+
+type fairItem struct {
+	prio TWorkerPriority
+	key  string
+	name string
+}
+
+func classifyFairItem(val interface{}) (TWorkerPriority, string) {
+	item := val.(fairItem)
+	return item.prio, item.key
+}
+
+func TestFairQueue(t *testing.T) {
+	cases := []struct {
+		name  string
+		opts  SFairQueueOptions
+		items []fairItem
+		want  string
+	}{
+		{
+			name: "round robin",
+			items: []fairItem{
+				{key: "a", name: "a1"}, {key: "a", name: "a2"}, {key: "a", name: "a3"},
+				{key: "b", name: "b1"}, {key: "c", name: "c1"}, {key: "b", name: "b2"},
+			},
+			want: "a1,b1,c1,a2,b2,a3",
+		},
+		{
+			name: "weighted",
+			opts: SFairQueueOptions{Weight: func(key string) int {
+				if key == "a" {
+					return 2
+				}
+				return 1
+			}},
+			items: []fairItem{
+				{key: "a", name: "a1"}, {key: "a", name: "a2"}, {key: "a", name: "a3"},
+				{key: "b", name: "b1"}, {key: "b", name: "b2"},
+			},
+			want: "a1,a2,b1,a3,b2",
+		},
+		{
+			name: "priority lanes",
+			items: []fairItem{
+				{prio: WORKER_PRIORITY_BACKGROUND, key: "a", name: "sync"},
+				{key: "a", name: "normal"},
+				{prio: WORKER_PRIORITY_INTERACTIVE, key: "b", name: "api"},
+			},
+			want: "api,normal,sync",
+		},
+		{
+			name: "key limit",
+			opts: SFairQueueOptions{KeyLimit: 2},
+			items: []fairItem{
+				{key: "a", name: "a1"}, {key: "a", name: "a2"}, {key: "a", name: "a3"},
+				{key: "b", name: "b1"},
+			},
+			want: "a1,b1,a2",
+		},
+	}
+	for _, c := range cases {
+		q := newFairQueue(10, c.opts, classifyFairItem)
+		for _, item := range c.items {
+			q.Push(item)
+		}
+		names := []string{}
+		for q.Size() > 0 {
+			names = append(names, q.Pop().(fairItem).name)
+		}
+		if got := strings.Join(names, ","); got != c.want {
+			t.Errorf("%s: want %s got %s", c.name, c.want, got)
+		}
+	}
+}
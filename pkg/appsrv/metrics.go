@@ -0,0 +1,176 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appsrv
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "appsrv"
+
+var (
+	workerLabels = []string{"worker_manager", "db_worker"}
+
+	workerQueueDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "worker", "queue_length"),
+		"Number of the tasks waiting in the queue of the worker manager",
+		workerLabels, nil,
+	)
+	workerQueueCapacityDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "worker", "queue_capacity"),
+		"Capacity of the queue of the worker manager, the backlog times the max worker count",
+		workerLabels, nil,
+	)
+	workerMaxDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "worker", "max_workers"),
+		"Max number of the active workers of the worker manager",
+		workerLabels, nil,
+	)
+	workerActiveDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "worker", "active_workers"),
+		"Number of the active workers of the worker manager",
+		workerLabels, nil,
+	)
+	workerDetachedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "worker", "detached_workers"),
+		"Number of the workers detached from the worker manager by long running tasks",
+		workerLabels, nil,
+	)
+	workerDroppedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "worker", "dropped_tasks_total"),
+		"Number of the tasks dropped due to the queue of the worker manager is full",
+		workerLabels, nil,
+	)
+	dbConnectionDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "db", "connections"),
+		"Number of the database connections used by the db workers",
+		nil, nil,
+	)
+)
+
+// sWorkerCollector collects the states of all worker managers at scrape time
+type sWorkerCollector struct{}
+
+func (c sWorkerCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		workerQueueDesc,
+		workerQueueCapacityDesc,
+		workerMaxDesc,
+		workerActiveDesc,
+		workerDetachedDesc,
+		workerDroppedDesc,
+		dbConnectionDesc,
+	} {
+		ch <- desc
+	}
+}
+
+func (c sWorkerCollector) Collect(ch chan<- prometheus.Metric) {
+	workerManagerLock.Lock()
+	managers := make([]*SWorkerManager, len(workerManagers))
+	copy(managers, workerManagers)
+	workerManagerLock.Unlock()
+
+	// worker managers of the same name are summed up
+	type sWorkerMetrics struct {
+		dbWorker                                      bool
+		queue, capacity, max, active, detach, dropped float64
+	}
+	names := make([]string, 0)
+	metrics := make(map[string]*sWorkerMetrics)
+	for _, wm := range managers {
+		m, ok := metrics[wm.name]
+		if !ok {
+			m = &sWorkerMetrics{dbWorker: wm.dbWorker}
+			metrics[wm.name] = m
+			names = append(names, wm.name)
+		}
+		wm.workerLock.Lock()
+		m.queue += float64(wm.queue.Size())
+		m.capacity += float64(wm.queue.Capacity())
+		m.max += float64(wm.workerCount)
+		m.active += float64(wm.activeWorker.size())
+		m.detach += float64(wm.detachedWorker.size())
+		wm.workerLock.Unlock()
+		m.dropped += float64(atomic.LoadInt64(&wm.droppedCount))
+	}
+	for _, name := range names {
+		m := metrics[name]
+		labels := []string{name, fmt.Sprintf("%v", m.dbWorker)}
+		ch <- prometheus.MustNewConstMetric(workerQueueDesc, prometheus.GaugeValue, m.queue, labels...)
+		ch <- prometheus.MustNewConstMetric(workerQueueCapacityDesc, prometheus.GaugeValue, m.capacity, labels...)
+		ch <- prometheus.MustNewConstMetric(workerMaxDesc, prometheus.GaugeValue, m.max, labels...)
+		ch <- prometheus.MustNewConstMetric(workerActiveDesc, prometheus.GaugeValue, m.active, labels...)
+		ch <- prometheus.MustNewConstMetric(workerDetachedDesc, prometheus.GaugeValue, m.detach, labels...)
+		ch <- prometheus.MustNewConstMetric(workerDroppedDesc, prometheus.CounterValue, m.dropped, labels...)
+	}
+	ch <- prometheus.MustNewConstMetric(dbConnectionDesc, prometheus.GaugeValue, float64(GetDBConnectionCount()))
+}
+
+// sAppMetrics is the metrics registry of an application
+type sAppMetrics struct {
+	registry *prometheus.Registry
+	duration *prometheus.HistogramVec
+}
+
+func newAppMetrics(name string) *sAppMetrics {
+	m := &sAppMetrics{
+		registry: prometheus.NewRegistry(),
+		duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace:   metricsNamespace,
+				Subsystem:   "http",
+				Name:        "request_duration_seconds",
+				Help:        "Latency of the requests by route",
+				ConstLabels: prometheus.Labels{"app": name},
+				Buckets:     []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+			},
+			[]string{"method", "route", "code"},
+		),
+	}
+	m.registry.MustRegister(
+		m.duration,
+		sWorkerCollector{},
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+func (m *sAppMetrics) observe(method string, hi *SHandlerInfo, status int, duration time.Duration) {
+	route := hi.GetName(nil)
+	if len(hi.path) == 0 && len(hi.name) == 0 {
+		// requests not matching any handler
+		route = "unmatched"
+	}
+	code := fmt.Sprintf("%dxx", status/100)
+	m.duration.WithLabelValues(method, route, code).Observe(duration.Seconds())
+}
+
+// MetricsHandler exports the worker manager states and the request latency
+// of the application in prometheus text or openmetrics format
+func MetricsHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	app := AppContextApp(ctx)
+	promhttp.HandlerFor(app.metrics.registry, promhttp.HandlerOpts{
+		EnableOpenMetrics: true,
+	}).ServeHTTP(w, r)
+}
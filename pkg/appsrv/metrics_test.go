@@ -0,0 +1,43 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appsrv
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	app := NewApplication("metrics-test", 2, false)
+	app.AddHandler("GET", "/ping-metrics", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		Send(w, "pong")
+	})
+	app.addMetricsHandler()
+	// a duplicated metrics handler is ignored
+	app.addMetricsHandler()
+
+	assert.HTTPBodyContains(t, app.ServeHTTP, "GET", "/ping-metrics", nil, "pong")
+	for _, metric := range []string{
+		`appsrv_http_request_duration_seconds_count{app="metrics-test",code="2xx",method="GET",route="get_ping-metrics"} 1`,
+		`appsrv_worker_queue_length{db_worker="false",worker_manager="HttpGetRequestWorkerManager"}`,
+		`appsrv_worker_dropped_tasks_total`,
+		`appsrv_db_connections`,
+	} {
+		assert.HTTPBodyContains(t, app.ServeHTTP, "GET", "/metrics", nil, metric)
+	}
+}
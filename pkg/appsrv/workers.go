@@ -21,6 +21,7 @@ import (
 	"net/http"
 	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"yunion.io/x/jsonutils"
@@ -169,7 +170,7 @@ func (wl *SWorkerList) size() int {
 
 type SWorkerManager struct {
 	name           string
-	queue          *Ring
+	queue          iWorkerQueue
 	workerCount    int
 	backlog        int
 	activeWorker   *SWorkerList
@@ -179,9 +180,13 @@ type SWorkerManager struct {
 	dbWorker       bool
 
 	ignoreOverflow bool
+	// count of the tasks dropped due to queue full
+	droppedCount int64
 
 	cancelPrevIdent bool
 
+	fairQueue *SFairQueueOptions
+
 	queueInitHook  func() error
 	queueEmptyHook func() error
 }
@@ -237,13 +242,33 @@ func (wm *SWorkerManager) EnableCancelPreviousIdenticalTask() {
 	wm.cancelPrevIdent = true
 }
 
+// EnableFairQueue queues the tasks in priority lanes and by the keys of
+// the tasks, see IPriorityWorkerTask and IFairWorkerTask
+func (wm *SWorkerManager) EnableFairQueue(opts SFairQueueOptions) error {
+	wm.workerLock.Lock()
+	defer wm.workerLock.Unlock()
+	if wm.queue.Size() > 0 {
+		return errors.Errorf("worker queue is not empty")
+	}
+	wm.fairQueue = &opts
+	wm.queue = wm.newQueue(wm.workerCount)
+	return nil
+}
+
+func (wm *SWorkerManager) newQueue(workerCount int) iWorkerQueue {
+	if wm.fairQueue != nil {
+		return newFairQueue(workerCount*wm.backlog, *wm.fairQueue, classifyWorkerTask)
+	}
+	return NewRing(workerCount * wm.backlog)
+}
+
 func (wm *SWorkerManager) UpdateWorkerCount(workerCount int) error {
 	wm.workerLock.Lock()
 	defer wm.workerLock.Unlock()
 	if wm.queue.Size() > 0 {
 		return errors.Errorf("worker queue is not empty")
 	}
-	wm.queue = NewRing(workerCount * wm.backlog)
+	wm.queue = wm.newQueue(workerCount)
 	wm.workerCount = workerCount
 	return nil
 }
@@ -256,8 +281,11 @@ func (wm *SWorkerManager) Run(task IWorkerTask, worker chan *SWorker, onErr func
 	ret := wm.queue.Push(&sWorkerTask{task: task, worker: worker, onError: onErr})
 	if ret {
 		wm.schedule()
-	} else if !wm.ignoreOverflow {
-		log.Warningf("[%s] queue full, task dropped", wm)
+	} else {
+		atomic.AddInt64(&wm.droppedCount, 1)
+		if !wm.ignoreOverflow {
+			log.Warningf("[%s] queue full, task dropped", wm)
+		}
 	}
 	return ret
 }
@@ -345,6 +373,8 @@ type SWorkerManagerStates struct {
 	DetachWorkerCnt int
 	DbWorker        bool
 	AllowOverflow   bool
+	DroppedCnt      int64
+	FairQueue       bool
 }
 
 func (s SWorkerManagerStates) IsBusy() bool {
@@ -365,6 +395,8 @@ func (wm *SWorkerManager) getState() SWorkerManagerStates {
 	state.DetachWorkerCnt = wm.detachedWorker.size()
 	state.DbWorker = wm.dbWorker
 	state.AllowOverflow = wm.ignoreOverflow
+	state.DroppedCnt = atomic.LoadInt64(&wm.droppedCount)
+	state.FairQueue = wm.fairQueue != nil
 
 	return state
 }
@@ -14,7 +14,13 @@
 
 package consts
 
-import "yunion.io/x/log"
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"yunion.io/x/log"
+)
 
 var (
 	QueryOffsetOptimization = false
@@ -30,6 +36,12 @@ var (
 	taskWorkerCount      int
 	localTaskWorkerCount int
 
+	taskInstanceId string
+
+	taskFairQueueWeights     = map[string]int{}
+	taskFairQueueWeightsLock = &sync.RWMutex{}
+	taskFairQueueKeyLimit    int
+
 	enableChangeOwnerAutoRename = false
 )
 
@@ -66,6 +78,56 @@ func SetLocalTaskWorkerCount(cnt int) {
 	localTaskWorkerCount = cnt
 }
 
+func SetTaskInstanceId(id string) {
+	taskInstanceId = id
+}
+
+// TaskInstanceId returns the configured id of the service instance owning
+// the tasks, empty if not set
+func TaskInstanceId() string {
+	return taskInstanceId
+}
+
+// SetTaskFairQueueWeights parses the weights in the form of <key>:<weight>,
+// the malformed ones are ignored
+func SetTaskFairQueueWeights(weights []string) {
+	parsed := make(map[string]int, len(weights))
+	for _, w := range weights {
+		idx := strings.LastIndex(w, ":")
+		if idx <= 0 {
+			log.Errorf("invalid task fair queue weight %q", w)
+			continue
+		}
+		weight, err := strconv.Atoi(w[idx+1:])
+		if err != nil || weight <= 0 {
+			log.Errorf("invalid task fair queue weight %q", w)
+			continue
+		}
+		parsed[w[:idx]] = weight
+	}
+	taskFairQueueWeightsLock.Lock()
+	defer taskFairQueueWeightsLock.Unlock()
+	taskFairQueueWeights = parsed
+}
+
+// TaskFairQueueWeight returns the weight of the key in the task fair queue,
+// 0 if not set
+func TaskFairQueueWeight(key string) int {
+	taskFairQueueWeightsLock.RLock()
+	defer taskFairQueueWeightsLock.RUnlock()
+	return taskFairQueueWeights[key]
+}
+
+func SetTaskFairQueueKeyLimit(limit int) {
+	taskFairQueueKeyLimit = limit
+}
+
+// TaskFairQueueKeyLimit returns the max queued tasks of each key in the task
+// fair queue, 0 if not limited
+func TaskFairQueueKeyLimit() int {
+	return taskFairQueueKeyLimit
+}
+
 func SetChangeOwnerAutoRename(enable bool) {
 	enableChangeOwnerAutoRename = enable
 }
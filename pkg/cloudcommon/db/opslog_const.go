@@ -80,6 +80,10 @@ const (
 	ACT_VM_CONVERTING   = "vm_converting"
 	ACT_VM_CONVERT_FAIL = "vm_convert_fail"
 
+	ACT_VM_RELOCATE      = "vm_relocate"
+	ACT_VM_RELOCATING    = "vm_relocating"
+	ACT_VM_RELOCATE_FAIL = "vm_relocate_fail"
+
 	ACT_SPLIT       = "net_split"
 	ACT_MERGE       = "net_merge"
 	ACT_IP_MAC_BIND = "ip_mac_bind"
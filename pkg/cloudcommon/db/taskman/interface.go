@@ -48,3 +48,28 @@ type ITask interface {
 	SetProgressAndStatus(progress float32, status string) error
 	SetProgress(progress float32) error
 }
+
+const (
+	// re-drive the task from the stage which launched current stage
+	TASK_RECOVERY_RESUME = "resume"
+	// query the host or cloud for the real state of current stage, the
+	// task must implement ITaskRequery
+	TASK_RECOVERY_REQUERY = "requery"
+	// fail the task, only when the task declares so for the stage
+	TASK_RECOVERY_FAIL = "fail"
+	// leave the task alone, waiting for the callback or its subtasks, the
+	// default of the tasks not implementing ITaskRecovery
+	TASK_RECOVERY_WAIT = "wait"
+)
+
+// ITaskRecovery declares how to recover a task interrupted by service
+// restart at the stage
+type ITaskRecovery interface {
+	GetRecoveryKind(stage string) string
+}
+
+// ITaskRequery queries the real state of the interrupted stage, the returned
+// data is passed to the stage as if the callback arrived, an error fails it
+type ITaskRequery interface {
+	RequeryStage(ctx context.Context, stage string) (jsonutils.JSONObject, error)
+}
@@ -0,0 +1,396 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package taskman
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/gotypes"
+	"yunion.io/x/pkg/utils"
+
+	"yunion.io/x/onecloud/pkg/apis"
+	"yunion.io/x/onecloud/pkg/appsrv"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/lockman"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/logclient"
+)
+
+const (
+	TASK_CANCELLED_KEY      = "__cancelled"
+	TASK_STAGE_DEADLINE_KEY = "__stage_deadline"
+
+	taskCancelledStageKey = "__cancelled_stage"
+	taskCancelHandledKey  = "__cancel_handled"
+
+	taskRetryStageKey = "__retry_stage"
+	taskRetryDataKey  = "__retry_data"
+	taskRetriesKey    = "__retries"
+)
+
+// SRetryPolicy retries a failed stage by calling again the stage which
+// launched it, with the same data
+type SRetryPolicy struct {
+	// the max retry times of each stage
+	MaxRetries int
+	// the delay before the first retry, doubled on each retry
+	Backoff time.Duration
+	// the upper bound of the delay, no bound if zero
+	MaxBackoff time.Duration
+	// the failed stages to retry, e.g. OnDeployComplete, all stages if empty
+	Stages []string
+}
+
+// STaskPolicy is the timeout and retry policy of a task class
+type STaskPolicy struct {
+	// the timeout of every stage, no timeout if zero
+	StageTimeout time.Duration
+	// the timeout of the stages keyed by stage name, overrides StageTimeout
+	StageTimeouts map[string]time.Duration
+
+	Retry *SRetryPolicy
+
+	// the priority lane in task worker queue, decided by whether the task
+	// is started by an API request if not set
+	Priority *appsrv.TWorkerPriority
+}
+
+var taskPolicyTable = make(map[string]*STaskPolicy)
+
+// RegisterTaskPolicy sets the policy of a registered task, e.g.
+//
+//	taskman.RegisterTaskPolicy(GuestLiveMigrateTask{}, taskman.STaskPolicy{
+//		StageTimeouts: map[string]time.Duration{"OnStartDestComplete": 10 * time.Minute},
+//	})
+func RegisterTaskPolicy(task interface{}, policy STaskPolicy) {
+	taskName := gotypes.GetInstanceTypeName(task)
+	if !isTaskExist(taskName) {
+		log.Fatalf("Task %s not registered", taskName)
+	}
+	taskPolicyTable[taskName] = &policy
+}
+
+func getTaskPolicy(taskName string) *STaskPolicy {
+	return taskPolicyTable[taskName]
+}
+
+func (policy *STaskPolicy) getStageTimeout(stage string) time.Duration {
+	if timeout, ok := policy.StageTimeouts[stage]; ok {
+		return timeout
+	}
+	return policy.StageTimeout
+}
+
+func (retry *SRetryPolicy) getBackoff(retried int) time.Duration {
+	backoff := retry.Backoff
+	for i := 0; i < retried; i++ {
+		backoff *= 2
+		if retry.MaxBackoff > 0 && backoff > retry.MaxBackoff {
+			return retry.MaxBackoff
+		}
+	}
+	return backoff
+}
+
+func (retry *SRetryPolicy) isRetryStage(stage string) bool {
+	return len(retry.Stages) == 0 || utils.IsInStringArray(stage, retry.Stages)
+}
+
+func (task *STask) isFinished() bool {
+	return utils.IsInStringArray(task.Stage, []string{TASK_STAGE_COMPLETE, TASK_STAGE_FAILED})
+}
+
+// IsCancelled tells whether the pending stage of the task is cancelled,
+// long running stages could check it to quit early. The stages entered by
+// the failure handler, e.g. rollback and cleanup, are not cancelled
+func (task *STask) IsCancelled() bool {
+	if task.Params == nil || !task.Params.Contains(TASK_CANCELLED_KEY) {
+		return false
+	}
+	stage, _ := task.Params.GetString(taskCancelledStageKey)
+	return stage == task.Stage
+}
+
+func (task *STask) isCancelHandled() bool {
+	handled, _ := task.Params.Bool(taskCancelHandledKey)
+	return handled
+}
+
+// markCancelHandled records that the failure handler of the cancelled stage
+// has been called, the late callbacks of the stage are dropped
+func (task *STask) markCancelHandled() error {
+	params := jsonutils.NewDict()
+	params.Add(jsonutils.JSONTrue, taskCancelHandledKey)
+	return task.SaveParams(params)
+}
+
+func (task *STask) getCancelReason() string {
+	reason, _ := task.Params.GetString(TASK_CANCELLED_KEY)
+	return reason
+}
+
+func taskFailureBody(reason string) *jsonutils.JSONDict {
+	body := jsonutils.NewDict()
+	body.Add(jsonutils.NewString("error"), "__status__")
+	body.Add(jsonutils.NewString(reason), "__reason__")
+	return body
+}
+
+// stageDeadline returns the deadline of current stage to be saved in
+// params, zero if the stage has no timeout
+func (task *STask) stageDeadline(stage string) time.Time {
+	policy := getTaskPolicy(task.TaskName)
+	if policy == nil {
+		return time.Time{}
+	}
+	timeout := policy.getStageTimeout(stage)
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+func (task *STask) armStageTimeout() {
+	deadline, err := task.Params.GetTime(TASK_STAGE_DEADLINE_KEY)
+	if err != nil || deadline.IsZero() {
+		return
+	}
+	taskId, stage := task.Id, task.Stage
+	time.AfterFunc(time.Until(deadline), func() {
+		TaskManager.checkStageTimeout(taskId, stage)
+	})
+}
+
+// isStageExpired tells whether the stage is still pending past its deadline,
+// the stage re-entered by retry has a new deadline
+func (task *STask) isStageExpired(stage string, now time.Time) bool {
+	if task.Stage != stage || task.isFinished() || task.IsCancelled() || task.Params == nil {
+		return false
+	}
+	deadline, _ := task.Params.GetTime(TASK_STAGE_DEADLINE_KEY)
+	return !deadline.IsZero() && !now.Before(deadline)
+}
+
+func (manager *STaskManager) checkStageTimeout(taskId, stage string) {
+	ctx := context.Background()
+	var reason string
+	func() {
+		lockman.LockRawObject(ctx, "tasks", taskId)
+		defer lockman.ReleaseRawObject(ctx, "tasks", taskId)
+
+		task := manager.fetchTask(taskId)
+		if task == nil || !task.isStageExpired(stage, time.Now()) {
+			return
+		}
+		reason = fmt.Sprintf("stage %s timeout", stage)
+		log.Errorf("Task %s %s, fail it", task.String(), reason)
+		task.cancelSubtasks(ctx, reason)
+	}()
+	if len(reason) > 0 {
+		err := runTask(taskId, taskFailureBody(reason))
+		if err != nil {
+			log.Errorf("run timeout task %s: %v", taskId, err)
+		}
+	}
+}
+
+// saveRetryPoint remembers the stage and data about to run, so a failure
+// of the stage launched by it could be retried, or the task could be
+// resumed after service restart
+func (task *STask) saveRetryPoint(data jsonutils.JSONObject, recoverable bool) {
+	policy := getTaskPolicy(task.TaskName)
+	if !recoverable && (policy == nil || policy.Retry == nil) {
+		return
+	}
+	params := jsonutils.NewDict()
+	params.Add(jsonutils.NewString(task.Stage), taskRetryStageKey)
+	params.Add(data, taskRetryDataKey)
+	task.SaveParams(params)
+}
+
+type sStageRetry struct {
+	stage   string
+	data    jsonutils.JSONObject
+	retries *jsonutils.JSONDict
+	backoff time.Duration
+}
+
+// getStageRetry returns the retry of the failed stage, false if the stage is
+// not retried by the policy, or its retries are used up
+func (task *STask) getStageRetry(policy *STaskPolicy) (*sStageRetry, bool) {
+	if policy == nil || policy.Retry == nil || !policy.Retry.isRetryStage(task.Stage) {
+		return nil, false
+	}
+	retryStage, _ := task.Params.GetString(taskRetryStageKey)
+	retryData, _ := task.Params.Get(taskRetryDataKey)
+	if len(retryStage) == 0 || retryData == nil {
+		return nil, false
+	}
+	retries := jsonutils.NewDict()
+	if prev, _ := task.Params.Get(taskRetriesKey); prev != nil {
+		retries.Update(prev)
+	}
+	retried, _ := retries.Int(task.Stage)
+	if int(retried) >= policy.Retry.MaxRetries {
+		return nil, false
+	}
+	retries.Set(task.Stage, jsonutils.NewInt(retried+1))
+	return &sStageRetry{
+		stage:   retryStage,
+		data:    retryData,
+		retries: retries,
+		backoff: policy.Retry.getBackoff(int(retried)),
+	}, true
+}
+
+// retryStage schedules a retry of the failed stage if the retry policy of
+// the task allows
+func (task *STask) retryStage(ctx context.Context, reason jsonutils.JSONObject) bool {
+	policy := getTaskPolicy(task.TaskName)
+	retry, ok := task.getStageRetry(policy)
+	if !ok {
+		return false
+	}
+	retried, _ := retry.retries.Int(task.Stage)
+	log.Warningf("Task %s failed: %s, retry %d/%d from stage %s after %s", task.String(), reason, retried, policy.Retry.MaxRetries, retry.stage, retry.backoff)
+
+	params := jsonutils.NewDict()
+	params.Add(retry.retries, taskRetriesKey)
+	task.SetStage(retry.stage, params)
+
+	taskId, retryStage, retryData := task.Id, retry.stage, retry.data
+	time.AfterFunc(retry.backoff, func() {
+		task := TaskManager.fetchTask(taskId)
+		if task == nil || task.Stage != retryStage || task.IsCancelled() {
+			return
+		}
+		err := task.ScheduleRun(retryData)
+		if err != nil {
+			log.Errorf("retry task %s: %v", task.String(), err)
+		}
+	})
+	return true
+}
+
+// cancelSubtasks cancels the unfinished subtasks of current stage
+func (task *STask) cancelSubtasks(ctx context.Context, reason string) {
+	for _, st := range SubTaskManager.GetInitSubtasks(task.Id, task.Stage) {
+		subtask := TaskManager.fetchTask(st.SubtaskId)
+		if subtask == nil {
+			st.SaveResults(true, jsonutils.NewString(reason))
+			continue
+		}
+		err := subtask.cancel(ctx, reason)
+		if err != nil {
+			log.Errorf("cancel subtask %s: %v", subtask.String(), err)
+		}
+	}
+}
+
+// getCancelParams marks the pending stage cancelled, the failure handler of
+// the stage is yet to be called
+func (task *STask) getCancelParams(reason string) *jsonutils.JSONDict {
+	params := jsonutils.NewDict()
+	params.Add(jsonutils.NewString(reason), TASK_CANCELLED_KEY)
+	params.Add(jsonutils.NewString(task.Stage), taskCancelledStageKey)
+	params.Add(jsonutils.JSONFalse, taskCancelHandledKey)
+	return params
+}
+
+func (task *STask) cancel(ctx context.Context, reason string) error {
+	if task.isFinished() || task.IsCancelled() {
+		return nil
+	}
+	err := task.SaveParams(task.getCancelParams(reason))
+	if err != nil {
+		return errors.Wrap(err, "SaveParams")
+	}
+	task.cancelSubtasks(ctx, reason)
+	return task.ScheduleRun(taskFailureBody(reason))
+}
+
+// PerformCancel cancels an unfinished task and its subtasks, the task runs
+// the failure handler of current stage
+func (task *STask) PerformCancel(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	input apis.TaskCancelInput,
+) (jsonutils.JSONObject, error) {
+	if task.isFinished() {
+		return nil, httperrors.NewInvalidStatusError("task %s is %s", task.Id, task.Stage)
+	}
+	if task.IsCancelled() {
+		return nil, httperrors.NewInvalidStatusError("stage %s of task %s has been cancelled", task.Stage, task.Id)
+	}
+	reason := fmt.Sprintf("task cancelled by %s", userCred.GetUserName())
+	if len(input.Reason) > 0 {
+		reason = fmt.Sprintf("%s: %s", reason, input.Reason)
+	}
+	err := task.cancel(ctx, reason)
+	if err != nil {
+		return nil, errors.Wrap(err, "cancel")
+	}
+	if manager := db.GetModelManager(task.ObjType); manager != nil && task.ObjId != MULTI_OBJECTS_ID {
+		obj, _ := manager.FetchById(task.ObjId)
+		if obj != nil {
+			logclient.AddActionLogWithContext(ctx, obj, logclient.ACT_CANCEL, reason, userCred, true)
+		}
+	}
+	return nil, nil
+}
+
+// CheckStageTimeouts fails the stages past the deadline saved in task
+// params, which covers the timers lost by service restart
+func (manager *STaskManager) CheckStageTimeouts(ctx context.Context, userCred mcclient.TokenCredential, isStart bool) {
+	q := manager.Query().NotIn("stage", []string{TASK_STAGE_FAILED, TASK_STAGE_COMPLETE})
+	q = q.Contains("params", TASK_STAGE_DEADLINE_KEY)
+	tasks := make([]STask, 0)
+	err := db.FetchModelObjects(manager, q, &tasks)
+	if err != nil {
+		log.Errorf("fetch tasks with stage deadline: %v", err)
+		return
+	}
+	now := time.Now()
+	for i := range tasks {
+		if !tasks[i].isStageExpired(tasks[i].Stage, now) {
+			continue
+		}
+		manager.checkStageTimeout(tasks[i].Id, tasks[i].Stage)
+	}
+}
+
+func (task *STask) setInitStageDeadline() {
+	if deadline := task.stageDeadline(task.Stage); !deadline.IsZero() {
+		task.Params.Add(jsonutils.NewTimeString(deadline), TASK_STAGE_DEADLINE_KEY)
+	}
+}
+
+func checkParentTaskCancelled(parentTaskId string) error {
+	if len(parentTaskId) == 0 {
+		return nil
+	}
+	parentTask := TaskManager.fetchTask(parentTaskId)
+	if parentTask != nil && parentTask.IsCancelled() {
+		return errors.Wrapf(httperrors.ErrInvalidStatus, "parent task %s has been cancelled", parentTaskId)
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package taskman
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"yunion.io/x/jsonutils"
+
+	"yunion.io/x/onecloud/pkg/apis"
+)
+
+type policyTestTask struct {
+	STask
+}
+
+func init() {
+	RegisterTask(policyTestTask{})
+	RegisterTaskPolicy(policyTestTask{}, STaskPolicy{
+		StageTimeout: 10 * time.Minute,
+		StageTimeouts: map[string]time.Duration{
+			"OnSlowComplete":      time.Hour,
+			"OnUnboundedComplete": 0,
+		},
+		Retry: &SRetryPolicy{
+			MaxRetries: 3,
+			Backoff:    time.Second,
+			MaxBackoff: 3 * time.Second,
+			Stages:     []string{"OnDeployComplete"},
+		},
+	})
+}
+
+func newPolicyTestTask(stage string) *STask {
+	task := &STask{TaskName: "policyTestTask", Stage: stage}
+	task.Params = jsonutils.NewDict()
+	return task
+}
+
+func TestStageDeadline(t *testing.T) {
+	cases := []struct {
+		taskName string
+		stage    string
+		want     time.Duration
+	}{
+		{"policyTestTask", "OnDeployComplete", 10 * time.Minute},
+		{"policyTestTask", "OnSlowComplete", time.Hour},
+		{"policyTestTask", "OnUnboundedComplete", 0},
+		{"recoveryTestTask", "OnDeployComplete", 0},
+	}
+	for _, c := range cases {
+		task := &STask{TaskName: c.taskName}
+		start := time.Now()
+		deadline := task.stageDeadline(c.stage)
+		if c.want == 0 {
+			if !deadline.IsZero() {
+				t.Errorf("%s %s: want no deadline, got %s", c.taskName, c.stage, deadline)
+			}
+			continue
+		}
+		if deadline.Before(start.Add(c.want)) || deadline.After(time.Now().Add(c.want)) {
+			t.Errorf("%s %s: want deadline in %s, got %s", c.taskName, c.stage, c.want, deadline.Sub(start))
+		}
+	}
+}
+
+func TestIsStageExpired(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		name      string
+		stage     string
+		deadline  time.Time
+		cancelled bool
+		want      bool
+	}{
+		{
+			name:     "past deadline",
+			stage:    "OnDeployComplete",
+			deadline: now.Add(-time.Second),
+			want:     true,
+		},
+		{
+			name:     "at deadline",
+			stage:    "OnDeployComplete",
+			deadline: now,
+			want:     true,
+		},
+		{
+			name:     "before deadline",
+			stage:    "OnDeployComplete",
+			deadline: now.Add(time.Second),
+		},
+		{
+			name:  "no deadline",
+			stage: "OnDeployComplete",
+		},
+		{
+			name:     "stage moved on",
+			stage:    "OnStartComplete",
+			deadline: now.Add(-time.Second),
+		},
+		{
+			name:     "task finished",
+			stage:    TASK_STAGE_COMPLETE,
+			deadline: now.Add(-time.Second),
+		},
+		{
+			name:      "stage cancelled",
+			stage:     "OnDeployComplete",
+			deadline:  now.Add(-time.Second),
+			cancelled: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			task := newPolicyTestTask(c.stage)
+			if !c.deadline.IsZero() {
+				task.Params.Add(jsonutils.NewTimeString(c.deadline), TASK_STAGE_DEADLINE_KEY)
+			}
+			if c.cancelled {
+				task.Params.Update(task.getCancelParams("cancelled"))
+			}
+			if got := task.isStageExpired("OnDeployComplete", now); got != c.want {
+				t.Errorf("want expired %v, got %v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestGetStageRetry(t *testing.T) {
+	policy := getTaskPolicy("policyTestTask")
+	retryData := jsonutils.Marshal(map[string]string{"host_id": "host"})
+
+	task := newPolicyTestTask("OnDeployComplete")
+	if _, ok := task.getStageRetry(policy); ok {
+		t.Errorf("retried without a retry point")
+	}
+	task.Params.Add(jsonutils.NewString("OnStartDeploy"), taskRetryStageKey)
+	task.Params.Add(retryData, taskRetryDataKey)
+
+	// the backoff doubles on each retry, capped by the max backoff
+	for _, backoff := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		retry, ok := task.getStageRetry(policy)
+		if !ok {
+			t.Fatalf("want retry after %s", backoff)
+		}
+		if retry.stage != "OnStartDeploy" || !jsonutils.Marshal(retry.data).Equals(retryData) {
+			t.Errorf("want retry from OnStartDeploy with %s, got %s with %s", retryData, retry.stage, retry.data)
+		}
+		if retry.backoff != backoff {
+			t.Errorf("want backoff %s, got %s", backoff, retry.backoff)
+		}
+		// the retry re-enters the failed stage with the retries saved
+		task.Params.Set(taskRetriesKey, retry.retries)
+	}
+	if _, ok := task.getStageRetry(policy); ok {
+		t.Errorf("retried after %d retries", policy.Retry.MaxRetries)
+	}
+
+	// the retries are counted by stage
+	task.Stage = "OnStartComplete"
+	if _, ok := task.getStageRetry(policy); ok {
+		t.Errorf("retried a stage not in the retry stages")
+	}
+	policy = &STaskPolicy{Retry: &SRetryPolicy{MaxRetries: 1}}
+	if _, ok := task.getStageRetry(policy); !ok {
+		t.Errorf("want retry of every stage if no stages set")
+	}
+	if _, ok := task.getStageRetry(&STaskPolicy{}); ok {
+		t.Errorf("retried without a retry policy")
+	}
+}
+
+func TestCancelRunningTask(t *testing.T) {
+	ctx := context.Background()
+	input := apis.TaskCancelInput{}
+
+	finished := newPolicyTestTask(TASK_STAGE_COMPLETE)
+	if _, err := finished.PerformCancel(ctx, nil, nil, input); err == nil {
+		t.Errorf("cancelled a finished task")
+	}
+
+	task := newPolicyTestTask("OnDeployComplete")
+	if task.IsCancelled() {
+		t.Fatalf("running task is cancelled")
+	}
+	task.Params.Update(task.getCancelParams("cancelled by user"))
+	if !task.IsCancelled() || task.isCancelHandled() {
+		t.Fatalf("want the pending stage cancelled and not handled")
+	}
+	if reason := task.getCancelReason(); reason != "cancelled by user" {
+		t.Errorf("want cancel reason, got %q", reason)
+	}
+	if _, err := task.PerformCancel(ctx, nil, nil, input); err == nil {
+		t.Errorf("cancelled a cancelled stage again")
+	}
+	if task.isStageExpired("OnDeployComplete", time.Now().Add(time.Hour)) {
+		t.Errorf("cancelled stage expired")
+	}
+
+	// the failure handler is called once, the late callbacks of the stage
+	// are dropped
+	task.Params.Add(jsonutils.JSONTrue, taskCancelHandledKey)
+	if !task.IsCancelled() || !task.isCancelHandled() {
+		t.Errorf("want the cancel handled")
+	}
+
+	// the stages entered by the failure handler are not cancelled
+	task.Stage = "OnRollbackComplete"
+	if task.IsCancelled() {
+		t.Errorf("rollback stage is cancelled")
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package taskman
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/reflectutils"
+	"yunion.io/x/pkg/util/stringutils"
+	"yunion.io/x/pkg/utils"
+
+	"yunion.io/x/onecloud/pkg/apis"
+	"yunion.io/x/onecloud/pkg/cloudcommon/consts"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+)
+
+const (
+	taskRequeryKey = "__requery__"
+	taskOwnerKey   = "__owner__"
+
+	taskRecoveryReason = "service restart"
+)
+
+// TaskRecoveryMaxAge is the age of the oldest task to recover, the older
+// tasks are left alone
+var TaskRecoveryMaxAge = 24 * time.Hour
+
+// taskBootId tells apart the runs of the same service instance, the tasks
+// started by the running process are never recovered by itself
+var taskBootId = stringutils.UUID4()
+
+// getTaskInstance identifies the service instance running the task, the
+// replicas of a HA region run on different hosts.  The hostname of a pod
+// changes when it is recreated, so a stable TaskInstanceId has to be
+// configured for the restarted pod to recover the tasks of the old one
+func getTaskInstance() string {
+	instanceId := consts.TaskInstanceId()
+	if len(instanceId) == 0 {
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.Errorf("get hostname: %v", err)
+		}
+		instanceId = hostname
+	}
+	return fmt.Sprintf("%s@%s/%s", consts.GetServiceName(), consts.GetRegion(), instanceId)
+}
+
+// getTaskOwner identifies the process running the task, a restarted
+// instance only recovers the tasks of its previous runs
+func getTaskOwner() string {
+	return fmt.Sprintf("%s/%s", getTaskInstance(), taskBootId)
+}
+
+func (task *STask) isOwnedByPreviousRun(instance string) bool {
+	taskOwner, _ := task.Params.GetString(taskOwnerKey)
+	return strings.HasPrefix(taskOwner, instance+"/") && taskOwner != getTaskOwner()
+}
+
+var (
+	recoveryReport     *apis.TaskRecoveryReport
+	recoveryReportLock = &sync.Mutex{}
+)
+
+func getTaskRecoveryKind(task *STask) string {
+	taskType, ok := taskTable[task.TaskName]
+	if !ok {
+		return TASK_RECOVERY_WAIT
+	}
+	recovery, ok := reflect.New(taskType).Interface().(ITaskRecovery)
+	if !ok {
+		return TASK_RECOVERY_WAIT
+	}
+	kind := recovery.GetRecoveryKind(task.Stage)
+	if !utils.IsInStringArray(kind, []string{TASK_RECOVERY_RESUME, TASK_RECOVERY_REQUERY, TASK_RECOVERY_FAIL}) {
+		return TASK_RECOVERY_WAIT
+	}
+	return kind
+}
+
+// getRecoveryAction decides how to recover the task at current stage and
+// the reason of failing it, the declared kind is overridden by a lost
+// cancellation or by the subtasks still running
+func (task *STask) getRecoveryAction(hasInitSubtasks func() bool) (string, string) {
+	kind := getTaskRecoveryKind(task)
+	switch {
+	case task.IsCancelled() && !task.isCancelHandled():
+		// the failure of the cancelled stage was lost by the restart
+		return TASK_RECOVERY_FAIL, task.getCancelReason()
+	case kind == TASK_RECOVERY_FAIL:
+		return kind, taskRecoveryReason
+	case hasInitSubtasks():
+		return TASK_RECOVERY_WAIT, ""
+	}
+	return kind, ""
+}
+
+// RecoverTasks picks up the tasks of this service instance interrupted by
+// the last restart, re-drives them according to the ITaskRecovery of the
+// task class, the others are left alone. The tasks run by the other
+// replicas of the region are never touched.
+func (manager *STaskManager) RecoverTasks(ctx context.Context) {
+	report := &apis.TaskRecoveryReport{
+		StartAt: time.Now(),
+		Tasks:   []apis.TaskRecoveryRecord{},
+	}
+	instance := getTaskInstance()
+	q := manager.Query().NotIn("stage", []string{TASK_STAGE_FAILED, TASK_STAGE_COMPLETE})
+	q = q.GT("created_at", report.StartAt.Add(-TaskRecoveryMaxAge)).LT("created_at", report.StartAt)
+	q = q.Contains("params", instance+"/").Asc("created_at")
+	tasks := make([]STask, 0)
+	err := db.FetchModelObjects(manager, q, &tasks)
+	if err != nil {
+		log.Errorf("fetch incomplete tasks: %v", err)
+		return
+	}
+	for i := range tasks {
+		task := &tasks[i]
+		if task.Params == nil || !task.isOwnedByPreviousRun(instance) {
+			continue
+		}
+		record := task.recover(ctx)
+		switch record.Action {
+		case TASK_RECOVERY_RESUME:
+			report.Resumed += 1
+		case TASK_RECOVERY_REQUERY:
+			report.Requeried += 1
+		case TASK_RECOVERY_WAIT:
+			report.Waiting += 1
+		default:
+			report.Failed += 1
+		}
+		report.Tasks = append(report.Tasks, record)
+	}
+	report.EndAt = time.Now()
+	log.Infof("Task recovery: %d resumed, %d requeried, %d waiting, %d failed", report.Resumed, report.Requeried, report.Waiting, report.Failed)
+
+	recoveryReportLock.Lock()
+	defer recoveryReportLock.Unlock()
+	recoveryReport = report
+}
+
+func (task *STask) recover(ctx context.Context) apis.TaskRecoveryRecord {
+	record := apis.TaskRecoveryRecord{
+		Id:       task.Id,
+		TaskName: task.TaskName,
+		ObjType:  task.ObjType,
+		ObjId:    task.ObjId,
+		Object:   task.Object,
+		Stage:    task.Stage,
+	}
+	kind, reason := task.getRecoveryAction(func() bool {
+		return len(SubTaskManager.GetInitSubtasks(task.Id, task.Stage)) > 0
+	})
+	record.Action, record.Reason = kind, reason
+
+	var err error
+	if kind != TASK_RECOVERY_FAIL {
+		// an expired deadline fails the stage at once
+		task.armStageTimeout()
+	}
+	switch kind {
+	case TASK_RECOVERY_RESUME:
+		err = task.resume()
+	case TASK_RECOVERY_REQUERY:
+		body := jsonutils.NewDict()
+		body.Add(jsonutils.JSONTrue, taskRequeryKey)
+		err = task.ScheduleRun(body)
+	case TASK_RECOVERY_FAIL:
+		err = task.ScheduleRun(taskFailureBody(record.Reason))
+	}
+	if err != nil {
+		log.Errorf("recover task %s by %s: %v", task.String(), kind, err)
+		record.Action = TASK_RECOVERY_FAIL
+		record.Reason = fmt.Sprintf("%s: %v", taskRecoveryReason, err)
+		task.SetStageFailed(ctx, jsonutils.NewString(record.Reason))
+	}
+	return record
+}
+
+// resume calls again the stage which launched current stage with the same
+// data, the retry point is saved for every task implementing ITaskRecovery
+func (task *STask) resume() error {
+	resumeStage, _ := task.Params.GetString(taskRetryStageKey)
+	resumeData, _ := task.Params.Get(taskRetryDataKey)
+	if len(resumeStage) == 0 || resumeData == nil {
+		if task.Stage != TASK_INIT_STAGE {
+			return errors.Errorf("no resume point of stage %s", task.Stage)
+		}
+		return task.ScheduleRun(nil)
+	}
+	if resumeStage != task.Stage {
+		err := task.SetStage(resumeStage, nil)
+		if err != nil {
+			return errors.Wrap(err, "SetStage")
+		}
+	}
+	return task.ScheduleRun(resumeData)
+}
+
+func isRequeryData(data jsonutils.JSONObject) bool {
+	if data == nil {
+		return false
+	}
+	requery, _ := data.Bool(taskRequeryKey)
+	return requery
+}
+
+func (task *STask) fetchObjects() error {
+	manager, ok := db.GetModelManager(task.ObjType).(db.IStandaloneModelManager)
+	if !ok {
+		return errors.Wrapf(errors.ErrNotFound, "model manager %s", task.ObjType)
+	}
+	fetch := func(objId string) (db.IStandaloneModel, error) {
+		obj, err := manager.FetchById(objId)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fetch %s %s", task.ObjType, objId)
+		}
+		return obj.(db.IStandaloneModel), nil
+	}
+	if task.ObjId != MULTI_OBJECTS_ID {
+		obj, err := fetch(task.ObjId)
+		if err != nil {
+			return err
+		}
+		task.taskObject = obj
+		return nil
+	}
+	for _, objId := range TaskObjectManager.GetObjectIds(task) {
+		obj, err := fetch(objId)
+		if err != nil {
+			return err
+		}
+		task.taskObjects = append(task.taskObjects, obj)
+	}
+	return nil
+}
+
+// requery runs the RequeryStage of the task, then continues current stage
+// with the result
+func (task *STask) requery(taskValue reflect.Value) {
+	if task.isFinished() {
+		return
+	}
+	ctxData := task.GetRequestContext()
+	ctx := ctxData.GetContext()
+
+	body, err := func() (jsonutils.JSONObject, error) {
+		requery, ok := taskValue.Interface().(ITaskRequery)
+		if !ok {
+			return nil, errors.Errorf("task %s does not implement ITaskRequery", task.TaskName)
+		}
+		err := task.fetchObjects()
+		if err != nil {
+			return nil, errors.Wrap(err, "fetchObjects")
+		}
+		if !reflectutils.FillEmbededStructValue(taskValue.Elem(), reflect.Indirect(reflect.ValueOf(task))) {
+			return nil, errors.Errorf("cannot locate embedded task struct of %s", task.TaskName)
+		}
+		return requery.RequeryStage(ctx, task.Stage)
+	}()
+	if err != nil {
+		log.Errorf("Task %s requery: %v", task.String(), err)
+		body = taskFailureBody(fmt.Sprintf("%s, requery stage %s: %v", taskRecoveryReason, task.Stage, err))
+	}
+	err = task.ScheduleRun(body)
+	if err != nil {
+		log.Errorf("run requeried task %s: %v", task.String(), err)
+	}
+}
+
+// GetPropertyRecoveryReport returns the report of the task recovery at the
+// last service start
+func (manager *STaskManager) GetPropertyRecoveryReport(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject) (*apis.TaskRecoveryReport, error) {
+	recoveryReportLock.Lock()
+	defer recoveryReportLock.Unlock()
+
+	if recoveryReport == nil {
+		return nil, httperrors.NewNotFoundError("no task recovery since service start")
+	}
+	return recoveryReport, nil
+}
@@ -0,0 +1,184 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package taskman
+
+import (
+	"context"
+	"testing"
+
+	"yunion.io/x/jsonutils"
+
+	"yunion.io/x/onecloud/pkg/cloudcommon/consts"
+)
+
+type recoveryTestTask struct {
+	STask
+}
+
+// GetRecoveryKind declares a recovery kind for each stage named after it
+func (task *recoveryTestTask) GetRecoveryKind(stage string) string {
+	return stage
+}
+
+func (task *recoveryTestTask) RequeryStage(ctx context.Context, stage string) (jsonutils.JSONObject, error) {
+	return jsonutils.NewDict(), nil
+}
+
+type undeclaredTestTask struct {
+	STask
+}
+
+func init() {
+	RegisterTask(recoveryTestTask{})
+	RegisterTask(undeclaredTestTask{})
+}
+
+func TestGetRecoveryAction(t *testing.T) {
+	cancelled := jsonutils.NewDict()
+	cancelled.Add(jsonutils.NewString("cancelled by user"), TASK_CANCELLED_KEY)
+	cancelled.Add(jsonutils.NewString(TASK_RECOVERY_RESUME), taskCancelledStageKey)
+
+	cancelHandled := jsonutils.NewDict()
+	cancelHandled.Update(cancelled)
+	cancelHandled.Add(jsonutils.JSONTrue, taskCancelHandledKey)
+
+	cases := []struct {
+		name       string
+		taskName   string
+		stage      string
+		params     *jsonutils.JSONDict
+		subtasks   bool
+		wantKind   string
+		wantReason string
+	}{
+		{
+			name:     "resume",
+			taskName: "recoveryTestTask",
+			stage:    TASK_RECOVERY_RESUME,
+			wantKind: TASK_RECOVERY_RESUME,
+		},
+		{
+			name:     "requery",
+			taskName: "recoveryTestTask",
+			stage:    TASK_RECOVERY_REQUERY,
+			wantKind: TASK_RECOVERY_REQUERY,
+		},
+		{
+			name:       "fail",
+			taskName:   "recoveryTestTask",
+			stage:      TASK_RECOVERY_FAIL,
+			wantKind:   TASK_RECOVERY_FAIL,
+			wantReason: taskRecoveryReason,
+		},
+		{
+			name:       "fail with running subtasks",
+			taskName:   "recoveryTestTask",
+			stage:      TASK_RECOVERY_FAIL,
+			subtasks:   true,
+			wantKind:   TASK_RECOVERY_FAIL,
+			wantReason: taskRecoveryReason,
+		},
+		{
+			name:     "resume with running subtasks waits",
+			taskName: "recoveryTestTask",
+			stage:    TASK_RECOVERY_RESUME,
+			subtasks: true,
+			wantKind: TASK_RECOVERY_WAIT,
+		},
+		{
+			name:     "unknown kind waits",
+			taskName: "recoveryTestTask",
+			stage:    "OnUnknown",
+			wantKind: TASK_RECOVERY_WAIT,
+		},
+		{
+			name:     "undeclared task waits",
+			taskName: "undeclaredTestTask",
+			stage:    TASK_RECOVERY_RESUME,
+			wantKind: TASK_RECOVERY_WAIT,
+		},
+		{
+			name:     "unregistered task waits",
+			taskName: "NoSuchTask",
+			stage:    TASK_RECOVERY_RESUME,
+			wantKind: TASK_RECOVERY_WAIT,
+		},
+		{
+			name:       "lost cancellation fails",
+			taskName:   "recoveryTestTask",
+			stage:      TASK_RECOVERY_RESUME,
+			params:     cancelled,
+			subtasks:   true,
+			wantKind:   TASK_RECOVERY_FAIL,
+			wantReason: "cancelled by user",
+		},
+		{
+			name:     "handled cancellation resumes",
+			taskName: "recoveryTestTask",
+			stage:    TASK_RECOVERY_RESUME,
+			params:   cancelHandled,
+			wantKind: TASK_RECOVERY_RESUME,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			task := &STask{TaskName: c.taskName, Stage: c.stage}
+			task.Params = jsonutils.NewDict()
+			if c.params != nil {
+				task.Params = c.params
+			}
+			kind, reason := task.getRecoveryAction(func() bool { return c.subtasks })
+			if kind != c.wantKind || reason != c.wantReason {
+				t.Errorf("want %s %q, got %s %q", c.wantKind, c.wantReason, kind, reason)
+			}
+		})
+	}
+}
+
+func TestIsOwnedByPreviousRun(t *testing.T) {
+	consts.SetTaskInstanceId("region-0")
+	defer consts.SetTaskInstanceId("")
+
+	instance := getTaskInstance()
+	cases := []struct {
+		name  string
+		owner string
+		want  bool
+	}{
+		{"previous run", instance + "/previous-boot", true},
+		{"current run", getTaskOwner(), false},
+		{"other replica", getTaskInstance() + "-1/previous-boot", false},
+		{"no owner", "", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			task := &STask{}
+			params := jsonutils.NewDict()
+			if len(c.owner) > 0 {
+				params.Add(jsonutils.NewString(c.owner), taskOwnerKey)
+			}
+			task.Params = params
+			if got := task.isOwnedByPreviousRun(instance); got != c.want {
+				t.Errorf("owner %q: want %v, got %v", c.owner, c.want, got)
+			}
+		})
+	}
+
+	// the instance follows the configured id instead of the hostname
+	consts.SetTaskInstanceId("region-1")
+	if getTaskInstance() == instance {
+		t.Errorf("task instance does not follow the configured id")
+	}
+}
@@ -265,6 +265,7 @@ func fetchTaskParams(
 	} else {
 		data = jsonutils.NewDict()
 	}
+	data.Add(jsonutils.NewString(getTaskOwner()), taskOwnerKey)
 	reqContext := appctx.FetchAppContextData(ctx)
 	if !reqContext.IsZero() {
 		data.Add(jsonutils.Marshal(&reqContext), REQUEST_CONTEXT_KEY)
@@ -315,6 +316,10 @@ func (manager *STaskManager) NewTask(
 		return nil, fmt.Errorf("task %s not found", taskName)
 	}
 
+	err := checkParentTaskCancelled(parentTaskId)
+	if err != nil {
+		return nil, err
+	}
 	data := fetchTaskParams(ctx, taskName, taskData, parentTaskId, parentTaskNotifyUrl, pendingUsage)
 	task := &STask{
 		ObjType:      obj.Keyword(),
@@ -338,12 +343,14 @@ func (manager *STaskManager) NewTask(
 	}
 
 	task.SetModelManager(manager, task)
-	err := manager.TableSpec().Insert(ctx, task)
+	task.setInitStageDeadline()
+	err = manager.TableSpec().Insert(ctx, task)
 	if err != nil {
 		log.Errorf("Task insert error %s", err)
 		return nil, err
 	}
 	task.SetProgressAndStatus(0, TASK_STATUS_QUEUE)
+	task.armStageTimeout()
 
 	parentTask := task.GetParentTask()
 	if parentTask != nil {
@@ -378,6 +385,10 @@ func (manager *STaskManager) NewParallelTask(
 
 	log.Debugf("number of objs: %d", len(objs))
 
+	err := checkParentTaskCancelled(parentTaskId)
+	if err != nil {
+		return nil, err
+	}
 	data := fetchTaskParams(ctx, taskName, taskData, parentTaskId, parentTaskNotifyUrl, pendingUsage)
 	task := &STask{
 		ObjType:      objs[0].Keyword(),
@@ -390,12 +401,14 @@ func (manager *STaskManager) NewParallelTask(
 		ParentTaskId: parentTaskId,
 	}
 	task.SetModelManager(manager, task)
-	err := manager.TableSpec().Insert(ctx, task)
+	task.setInitStageDeadline()
+	err = manager.TableSpec().Insert(ctx, task)
 	if err != nil {
 		log.Errorf("Task insert error %s", err)
 		return nil, err
 	}
 	task.SetProgressAndStatus(0, TASK_STATUS_QUEUE)
+	task.armStageTimeout()
 
 	domainIds := stringutils2.NewSortedStrings(nil)
 	tenantIds := stringutils2.NewSortedStrings(nil)
@@ -459,14 +472,6 @@ func (manager *STaskManager) fetchTask(idStr string) *STask {
 	return task
 }
 
-func (manager *STaskManager) getTaskName(taskId string) string {
-	baseTask := manager.fetchTask(taskId)
-	if baseTask == nil {
-		return ""
-	}
-	return baseTask.TaskName
-}
-
 func (manager *STaskManager) execTask(taskId string, data jsonutils.JSONObject) {
 	baseTask := manager.fetchTask(taskId)
 	if baseTask == nil {
@@ -479,6 +484,10 @@ func (manager *STaskManager) execTask(taskId string, data jsonutils.JSONObject)
 	}
 	log.Debugf("Do task %s(%s) with data %s at stage %s", taskType, taskId, data, baseTask.Stage)
 	taskValue := reflect.New(taskType)
+	if isRequeryData(data) {
+		baseTask.requery(taskValue)
+		return
+	}
 	if taskValue.Type().Implements(ITaskType) {
 		execITask(taskValue, baseTask, data, false)
 	} else if taskValue.Type().Implements(IBatchTaskType) {
@@ -530,6 +539,27 @@ func execITask(taskValue reflect.Value, task *STask, odata jsonutils.JSONObject,
 		data = jsonutils.NewDict()
 	}
 
+	if task.IsCancelled() {
+		if task.isFinished() || task.isCancelHandled() {
+			log.Warningf("Stage %s of task %s has been cancelled, ignore data %s", task.Stage, task.String(), data)
+			return
+		}
+		err := task.markCancelHandled()
+		if err != nil {
+			log.Errorf("mark cancel of task %s handled: %v", task.String(), err)
+			return
+		}
+		if !taskFailed {
+			taskFailed = true
+			reason := taskFailureBody(task.getCancelReason())
+			reason.Set("__stage__", jsonutils.NewString(task.Stage))
+			data = reason
+		}
+	} else if taskFailed && task.retryStage(ctx, data) {
+		task.SaveRequestContext(&ctxData)
+		return
+	}
+
 	stageName := task.Stage
 	if taskFailed {
 		stageName = fmt.Sprintf("%sFailed", task.Stage)
@@ -661,6 +691,11 @@ func execITask(taskValue reflect.Value, task *STask, odata jsonutils.JSONObject,
 		}
 	}()
 
+	if !taskFailed {
+		_, recoverable := taskValue.Interface().(ITaskRecovery)
+		task.saveRetryPoint(data, recoverable)
+	}
+
 	log.Debugf("Call %s %s %#v", task.TaskName, stageName, params)
 	funcValue.Call(params)
 
@@ -754,14 +789,22 @@ func (self *STask) SetStage(stageName string, data *jsonutils.JSONDict) error {
 			stageData.Add(jsonutils.NewTimeString(time.Now()), "complete_at")
 			stageList.Add(stageData)
 			self.Stage = stageName
+			params.Remove(TASK_STAGE_DEADLINE_KEY)
+			if deadline := self.stageDeadline(stageName); !deadline.IsZero() {
+				params.Add(jsonutils.NewTimeString(deadline), TASK_STAGE_DEADLINE_KEY)
+			}
 		}
 		self.Params = params
 		return nil
 	})
 	if err != nil {
 		log.Errorf("set_stage fail %s", err)
+		return err
 	}
-	return err
+	if len(stageName) > 0 {
+		self.armStageTimeout()
+	}
+	return nil
 }
 
 func (task *STask) GetObjectIdStr() string {
@@ -47,6 +47,15 @@ func getTaskWorkMan() *appsrv.SWorkerManager {
 	}
 	log.Infof("TaskWorkerManager %d", consts.TaskWorkerCount())
 	_taskWorkMan = appsrv.NewWorkerManager("TaskWorkerManager", consts.TaskWorkerCount(), 1024, true)
+	// keep the bulk operations of a project from starving the others, a
+	// project is served the tasks of its weight in each round
+	err := _taskWorkMan.EnableFairQueue(appsrv.SFairQueueOptions{
+		Weight:   consts.TaskFairQueueWeight,
+		KeyLimit: consts.TaskFairQueueKeyLimit(),
+	})
+	if err != nil {
+		log.Fatalf("enable fair queue of TaskWorkerManager: %v", err)
+	}
 	return _taskWorkMan
 }
 
@@ -59,8 +68,10 @@ func getTaskWorkMan() *appsrv.SWorkerManager {
 }*/
 
 type taskTask struct {
-	taskId string
-	data   jsonutils.JSONObject
+	taskId   string
+	data     jsonutils.JSONObject
+	key      string
+	priority appsrv.TWorkerPriority
 }
 
 func (t *taskTask) Run() {
@@ -71,19 +82,51 @@ func (t *taskTask) Dump() string {
 	return jsonutils.Marshal(t).PrettyString()
 }
 
+func (t *taskTask) GetFairQueueKey() string {
+	return t.key
+}
+
+func (t *taskTask) GetWorkerPriority() appsrv.TWorkerPriority {
+	return t.priority
+}
+
+// getWorkerPriority returns the priority of the task in policy, or
+// interactive for the tasks started by API requests and background for the
+// others, e.g. the tasks started by cron jobs
+func (task *STask) getWorkerPriority() appsrv.TWorkerPriority {
+	if policy := getTaskPolicy(task.TaskName); policy != nil && policy.Priority != nil {
+		return *policy.Priority
+	}
+	ctxData := task.GetRequestContext()
+	if len(ctxData.RequestId) > 0 {
+		return appsrv.WORKER_PRIORITY_INTERACTIVE
+	}
+	return appsrv.WORKER_PRIORITY_BACKGROUND
+}
+
+func (task *STask) getFairQueueKey() string {
+	if len(task.ProjectId) > 0 {
+		return task.ProjectId
+	}
+	return task.DomainId
+}
+
 func runTask(taskId string, data jsonutils.JSONObject) error {
-	taskName := TaskManager.getTaskName(taskId)
-	if len(taskName) == 0 {
+	baseTask := TaskManager.fetchTask(taskId)
+	if baseTask == nil {
 		return fmt.Errorf("no such task??? task_id=%s", taskId)
 	}
+	taskName := baseTask.TaskName
 	worker := getTaskWorkMan()
 	if workerMan, ok := taskWorkerTable[taskName]; ok {
 		worker = workerMan
 	}
 
 	task := &taskTask{
-		taskId: taskId,
-		data:   data,
+		taskId:   taskId,
+		data:     data,
+		key:      baseTask.getFairQueueKey(),
+		priority: baseTask.getWorkerPriority(),
 	}
 
 	isOk := worker.Run(task, nil, func(err error) {
@@ -68,6 +68,9 @@ func OnBaseOptionsChange(oOpts, nOpts interface{}) bool {
 	if oldOpts.LocalTaskWorkerCount != newOpts.LocalTaskWorkerCount {
 		consts.SetLocalTaskWorkerCount(newOpts.LocalTaskWorkerCount)
 	}
+	if stringsChanged(oldOpts.TaskFairQueueWeights, newOpts.TaskFairQueueWeights) {
+		consts.SetTaskFairQueueWeights(newOpts.TaskFairQueueWeights)
+	}
 	if oldOpts.EnableChangeOwnerAutoRename != newOpts.EnableChangeOwnerAutoRename {
 		consts.SetChangeOwnerAutoRename(newOpts.EnableChangeOwnerAutoRename)
 	}
@@ -91,6 +94,25 @@ func privatePrrefixesChanged(oldprefs, newprefs []string) bool {
 	return false
 }
 
+// stringsChanged compares the lists regardless of the order, without sorting
+// the lists of the options in place
+func stringsChanged(olds, news []string) bool {
+	if len(olds) != len(news) {
+		return true
+	}
+	counts := make(map[string]int, len(olds))
+	for _, s := range olds {
+		counts[s] += 1
+	}
+	for _, s := range news {
+		if counts[s] == 0 {
+			return true
+		}
+		counts[s] -= 1
+	}
+	return false
+}
+
 func OnCommonOptionsChange(oOpts, nOpts interface{}) bool {
 	oldOpts := oOpts.(*CommonOptions)
 	newOpts := nOpts.(*CommonOptions)
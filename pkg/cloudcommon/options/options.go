@@ -74,6 +74,11 @@ type BaseOptions struct {
 	TaskWorkerCount      int `default:"4" help:"Task manager worker thread count, default is 4"`
 	LocalTaskWorkerCount int `default:"4" help:"Worker thread count that runs local tasks, default is 4"`
 
+	TaskInstanceId string `help:"Stable id of this service instance owning its tasks across restarts, e.g. the pod name of a statefulset, default is the hostname"`
+
+	TaskFairQueueWeights  []string `help:"Weights of projects sharing the task workers, in the form of <project_id>:<weight>, the weight of other projects is 1"`
+	TaskFairQueueKeyLimit int      `default:"0" help:"Max queued tasks of each project in the task workers, the tasks over the limit are rejected, 0 means only limited by the queue capacity"`
+
 	DefaultProcessTimeoutSeconds int `default:"60" help:"request process timeout, default is 60 seconds"`
 
 	EnableSsl   bool   `help:"Enable https"`
@@ -396,6 +401,9 @@ func parseOptions(optStruct interface{}, args []string, configFileName string, s
 
 	consts.SetTaskWorkerCount(optionsRef.TaskWorkerCount)
 	consts.SetLocalTaskWorkerCount(optionsRef.LocalTaskWorkerCount)
+	consts.SetTaskInstanceId(optionsRef.TaskInstanceId)
+	consts.SetTaskFairQueueWeights(optionsRef.TaskFairQueueWeights)
+	consts.SetTaskFairQueueKeyLimit(optionsRef.TaskFairQueueKeyLimit)
 }
 
 func (self *BaseOptions) HttpTransportProxyFunc() httputils.TransportProxyFunc {
@@ -819,6 +819,13 @@ func (self *SKVMGuestDriver) CheckMigrate(ctx context.Context, guest *models.SGu
 	if !input.IsRescueMode && guest.Status != api.VM_READY {
 		return httperrors.NewServerStatusError("Cannot normal migrate guest in status %s, try rescue mode or server-live-migrate?", guest.Status)
 	}
+	hasHostPath, err := guest.HasHostPathFilesystemMounts()
+	if err != nil {
+		return errors.Wrap(err, "HasHostPathFilesystemMounts")
+	}
+	if hasHostPath {
+		return httperrors.NewBadRequestError("Cannot migrate guest with host path filesystem mounts")
+	}
 	if input.IsRescueMode {
 		host, err := guest.GetHost()
 		if err != nil {
@@ -874,6 +881,13 @@ func (self *SKVMGuestDriver) CheckLiveMigrate(ctx context.Context, guest *models
 		if len(devices) > 0 {
 			return httperrors.NewBadRequestError("Cannot live migrate with isolated devices")
 		}
+		mounts, err := guest.GetFilesystemMounts()
+		if err != nil {
+			return errors.Wrapf(err, "GetFilesystemMounts")
+		}
+		if len(mounts) > 0 {
+			return httperrors.NewBadRequestError("Cannot live migrate with filesystem mounts")
+		}
 		if !guest.CheckQemuVersion(guest.GetQemuVersion(userCred), "1.1.2") {
 			return httperrors.NewBadRequestError("Cannot do live migrate, too low qemu version")
 		}
@@ -30,6 +30,7 @@ import (
 	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
 	"yunion.io/x/onecloud/pkg/httperrors"
 	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/seclib2"
 	"yunion.io/x/onecloud/pkg/util/stringutils2"
 )
 
@@ -66,10 +67,23 @@ func (bs *SBackupStorageManager) ValidateCreateData(ctx context.Context, userCre
 	if err != nil {
 		return input, err
 	}
-	if !utils.IsInArray(input.StorageType, []string{string(api.BACKUPSTORAGE_TYPE_NFS), string(api.BACKUPSTORAGE_TYPE_OBJECT_STORAGE)}) {
+	if !utils.IsInArray(input.StorageType, []string{string(api.BACKUPSTORAGE_TYPE_NFS), string(api.BACKUPSTORAGE_TYPE_OBJECT_STORAGE), string(api.BACKUPSTORAGE_TYPE_REPOSITORY)}) {
 		return input, httperrors.NewInputParameterError("Invalid storage type %s", input.StorageType)
 	}
-	switch input.StorageType {
+	backend := input.StorageType
+	if input.StorageType == string(api.BACKUPSTORAGE_TYPE_REPOSITORY) {
+		if !utils.IsInArray(input.RepositoryBackend, []string{string(api.BACKUPSTORAGE_TYPE_NFS), string(api.BACKUPSTORAGE_TYPE_OBJECT_STORAGE)}) {
+			return input, httperrors.NewInputParameterError("Invalid repository backend %s", input.RepositoryBackend)
+		}
+		backend = input.RepositoryBackend
+		if len(input.RepositoryKey) == 0 {
+			input.RepositoryKey = seclib2.RandomPassword2(32)
+		}
+	} else {
+		input.RepositoryBackend = ""
+		input.RepositoryKey = ""
+	}
+	switch backend {
 	case string(api.BACKUPSTORAGE_TYPE_NFS):
 		if input.NfsHost == "" {
 			return input, httperrors.NewInputParameterError("nfs_host is required when storage type is nfs")
@@ -112,6 +126,9 @@ func (bs *SBackupStorage) CustomizeCreate(ctx context.Context, userCred mcclient
 		ObjectBucketUrl: input.ObjectBucketUrl,
 		ObjectAccessKey: input.ObjectAccessKey,
 		ObjectSecret:    input.ObjectSecret,
+
+		RepositoryBackend: input.RepositoryBackend,
+		RepositoryKey:     input.RepositoryKey,
 	}
 	return bs.SEnabledStatusInfrasResourceBase.CustomizeCreate(ctx, userCred, ownerId, query, data)
 }
@@ -134,12 +151,18 @@ func (bs *SBackupStorage) ValidateDeleteCondition(ctx context.Context, info json
 func (bs *SBackupStorage) PostCreate(ctx context.Context, userCred mcclient.TokenCredential, ownerId mcclient.IIdentityProvider, query jsonutils.JSONObject, data jsonutils.JSONObject) {
 	bs.SEnabledStatusInfrasResourceBase.PostCreate(ctx, userCred, ownerId, query, data)
 	bs.SetStatus(ctx, userCred, api.BACKUPSTORAGE_STATUS_OFFLINE, "")
-	if bs.StorageType == api.BACKUPSTORAGE_TYPE_OBJECT_STORAGE {
+	if bs.getBackendType() == api.BACKUPSTORAGE_TYPE_OBJECT_STORAGE {
 		err := bs.saveObjectSecret(bs.AccessInfo.ObjectSecret)
 		if err != nil {
 			log.Errorf("convert object secret fail %s", err)
 		}
 	}
+	if bs.StorageType == api.BACKUPSTORAGE_TYPE_REPOSITORY {
+		err := bs.saveRepositoryKey(bs.AccessInfo.RepositoryKey)
+		if err != nil {
+			log.Errorf("convert repository key fail %s", err)
+		}
+	}
 	err := bs.startSyncStatusTask(ctx, userCred, "")
 	if err != nil {
 		log.Errorf("unable to sync backup storage status")
@@ -164,6 +187,29 @@ func (bs *SBackupStorage) saveObjectSecret(secret string) error {
 	return errors.Wrap(err, "Update")
 }
 
+func (bs *SBackupStorage) saveRepositoryKey(key string) error {
+	sec, err := utils.EncryptAESBase64(bs.Id, key)
+	if err != nil {
+		return errors.Wrap(err, "EncryptAESBase64")
+	}
+	accessInfo := *bs.AccessInfo
+	accessInfo.RepositoryKey = sec
+	_, err = db.Update(bs, func() error {
+		bs.AccessInfo = &accessInfo
+		return nil
+	})
+	return errors.Wrap(err, "Update")
+}
+
+// getBackendType returns the type of the storage holding the data, which is
+// the backend for a repository
+func (bs *SBackupStorage) getBackendType() api.TBackupStorageType {
+	if bs.StorageType == api.BACKUPSTORAGE_TYPE_REPOSITORY {
+		return api.TBackupStorageType(bs.AccessInfo.RepositoryBackend)
+	}
+	return bs.StorageType
+}
+
 func (bs *SBackupStorage) getMoreDetails(ctx context.Context, out api.BackupStorageDetails) api.BackupStorageDetails {
 	out.NfsHost = bs.AccessInfo.NfsHost
 	out.NfsSharedDir = bs.AccessInfo.NfsSharedDir
@@ -171,6 +217,7 @@ func (bs *SBackupStorage) getMoreDetails(ctx context.Context, out api.BackupStor
 	out.ObjectAccessKey = bs.AccessInfo.ObjectAccessKey
 	// should not return secret
 	out.ObjectSecret = "" // bs.AccessInfo.ObjectSecret
+	out.RepositoryBackend = bs.AccessInfo.RepositoryBackend
 	return out
 }
 
@@ -257,6 +304,44 @@ func (bs *SBackupStorage) PerformSyncstatus(ctx context.Context, userCred mcclie
 	return nil, bs.startSyncStatusTask(ctx, userCred, "")
 }
 
+func (bs *SBackupStorage) validateRepositoryAction() error {
+	if bs.StorageType != api.BACKUPSTORAGE_TYPE_REPOSITORY {
+		return httperrors.NewUnsupportOperationError("backup storage of type %s is not a repository", bs.StorageType)
+	}
+	if bs.Status != api.BACKUPSTORAGE_STATUS_ONLINE {
+		return httperrors.NewInvalidStatusError("backup storage %s is %s", bs.Name, bs.Status)
+	}
+	return nil
+}
+
+// PerformVerify checks that the chunks of every backup in the repository exist
+// and, if check_data, are intact
+func (bs *SBackupStorage) PerformVerify(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input api.BackupStorageVerifyInput) (jsonutils.JSONObject, error) {
+	err := bs.validateRepositoryAction()
+	if err != nil {
+		return nil, err
+	}
+	return nil, bs.startRepositoryTask(ctx, userCred, "BackupStorageVerifyTask", jsonutils.Marshal(input).(*jsonutils.JSONDict))
+}
+
+// PerformGc removes the chunks in the repository no longer referenced by any
+// backup
+func (bs *SBackupStorage) PerformGc(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input api.BackupStorageGcInput) (jsonutils.JSONObject, error) {
+	err := bs.validateRepositoryAction()
+	if err != nil {
+		return nil, err
+	}
+	return nil, bs.startRepositoryTask(ctx, userCred, "BackupStorageGcTask", jsonutils.Marshal(input).(*jsonutils.JSONDict))
+}
+
+func (bs *SBackupStorage) startRepositoryTask(ctx context.Context, userCred mcclient.TokenCredential, taskName string, params *jsonutils.JSONDict) error {
+	task, err := taskman.TaskManager.NewTask(ctx, taskName, bs, userCred, params, "", "", nil)
+	if err != nil {
+		return errors.Wrapf(err, "NewTask %s", taskName)
+	}
+	return task.ScheduleRun(nil)
+}
+
 func (bs *SBackupStorage) ValidateUpdateData(
 	ctx context.Context,
 	userCred mcclient.TokenCredential,
@@ -288,7 +373,7 @@ func (bs *SBackupStorage) PostUpdate(ctx context.Context, userCred mcclient.Toke
 	// update accessinfo
 	accessInfoChanged := false
 	accessInfo := *bs.AccessInfo
-	switch bs.StorageType {
+	switch bs.getBackendType() {
 	case api.BACKUPSTORAGE_TYPE_NFS:
 		if len(input.NfsHost) > 0 {
 			accessInfo.NfsHost = input.NfsHost
@@ -335,7 +420,7 @@ func (bs *SBackupStorage) PostUpdate(ctx context.Context, userCred mcclient.Toke
 
 func (bs *SBackupStorage) GetAccessInfo() (*api.SBackupStorageAccessInfo, error) {
 	accessInfo := *bs.AccessInfo
-	switch bs.StorageType {
+	switch bs.getBackendType() {
 	case api.BACKUPSTORAGE_TYPE_OBJECT_STORAGE:
 		secret, err := utils.DescryptAESBase64(bs.Id, accessInfo.ObjectSecret)
 		if err != nil {
@@ -343,6 +428,13 @@ func (bs *SBackupStorage) GetAccessInfo() (*api.SBackupStorageAccessInfo, error)
 		}
 		accessInfo.ObjectSecret = secret
 	}
+	if bs.StorageType == api.BACKUPSTORAGE_TYPE_REPOSITORY {
+		key, err := utils.DescryptAESBase64(bs.Id, accessInfo.RepositoryKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "DescryptAESBase64 repository key")
+		}
+		accessInfo.RepositoryKey = key
+	}
 	return &accessInfo, nil
 }
 
@@ -0,0 +1,696 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/rbacscope"
+	"yunion.io/x/pkg/utils"
+	"yunion.io/x/sqlchemy"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/quotas"
+	"yunion.io/x/onecloud/pkg/compute/options"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/logclient"
+	"yunion.io/x/onecloud/pkg/util/stringutils2"
+)
+
+// +onecloud:swagger-gen-model-singular=capacity_reservation
+// +onecloud:swagger-gen-model-plural=capacity_reservations
+type SCapacityReservationManager struct {
+	db.SVirtualResourceBaseManager
+	SZoneResourceBaseManager
+}
+
+var CapacityReservationManager *SCapacityReservationManager
+
+func init() {
+	CapacityReservationManager = &SCapacityReservationManager{
+		SVirtualResourceBaseManager: db.NewVirtualResourceBaseManager(
+			SCapacityReservation{},
+			"capacity_reservations_tbl",
+			"capacity_reservation",
+			"capacity_reservations",
+		),
+	}
+	CapacityReservationManager.SetVirtualObject(CapacityReservationManager)
+}
+
+// SCapacityReservation holds the capacity of a host set or a zone for its
+// project during a time window, the scheduler keeps the unused part of the
+// reservation from the guests of other projects
+type SCapacityReservation struct {
+	db.SVirtualResourceBase
+
+	SZoneResourceBase `width:"36" charset:"ascii" nullable:"true" list:"user" create:"optional"`
+
+	// 预留资源所在的宿主机ID列表, 以','分隔, 为空时预留整个可用区
+	HostIds string `charset:"ascii" nullable:"true" list:"user" create:"optional"`
+
+	// 预留的CPU核数
+	CpuCount int `nullable:"false" default:"0" list:"user" create:"optional"`
+	// 预留的内存大小, 单位MB
+	MemSize int `nullable:"false" default:"0" list:"user" create:"optional"`
+	// 预留的本地存储大小, 单位MB
+	StorageSize int `nullable:"false" default:"0" list:"user" create:"optional"`
+	// 预留的透传设备数量
+	IsolatedDeviceCount int `nullable:"false" default:"0" list:"user" create:"optional"`
+	// 预留的透传设备型号
+	DevModel string `width:"128" charset:"utf8" nullable:"true" list:"user" create:"optional"`
+
+	// 预留开始时间
+	StartAt time.Time `nullable:"false" list:"user" create:"optional"`
+	// 预留结束时间
+	EndAt time.Time `nullable:"false" list:"user" create:"optional" update:"user"`
+}
+
+type sPoolCapacity struct {
+	CpuCount            int
+	MemSize             int
+	StorageSize         int
+	IsolatedDeviceCount int
+}
+
+func (manager *SCapacityReservationManager) ValidateCreateData(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	ownerId mcclient.IIdentityProvider,
+	query jsonutils.JSONObject,
+	input api.CapacityReservationCreateInput,
+) (*jsonutils.JSONDict, error) {
+	var err error
+	var zone *SZone
+	if len(input.ZoneId) > 0 {
+		zone, input.ZoneResourceInput, err = ValidateZoneResourceInput(ctx, userCred, input.ZoneResourceInput)
+		if err != nil {
+			return nil, errors.Wrap(err, "ValidateZoneResourceInput")
+		}
+	}
+	hostIds := []string{}
+	for _, hostStr := range input.Hosts {
+		hostObj, err := HostManager.FetchByIdOrName(ctx, userCred, hostStr)
+		if err != nil {
+			if errors.Cause(err) == sql.ErrNoRows {
+				return nil, httperrors.NewResourceNotFoundError2(HostManager.Keyword(), hostStr)
+			}
+			return nil, httperrors.NewGeneralError(err)
+		}
+		host := hostObj.(*SHost)
+		if zone == nil {
+			input.ZoneId = host.ZoneId
+		} else if host.ZoneId != zone.Id {
+			return nil, httperrors.NewInputParameterError("host %s not in zone %s", host.Name, zone.Name)
+		}
+		if !utils.IsInStringArray(host.Id, hostIds) {
+			hostIds = append(hostIds, host.Id)
+		}
+	}
+	if len(input.ZoneId) == 0 {
+		return nil, httperrors.NewMissingParameterError("zone_id or hosts")
+	}
+	if input.CpuCount < 0 || input.MemSize < 0 || input.StorageSize < 0 || input.IsolatedDeviceCount < 0 {
+		return nil, httperrors.NewInputParameterError("reserved amount must not be negative")
+	}
+	if input.CpuCount+input.MemSize+input.StorageSize+input.IsolatedDeviceCount == 0 {
+		return nil, httperrors.NewMissingParameterError("cpu_count, mem_size, storage_size or isolated_device_count")
+	}
+
+	if input.StartAt.IsZero() {
+		input.StartAt = time.Now().UTC()
+	}
+	if input.EndAt.IsZero() {
+		if len(input.Duration) == 0 {
+			return nil, httperrors.NewMissingParameterError("end_at or duration")
+		}
+		duration, err := time.ParseDuration(input.Duration)
+		if err != nil {
+			return nil, httperrors.NewInputParameterError("invalid duration %s", input.Duration)
+		}
+		input.EndAt = input.StartAt.Add(duration)
+	}
+	if !input.EndAt.After(input.StartAt) {
+		return nil, httperrors.NewInputParameterError("end_at must be later than start_at")
+	}
+	if !input.EndAt.After(time.Now()) {
+		return nil, httperrors.NewInputParameterError("end_at %s is in the past", input.EndAt)
+	}
+
+	pool := &SCapacityReservation{HostIds: strings.Join(hostIds, ","), DevModel: input.DevModel}
+	pool.ZoneId = input.ZoneId
+	pool.StartAt, pool.EndAt = input.StartAt, input.EndAt
+	free, err := pool.getPoolFree()
+	if err != nil {
+		return nil, errors.Wrap(err, "getPoolFree")
+	}
+	if input.CpuCount > free.CpuCount {
+		return nil, httperrors.NewOutOfResourceError("cpu_count %d exceeds unreserved free capacity %d", input.CpuCount, free.CpuCount)
+	}
+	if input.MemSize > free.MemSize {
+		return nil, httperrors.NewOutOfResourceError("mem_size %d exceeds unreserved free capacity %d", input.MemSize, free.MemSize)
+	}
+	if input.StorageSize > free.StorageSize {
+		return nil, httperrors.NewOutOfResourceError("storage_size %d exceeds unreserved free capacity %d", input.StorageSize, free.StorageSize)
+	}
+	if input.IsolatedDeviceCount > free.IsolatedDeviceCount {
+		return nil, httperrors.NewOutOfResourceError("isolated_device_count %d exceeds unreserved free capacity %d", input.IsolatedDeviceCount, free.IsolatedDeviceCount)
+	}
+
+	// the reserved amount is for the guests of the project, it must be
+	// within the compute quota of the project
+	zoneObj, err := ZoneManager.FetchById(input.ZoneId)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetch zone %s", input.ZoneId)
+	}
+	quota := SQuota{
+		Cpu:            input.CpuCount,
+		Memory:         input.MemSize,
+		Storage:        input.StorageSize,
+		IsolatedDevice: input.IsolatedDeviceCount,
+	}
+	quota.SetKeys(fetchComputeQuotaKeys(rbacscope.ScopeProject, ownerId, zoneObj.(*SZone), nil, api.HYPERVISOR_KVM))
+	cnt, err := quotas.GetQuotaCount(ctx, &quota, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetQuotaCount")
+	}
+	if cnt < 1 {
+		return nil, httperrors.NewOutOfQuotaError("reserved amount exceeds the compute quota of project")
+	}
+
+	input.VirtualResourceCreateInput, err = manager.SVirtualResourceBaseManager.ValidateCreateData(ctx, userCred, ownerId, query, input.VirtualResourceCreateInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SVirtualResourceBaseManager.ValidateCreateData")
+	}
+	data := jsonutils.Marshal(input).(*jsonutils.JSONDict)
+	data.Set("host_ids", jsonutils.NewString(pool.HostIds))
+	return data, nil
+}
+
+func (r *SCapacityReservation) PostCreate(ctx context.Context, userCred mcclient.TokenCredential, ownerId mcclient.IIdentityProvider, query jsonutils.JSONObject, data jsonutils.JSONObject) {
+	r.SVirtualResourceBase.PostCreate(ctx, userCred, ownerId, query, data)
+	r.SetStatus(ctx, userCred, r.getCurrentStatus(time.Now()), "")
+}
+
+func (r *SCapacityReservation) ValidateUpdateData(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	input api.CapacityReservationUpdateInput,
+) (api.CapacityReservationUpdateInput, error) {
+	var err error
+	if !input.EndAt.IsZero() {
+		if !r.isAlive() {
+			return input, httperrors.NewInvalidStatusError("can not change end_at of %s reservation", r.Status)
+		}
+		if !input.EndAt.After(r.StartAt) || !input.EndAt.After(time.Now()) {
+			return input, httperrors.NewInputParameterError("end_at must be later than start_at and now")
+		}
+		if input.EndAt.After(r.EndAt) {
+			// the extended window must not overlap the reservations made
+			// on the capacity released at the original end
+			ext := *r
+			ext.StartAt, ext.EndAt = r.EndAt, input.EndAt
+			free, err := ext.getPoolFree()
+			if err != nil {
+				return input, errors.Wrap(err, "getPoolFree")
+			}
+			usage, err := r.GetUsage()
+			if err != nil {
+				return input, errors.Wrap(err, "GetUsage")
+			}
+			if nonNegative(r.CpuCount-usage.UsedCpuCount) > free.CpuCount ||
+				nonNegative(r.MemSize-usage.UsedMemSize) > free.MemSize ||
+				nonNegative(r.StorageSize-usage.UsedStorageSize) > free.StorageSize ||
+				nonNegative(r.IsolatedDeviceCount-usage.UsedIsolatedDeviceCount) > free.IsolatedDeviceCount {
+				return input, httperrors.NewOutOfResourceError("not enough unreserved capacity to extend the reservation to %s", input.EndAt)
+			}
+		}
+	}
+	input.VirtualResourceBaseUpdateInput, err = r.SVirtualResourceBase.ValidateUpdateData(ctx, userCred, query, input.VirtualResourceBaseUpdateInput)
+	if err != nil {
+		return input, errors.Wrap(err, "SVirtualResourceBase.ValidateUpdateData")
+	}
+	return input, nil
+}
+
+func (r *SCapacityReservation) PostUpdate(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) {
+	r.SVirtualResourceBase.PostUpdate(ctx, userCred, query, data)
+	if r.isAlive() {
+		r.SetStatus(ctx, userCred, r.getCurrentStatus(time.Now()), "update end_at")
+	}
+}
+
+func (r *SCapacityReservation) isAlive() bool {
+	return utils.IsInStringArray(r.Status, []string{api.CAPACITY_RESERVATION_STATUS_PENDING, api.CAPACITY_RESERVATION_STATUS_ACTIVE})
+}
+
+func (r *SCapacityReservation) getCurrentStatus(now time.Time) string {
+	if !now.Before(r.EndAt) {
+		return api.CAPACITY_RESERVATION_STATUS_EXPIRED
+	}
+	if now.Before(r.StartAt) {
+		return api.CAPACITY_RESERVATION_STATUS_PENDING
+	}
+	return api.CAPACITY_RESERVATION_STATUS_ACTIVE
+}
+
+func (r *SCapacityReservation) PerformCancel(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	input api.CapacityReservationCancelInput,
+) (jsonutils.JSONObject, error) {
+	if !r.isAlive() {
+		return nil, httperrors.NewInvalidStatusError("can not cancel %s reservation", r.Status)
+	}
+	err := r.SetStatus(ctx, userCred, api.CAPACITY_RESERVATION_STATUS_CANCELLED, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "SetStatus")
+	}
+	logclient.AddActionLogWithContext(ctx, r, logclient.ACT_CANCEL, nil, userCred, true)
+	return nil, nil
+}
+
+func (r *SCapacityReservation) GetHostIds() []string {
+	if len(r.HostIds) == 0 {
+		return []string{}
+	}
+	return strings.Split(r.HostIds, ",")
+}
+
+// GetPoolHostIds returns the hosts sharing the reservation, all hosts of the
+// zone if no host is specified
+func (r *SCapacityReservation) GetPoolHostIds() ([]string, error) {
+	hostIds := r.GetHostIds()
+	if len(hostIds) > 0 {
+		return hostIds, nil
+	}
+	q := HostManager.Query("id").Equals("zone_id", r.ZoneId)
+	rows, err := q.Rows()
+	if err != nil {
+		return nil, errors.Wrap(err, "Query hosts")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var hostId string
+		if err := rows.Scan(&hostId); err != nil {
+			return nil, errors.Wrap(err, "rows.Scan")
+		}
+		hostIds = append(hostIds, hostId)
+	}
+	return hostIds, nil
+}
+
+func (r *SCapacityReservation) getPoolCapacity() (*sPoolCapacity, error) {
+	hostIds, err := r.GetPoolHostIds()
+	if err != nil {
+		return nil, err
+	}
+	ret := &sPoolCapacity{}
+	if len(hostIds) == 0 {
+		return ret, nil
+	}
+	hosts := make([]SHost, 0)
+	err = db.FetchModelObjects(HostManager, HostManager.Query().In("id", hostIds), &hosts)
+	if err != nil {
+		return nil, errors.Wrap(err, "FetchModelObjects hosts")
+	}
+	for i := range hosts {
+		ret.CpuCount += int(hosts[i].GetVirtualCPUCount())
+		ret.MemSize += int(hosts[i].GetVirtualMemorySize())
+		capa := hosts[i].GetAttachedLocalStorageCapacity()
+		ret.StorageSize += int(capa.VCapacity)
+	}
+	devQ := IsolatedDeviceManager.Query().In("host_id", hostIds)
+	if len(r.DevModel) > 0 {
+		devQ = devQ.Equals("model", r.DevModel)
+	}
+	ret.IsolatedDeviceCount, err = devQ.CountWithError()
+	if err != nil {
+		return nil, errors.Wrap(err, "count isolated devices")
+	}
+	return ret, nil
+}
+
+// overlapsWith returns whether the reservation is alive during the window of
+// o and shares pool hosts with it
+func (r *SCapacityReservation) overlapsWith(o *SCapacityReservation, poolHostIds []string) (bool, error) {
+	if !r.StartAt.Before(o.EndAt) || !o.StartAt.Before(r.EndAt) {
+		return false, nil
+	}
+	hostIds, err := r.GetPoolHostIds()
+	if err != nil {
+		return false, err
+	}
+	for _, hostId := range hostIds {
+		if utils.IsInStringArray(hostId, poolHostIds) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// getPoolFree returns the capacity of the pool minus the resources used by
+// the existing guests and the unused part of the overlapping reservations
+func (r *SCapacityReservation) getPoolFree() (*sPoolCapacity, error) {
+	ret, err := r.getPoolCapacity()
+	if err != nil {
+		return nil, errors.Wrap(err, "getPoolCapacity")
+	}
+	hostIds, err := r.GetPoolHostIds()
+	if err != nil {
+		return nil, err
+	}
+	if len(hostIds) == 0 {
+		return ret, nil
+	}
+	status := ""
+	if options.Options.IgnoreNonrunningGuests {
+		status = api.VM_RUNNING
+	}
+	guestUsages, err := fetchHostGuestResource(hostIds, status)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetchHostGuestResource")
+	}
+	for _, usage := range guestUsages {
+		ret.CpuCount -= usage.GuestVcpuCount
+		ret.MemSize -= usage.GuestVmemSize
+	}
+	hosts := make([]SHost, 0)
+	err = db.FetchModelObjects(HostManager, HostManager.Query().In("id", hostIds), &hosts)
+	if err != nil {
+		return nil, errors.Wrap(err, "FetchModelObjects hosts")
+	}
+	for i := range hosts {
+		capa := hosts[i].GetAttachedLocalStorageCapacity()
+		ret.StorageSize -= int(capa.Used + capa.Wasted)
+	}
+	devQ := IsolatedDeviceManager.Query().In("host_id", hostIds).IsNotEmpty("guest_id")
+	if len(r.DevModel) > 0 {
+		devQ = devQ.Equals("model", r.DevModel)
+	}
+	usedDevs, err := devQ.CountWithError()
+	if err != nil {
+		return nil, errors.Wrap(err, "count used isolated devices")
+	}
+	ret.IsolatedDeviceCount -= usedDevs
+
+	q := CapacityReservationManager.Query().Equals("zone_id", r.ZoneId).In("status", []string{api.CAPACITY_RESERVATION_STATUS_PENDING, api.CAPACITY_RESERVATION_STATUS_ACTIVE}).IsFalse("pending_deleted")
+	if len(r.Id) > 0 {
+		q = q.NotEquals("id", r.Id)
+	}
+	reservations := make([]SCapacityReservation, 0)
+	err = db.FetchModelObjects(CapacityReservationManager, q, &reservations)
+	if err != nil {
+		return nil, errors.Wrap(err, "FetchModelObjects reservations")
+	}
+	for i := range reservations {
+		o := &reservations[i]
+		overlap, err := o.overlapsWith(r, hostIds)
+		if err != nil {
+			return nil, errors.Wrapf(err, "overlapsWith %s", o.Name)
+		}
+		if !overlap {
+			continue
+		}
+		// the used part of the reservation is counted in guest usages
+		usage, err := o.GetUsage()
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetUsage of %s", o.Name)
+		}
+		ret.subUnusedReserved(o, usage, r.DevModel)
+	}
+	return ret, nil
+}
+
+// subUnusedReserved takes the unused part of the reservation o out of the pool,
+// the devices of other models are not held by o
+func (pool *sPoolCapacity) subUnusedReserved(o *SCapacityReservation, usage *api.CapacityReservationUsage, devModel string) {
+	pool.CpuCount -= nonNegative(o.CpuCount - usage.UsedCpuCount)
+	pool.MemSize -= nonNegative(o.MemSize - usage.UsedMemSize)
+	pool.StorageSize -= nonNegative(o.StorageSize - usage.UsedStorageSize)
+	if len(devModel) == 0 || len(o.DevModel) == 0 || devModel == o.DevModel {
+		pool.IsolatedDeviceCount -= nonNegative(o.IsolatedDeviceCount - usage.UsedIsolatedDeviceCount)
+	}
+}
+
+// GetUsage returns the resources consumed by the owner project on the pool
+// hosts since the reservation started
+func (r *SCapacityReservation) GetUsage() (*api.CapacityReservationUsage, error) {
+	hostIds, err := r.GetPoolHostIds()
+	if err != nil {
+		return nil, err
+	}
+	ret := &api.CapacityReservationUsage{}
+	if len(hostIds) == 0 {
+		return ret, nil
+	}
+	guests := GuestManager.Query().Equals("tenant_id", r.ProjectId).In("host_id", hostIds).GE("created_at", r.StartAt).IsFalse("pending_deleted").SubQuery()
+
+	q := guests.Query(
+		sqlchemy.SUM("cpu_count", guests.Field("vcpu_count")),
+		sqlchemy.SUM("mem_size", guests.Field("vmem_size")),
+	)
+	usage := struct {
+		CpuCount int
+		MemSize  int
+	}{}
+	err = q.First(&usage)
+	if err != nil && errors.Cause(err) != sql.ErrNoRows {
+		return nil, errors.Wrap(err, "sum guests")
+	}
+	ret.UsedCpuCount, ret.UsedMemSize = usage.CpuCount, usage.MemSize
+
+	disks := DiskManager.Query().SubQuery()
+	guestdisks := GuestdiskManager.Query().SubQuery()
+	storages := StorageManager.Query().SubQuery()
+	dq := disks.Query(sqlchemy.SUM("storage_size", disks.Field("disk_size")))
+	dq = dq.Join(guestdisks, sqlchemy.Equals(guestdisks.Field("disk_id"), disks.Field("id")))
+	dq = dq.Join(guests, sqlchemy.Equals(guests.Field("id"), guestdisks.Field("guest_id")))
+	dq = dq.Join(storages, sqlchemy.Equals(storages.Field("id"), disks.Field("storage_id")))
+	dq = dq.Filter(sqlchemy.In(storages.Field("storage_type"), api.HOST_STORAGE_LOCAL_TYPES))
+	storageUsage := struct {
+		StorageSize int
+	}{}
+	err = dq.First(&storageUsage)
+	if err != nil && errors.Cause(err) != sql.ErrNoRows {
+		return nil, errors.Wrap(err, "sum disks")
+	}
+	ret.UsedStorageSize = storageUsage.StorageSize
+
+	devQ := IsolatedDeviceManager.Query().In("host_id", hostIds).In("guest_id", guests.Query(guests.Field("id")).SubQuery())
+	if len(r.DevModel) > 0 {
+		devQ = devQ.Equals("model", r.DevModel)
+	}
+	ret.UsedIsolatedDeviceCount, err = devQ.CountWithError()
+	if err != nil {
+		return nil, errors.Wrap(err, "count isolated devices")
+	}
+	return ret, nil
+}
+
+// FetchActiveReservations returns the reservations in effect at the moment
+func (manager *SCapacityReservationManager) FetchActiveReservations() ([]SCapacityReservation, error) {
+	now := time.Now().UTC()
+	q := manager.Query().In("status", []string{api.CAPACITY_RESERVATION_STATUS_PENDING, api.CAPACITY_RESERVATION_STATUS_ACTIVE})
+	q = q.LE("start_at", now).GT("end_at", now).IsFalse("pending_deleted")
+	ret := make([]SCapacityReservation, 0)
+	err := db.FetchModelObjects(manager, q, &ret)
+	if err != nil {
+		return nil, errors.Wrap(err, "FetchModelObjects")
+	}
+	return ret, nil
+}
+
+// UpdateReservationStatus activates the reservations whose window begins and
+// expires the ones whose window ends
+func (manager *SCapacityReservationManager) UpdateReservationStatus(ctx context.Context, userCred mcclient.TokenCredential, isStart bool) {
+	q := manager.Query().In("status", []string{api.CAPACITY_RESERVATION_STATUS_PENDING, api.CAPACITY_RESERVATION_STATUS_ACTIVE})
+	reservations := make([]SCapacityReservation, 0)
+	err := db.FetchModelObjects(manager, q, &reservations)
+	if err != nil {
+		log.Errorf("fetch capacity reservations: %v", err)
+		return
+	}
+	now := time.Now()
+	for i := range reservations {
+		status := reservations[i].getCurrentStatus(now)
+		if status != reservations[i].Status {
+			reservations[i].SetStatus(ctx, userCred, status, "")
+		}
+	}
+}
+
+func (manager *SCapacityReservationManager) ListItemFilter(
+	ctx context.Context,
+	q *sqlchemy.SQuery,
+	userCred mcclient.TokenCredential,
+	input api.CapacityReservationListInput,
+) (*sqlchemy.SQuery, error) {
+	var err error
+
+	q, err = manager.SVirtualResourceBaseManager.ListItemFilter(ctx, q, userCred, input.VirtualResourceListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SVirtualResourceBaseManager.ListItemFilter")
+	}
+	q, err = manager.SZoneResourceBaseManager.ListItemFilter(ctx, q, userCred, input.ZonalFilterListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SZoneResourceBaseManager.ListItemFilter")
+	}
+	if len(input.HostId) > 0 {
+		hostObj, err := HostManager.FetchByIdOrName(ctx, userCred, input.HostId)
+		if err != nil {
+			if errors.Cause(err) == sql.ErrNoRows {
+				return nil, httperrors.NewResourceNotFoundError2(HostManager.Keyword(), input.HostId)
+			}
+			return nil, httperrors.NewGeneralError(err)
+		}
+		host := hostObj.(*SHost)
+		q = q.Filter(sqlchemy.OR(
+			sqlchemy.Contains(q.Field("host_ids"), host.Id),
+			sqlchemy.AND(
+				sqlchemy.IsNullOrEmpty(q.Field("host_ids")),
+				sqlchemy.Equals(q.Field("zone_id"), host.ZoneId),
+			),
+		))
+	}
+	if input.Active != nil {
+		now := time.Now().UTC()
+		cond := sqlchemy.AND(
+			sqlchemy.In(q.Field("status"), []string{api.CAPACITY_RESERVATION_STATUS_PENDING, api.CAPACITY_RESERVATION_STATUS_ACTIVE}),
+			sqlchemy.LE(q.Field("start_at"), now),
+			sqlchemy.GT(q.Field("end_at"), now),
+		)
+		if *input.Active {
+			q = q.Filter(cond)
+		} else {
+			q = q.Filter(sqlchemy.NOT(cond))
+		}
+	}
+	return q, nil
+}
+
+func (manager *SCapacityReservationManager) OrderByExtraFields(
+	ctx context.Context,
+	q *sqlchemy.SQuery,
+	userCred mcclient.TokenCredential,
+	input api.CapacityReservationListInput,
+) (*sqlchemy.SQuery, error) {
+	var err error
+
+	q, err = manager.SVirtualResourceBaseManager.OrderByExtraFields(ctx, q, userCred, input.VirtualResourceListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SVirtualResourceBaseManager.OrderByExtraFields")
+	}
+	q, err = manager.SZoneResourceBaseManager.OrderByExtraFields(ctx, q, userCred, input.ZonalFilterListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SZoneResourceBaseManager.OrderByExtraFields")
+	}
+	return q, nil
+}
+
+func (manager *SCapacityReservationManager) QueryDistinctExtraField(q *sqlchemy.SQuery, field string) (*sqlchemy.SQuery, error) {
+	var err error
+
+	q, err = manager.SVirtualResourceBaseManager.QueryDistinctExtraField(q, field)
+	if err == nil {
+		return q, nil
+	}
+	q, err = manager.SZoneResourceBaseManager.QueryDistinctExtraField(q, field)
+	if err == nil {
+		return q, nil
+	}
+	return q, httperrors.ErrNotFound
+}
+
+func (manager *SCapacityReservationManager) ListItemExportKeys(ctx context.Context,
+	q *sqlchemy.SQuery,
+	userCred mcclient.TokenCredential,
+	keys stringutils2.SSortedStrings,
+) (*sqlchemy.SQuery, error) {
+	var err error
+	q, err = manager.SVirtualResourceBaseManager.ListItemExportKeys(ctx, q, userCred, keys)
+	if err != nil {
+		return nil, errors.Wrap(err, "SVirtualResourceBaseManager.ListItemExportKeys")
+	}
+	if keys.ContainsAny(manager.SZoneResourceBaseManager.GetExportKeys()...) {
+		q, err = manager.SZoneResourceBaseManager.ListItemExportKeys(ctx, q, userCred, keys)
+		if err != nil {
+			return nil, errors.Wrap(err, "SZoneResourceBaseManager.ListItemExportKeys")
+		}
+	}
+	return q, nil
+}
+
+func (manager *SCapacityReservationManager) FetchCustomizeColumns(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	objs []interface{},
+	fields stringutils2.SSortedStrings,
+	isList bool,
+) []api.CapacityReservationDetails {
+	rows := make([]api.CapacityReservationDetails, len(objs))
+
+	virtRows := manager.SVirtualResourceBaseManager.FetchCustomizeColumns(ctx, userCred, query, objs, fields, isList)
+	zoneRows := manager.SZoneResourceBaseManager.FetchCustomizeColumns(ctx, userCred, query, objs, fields, isList)
+
+	hostIds := []string{}
+	for i := range objs {
+		hostIds = append(hostIds, objs[i].(*SCapacityReservation).GetHostIds()...)
+	}
+	hostNames := map[string]string{}
+	if len(hostIds) > 0 {
+		hosts := make([]SHost, 0)
+		err := db.FetchModelObjects(HostManager, HostManager.Query().In("id", hostIds), &hosts)
+		if err != nil {
+			log.Errorf("FetchModelObjects hosts: %v", err)
+		}
+		for i := range hosts {
+			hostNames[hosts[i].Id] = hosts[i].Name
+		}
+	}
+
+	for i := range rows {
+		rows[i] = api.CapacityReservationDetails{
+			VirtualResourceDetails: virtRows[i],
+			ZoneResourceInfo:       zoneRows[i],
+			Hosts:                  []string{},
+		}
+		r := objs[i].(*SCapacityReservation)
+		for _, hostId := range r.GetHostIds() {
+			rows[i].Hosts = append(rows[i].Hosts, hostNames[hostId])
+		}
+		if r.isAlive() {
+			usage, err := r.GetUsage()
+			if err != nil {
+				log.Errorf("GetUsage of capacity reservation %s: %v", r.Name, err)
+				continue
+			}
+			rows[i].CapacityReservationUsage = *usage
+		}
+	}
+
+	return rows
+}
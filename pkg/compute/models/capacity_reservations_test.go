@@ -0,0 +1,146 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+	"time"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+)
+
+func TestCapacityReservationOverlapsWith(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	window := func(start, end int) (time.Time, time.Time) {
+		return base.Add(time.Duration(start) * time.Hour), base.Add(time.Duration(end) * time.Hour)
+	}
+	// the new reservation holds h1 and h2 from 10:00 to 20:00
+	r := &SCapacityReservation{}
+	r.StartAt, r.EndAt = window(10, 20)
+	poolHostIds := []string{"h1", "h2"}
+
+	cases := []struct {
+		name       string
+		start, end int
+		hostIds    string
+		want       bool
+	}{
+		{"contained", 12, 18, "h1", true},
+		{"containing", 0, 30, "h2", true},
+		{"overlapping start", 5, 11, "h1", true},
+		{"overlapping end", 19, 25, "h1,h3", true},
+		{"same window", 10, 20, "h2", true},
+		{"ending at start", 5, 10, "h1", false},
+		{"starting at end", 20, 25, "h1", false},
+		{"before", 0, 5, "h1", false},
+		{"after", 21, 30, "h1", false},
+		{"other hosts", 12, 18, "h3,h4", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			o := &SCapacityReservation{HostIds: c.hostIds}
+			o.StartAt, o.EndAt = window(c.start, c.end)
+			got, err := o.overlapsWith(r, poolHostIds)
+			if err != nil {
+				t.Fatalf("overlapsWith: %v", err)
+			}
+			if got != c.want {
+				t.Errorf("want overlap %v, got %v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestCapacityReservationStatus(t *testing.T) {
+	now := time.Now()
+	r := &SCapacityReservation{StartAt: now.Add(time.Hour), EndAt: now.Add(2 * time.Hour)}
+	cases := []struct {
+		at   time.Time
+		want string
+	}{
+		{now, api.CAPACITY_RESERVATION_STATUS_PENDING},
+		{now.Add(time.Hour), api.CAPACITY_RESERVATION_STATUS_ACTIVE},
+		{now.Add(90 * time.Minute), api.CAPACITY_RESERVATION_STATUS_ACTIVE},
+		{now.Add(2 * time.Hour), api.CAPACITY_RESERVATION_STATUS_EXPIRED},
+	}
+	for _, c := range cases {
+		if got := r.getCurrentStatus(c.at); got != c.want {
+			t.Errorf("at %s: want %s, got %s", c.at.Sub(now), c.want, got)
+		}
+	}
+}
+
+func TestPoolSubUnusedReserved(t *testing.T) {
+	reservation := &SCapacityReservation{
+		CpuCount:            16,
+		MemSize:             32768,
+		StorageSize:         102400,
+		IsolatedDeviceCount: 2,
+		DevModel:            "A100",
+	}
+	cases := []struct {
+		name     string
+		usage    api.CapacityReservationUsage
+		devModel string
+		want     sPoolCapacity
+	}{
+		{
+			name:  "unused",
+			usage: api.CapacityReservationUsage{},
+			want:  sPoolCapacity{CpuCount: 48, MemSize: 98304, StorageSize: 409600, IsolatedDeviceCount: 6},
+		},
+		{
+			name: "partially consumed",
+			usage: api.CapacityReservationUsage{
+				UsedCpuCount:            4,
+				UsedMemSize:             8192,
+				UsedStorageSize:         102400,
+				UsedIsolatedDeviceCount: 1,
+			},
+			want: sPoolCapacity{CpuCount: 52, MemSize: 106496, StorageSize: 512000, IsolatedDeviceCount: 7},
+		},
+		{
+			name: "overused",
+			usage: api.CapacityReservationUsage{
+				UsedCpuCount:            32,
+				UsedMemSize:             65536,
+				UsedStorageSize:         204800,
+				UsedIsolatedDeviceCount: 4,
+			},
+			want: sPoolCapacity{CpuCount: 64, MemSize: 131072, StorageSize: 512000, IsolatedDeviceCount: 8},
+		},
+		{
+			name:     "devices of other model",
+			usage:    api.CapacityReservationUsage{},
+			devModel: "T4",
+			want:     sPoolCapacity{CpuCount: 48, MemSize: 98304, StorageSize: 409600, IsolatedDeviceCount: 8},
+		},
+		{
+			name:     "devices of same model",
+			usage:    api.CapacityReservationUsage{UsedIsolatedDeviceCount: 1},
+			devModel: "A100",
+			want:     sPoolCapacity{CpuCount: 48, MemSize: 98304, StorageSize: 409600, IsolatedDeviceCount: 7},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pool := &sPoolCapacity{CpuCount: 64, MemSize: 131072, StorageSize: 512000, IsolatedDeviceCount: 8}
+			pool.subUnusedReserved(reservation, &c.usage, c.devModel)
+			if *pool != c.want {
+				t.Errorf("want %+v, got %+v", c.want, *pool)
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/utils"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
+	"yunion.io/x/onecloud/pkg/compute/options"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+)
+
+// Incremental and differential disk backups export only the clusters recorded
+// by the persistent dirty bitmap of the parent backup, which is the chain tip
+// kept in the disk metadata. A full or incremental backup adds its own bitmap
+// atomically with the backup job and becomes the tip once it is recorded, a
+// differential backup leaves both untouched. No bitmap is cleared by the
+// backup job, the host drops the bitmaps older than the recorded tip, so a
+// failed backup leaves the chain as is.
+
+func (backup *SDiskBackup) IsChained() bool {
+	return len(backup.DirtyBitmap) > 0
+}
+
+// GetNewDirtyBitmap returns the name of the dirty bitmap added if the backup
+// starts a new chain
+func (backup *SDiskBackup) GetNewDirtyBitmap() string {
+	return api.DISK_BACKUP_DIRTY_BITMAP_PREFIX + backup.Id
+}
+
+func (manager *SDiskBackupManager) validateBackupMode(disk *SDisk, input api.DiskBackupCreateInput) error {
+	if !utils.IsInStringArray(input.BackupMode, []string{api.DISK_BACKUP_MODE_FULL, api.DISK_BACKUP_MODE_INCREMENTAL, api.DISK_BACKUP_MODE_DIFFERENTIAL}) {
+		return httperrors.NewInputParameterError("invalid backup_mode %s", input.BackupMode)
+	}
+	if input.BackupAsTar != nil {
+		return httperrors.NewInputParameterError("backup_mode is not supported by backup_as_tar")
+	}
+	if len(disk.EncryptKeyId) > 0 {
+		return httperrors.NewNotSupportedError("backup_mode is not supported by encrypted disk")
+	}
+	if disk.DiskFormat != "qcow2" {
+		return httperrors.NewNotSupportedError("backup_mode is not supported by disk format %s", disk.DiskFormat)
+	}
+	guest := disk.GetGuest()
+	if guest == nil || guest.Hypervisor != api.HYPERVISOR_KVM {
+		return httperrors.NewNotSupportedError("backup_mode is only supported by disk of kvm guest")
+	}
+	if guest.Status != api.VM_RUNNING {
+		return httperrors.NewInvalidStatusError("backup_mode requires guest %s running, current status %s", guest.Name, guest.Status)
+	}
+	return nil
+}
+
+func (backup *SDiskBackup) getChainTip(ctx context.Context, disk *SDisk) *SDiskBackup {
+	tipId := disk.GetMetadata(ctx, api.DISK_METADATA_BACKUP_CHAIN_TIP, nil)
+	if len(tipId) == 0 {
+		return nil
+	}
+	obj, err := DiskBackupManager.FetchById(tipId)
+	if err != nil {
+		return nil
+	}
+	tip := obj.(*SDiskBackup)
+	if !tip.IsChained() || tip.DiskId != backup.DiskId || tip.BackupStorageId != backup.BackupStorageId {
+		return nil
+	}
+	if !utils.IsInStringArray(tip.Status, []string{api.BACKUP_STATUS_READY, api.BACKUP_STATUS_CONSOLIDATING}) {
+		return nil
+	}
+	return tip
+}
+
+// linkBackupChain returns the mode, parent and dirty bitmap of the backup
+// linked to the chain tip, the bitmap of a differential backup is the one of
+// its parent, the others record the changes since themselves
+func (backup *SDiskBackup) linkBackupChain(tip *SDiskBackup) (string, string, string) {
+	mode, parentId, bitmap := backup.BackupMode, "", backup.GetNewDirtyBitmap()
+	if mode == api.DISK_BACKUP_MODE_FULL {
+		return mode, parentId, bitmap
+	}
+	if tip == nil {
+		return api.DISK_BACKUP_MODE_FULL, parentId, bitmap
+	}
+	if mode == api.DISK_BACKUP_MODE_DIFFERENTIAL {
+		bitmap = tip.DirtyBitmap
+	}
+	return mode, tip.Id, bitmap
+}
+
+// PrepareBackupChain picks the parent of the backup, the backup falls back to
+// full if there is no usable chain tip
+func (backup *SDiskBackup) PrepareBackupChain(ctx context.Context) error {
+	disk, err := backup.GetDisk()
+	if err != nil {
+		return errors.Wrap(err, "GetDisk")
+	}
+	tip := backup.getChainTip(ctx, disk)
+	mode, parentId, bitmap := backup.linkBackupChain(tip)
+	if mode != backup.BackupMode {
+		log.Infof("no backup chain of disk %s, backup %s fallback to full", disk.Id, backup.Id)
+	}
+	_, err = db.Update(backup, func() error {
+		backup.BackupMode = mode
+		backup.ParentBackupId = parentId
+		backup.DirtyBitmap = bitmap
+		return nil
+	})
+	return err
+}
+
+// GetChainDirtyBitmaps returns the bitmap to read by the backup, and the
+// bitmap of the chain tip which should be kept by the host
+func (backup *SDiskBackup) GetChainDirtyBitmaps(ctx context.Context) (string, string, error) {
+	disk, err := backup.GetDisk()
+	if err != nil {
+		return "", "", errors.Wrap(err, "GetDisk")
+	}
+	keep := ""
+	if tip := backup.getChainTip(ctx, disk); tip != nil {
+		keep = tip.DirtyBitmap
+	}
+	if len(backup.ParentBackupId) == 0 {
+		return "", keep, nil
+	}
+	parent, err := DiskBackupManager.FetchById(backup.ParentBackupId)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "fetch parent backup %s", backup.ParentBackupId)
+	}
+	return parent.(*SDiskBackup).DirtyBitmap, keep, nil
+}
+
+// SaveBackupChain records the result of the dirty bitmap backup, the host
+// takes a full backup instead if the bitmap is lost
+func (backup *SDiskBackup) SaveBackupChain(ctx context.Context, userCred mcclient.TokenCredential, data jsonutils.JSONObject) error {
+	sizeMb, _ := data.Int("size_mb")
+	mode, _ := data.GetString("backup_mode")
+	bitmap, _ := data.GetString("dirty_bitmap")
+	_, err := db.Update(backup, func() error {
+		backup.SizeMb = int(sizeMb)
+		if len(mode) > 0 {
+			backup.BackupMode = mode
+		}
+		if len(bitmap) > 0 {
+			backup.DirtyBitmap = bitmap
+		}
+		if backup.BackupMode == api.DISK_BACKUP_MODE_FULL {
+			backup.ParentBackupId = ""
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "update backup")
+	}
+	if backup.BackupMode == api.DISK_BACKUP_MODE_DIFFERENTIAL {
+		return nil
+	}
+	disk, err := backup.GetDisk()
+	if err != nil {
+		return errors.Wrap(err, "GetDisk")
+	}
+	return disk.SetMetadata(ctx, api.DISK_METADATA_BACKUP_CHAIN_TIP, backup.Id, userCred)
+}
+
+// GetBackupChain returns the ancestors of the backup from the full backup down
+// to the parent
+func (backup *SDiskBackup) GetBackupChain() ([]string, error) {
+	chain := []string{}
+	visited := map[string]bool{backup.Id: true}
+	cur := backup
+	for len(cur.ParentBackupId) > 0 {
+		if visited[cur.ParentBackupId] {
+			return nil, errors.Errorf("loop in backup chain of %s at %s", backup.Id, cur.ParentBackupId)
+		}
+		obj, err := DiskBackupManager.FetchById(cur.ParentBackupId)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fetch parent %s of backup %s", cur.ParentBackupId, cur.Id)
+		}
+		cur = obj.(*SDiskBackup)
+		if cur.BackupStorageId != backup.BackupStorageId {
+			return nil, errors.Errorf("parent backup %s is on different backup storage", cur.Id)
+		}
+		visited[cur.Id] = true
+		chain = append([]string{cur.Id}, chain...)
+	}
+	return chain, nil
+}
+
+func (backup *SDiskBackup) GetDependentBackups() ([]SDiskBackup, error) {
+	q := DiskBackupManager.Query().Equals("parent_backup_id", backup.Id)
+	backups := make([]SDiskBackup, 0)
+	err := db.FetchModelObjects(DiskBackupManager, q, &backups)
+	if err != nil {
+		return nil, errors.Wrap(err, "FetchModelObjects")
+	}
+	return backups, nil
+}
+
+func (backup *SDiskBackup) GetDependentBackupCount() (int, error) {
+	return DiskBackupManager.Query().Equals("parent_backup_id", backup.Id).CountWithError()
+}
+
+// PerformConsolidate merges the ancestors into the backup, so that the backup
+// no longer depends on them
+func (backup *SDiskBackup) PerformConsolidate(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input api.DiskBackupConsolidateInput) (jsonutils.JSONObject, error) {
+	if backup.Status != api.BACKUP_STATUS_READY {
+		return nil, httperrors.NewInvalidStatusError("cannot consolidate backup in status %s", backup.Status)
+	}
+	if len(backup.ParentBackupId) == 0 {
+		return nil, httperrors.NewBadRequestError("backup %s does not depend on other backups", backup.Name)
+	}
+	return nil, backup.StartConsolidateTask(ctx, userCred, "")
+}
+
+func (backup *SDiskBackup) StartConsolidateTask(ctx context.Context, userCred mcclient.TokenCredential, parentTaskId string) error {
+	backup.SetStatus(ctx, userCred, api.BACKUP_STATUS_CONSOLIDATING, "")
+	task, err := taskman.TaskManager.NewTask(ctx, "DiskBackupConsolidateTask", backup, userCred, nil, parentTaskId, "", nil)
+	if err != nil {
+		return err
+	}
+	return task.ScheduleRun(nil)
+}
+
+// ExpireBackupChainLinks removes the chain links older than the retention
+// days, an expired link is deleted once nothing depends on it, the unexpired
+// backups depending on it are consolidated first
+func (manager *SDiskBackupManager) ExpireBackupChainLinks(ctx context.Context, userCred mcclient.TokenCredential, isStart bool) {
+	if options.Options.DiskBackupChainRetentionDays <= 0 {
+		return
+	}
+	expireAt := time.Now().AddDate(0, 0, -options.Options.DiskBackupChainRetentionDays)
+	q := manager.Query().IsNotEmpty("dirty_bitmap").Equals("status", api.BACKUP_STATUS_READY).LT("created_at", expireAt)
+	backups := make([]SDiskBackup, 0)
+	err := db.FetchModelObjects(manager, q, &backups)
+	if err != nil {
+		log.Errorf("fetch expired backup chain links: %v", err)
+		return
+	}
+	for i := range backups {
+		backup := &backups[i]
+		dependents, err := backup.GetDependentBackups()
+		if err != nil {
+			log.Errorf("GetDependentBackups of %s: %v", backup.Id, err)
+			continue
+		}
+		if len(dependents) == 0 {
+			err = backup.ValidateDeleteCondition(ctx, nil)
+			if err != nil {
+				log.Warningf("expired backup %s cannot be deleted: %v", backup.Id, err)
+				continue
+			}
+			err = backup.StartBackupDeleteTask(ctx, userCred, "", false)
+			if err != nil {
+				log.Errorf("delete expired backup %s: %v", backup.Id, err)
+			}
+			continue
+		}
+		for j := range dependents {
+			dependent := &dependents[j]
+			if dependent.Status != api.BACKUP_STATUS_READY || dependent.CreatedAt.Before(expireAt) {
+				continue
+			}
+			err = dependent.StartConsolidateTask(ctx, userCred, "")
+			if err != nil {
+				log.Errorf("consolidate backup %s: %v", dependent.Id, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+)
+
+func TestLinkBackupChain(t *testing.T) {
+	full := &SDiskBackup{BackupMode: api.DISK_BACKUP_MODE_FULL}
+	full.Id = "b1"
+	full.DirtyBitmap = full.GetNewDirtyBitmap()
+
+	cases := []struct {
+		name       string
+		mode       string
+		tip        *SDiskBackup
+		wantMode   string
+		wantParent string
+		wantBitmap string
+	}{
+		{"full", api.DISK_BACKUP_MODE_FULL, full, api.DISK_BACKUP_MODE_FULL, "", "backup-b2"},
+		{"incremental", api.DISK_BACKUP_MODE_INCREMENTAL, full, api.DISK_BACKUP_MODE_INCREMENTAL, "b1", "backup-b2"},
+		{"differential", api.DISK_BACKUP_MODE_DIFFERENTIAL, full, api.DISK_BACKUP_MODE_DIFFERENTIAL, "b1", "backup-b1"},
+		{"no tip", api.DISK_BACKUP_MODE_INCREMENTAL, nil, api.DISK_BACKUP_MODE_FULL, "", "backup-b2"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			backup := &SDiskBackup{BackupMode: c.mode}
+			backup.Id = "b2"
+			mode, parentId, bitmap := backup.linkBackupChain(c.tip)
+			if mode != c.wantMode || parentId != c.wantParent || bitmap != c.wantBitmap {
+				t.Errorf("want %s %s %s, got %s %s %s", c.wantMode, c.wantParent, c.wantBitmap, mode, parentId, bitmap)
+			}
+		})
+	}
+}
@@ -64,6 +64,13 @@ type SDiskBackup struct {
 	// 操作系统类型
 	OsType     string `width:"32" charset:"ascii" nullable:"true" list:"user" create:"optional"`
 	DiskConfig *SBackupDiskConfig
+
+	// 备份模式
+	BackupMode string `width:"16" charset:"ascii" nullable:"true" list:"user" create:"optional"`
+	// 依赖的备份
+	ParentBackupId string `width:"36" charset:"ascii" nullable:"true" list:"user" index:"true"`
+	// 记录备份链变化的脏位图
+	DirtyBitmap string `width:"64" charset:"ascii" nullable:"true" list:"user"`
 }
 
 var DiskBackupManager *SDiskBackupManager
@@ -121,6 +128,12 @@ func (dm *SDiskBackupManager) ListItemFilter(ctx context.Context, q *sqlchemy.SQ
 	if input.BackupStorageId != "" {
 		q = q.Equals("backup_storage_id", input.BackupStorageId)
 	}
+	if len(input.BackupMode) > 0 {
+		q = q.In("backup_mode", input.BackupMode)
+	}
+	if input.ParentBackupId != "" {
+		q = q.Equals("parent_backup_id", input.ParentBackupId)
+	}
 	if input.IsInstanceBackup != nil {
 		insjsq := InstanceBackupJointManager.Query().SubQuery()
 		if !*input.IsInstanceBackup {
@@ -144,6 +157,13 @@ func (self *SDiskBackup) ValidateDeleteCondition(ctx context.Context, info jsonu
 	if is {
 		return httperrors.NewBadRequestError("disk backup referenced by instance backup")
 	}
+	cnt, err := self.GetDependentBackupCount()
+	if err != nil {
+		return err
+	}
+	if cnt > 0 {
+		return httperrors.NewBadRequestError("disk backup depended by %d backups, consolidate them first", cnt)
+	}
 	return nil
 }
 
@@ -183,6 +203,14 @@ func (db *SDiskBackup) getMoreDetails(out api.DiskBackupDetails) api.DiskBackupD
 	if t, _ := InstanceBackupJointManager.IsSubBackup(db.Id); t {
 		out.IsSubBackup = true
 	}
+	if len(db.ParentBackupId) > 0 {
+		if parent, _ := DiskBackupManager.FetchById(db.ParentBackupId); parent != nil {
+			out.ParentBackup = parent.GetName()
+		}
+	}
+	if db.IsChained() {
+		out.DependentBackupCount, _ = db.GetDependentBackupCount()
+	}
 	return out
 }
 
@@ -281,6 +309,13 @@ func (dm *SDiskBackupManager) ValidateCreateData(
 	}
 	input.CloudregionId = region.Id
 
+	if len(input.BackupMode) > 0 {
+		err = dm.validateBackupMode(disk, input)
+		if err != nil {
+			return input, err
+		}
+	}
+
 	if input.BackupAsTar != nil {
 		if input.BackupAsTar.ContainerId == "" {
 			return input, httperrors.NewMissingParameterError("container_id")
@@ -825,12 +825,17 @@ func (self *SDisk) getDiskAllocateFromBackupInput(ctx context.Context, backupId
 	if err != nil {
 		return nil, errors.Wrap(err, "backupStorage.GetAccessInfo")
 	}
+	chain, err := backup.GetBackupChain()
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get backup chain of backup %s", backupId)
+	}
 	return &api.DiskAllocateFromBackupInput{
 		BackupId:                backupId,
 		BackupStorageId:         bs.GetId(),
 		BackupStorageAccessInfo: jsonutils.Marshal(accessInfo).(*jsonutils.JSONDict),
 		DiskConfig:              &backup.DiskConfig.DiskConfig,
 		BackupAsTar:             backup.DiskConfig.BackupAsTar,
+		BackupChain:             chain,
 	}, nil
 }
 
@@ -2118,6 +2123,15 @@ func fillDiskConfigByImage(ctx context.Context, userCred mcclient.TokenCredentia
 		if image.Status != cloudprovider.IMAGE_STATUS_ACTIVE {
 			return httperrors.NewInvalidStatusError("Image status is not active")
 		}
+		if options.Options.RequireSignedImage && len(image.ExternalId) == 0 {
+			status := image.Properties[imageapi.IMAGE_SIGNATURE_STATUS]
+			if len(status) == 0 {
+				status = imageapi.IMAGE_SIGNATURE_STATUS_UNSIGNED
+			}
+			if status != imageapi.IMAGE_SIGNATURE_STATUS_VERIFIED {
+				return httperrors.NewForbiddenError("image %s signature is %s, only verified images are allowed", image.Name, status)
+			}
+		}
 		diskConfig.ImageId = image.Id
 		diskConfig.ImageEncryptKeyId = image.EncryptKeyId
 		diskConfig.ImageProperties = image.Properties
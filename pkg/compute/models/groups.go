@@ -27,6 +27,7 @@ import (
 	"yunion.io/x/pkg/util/netutils"
 	"yunion.io/x/pkg/util/rbacscope"
 	"yunion.io/x/pkg/util/sets"
+	"yunion.io/x/pkg/utils"
 	"yunion.io/x/sqlchemy"
 
 	"yunion.io/x/onecloud/pkg/apis"
@@ -89,6 +90,9 @@ type SGroup struct {
 	// the upper limit number of guests with this group in a host
 	Granularity     int               `nullable:"false" list:"user" get:"user" create:"optional" update:"user" default:"1"`
 	ForceDispersion tristate.TriState `list:"user" get:"user" create:"optional" update:"user" default:"true"`
+
+	// 拓扑分布约束
+	SpreadConstraints api.GroupSpreadConstraints `length:"medium" nullable:"true" list:"user" get:"user" create:"optional" update:"user"`
 	// 是否启用
 	// Enabled tristate.TriState `default:"true" create:"optional" list:"user" update:"user"`
 }
@@ -138,6 +142,74 @@ func (sm *SGroupManager) ListItemFilter(
 	return q, nil
 }
 
+func (sm *SGroupManager) ValidateCreateData(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	ownerId mcclient.IIdentityProvider,
+	query jsonutils.JSONObject,
+	input api.InstanceGroupCreateInput,
+) (api.InstanceGroupCreateInput, error) {
+	var err error
+	input.VirtualResourceCreateInput, err = sm.SVirtualResourceBaseManager.ValidateCreateData(ctx, userCred, ownerId, query, input.VirtualResourceCreateInput)
+	if err != nil {
+		return input, errors.Wrap(err, "SVirtualResourceBaseManager.ValidateCreateData")
+	}
+	err = validateGroupSpreadConstraints(input.SpreadConstraints)
+	if err != nil {
+		return input, err
+	}
+	return input, nil
+}
+
+func (group *SGroup) ValidateUpdateData(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	input api.InstanceGroupUpdateInput,
+) (api.InstanceGroupUpdateInput, error) {
+	var err error
+	input.VirtualResourceBaseUpdateInput, err = group.SVirtualResourceBase.ValidateUpdateData(ctx, userCred, query, input.VirtualResourceBaseUpdateInput)
+	if err != nil {
+		return input, errors.Wrap(err, "SVirtualResourceBase.ValidateUpdateData")
+	}
+	err = validateGroupSpreadConstraints(input.SpreadConstraints)
+	if err != nil {
+		return input, err
+	}
+	return input, nil
+}
+
+func validateGroupSpreadConstraints(constraints api.GroupSpreadConstraints) error {
+	keys := sets.NewString()
+	for i := range constraints {
+		c := &constraints[i]
+		kind, arg := c.ParseTopologyKey()
+		switch kind {
+		case api.GROUP_TOPOLOGY_KEY_ZONE:
+		case "schedtag", "metadata":
+			if len(arg) == 0 {
+				return httperrors.NewInputParameterError("empty %s in topology_key %q", kind, c.TopologyKey)
+			}
+		default:
+			return httperrors.NewInputParameterError("invalid topology_key %q", c.TopologyKey)
+		}
+		if keys.Has(c.TopologyKey) {
+			return httperrors.NewDuplicateIdError("topology_key", c.TopologyKey)
+		}
+		keys.Insert(c.TopologyKey)
+		if c.MaxSkew < 1 {
+			return httperrors.NewInputParameterError("max_skew of topology_key %q must be greater than 0", c.TopologyKey)
+		}
+		if len(c.WhenUnsatisfiable) == 0 {
+			c.WhenUnsatisfiable = api.GROUP_SPREAD_DO_NOT_SCHEDULE
+		}
+		if !utils.IsInStringArray(c.WhenUnsatisfiable, []string{api.GROUP_SPREAD_DO_NOT_SCHEDULE, api.GROUP_SPREAD_SCHEDULE_ANYWAY}) {
+			return httperrors.NewInputParameterError("invalid when_unsatisfiable %q", c.WhenUnsatisfiable)
+		}
+	}
+	return nil
+}
+
 func (sm *SGroupManager) OrderByExtraFields(
 	ctx context.Context,
 	q *sqlchemy.SQuery,
@@ -4994,6 +4994,24 @@ func (self *SGuest) PerformIoThrottle(ctx context.Context, userCred mcclient.Tok
 		}
 	}
 
+	for diskId, bpsMin := range input.BpsMin {
+		if bpsMin < 0 {
+			return nil, httperrors.NewInputParameterError("disk %s bps_min must > 0", diskId)
+		}
+		if bps, ok := input.Bps[diskId]; ok && bps > 0 && bpsMin > bps {
+			return nil, httperrors.NewInputParameterError("disk %s bps_min %d exceeds bps %d", diskId, bpsMin, bps)
+		}
+	}
+
+	for diskId, iopsMin := range input.IopsMin {
+		if iopsMin < 0 {
+			return nil, httperrors.NewInputParameterError("disk %s iops_min must > 0", diskId)
+		}
+		if iops, ok := input.IOPS[diskId]; ok && iops > 0 && iopsMin > iops {
+			return nil, httperrors.NewInputParameterError("disk %s iops_min %d exceeds iops %d", diskId, iopsMin, iops)
+		}
+	}
+
 	if err := self.UpdateIoThrottle(input); err != nil {
 		return nil, errors.Wrap(err, "update io throttles")
 	}
@@ -5013,6 +5031,12 @@ func (self *SGuest) UpdateIoThrottle(input *api.ServerSetDiskIoThrottleInput) er
 			if iops, ok := input.IOPS[gds[i].DiskId]; ok {
 				gds[i].Iops = iops
 			}
+			if bpsMin, ok := input.BpsMin[gds[i].DiskId]; ok {
+				gds[i].BpsMin = bpsMin
+			}
+			if iopsMin, ok := input.IopsMin[gds[i].DiskId]; ok {
+				gds[i].IopsMin = iopsMin
+			}
 			return nil
 		})
 		if err != nil {
@@ -6515,3 +6539,23 @@ func (self *SGuest) PerformSyncOsInfo(ctx context.Context, userCred mcclient.Tok
 		return nil, self.startQgaSyncOsInfoTask(ctx, userCred, "")
 	}
 }
+
+func (self *SGuest) GetDetailsSchedDecisions(ctx context.Context, userCred mcclient.TokenCredential, input *api.ServerGetSchedDecisionsInput) (*api.ServerGetSchedDecisionsResp, error) {
+	limit := 10
+	if input.Limit != nil {
+		limit = *input.Limit
+	}
+	decisions, err := SchedDecisionManager.FetchGuestDecisions(self.Id, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "FetchGuestDecisions")
+	}
+	resp := &api.ServerGetSchedDecisionsResp{
+		Decisions: make([]api.SSchedDecision, 0, len(decisions)),
+	}
+	for i := range decisions {
+		decision := api.SSchedDecision{}
+		jsonutils.Update(&decision, &decisions[i])
+		resp.Decisions = append(resp.Decisions, decision)
+	}
+	return resp, nil
+}
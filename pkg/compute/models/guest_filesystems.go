@@ -0,0 +1,279 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/validators"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/logclient"
+)
+
+// +onecloud:swagger-gen-ignore
+type SGuestFilesystemMountManager struct {
+	db.SResourceBaseManager
+}
+
+var GuestFilesystemMountManager *SGuestFilesystemMountManager
+
+func init() {
+	GuestFilesystemMountManager = &SGuestFilesystemMountManager{
+		SResourceBaseManager: db.NewResourceBaseManager(
+			SGuestFilesystemMount{},
+			"guest_filesystem_mounts_tbl",
+			"guest_filesystem_mount",
+			"guest_filesystem_mounts",
+		),
+	}
+	GuestFilesystemMountManager.SetVirtualObject(GuestFilesystemMountManager)
+}
+
+// SGuestFilesystemMount is a directory shared into a kvm guest through virtiofs
+// +onecloud:swagger-gen-ignore
+type SGuestFilesystemMount struct {
+	db.SResourceBase
+
+	RowId   int64  `primary:"true" auto_increment:"true" list:"user"`
+	GuestId string `width:"36" charset:"ascii" nullable:"false" index:"true" list:"user"`
+	// 挂载标签
+	Tag string `width:"36" charset:"ascii" nullable:"false" list:"user"`
+	// enum: host_path, mount_target
+	SourceType    string `width:"16" charset:"ascii" nullable:"false" list:"user"`
+	HostPath      string `width:"256" charset:"utf8" nullable:"true" list:"user"`
+	MountTargetId string `width:"36" charset:"ascii" nullable:"true" list:"user"`
+	SubPath       string `width:"256" charset:"utf8" nullable:"true" list:"user"`
+	ReadOnly      bool   `nullable:"false" default:"false" list:"user"`
+}
+
+var guestFilesystemTagReg = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+func (self *SGuestFilesystemMount) getMountTarget() (*SMountTarget, error) {
+	obj, err := MountTargetManager.FetchById(self.MountTargetId)
+	if err != nil {
+		return nil, errors.Wrapf(err, "MountTargetManager.FetchById(%s)", self.MountTargetId)
+	}
+	return obj.(*SMountTarget), nil
+}
+
+func (self *SGuestFilesystemMount) getDetails() api.GuestFilesystemMountDetails {
+	ret := api.GuestFilesystemMountDetails{
+		Tag:           self.Tag,
+		SourceType:    self.SourceType,
+		HostPath:      self.HostPath,
+		MountTargetId: self.MountTargetId,
+		SubPath:       self.SubPath,
+		ReadOnly:      self.ReadOnly,
+	}
+	if len(self.MountTargetId) > 0 {
+		if mt, err := self.getMountTarget(); err == nil {
+			ret.MountTarget = mt.Name
+		}
+	}
+	return ret
+}
+
+func (self *SGuestFilesystemMount) getJsonDesc() (*api.GuestFilesystemJsonDesc, error) {
+	desc := &api.GuestFilesystemJsonDesc{
+		Tag:        self.Tag,
+		SourceType: self.SourceType,
+		ReadOnly:   self.ReadOnly,
+	}
+	switch self.SourceType {
+	case api.GUEST_FILESYSTEM_SOURCE_HOST_PATH:
+		desc.Source = self.HostPath
+	case api.GUEST_FILESYSTEM_SOURCE_MOUNT_TARGET:
+		mt, err := self.getMountTarget()
+		if err != nil {
+			return nil, err
+		}
+		desc.Source = fmt.Sprintf("%s:%s", mt.DomainName, self.SubPath)
+	default:
+		return nil, errors.Wrapf(errors.ErrNotSupported, "source type %s", self.SourceType)
+	}
+	return desc, nil
+}
+
+func (self *SGuest) GetFilesystemMounts() ([]SGuestFilesystemMount, error) {
+	q := GuestFilesystemMountManager.Query().Equals("guest_id", self.Id).Asc("row_id")
+	mounts := make([]SGuestFilesystemMount, 0)
+	err := db.FetchModelObjects(GuestFilesystemMountManager, q, &mounts)
+	if err != nil {
+		return nil, errors.Wrap(err, "FetchModelObjects")
+	}
+	return mounts, nil
+}
+
+func (self *SGuest) getFilesystemMount(tag string) (*SGuestFilesystemMount, error) {
+	mounts, err := self.GetFilesystemMounts()
+	if err != nil {
+		return nil, err
+	}
+	for i := range mounts {
+		if mounts[i].Tag == tag {
+			return &mounts[i], nil
+		}
+	}
+	return nil, httperrors.NewResourceNotFoundError2("filesystem mount", tag)
+}
+
+func (self *SGuest) HasHostPathFilesystemMounts() (bool, error) {
+	cnt, err := GuestFilesystemMountManager.Query().Equals("guest_id", self.Id).
+		Equals("source_type", api.GUEST_FILESYSTEM_SOURCE_HOST_PATH).CountWithError()
+	if err != nil {
+		return false, errors.Wrap(err, "CountWithError")
+	}
+	return cnt > 0, nil
+}
+
+func (self *SGuest) getFilesystemJsonDescs() []*api.GuestFilesystemJsonDesc {
+	mounts, err := self.GetFilesystemMounts()
+	if err != nil {
+		return nil
+	}
+	ret := make([]*api.GuestFilesystemJsonDesc, 0, len(mounts))
+	for i := range mounts {
+		desc, err := mounts[i].getJsonDesc()
+		if err != nil {
+			// skip mounts whose source was removed, the guest still boots
+			continue
+		}
+		ret = append(ret, desc)
+	}
+	return ret
+}
+
+func (self *SGuest) GetDetailsFilesystemMounts(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject) ([]api.GuestFilesystemMountDetails, error) {
+	mounts, err := self.GetFilesystemMounts()
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]api.GuestFilesystemMountDetails, 0, len(mounts))
+	for i := range mounts {
+		ret = append(ret, mounts[i].getDetails())
+	}
+	return ret, nil
+}
+
+func (self *SGuest) validateAttachFilesystemInput(ctx context.Context, userCred mcclient.TokenCredential, input *api.ServerAttachFilesystemInput) error {
+	if len(input.Tag) == 0 {
+		return httperrors.NewMissingParameterError("tag")
+	}
+	if len(input.Tag) > api.GUEST_FILESYSTEM_TAG_MAX_LENGTH || !guestFilesystemTagReg.MatchString(input.Tag) {
+		return httperrors.NewInputParameterError("invalid tag %q", input.Tag)
+	}
+	if _, err := self.getFilesystemMount(input.Tag); err == nil {
+		return httperrors.NewDuplicateNameError("tag", input.Tag)
+	}
+	switch input.SourceType {
+	case api.GUEST_FILESYSTEM_SOURCE_HOST_PATH:
+		if !userCred.HasSystemAdminPrivilege() {
+			return httperrors.NewForbiddenError("only system admin can share host path")
+		}
+		if !filepath.IsAbs(input.HostPath) {
+			return httperrors.NewInputParameterError("host_path must be an absolute path")
+		}
+		input.HostPath = filepath.Clean(input.HostPath)
+		if input.HostPath == "/" {
+			return httperrors.NewInputParameterError("can't share host root directory")
+		}
+		input.MountTargetId = ""
+		input.SubPath = ""
+	case api.GUEST_FILESYSTEM_SOURCE_MOUNT_TARGET:
+		if len(input.MountTargetId) == 0 {
+			return httperrors.NewMissingParameterError("mount_target_id")
+		}
+		mtObj, err := validators.ValidateModel(ctx, userCred, MountTargetManager, &input.MountTargetId)
+		if err != nil {
+			return err
+		}
+		mt := mtObj.(*SMountTarget)
+		if len(mt.DomainName) == 0 {
+			return httperrors.NewInputParameterError("mount target %s has no domain name", mt.Name)
+		}
+		fs, err := mt.GetFileSystem()
+		if err != nil {
+			return errors.Wrap(err, "GetFileSystem")
+		}
+		if !strings.EqualFold(fs.Protocol, "NFS") {
+			return httperrors.NewNotSupportedError("file system %s protocol %s not supported", fs.Name, fs.Protocol)
+		}
+		if len(input.SubPath) == 0 {
+			input.SubPath = "/"
+		}
+		input.SubPath = filepath.Clean("/" + input.SubPath)
+		input.HostPath = ""
+	default:
+		return httperrors.NewInputParameterError("invalid source_type %q", input.SourceType)
+	}
+	return nil
+}
+
+// 挂载virtiofs共享目录
+func (self *SGuest) PerformAttachFilesystem(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input api.ServerAttachFilesystemInput) (jsonutils.JSONObject, error) {
+	if self.Hypervisor != api.HYPERVISOR_KVM {
+		return nil, httperrors.NewNotAcceptableError("Not allow for hypervisor %s", self.Hypervisor)
+	}
+	if self.Status != api.VM_READY {
+		return nil, httperrors.NewInvalidStatusError("Can't attach filesystem when guest is %s", self.Status)
+	}
+	if err := self.validateAttachFilesystemInput(ctx, userCred, &input); err != nil {
+		return nil, err
+	}
+	mount := &SGuestFilesystemMount{
+		GuestId:       self.Id,
+		Tag:           input.Tag,
+		SourceType:    input.SourceType,
+		HostPath:      input.HostPath,
+		MountTargetId: input.MountTargetId,
+		SubPath:       input.SubPath,
+		ReadOnly:      input.ReadOnly,
+	}
+	mount.SetModelManager(GuestFilesystemMountManager, mount)
+	if err := GuestFilesystemMountManager.TableSpec().Insert(ctx, mount); err != nil {
+		return nil, errors.Wrap(err, "Insert")
+	}
+	logclient.AddActionLogWithContext(ctx, self, logclient.ACT_GUEST_ATTACH_FILESYSTEM, input, userCred, true)
+	return nil, self.StartSyncTask(ctx, userCred, false, "")
+}
+
+// 卸载virtiofs共享目录
+func (self *SGuest) PerformDetachFilesystem(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input api.ServerDetachFilesystemInput) (jsonutils.JSONObject, error) {
+	if self.Hypervisor != api.HYPERVISOR_KVM {
+		return nil, httperrors.NewNotAcceptableError("Not allow for hypervisor %s", self.Hypervisor)
+	}
+	if self.Status != api.VM_READY {
+		return nil, httperrors.NewInvalidStatusError("Can't detach filesystem when guest is %s", self.Status)
+	}
+	mount, err := self.getFilesystemMount(input.Tag)
+	if err != nil {
+		return nil, err
+	}
+	if err := mount.Delete(ctx, userCred); err != nil {
+		return nil, errors.Wrap(err, "Delete")
+	}
+	logclient.AddActionLogWithContext(ctx, self, logclient.ACT_GUEST_DETACH_FILESYSTEM, input, userCred, true)
+	return nil, self.StartSyncTask(ctx, userCred, false, "")
+}
@@ -0,0 +1,465 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"fmt"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/netutils"
+	"yunion.io/x/pkg/util/rbacscope"
+	"yunion.io/x/pkg/utils"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/lockman"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/quotas"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
+	"yunion.io/x/onecloud/pkg/compute/options"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/mcclient/auth"
+	"yunion.io/x/onecloud/pkg/mcclient/modules/scheduler"
+)
+
+// 跨区域迁移虚拟机
+func (self *SGuest) PerformRelocate(
+	ctx context.Context, userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject, input *api.ServerRelocateInput,
+) (jsonutils.JSONObject, error) {
+	if self.Hypervisor != api.HYPERVISOR_KVM {
+		return nil, httperrors.NewUnsupportOperationError("relocate is only supported for %s guest", api.HYPERVISOR_KVM)
+	}
+	if !utils.IsInStringArray(self.Status, []string{api.VM_RUNNING, api.VM_READY}) {
+		return nil, httperrors.NewInvalidStatusError("cannot relocate guest in status %s", self.Status)
+	}
+	if len(self.GetMetadata(ctx, api.SERVER_META_RELOCATED_TO, userCred)) > 0 {
+		return nil, httperrors.NewBadRequestError("guest has been relocated")
+	}
+	if len(self.BackupHostId) > 0 {
+		return nil, httperrors.NewBadRequestError("cannot relocate guest with backup host")
+	}
+	devs, err := self.GetIsolatedDevices()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetIsolatedDevices")
+	}
+	if len(devs) > 0 {
+		return nil, httperrors.NewBadRequestError("cannot relocate guest with isolated devices")
+	}
+	if eip, _ := self.GetEipOrPublicIp(); eip != nil {
+		return nil, httperrors.NewBadRequestError("cannot relocate guest with eip %s, dissociate it first", eip.IpAddr)
+	}
+	disks, err := self.GetDisks()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetDisks")
+	}
+	for i := range disks {
+		storage, err := disks[i].GetStorage()
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetStorage of disk %s", disks[i].Name)
+		}
+		if storage.StorageType != api.STORAGE_LOCAL {
+			return nil, httperrors.NewUnsupportOperationError("disk %s on %s storage cannot be relocated", disks[i].Name, storage.StorageType)
+		}
+	}
+
+	if len(input.TargetRegion) == 0 {
+		return nil, httperrors.NewMissingParameterError("target_region")
+	}
+	regionObj, err := CloudregionManager.FetchByIdOrName(ctx, userCred, input.TargetRegion)
+	if err != nil {
+		return nil, httperrors.NewResourceNotFoundError2(CloudregionManager.Keyword(), input.TargetRegion)
+	}
+	region := regionObj.(*SCloudregion)
+	input.TargetRegion = region.Id
+	srcRegion, err := self.getRegion()
+	if err != nil {
+		return nil, errors.Wrap(err, "getRegion")
+	}
+	if srcRegion.Id == region.Id {
+		return nil, httperrors.NewInputParameterError("guest is already in region %s, use migrate instead", region.Name)
+	}
+	if len(input.TargetZone) > 0 {
+		zoneObj, err := ZoneManager.FetchByIdOrName(ctx, userCred, input.TargetZone)
+		if err != nil {
+			return nil, httperrors.NewResourceNotFoundError2(ZoneManager.Keyword(), input.TargetZone)
+		}
+		zone := zoneObj.(*SZone)
+		if zone.CloudregionId != region.Id {
+			return nil, httperrors.NewInputParameterError("zone %s not in region %s", zone.Name, region.Name)
+		}
+		input.TargetZone = zone.Id
+	}
+	if len(input.PreferHost) > 0 {
+		hostObj, err := HostManager.FetchByIdOrName(ctx, userCred, input.PreferHost)
+		if err != nil {
+			return nil, httperrors.NewResourceNotFoundError2(HostManager.Keyword(), input.PreferHost)
+		}
+		host := hostObj.(*SHost)
+		if host.HostType != api.HOST_TYPE_HYPERVISOR {
+			return nil, httperrors.NewBadRequestError("host %s is not kvm host", host.Name)
+		}
+		hostRegion, err := host.GetRegion()
+		if err != nil || hostRegion.Id != region.Id {
+			return nil, httperrors.NewInputParameterError("host %s not in region %s", host.Name, region.Name)
+		}
+		input.PreferHost = host.Id
+	}
+	if input.MaxDowntimeSeconds <= 0 {
+		input.MaxDowntimeSeconds = api.GUEST_RELOCATE_DEFAULT_MAX_DOWNTIME
+	}
+
+	netConfs, err := self.getRelocateNetworks(ctx, userCred, region, input.Networks)
+	if err != nil {
+		return nil, err
+	}
+
+	newGuest, createInput, err := self.createRelocatedServer(ctx, userCred, region, input, netConfs)
+	if err != nil {
+		return nil, errors.Wrap(err, "create relocated server")
+	}
+	return nil, self.StartRelocateTask(ctx, userCred, newGuest, createInput, input, "")
+}
+
+// getRelocateNetworks maps every nic onto its target network, the address is
+// kept when it falls into the target network
+func (self *SGuest) getRelocateNetworks(ctx context.Context, userCred mcclient.TokenCredential, region *SCloudregion, inputs []api.ServerRelocateNetworkInput) ([]*api.NetworkConfig, error) {
+	gns, err := self.GetNetworks("")
+	if err != nil {
+		return nil, errors.Wrap(err, "GetNetworks")
+	}
+	targets := map[int]api.ServerRelocateNetworkInput{}
+	for _, input := range inputs {
+		targets[input.Index] = input
+	}
+	ret := make([]*api.NetworkConfig, 0, len(gns))
+	for i := range gns {
+		target, ok := targets[int(gns[i].Index)]
+		if !ok || len(target.Network) == 0 {
+			return nil, httperrors.NewMissingParameterError(fmt.Sprintf("networks.%d.network", gns[i].Index))
+		}
+		netObj, err := NetworkManager.FetchByIdOrName(ctx, userCred, target.Network)
+		if err != nil {
+			return nil, httperrors.NewResourceNotFoundError2(NetworkManager.Keyword(), target.Network)
+		}
+		network := netObj.(*SNetwork)
+		netRegion, err := network.GetRegion()
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetRegion of network %s", network.Name)
+		}
+		if netRegion.Id != region.Id {
+			return nil, httperrors.NewInputParameterError("network %s not in region %s", network.Name, region.Name)
+		}
+		address := target.Address
+		if len(address) > 0 {
+			addr, err := netutils.NewIPV4Addr(address)
+			if err != nil {
+				return nil, httperrors.NewInputParameterError("invalid address %s", address)
+			}
+			if !network.IsAddressInRange(addr) {
+				return nil, httperrors.NewInputParameterError("address %s not in network %s", address, network.Name)
+			}
+		} else if len(gns[i].IpAddr) > 0 {
+			addr, err := netutils.NewIPV4Addr(gns[i].IpAddr)
+			if err == nil && network.IsAddressInRange(addr) {
+				address = gns[i].IpAddr
+			}
+		}
+		ret = append(ret, &api.NetworkConfig{
+			Index:   int(gns[i].Index),
+			Network: network.Id,
+			Address: address,
+			Driver:  gns[i].Driver,
+			BwLimit: gns[i].BwLimit,
+			Ifname:  gns[i].Ifname,
+		})
+	}
+	return ret, nil
+}
+
+func (self *SGuest) createRelocatedServer(
+	ctx context.Context, userCred mcclient.TokenCredential, region *SCloudregion,
+	input *api.ServerRelocateInput, netConfs []*api.NetworkConfig,
+) (*SGuest, *api.ServerCreateInput, error) {
+	pendingUsage, pendingRegionUsage, err := self.getGuestUsage(1)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "getGuestUsage")
+	}
+	keys, err := self.GetQuotaKeys()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "GetQuotaKeys")
+	}
+	pendingUsage.SetKeys(keys)
+	err = quotas.CheckSetPendingQuota(ctx, userCred, &pendingUsage)
+	if err != nil {
+		return nil, nil, httperrors.NewOutOfQuotaError("Check set pending quota error %s", err)
+	}
+	pendingRegionUsage.SetKeys(fetchRegionalQuotaKeys(rbacscope.ScopeProject, self.GetOwnerId(), region, nil))
+	err = quotas.CheckSetPendingQuota(ctx, userCred, &pendingRegionUsage)
+	if err != nil {
+		quotas.CancelPendingUsage(ctx, userCred, &pendingUsage, &pendingUsage, false)
+		return nil, nil, httperrors.NewOutOfQuotaError("Check set pending regional quota error %s", err)
+	}
+
+	createInput := self.ToCreateInput(ctx, userCred)
+	createInput.GenerateName = fmt.Sprintf("%s-%s", self.Name, region.Name)
+	createInput.Hostname = self.Hostname
+	createInput.PreferRegion = region.Id
+	createInput.PreferZone = input.TargetZone
+	createInput.PreferHost = input.PreferHost
+	createInput.Networks = netConfs
+	createInput.EipBw = 0
+	createInput.PublicIpBw = 0
+	for i := range createInput.Disks {
+		// disks are moved over rather than created from image
+		createInput.Disks[i].ImageId = ""
+		createInput.Disks[i].SnapshotId = ""
+		createInput.Disks[i].Storage = ""
+		createInput.Disks[i].Backend = api.STORAGE_LOCAL
+		createInput.Disks[i].Medium = ""
+	}
+	createInput.SecgroupId = ""
+	createInput.Secgroups = nil
+	secgroups, err := self.GetSecgroups()
+	if err != nil {
+		quotas.CancelPendingUsage(ctx, userCred, &pendingUsage, &pendingUsage, false)
+		quotas.CancelPendingUsage(ctx, userCred, &pendingRegionUsage, &pendingRegionUsage, false)
+		return nil, nil, errors.Wrap(err, "GetSecgroups")
+	}
+	for i := range secgroups {
+		createInput.Secgroups = append(createInput.Secgroups, secgroups[i].Id)
+	}
+
+	schedDesc := self.ToSchedDesc()
+	schedDesc.HostId = ""
+	schedDesc.PreferRegion = region.Id
+	schedDesc.PreferZone = input.TargetZone
+	schedDesc.PreferHost = input.PreferHost
+	for i := range schedDesc.Disks {
+		schedDesc.Disks[i].Backend = api.STORAGE_LOCAL
+		schedDesc.Disks[i].Medium = ""
+		schedDesc.Disks[i].Storage = ""
+	}
+	schedDesc.Networks = netConfs
+
+	s := auth.GetAdminSession(ctx, options.Options.Region)
+	succ, res, err := scheduler.SchedManager.DoScheduleForecast(s, schedDesc, 1)
+	if err != nil {
+		quotas.CancelPendingUsage(ctx, userCred, &pendingUsage, &pendingUsage, false)
+		quotas.CancelPendingUsage(ctx, userCred, &pendingRegionUsage, &pendingRegionUsage, false)
+		return nil, nil, errors.Wrap(err, "Do schedule relocate forecast")
+	}
+	if !succ {
+		quotas.CancelPendingUsage(ctx, userCred, &pendingUsage, &pendingUsage, false)
+		quotas.CancelPendingUsage(ctx, userCred, &pendingRegionUsage, &pendingRegionUsage, false)
+		return nil, nil, httperrors.NewInsufficientResourceError(res.String())
+	}
+
+	lockman.LockClass(ctx, GuestManager, self.ProjectId)
+	defer lockman.ReleaseClass(ctx, GuestManager, self.ProjectId)
+	newGuest, err := db.DoCreate(GuestManager, ctx, userCred, nil,
+		jsonutils.Marshal(createInput), self.GetOwnerId())
+	quotas.CancelPendingUsage(ctx, userCred, &pendingUsage, &pendingUsage, true)
+	quotas.CancelPendingUsage(ctx, userCred, &pendingRegionUsage, &pendingRegionUsage, true)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "db.DoCreate")
+	}
+	target := newGuest.(*SGuest)
+	err = self.copyRelocateMetadata(ctx, userCred, target)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "copyRelocateMetadata")
+	}
+	return target, createInput, nil
+}
+
+// copyRelocateMetadata carries user tags, os info and login info over to the
+// relocated guest, the login key is encrypted with the guest id
+func (self *SGuest) copyRelocateMetadata(ctx context.Context, userCred mcclient.TokenCredential, target *SGuest) error {
+	tags, err := self.GetAllUserMetadata()
+	if err != nil {
+		return errors.Wrap(err, "GetAllUserMetadata")
+	}
+	if len(tags) > 0 {
+		err = target.SetUserMetadataAll(ctx, tags, userCred)
+		if err != nil {
+			return errors.Wrap(err, "SetUserMetadataAll")
+		}
+	}
+	meta, err := self.GetAllMetadata(ctx, userCred)
+	if err != nil {
+		return errors.Wrap(err, "GetAllMetadata")
+	}
+	metadata := map[string]interface{}{
+		api.SERVER_META_RELOCATED_FROM: self.Id,
+	}
+	for k, v := range meta {
+		switch k {
+		case api.VM_METADATA_LOGIN_KEY:
+			passwd, err := utils.DescryptAESBase64(self.Id, v)
+			if err == nil {
+				metadata[k], _ = utils.EncryptAESBase64(target.Id, passwd)
+			}
+		case api.VM_METADATA_LOGIN_ACCOUNT, api.VM_METADATA_OS_ARCH, api.VM_METADATA_OS_DISTRO, api.VM_METADATA_OS_NAME, api.VM_METADATA_OS_VERSION:
+			metadata[k] = v
+		}
+	}
+	return target.SetAllMetadata(ctx, metadata, userCred)
+}
+
+func (self *SGuest) StartRelocateTask(
+	ctx context.Context, userCred mcclient.TokenCredential, target *SGuest,
+	createInput *api.ServerCreateInput, input *api.ServerRelocateInput, parentTaskId string,
+) error {
+	params := jsonutils.NewDict()
+	params.Set("target_guest_id", jsonutils.NewString(target.Id))
+	params.Set("create_input", jsonutils.Marshal(createInput))
+	params.Set("input", jsonutils.Marshal(input))
+	params.Set("guest_status", jsonutils.NewString(self.Status))
+	task, err := taskman.TaskManager.NewTask(ctx, "GuestRelocateTask", self, userCred, params, parentTaskId, "", nil)
+	if err != nil {
+		return errors.Wrap(err, "NewTask")
+	}
+	self.SetStatus(ctx, userCred, api.VM_RELOCATING, "")
+	db.OpsLog.LogEvent(self, db.ACT_VM_RELOCATING, input, userCred)
+	return task.ScheduleRun(nil)
+}
+
+// OnRelocateSwitchover hands the disks of the source guest over to the relocated
+// guest and swaps their names. The updates are not atomic, the source is marked
+// as relocated before anything is moved so that a switchover broken halfway is
+// never mistaken for one that has not started
+func (self *SGuest) OnRelocateSwitchover(
+	ctx context.Context, userCred mcclient.TokenCredential, target *SGuest,
+	storageIds map[string]string, diskPaths map[string]string,
+) error {
+	region, err := target.getRegion()
+	if err != nil {
+		return errors.Wrap(err, "getRegion")
+	}
+	err = self.SetMetadata(ctx, api.SERVER_META_RELOCATED_TO, target.Id, userCred)
+	if err != nil {
+		return errors.Wrap(err, "SetMetadata")
+	}
+	guestdisks, err := self.GetGuestDisks()
+	if err != nil {
+		return errors.Wrap(err, "GetGuestDisks")
+	}
+	for i := range guestdisks {
+		disk := guestdisks[i].GetDisk()
+		if disk == nil {
+			return errors.Wrapf(errors.ErrNotFound, "disk %s", guestdisks[i].DiskId)
+		}
+		storageId, ok := storageIds[disk.Id]
+		if !ok {
+			return errors.Wrapf(errors.ErrNotFound, "target storage of disk %s", disk.Id)
+		}
+		_, err = db.Update(disk, func() error {
+			disk.StorageId = storageId
+			if path, ok := diskPaths[disk.Id]; ok && len(path) > 0 {
+				disk.AccessPath = path
+			}
+			return nil
+		})
+		if err != nil {
+			return errors.Wrapf(err, "update disk %s", disk.Id)
+		}
+		snapshots := SnapshotManager.GetDiskSnapshots(disk.Id)
+		for j := range snapshots {
+			_, err = db.Update(&snapshots[j], func() error {
+				snapshots[j].StorageId = storageId
+				snapshots[j].CloudregionId = region.Id
+				return nil
+			})
+			if err != nil {
+				return errors.Wrapf(err, "update snapshot %s", snapshots[j].Id)
+			}
+		}
+		_, err = db.Update(&guestdisks[i], func() error {
+			guestdisks[i].GuestId = target.Id
+			return nil
+		})
+		if err != nil {
+			return errors.Wrapf(err, "move guestdisk %s", disk.Id)
+		}
+	}
+
+	name := self.Name
+	_, err = db.Update(self, func() error {
+		self.Name = fmt.Sprintf("%s-relocated-%s", name, region.Name)
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "rename source guest")
+	}
+	_, err = db.Update(target, func() error {
+		target.Name = name
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "rename relocated guest")
+	}
+	return nil
+}
+
+// SGuestRelocateRecovery tells what a failed relocation rolls back
+type SGuestRelocateRecovery struct {
+	// the relocated guest and the files fetched onto the target storages are removed
+	DeleteTarget bool
+	// the pre-copy snapshots are removed from the source disks
+	DeleteSnapshots bool
+	// the source guest stopped for the final sync is started again
+	RestartSource bool
+}
+
+// GetGuestRelocateRecovery rolls back everything until the switchover started,
+// from then on the relocated guest may own some of the disks and both guests
+// are left for manual recovery
+func GetGuestRelocateRecovery(switched, stopped, sourceRunning bool) SGuestRelocateRecovery {
+	if switched {
+		return SGuestRelocateRecovery{}
+	}
+	return SGuestRelocateRecovery{
+		DeleteTarget:    true,
+		DeleteSnapshots: true,
+		RestartSource:   stopped && sourceRunning,
+	}
+}
+
+// CleanupRelocateTargetDisks removes the disk files and snapshot chains fetched
+// onto the target storages by a relocation that did not switch over
+func (self *SGuest) CleanupRelocateTargetDisks(ctx context.Context, userCred mcclient.TokenCredential, host *SHost, storageIds map[string]string) error {
+	disks, err := self.GetDisks()
+	if err != nil {
+		return errors.Wrap(err, "GetDisks")
+	}
+	header := mcclient.GetTokenHeaders(userCred)
+	errs := []error{}
+	for i := range disks {
+		storageId := storageIds[disks[i].Id]
+		if len(storageId) == 0 || storageId == disks[i].StorageId {
+			continue
+		}
+		body := jsonutils.NewDict()
+		body.Set("clean_snapshots", jsonutils.JSONTrue)
+		url := fmt.Sprintf("/disks/%s/delete/%s", storageId, disks[i].Id)
+		_, err := host.Request(ctx, userCred, "POST", url, header, body)
+		if err != nil && errors.Cause(err) != errors.ErrNotFound {
+			errs = append(errs, errors.Wrapf(err, "cleanup disk %s", disks[i].Name))
+		}
+	}
+	return errors.NewAggregate(errs)
+}
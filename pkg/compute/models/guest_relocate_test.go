@@ -0,0 +1,41 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import "testing"
+
+func TestGetGuestRelocateRecovery(t *testing.T) {
+	cases := []struct {
+		name          string
+		switched      bool
+		stopped       bool
+		sourceRunning bool
+		want          SGuestRelocateRecovery
+	}{
+		{"precopy", false, false, true, SGuestRelocateRecovery{DeleteTarget: true, DeleteSnapshots: true}},
+		{"final sync", false, true, true, SGuestRelocateRecovery{DeleteTarget: true, DeleteSnapshots: true, RestartSource: true}},
+		{"final sync of stopped guest", false, true, false, SGuestRelocateRecovery{DeleteTarget: true, DeleteSnapshots: true}},
+		{"switched", true, true, true, SGuestRelocateRecovery{}},
+		{"switched stopped guest", true, true, false, SGuestRelocateRecovery{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := GetGuestRelocateRecovery(c.switched, c.stopped, c.sourceRunning)
+			if got != c.want {
+				t.Errorf("want %+v, got %+v", c.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/httputils"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	hostapi "yunion.io/x/onecloud/pkg/apis/host"
+	"yunion.io/x/onecloud/pkg/cloudcommon/consts"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/mcclient/auth"
+	identity_modules "yunion.io/x/onecloud/pkg/mcclient/modules/identity"
+)
+
+// The vTPM state of a kvm guest lives in the guest home dir on its host. Live
+// migration carries it within the qemu migration stream, cold migration and
+// instance snapshots pass it through the region, where it is kept in the
+// metadata of the instance snapshot encrypted by a key of the identity service,
+// instance backups save it to the backup storage alongside the disk backups.
+
+func (self *SGuest) requestVtpm(ctx context.Context, userCred mcclient.TokenCredential, action string, body jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	host, err := self.GetHost()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetHost")
+	}
+	url := fmt.Sprintf("/servers/%s/%s", self.Id, action)
+	return host.Request(ctx, userCred, "POST", url, mcclient.GetTokenHeaders(userCred), body)
+}
+
+// ExportVtpmState returns the TPM state of the guest packed by its host
+func (self *SGuest) ExportVtpmState(ctx context.Context, userCred mcclient.TokenCredential) (string, error) {
+	ret, err := self.requestVtpm(ctx, userCred, "vtpm-export", nil)
+	if err != nil {
+		return "", errors.Wrap(err, "request vtpm-export")
+	}
+	state := hostapi.GuestVtpmState{}
+	err = ret.Unmarshal(&state)
+	if err != nil {
+		return "", errors.Wrap(err, "Unmarshal")
+	}
+	return state.State, nil
+}
+
+// ImportVtpmState replaces the TPM state of the stopped guest
+func (self *SGuest) ImportVtpmState(ctx context.Context, userCred mcclient.TokenCredential, state string) error {
+	_, err := self.requestVtpm(ctx, userCred, "vtpm-import", jsonutils.Marshal(&hostapi.GuestVtpmState{State: state}))
+	return errors.Wrap(err, "request vtpm-import")
+}
+
+// getVtpmEncryptKeyId returns the key encrypting the vTPM state of the
+// instance snapshot, the encrypt key of the encrypted instance snapshot, or
+// the key created for the vTPM state of an unencrypted one
+func (isp *SInstanceSnapshot) getVtpmEncryptKeyId(ctx context.Context, userCred mcclient.TokenCredential) (string, error) {
+	if isp.IsEncrypted() {
+		return isp.EncryptKeyId, nil
+	}
+	keyId := isp.GetMetadata(ctx, api.INSTANCE_SNAPSHOT_METADATA_VTPM_KEY_ID, nil)
+	if len(keyId) > 0 {
+		return keyId, nil
+	}
+	session := auth.GetAdminSession(ctx, consts.GetRegion())
+	key, err := identity_modules.Credentials.CreateEncryptKey(session, "", "key-vtpm-"+isp.Id, "")
+	if err != nil {
+		return "", errors.Wrap(err, "Credentials.CreateEncryptKey")
+	}
+	err = isp.SetMetadata(ctx, api.INSTANCE_SNAPSHOT_METADATA_VTPM_KEY_ID, key.KeyId, userCred)
+	if err != nil {
+		return "", errors.Wrap(err, "SetMetadata")
+	}
+	return key.KeyId, nil
+}
+
+// SaveVtpmState keeps the TPM state of the guest in the metadata of the
+// instance snapshot, encrypted by a key of the identity service
+func (isp *SInstanceSnapshot) SaveVtpmState(ctx context.Context, userCred mcclient.TokenCredential, guest *SGuest) error {
+	state, err := guest.ExportVtpmState(ctx, userCred)
+	if err != nil {
+		return err
+	}
+	keyId, err := isp.getVtpmEncryptKeyId(ctx, userCred)
+	if err != nil {
+		return errors.Wrap(err, "getVtpmEncryptKeyId")
+	}
+	session := auth.GetAdminSession(ctx, consts.GetRegion())
+	sec, err := identity_modules.Credentials.EncryptKeyEncryptBase64(session, keyId, []byte(state))
+	if err != nil {
+		return errors.Wrap(err, "EncryptKeyEncryptBase64")
+	}
+	return isp.SetMetadata(ctx, api.INSTANCE_SNAPSHOT_METADATA_VTPM_STATE, sec, userCred)
+}
+
+// ResetVtpmState restores the TPM state saved by the instance snapshot, the
+// snapshots taken without vTPM leave the TPM state untouched
+func (isp *SInstanceSnapshot) ResetVtpmState(ctx context.Context, userCred mcclient.TokenCredential, guest *SGuest) error {
+	sec := isp.GetMetadata(ctx, api.INSTANCE_SNAPSHOT_METADATA_VTPM_STATE, nil)
+	if len(sec) == 0 {
+		return nil
+	}
+	keyId, err := isp.getVtpmEncryptKeyId(ctx, userCred)
+	if err != nil {
+		return errors.Wrap(err, "getVtpmEncryptKeyId")
+	}
+	session := auth.GetAdminSession(ctx, consts.GetRegion())
+	state, err := identity_modules.Credentials.EncryptKeyDecryptBase64(session, keyId, sec)
+	if err != nil {
+		return errors.Wrap(err, "EncryptKeyDecryptBase64")
+	}
+	return guest.ImportVtpmState(ctx, userCred, string(state))
+}
+
+// deleteVtpmEncryptKey deletes the key created for the vTPM state along with
+// the instance snapshot
+func (isp *SInstanceSnapshot) deleteVtpmEncryptKey(ctx context.Context) error {
+	keyId := isp.GetMetadata(ctx, api.INSTANCE_SNAPSHOT_METADATA_VTPM_KEY_ID, nil)
+	if len(keyId) == 0 {
+		return nil
+	}
+	session := auth.GetAdminSession(ctx, consts.GetRegion())
+	_, err := identity_modules.Credentials.Delete(session, keyId, nil)
+	if err != nil && httputils.ErrorCode(err) != http.StatusNotFound {
+		return errors.Wrapf(err, "delete encrypt key %s", keyId)
+	}
+	return nil
+}
+
+func (ib *SInstanceBackup) GetVtpmBackupId(ctx context.Context) string {
+	return ib.GetMetadata(ctx, api.INSTANCE_BACKUP_METADATA_VTPM_BACKUP_ID, nil)
+}
+
+func (ib *SInstanceBackup) getVtpmBackupInput(backupId string) (*hostapi.GuestVtpmBackupRequest, error) {
+	bs, err := ib.GetBackupStorage()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetBackupStorage")
+	}
+	accessInfo, err := bs.GetAccessInfo()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetAccessInfo")
+	}
+	return &hostapi.GuestVtpmBackupRequest{
+		BackupId:                backupId,
+		BackupStorageId:         bs.Id,
+		BackupStorageAccessInfo: jsonutils.Marshal(accessInfo).(*jsonutils.JSONDict),
+	}, nil
+}
+
+// SaveVtpmState saves the TPM state of the guest to the backup storage
+func (ib *SInstanceBackup) SaveVtpmState(ctx context.Context, userCred mcclient.TokenCredential, guest *SGuest) error {
+	input, err := ib.getVtpmBackupInput(fmt.Sprintf("%s.vtpm", ib.Id))
+	if err != nil {
+		return err
+	}
+	_, err = guest.requestVtpm(ctx, userCred, "vtpm-backup", jsonutils.Marshal(input))
+	if err != nil {
+		return errors.Wrap(err, "request vtpm-backup")
+	}
+	return ib.SetMetadata(ctx, api.INSTANCE_BACKUP_METADATA_VTPM_BACKUP_ID, input.BackupId, userCred)
+}
+
+// RestoreVtpmState restores the TPM state to the stopped guest recovered from
+// the instance backup
+func (ib *SInstanceBackup) RestoreVtpmState(ctx context.Context, userCred mcclient.TokenCredential, guest *SGuest) error {
+	backupId := ib.GetVtpmBackupId(ctx)
+	if len(backupId) == 0 || !guest.Vtpm {
+		return nil
+	}
+	input, err := ib.getVtpmBackupInput(backupId)
+	if err != nil {
+		return err
+	}
+	_, err = guest.requestVtpm(ctx, userCred, "vtpm-restore", jsonutils.Marshal(input))
+	return errors.Wrap(err, "request vtpm-restore")
+}
@@ -70,6 +70,9 @@ type SGuestdisk struct {
 	AioMode   string `width:"32" charset:"ascii" nullable:"true" get:"user" update:"user"`  // Column(VARCHAR(32, charset='ascii'), nullable=True)
 	Iops      int    `nullable:"true" default:"0"`
 	Bps       int    `nullable:"true" default:"0"` // Mb
+	// minimum iops and bps kept by host io qos controller
+	IopsMin int `nullable:"true" default:"0"`
+	BpsMin  int `nullable:"true" default:"0"`
 
 	Mountpoint string `width:"256" charset:"utf8" nullable:"true" get:"user"` // Column(VARCHAR(256, charset='utf8'), nullable=True)
 
@@ -205,6 +208,8 @@ func (self *SGuestdisk) GetDiskJsonDescAtHost(ctx context.Context, host *SHost,
 		Iops:       self.Iops,
 		Throughput: disk.Throughput,
 		Bps:        self.Bps,
+		IopsMin:    self.IopsMin,
+		BpsMin:     self.BpsMin,
 		Size:       disk.DiskSize,
 	}
 	desc.TemplateId = disk.GetTemplateId()
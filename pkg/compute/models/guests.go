@@ -155,6 +155,12 @@ type SGuest struct {
 	Vdi     string `width:"36" charset:"ascii" nullable:"true" list:"user" update:"user" create:"optional"`
 	Machine string `width:"36" charset:"ascii" nullable:"true" list:"user" update:"user" create:"optional"`
 	Bios    string `width:"36" charset:"ascii" nullable:"true" list:"user" update:"user" create:"optional"`
+	// 是否启用vTPM
+	Vtpm bool `nullable:"false" default:"false" list:"user" update:"user" create:"optional"`
+	// 是否启用内存气球
+	MemBalloon bool `nullable:"false" default:"false" list:"user" update:"user" create:"optional"`
+	// 内存气球回收时保留的最小内存, 单位MB
+	MemBalloonFloor int `nullable:"false" default:"0" list:"user" update:"user" create:"optional"`
 	// 操作系统类型
 	OsType string `width:"36" charset:"ascii" nullable:"true" list:"user" create:"optional"`
 
@@ -176,6 +182,9 @@ type SGuest struct {
 	// 套餐名称
 	InstanceType string `width:"64" charset:"utf8" nullable:"true" list:"user" create:"optional"`
 
+	// 调度优先级类Id
+	PriorityClassId string `width:"36" charset:"ascii" nullable:"true" list:"user" create:"optional"`
+
 	SshableLastState tristate.TriState `default:"false" list:"user"`
 
 	IsDaemon tristate.TriState `default:"false" list:"admin" create:"admin_optional" update:"admin"`
@@ -1420,6 +1429,27 @@ func (self *SGuest) ValidateUpdateData(ctx context.Context, userCred mcclient.To
 		}
 	}
 
+	if input.Vtpm != nil && *input.Vtpm != self.Vtpm {
+		if self.Hypervisor != api.HYPERVISOR_KVM {
+			return input, httperrors.NewNotSupportedError("vtpm is not supported by %s", self.Hypervisor)
+		}
+		if self.Status != api.VM_READY {
+			return input, httperrors.NewInvalidStatusError("cannot change vtpm in status %s", self.Status)
+		}
+	}
+
+	if input.MemBalloon != nil && *input.MemBalloon != self.MemBalloon {
+		if self.Hypervisor != api.HYPERVISOR_KVM {
+			return input, httperrors.NewNotSupportedError("mem balloon is not supported by %s", self.Hypervisor)
+		}
+		if self.Status != api.VM_READY {
+			return input, httperrors.NewInvalidStatusError("cannot change mem balloon in status %s", self.Status)
+		}
+	}
+	if input.MemBalloonFloor != nil && (*input.MemBalloonFloor < 0 || *input.MemBalloonFloor > self.VmemSize) {
+		return input, httperrors.NewOutOfRangeError("mem_balloon_floor should be between 0 and %d", self.VmemSize)
+	}
+
 	drv, err := self.GetDriver()
 	if err != nil {
 		return input, err
@@ -1651,6 +1681,32 @@ func (manager *SGuestManager) validateCreateData(
 		input.InstanceGroupIds = newGroupIds
 	}
 
+	if len(input.SchedAlgorithm) > 0 && !utils.IsInStringArray(input.SchedAlgorithm, api.SCHED_ALGORITHM_LIST) {
+		return nil, httperrors.NewInputParameterError("invalid sched_algorithm %s", input.SchedAlgorithm)
+	}
+
+	if len(input.PriorityClassId) > 0 {
+		pcObj, err := SchedPriorityClassManager.FetchByIdOrName(ctx, userCred, input.PriorityClassId)
+		if err != nil {
+			if errors.Cause(err) == sql.ErrNoRows {
+				return nil, httperrors.NewResourceNotFoundError2(SchedPriorityClassManager.Keyword(), input.PriorityClassId)
+			}
+			return nil, httperrors.NewGeneralError(err)
+		}
+		if !pcObj.(*SSchedPriorityClass).IsUsableBy(userCred, ownerId.GetProjectId()) {
+			return nil, httperrors.NewForbiddenError("priority class %s is not allowed for project %s", pcObj.GetName(), ownerId.GetProjectId())
+		}
+		input.PriorityClassId = pcObj.GetId()
+	} else {
+		pc, err := SchedPriorityClassManager.FetchProjectDefault(ownerId.GetProjectId())
+		if err != nil {
+			return nil, errors.Wrap(err, "FetchProjectDefault")
+		}
+		if pc != nil {
+			input.PriorityClassId = pc.Id
+		}
+	}
+
 	// check that all image of disk is the part of guest imgae, if use guest image to create guest
 	err = manager.checkGuestImage(ctx, input)
 	if err != nil {
@@ -1827,6 +1883,15 @@ func (manager *SGuestManager) validateCreateData(
 			input.IsDaemon = &setDaemon
 		}
 	}
+	if input.Vtpm && input.Hypervisor != api.HYPERVISOR_KVM {
+		return nil, httperrors.NewNotSupportedError("vtpm is not supported by %s", input.Hypervisor)
+	}
+	if input.MemBalloon && input.Hypervisor != api.HYPERVISOR_KVM {
+		return nil, httperrors.NewNotSupportedError("mem balloon is not supported by %s", input.Hypervisor)
+	}
+	if input.MemBalloonFloor < 0 {
+		return nil, httperrors.NewOutOfRangeError("mem_balloon_floor should not be negative")
+	}
 
 	hypervisor = input.Hypervisor
 	driver, err := GetDriver(hypervisor, input.Provider)
@@ -1861,6 +1926,9 @@ func (manager *SGuestManager) validateCreateData(
 			input.VmemSize = vmemSize
 			input.VcpuCount = vcpuCount
 		}
+		if input.MemBalloonFloor > input.VmemSize {
+			return nil, httperrors.NewOutOfRangeError("mem_balloon_floor should be between 0 and %d", input.VmemSize)
+		}
 
 		dataDiskDefs := []*api.DiskConfig{}
 		if sku != nil && sku.AttachedDiskCount > 0 {
@@ -2346,6 +2414,13 @@ func (self *SGuest) PostUpdate(ctx context.Context, userCred mcclient.TokenCrede
 			log.Errorf("unable to set sshport for guest %s", self.GetId())
 		}
 	}
+	if data.Contains("mem_balloon_floor") && self.MemBalloon && self.Status == api.VM_RUNNING {
+		// let the host balloon controller pick up the new floor
+		err := self.StartSyncTask(ctx, userCred, false, "")
+		if err != nil {
+			log.Errorf("StartSyncTask fail: %s", err)
+		}
+	}
 }
 
 func (manager *SGuestManager) checkCreateQuota(
@@ -2470,6 +2545,12 @@ func getGuestResourceRequirements(
 	return req, regionReq
 }
 
+// GetGuestCreateResourceRequirements returns the pending usage held by a
+// single guest created from the input
+func GetGuestCreateResourceRequirements(ctx context.Context, userCred mcclient.TokenCredential, input api.ServerCreateInput, ownerId mcclient.IIdentityProvider) (SQuota, SRegionQuota) {
+	return getGuestResourceRequirements(ctx, userCred, input, ownerId, 1, input.Backup)
+}
+
 func (guest *SGuest) getGuestBackupResourceRequirements(ctx context.Context, userCred mcclient.TokenCredential) SQuota {
 	guestDisksSize := guest.getDiskSize()
 	return SQuota{
@@ -3007,6 +3088,10 @@ func (self *SGuest) getSecurityGroupsRules() string {
 	}
 	rules := []string{}
 	for _, rule := range secrules {
+		if len(rule.PeerSecgroupId) > 0 {
+			// realised by vpcagent for ovn vpc only
+			continue
+		}
 		rules = append(rules, rule.String())
 	}
 	return strings.Join(rules, SECURITY_GROUP_SEPARATOR)
@@ -5162,6 +5247,7 @@ func (self *SGuest) GetJsonDescAtHypervisor(ctx context.Context, host *SHost) *a
 		Vdi:          self.GetVdi(),
 		Machine:      self.getMachine(),
 		Bios:         self.getBios(),
+		Vtpm:         self.Vtpm,
 		BootOrder:    self.BootOrder,
 		SrcIpCheck:   self.SrcIpCheck.Bool(),
 		SrcMacCheck:  self.SrcMacCheck.Bool(),
@@ -5176,6 +5262,8 @@ func (self *SGuest) GetJsonDescAtHypervisor(ctx context.Context, host *SHost) *a
 		LightMode:  self.RescueMode,
 		Hypervisor: self.GetHypervisor(),
 	}
+	desc.MemBalloon = self.MemBalloon
+	desc.MemBalloonFloor = self.MemBalloonFloor
 
 	if len(self.BackupHostId) > 0 {
 		if self.HostId == host.Id {
@@ -5255,6 +5343,8 @@ func (self *SGuest) GetJsonDescAtHypervisor(ctx context.Context, host *SHost) *a
 		desc.Floppys = append(desc.Floppys, floppyDesc)
 	}
 
+	desc.Filesystems = self.getFilesystemJsonDescs()
+
 	// tenant
 	tc, _ := self.GetTenantCache(ctx)
 	if tc != nil {
@@ -6231,6 +6321,7 @@ func (self *SGuest) ToSchedDesc() *schedapi.ScheduleInput {
 	}
 	config.Project = self.ProjectId
 	config.Domain = self.DomainId
+	config.PriorityClassId = self.PriorityClassId
 	/*tags := self.GetApptags()
 	for i := 0; i < len(tags); i++ {
 		desc.Set(tags[i], jsonutils.JSONTrue)
@@ -6375,6 +6466,9 @@ func (self *SGuest) ToCreateInput(ctx context.Context, userCred mcclient.TokenCr
 	}
 	userInput.Networks = nets
 	userInput.IsolatedDevices = genInput.IsolatedDevices
+	userInput.Vtpm = genInput.Vtpm
+	userInput.MemBalloon = genInput.MemBalloon
+	userInput.MemBalloonFloor = genInput.MemBalloonFloor
 	userInput.Count = 1
 	// override some old userInput properties via genInput because of change config behavior
 	userInput.VmemSize = genInput.VmemSize
@@ -6435,6 +6529,9 @@ func (self *SGuest) toCreateInput() *api.ServerCreateInput {
 	r.Vga = self.Vga
 	r.Vdi = self.Vdi
 	r.Bios = self.Bios
+	r.Vtpm = self.Vtpm
+	r.MemBalloon = self.MemBalloon
+	r.MemBalloonFloor = self.MemBalloonFloor
 	r.Description = self.Description
 	r.BootOrder = self.BootOrder
 	r.DisableDelete = new(bool)
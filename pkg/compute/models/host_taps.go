@@ -48,7 +48,7 @@ func (h *SHost) GetDetailsTapConfig(ctx context.Context, userCred mcclient.Token
 	for _, flow := range flows {
 		mirror, err := flow.getMirrorConfig(true)
 		if err != nil {
-			if errors.Cause(err) == errors.ErrNotFound {
+			if errors.Cause(err) == errors.ErrNotFound || errors.Cause(err) == errors.ErrNotSupported {
 				continue
 			} else {
 				return conf, errors.Wrap(err, "flow.getMirrorConfig")
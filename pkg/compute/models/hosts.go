@@ -151,6 +151,8 @@ type SHost struct {
 	MemReserved int `nullable:"true" default:"0" list:"domain" update:"domain" create:"domain_optional"`
 	// 内存超分比
 	MemCmtbound float32 `nullable:"true" default:"1" list:"domain" update:"domain" create:"domain_optional"`
+	// 内存气球从虚拟机回收的内存大小,单位Mb
+	MemBalloonReclaimed int `nullable:"false" default:"0" list:"domain"`
 	// 页大小
 	PageSizeKB         int  `nullable:"false" default:"4" list:"domain" update:"domain" create:"domain_optional"`
 	EnableNumaAllocate bool `nullable:"true" default:"false" list:"domain" update:"domain" create:"domain_optional"`
@@ -4667,6 +4669,15 @@ func (hh *SHost) PerformPing(ctx context.Context, userCred mcclient.TokenCredent
 		}
 		hh.SetMetadata(ctx, "root_partition_used_capacity_mb", input.RootPartitionUsedCapacityMb, userCred)
 		hh.SetMetadata(ctx, "memory_used_mb", input.MemoryUsedMb, userCred)
+		if hh.MemBalloonReclaimed != input.MemBalloonReclaimedMb {
+			_, err := db.Update(hh, func() error {
+				hh.MemBalloonReclaimed = input.MemBalloonReclaimedMb
+				return nil
+			})
+			if err != nil {
+				log.Errorf("update host mem balloon reclaimed error %s", err)
+			}
+		}
 
 		guests, _ := hh.GetGuests()
 		for _, guest := range guests {
@@ -4700,6 +4711,9 @@ func (hh *SHost) PerformPing(ctx context.Context, userCred mcclient.TokenCredent
 		return nil, fmt.Errorf("Get catalog error")
 	}
 	result.Set("catalog", catalog)
+	if budgets := hh.GetMetadataJson(ctx, api.HOSTMETA_IO_QOS_BUDGETS, nil); budgets != nil {
+		result.Set(api.HOSTMETA_IO_QOS_BUDGETS, budgets)
+	}
 
 	appParams := appsrv.AppContextGetParams(ctx)
 	if appParams != nil {
@@ -4821,6 +4835,46 @@ func (hh *SHost) PerformReserveCpus(
 	return nil, err
 }
 
+// 设置宿主机上各项目的I/O预算
+func (hh *SHost) PerformSetIoQos(
+	ctx context.Context, userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject, input api.HostSetIoQosInput,
+) (jsonutils.JSONObject, error) {
+	if hh.HostType != api.HOST_TYPE_HYPERVISOR {
+		return nil, httperrors.NewNotSupportedError("host type %s not support io qos", hh.HostType)
+	}
+	if len(input.Budgets) == 0 {
+		return nil, hh.RemoveMetadata(ctx, api.HOSTMETA_IO_QOS_BUDGETS, userCred)
+	}
+	projects := map[string]bool{}
+	for i := range input.Budgets {
+		budget := &input.Budgets[i]
+		if len(budget.Project) == 0 {
+			budget.Project = budget.ProjectId
+		}
+		if len(budget.Project) == 0 {
+			return nil, httperrors.NewMissingParameterError("project")
+		}
+		if budget.Iops < 0 || budget.Bps < 0 {
+			return nil, httperrors.NewInputParameterError("project %s budget must >= 0", budget.Project)
+		}
+		tenant, err := db.TenantCacheManager.FetchTenantByIdOrNameInDomain(ctx, budget.Project, userCred.GetProjectDomainId())
+		if err != nil {
+			if errors.Cause(err) == sql.ErrNoRows {
+				return nil, httperrors.NewResourceNotFoundError2("project", budget.Project)
+			}
+			return nil, errors.Wrapf(err, "fetch project %s", budget.Project)
+		}
+		if projects[tenant.Id] {
+			return nil, httperrors.NewDuplicateResourceError("project %s budget", tenant.Name)
+		}
+		projects[tenant.Id] = true
+		budget.Project = tenant.Name
+		budget.ProjectId = tenant.Id
+	}
+	return nil, hh.SetMetadata(ctx, api.HOSTMETA_IO_QOS_BUDGETS, input.Budgets, userCred)
+}
+
 func (hh *SHost) HasBMC() bool {
 	ipmiInfo, _ := hh.GetIpmiInfo()
 	if ipmiInfo.Username != "" && ipmiInfo.Password != "" {
@@ -415,6 +415,13 @@ func (self *SInstanceBackup) ToInstanceCreateInput(sourceInput *api.ServerCreate
 	if sourceInput.Bios == "" {
 		sourceInput.Bios = createInput.Bios
 	}
+	if !sourceInput.Vtpm {
+		sourceInput.Vtpm = createInput.Vtpm
+	}
+	if !sourceInput.MemBalloon {
+		sourceInput.MemBalloon = createInput.MemBalloon
+		sourceInput.MemBalloonFloor = createInput.MemBalloonFloor
+	}
 	if sourceInput.BootOrder == "" {
 		sourceInput.BootOrder = createInput.BootOrder
 	}
@@ -512,6 +519,16 @@ func (self *SInstanceBackup) PerformPack(ctx context.Context, userCred mcclient.
 	if input.PackageName == "" {
 		return nil, httperrors.NewMissingParameterError("miss package_name")
 	}
+	dbs, err := self.GetBackups()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetBackups")
+	}
+	for i := range dbs {
+		// only the changed clusters are saved by a chained backup
+		if len(dbs[i].ParentBackupId) > 0 {
+			return nil, httperrors.NewUnsupportOperationError("disk backup %s depends on other backups, consolidate it first", dbs[i].Name)
+		}
+	}
 	self.SetStatus(ctx, userCred, api.INSTANCE_BACKUP_STATUS_PACK, "")
 	params := jsonutils.NewDict()
 	params.Set("package_name", jsonutils.NewString(input.PackageName))
@@ -574,6 +591,11 @@ func (self *SInstanceBackup) PackMetadata(ctx context.Context, userCred mcclient
 		EncryptKeyId: self.EncryptKeyId,
 		Metadata:     allMetadata,
 	}
+	// the vtpm backup is packed as a file, its id is meaningless elsewhere
+	if _, ok := metadata.Metadata[api.INSTANCE_BACKUP_METADATA_VTPM_BACKUP_ID]; ok {
+		delete(metadata.Metadata, api.INSTANCE_BACKUP_METADATA_VTPM_BACKUP_ID)
+		metadata.HasVtpm = true
+	}
 	dbs, err := self.GetBackups()
 	if err != nil {
 		return nil, err
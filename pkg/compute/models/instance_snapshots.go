@@ -607,6 +607,10 @@ func (self *SInstanceSnapshot) StartInstanceSnapshotDeleteTask(
 }
 
 func (self *SInstanceSnapshot) RealDelete(ctx context.Context, userCred mcclient.TokenCredential) error {
+	err := self.deleteVtpmEncryptKey(ctx)
+	if err != nil {
+		return errors.Wrap(err, "deleteVtpmEncryptKey")
+	}
 	return db.DeleteModel(ctx, userCred, self)
 }
 
@@ -17,18 +17,21 @@ package models
 import (
 	"context"
 	"database/sql"
+	"net"
 	"strings"
 
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/log"
 	"yunion.io/x/pkg/errors"
 	"yunion.io/x/pkg/tristate"
+	"yunion.io/x/pkg/util/regutils"
 	"yunion.io/x/pkg/utils"
 	"yunion.io/x/sqlchemy"
 
 	api "yunion.io/x/onecloud/pkg/apis/compute"
 	"yunion.io/x/onecloud/pkg/cloudcommon/db"
 	"yunion.io/x/onecloud/pkg/cloudcommon/db/lockman"
+	"yunion.io/x/onecloud/pkg/compute/options"
 	"yunion.io/x/onecloud/pkg/httperrors"
 	"yunion.io/x/onecloud/pkg/mcclient"
 	"yunion.io/x/onecloud/pkg/util/stringutils2"
@@ -70,6 +73,14 @@ type SNetTapFlow struct {
 	Direction string `width:"6" charset:"ascii" list:"admin" create:"admin_required" default:"BOTH"`
 
 	FlowId uint16 `nullable:"false" list:"admin"`
+
+	// 按协议过滤镜像流量
+	Protocol string `width:"8" charset:"ascii" list:"admin" create:"admin_optional" default:"any"`
+	// 按CIDR过滤镜像流量，匹配源地址或目的地址
+	Cidr string `width:"43" charset:"ascii" nullable:"true" list:"admin" create:"admin_optional"`
+
+	// 是否由vpcagent以OVN Mirror镜像，否则由宿主机在br-vpc上镜像
+	OvnMirror bool `nullable:"false" default:"false" list:"admin" create:"admin_optional"`
 }
 
 func (man *SNetTapFlowManager) ListItemFilter(
@@ -255,8 +266,12 @@ func (manager *SNetTapFlowManager) ValidateCreateData(
 	}
 	tap := tapObj.(*SNetTapService)
 	input.TapId = tap.Id
+	isOvnMirror := false
 	switch input.Type {
 	case api.TapFlowVSwitch:
+		if tap.Type == api.TapServiceRemote {
+			return input, errors.Wrap(httperrors.ErrNotSupported, "remote tap service only accepts guest nics in vpc networks mirrored with ovn mirrors")
+		}
 		hostObj, err := HostManager.FetchByIdOrName(ctx, userCred, input.HostId)
 		if err != nil {
 			if errors.Cause(err) == sql.ErrNoRows {
@@ -338,6 +353,42 @@ func (manager *SNetTapFlowManager) ValidateCreateData(
 		input.MacAddr = gn.MacAddr
 		input.NetId = gn.NetworkId
 		input.VlanId = nil
+		net, err := gn.GetNetwork()
+		if err != nil {
+			return input, errors.Wrap(err, "GetNetwork")
+		}
+		if !net.IsClassic() && tap.Type != api.TapServiceHost && options.Options.EnableOvnTapMirror {
+			// vpc ports are mirrored by vpcagent with ovn mirrors, the others
+			// are mirrored by host agents on br-vpc
+			vpc, err := net.GetVpc()
+			if err != nil {
+				return input, errors.Wrap(err, "GetVpc")
+			}
+			if len(vpc.ManagerId) > 0 {
+				return input, errors.Wrapf(httperrors.ErrNotSupported, "vpc %s of guest nic is not an onpremise ovn vpc", vpc.Name)
+			}
+			if tap.Type == api.TapServiceGuest {
+				// ovn delivers mirrored packets to the nic of tap guest in the same network
+				tapGns, err := GuestnetworkManager.FetchByGuestId(tap.TargetId)
+				if err != nil {
+					return input, errors.Wrap(err, "GuestnetworkManager.FetchByGuestId")
+				}
+				found := false
+				for i := range tapGns {
+					if tapGns[i].NetworkId == gn.NetworkId {
+						found = true
+						break
+					}
+				}
+				if !found {
+					return input, errors.Wrapf(httperrors.ErrInvalidStatus, "guest of tap service has no nic in network %s", net.Name)
+				}
+			}
+			isOvnMirror = true
+		}
+		if tap.Type == api.TapServiceRemote && !isOvnMirror {
+			return input, errors.Wrap(httperrors.ErrNotSupported, "remote tap service only accepts guest nics in vpc networks mirrored with ovn mirrors")
+		}
 		// check loop
 		if tap.Type == api.TapServiceGuest && tap.TargetId == input.SourceId {
 			return input, errors.Wrap(httperrors.ErrInputParameter, "cannot tap trafic from guest itself")
@@ -359,6 +410,28 @@ func (manager *SNetTapFlowManager) ValidateCreateData(
 	if !utils.IsInStringArray(input.Direction, api.TapFlowDirections) {
 		return input, errors.Wrapf(httperrors.ErrNotSupported, "unsupported direction %s", input.Direction)
 	}
+	if len(input.Protocol) == 0 {
+		input.Protocol = api.TapFlowProtocolAny
+	}
+	if !utils.IsInStringArray(input.Protocol, api.TapFlowProtocols) {
+		return input, errors.Wrapf(httperrors.ErrNotSupported, "unsupported protocol %s", input.Protocol)
+	}
+	if len(input.Cidr) > 0 {
+		if !regutils.MatchCIDR(input.Cidr) && !regutils.MatchCIDR6(input.Cidr) {
+			return input, errors.Wrapf(httperrors.ErrInputParameter, "invalid cidr %q", input.Cidr)
+		}
+		_, ipnet, err := net.ParseCIDR(input.Cidr)
+		if err != nil {
+			return input, errors.Wrapf(httperrors.ErrInputParameter, "invalid cidr %q", input.Cidr)
+		}
+		input.Cidr = ipnet.String()
+	}
+	// ovn filters traffic of lport mirrors only, host taps and gre/erspan
+	// mirrors take all packets of the port
+	if (input.Protocol != api.TapFlowProtocolAny || len(input.Cidr) > 0) && (!isOvnMirror || tap.Type != api.TapServiceGuest) {
+		return input, errors.Wrap(httperrors.ErrNotSupported, "protocol and cidr filters are only supported for ovn mirrors of vpc guest nics to a guest tap service")
+	}
+	input.OvnMirror = isOvnMirror
 	if input.Enabled == nil {
 		trueVal := true
 		input.Enabled = &trueVal
@@ -454,6 +527,10 @@ func (flow *SNetTapFlow) getMirrorConfig(needTapHostIp bool) (api.SMirrorConfig,
 		if err != nil {
 			return ret, errors.Wrapf(err, "GetNetwork")
 		}
+		if flow.OvnMirror {
+			// programmed as ovn mirror by vpcagent
+			return ret, errors.Wrap(errors.ErrNotSupported, "ovn mirror of guest nic in vpc network")
+		}
 		if net.IsClassic() {
 			wireId = net.WireId
 		} else {
@@ -17,6 +17,7 @@ package models
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"sort"
 	"strings"
 
@@ -25,6 +26,8 @@ import (
 	"yunion.io/x/pkg/errors"
 	"yunion.io/x/pkg/tristate"
 	"yunion.io/x/pkg/util/netutils"
+	"yunion.io/x/pkg/util/regutils"
+	"yunion.io/x/pkg/utils"
 	"yunion.io/x/sqlchemy"
 
 	"yunion.io/x/onecloud/pkg/apis"
@@ -59,14 +62,21 @@ func init() {
 type SNetTapService struct {
 	db.SEnabledStatusStandaloneResourceBase
 
-	// 流量采集端类型，虚拟机(guest)还是宿主机(host)
+	// 流量采集端类型，虚拟机(guest)、宿主机(host)还是远端隧道端点(remote)
 	Type string `width:"10" charset:"ascii" list:"admin" create:"admin_required"`
-	// 接受流量的目标ID，如果type=host，是hostId，如果type=guest，是guestId
-	TargetId string `width:"36" charset:"ascii" nullable:"false" list:"admin" create:"admin_required"`
+	// 接受流量的目标ID，如果type=host，是hostId，如果type=guest，是guestId，如果type=remote，为空
+	TargetId string `width:"36" charset:"ascii" nullable:"false" list:"admin" create:"admin_optional"`
 	// 接受流量的Mac地址
 	MacAddr string `width:"18" charset:"ascii" list:"admin" create:"admin_optional"`
 	// 网卡名称
 	Ifname string `width:"16" charset:"ascii" nullable:"true" list:"admin"`
+
+	// 远端隧道端点IP地址，仅type=remote有效
+	RemoteIp string `width:"16" charset:"ascii" nullable:"true" list:"admin" create:"admin_optional"`
+	// 远端隧道封装协议，gre或erspan
+	Encap string `width:"8" charset:"ascii" nullable:"true" list:"admin" create:"admin_optional"`
+	// GRE key或ERSPAN session id
+	TunnelKey int `nullable:"true" list:"admin" create:"admin_optional"`
 }
 
 func (man *SNetTapServiceManager) ListItemFilter(
@@ -191,6 +201,9 @@ func (srv *SNetTapService) getMoreDetails(ctx context.Context, details api.NetTa
 		details.Target = guest.Name
 		ret := fetchGuestIPs([]string{srv.TargetId}, tristate.False)
 		details.TargetIps = strings.Join(ret[srv.TargetId], ",")
+	case api.TapServiceRemote:
+		details.Target = fmt.Sprintf("%s://%s", srv.Encap, srv.RemoteIp)
+		details.TargetIps = srv.RemoteIp
 	}
 	details.FlowCount, err = srv.getFlowsCount()
 	if err != nil {
@@ -292,6 +305,32 @@ func (manager *SNetTapServiceManager) ValidateCreateData(
 			return input, errors.Wrap(err, "fetchGuestById")
 		}
 		input.TargetId = guestObj.GetId()
+	case api.TapServiceRemote:
+		if !regutils.MatchIP4Addr(input.RemoteIp) {
+			return input, errors.Wrapf(httperrors.ErrInputParameter, "invalid remote_ip %q", input.RemoteIp)
+		}
+		if len(input.Encap) == 0 {
+			input.Encap = api.TapServiceEncapGre
+		}
+		if !utils.IsInStringArray(input.Encap, api.TapServiceEncaps) {
+			return input, errors.Wrapf(httperrors.ErrNotSupported, "unsupported encap %s", input.Encap)
+		}
+		if input.TunnelKey == nil {
+			zero := 0
+			input.TunnelKey = &zero
+		}
+		if *input.TunnelKey < 0 || (input.Encap == api.TapServiceEncapErspan && *input.TunnelKey > api.TapServiceErspanSessionIdMax) {
+			return input, errors.Wrapf(httperrors.ErrInputParameter, "invalid tunnel_key %d for %s", *input.TunnelKey, input.Encap)
+		}
+		cnt, err := manager.Query().Equals("type", api.TapServiceRemote).Equals("remote_ip", input.RemoteIp).Equals("encap", input.Encap).Equals("tunnel_key", *input.TunnelKey).CountWithError()
+		if err != nil {
+			return input, errors.Wrap(err, "query duplicity")
+		}
+		if cnt > 0 {
+			return input, errors.Wrapf(httperrors.ErrConflict, "remote endpoint %s://%s key %d has been used", input.Encap, input.RemoteIp, *input.TunnelKey)
+		}
+		input.TargetId = ""
+		input.MacAddr = ""
 	default:
 		return input, errors.Wrapf(httperrors.ErrNotSupported, "unsupported type %s", input.Type)
 	}
@@ -382,6 +421,9 @@ func (manager *SNetTapServiceManager) FilterByMac(mac string) *sqlchemy.SQuery {
 }
 
 func (srv *SNetTapService) getTapHostIp() string {
+	if srv.Type == api.TapServiceRemote {
+		return srv.RemoteIp
+	}
 	var hostId string
 	if srv.Type == api.TapServiceGuest {
 		guest := GuestManager.FetchGuestById(srv.TargetId)
@@ -404,7 +446,9 @@ func (srv *SNetTapService) getConfig() (api.STapServiceConfig, error) {
 	for _, flow := range flows {
 		mc, err := flow.getMirrorConfig(false)
 		if err != nil {
-			log.Errorf("getMirrorConfig fail: %s", err)
+			if errors.Cause(err) != errors.ErrNotSupported {
+				log.Errorf("getMirrorConfig fail: %s", err)
+			}
 		} else {
 			mirrors = append(mirrors, mc)
 		}
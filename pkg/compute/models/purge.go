@@ -802,6 +802,7 @@ func (self *SGuest) purge(ctx context.Context, userCred mcclient.TokenCredential
 	guestnetworks := GuestnetworkManager.Query("row_id").Equals("guest_id", self.Id)
 	guestcdroms := GuestcdromManager.Query("row_id").Equals("id", self.Id)
 	guestvfd := GuestFloppyManager.Query("row_id").Equals("id", self.Id)
+	guestfsmounts := GuestFilesystemMountManager.Query("row_id").Equals("guest_id", self.Id)
 	guestgroups := GroupguestManager.Query("row_id").Equals("guest_id", self.Id)
 	guestsecgroups := GuestsecgroupManager.Query("row_id").Equals("guest_id", self.Id)
 	// instancesnapshots := InstanceSnapshotManager.Query("id").Equals("guest_id", self.Id)
@@ -823,6 +824,7 @@ func (self *SGuest) purge(ctx context.Context, userCred mcclient.TokenCredential
 		{manager: GroupguestManager, key: "row_id", q: guestgroups},
 		{manager: GuestcdromManager, key: "row_id", q: guestcdroms},
 		{manager: GuestFloppyManager, key: "row_id", q: guestvfd},
+		{manager: GuestFilesystemMountManager, key: "row_id", q: guestfsmounts},
 		{manager: GuestnetworkManager, key: "row_id", q: guestnetworks},
 		{manager: GuestdiskManager, key: "row_id", q: guestdisks},
 		// {manager: InstanceSnapshotManager, key: "id", q: instancesnapshots},
@@ -55,10 +55,14 @@ type IRegionDriver interface {
 	RequestSyncDiskBackupStatus(ctx context.Context, userCred mcclient.TokenCredential, backup *SDiskBackup, task taskman.ITask) error
 	RequestCreateBackup(ctx context.Context, backup *SDiskBackup, snapshotId string, task taskman.ITask) error
 	RequestDeleteBackup(ctx context.Context, backup *SDiskBackup, task taskman.ITask) error
+	RequestCreateBackupByDirtyBitmap(ctx context.Context, backup *SDiskBackup, task taskman.ITask) error
+	RequestConsolidateBackup(ctx context.Context, backup *SDiskBackup, chain []string, task taskman.ITask) error
 	RequestCreateInstanceBackup(ctx context.Context, guest *SGuest, ib *SInstanceBackup, task taskman.ITask, params *jsonutils.JSONDict) error
 	RequestDeleteInstanceBackup(ctx context.Context, ib *SInstanceBackup, task taskman.ITask) error
 	RequestSyncInstanceBackupStatus(ctx context.Context, userCred mcclient.TokenCredential, ib *SInstanceBackup, task taskman.ITask) error
 	RequestSyncBackupStorageStatus(ctx context.Context, userCred mcclient.TokenCredential, bs *SBackupStorage, task taskman.ITask) error
+	RequestVerifyBackupStorage(ctx context.Context, userCred mcclient.TokenCredential, bs *SBackupStorage, input api.BackupStorageVerifyInput, task taskman.ITask) error
+	RequestGcBackupStorage(ctx context.Context, userCred mcclient.TokenCredential, bs *SBackupStorage, input api.BackupStorageGcInput, task taskman.ITask) error
 
 	RequestCreateInstanceSnapshot(ctx context.Context, guest *SGuest, isp *SInstanceSnapshot, task taskman.ITask, params *jsonutils.JSONDict) error
 	RequestDeleteInstanceSnapshot(ctx context.Context, isp *SInstanceSnapshot, task taskman.ITask) error
@@ -119,6 +123,10 @@ type IVpcDriver interface {
 	IsVpcCreateNeedInputCidr() bool
 	RequestCreateVpc(ctx context.Context, userCred mcclient.TokenCredential, region *SCloudregion, vpc *SVpc, task taskman.ITask) error
 	RequestDeleteVpc(ctx context.Context, userCred mcclient.TokenCredential, region *SCloudregion, vpc *SVpc, task taskman.ITask) error
+
+	ValidateCreateVpcPeeringConnection(ctx context.Context, userCred mcclient.TokenCredential, vpc *SVpc, peerVpc *SVpc, input api.VpcPeeringConnectionCreateInput) (api.VpcPeeringConnectionCreateInput, error)
+	RequestCreateVpcPeeringConnection(ctx context.Context, userCred mcclient.TokenCredential, peer *SVpcPeeringConnection, task taskman.ITask) error
+	RequestDeleteVpcPeeringConnection(ctx context.Context, userCred mcclient.TokenCredential, peer *SVpcPeeringConnection, task taskman.ITask) error
 }
 
 type ILoadbalancerDriver interface {
@@ -217,6 +225,9 @@ type INatGatewayDriver interface {
 	RequestAssociateEipForNAT(ctx context.Context, userCred mcclient.TokenCredential, nat *SNatGateway, eip *SElasticip, task taskman.ITask) error
 	ValidateCreateNatGateway(ctx context.Context, userCred mcclient.TokenCredential, input api.NatgatewayCreateInput) (api.NatgatewayCreateInput, error)
 	OnNatEntryDeleteComplete(ctx context.Context, userCred mcclient.TokenCredential, eip *SElasticip) error
+	RequestCreateNatGateway(ctx context.Context, userCred mcclient.TokenCredential, nat *SNatGateway, task taskman.ITask) error
+	RequestCreateNatSEntry(ctx context.Context, userCred mcclient.TokenCredential, nat *SNatGateway, snat *SNatSEntry) error
+	RequestCreateNatDEntry(ctx context.Context, userCred mcclient.TokenCredential, nat *SNatGateway, dnat *SNatDEntry) error
 }
 
 type IElasticcacheDriver interface {
@@ -0,0 +1,244 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/utils"
+	"yunion.io/x/sqlchemy"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/lockman"
+	"yunion.io/x/onecloud/pkg/compute/options"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/stringutils2"
+)
+
+// +onecloud:swagger-gen-model-singular=sched_decision
+// +onecloud:swagger-gen-model-plural=sched_decisions
+type SSchedDecisionManager struct {
+	db.SStandaloneAnonResourceBaseManager
+}
+
+var SchedDecisionManager *SSchedDecisionManager
+
+func init() {
+	SchedDecisionManager = &SSchedDecisionManager{
+		SStandaloneAnonResourceBaseManager: db.NewStandaloneAnonResourceBaseManager(
+			SSchedDecision{},
+			"sched_decisions_tbl",
+			"sched_decision",
+			"sched_decisions",
+		),
+	}
+	SchedDecisionManager.SetVirtualObject(SchedDecisionManager)
+}
+
+// SSchedDecision records a real placement decision made by scheduler
+type SSchedDecision struct {
+	db.SStandaloneAnonResourceBase
+
+	// 调度会话ID
+	SessionId string `width:"64" charset:"ascii" nullable:"false" index:"true" list:"admin"`
+	// 调度的虚拟机ID列表, 以','分隔
+	GuestIds string `charset:"ascii" nullable:"true" list:"admin"`
+	// 选中的宿主机ID列表, 以','分隔
+	HostIds string `charset:"ascii" nullable:"true" list:"admin"`
+
+	Hypervisor string `width:"16" charset:"ascii" nullable:"true" list:"admin"`
+	// 调度算法
+	Algorithm string `width:"32" charset:"ascii" nullable:"true" list:"admin"`
+	// 调度结果, success 或 failed
+	Status string `width:"16" charset:"ascii" nullable:"false" index:"true" list:"admin"`
+	// 调度失败原因
+	Error string `charset:"utf8" nullable:"true" list:"admin"`
+
+	// 调度请求
+	Request jsonutils.JSONObject `length:"long" nullable:"true" get:"admin"`
+	// 通过所有过滤器的候选宿主机及各优先级得分
+	Candidates api.SchedDecisionCandidates `length:"long" nullable:"true" get:"admin"`
+	// 各过滤器耗时
+	Predicates api.SchedDecisionPredicates `length:"medium" nullable:"true" get:"admin"`
+	// 调度总耗时, 单位毫秒
+	ElapsedMs int64 `nullable:"false" default:"0" list:"admin"`
+}
+
+func (manager *SSchedDecisionManager) ValidateCreateData(ctx context.Context, userCred mcclient.TokenCredential, ownerId mcclient.IIdentityProvider, query jsonutils.JSONObject, data *jsonutils.JSONDict) (*jsonutils.JSONDict, error) {
+	return nil, httperrors.NewForbiddenError("not allow to create")
+}
+
+// Record persists a placement decision, called by scheduler
+func (manager *SSchedDecisionManager) Record(ctx context.Context, decision *SSchedDecision) error {
+	decision.SetModelManager(manager, decision)
+	err := manager.TableSpec().Insert(ctx, decision)
+	if err != nil {
+		return errors.Wrap(err, "Insert")
+	}
+	return nil
+}
+
+// LinkGuest appends a guest to the decision of a schedule session, used by
+// region when the guests scheduled by the session are known
+func (manager *SSchedDecisionManager) LinkGuest(ctx context.Context, sessionId string, guestId string) error {
+	if len(sessionId) == 0 || len(guestId) == 0 {
+		return nil
+	}
+	lockman.LockRawObject(ctx, manager.Keyword(), sessionId)
+	defer lockman.ReleaseRawObject(ctx, manager.Keyword(), sessionId)
+
+	decisions := make([]SSchedDecision, 0)
+	q := manager.Query().Equals("session_id", sessionId)
+	err := db.FetchModelObjects(manager, q, &decisions)
+	if err != nil {
+		return errors.Wrap(err, "FetchModelObjects")
+	}
+	for i := range decisions {
+		decision := &decisions[i]
+		guestIds := decision.GetGuestIds()
+		if utils.IsInStringArray(guestId, guestIds) {
+			continue
+		}
+		_, err := db.Update(decision, func() error {
+			decision.GuestIds = strings.Join(append(guestIds, guestId), ",")
+			return nil
+		})
+		if err != nil {
+			return errors.Wrapf(err, "update decision %s", decision.Id)
+		}
+	}
+	return nil
+}
+
+func (decision *SSchedDecision) GetGuestIds() []string {
+	if len(decision.GuestIds) == 0 {
+		return []string{}
+	}
+	return strings.Split(decision.GuestIds, ",")
+}
+
+func (decision *SSchedDecision) GetHostIds() []string {
+	if len(decision.HostIds) == 0 {
+		return []string{}
+	}
+	return strings.Split(decision.HostIds, ",")
+}
+
+func (manager *SSchedDecisionManager) ListItemFilter(
+	ctx context.Context,
+	q *sqlchemy.SQuery,
+	userCred mcclient.TokenCredential,
+	input api.SchedDecisionListInput,
+) (*sqlchemy.SQuery, error) {
+	var err error
+
+	q, err = manager.SStandaloneAnonResourceBaseManager.ListItemFilter(ctx, q, userCred, input.StandaloneAnonResourceListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SStandaloneAnonResourceBaseManager.ListItemFilter")
+	}
+	if len(input.SessionId) > 0 {
+		q = q.In("session_id", input.SessionId)
+	}
+	if len(input.Status) > 0 {
+		q = q.In("status", input.Status)
+	}
+	if len(input.ServerId) > 0 {
+		guestObj, err := GuestManager.FetchByIdOrName(ctx, userCred, input.ServerId)
+		if err != nil {
+			return nil, httperrors.NewResourceNotFoundError2(GuestManager.Keyword(), input.ServerId)
+		}
+		q = q.Filter(sqlchemy.Contains(q.Field("guest_ids"), guestObj.GetId()))
+	}
+	if len(input.HostId) > 0 {
+		q = q.Filter(sqlchemy.Contains(q.Field("host_ids"), input.HostId))
+	}
+	return q, nil
+}
+
+func (manager *SSchedDecisionManager) FetchCustomizeColumns(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	objs []interface{},
+	fields stringutils2.SSortedStrings,
+	isList bool,
+) []api.SchedDecisionDetails {
+	rows := make([]api.SchedDecisionDetails, len(objs))
+
+	baseRows := manager.SStandaloneAnonResourceBaseManager.FetchCustomizeColumns(ctx, userCred, query, objs, fields, isList)
+
+	for i := range rows {
+		rows[i] = api.SchedDecisionDetails{
+			StandaloneAnonResourceDetails: baseRows[i],
+		}
+	}
+
+	return rows
+}
+
+func (manager *SSchedDecisionManager) guestDecisionsQuery(guestId string, limit int) *sqlchemy.SQuery {
+	q := manager.Query()
+	q = q.Filter(sqlchemy.Contains(q.Field("guest_ids"), guestId)).Desc("created_at")
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	return q
+}
+
+func (manager *SSchedDecisionManager) FetchGuestDecisions(guestId string, limit int) ([]SSchedDecision, error) {
+	decisions := make([]SSchedDecision, 0)
+	q := manager.guestDecisionsQuery(guestId, limit)
+	err := db.FetchModelObjects(manager, q, &decisions)
+	if err != nil {
+		return nil, errors.Wrap(err, "FetchModelObjects")
+	}
+	return decisions, nil
+}
+
+// schedDecisionExpireTime returns the creation time before which decisions
+// are removed, false if decisions are kept forever
+func schedDecisionExpireTime(now time.Time, retentionDays int) (time.Time, bool) {
+	if retentionDays <= 0 {
+		return time.Time{}, false
+	}
+	return now.AddDate(0, 0, -retentionDays), true
+}
+
+// CleanupExpiredDecisions removes the decisions older than retention days
+func (manager *SSchedDecisionManager) CleanupExpiredDecisions(ctx context.Context, userCred mcclient.TokenCredential, isStart bool) {
+	expireAt, ok := schedDecisionExpireTime(time.Now(), options.Options.SchedDecisionRetentionDays)
+	if !ok {
+		return
+	}
+	_, err := sqlchemy.GetDB().Exec(
+		fmt.Sprintf(
+			"delete from %s where created_at < ?",
+			manager.TableSpec().Name(),
+		), expireAt,
+	)
+	if err != nil {
+		log.Errorf("unable to delete expired data in %q: %v", manager.TableSpec().Name(), err)
+		return
+	}
+	log.Infof("delete expired data in %q successfully", manager.TableSpec().Name())
+}
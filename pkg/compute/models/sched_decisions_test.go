@@ -0,0 +1,83 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"yunion.io/x/sqlchemy"
+)
+
+func TestSchedDecisionIds(t *testing.T) {
+	cases := []struct {
+		ids  string
+		want []string
+	}{
+		{"", []string{}},
+		{"g1", []string{"g1"}},
+		{"g1,g2", []string{"g1", "g2"}},
+	}
+	for _, c := range cases {
+		decision := &SSchedDecision{GuestIds: c.ids, HostIds: c.ids}
+		if got := decision.GetGuestIds(); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("guest ids of %q: want %v, got %v", c.ids, c.want, got)
+		}
+		if got := decision.GetHostIds(); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("host ids of %q: want %v, got %v", c.ids, c.want, got)
+		}
+	}
+}
+
+func TestSchedDecisionGuestQuery(t *testing.T) {
+	sqlchemy.SetupMockDatabaseBackend()
+
+	sql := SchedDecisionManager.guestDecisionsQuery("guest-1", 5).String()
+	aliases := map[string]bool{}
+	for _, alias := range regexp.MustCompile("`(t[0-9]+)`").FindAllStringSubmatch(sql, -1) {
+		aliases[alias[1]] = true
+	}
+	if len(aliases) != 1 {
+		t.Errorf("want one table alias, got %v in %s", aliases, sql)
+	}
+	for _, want := range []string{"guest_ids", "LIKE", "ORDER BY", "LIMIT 5"} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("want %q in %s", want, sql)
+		}
+	}
+}
+
+func TestSchedDecisionExpireTime(t *testing.T) {
+	now := time.Date(2026, 3, 10, 8, 0, 0, 0, time.UTC)
+	cases := []struct {
+		days   int
+		want   time.Time
+		wantOk bool
+	}{
+		{days: 0},
+		{days: -1},
+		{days: 7, want: time.Date(2026, 3, 3, 8, 0, 0, 0, time.UTC), wantOk: true},
+		{days: 30, want: time.Date(2026, 2, 8, 8, 0, 0, 0, time.UTC), wantOk: true},
+	}
+	for _, c := range cases {
+		got, ok := schedDecisionExpireTime(now, c.days)
+		if ok != c.wantOk || !got.Equal(c.want) {
+			t.Errorf("days %d: want %v %v, got %v %v", c.days, c.want, c.wantOk, got, ok)
+		}
+	}
+}
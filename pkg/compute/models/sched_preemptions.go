@@ -0,0 +1,163 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/sqlchemy"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/stringutils2"
+)
+
+// +onecloud:swagger-gen-model-singular=sched_preemption
+// +onecloud:swagger-gen-model-plural=sched_preemptions
+type SSchedPreemptionManager struct {
+	db.SStandaloneAnonResourceBaseManager
+}
+
+var SchedPreemptionManager *SSchedPreemptionManager
+
+func init() {
+	SchedPreemptionManager = &SSchedPreemptionManager{
+		SStandaloneAnonResourceBaseManager: db.NewStandaloneAnonResourceBaseManager(
+			SSchedPreemption{},
+			"sched_preemptions_tbl",
+			"sched_preemption",
+			"sched_preemptions",
+		),
+	}
+	SchedPreemptionManager.SetVirtualObject(SchedPreemptionManager)
+}
+
+// SSchedPreemption is the audit record of a preemption
+type SSchedPreemption struct {
+	db.SStandaloneAnonResourceBase
+
+	// 发起抢占的虚拟机ID
+	PreemptorId string `width:"36" charset:"ascii" nullable:"false" index:"true" list:"admin"`
+	// 发起抢占的虚拟机的优先级类ID
+	PriorityClassId string `width:"36" charset:"ascii" nullable:"true" list:"admin"`
+	// 发起抢占的虚拟机的优先级
+	Priority int `nullable:"false" default:"0" list:"admin"`
+	// 驱逐被抢占虚拟机后放置的宿主机ID
+	HostId string `width:"36" charset:"ascii" nullable:"true" index:"true" list:"admin"`
+	// 被抢占的虚拟机
+	Victims api.SchedPreemptionVictims `length:"medium" nullable:"true" list:"admin"`
+	// 是否仅演练
+	DryRun bool `nullable:"false" default:"false" list:"admin"`
+	// dry_run, evicting, success 或 failed
+	Status string `width:"16" charset:"ascii" nullable:"false" index:"true" list:"admin"`
+	// 失败原因
+	Reason string `charset:"utf8" nullable:"true" list:"admin"`
+}
+
+func (manager *SSchedPreemptionManager) ValidateCreateData(ctx context.Context, userCred mcclient.TokenCredential, ownerId mcclient.IIdentityProvider, query jsonutils.JSONObject, data *jsonutils.JSONDict) (*jsonutils.JSONDict, error) {
+	return nil, httperrors.NewForbiddenError("not allow to create")
+}
+
+func (manager *SSchedPreemptionManager) Record(ctx context.Context, preemption *SSchedPreemption) error {
+	preemption.SetModelManager(manager, preemption)
+	err := manager.TableSpec().Insert(ctx, preemption)
+	if err != nil {
+		return errors.Wrap(err, "Insert")
+	}
+	return nil
+}
+
+func (preemption *SSchedPreemption) SetStatus(ctx context.Context, userCred mcclient.TokenCredential, status string, reason string) error {
+	_, err := db.Update(preemption, func() error {
+		preemption.Status = status
+		preemption.Reason = reason
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "Update")
+	}
+	return nil
+}
+
+func (manager *SSchedPreemptionManager) ListItemFilter(
+	ctx context.Context,
+	q *sqlchemy.SQuery,
+	userCred mcclient.TokenCredential,
+	input api.SchedPreemptionListInput,
+) (*sqlchemy.SQuery, error) {
+	var err error
+
+	q, err = manager.SStandaloneAnonResourceBaseManager.ListItemFilter(ctx, q, userCred, input.StandaloneAnonResourceListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SStandaloneAnonResourceBaseManager.ListItemFilter")
+	}
+	if len(input.ServerId) > 0 {
+		guestObj, err := GuestManager.FetchByIdOrName(ctx, userCred, input.ServerId)
+		if err != nil {
+			return nil, httperrors.NewResourceNotFoundError2(GuestManager.Keyword(), input.ServerId)
+		}
+		q = q.Equals("preemptor_id", guestObj.GetId())
+	}
+	if len(input.HostId) > 0 {
+		q = q.Equals("host_id", input.HostId)
+	}
+	if len(input.Status) > 0 {
+		q = q.In("status", input.Status)
+	}
+	return q, nil
+}
+
+func (manager *SSchedPreemptionManager) FetchCustomizeColumns(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	objs []interface{},
+	fields stringutils2.SSortedStrings,
+	isList bool,
+) []api.SchedPreemptionDetails {
+	rows := make([]api.SchedPreemptionDetails, len(objs))
+
+	baseRows := manager.SStandaloneAnonResourceBaseManager.FetchCustomizeColumns(ctx, userCred, query, objs, fields, isList)
+
+	guestIds := make([]string, len(objs))
+	hostIds := make([]string, len(objs))
+	for i := range rows {
+		rows[i] = api.SchedPreemptionDetails{
+			StandaloneAnonResourceDetails: baseRows[i],
+		}
+		preemption := objs[i].(*SSchedPreemption)
+		guestIds[i] = preemption.PreemptorId
+		hostIds[i] = preemption.HostId
+	}
+
+	guests, err := db.FetchIdNameMap2(GuestManager, guestIds)
+	if err != nil {
+		return rows
+	}
+	hosts, err := db.FetchIdNameMap2(HostManager, hostIds)
+	if err != nil {
+		return rows
+	}
+	for i := range rows {
+		rows[i].Server = guests[guestIds[i]]
+		rows[i].Host = hosts[hostIds[i]]
+	}
+
+	return rows
+}
@@ -0,0 +1,360 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/rbacscope"
+	"yunion.io/x/pkg/utils"
+	"yunion.io/x/sqlchemy"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/stringutils2"
+)
+
+// +onecloud:swagger-gen-model-singular=sched_priority_class
+// +onecloud:swagger-gen-model-plural=sched_priority_classes
+type SSchedPriorityClassManager struct {
+	db.SStandaloneResourceBaseManager
+}
+
+var SchedPriorityClassManager *SSchedPriorityClassManager
+
+func init() {
+	SchedPriorityClassManager = &SSchedPriorityClassManager{
+		SStandaloneResourceBaseManager: db.NewStandaloneResourceBaseManager(
+			SSchedPriorityClass{},
+			"sched_priority_classes_tbl",
+			"sched_priority_class",
+			"sched_priority_classes",
+		),
+	}
+	SchedPriorityClassManager.SetVirtualObject(SchedPriorityClassManager)
+}
+
+// SSchedPriorityClass is the scheduling priority of guests, a guest with
+// preempt_lower_priority policy is able to evict the guests with lower
+// priority when no host fits it
+type SSchedPriorityClass struct {
+	db.SStandaloneResourceBase
+
+	// 优先级数值, 越大优先级越高
+	Value int `nullable:"false" default:"0" list:"user" create:"optional" update:"admin"`
+	// 抢占策略
+	PreemptionPolicy string `width:"32" charset:"ascii" nullable:"false" default:"never" list:"user" create:"optional" update:"admin"`
+	// 被抢占虚拟机的处理方式, stop 或 migrate
+	VictimAction string `width:"16" charset:"ascii" nullable:"false" default:"stop" list:"user" create:"optional" update:"admin"`
+	// 以此优先级类作为默认优先级的项目ID列表, 以','分隔
+	ProjectIds string `charset:"ascii" nullable:"true" list:"admin"`
+}
+
+func (manager *SSchedPriorityClassManager) validateProjects(ctx context.Context, projects []string) (string, error) {
+	projectIds := []string{}
+	for _, project := range projects {
+		tenant, err := db.TenantCacheManager.FetchTenantByIdOrNameInDomain(ctx, project, "")
+		if err != nil {
+			if errors.Cause(err) == sql.ErrNoRows {
+				return "", httperrors.NewResourceNotFoundError2("project", project)
+			}
+			return "", errors.Wrapf(err, "FetchTenantByIdOrNameInDomain %s", project)
+		}
+		if !utils.IsInStringArray(tenant.Id, projectIds) {
+			projectIds = append(projectIds, tenant.Id)
+		}
+	}
+	return strings.Join(projectIds, ","), nil
+}
+
+func (manager *SSchedPriorityClassManager) ValidateCreateData(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	ownerId mcclient.IIdentityProvider,
+	query jsonutils.JSONObject,
+	input api.SchedPriorityClassCreateInput,
+) (*jsonutils.JSONDict, error) {
+	var err error
+	if len(input.PreemptionPolicy) == 0 {
+		input.PreemptionPolicy = api.PREEMPTION_POLICY_NEVER
+	}
+	if !utils.IsInStringArray(input.PreemptionPolicy, api.PREEMPTION_POLICIES) {
+		return nil, httperrors.NewInputParameterError("invalid preemption_policy %s", input.PreemptionPolicy)
+	}
+	if len(input.VictimAction) == 0 {
+		input.VictimAction = api.PREEMPT_VICTIM_ACTION_STOP
+	}
+	if !utils.IsInStringArray(input.VictimAction, api.PREEMPT_VICTIM_ACTIONS) {
+		return nil, httperrors.NewInputParameterError("invalid victim_action %s", input.VictimAction)
+	}
+	input.StandaloneResourceCreateInput, err = manager.SStandaloneResourceBaseManager.ValidateCreateData(ctx, userCred, ownerId, query, input.StandaloneResourceCreateInput)
+	if err != nil {
+		return nil, err
+	}
+	data := jsonutils.Marshal(input).(*jsonutils.JSONDict)
+	if len(input.Projects) > 0 {
+		projectIds, err := manager.validateProjects(ctx, input.Projects)
+		if err != nil {
+			return nil, err
+		}
+		data.Set("project_ids", jsonutils.NewString(projectIds))
+	}
+	return data, nil
+}
+
+func (pc *SSchedPriorityClass) ValidateUpdateData(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	input api.SchedPriorityClassUpdateInput,
+) (*jsonutils.JSONDict, error) {
+	var err error
+	if len(input.PreemptionPolicy) > 0 && !utils.IsInStringArray(input.PreemptionPolicy, api.PREEMPTION_POLICIES) {
+		return nil, httperrors.NewInputParameterError("invalid preemption_policy %s", input.PreemptionPolicy)
+	}
+	if len(input.VictimAction) > 0 && !utils.IsInStringArray(input.VictimAction, api.PREEMPT_VICTIM_ACTIONS) {
+		return nil, httperrors.NewInputParameterError("invalid victim_action %s", input.VictimAction)
+	}
+	input.StandaloneResourceBaseUpdateInput, err = pc.SStandaloneResourceBase.ValidateUpdateData(ctx, userCred, query, input.StandaloneResourceBaseUpdateInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SStandaloneResourceBase.ValidateUpdateData")
+	}
+	data := jsonutils.Marshal(input).(*jsonutils.JSONDict)
+	if input.Projects != nil {
+		projectIds, err := SchedPriorityClassManager.validateProjects(ctx, input.Projects)
+		if err != nil {
+			return nil, err
+		}
+		data.Set("project_ids", jsonutils.NewString(projectIds))
+	}
+	return data, nil
+}
+
+func (pc *SSchedPriorityClass) getGuestQuery() *sqlchemy.SQuery {
+	return GuestManager.Query().Equals("priority_class_id", pc.Id)
+}
+
+func (pc *SSchedPriorityClass) ValidateDeleteCondition(ctx context.Context, info jsonutils.JSONObject) error {
+	cnt, err := pc.getGuestQuery().CountWithError()
+	if err != nil {
+		return errors.Wrap(err, "CountWithError")
+	}
+	if cnt > 0 {
+		return httperrors.NewNotEmptyError("priority class is used by %d guests", cnt)
+	}
+	return pc.SStandaloneResourceBase.ValidateDeleteCondition(ctx, nil)
+}
+
+func (pc *SSchedPriorityClass) GetProjectIds() []string {
+	if len(pc.ProjectIds) == 0 {
+		return []string{}
+	}
+	return strings.Split(pc.ProjectIds, ",")
+}
+
+func (pc *SSchedPriorityClass) CanPreempt() bool {
+	return pc.PreemptionPolicy == api.PREEMPTION_POLICY_PREEMPT_LOWER
+}
+
+// IsUsableBy returns whether the user is allowed to assign the class to the
+// guests of the project, the classes raising priority or preempting others
+// are reserved for admins and the projects bound to them
+func (pc *SSchedPriorityClass) IsUsableBy(userCred mcclient.TokenCredential, projectId string) bool {
+	if userCred.HasSystemAdminPrivilege() {
+		return true
+	}
+	if utils.IsInStringArray(projectId, pc.GetProjectIds()) {
+		return true
+	}
+	return pc.Value <= 0 && !pc.CanPreempt()
+}
+
+func (manager *SSchedPriorityClassManager) ListItemFilter(
+	ctx context.Context,
+	q *sqlchemy.SQuery,
+	userCred mcclient.TokenCredential,
+	input api.SchedPriorityClassListInput,
+) (*sqlchemy.SQuery, error) {
+	var err error
+
+	q, err = manager.SStandaloneResourceBaseManager.ListItemFilter(ctx, q, userCred, input.StandaloneResourceListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SStandaloneResourceBaseManager.ListItemFilter")
+	}
+	if len(input.PreemptionPolicy) > 0 {
+		q = q.In("preemption_policy", input.PreemptionPolicy)
+	}
+	if len(input.ProjectId) > 0 {
+		tenant, err := db.TenantCacheManager.FetchTenantByIdOrNameInDomain(ctx, input.ProjectId, "")
+		if err != nil {
+			return nil, httperrors.NewResourceNotFoundError2("project", input.ProjectId)
+		}
+		q = q.Filter(sqlchemy.Contains(q.Field("project_ids"), tenant.Id))
+	}
+	return q, nil
+}
+
+func (manager *SSchedPriorityClassManager) OrderByExtraFields(
+	ctx context.Context,
+	q *sqlchemy.SQuery,
+	userCred mcclient.TokenCredential,
+	input api.SchedPriorityClassListInput,
+) (*sqlchemy.SQuery, error) {
+	var err error
+
+	q, err = manager.SStandaloneResourceBaseManager.OrderByExtraFields(ctx, q, userCred, input.StandaloneResourceListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SStandaloneResourceBaseManager.OrderByExtraFields")
+	}
+	return q, nil
+}
+
+func (manager *SSchedPriorityClassManager) FetchCustomizeColumns(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	objs []interface{},
+	fields stringutils2.SSortedStrings,
+	isList bool,
+) []api.SchedPriorityClassDetails {
+	rows := make([]api.SchedPriorityClassDetails, len(objs))
+
+	stdRows := manager.SStandaloneResourceBaseManager.FetchCustomizeColumns(ctx, userCred, query, objs, fields, isList)
+
+	for i := range rows {
+		rows[i] = api.SchedPriorityClassDetails{
+			StandaloneResourceDetails: stdRows[i],
+		}
+		pc := objs[i].(*SSchedPriorityClass)
+		rows[i].GuestCount, _ = pc.getGuestQuery().CountWithError()
+	}
+
+	return rows
+}
+
+// FetchProjectDefault returns the priority class with the highest value
+// among the classes which take the project as default
+func (manager *SSchedPriorityClassManager) FetchProjectDefault(projectId string) (*SSchedPriorityClass, error) {
+	if len(projectId) == 0 {
+		return nil, nil
+	}
+	q := manager.Query()
+	q = q.Filter(sqlchemy.Contains(q.Field("project_ids"), projectId)).Desc("value")
+	classes := make([]SSchedPriorityClass, 0)
+	err := db.FetchModelObjects(manager, q, &classes)
+	if err != nil {
+		return nil, errors.Wrap(err, "FetchModelObjects")
+	}
+	for i := range classes {
+		if utils.IsInStringArray(projectId, classes[i].GetProjectIds()) {
+			return &classes[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// FetchGuestPriorityClass returns the priority class of the guest, falls
+// back to the default class of the guest's project
+func (manager *SSchedPriorityClassManager) FetchGuestPriorityClass(priorityClassId, projectId string) (*SSchedPriorityClass, error) {
+	if len(priorityClassId) > 0 {
+		obj, err := manager.FetchById(priorityClassId)
+		if err != nil {
+			if errors.Cause(err) != sql.ErrNoRows {
+				return nil, errors.Wrapf(err, "FetchById %s", priorityClassId)
+			}
+		} else {
+			return obj.(*SSchedPriorityClass), nil
+		}
+	}
+	return manager.FetchProjectDefault(projectId)
+}
+
+// GetGuestPriority returns the priority value of the guest, 0 if the guest
+// has no priority class
+func (manager *SSchedPriorityClassManager) GetGuestPriority(guest *SGuest) int {
+	pc, err := manager.FetchGuestPriorityClass(guest.PriorityClassId, guest.ProjectId)
+	if err != nil || pc == nil {
+		return 0
+	}
+	return pc.Value
+}
+
+// GetGuestsPriority returns the priority values of the guests keyed by
+// guest id, the classes are fetched once for all the guests
+func (manager *SSchedPriorityClassManager) GetGuestsPriority(guests []SGuest) (map[string]int, error) {
+	classes := make([]SSchedPriorityClass, 0)
+	err := db.FetchModelObjects(manager, manager.Query().Desc("value"), &classes)
+	if err != nil {
+		return nil, errors.Wrap(err, "FetchModelObjects")
+	}
+	byId := make(map[string]*SSchedPriorityClass, len(classes))
+	for i := range classes {
+		byId[classes[i].Id] = &classes[i]
+	}
+	projectDefault := func(projectId string) int {
+		// classes are ordered by value desc, the first bound one wins
+		for i := range classes {
+			if utils.IsInStringArray(projectId, classes[i].GetProjectIds()) {
+				return classes[i].Value
+			}
+		}
+		return 0
+	}
+	ret := make(map[string]int, len(guests))
+	for i := range guests {
+		if pc, ok := byId[guests[i].PriorityClassId]; ok {
+			ret[guests[i].Id] = pc.Value
+		} else {
+			ret[guests[i].Id] = projectDefault(guests[i].ProjectId)
+		}
+	}
+	return ret, nil
+}
+
+// FilterPreemptableGuests limits the guests query to the guests that the
+// requester with the policy scope is allowed to preempt
+func FilterPreemptableGuests(q *sqlchemy.SQuery, scope rbacscope.TRbacScope, projectId, domainId string) *sqlchemy.SQuery {
+	switch scope {
+	case rbacscope.ScopeSystem:
+		return q
+	case rbacscope.ScopeDomain:
+		return q.Equals("domain_id", domainId)
+	case rbacscope.ScopeProject, rbacscope.ScopeUser:
+		return q.Equals("tenant_id", projectId)
+	default:
+		return q.FilterByFalse()
+	}
+}
+
+// IsGuestPreemptable checks the guest against the same rule of
+// FilterPreemptableGuests
+func IsGuestPreemptable(guest *SGuest, scope rbacscope.TRbacScope, projectId, domainId string) bool {
+	switch scope {
+	case rbacscope.ScopeSystem:
+		return true
+	case rbacscope.ScopeDomain:
+		return guest.DomainId == domainId
+	case rbacscope.ScopeProject, rbacscope.ScopeUser:
+		return guest.ProjectId == projectId
+	default:
+		return false
+	}
+}
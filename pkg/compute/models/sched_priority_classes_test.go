@@ -0,0 +1,58 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+
+	"yunion.io/x/pkg/util/rbacscope"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+)
+
+func TestIsGuestPreemptable(t *testing.T) {
+	guest := &SGuest{}
+	guest.ProjectId = "p1"
+	guest.DomainId = "d1"
+	cases := []struct {
+		scope   rbacscope.TRbacScope
+		project string
+		domain  string
+		want    bool
+	}{
+		{rbacscope.ScopeSystem, "p2", "d2", true},
+		{rbacscope.ScopeDomain, "p2", "d1", true},
+		{rbacscope.ScopeDomain, "p1", "d2", false},
+		{rbacscope.ScopeProject, "p1", "d1", true},
+		{rbacscope.ScopeProject, "p2", "d1", false},
+		{rbacscope.ScopeNone, "p2", "d1", false},
+	}
+	for _, c := range cases {
+		if got := IsGuestPreemptable(guest, c.scope, c.project, c.domain); got != c.want {
+			t.Errorf("scope %s project %s domain %s: want %v got %v", c.scope, c.project, c.domain, c.want, got)
+		}
+	}
+}
+
+func TestSchedPriorityClassCanPreempt(t *testing.T) {
+	pc := &SSchedPriorityClass{PreemptionPolicy: api.PREEMPTION_POLICY_NEVER}
+	if pc.CanPreempt() {
+		t.Errorf("class with never policy should not preempt")
+	}
+	pc.PreemptionPolicy = api.PREEMPTION_POLICY_PREEMPT_LOWER
+	if !pc.CanPreempt() {
+		t.Errorf("class with preempt_lower_priority policy should preempt")
+	}
+}
@@ -60,6 +60,8 @@ type SSchedpolicy struct {
 
 	Condition string `width:"1024" charset:"ascii" nullable:"false" list:"user" create:"required" update:"user"`
 	Strategy  string `width:"32" charset:"ascii" nullable:"false" list:"user" create:"required" update:"user"`
+	// 匹配的虚拟机使用的调度算法, 为空时不改变调度算法
+	Algorithm string `width:"32" charset:"ascii" nullable:"true" list:"user" create:"optional" update:"user"`
 
 	Enabled tristate.TriState `default:"true" create:"optional" list:"user" update:"user"`
 }
@@ -79,6 +81,11 @@ func validateSchedpolicyInputData(ctx context.Context, data *jsonutils.JSONDict,
 		return httperrors.NewInputParameterError("invalid strategy %s", strategyStr)
 	}
 
+	algorithm := jsonutils.GetAnyString(data, []string{"algorithm"})
+	if len(algorithm) > 0 && !utils.IsInStringArray(algorithm, api.SCHED_ALGORITHM_LIST) {
+		return httperrors.NewInputParameterError("invalid algorithm %s", algorithm)
+	}
+
 	return nil
 }
 
@@ -283,6 +290,24 @@ func applyServerSchedtags(policies []SSchedpolicy, input *schedapi.ScheduleInput
 	applyResourceSchedPolicy(policies, input.Schedtags, inputCond, setFunc)
 }
 
+// applyServerSchedAlgorithm sets the schedule algorithm of the first matched
+// policy, an algorithm specified by request is never overridden
+func applyServerSchedAlgorithm(policies []SSchedpolicy, input *schedapi.ScheduleInput) {
+	if len(input.SchedAlgorithm) > 0 {
+		return
+	}
+	inputCond := GetDynamicConditionInput(GuestManager, input.ToConditionInput())
+	for i := range policies {
+		if len(policies[i].Algorithm) == 0 {
+			continue
+		}
+		if matchResourceSchedPolicy(policies[i], inputCond) {
+			input.SchedAlgorithm = policies[i].Algorithm
+			return
+		}
+	}
+}
+
 func applyDiskSchedtags(policies []SSchedpolicy, input *api.DiskConfig) {
 	inputCond := GetDynamicConditionInput(DiskManager, jsonutils.Marshal(input).(*jsonutils.JSONDict))
 	setFunc := func(tags []*api.SchedtagConfig) {
@@ -308,6 +333,7 @@ func ApplySchedPolicies(input *schedapi.ScheduleInput) *schedapi.ScheduleInput {
 	config := input.ServerConfigs
 
 	applyServerSchedtags(hostPolicies, input)
+	applyServerSchedAlgorithm(hostPolicies, input)
 	for _, disk := range config.Disks {
 		applyDiskSchedtags(storagePolicies, disk)
 	}
@@ -144,6 +144,8 @@ type SSchedtag struct {
 
 	DefaultStrategy string `width:"16" charset:"ascii" nullable:"true" default:"" list:"user" update:"admin" create:"admin_optional"` // Column(VARCHAR(16, charset='ascii'), nullable=True, default='')
 	ResourceType    string `width:"16" charset:"ascii" nullable:"true" list:"user" create:"required"`                                 // Column(VARCHAR(16, charset='ascii'), nullable=True, default='')
+	// 拓扑键, 主机组分布约束 schedtag:<topology_key> 以带有该拓扑键的调度标签为拓扑域
+	TopologyKey string `width:"64" charset:"utf8" nullable:"true" list:"user" update:"admin" create:"admin_optional"`
 }
 
 func (m *SSchedtagManager) FilterByOwner(ctx context.Context, q *sqlchemy.SQuery, man db.FilterByOwnerProvider, userCred mcclient.TokenCredential, ownerId mcclient.IIdentityProvider, scope rbacscope.TRbacScope) *sqlchemy.SQuery {
@@ -77,6 +77,11 @@ type SSecurityGroupRule struct {
 	CIDR        string `width:"256" charset:"ascii" list:"user" update:"user" create:"optional"`
 	Action      string `width:"5" charset:"ascii" nullable:"false" list:"user" update:"user" create:"required"`
 	Description string `width:"256" charset:"utf8" list:"user" update:"user" create:"optional"`
+
+	// 记录规则命中日志, 仅对OVN VPC生效
+	AclLog bool `nullable:"false" default:"false" list:"user" update:"user" create:"optional"`
+	// 对端安全组ID, 仅对OVN VPC生效
+	PeerSecgroupId string `width:"128" charset:"ascii" list:"user" create:"optional"`
 }
 
 func (self *SSecurityGroupRule) GetId() string {
@@ -275,6 +280,10 @@ func (manager *SSecurityGroupRuleManager) ValidateCreateData(ctx context.Context
 
 	secgroup := _secgroup.(*SSecurityGroup)
 
+	if len(input.PeerSecgroupId) > 0 && len(secgroup.ManagerId) > 0 {
+		return nil, httperrors.NewUnsupportOperationError("peer secgroup is only supported by on-premise security group")
+	}
+
 	driver, err := secgroup.GetRegionDriver()
 	if err != nil {
 		return nil, err
@@ -286,6 +295,7 @@ func (manager *SSecurityGroupRuleManager) ValidateCreateData(ctx context.Context
 	if err != nil {
 		return nil, err
 	}
+	input.PeerSecgroupId = opts.Rules[0].PeerSecgroupId
 
 	if !secgroup.IsOwner(userCred) && !userCred.HasSystemAdminPrivilege() {
 		return input, httperrors.NewForbiddenError("not enough privilege")
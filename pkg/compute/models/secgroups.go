@@ -90,6 +90,9 @@ type SSecurityGroup struct {
 	SGlobalVpcResourceBase `width:"36" charset:"ascii" list:"user" create:"domain_optional" json:"globalvpc_id"`
 
 	SVpcResourceBase `wdith:"36" charset:"ascii" nullable:"true" list:"domain" create:"domain_optional" update:""`
+
+	// 记录所有规则的命中日志, 仅对OVN VPC生效
+	AclLog bool `nullable:"false" default:"false" list:"user" create:"optional" update:"user"`
 }
 
 func (self *SSecurityGroup) GetCloudproviderId() string {
@@ -488,6 +491,14 @@ func (manager *SSecurityGroupManager) ValidateCreateData(
 		return nil, err
 	}
 
+	if len(vpc.ManagerId) > 0 {
+		for i := range input.Rules {
+			if len(input.Rules[i].PeerSecgroupId) > 0 {
+				return nil, httperrors.NewUnsupportOperationError("peer secgroup is only supported by on-premise security group")
+			}
+		}
+	}
+
 	driver := region.GetDriver()
 
 	input, err = driver.ValidateCreateSecurityGroupInput(ctx, userCred, input)
@@ -563,6 +574,10 @@ func (self *SSecurityGroup) getSecurityRuleString() (string, error) {
 	}
 	var rules []string
 	for _, rule := range secgrouprules {
+		if len(rule.PeerSecgroupId) > 0 {
+			// realised by vpcagent for ovn vpc only
+			continue
+		}
 		rules = append(rules, rule.String())
 	}
 	return strings.Join(rules, SECURITY_GROUP_SEPARATOR), nil
@@ -677,6 +692,7 @@ func (self *SSecurityGroup) PerformClone(ctx context.Context, userCred mcclient.
 
 	secgroup.Name = input.Name
 	secgroup.Description = input.Description
+	secgroup.AclLog = self.AclLog
 	secgroup.Status = api.SECGROUP_STATUS_READY
 	secgroup.ProjectId = userCred.GetProjectId()
 	secgroup.DomainId = userCred.GetProjectDomainId()
@@ -711,6 +727,8 @@ func (self *SSecurityGroup) PerformClone(ctx context.Context, userCred mcclient.
 		secgrouprule.CIDR = rule.CIDR
 		secgrouprule.Action = rule.Action
 		secgrouprule.Description = rule.Description
+		secgrouprule.AclLog = rule.AclLog
+		secgrouprule.PeerSecgroupId = rule.PeerSecgroupId
 		secgrouprule.SecgroupId = secgroup.Id
 		if err := SecurityGroupRuleManager.TableSpec().Insert(ctx, secgrouprule); err != nil {
 			return input, err
@@ -1042,6 +1060,14 @@ func (self *SSecurityGroup) ValidateDeleteCondition(ctx context.Context, info ap
 	if info.TotalCnt > 0 {
 		return httperrors.NewNotEmptyError("the security group %s is in use cnt: %d", self.Id, info.TotalCnt)
 	}
+	q := SecurityGroupRuleManager.Query().Equals("peer_secgroup_id", self.Id).NotEquals("secgroup_id", self.Id)
+	cnt, err := q.CountWithError()
+	if err != nil {
+		return httperrors.NewInternalServerError("count peer secgroup rules: %v", err)
+	}
+	if cnt > 0 {
+		return httperrors.NewNotEmptyError("the security group %s is referred by %d rules of other security groups", self.Id, cnt)
+	}
 	return self.SSharableVirtualResourceBase.ValidateDeleteCondition(ctx, nil)
 }
 
@@ -1141,6 +1167,7 @@ func (self *SSecurityGroup) PerformImportRules(ctx context.Context, userCred mcc
 			CIDR:        r.CIDR,
 			Action:      r.Action,
 			Description: r.Description,
+			AclLog:      r.AclLog,
 		}
 		rule.SecgroupId = self.Id
 
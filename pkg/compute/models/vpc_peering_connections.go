@@ -27,6 +27,7 @@ import (
 
 	api "yunion.io/x/onecloud/pkg/apis/compute"
 	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/lockman"
 	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
 	"yunion.io/x/onecloud/pkg/httperrors"
 	"yunion.io/x/onecloud/pkg/mcclient"
@@ -63,6 +64,9 @@ type SVpcPeeringConnection struct {
 	PeerVpcId        string `width:"36" charset:"ascii" nullable:"true" list:"domain" create:"required" json:"peer_vpc_id"`
 	PeerAccountId    string `width:"36" charset:"ascii" nullable:"true" list:"domain"`
 	Bandwidth        int    `nullable:"false" default:"0" list:"user" create:"optional"`
+
+	// ovn 互联链路序号, -1 表示未分配
+	TransitIndex int `nullable:"false" default:"-1" list:"domain"`
 }
 
 func (manager *SVpcPeeringConnectionManager) GetContextManagers() [][]db.IModelManager {
@@ -143,8 +147,18 @@ func (manager *SVpcPeeringConnectionManager) ValidateCreateData(
 	}
 	peerVpc := _peerVpc.(*SVpc)
 
+	input.VpcId = vpc.Id
+	input.PeerVpcId = peerVpc.Id
+
+	if len(vpc.ManagerId) == 0 && len(peerVpc.ManagerId) == 0 {
+		region, err := vpc.GetRegion()
+		if err != nil {
+			return input, httperrors.NewGeneralError(errors.Wrapf(err, "GetRegion"))
+		}
+		return region.GetDriver().ValidateCreateVpcPeeringConnection(ctx, userCred, vpc, peerVpc, input)
+	}
 	if len(vpc.ManagerId) == 0 || len(peerVpc.ManagerId) == 0 {
-		return input, httperrors.NewInputParameterError("Only public cloud support vpcpeering")
+		return input, httperrors.NewInputParameterError("vpc peering between public cloud and on-premise vpc is not supported")
 	}
 
 	// get account,providerFactory
@@ -161,31 +175,9 @@ func (manager *SVpcPeeringConnectionManager) ValidateCreateData(
 
 	// check vpc ip range overlap
 	if !factory.IsSupportVpcPeeringVpcCidrOverlap() {
-		vpcIpv4Ranges := []netutils.IPV4AddrRange{}
-		peervpcIpv4Ranges := []netutils.IPV4AddrRange{}
-		vpcCidrBlocks := strings.Split(vpc.CidrBlock, ",")
-		peervpcCidrBlocks := strings.Split(peerVpc.CidrBlock, ",")
-		for i := range vpcCidrBlocks {
-			vpcIpv4Range, err := netutils.NewIPV4Prefix(vpcCidrBlocks[i])
-			if err != nil {
-				return input, httperrors.NewGeneralError(errors.Wrapf(err, "convert vpc cidr %s to ipv4range error", vpcCidrBlocks[i]))
-			}
-			vpcIpv4Ranges = append(vpcIpv4Ranges, vpcIpv4Range.ToIPRange())
-		}
-
-		for i := range peervpcCidrBlocks {
-			peervpcIpv4Range, err := netutils.NewIPV4Prefix(peervpcCidrBlocks[i])
-			if err != nil {
-				return input, httperrors.NewGeneralError(errors.Wrapf(err, "convert vpc cidr %s to ipv4range error", peervpcCidrBlocks[i]))
-			}
-			peervpcIpv4Ranges = append(peervpcIpv4Ranges, peervpcIpv4Range.ToIPRange())
-		}
-		for i := range vpcIpv4Ranges {
-			for j := range peervpcIpv4Ranges {
-				if vpcIpv4Ranges[i].IsOverlap(peervpcIpv4Ranges[j]) {
-					return input, httperrors.NewNotSupportedError("ipv4 range overlap")
-				}
-			}
+		err := ValidateVpcPeeringCidrOverlap(vpc, peerVpc)
+		if err != nil {
+			return input, err
 		}
 	}
 
@@ -218,6 +210,109 @@ func (manager *SVpcPeeringConnectionManager) ValidateCreateData(
 	return input, nil
 }
 
+// ValidateVpcPeeringCidrOverlap 检查两个vpc的网段是否重叠
+func ValidateVpcPeeringCidrOverlap(vpc, peerVpc *SVpc) error {
+	vpcIpv4Ranges := []netutils.IPV4AddrRange{}
+	peervpcIpv4Ranges := []netutils.IPV4AddrRange{}
+	vpcCidrBlocks := strings.Split(vpc.CidrBlock, ",")
+	peervpcCidrBlocks := strings.Split(peerVpc.CidrBlock, ",")
+	for i := range vpcCidrBlocks {
+		vpcIpv4Range, err := netutils.NewIPV4Prefix(vpcCidrBlocks[i])
+		if err != nil {
+			return httperrors.NewGeneralError(errors.Wrapf(err, "convert vpc cidr %s to ipv4range error", vpcCidrBlocks[i]))
+		}
+		vpcIpv4Ranges = append(vpcIpv4Ranges, vpcIpv4Range.ToIPRange())
+	}
+
+	for i := range peervpcCidrBlocks {
+		peervpcIpv4Range, err := netutils.NewIPV4Prefix(peervpcCidrBlocks[i])
+		if err != nil {
+			return httperrors.NewGeneralError(errors.Wrapf(err, "convert vpc cidr %s to ipv4range error", peervpcCidrBlocks[i]))
+		}
+		peervpcIpv4Ranges = append(peervpcIpv4Ranges, peervpcIpv4Range.ToIPRange())
+	}
+	for i := range vpcIpv4Ranges {
+		for j := range peervpcIpv4Ranges {
+			if vpcIpv4Ranges[i].IsOverlap(peervpcIpv4Ranges[j]) {
+				return httperrors.NewNotSupportedError("ipv4 range overlap")
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateVpcPeeringCidrOverlapWithPeers checks cidr blocks of a new peering
+// against vpcs already peered with either side, as routers of both sides
+// route cidr blocks of all their peers
+func ValidateVpcPeeringCidrOverlapWithPeers(vpc, peerVpc *SVpc, vpcPeers, peerVpcPeers []SVpc) error {
+	for i := range vpcPeers {
+		if vpcPeers[i].Id == peerVpc.Id {
+			continue
+		}
+		if err := ValidateVpcPeeringCidrOverlap(peerVpc, &vpcPeers[i]); err != nil {
+			return httperrors.NewNotSupportedError("cidr of vpc %s overlaps with vpc %s peered with vpc %s", peerVpc.Name, vpcPeers[i].Name, vpc.Name)
+		}
+	}
+	for i := range peerVpcPeers {
+		if peerVpcPeers[i].Id == vpc.Id {
+			continue
+		}
+		if err := ValidateVpcPeeringCidrOverlap(vpc, &peerVpcPeers[i]); err != nil {
+			return httperrors.NewNotSupportedError("cidr of vpc %s overlaps with vpc %s peered with vpc %s", vpc.Name, peerVpcPeers[i].Name, peerVpc.Name)
+		}
+	}
+	return nil
+}
+
+// pickVpcPeeringTransitIndex returns the smallest transit link index not in use
+func pickVpcPeeringTransitIndex(used map[int]bool, maxIdx int) (int, error) {
+	for i := 0; i < maxIdx; i++ {
+		if !used[i] {
+			return i, nil
+		}
+	}
+	return -1, errors.Wrapf(httperrors.ErrOutOfResource, "all %d transit links are in use", maxIdx)
+}
+
+// AllocTransitIndex stores a transit link index not used by other peering
+// connections of both vpcs.  The index stays with the peering connection
+// until it is deleted, so that addresses of transit links do not move when
+// other peering connections come and go
+func (self *SVpcPeeringConnection) AllocTransitIndex(ctx context.Context) error {
+	lockman.LockRawObject(ctx, VpcPeeringConnectionManager.Keyword(), "transit_index")
+	defer lockman.ReleaseRawObject(ctx, VpcPeeringConnectionManager.Keyword(), "transit_index")
+
+	if self.TransitIndex >= 0 {
+		return nil
+	}
+	vpcIds := []string{self.VpcId, self.PeerVpcId}
+	q := VpcPeeringConnectionManager.Query()
+	q = q.Filter(sqlchemy.OR(
+		sqlchemy.In(q.Field("vpc_id"), vpcIds),
+		sqlchemy.In(q.Field("peer_vpc_id"), vpcIds),
+	))
+	q = q.GE("transit_index", 0)
+	peers := []SVpcPeeringConnection{}
+	err := db.FetchModelObjects(VpcPeeringConnectionManager, q, &peers)
+	if err != nil {
+		return errors.Wrapf(err, "db.FetchModelObjects")
+	}
+	used := map[int]bool{}
+	for i := range peers {
+		used[peers[i].TransitIndex] = true
+	}
+	transitCidr := api.VpcInterPeerCidr()
+	idx, err := pickVpcPeeringTransitIndex(used, 1<<uint(api.VpcInterPeerMask-int(transitCidr.MaskLen)))
+	if err != nil {
+		return err
+	}
+	_, err = db.Update(self, func() error {
+		self.TransitIndex = idx
+		return nil
+	})
+	return err
+}
+
 func (self *SVpcPeeringConnection) PostCreate(ctx context.Context, userCred mcclient.TokenCredential, ownerId mcclient.IIdentityProvider, query jsonutils.JSONObject, data jsonutils.JSONObject) {
 	params := jsonutils.NewDict()
 	task, err := taskman.TaskManager.NewTask(ctx, "VpcPeeringConnectionCreateTask", self, userCred, params, "", "", nil)
@@ -0,0 +1,130 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+)
+
+func TestValidateVpcPeeringCidrOverlapWithPeers(t *testing.T) {
+	newVpc := func(id, cidr string) SVpc {
+		vpc := SVpc{CidrBlock: cidr}
+		vpc.Id = id
+		vpc.Name = id
+		return vpc
+	}
+	var (
+		vpcA = newVpc("a", "10.0.0.0/16")
+		vpcB = newVpc("b", "10.1.0.0/16")
+		vpcC = newVpc("c", "10.2.0.0/16,192.168.0.0/24")
+		vpcD = newVpc("d", "192.168.0.0/16")
+	)
+	cases := []struct {
+		name         string
+		vpc          SVpc
+		peerVpc      SVpc
+		vpcPeers     []SVpc
+		peerVpcPeers []SVpc
+		wantErr      bool
+	}{
+		{
+			name:    "no peers",
+			vpc:     vpcA,
+			peerVpc: vpcB,
+		},
+		{
+			name:         "disjoint peers",
+			vpc:          vpcA,
+			peerVpc:      vpcB,
+			vpcPeers:     []SVpc{vpcC},
+			peerVpcPeers: []SVpc{vpcC},
+		},
+		{
+			name:     "peer vpc overlaps with peer of vpc",
+			vpc:      vpcA,
+			peerVpc:  vpcD,
+			vpcPeers: []SVpc{vpcC},
+			wantErr:  true,
+		},
+		{
+			name:         "vpc overlaps with peer of peer vpc",
+			vpc:          vpcD,
+			peerVpc:      vpcA,
+			peerVpcPeers: []SVpc{vpcC},
+			wantErr:      true,
+		},
+		{
+			name:         "each other skipped",
+			vpc:          vpcC,
+			peerVpc:      vpcD,
+			vpcPeers:     []SVpc{vpcD},
+			peerVpcPeers: []SVpc{vpcC},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidateVpcPeeringCidrOverlapWithPeers(&c.vpc, &c.peerVpc, c.vpcPeers, c.peerVpcPeers)
+			if (err != nil) != c.wantErr {
+				t.Errorf("want error %v, got %v", c.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPickVpcPeeringTransitIndex(t *testing.T) {
+	cases := []struct {
+		name    string
+		used    map[int]bool
+		maxIdx  int
+		want    int
+		wantErr bool
+	}{
+		{
+			name:   "empty",
+			maxIdx: 4,
+			want:   0,
+		},
+		{
+			name:   "hole",
+			used:   map[int]bool{0: true, 2: true},
+			maxIdx: 4,
+			want:   1,
+		},
+		{
+			name:   "next",
+			used:   map[int]bool{0: true, 1: true},
+			maxIdx: 4,
+			want:   2,
+		},
+		{
+			name:    "exhausted",
+			used:    map[int]bool{0: true, 1: true},
+			maxIdx:  2,
+			want:    -1,
+			wantErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := pickVpcPeeringTransitIndex(c.used, c.maxIdx)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("want error %v, got %v", c.wantErr, err)
+			}
+			if got != c.want {
+				t.Errorf("want %d, got %d", c.want, got)
+			}
+		})
+	}
+}
@@ -191,6 +191,25 @@ func (svpc *SVpc) GetAccepterVpcPeeringConnections() ([]SVpcPeeringConnection, e
 	}
 	return vpcPC, nil
 }
+
+// GetPeeredVpcs returns vpcs on the other side of peering connections of
+// the vpc, no matter which side requested the peering
+func (svpc *SVpc) GetPeeredVpcs() ([]SVpc, error) {
+	rq := svpc.getRequesterVpcPeeringConnectionQuery().SubQuery()
+	aq := svpc.getAccepterVpcPeeringConnectionQuery().SubQuery()
+	q := VpcManager.Query()
+	q = q.Filter(sqlchemy.OR(
+		sqlchemy.In(q.Field("id"), rq.Query(rq.Field("peer_vpc_id")).SubQuery()),
+		sqlchemy.In(q.Field("id"), aq.Query(aq.Field("vpc_id")).SubQuery()),
+	))
+	vpcs := []SVpc{}
+	err := db.FetchModelObjects(VpcManager, q, &vpcs)
+	if err != nil {
+		return nil, err
+	}
+	return vpcs, nil
+}
+
 func (svpc *SVpc) GetVpcPeeringConnectionCount() (int, error) {
 	q := svpc.getRequesterVpcPeeringConnectionQuery()
 	requesterPeerCount, err := q.CountWithError()
@@ -258,6 +277,9 @@ func (svpc *SVpc) ValidateDeleteCondition(ctx context.Context, info *api.VpcDeta
 	if info.RequestVpcPeerCount > 0 {
 		return httperrors.NewNotEmptyError("VPC not empty, please delete vpc peering first")
 	}
+	if len(svpc.ManagerId) == 0 && info.AcceptVpcPeerCount > 0 {
+		return httperrors.NewNotEmptyError("VPC not empty, please delete vpc peering first")
+	}
 
 	return svpc.SEnabledStatusInfrasResourceBase.ValidateDeleteCondition(ctx, nil)
 }
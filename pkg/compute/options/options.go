@@ -58,6 +58,8 @@ type ComputeOptions struct {
 	DefaultMtu       int `default:"1500" help:"Default network mtu"`
 	OvnUnderlayMtu   int `help:"mtu of ovn underlay network" default:"1500"`
 
+	EnableOvnTapMirror bool `help:"mirror new tap flows of vpc guest nics to guest or remote tap services with ovn mirrors, requires enable_ovn_mirror of vpcagent" default:"false"`
+
 	DefaultServerQuota           int `default:"50" help:"Common Server quota per tenant, default 50"`
 	DefaultCpuQuota              int `default:"200" help:"Common CPU quota per tenant, default 200"`
 	DefaultMemoryQuota           int `default:"204800" help:"Common memory quota per tenant in MB, default 200G"`
@@ -160,6 +162,7 @@ type ComputeOptions struct {
 	GuestTemplateCheckInterval int `help:"interval between two consecutive inspections of Guest Template in hour unit" default:"12"`
 
 	ReconcileGuestBackupIntervalSeconds int `help:"interval reconcile guest bakcups" default:"30"`
+	DiskBackupChainRetentionDays        int `help:"Days to keep the links of incremental or differential disk backup chains, the expired links are consolidated or deleted, 0 means never expire" default:"0"`
 
 	EnableAutoRenameProject bool `help:"when it set true, auto create project will rename when cloud project name changed" default:"false"`
 
@@ -184,13 +187,16 @@ type ComputeOptions struct {
 
 	NoCheckOsTypeForCachedImage bool `help:"Don't check os type for cached image"`
 
+	RequireSignedImage bool `help:"Refuse to create disks from glance images whose signature is not verified" default:"false"`
+
 	ProhibitRefreshingCloudImage bool `help:"Prohibit refreshing cloud image"`
 
 	GlobalMacPrefix string `help:"Global prefix of MAC address, default to 00:22" default:"00:22"`
 
 	DefaultIPAllocationDirection string `help:"default IP allocation direction" default:"stepdown"`
 
-	KeepDeletedSnapshotDays int `help:"The day of cleanup snapshot" default:"30"`
+	KeepDeletedSnapshotDays    int `help:"The day of cleanup snapshot" default:"30"`
+	SchedDecisionRetentionDays int `help:"Days to keep the placement decisions recorded by scheduler, 0 means never cleanup" default:"7"`
 	// 弹性伸缩中的ecs一般会有特殊的系统标签，通过指定这些标签可以忽略这部分ecs的同步, 指定多个key需要以 ',' 分隔
 	SkipServerBySysTagKeys  string `help:"skip server,disk sync and create with system tags" default:""`
 	SkipServerByUserTagKeys string `help:"skip server,disk sync and create with user tags" default:""`
@@ -211,6 +211,18 @@ func (self *SBaseRegionDriver) RequestDeleteVpc(ctx context.Context, userCred mc
 	return fmt.Errorf("Not implement RequestDeleteVpc")
 }
 
+func (self *SBaseRegionDriver) ValidateCreateVpcPeeringConnection(ctx context.Context, userCred mcclient.TokenCredential, vpc *models.SVpc, peerVpc *models.SVpc, input api.VpcPeeringConnectionCreateInput) (api.VpcPeeringConnectionCreateInput, error) {
+	return input, httperrors.NewNotImplementedError("ValidateCreateVpcPeeringConnection")
+}
+
+func (self *SBaseRegionDriver) RequestCreateVpcPeeringConnection(ctx context.Context, userCred mcclient.TokenCredential, peer *models.SVpcPeeringConnection, task taskman.ITask) error {
+	return errors.Wrapf(cloudprovider.ErrNotImplemented, "RequestCreateVpcPeeringConnection")
+}
+
+func (self *SBaseRegionDriver) RequestDeleteVpcPeeringConnection(ctx context.Context, userCred mcclient.TokenCredential, peer *models.SVpcPeeringConnection, task taskman.ITask) error {
+	return errors.Wrapf(cloudprovider.ErrNotImplemented, "RequestDeleteVpcPeeringConnection")
+}
+
 func (self *SBaseRegionDriver) ValidateCreateSecurityGroupInput(ctx context.Context, userCred mcclient.TokenCredential, input *api.SSecgroupCreateInput) (*api.SSecgroupCreateInput, error) {
 	return nil, errors.Wrapf(cloudprovider.ErrNotImplemented, "ValidateCreateSecurityGroupInput")
 }
@@ -382,6 +394,18 @@ func (self *SBaseRegionDriver) OnNatEntryDeleteComplete(ctx context.Context, use
 	return nil
 }
 
+func (self *SBaseRegionDriver) RequestCreateNatGateway(ctx context.Context, userCred mcclient.TokenCredential, nat *models.SNatGateway, task taskman.ITask) error {
+	return errors.Wrapf(cloudprovider.ErrNotImplemented, "RequestCreateNatGateway")
+}
+
+func (self *SBaseRegionDriver) RequestCreateNatSEntry(ctx context.Context, userCred mcclient.TokenCredential, nat *models.SNatGateway, snat *models.SNatSEntry) error {
+	return errors.Wrapf(cloudprovider.ErrNotImplemented, "RequestCreateNatSEntry")
+}
+
+func (self *SBaseRegionDriver) RequestCreateNatDEntry(ctx context.Context, userCred mcclient.TokenCredential, nat *models.SNatGateway, dnat *models.SNatDEntry) error {
+	return errors.Wrapf(cloudprovider.ErrNotImplemented, "RequestCreateNatDEntry")
+}
+
 func (self *SBaseRegionDriver) ValidateCreateNatGateway(ctx context.Context, userCred mcclient.TokenCredential, input api.NatgatewayCreateInput) (api.NatgatewayCreateInput, error) {
 	return input, httperrors.NewNotImplementedError("ValidateCreateNatGateway")
 }
@@ -410,6 +434,14 @@ func (self *SBaseRegionDriver) RequestCreateBackup(ctx context.Context, backup *
 	return errors.Wrapf(cloudprovider.ErrNotImplemented, "RequestCreateBackup")
 }
 
+func (self *SBaseRegionDriver) RequestCreateBackupByDirtyBitmap(ctx context.Context, backup *models.SDiskBackup, task taskman.ITask) error {
+	return errors.Wrapf(cloudprovider.ErrNotImplemented, "RequestCreateBackupByDirtyBitmap")
+}
+
+func (self *SBaseRegionDriver) RequestConsolidateBackup(ctx context.Context, backup *models.SDiskBackup, chain []string, task taskman.ITask) error {
+	return errors.Wrapf(cloudprovider.ErrNotImplemented, "RequestConsolidateBackup")
+}
+
 func (self *SBaseRegionDriver) RequestDeleteBackup(ctx context.Context, backup *models.SDiskBackup, task taskman.ITask) error {
 	return errors.Wrapf(cloudprovider.ErrNotImplemented, "RequestDeleteBackup")
 }
@@ -434,6 +466,14 @@ func (self *SBaseRegionDriver) RequestSyncBackupStorageStatus(ctx context.Contex
 	return errors.Wrapf(cloudprovider.ErrNotImplemented, "SyncBackupStorageStatus")
 }
 
+func (self *SBaseRegionDriver) RequestVerifyBackupStorage(ctx context.Context, userCred mcclient.TokenCredential, bs *models.SBackupStorage, input api.BackupStorageVerifyInput, task taskman.ITask) error {
+	return errors.Wrapf(cloudprovider.ErrNotImplemented, "RequestVerifyBackupStorage")
+}
+
+func (self *SBaseRegionDriver) RequestGcBackupStorage(ctx context.Context, userCred mcclient.TokenCredential, bs *models.SBackupStorage, input api.BackupStorageGcInput, task taskman.ITask) error {
+	return errors.Wrapf(cloudprovider.ErrNotImplemented, "RequestGcBackupStorage")
+}
+
 func (self *SBaseRegionDriver) RequestPackInstanceBackup(ctx context.Context, ib *models.SInstanceBackup, task taskman.ITask, packageName string) error {
 	return errors.Wrapf(cloudprovider.ErrNotImplemented, "RequestPackInstanceBackup")
 }
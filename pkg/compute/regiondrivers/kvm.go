@@ -33,6 +33,7 @@ import (
 	"yunion.io/x/sqlchemy"
 
 	"yunion.io/x/onecloud/pkg/apis"
+	billing_api "yunion.io/x/onecloud/pkg/apis/billing"
 	api "yunion.io/x/onecloud/pkg/apis/compute"
 	hostapi "yunion.io/x/onecloud/pkg/apis/host"
 	"yunion.io/x/onecloud/pkg/cloudcommon/db"
@@ -77,6 +78,15 @@ func (self *SKVMRegionDriver) ValidateCreateSecurityGroupInput(ctx context.Conte
 		if err != nil {
 			return input, httperrors.NewInputParameterError("rule %d is invalid: %s", i, err)
 		}
+		if len(input.Rules[i].PeerSecgroupId) > 0 {
+			peerObj, err := validators.ValidateModel(ctx, userCred, models.SecurityGroupManager, &input.Rules[i].PeerSecgroupId)
+			if err != nil {
+				return input, err
+			}
+			if peer := peerObj.(*models.SSecurityGroup); len(peer.ManagerId) > 0 {
+				return input, httperrors.NewInputParameterError("peer secgroup %s is not an on-premise security group", peer.Name)
+			}
+		}
 	}
 	return input, nil
 }
@@ -528,6 +538,74 @@ func (self *SKVMRegionDriver) RequestDeleteVpc(ctx context.Context, userCred mcc
 	return nil
 }
 
+func (self *SKVMRegionDriver) ValidateCreateVpcPeeringConnection(ctx context.Context, userCred mcclient.TokenCredential, vpc *models.SVpc, peerVpc *models.SVpc, input api.VpcPeeringConnectionCreateInput) (api.VpcPeeringConnectionCreateInput, error) {
+	if vpc.Id == api.DEFAULT_VPC_ID || peerVpc.Id == api.DEFAULT_VPC_ID {
+		return input, httperrors.NewInputParameterError("default vpc does not support vpc peering")
+	}
+	if vpc.Id == peerVpc.Id {
+		return input, httperrors.NewInputParameterError("cannot peer vpc %s with itself", vpc.Name)
+	}
+	if vpc.CloudregionId != peerVpc.CloudregionId {
+		return input, httperrors.NewNotSupportedError("cross region vpc peering is not supported")
+	}
+	// there is no acceptance by the peer side, so only vpcs of the domain of
+	// requester can be peered, unless requester is sysadmin
+	if db.IsAdminAllowCreate(userCred, models.VpcPeeringConnectionManager).Result.IsDeny() {
+		domainId := userCred.GetProjectDomainId()
+		if vpc.DomainId != domainId || peerVpc.DomainId != domainId {
+			return input, httperrors.NewForbiddenError("only sysadmin can peer vpcs of other domains")
+		}
+	}
+	err := models.ValidateVpcPeeringCidrOverlap(vpc, peerVpc)
+	if err != nil {
+		return input, err
+	}
+	vpcPeers, err := vpc.GetPeeredVpcs()
+	if err != nil {
+		return input, httperrors.NewGeneralError(errors.Wrapf(err, "GetPeeredVpcs of vpc %s", vpc.Name))
+	}
+	peerVpcPeers, err := peerVpc.GetPeeredVpcs()
+	if err != nil {
+		return input, httperrors.NewGeneralError(errors.Wrapf(err, "GetPeeredVpcs of vpc %s", peerVpc.Name))
+	}
+	err = models.ValidateVpcPeeringCidrOverlapWithPeers(vpc, peerVpc, vpcPeers, peerVpcPeers)
+	if err != nil {
+		return input, err
+	}
+	// the ovn transit switch is shared by both directions
+	q := models.VpcPeeringConnectionManager.Query()
+	q = q.Filter(sqlchemy.OR(
+		sqlchemy.AND(sqlchemy.Equals(q.Field("vpc_id"), vpc.Id), sqlchemy.Equals(q.Field("peer_vpc_id"), peerVpc.Id)),
+		sqlchemy.AND(sqlchemy.Equals(q.Field("vpc_id"), peerVpc.Id), sqlchemy.Equals(q.Field("peer_vpc_id"), vpc.Id)),
+	))
+	cnt, err := q.CountWithError()
+	if err != nil {
+		return input, httperrors.NewGeneralError(err)
+	}
+	if cnt > 0 {
+		return input, httperrors.NewDuplicateResourceError("vpc %s and vpc %s have already connected", vpc.Name, peerVpc.Name)
+	}
+	return input, nil
+}
+
+func (self *SKVMRegionDriver) RequestCreateVpcPeeringConnection(ctx context.Context, userCred mcclient.TokenCredential, peer *models.SVpcPeeringConnection, task taskman.ITask) error {
+	err := peer.AllocTransitIndex(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "AllocTransitIndex")
+	}
+	err = peer.SetStatus(ctx, userCred, api.VPC_PEERING_CONNECTION_STATUS_ACTIVE, "")
+	if err != nil {
+		return errors.Wrapf(err, "SetStatus")
+	}
+	task.ScheduleRun(nil)
+	return nil
+}
+
+func (self *SKVMRegionDriver) RequestDeleteVpcPeeringConnection(ctx context.Context, userCred mcclient.TokenCredential, peer *models.SVpcPeeringConnection, task taskman.ITask) error {
+	task.ScheduleRun(nil)
+	return nil
+}
+
 func (self *SKVMRegionDriver) GetEipDefaultChargeType() string {
 	return api.EIP_CHARGE_TYPE_BY_BANDWIDTH
 }
@@ -671,6 +749,9 @@ func (self *SKVMRegionDriver) RequestDeleteInstanceBackup(ctx context.Context, i
 	}
 	if len(backups) == 0 {
 		task.SetStage("OnInstanceBackupDelete", nil)
+		if vtpmBackupId := ib.GetVtpmBackupId(ctx); len(vtpmBackupId) > 0 {
+			return self.requestDeleteVtpmBackup(ctx, ib, vtpmBackupId, task)
+		}
 		taskman.LocalTaskRun(task, func() (jsonutils.JSONObject, error) {
 			return nil, nil
 		})
@@ -687,6 +768,28 @@ func (self *SKVMRegionDriver) RequestDeleteInstanceBackup(ctx context.Context, i
 	return nil
 }
 
+func (self *SKVMRegionDriver) requestDeleteVtpmBackup(ctx context.Context, ib *models.SInstanceBackup, backupId string, task taskman.ITask) error {
+	backupStorage, err := ib.GetBackupStorage()
+	if err != nil {
+		return errors.Wrap(err, "unable to get backupStorage")
+	}
+	host, err := models.HostManager.GetEnabledKvmHostForBackupStorage(backupStorage)
+	if err != nil {
+		return errors.Wrap(err, "GetEnabledKvmHostForBackupStorage")
+	}
+	accessInfo, err := backupStorage.GetAccessInfo()
+	if err != nil {
+		return errors.Wrap(err, "GetAccessInfo")
+	}
+	url := fmt.Sprintf("%s/storages/delete-backup", host.ManagerUri)
+	body := jsonutils.NewDict()
+	body.Set("backup_id", jsonutils.NewString(backupId))
+	body.Set("backup_storage_id", jsonutils.NewString(backupStorage.GetId()))
+	body.Set("backup_storage_access_info", jsonutils.Marshal(accessInfo))
+	_, _, err = httputils.JSONRequest(httputils.GetDefaultClient(), ctx, "POST", url, task.GetTaskRequestHeader(), body, false)
+	return errors.Wrap(err, "request delete vtpm backup")
+}
+
 func (self *SKVMRegionDriver) RequestResetToInstanceSnapshot(ctx context.Context, guest *models.SGuest, isp *models.SInstanceSnapshot, task taskman.ITask, params *jsonutils.JSONDict) error {
 	jIsps, err := isp.GetInstanceSnapshotJointsByOrder(guest)
 	if err != nil {
@@ -699,6 +802,11 @@ func (self *SKVMRegionDriver) RequestResetToInstanceSnapshot(ctx context.Context
 	diskIndex := int(diskIndexI64)
 	if diskIndex >= len(jIsps) {
 		task.SetStage("OnInstanceSnapshotReset", nil)
+		if guest.Vtpm {
+			if err := isp.ResetVtpmState(ctx, task.GetUserCred(), guest); err != nil {
+				return errors.Wrap(err, "ResetVtpmState")
+			}
+		}
 		withMem := jsonutils.QueryBoolean(params, "with_memory", false)
 		if isp.WithMemory && withMem {
 			// reset do memory snapshot
@@ -765,6 +873,11 @@ func (self *SKVMRegionDriver) RequestCreateInstanceSnapshot(ctx context.Context,
 	diskIndex := int(diskIndexI64)
 	if diskIndex >= len(disks) {
 		task.SetStage("OnInstanceSnapshot", nil)
+		if guest.Vtpm {
+			if err := isp.SaveVtpmState(ctx, task.GetUserCred(), guest); err != nil {
+				return errors.Wrap(err, "SaveVtpmState")
+			}
+		}
 		if isp.WithMemory {
 			// request do memory snapshot
 			host, err := guest.GetHost()
@@ -896,6 +1009,11 @@ func (self *SKVMRegionDriver) RequestSyncDiskStatus(ctx context.Context, userCre
 
 func (self *SKVMRegionDriver) RequestCreateInstanceBackup(ctx context.Context, guest *models.SGuest, ib *models.SInstanceBackup, task taskman.ITask, params *jsonutils.JSONDict) error {
 	disks, _ := guest.GetGuestDisks()
+	if guest.Vtpm {
+		if err := ib.SaveVtpmState(ctx, task.GetUserCred(), guest); err != nil {
+			return errors.Wrap(err, "SaveVtpmState")
+		}
+	}
 	task.SetStage("OnKvmDisksSnapshot", params)
 	for i := range disks {
 		disk := disks[i]
@@ -963,6 +1081,9 @@ func (self *SKVMRegionDriver) RequestPackInstanceBackup(ctx context.Context, ib
 	}
 	body.Set("backup_storage_access_info", jsonutils.Marshal(accessInfo))
 	body.Set("backup_ids", jsonutils.Marshal(backupIds))
+	if vtpmBackupId := ib.GetVtpmBackupId(ctx); len(vtpmBackupId) > 0 {
+		body.Set("vtpm_backup_id", jsonutils.NewString(vtpmBackupId))
+	}
 	body.Set("metadata", jsonutils.Marshal(metadata))
 	header := task.GetTaskRequestHeader()
 	_, _, err = httputils.JSONRequest(httputils.GetDefaultClient(), ctx, "POST", url, header, body, false)
@@ -1029,6 +1150,38 @@ func (self *SKVMRegionDriver) RequestSyncBackupStorageStatus(ctx context.Context
 	return nil
 }
 
+func (self *SKVMRegionDriver) RequestVerifyBackupStorage(ctx context.Context, userCred mcclient.TokenCredential, bs *models.SBackupStorage, input api.BackupStorageVerifyInput, task taskman.ITask) error {
+	body := jsonutils.NewDict()
+	body.Set("check_data", jsonutils.NewBool(input.CheckData))
+	return self.requestBackupRepository(ctx, bs, "verify-backup-storage", body, task)
+}
+
+func (self *SKVMRegionDriver) RequestGcBackupStorage(ctx context.Context, userCred mcclient.TokenCredential, bs *models.SBackupStorage, input api.BackupStorageGcInput, task taskman.ITask) error {
+	body := jsonutils.NewDict()
+	body.Set("dry_run", jsonutils.NewBool(input.DryRun))
+	return self.requestBackupRepository(ctx, bs, "gc-backup-storage", body, task)
+}
+
+func (self *SKVMRegionDriver) requestBackupRepository(ctx context.Context, bs *models.SBackupStorage, action string, body *jsonutils.JSONDict, task taskman.ITask) error {
+	host, err := models.HostManager.GetEnabledKvmHostForBackupStorage(bs)
+	if err != nil {
+		return errors.Wrap(err, "GetEnabledKvmHostForBackupStorage")
+	}
+	url := fmt.Sprintf("%s/storages/%s", host.ManagerUri, action)
+	body.Set("backup_storage_id", jsonutils.NewString(bs.GetId()))
+	accessInfo, err := bs.GetAccessInfo()
+	if err != nil {
+		return errors.Wrap(err, "GetAccessInfo")
+	}
+	body.Set("backup_storage_access_info", jsonutils.Marshal(accessInfo))
+	header := task.GetTaskRequestHeader()
+	_, _, err = httputils.JSONRequest(httputils.GetDefaultClient(), ctx, "POST", url, header, body, false)
+	if err != nil {
+		return errors.Wrapf(err, "request %s", action)
+	}
+	return nil
+}
+
 func (self *SKVMRegionDriver) RequestSyncInstanceBackupStatus(ctx context.Context, userCred mcclient.TokenCredential, ib *models.SInstanceBackup, task taskman.ITask) error {
 	originStatus, _ := task.GetParams().GetString("origin_status")
 	if utils.IsInStringArray(originStatus, []string{
@@ -1149,8 +1302,146 @@ func (self *SKVMRegionDriver) RequestSyncSnapshotStatus(ctx context.Context, use
 	return nil
 }
 
+func (self *SKVMRegionDriver) IsSupportedNatGateway() bool {
+	return true
+}
+
+func (self *SKVMRegionDriver) IsSupportedNatAutoRenew() bool {
+	return false
+}
+
+func (self *SKVMRegionDriver) ValidateCreateNatGateway(ctx context.Context, userCred mcclient.TokenCredential, input api.NatgatewayCreateInput) (api.NatgatewayCreateInput, error) {
+	if input.VpcId == api.DEFAULT_VPC_ID {
+		return input, httperrors.NewInputParameterError("nat gateway is not supported in default vpc")
+	}
+	if input.BillingType == billing_api.BILLING_TYPE_PREPAID {
+		return input, httperrors.NewInputParameterError("nat gateway of onecloud vpc does not support prepaid billing")
+	}
+	// ovn logical router supports only one distributed gateway port
+	cnt, err := models.NatGatewayManager.Query().Equals("vpc_id", input.VpcId).CountWithError()
+	if err != nil {
+		return input, httperrors.NewGeneralError(errors.Wrapf(err, "count nat gateways of vpc %s", input.VpcId))
+	}
+	if cnt > 0 {
+		return input, httperrors.NewConflictError("vpc %s already has a nat gateway", input.VpcId)
+	}
+	if len(input.Eip) > 0 {
+		_eip, err := models.ElasticipManager.FetchById(input.Eip)
+		if err != nil {
+			return input, httperrors.NewGeneralError(errors.Wrapf(err, "fetch eip %s", input.Eip))
+		}
+		eip := _eip.(*models.SElasticip)
+		if len(eip.ManagerId) > 0 {
+			return input, httperrors.NewInputParameterError("eip %s is not an onecloud eip", eip.Name)
+		}
+	}
+	return input, nil
+}
+
+func (self *SKVMRegionDriver) RequestCreateNatGateway(ctx context.Context, userCred mcclient.TokenCredential, nat *models.SNatGateway, task taskman.ITask) error {
+	// logical router nat rules are programmed by vpcagent
+	return task.ScheduleRun(nil)
+}
+
+// RequestSyncNatGatewayStatus checks what vpcagent needs to program the nat
+// gateway: an available vpc, eips from a single network and entries using
+// eips bound to the gateway
+func (self *SKVMRegionDriver) RequestSyncNatGatewayStatus(ctx context.Context, userCred mcclient.TokenCredential, nat *models.SNatGateway, task taskman.ITask) error {
+	taskman.LocalTaskRun(task, func() (jsonutils.JSONObject, error) {
+		reason, err := self.checkNatGateway(nat)
+		if err != nil {
+			return nil, err
+		}
+		if len(reason) > 0 {
+			return nil, nat.SetStatus(ctx, userCred, api.NAT_STATUS_UNKNOWN, reason)
+		}
+		return nil, nat.SetStatus(ctx, userCred, api.NAT_STAUTS_AVAILABLE, "syncstatus")
+	})
+	return nil
+}
+
+// checkNatGateway returns why the nat gateway cannot be programmed, or an
+// empty string when it can
+func (self *SKVMRegionDriver) checkNatGateway(nat *models.SNatGateway) (string, error) {
+	vpc, err := nat.GetVpc()
+	if err != nil {
+		return "", errors.Wrapf(err, "GetVpc")
+	}
+	if vpc.Status != api.VPC_STATUS_AVAILABLE {
+		return fmt.Sprintf("vpc %s is %s", vpc.Name, vpc.Status), nil
+	}
+	eips, err := nat.GetEips()
+	if err != nil {
+		return "", errors.Wrapf(err, "GetEips")
+	}
+	eipIps := map[string]bool{}
+	for i := range eips {
+		if eips[i].NetworkId != eips[0].NetworkId {
+			return fmt.Sprintf("eip %s is not in the same network as eip %s", eips[i].Name, eips[0].Name), nil
+		}
+		eipIps[eips[i].IpAddr] = true
+	}
+	stable, err := nat.GetSTable()
+	if err != nil {
+		return "", errors.Wrapf(err, "GetSTable")
+	}
+	for i := range stable {
+		if !eipIps[stable[i].IP] {
+			return fmt.Sprintf("eip %s of snat entry %s is not bound to the nat gateway", stable[i].IP, stable[i].Name), nil
+		}
+	}
+	dtable, err := nat.GetDTable()
+	if err != nil {
+		return "", errors.Wrapf(err, "GetDTable")
+	}
+	for i := range dtable {
+		if !eipIps[dtable[i].ExternalIP] {
+			return fmt.Sprintf("eip %s of dnat entry %s is not bound to the nat gateway", dtable[i].ExternalIP, dtable[i].Name), nil
+		}
+	}
+	return "", nil
+}
+
+// validateNatEip makes sure all eips of a nat gateway come from the same
+// external network, which is attached to the gateway router port
+func (self *SKVMRegionDriver) validateNatEip(nat *models.SNatGateway, eip *models.SElasticip) error {
+	if len(eip.ManagerId) > 0 {
+		return errors.Wrapf(cloudprovider.ErrNotSupported, "eip %s is not an onecloud eip", eip.Name)
+	}
+	eips, err := nat.GetEips()
+	if err != nil {
+		return errors.Wrapf(err, "nat.GetEips")
+	}
+	for i := range eips {
+		if eips[i].Id != eip.Id && eips[i].NetworkId != eip.NetworkId {
+			return httperrors.NewInputParameterError("eip %s is not in the same network as eip %s of nat gateway %s", eip.Name, eips[i].Name, nat.Name)
+		}
+	}
+	return nil
+}
+
 func (self *SKVMRegionDriver) RequestAssociateEipForNAT(ctx context.Context, userCred mcclient.TokenCredential, nat *models.SNatGateway, eip *models.SElasticip, task taskman.ITask) error {
-	return errors.Wrapf(cloudprovider.ErrNotSupported, "RequestAssociateEipForNAT")
+	if err := self.validateNatEip(nat, eip); err != nil {
+		return err
+	}
+	if err := eip.AssociateNatGateway(ctx, userCred, nat); err != nil {
+		return errors.Wrapf(err, "AssociateNatGateway")
+	}
+	if err := eip.SetStatus(ctx, userCred, api.EIP_STATUS_READY, api.EIP_STATUS_ASSOCIATE); err != nil {
+		return errors.Wrapf(err, "set eip status to %s", api.EIP_STATUS_READY)
+	}
+	return task.ScheduleRun(nil)
+}
+
+func (self *SKVMRegionDriver) RequestCreateNatSEntry(ctx context.Context, userCred mcclient.TokenCredential, nat *models.SNatGateway, snat *models.SNatSEntry) error {
+	return nil
+}
+
+func (self *SKVMRegionDriver) RequestCreateNatDEntry(ctx context.Context, userCred mcclient.TokenCredential, nat *models.SNatGateway, dnat *models.SNatDEntry) error {
+	if !utils.IsInStringArray(dnat.IpProtocol, []string{"tcp", "udp"}) {
+		return errors.Wrapf(cloudprovider.ErrNotSupported, "ip protocol %s", dnat.IpProtocol)
+	}
+	return nil
 }
 
 func (self *SKVMRegionDriver) ValidateCacheSecgroup(ctx context.Context, userCred mcclient.TokenCredential, secgroup *models.SSecurityGroup, vpc *models.SVpc, classic bool) error {
@@ -1367,8 +1658,83 @@ func (self *SKVMRegionDriver) RequestCreateBackup(ctx context.Context, backup *m
 	return nil
 }
 
+func (self *SKVMRegionDriver) RequestCreateBackupByDirtyBitmap(ctx context.Context, backup *models.SDiskBackup, task taskman.ITask) error {
+	backupStorage, err := backup.GetBackupStorage()
+	if err != nil {
+		return errors.Wrap(err, "unable to get backupStorage")
+	}
+	disk, err := backup.GetDisk()
+	if err != nil {
+		return errors.Wrap(err, "unable to get disk")
+	}
+	guest := disk.GetGuest()
+	if guest == nil {
+		return errors.Wrapf(errors.ErrNotFound, "guest of disk %s", disk.Id)
+	}
+	host, err := guest.GetHost()
+	if err != nil {
+		return errors.Wrap(err, "GetHost")
+	}
+	url := fmt.Sprintf("%s/servers/%s/disk-backup", host.ManagerUri, guest.Id)
+	body := jsonutils.NewDict()
+	body.Set("disk_id", jsonutils.NewString(disk.Id))
+	body.Set("backup_id", jsonutils.NewString(backup.GetId()))
+	body.Set("backup_storage_id", jsonutils.NewString(backupStorage.GetId()))
+	accessInfo, err := backupStorage.GetAccessInfo()
+	if err != nil {
+		return errors.Wrap(err, "GetAccessInfo")
+	}
+	body.Set("backup_storage_access_info", jsonutils.Marshal(accessInfo))
+	readBitmap, keepBitmap, err := backup.GetChainDirtyBitmaps(ctx)
+	if err != nil {
+		return errors.Wrap(err, "GetChainDirtyBitmaps")
+	}
+	body.Set("backup_mode", jsonutils.NewString(backup.BackupMode))
+	body.Set("dirty_bitmap", jsonutils.NewString(readBitmap))
+	body.Set("new_dirty_bitmap", jsonutils.NewString(backup.GetNewDirtyBitmap()))
+	body.Set("keep_dirty_bitmap", jsonutils.NewString(keepBitmap))
+	header := task.GetTaskRequestHeader()
+	_, _, err = httputils.JSONRequest(httputils.GetDefaultClient(), ctx, "POST", url, header, body, false)
+	if err != nil {
+		return errors.Wrap(err, "unable to backup")
+	}
+	return nil
+}
+
+func (self *SKVMRegionDriver) RequestConsolidateBackup(ctx context.Context, backup *models.SDiskBackup, chain []string, task taskman.ITask) error {
+	backupStorage, err := backup.GetBackupStorage()
+	if err != nil {
+		return errors.Wrap(err, "unable to get backupStorage")
+	}
+	host, err := models.HostManager.GetEnabledKvmHostForDiskBackup(backup)
+	if err != nil {
+		return errors.Wrap(err, "GetEnabledKvmHostForDiskBackup")
+	}
+	url := fmt.Sprintf("%s/storages/consolidate-backup", host.ManagerUri)
+	body := jsonutils.NewDict()
+	body.Set("backup_id", jsonutils.NewString(backup.GetId()))
+	body.Set("backup_chain", jsonutils.NewStringArray(chain))
+	body.Set("backup_storage_id", jsonutils.NewString(backupStorage.GetId()))
+	accessInfo, err := backupStorage.GetAccessInfo()
+	if err != nil {
+		return errors.Wrap(err, "GetAccessInfo")
+	}
+	body.Set("backup_storage_access_info", jsonutils.Marshal(accessInfo))
+	header := task.GetTaskRequestHeader()
+	_, _, err = httputils.JSONRequest(httputils.GetDefaultClient(), ctx, "POST", url, header, body, false)
+	if err != nil {
+		return errors.Wrap(err, "unable to consolidate backup")
+	}
+	return nil
+}
+
 func (self *SKVMRegionDriver) RequestAssociateEip(ctx context.Context, userCred mcclient.TokenCredential, eip *models.SElasticip, input api.ElasticipAssociateInput, obj db.IStatusStandaloneModel, task taskman.ITask) error {
 	taskman.LocalTaskRun(task, func() (jsonutils.JSONObject, error) {
+		if nat, ok := obj.(*models.SNatGateway); ok {
+			if err := self.validateNatEip(nat, eip); err != nil {
+				return nil, err
+			}
+		}
 		if err := eip.AssociateInstance(ctx, userCred, input.InstanceType, obj); err != nil {
 			return nil, errors.Wrapf(err, "associate eip %s(%s) to %s %s(%s)", eip.Name, eip.Id, obj.Keyword(), obj.GetName(), obj.GetId())
 		}
@@ -1388,6 +1754,8 @@ func (self *SKVMRegionDriver) RequestAssociateEip(ctx context.Context, userCred
 			if err != nil {
 				return nil, err
 			}
+		case api.EIP_ASSOCIATE_TYPE_NAT_GATEWAY:
+			// nat rules are programmed by vpcagent
 		default:
 			return nil, errors.Wrapf(cloudprovider.ErrNotSupported, "instance type %s", input.InstanceType)
 		}
@@ -1529,8 +1897,10 @@ func (self *SKVMRegionDriver) RequestCreateSecurityGroup(
 			CIDR:        r.CIDR,
 			Action:      r.Action,
 			Description: r.Description,
+			AclLog:      r.AclLog,
 		}
 		rule.SecgroupId = secgroup.Id
+		rule.PeerSecgroupId = r.PeerSecgroupId
 		models.SecurityGroupRuleManager.TableSpec().Insert(ctx, rule)
 	}
 	secgroup.SetStatus(ctx, userCred, api.SECGROUP_STATUS_READY, "")
@@ -1186,6 +1186,223 @@ func (self *SManagedVirtualizationRegionDriver) RequestAssociateEipForNAT(ctx co
 	return eip.StartEipAssociateTask(ctx, userCred, jsonutils.Marshal(opts).(*jsonutils.JSONDict), task.GetTaskId())
 }
 
+func (self *SManagedVirtualizationRegionDriver) RequestCreateVpcPeeringConnection(ctx context.Context, userCred mcclient.TokenCredential, peer *models.SVpcPeeringConnection, task taskman.ITask) error {
+	taskman.LocalTaskRun(task, func() (jsonutils.JSONObject, error) {
+		vpc, err := peer.GetVpc()
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetVpc")
+		}
+
+		peerVpc, err := peer.GetPeerVpc()
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetPeerVpc")
+		}
+
+		iVpc, err := vpc.GetIVpc(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetIVpc")
+		}
+
+		iPeerVpc, err := peerVpc.GetIVpc(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetIVpc")
+		}
+
+		opts := &cloudprovider.VpcPeeringConnectionCreateOptions{
+			Name:          peer.Name,
+			Desc:          peer.Description,
+			Bandwidth:     peer.Bandwidth,
+			PeerVpcId:     iPeerVpc.GetId(),
+			PeerRegionId:  iPeerVpc.GetRegion().GetId(),
+			PeerAccountId: iPeerVpc.GetAuthorityOwnerId(),
+		}
+		iPeerConnection, err := iVpc.CreateICloudVpcPeeringConnection(opts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "CreateICloudVpcPeeringConnection")
+		}
+		err = iPeerVpc.AcceptICloudVpcPeeringConnection(iPeerConnection.GetGlobalId())
+		if err != nil {
+			return nil, errors.Wrapf(err, "AcceptICloudVpcPeeringConnection")
+		}
+
+		iPeerConnection.Refresh()
+		err = peer.SyncWithCloudPeerConnection(ctx, userCred, iPeerConnection)
+		if err != nil {
+			return nil, errors.Wrapf(err, "SyncWithCloudPeerConnection")
+		}
+		return nil, nil
+	})
+	return nil
+}
+
+func (self *SManagedVirtualizationRegionDriver) RequestDeleteVpcPeeringConnection(ctx context.Context, userCred mcclient.TokenCredential, peer *models.SVpcPeeringConnection, task taskman.ITask) error {
+	taskman.LocalTaskRun(task, func() (jsonutils.JSONObject, error) {
+		if len(peer.ExternalId) == 0 {
+			return nil, nil
+		}
+
+		vpc, err := peer.GetVpc()
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetVpc")
+		}
+
+		iVpc, err := vpc.GetIVpc(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetIVpc")
+		}
+
+		iPeer, err := iVpc.GetICloudVpcPeeringConnectionById(peer.ExternalId)
+		if err != nil {
+			if errors.Cause(err) != cloudprovider.ErrNotFound {
+				return nil, errors.Wrapf(err, "GetICloudVpcPeeringConnectionById(%s)", peer.ExternalId)
+			}
+			return nil, nil
+		}
+
+		err = iPeer.Delete()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Delete")
+		}
+		return nil, nil
+	})
+	return nil
+}
+
+func (self *SManagedVirtualizationRegionDriver) RequestCreateNatGateway(ctx context.Context, userCred mcclient.TokenCredential, nat *models.SNatGateway, task taskman.ITask) error {
+	opts := cloudprovider.NatGatewayCreateOptions{
+		Name:    nat.Name,
+		Desc:    nat.Description,
+		NatSpec: nat.NatSpec,
+	}
+
+	vpc, err := nat.GetVpc()
+	if err != nil {
+		return errors.Wrapf(err, "nat.GetVpc")
+	}
+
+	opts.VpcId = vpc.ExternalId
+
+	if len(nat.NetworkId) > 0 {
+		_network, err := models.NetworkManager.FetchById(nat.NetworkId)
+		if err != nil {
+			return errors.Wrapf(err, "NetworkManager.FetchById(%s)", nat.NetworkId)
+		}
+		network := _network.(*models.SNetwork)
+		opts.NetworkId = network.ExternalId
+	}
+
+	if nat.BillingType == billing_api.BILLING_TYPE_PREPAID {
+		bc, err := billing.ParseBillingCycle(nat.BillingCycle)
+		if err != nil {
+			return errors.Wrapf(err, "ParseBillingCycle(%s)", nat.BillingCycle)
+		}
+		bc.AutoRenew = nat.AutoRenew
+		opts.BillingCycle = &bc
+	}
+
+	taskman.LocalTaskRun(task, func() (jsonutils.JSONObject, error) {
+		iVpc, err := vpc.GetIVpc(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "vpc.GetIVpc")
+		}
+
+		iNat, err := iVpc.CreateINatGateway(&opts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "iVpc.CreateINatGateway")
+		}
+		err = db.SetExternalId(nat, userCred, iNat.GetGlobalId())
+		if err != nil {
+			return nil, errors.Wrapf(err, "db.SetExternalId")
+		}
+
+		err = cloudprovider.WaitStatus(iNat, api.NAT_STAUTS_AVAILABLE, time.Second*5, time.Minute*10)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cloudprovider.WaitStatus")
+		}
+
+		nat.SyncWithCloudNatGateway(ctx, userCred, nat.GetCloudprovider(), iNat)
+		return nil, nil
+	})
+	return nil
+}
+
+func (self *SManagedVirtualizationRegionDriver) RequestCreateNatSEntry(ctx context.Context, userCred mcclient.TokenCredential, nat *models.SNatGateway, snat *models.SNatSEntry) error {
+	iNat, err := nat.GetINatGateway(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "nat.GetINatGateway")
+	}
+
+	eip, err := snat.GetEip()
+	if err != nil {
+		return errors.Wrapf(err, "snat.GetEip")
+	}
+
+	rule := cloudprovider.SNatSRule{
+		ExternalIP:   snat.IP,
+		ExternalIPID: eip.ExternalId,
+	}
+	if len(snat.SourceCIDR) > 0 {
+		rule.SourceCIDR = snat.SourceCIDR
+	} else {
+		network, err := snat.GetNetwork()
+		if err != nil {
+			return errors.Wrapf(err, "snat.GetNetwork")
+		}
+		rule.NetworkID = network.ExternalId
+	}
+	iSnat, err := iNat.CreateINatSEntry(rule)
+	if err != nil {
+		return errors.Wrapf(err, "CreateINatSEntry")
+	}
+
+	err = db.SetExternalId(snat, userCred, iSnat.GetGlobalId())
+	if err != nil {
+		return errors.Wrapf(err, "db.SetExternalId(%s)", iSnat.GetGlobalId())
+	}
+
+	err = cloudprovider.WaitStatus(iSnat, api.NAT_STAUTS_AVAILABLE, 10*time.Second, 5*time.Minute)
+	if err != nil {
+		return errors.Wrapf(err, "cloudprovider.WaitStatus(iSnat)")
+	}
+	return nil
+}
+
+func (self *SManagedVirtualizationRegionDriver) RequestCreateNatDEntry(ctx context.Context, userCred mcclient.TokenCredential, nat *models.SNatGateway, dnat *models.SNatDEntry) error {
+	iNat, err := nat.GetINatGateway(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "nat.GetINatGateway")
+	}
+
+	eip, err := dnat.GetEip()
+	if err != nil {
+		return errors.Wrapf(err, "dnat.GetEip")
+	}
+
+	rule := cloudprovider.SNatDRule{
+		Protocol:     dnat.IpProtocol,
+		InternalIP:   dnat.InternalIP,
+		InternalPort: dnat.InternalPort,
+		ExternalIP:   dnat.ExternalIP,
+		ExternalPort: dnat.ExternalPort,
+		ExternalIPID: eip.ExternalId,
+	}
+	iDnat, err := iNat.CreateINatDEntry(rule)
+	if err != nil {
+		return errors.Wrapf(err, "iNat.CreateINatDEntry")
+	}
+
+	err = db.SetExternalId(dnat, userCred, iDnat.GetGlobalId())
+	if err != nil {
+		return errors.Wrapf(err, "db.SetExternalId(%s)", iDnat.GetGlobalId())
+	}
+
+	err = cloudprovider.WaitStatus(iDnat, api.NAT_STAUTS_AVAILABLE, 10*time.Second, 5*time.Minute)
+	if err != nil {
+		return errors.Wrapf(err, "cloudprovider.WaitStatus")
+	}
+	return nil
+}
+
 func (self *SManagedVirtualizationRegionDriver) RequestCreateDBInstance(ctx context.Context, userCred mcclient.TokenCredential, dbinstance *models.SDBInstance, task taskman.ITask) error {
 	taskman.LocalTaskRun(task, func() (jsonutils.JSONObject, error) {
 		iregion, err := dbinstance.GetIRegion(ctx)
@@ -67,6 +67,7 @@ func InitHandlers(app *appsrv.Application) {
 		db.I18nManager,
 		models.GuestcdromManager,
 		models.GuestFloppyManager,
+		models.GuestFilesystemMountManager,
 		models.NetInterfaceManager,
 		models.NetworkAdditionalWireManager,
 
@@ -132,6 +133,10 @@ func InitHandlers(app *appsrv.Application) {
 		models.NetworkManager,
 		models.NetworkAddressManager,
 		models.NetworkIpMacManager,
+		models.SchedDecisionManager,
+		models.SchedPriorityClassManager,
+		models.SchedPreemptionManager,
+		models.CapacityReservationManager,
 		models.ReservedipManager,
 		models.KeypairManager,
 		models.IsolatedDeviceManager,
@@ -163,6 +163,10 @@ func StartServiceWithJobs(jobs func(cron *cronman.SCronJobManager)) {
 		cron.AddJobAtIntervals("CleanExpiredPostpaidServers", time.Duration(opts.PrepaidExpireCheckSeconds)*time.Second, models.GuestManager.DeleteExpiredPostpaidServers)
 		cron.AddJobAtIntervals("CleanExpiredPostpaidNatGateways", time.Duration(opts.PrepaidExpireCheckSeconds)*time.Second, models.NatGatewayManager.DeleteExpiredPostpaids)
 		cron.AddJobAtIntervals("CleanExpiredPostpaidNas", time.Duration(opts.PrepaidExpireCheckSeconds)*time.Second, models.FileSystemManager.DeleteExpiredPostpaids)
+		cron.AddJobAtIntervals("ExpireDiskBackupChainLinks", time.Hour, models.DiskBackupManager.ExpireBackupChainLinks)
+		cron.AddJobAtIntervals("UpdateCapacityReservationStatus", time.Duration(opts.PrepaidExpireCheckSeconds)*time.Second, models.CapacityReservationManager.UpdateReservationStatus)
+
+		cron.AddJobAtIntervalsWithStartRun("CheckTaskStageTimeouts", time.Minute, taskman.TaskManager.CheckStageTimeouts, true)
 
 		cron.AddJobAtIntervals("StartHostPingDetectionTask", time.Duration(opts.HostOfflineDetectionInterval)*time.Second, models.HostManager.PingDetectionTask)
 
@@ -192,6 +196,7 @@ func StartServiceWithJobs(jobs func(cron *cronman.SCronJobManager)) {
 		cron.AddJobEveryFewDays("SyncElasticCacheSkus", opts.SyncSkusDay, opts.SyncSkusHour, 0, 0, models.SyncElasticCacheSkus, true)
 
 		cron.AddJobEveryFewDays("SnapshotDataCleaning", 1, 0, 0, 0, models.SnapshotManager.DataCleaning, true)
+		cron.AddJobEveryFewDays("SchedDecisionCleaning", 1, 1, 0, 0, models.SchedDecisionManager.CleanupExpiredDecisions, true)
 
 		cron.AddJobAtIntervalsWithStartRun("SyncCloudImages", time.Duration(opts.CloudImagesSyncIntervalHours)*time.Hour, models.SyncPublicCloudImages, true)
 
@@ -207,6 +212,7 @@ func StartServiceWithJobs(jobs func(cron *cronman.SCronJobManager)) {
 		go cron.Start2(ctx, electObj)
 	}
 	if !opts.IsSlaveNode {
+		go taskman.TaskManager.RecoverTasks(ctx)
 		go cronFunc()
 	}
 
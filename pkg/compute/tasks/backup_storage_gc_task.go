@@ -0,0 +1,66 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tasks
+
+import (
+	"context"
+
+	"yunion.io/x/jsonutils"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
+	"yunion.io/x/onecloud/pkg/compute/models"
+	"yunion.io/x/onecloud/pkg/util/logclient"
+)
+
+type BackupStorageGcTask struct {
+	taskman.STask
+}
+
+func init() {
+	taskman.RegisterTask(BackupStorageGcTask{})
+}
+
+func (self *BackupStorageGcTask) taskFailed(ctx context.Context, bs *models.SBackupStorage, err jsonutils.JSONObject) {
+	logclient.AddActionLogWithStartable(self, bs, logclient.ACT_GARBAGE_COLLECT, err, self.UserCred, false)
+	self.SetStageFailed(ctx, err)
+}
+
+func (self *BackupStorageGcTask) OnInit(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
+	bs := obj.(*models.SBackupStorage)
+	input := api.BackupStorageGcInput{}
+	self.GetParams().Unmarshal(&input)
+
+	self.SetStage("OnGc", nil)
+	err := bs.GetRegionDriver().RequestGcBackupStorage(ctx, self.GetUserCred(), bs, input, self)
+	if err != nil {
+		self.taskFailed(ctx, bs, jsonutils.NewString(err.Error()))
+	}
+}
+
+func (self *BackupStorageGcTask) OnGc(ctx context.Context, bs *models.SBackupStorage, data jsonutils.JSONObject) {
+	err := bs.SetMetadata(ctx, api.BACKUPSTORAGE_METADATA_REPOSITORY_GC, data.String(), self.UserCred)
+	if err != nil {
+		self.taskFailed(ctx, bs, jsonutils.NewString(err.Error()))
+		return
+	}
+	logclient.AddActionLogWithStartable(self, bs, logclient.ACT_GARBAGE_COLLECT, data, self.UserCred, true)
+	self.SetStageComplete(ctx, nil)
+}
+
+func (self *BackupStorageGcTask) OnGcFailed(ctx context.Context, bs *models.SBackupStorage, data jsonutils.JSONObject) {
+	self.taskFailed(ctx, bs, data)
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tasks
+
+import (
+	"context"
+
+	"yunion.io/x/jsonutils"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
+	"yunion.io/x/onecloud/pkg/compute/models"
+	"yunion.io/x/onecloud/pkg/util/logclient"
+)
+
+type DiskBackupConsolidateTask struct {
+	taskman.STask
+}
+
+func init() {
+	taskman.RegisterTask(DiskBackupConsolidateTask{})
+}
+
+func (self *DiskBackupConsolidateTask) taskFailed(ctx context.Context, backup *models.SDiskBackup, reason jsonutils.JSONObject) {
+	reasonStr, _ := reason.GetString()
+	backup.SetStatus(ctx, self.UserCred, api.BACKUP_STATUS_CONSOLIDATE_FAILED, reasonStr)
+	logclient.AddActionLogWithStartable(self, backup, logclient.ACT_MERGE, reason, self.UserCred, false)
+	self.SetStageFailed(ctx, reason)
+}
+
+func (self *DiskBackupConsolidateTask) OnInit(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
+	backup := obj.(*models.SDiskBackup)
+	chain, err := backup.GetBackupChain()
+	if err != nil {
+		self.taskFailed(ctx, backup, jsonutils.NewString(err.Error()))
+		return
+	}
+	self.SetStage("OnConsolidate", nil)
+	rd, err := backup.GetRegionDriver()
+	if err != nil {
+		self.taskFailed(ctx, backup, jsonutils.NewString(err.Error()))
+		return
+	}
+	err = rd.RequestConsolidateBackup(ctx, backup, chain, self)
+	if err != nil {
+		self.taskFailed(ctx, backup, jsonutils.NewString(err.Error()))
+	}
+}
+
+func (self *DiskBackupConsolidateTask) OnConsolidate(ctx context.Context, backup *models.SDiskBackup, data jsonutils.JSONObject) {
+	sizeMb, _ := data.Int("size_mb")
+	_, err := db.Update(backup, func() error {
+		backup.SizeMb = int(sizeMb)
+		backup.BackupMode = api.DISK_BACKUP_MODE_FULL
+		backup.ParentBackupId = ""
+		return nil
+	})
+	if err != nil {
+		self.taskFailed(ctx, backup, jsonutils.NewString(err.Error()))
+		return
+	}
+	backup.SetStatus(ctx, self.UserCred, api.BACKUP_STATUS_READY, "")
+	logclient.AddActionLogWithStartable(self, backup, logclient.ACT_MERGE, nil, self.UserCred, true)
+	self.SetStageComplete(ctx, nil)
+}
+
+func (self *DiskBackupConsolidateTask) OnConsolidateFailed(ctx context.Context, backup *models.SDiskBackup, data jsonutils.JSONObject) {
+	self.taskFailed(ctx, backup, data)
+}
@@ -71,6 +71,10 @@ func (self *DiskBackupCreateTask) taksSuccess(ctx context.Context, backup *model
 
 func (self *DiskBackupCreateTask) OnInit(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
 	backup := obj.(*models.SDiskBackup)
+	if len(backup.BackupMode) > 0 {
+		self.startDirtyBitmapBackup(ctx, backup)
+		return
+	}
 	if self.Params.Contains("snapshot_id") {
 		self.OnSnapshot(ctx, backup, nil)
 		return
@@ -91,6 +95,28 @@ func (self *DiskBackupCreateTask) OnInit(ctx context.Context, obj db.IStandalone
 	}
 }
 
+// startDirtyBitmapBackup exports the disk of the running guest directly, no
+// snapshot is needed
+func (self *DiskBackupCreateTask) startDirtyBitmapBackup(ctx context.Context, backup *models.SDiskBackup) {
+	err := backup.PrepareBackupChain(ctx)
+	if err != nil {
+		self.taskFailed(ctx, backup, jsonutils.NewString(err.Error()), api.BACKUP_STATUS_CREATE_FAILED)
+		return
+	}
+	backup.SetStatus(ctx, self.UserCred, api.BACKUP_STATUS_SAVING, "")
+	self.SetStage("OnSave", nil)
+	rd, err := backup.GetRegionDriver()
+	if err != nil {
+		self.taskFailed(ctx, backup, jsonutils.NewString(err.Error()), api.BACKUP_STATUS_SAVE_FAILED)
+		return
+	}
+	err = rd.RequestCreateBackupByDirtyBitmap(ctx, backup, self)
+	if err != nil {
+		self.taskFailed(ctx, backup, jsonutils.NewString(err.Error()), api.BACKUP_STATUS_SAVE_FAILED)
+		return
+	}
+}
+
 func (self *DiskBackupCreateTask) OnSnapshot(ctx context.Context, backup *models.SDiskBackup, data jsonutils.JSONObject) {
 	snapshotId, _ := self.Params.GetString("snapshot_id")
 	if self.Params.Contains("only_snapshot") {
@@ -119,6 +145,15 @@ func (self *DiskBackupCreateTask) OnSnapshotFailed(ctx context.Context, backup *
 }
 
 func (self *DiskBackupCreateTask) OnSave(ctx context.Context, backup *models.SDiskBackup, data jsonutils.JSONObject) {
+	if len(backup.BackupMode) > 0 {
+		err := backup.SaveBackupChain(ctx, self.UserCred, data)
+		if err != nil {
+			self.taskFailed(ctx, backup, jsonutils.NewString(err.Error()), api.BACKUP_STATUS_SAVE_FAILED)
+			return
+		}
+		self.taksSuccess(ctx, backup, nil)
+		return
+	}
 	// cleanup snapshot
 	snapshotId, _ := self.Params.GetString("snapshot_id")
 	self.SetStage("OnCleanupSnapshot", nil)
@@ -142,6 +177,10 @@ func (self *DiskBackupCreateTask) OnSave(ctx context.Context, backup *models.SDi
 }
 
 func (self *DiskBackupCreateTask) OnSaveFailed(ctx context.Context, backup *models.SDiskBackup, data jsonutils.JSONObject) {
+	if len(backup.BackupMode) > 0 {
+		self.taskFailed(ctx, backup, data, api.BACKUP_STATUS_SAVE_FAILED)
+		return
+	}
 	snapshotId, _ := self.Params.GetString("snapshot_id")
 	snapshotModel, err := models.SnapshotManager.FetchById(snapshotId)
 	if err != nil {
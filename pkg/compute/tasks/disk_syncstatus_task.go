@@ -36,6 +36,11 @@ func init() {
 	taskman.RegisterTask(DiskSyncstatusTask{})
 }
 
+// GetRecoveryKind syncing status is idempotent, so just do it again
+func (self *DiskSyncstatusTask) GetRecoveryKind(stage string) string {
+	return taskman.TASK_RECOVERY_RESUME
+}
+
 func (self *DiskSyncstatusTask) taskFailed(ctx context.Context, disk *models.SDisk, err error) {
 	disk.SetStatus(ctx, self.GetUserCred(), api.DISK_UNKNOWN, err.Error())
 	self.SetStageFailed(ctx, jsonutils.NewString(err.Error()))
@@ -16,12 +16,17 @@ package tasks
 
 import (
 	"context"
+	"strings"
 
 	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/httputils"
 
+	api "yunion.io/x/onecloud/pkg/apis/compute"
 	"yunion.io/x/onecloud/pkg/cloudcommon/db/quotas"
 	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
 	"yunion.io/x/onecloud/pkg/compute/models"
+	"yunion.io/x/onecloud/pkg/mcclient/auth"
 )
 
 type SGuestBaseTask struct {
@@ -50,3 +55,23 @@ func (self *SGuestBaseTask) finalReleasePendingUsage(ctx context.Context) {
 		quotas.CancelPendingUsage(ctx, self.UserCred, &pendingRegionUsage, &pendingRegionUsage, false) // failure
 	}
 }
+
+// requeryGuestRunning asks the host whether the qemu of the guest is
+// running, the monitor command is answered synchronously by kvm hosts
+func (self *SGuestBaseTask) requeryGuestRunning(ctx context.Context, guest *models.SGuest) (bool, error) {
+	if guest.Hypervisor != api.HYPERVISOR_KVM {
+		return false, errors.Wrapf(errors.ErrNotSupported, "requery guest of hypervisor %s", guest.Hypervisor)
+	}
+	res, err := guest.SendMonitorCommand(ctx, auth.AdminCredential(), &api.ServerMonitorInput{COMMAND: "info status"})
+	if err != nil {
+		if jce, ok := errors.Cause(err).(*httputils.JSONClientError); ok {
+			// the host answers 404 for unknown guests and 400 for stopped ones
+			if jce.Code == 404 || (jce.Code == 400 && strings.Contains(jce.Details, "stopped")) {
+				return false, nil
+			}
+		}
+		return false, errors.Wrap(err, "SendMonitorCommand")
+	}
+	status, _ := res.GetString("results")
+	return strings.Contains(status, "running"), nil
+}
@@ -33,6 +33,15 @@ type GuestDeployTask struct {
 	SGuestBaseTask
 }
 
+// GetRecoveryKind fails the task interrupted while deploying on host, the
+// disks may be half deployed and the deploy has to be requested again
+func (self *GuestDeployTask) GetRecoveryKind(stage string) string {
+	if stage == "OnDeployGuestComplete" {
+		return taskman.TASK_RECOVERY_FAIL
+	}
+	return taskman.TASK_RECOVERY_WAIT
+}
+
 func (self *GuestDeployTask) OnInit(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
 	guest := obj.(*models.SGuest)
 	if !guest.IsNetworkAllocated() {
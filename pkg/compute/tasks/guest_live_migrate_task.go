@@ -18,6 +18,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/log"
@@ -54,6 +55,12 @@ func init() {
 	taskman.RegisterTask(GuestMigrateTask{})
 	taskman.RegisterTask(ManagedGuestMigrateTask{})
 	taskman.RegisterTask(ManagedGuestLiveMigrateTask{})
+
+	// the dest guest is started in incoming mode before the memory is sent,
+	// a hung dest host should not keep the guest in migrating forever
+	taskman.RegisterTaskPolicy(GuestLiveMigrateTask{}, taskman.STaskPolicy{
+		StageTimeouts: map[string]time.Duration{"OnStartDestComplete": 10 * time.Minute},
+	})
 }
 
 func (task *GuestMigrateTask) isLiveMigrate() bool {
@@ -344,6 +351,15 @@ func (task *GuestMigrateTask) OnSrcPrepareComplete(ctx context.Context, guest *m
 		}
 		body.Set("src_desc", srcDesc)
 		body.Set("live_migrate", jsonutils.JSONTrue)
+	} else if guest.Vtpm {
+		// the guest is stopped, copy its TPM state to the target host. A live
+		// migration doesn't need this, qemu carries the state in the stream
+		state, err := guest.ExportVtpmState(ctx, task.UserCred)
+		if err != nil {
+			task.TaskFailed(ctx, guest, jsonutils.NewString(errors.Wrap(err, "export vtpm state").Error()))
+			return
+		}
+		body.Set("vtpm_state", jsonutils.NewString(state))
 	}
 	if jsonutils.QueryBoolean(task.GetParams(), "enable_tls", false) {
 		body.Set("enable_tls", jsonutils.JSONTrue)
@@ -0,0 +1,251 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tasks
+
+import (
+	"context"
+	"fmt"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/cmdline"
+	"yunion.io/x/onecloud/pkg/cloudcommon/consts"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
+	"yunion.io/x/onecloud/pkg/cloudcommon/policy"
+	"yunion.io/x/onecloud/pkg/compute/models"
+	"yunion.io/x/onecloud/pkg/compute/options"
+	"yunion.io/x/onecloud/pkg/mcclient/auth"
+	"yunion.io/x/onecloud/pkg/mcclient/modules/scheduler"
+	"yunion.io/x/onecloud/pkg/util/logclient"
+)
+
+// OnSchedulePreempt asks scheduler for a preemption plan of the guest which
+// has no fitting host, and starts GuestPreemptTask to evict the victims
+// and place the guest again
+func (task *GuestBatchCreateTask) OnSchedulePreempt(ctx context.Context, obj IScheduleModel, reason string, index int) bool {
+	guest := obj.(*models.SGuest)
+	if len(guest.PriorityClassId) == 0 {
+		return false
+	}
+	pc, err := models.SchedPriorityClassManager.FetchGuestPriorityClass(guest.PriorityClassId, guest.ProjectId)
+	if err != nil || pc == nil || !pc.CanPreempt() {
+		return false
+	}
+
+	data := getBatchParamsAtIndex(task, index)
+	schedInput, err := cmdline.FetchScheduleInputByJSON(data)
+	if err != nil {
+		log.Errorf("FetchScheduleInputByJSON for preemption of guest %s: %v", guest.Name, err)
+		return false
+	}
+	schedInput.PriorityClassId = pc.Id
+	// victims are limited to the guests the requester is allowed to stop
+	scope, _ := policy.PolicyManager.AllowScope(task.UserCred, consts.GetServiceType(), models.GuestManager.KeywordPlural(), policy.PolicyActionPerform, "stop")
+	schedInput.PreemptScope = string(scope)
+	s := auth.GetSession(ctx, task.UserCred, options.Options.Region)
+	output, err := scheduler.SchedManager.Preempt(s, schedInput)
+	if err != nil {
+		log.Errorf("preempt for guest %s: %v", guest.Name, err)
+		return false
+	}
+	if len(output.HostId) == 0 {
+		log.Infof("no preemption plan for guest %s: %s", guest.Name, output.Error)
+		return false
+	}
+	for _, victim := range output.Victims {
+		victimGuest := models.GuestManager.FetchGuestById(victim.GuestId)
+		if victimGuest != nil && !models.IsGuestPreemptable(victimGuest, scope, guest.ProjectId, guest.DomainId) {
+			log.Errorf("preemption plan of guest %s contains victim %s out of scope %s", guest.Name, victimGuest.Name, scope)
+			return false
+		}
+	}
+
+	preemption := &models.SSchedPreemption{
+		PreemptorId:     guest.Id,
+		PriorityClassId: pc.Id,
+		Priority:        output.Priority,
+		HostId:          output.HostId,
+		Victims:         output.Victims,
+		DryRun:          schedInput.PreemptDryRun,
+		Status:          api.SCHED_PREEMPTION_STATUS_EVICTING,
+		Reason:          reason,
+	}
+	if preemption.DryRun {
+		preemption.Status = api.SCHED_PREEMPTION_STATUS_DRY_RUN
+	}
+	err = models.SchedPreemptionManager.Record(ctx, preemption)
+	if err != nil {
+		log.Errorf("record preemption of guest %s: %v", guest.Name, err)
+		return false
+	}
+	if preemption.DryRun {
+		return false
+	}
+
+	input, err := task.GetCreateInput(data)
+	if err != nil {
+		preemption.SetStatus(ctx, task.UserCred, api.SCHED_PREEMPTION_STATUS_FAILED, err.Error())
+		return false
+	}
+	// the share of the guest in the pending usage moves to the preempt task,
+	// which consumes or cancels it instead of this task
+	pendingUsage, pendingRegionUsage := models.GetGuestCreateResourceRequirements(ctx, task.UserCred, *input, guest.GetOwnerId())
+	task.takePendingUsage(&pendingUsage, &pendingRegionUsage)
+
+	params := data.CopyExcludes("data")
+	params.Set("preemption_id", jsonutils.NewString(preemption.Id))
+	params.Set("prefer_host_id", jsonutils.NewString(output.HostId))
+	guest.SetStatus(ctx, task.UserCred, api.VM_PREEMPTING, "")
+	db.OpsLog.LogEvent(guest, db.ACT_ALLOCATING, preemption.Victims, task.UserCred)
+	preemptTask, err := taskman.TaskManager.NewTask(ctx, "GuestPreemptTask", guest, task.UserCred, params, "", "", &pendingUsage, &pendingRegionUsage)
+	if err != nil {
+		task.returnPendingUsage(&pendingUsage, &pendingRegionUsage)
+	} else {
+		err = preemptTask.ScheduleRun(nil)
+	}
+	if err != nil {
+		preemption.SetStatus(ctx, task.UserCred, api.SCHED_PREEMPTION_STATUS_FAILED, err.Error())
+		return false
+	}
+	return true
+}
+
+// takePendingUsage moves at most the given usage out of the pending usage of
+// the task, the usage actually moved is returned in place
+func (task *GuestBatchCreateTask) takePendingUsage(usage *models.SQuota, regionUsage *models.SRegionQuota) {
+	pendingUsage := models.SQuota{}
+	task.GetPendingUsage(&pendingUsage, 0)
+	left := pendingUsage
+	left.Sub(usage)
+	pendingUsage.Sub(&left)
+	task.SetPendingUsage(&left, 0)
+	*usage = pendingUsage
+
+	pendingRegionUsage := models.SRegionQuota{}
+	task.GetPendingUsage(&pendingRegionUsage, 1)
+	regionLeft := pendingRegionUsage
+	regionLeft.Sub(regionUsage)
+	pendingRegionUsage.Sub(&regionLeft)
+	task.SetPendingUsage(&regionLeft, 1)
+	*regionUsage = pendingRegionUsage
+}
+
+// returnPendingUsage puts the usage taken by takePendingUsage back
+func (task *GuestBatchCreateTask) returnPendingUsage(usage *models.SQuota, regionUsage *models.SRegionQuota) {
+	pendingUsage := models.SQuota{}
+	task.GetPendingUsage(&pendingUsage, 0)
+	pendingUsage.Add(usage)
+	task.SetPendingUsage(&pendingUsage, 0)
+
+	pendingRegionUsage := models.SRegionQuota{}
+	task.GetPendingUsage(&pendingRegionUsage, 1)
+	pendingRegionUsage.Add(regionUsage)
+	task.SetPendingUsage(&pendingRegionUsage, 1)
+}
+
+// GuestPreemptTask evicts the victims of a preemption, then schedules the
+// preemptor to the host released by the victims
+type GuestPreemptTask struct {
+	GuestBatchCreateTask
+}
+
+func init() {
+	taskman.RegisterTask(GuestPreemptTask{})
+}
+
+func (task *GuestPreemptTask) getPreemption() (*models.SSchedPreemption, error) {
+	preemptionId, _ := task.GetParams().GetString("preemption_id")
+	obj, err := models.SchedPreemptionManager.FetchById(preemptionId)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetch preemption %s", preemptionId)
+	}
+	return obj.(*models.SSchedPreemption), nil
+}
+
+func (task *GuestPreemptTask) setPreemptionStatus(ctx context.Context, status string, reason string) {
+	preemption, err := task.getPreemption()
+	if err != nil {
+		log.Errorf("getPreemption: %v", err)
+		return
+	}
+	preemption.SetStatus(ctx, task.UserCred, status, reason)
+}
+
+// OnSchedulePreempt disables nested preemption
+func (task *GuestPreemptTask) OnSchedulePreempt(ctx context.Context, obj IScheduleModel, reason string, index int) bool {
+	return false
+}
+
+func (task *GuestPreemptTask) OnInit(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
+	guest := obj.(*models.SGuest)
+	preemption, err := task.getPreemption()
+	if err != nil {
+		task.OnVictimsEvictedFailed(ctx, guest, jsonutils.NewString(err.Error()))
+		return
+	}
+
+	task.SetStage("OnVictimsEvicted", nil)
+	evicting := 0
+	for _, victim := range preemption.Victims {
+		victimGuest := models.GuestManager.FetchGuestById(victim.GuestId)
+		if victimGuest == nil || victimGuest.HostId != preemption.HostId || victimGuest.Status != api.VM_RUNNING {
+			continue
+		}
+		switch victim.Action {
+		case api.PREEMPT_VICTIM_ACTION_MIGRATE:
+			err = victimGuest.StartGuestLiveMigrateTask(ctx, task.UserCred, victimGuest.Status, "", nil, nil, nil, nil, nil, nil, task.GetId())
+		default:
+			err = victimGuest.StartGuestStopTask(ctx, task.UserCred, 0, true, false, task.GetId())
+		}
+		if err != nil {
+			task.OnVictimsEvictedFailed(ctx, guest, jsonutils.NewString(fmt.Sprintf("evict %s: %s", victimGuest.Name, err)))
+			return
+		}
+		logclient.AddActionLogWithStartable(task, victimGuest, logclient.ACT_ALLOCATE, fmt.Sprintf("preempted by %s", guest.Name), task.UserCred, true)
+		evicting += 1
+	}
+	if evicting == 0 {
+		task.OnVictimsEvicted(ctx, guest, nil)
+	}
+}
+
+func (task *GuestPreemptTask) OnVictimsEvicted(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
+	StartScheduleObjects(ctx, task, []db.IStandaloneModel{guest})
+}
+
+func (task *GuestPreemptTask) OnVictimsEvictedFailed(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
+	task.setPreemptionStatus(ctx, api.SCHED_PREEMPTION_STATUS_FAILED, data.String())
+	guest.SetStatus(ctx, task.UserCred, api.VM_SCHEDULE_FAILED, data.String())
+	task.SetStageFailed(ctx, data)
+}
+
+func (task *GuestPreemptTask) OnScheduleFailed(ctx context.Context, reason jsonutils.JSONObject) {
+	task.setPreemptionStatus(ctx, api.SCHED_PREEMPTION_STATUS_FAILED, reason.String())
+	task.GuestBatchCreateTask.OnScheduleFailed(ctx, reason)
+}
+
+func (task *GuestPreemptTask) OnScheduleComplete(ctx context.Context, guest *models.SGuest, data *jsonutils.JSONDict) {
+	task.setPreemptionStatus(ctx, api.SCHED_PREEMPTION_STATUS_SUCCESS, "")
+	task.SetStageComplete(ctx, nil)
+}
+
+func (task *GuestPreemptTask) OnScheduleCompleteFailed(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
+	task.setPreemptionStatus(ctx, api.SCHED_PREEMPTION_STATUS_FAILED, data.String())
+	task.SetStageFailed(ctx, data)
+}
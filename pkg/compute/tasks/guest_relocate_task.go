@@ -0,0 +1,708 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	schedapi "yunion.io/x/onecloud/pkg/apis/scheduler"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/lockman"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
+	"yunion.io/x/onecloud/pkg/compute/models"
+	"yunion.io/x/onecloud/pkg/util/logclient"
+)
+
+// GuestRelocateTask moves a kvm guest into another region. The disks are
+// pre-copied while the guest keeps running: every round takes a snapshot of
+// each disk so that the target host can fetch the now immutable backing files.
+// Once the remaining overlays are estimated to transfer within the allowed
+// downtime the guest is stopped, the overlays are fetched and the disks are
+// handed over to the guest record created in the target region.
+type GuestRelocateTask struct {
+	SSchedTask
+}
+
+func init() {
+	taskman.RegisterTask(GuestRelocateTask{})
+}
+
+func (task *GuestRelocateTask) getTargetGuest() *models.SGuest {
+	guestId, _ := task.Params.GetString("target_guest_id")
+	return models.GuestManager.FetchGuestById(guestId)
+}
+
+func (task *GuestRelocateTask) getInput() *api.ServerRelocateInput {
+	input := new(api.ServerRelocateInput)
+	task.Params.Unmarshal(input, "input")
+	return input
+}
+
+func (task *GuestRelocateTask) getStringMap(key string) map[string]string {
+	ret := map[string]string{}
+	task.Params.Unmarshal(&ret, key)
+	return ret
+}
+
+func (task *GuestRelocateTask) getDisks() ([]models.SDisk, error) {
+	diskIds := []string{}
+	task.Params.Unmarshal(&diskIds, "disk_ids")
+	ret := make([]models.SDisk, 0, len(diskIds))
+	for _, id := range diskIds {
+		disk := models.DiskManager.FetchDiskById(id)
+		if disk == nil {
+			return nil, errors.Wrapf(errors.ErrNotFound, "disk %s", id)
+		}
+		ret = append(ret, *disk)
+	}
+	return ret, nil
+}
+
+func (task *GuestRelocateTask) isSourceRunning() bool {
+	status, _ := task.Params.GetString("guest_status")
+	return status == api.VM_RUNNING
+}
+
+func (task *GuestRelocateTask) getRelocateSnapshots() []string {
+	ret := []string{}
+	task.Params.Unmarshal(&ret, "relocate_snapshots")
+	return ret
+}
+
+// taskFailed rolls back a relocation that has not switched over: the relocated
+// guest and the files fetched onto the target host are removed, the source is
+// started again and the pre-copy snapshots are deleted before the task fails
+func (task *GuestRelocateTask) taskFailed(ctx context.Context, guest *models.SGuest, reason jsonutils.JSONObject) {
+	targetGuest := task.getTargetGuest()
+	recovery := models.GetGuestRelocateRecovery(
+		jsonutils.QueryBoolean(task.Params, "switched", false),
+		jsonutils.QueryBoolean(task.Params, "stopped", false),
+		task.isSourceRunning(),
+	)
+	if !recovery.DeleteTarget {
+		// disks may belong to the relocated guest already, leave both for manual recovery
+		guest.SetStatus(ctx, task.UserCred, api.VM_RELOCATE_FAILED, reason.String())
+		if targetGuest != nil {
+			targetGuest.SetStatus(ctx, task.UserCred, api.VM_RELOCATE_FAILED, reason.String())
+		}
+		task.rollbackComplete(ctx, guest, reason)
+		return
+	}
+
+	task.Params.Set("rollback_reason", reason)
+	if targetGuest != nil {
+		targetGuest.SetStatus(ctx, task.UserCred, api.VM_RELOCATE_FAILED, reason.String())
+		err := targetGuest.StartDeleteGuestTask(ctx, task.UserCred, "", api.ServerDeleteInput{OverridePendingDelete: true})
+		if err != nil {
+			log.Errorf("delete relocate target guest %s: %s", targetGuest.Name, err)
+		}
+	}
+	targetHostId, _ := task.Params.GetString("target_host_id")
+	if targetHost := models.HostManager.FetchHostById(targetHostId); targetHost != nil {
+		err := guest.CleanupRelocateTargetDisks(ctx, task.UserCred, targetHost, task.getStringMap("target_storages"))
+		if err != nil {
+			log.Errorf("cleanup relocate target disks of %s: %s", guest.Name, err)
+		}
+	}
+	if recovery.RestartSource {
+		// bring the source back first to keep the outage bounded
+		guest.SetStatus(ctx, task.UserCred, api.VM_READY, reason.String())
+		task.SetStage("OnRelocateRollbackSourceStarted", nil)
+		err := guest.StartGueststartTask(ctx, task.UserCred, nil, task.GetTaskId())
+		if err == nil {
+			return
+		}
+		log.Errorf("restart relocate source guest %s: %s", guest.Name, err)
+	}
+	task.OnRelocateRollbackSourceStarted(ctx, guest, nil)
+}
+
+func (task *GuestRelocateTask) OnRelocateRollbackSourceStarted(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
+	task.deleteNextRelocateSnapshot(ctx, guest, 0)
+}
+
+func (task *GuestRelocateTask) OnRelocateRollbackSourceStartedFailed(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
+	log.Errorf("restart relocate source guest %s: %s", guest.Name, data)
+	task.deleteNextRelocateSnapshot(ctx, guest, 0)
+}
+
+// deleteNextRelocateSnapshot deletes the pre-copy snapshots one by one, they
+// share the backing chains of the disks. It finishes the relocation, or its
+// rollback when a failure reason is recorded
+func (task *GuestRelocateTask) deleteNextRelocateSnapshot(ctx context.Context, guest *models.SGuest, idx int) {
+	snapshotIds := task.getRelocateSnapshots()
+	for ; idx < len(snapshotIds); idx++ {
+		obj, err := models.SnapshotManager.FetchById(snapshotIds[idx])
+		if err != nil {
+			log.Warningf("fetch relocate snapshot %s: %s", snapshotIds[idx], err)
+			continue
+		}
+		snapshot := obj.(*models.SSnapshot)
+		task.Params.Set("snapshot_index", jsonutils.NewInt(int64(idx)))
+		task.SetStage("OnRelocateSnapshotDeleted", nil)
+		err = snapshot.StartSnapshotDeleteTask(ctx, task.UserCred, false, task.GetTaskId())
+		if err == nil {
+			return
+		}
+		log.Warningf("delete relocate snapshot %s: %s", snapshot.Name, err)
+	}
+	if reason, _ := task.Params.Get("rollback_reason"); reason != nil {
+		if guest.Status == api.VM_RELOCATING {
+			guest.SetStatus(ctx, task.UserCred, api.VM_RELOCATE_FAILED, reason.String())
+		}
+		task.rollbackComplete(ctx, guest, reason)
+		return
+	}
+	task.taskComplete(ctx, guest)
+}
+
+func (task *GuestRelocateTask) OnRelocateSnapshotDeleted(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
+	idx, _ := task.Params.Int("snapshot_index")
+	task.deleteNextRelocateSnapshot(ctx, guest, int(idx)+1)
+}
+
+func (task *GuestRelocateTask) OnRelocateSnapshotDeletedFailed(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
+	// a leftover snapshot does not fail the relocation or its rollback
+	log.Warningf("delete relocate snapshot failed: %s", data)
+	task.OnRelocateSnapshotDeleted(ctx, guest, data)
+}
+
+func (task *GuestRelocateTask) rollbackComplete(ctx context.Context, guest *models.SGuest, reason jsonutils.JSONObject) {
+	db.OpsLog.LogEvent(guest, db.ACT_VM_RELOCATE_FAIL, reason, task.UserCred)
+	logclient.AddActionLogWithStartable(task, guest, logclient.ACT_VM_RELOCATE, reason, task.UserCred, false)
+	task.SetStageFailed(ctx, reason)
+}
+
+func (task *GuestRelocateTask) GetSchedParams() (*schedapi.ScheduleInput, error) {
+	guest := task.GetObject().(*models.SGuest)
+	createInput := new(api.ServerCreateInput)
+	err := task.Params.Unmarshal(createInput, "create_input")
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshal create input")
+	}
+	input := task.getInput()
+
+	schedDesc := guest.ToSchedDesc()
+	schedDesc.HostId = ""
+	schedDesc.PreferRegion = input.TargetRegion
+	schedDesc.PreferZone = input.TargetZone
+	schedDesc.PreferHost = input.PreferHost
+	for i := range schedDesc.Disks {
+		schedDesc.Disks[i].Backend = api.STORAGE_LOCAL
+		schedDesc.Disks[i].Medium = ""
+		schedDesc.Disks[i].Storage = ""
+	}
+	schedDesc.Networks = createInput.Networks
+	return schedDesc, nil
+}
+
+func (task *GuestRelocateTask) OnInit(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
+	StartScheduleObjects(ctx, task, []db.IStandaloneModel{obj})
+}
+
+func (task *GuestRelocateTask) OnStartSchedule(obj IScheduleModel) {
+	// keep relocating status, the guest is not moved by scheduling
+}
+
+func (task *GuestRelocateTask) OnScheduleFailCallback(ctx context.Context, obj IScheduleModel, reason jsonutils.JSONObject, index int) {
+	// do nothing
+}
+
+func (task *GuestRelocateTask) OnScheduleFailed(ctx context.Context, reason jsonutils.JSONObject) {
+	guest := task.GetObject().(*models.SGuest)
+	task.taskFailed(ctx, guest, reason)
+}
+
+func (task *GuestRelocateTask) SaveScheduleResult(ctx context.Context, obj IScheduleModel, target *schedapi.CandidateResource, index int) {
+	guest := obj.(*models.SGuest)
+	targetGuest := task.getTargetGuest()
+	if targetGuest == nil {
+		task.taskFailed(ctx, guest, jsonutils.NewString("target guest not found"))
+		return
+	}
+	targetGuest.SetStatus(ctx, task.UserCred, api.VM_RELOCATING, "")
+	err := targetGuest.OnScheduleToHost(ctx, task.UserCred, target.HostId)
+	if err != nil {
+		task.taskFailed(ctx, guest, jsonutils.NewString(fmt.Sprintf("update guest %s", err)))
+		return
+	}
+	host, err := targetGuest.GetHost()
+	if err != nil {
+		task.taskFailed(ctx, guest, jsonutils.NewString(fmt.Sprintf("GetHost %s", err)))
+		return
+	}
+	createInput := new(api.ServerCreateInput)
+	err = task.Params.Unmarshal(createInput, "create_input")
+	if err != nil {
+		task.taskFailed(ctx, guest, jsonutils.NewString(fmt.Sprintf("unmarshal create input %s", err)))
+		return
+	}
+	err = targetGuest.CreateNetworksOnHost(ctx, task.UserCred, host, createInput.Networks, nil, nil, target.Nets)
+	if err != nil {
+		task.taskFailed(ctx, guest, jsonutils.NewString(fmt.Sprintf("guest create networks %s", err)))
+		return
+	}
+
+	disks, err := guest.GetDisks()
+	if err != nil {
+		task.taskFailed(ctx, guest, jsonutils.NewString(fmt.Sprintf("GetDisks %s", err)))
+		return
+	}
+	if len(target.Disks) < len(disks) {
+		task.taskFailed(ctx, guest, jsonutils.NewString("no target storage found for all disks"))
+		return
+	}
+	diskIds := []string{}
+	srcStorages, targetStorages := map[string]string{}, map[string]string{}
+	for i := range disks {
+		if len(target.Disks[i].StorageIds) == 0 {
+			task.taskFailed(ctx, guest, jsonutils.NewString(fmt.Sprintf("no target storage found for disk %s", disks[i].Name)))
+			return
+		}
+		diskIds = append(diskIds, disks[i].Id)
+		srcStorages[disks[i].Id] = disks[i].StorageId
+		targetStorages[disks[i].Id] = target.Disks[i].StorageIds[0]
+	}
+	task.Params.Set("target_host_id", jsonutils.NewString(target.HostId))
+	task.Params.Set("disk_ids", jsonutils.NewStringArray(diskIds))
+	task.Params.Set("source_storages", jsonutils.Marshal(srcStorages))
+	task.Params.Set("target_storages", jsonutils.Marshal(targetStorages))
+	task.Params.Set("round", jsonutils.NewInt(0))
+	guest.SetStatus(ctx, task.UserCred, api.VM_RELOCATING, "")
+	task.cacheNextImage(ctx, guest, 0)
+}
+
+func (task *GuestRelocateTask) cacheNextImage(ctx context.Context, guest *models.SGuest, idx int) {
+	disks, err := task.getDisks()
+	if err != nil {
+		task.taskFailed(ctx, guest, jsonutils.NewString(err.Error()))
+		return
+	}
+	for ; idx < len(disks); idx++ {
+		if len(disks[idx].TemplateId) > 0 {
+			break
+		}
+	}
+	if idx >= len(disks) {
+		task.startRound(ctx, guest)
+		return
+	}
+	disk := &disks[idx]
+	format, err := disk.GetCacheImageFormat(ctx)
+	if err != nil {
+		task.taskFailed(ctx, guest, jsonutils.NewString(fmt.Sprintf("disk get cache image format failed %s", err)))
+		return
+	}
+	storageId := task.getStringMap("target_storages")[disk.Id]
+	storage := models.StorageManager.FetchStorageById(storageId)
+	if storage == nil {
+		task.taskFailed(ctx, guest, jsonutils.NewString(fmt.Sprintf("target storage %s not found", storageId)))
+		return
+	}
+	task.Params.Set("disk_index", jsonutils.NewInt(int64(idx)))
+	task.SetStage("OnRelocateCacheImage", nil)
+	input := api.CacheImageInput{
+		ImageId:      disk.GetTemplateId(),
+		Format:       format,
+		ParentTaskId: task.GetTaskId(),
+	}
+	err = storage.GetStoragecache().StartImageCacheTask(ctx, task.UserCred, input)
+	if err != nil {
+		task.taskFailed(ctx, guest, jsonutils.NewString(fmt.Sprintf("StartImageCacheTask %s", err)))
+		return
+	}
+}
+
+func (task *GuestRelocateTask) OnRelocateCacheImage(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
+	idx, _ := task.Params.Int("disk_index")
+	task.cacheNextImage(ctx, guest, int(idx)+1)
+}
+
+func (task *GuestRelocateTask) OnRelocateCacheImageFailed(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
+	task.taskFailed(ctx, guest, data)
+}
+
+// startRound starts a pre-copy round, a guest not running is synced right away
+func (task *GuestRelocateTask) startRound(ctx context.Context, guest *models.SGuest) {
+	if !task.isSourceRunning() {
+		task.Params.Set("stopped", jsonutils.JSONTrue)
+		task.syncNextDisk(ctx, guest, 0)
+		return
+	}
+	round, _ := task.Params.Int("round")
+	task.Params.Set("round", jsonutils.NewInt(round+1))
+	task.Params.Set("round_bytes", jsonutils.NewInt(0))
+	task.Params.Set("round_started", jsonutils.NewInt(time.Now().Unix()))
+	task.snapshotNextDisk(ctx, guest, 0)
+}
+
+func (task *GuestRelocateTask) snapshotNextDisk(ctx context.Context, guest *models.SGuest, idx int) {
+	disks, err := task.getDisks()
+	if err != nil {
+		task.taskFailed(ctx, guest, jsonutils.NewString(err.Error()))
+		return
+	}
+	if idx >= len(disks) {
+		task.syncNextDisk(ctx, guest, 0)
+		return
+	}
+	round, _ := task.Params.Int("round")
+	snapshot, err := func() (*models.SSnapshot, error) {
+		lockman.LockClass(ctx, models.SnapshotManager, "name")
+		defer lockman.ReleaseClass(ctx, models.SnapshotManager, "name")
+
+		name, err := db.GenerateName(ctx, models.SnapshotManager, guest.GetOwnerId(), fmt.Sprintf("%s-relocate-%d", disks[idx].Name, round))
+		if err != nil {
+			return nil, errors.Wrap(err, "Generate snapshot name")
+		}
+		return models.SnapshotManager.CreateSnapshot(ctx, guest.GetOwnerId(), api.SNAPSHOT_MANUAL,
+			disks[idx].Id, guest.Id, "", name, -1, true, "")
+	}()
+	if err != nil {
+		task.taskFailed(ctx, guest, jsonutils.NewString(fmt.Sprintf("create snapshot of disk %s: %s", disks[idx].Name, err)))
+		return
+	}
+	task.Params.Set("relocate_snapshots", jsonutils.NewStringArray(append(task.getRelocateSnapshots(), snapshot.Id)))
+	task.Params.Set("disk_index", jsonutils.NewInt(int64(idx)))
+	task.SetStage("OnRelocateSnapshot", nil)
+	err = snapshot.StartSnapshotCreateTask(ctx, task.UserCred, nil, task.GetTaskId())
+	if err != nil {
+		task.taskFailed(ctx, guest, jsonutils.NewString(err.Error()))
+		return
+	}
+}
+
+func (task *GuestRelocateTask) OnRelocateSnapshot(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
+	idx, _ := task.Params.Int("disk_index")
+	task.snapshotNextDisk(ctx, guest, int(idx)+1)
+}
+
+func (task *GuestRelocateTask) OnRelocateSnapshotFailed(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
+	task.taskFailed(ctx, guest, data)
+}
+
+// syncNextDisk fetches the snapshot chain of a disk onto the target host, the
+// top disk is fetched as well once the source guest is stopped
+func (task *GuestRelocateTask) syncNextDisk(ctx context.Context, guest *models.SGuest, idx int) {
+	disks, err := task.getDisks()
+	if err != nil {
+		task.taskFailed(ctx, guest, jsonutils.NewString(err.Error()))
+		return
+	}
+	final := jsonutils.QueryBoolean(task.Params, "stopped", false)
+	if idx >= len(disks) {
+		if final {
+			task.onFinalSynced(ctx, guest)
+		} else {
+			task.onRoundSynced(ctx, guest)
+		}
+		return
+	}
+	disk := &disks[idx]
+	body, err := task.prepareDiskSync(ctx, disk)
+	if err != nil {
+		task.taskFailed(ctx, guest, jsonutils.NewString(fmt.Sprintf("prepare sync disk %s: %s", disk.Name, err)))
+		return
+	}
+	body.Set("snapshots_only", jsonutils.NewBool(!final))
+	fetched := map[string][]string{}
+	task.Params.Unmarshal(&fetched, "fetched_snapshots")
+	if len(fetched[disk.Id]) > 0 {
+		body.Set("fetched_snapshots", jsonutils.NewStringArray(fetched[disk.Id]))
+	}
+
+	targetHostId, _ := task.Params.GetString("target_host_id")
+	targetHost := models.HostManager.FetchHostById(targetHostId)
+	if targetHost == nil {
+		task.taskFailed(ctx, guest, jsonutils.NewString(fmt.Sprintf("target host %s not found", targetHostId)))
+		return
+	}
+	targetStorage := models.StorageManager.FetchStorageById(task.getStringMap("target_storages")[disk.Id])
+	if targetStorage == nil {
+		task.taskFailed(ctx, guest, jsonutils.NewString(fmt.Sprintf("target storage of disk %s not found", disk.Name)))
+		return
+	}
+	driver, err := targetHost.GetHostDriver()
+	if err != nil {
+		task.taskFailed(ctx, guest, jsonutils.NewString(errors.Wrap(err, "GetHostDriver").Error()))
+		return
+	}
+	task.Params.Set("disk_index", jsonutils.NewInt(int64(idx)))
+	task.SetStage("OnRelocateDiskSync", nil)
+	err = driver.RequestDiskMigrate(ctx, targetHost, targetStorage, disk, task, body)
+	if err != nil {
+		task.taskFailed(ctx, guest, jsonutils.NewString(fmt.Sprintf("failed request disk migrate %s", err)))
+		return
+	}
+}
+
+func (task *GuestRelocateTask) prepareDiskSync(ctx context.Context, disk *models.SDisk) (*jsonutils.JSONDict, error) {
+	storage, err := disk.GetStorage()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetStorage")
+	}
+	sourceHost, err := storage.GetMasterHost()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetMasterHost")
+	}
+	driver, err := sourceHost.GetHostDriver()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetHostDriver")
+	}
+	ret, err := driver.RequestDiskSrcMigratePrepare(ctx, sourceHost, disk, task)
+	if err != nil {
+		return nil, errors.Wrap(err, "RequestDiskSrcMigratePrepare")
+	}
+	body := jsonutils.NewDict()
+	if ret != nil {
+		body.Update(ret.(*jsonutils.JSONDict))
+	}
+	body.Set("snapshots_uri", jsonutils.NewString(fmt.Sprintf("%s/download/snapshots/", sourceHost.ManagerUri)))
+	body.Set("disk_uri", jsonutils.NewString(fmt.Sprintf("%s/download/disks/", sourceHost.ManagerUri)))
+	body.Set("src_storage_id", jsonutils.NewString(disk.StorageId))
+	if disk.TemplateId != "" {
+		body.Set("template_id", jsonutils.NewString(disk.TemplateId))
+	}
+	return body, nil
+}
+
+func (task *GuestRelocateTask) OnRelocateDiskSync(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
+	idx, _ := task.Params.Int("disk_index")
+	diskIds := []string{}
+	task.Params.Unmarshal(&diskIds, "disk_ids")
+	if int(idx) >= len(diskIds) {
+		task.taskFailed(ctx, guest, jsonutils.NewString(fmt.Sprintf("invalid disk index %d", idx)))
+		return
+	}
+	diskId := diskIds[idx]
+
+	fetched := map[string][]string{}
+	task.Params.Unmarshal(&fetched, "fetched_snapshots")
+	snaps := []string{}
+	data.Unmarshal(&snaps, "fetched_snapshots")
+	fetched[diskId] = snaps
+	task.Params.Set("fetched_snapshots", jsonutils.Marshal(fetched))
+
+	fetchedBytes, _ := data.Int("fetched_bytes")
+	roundBytes, _ := task.Params.Int("round_bytes")
+	task.Params.Set("round_bytes", jsonutils.NewInt(roundBytes+fetchedBytes))
+
+	if diskPath, _ := data.GetString("disk_path"); len(diskPath) > 0 {
+		diskPaths := task.getStringMap("disk_paths")
+		diskPaths[diskId] = diskPath
+		task.Params.Set("disk_paths", jsonutils.Marshal(diskPaths))
+	}
+	task.syncNextDisk(ctx, guest, int(idx)+1)
+}
+
+func (task *GuestRelocateTask) OnRelocateDiskSyncFailed(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
+	task.taskFailed(ctx, guest, data)
+}
+
+// onRoundSynced estimates the downtime as the size of the overlays written
+// since the last snapshot over the throughput of this round
+func (task *GuestRelocateTask) onRoundSynced(ctx context.Context, guest *models.SGuest) {
+	round, _ := task.Params.Int("round")
+	roundBytes, _ := task.Params.Int("round_bytes")
+	started, _ := task.Params.Int("round_started")
+	elapsed := time.Now().Unix() - started
+	if elapsed < 1 {
+		elapsed = 1
+	}
+	throughput := roundBytes / elapsed
+	if last, _ := task.Params.Int("throughput"); last > throughput {
+		throughput = last
+	}
+	task.Params.Set("throughput", jsonutils.NewInt(throughput))
+
+	disks, err := task.getDisks()
+	if err != nil {
+		task.taskFailed(ctx, guest, jsonutils.NewString(err.Error()))
+		return
+	}
+	var overlay int64
+	for i := range disks {
+		ret, err := task.prepareDiskSync(ctx, &disks[i])
+		if err != nil {
+			task.taskFailed(ctx, guest, jsonutils.NewString(fmt.Sprintf("prepare sync disk %s: %s", disks[i].Name, err)))
+			return
+		}
+		size, _ := ret.Int("disk_actual_size")
+		overlay += size
+	}
+	input := task.getInput()
+	downtime := int64(-1)
+	if throughput > 0 {
+		downtime = overlay / throughput
+	}
+	notes := jsonutils.NewDict()
+	notes.Set("round", jsonutils.NewInt(round))
+	notes.Set("round_bytes", jsonutils.NewInt(roundBytes))
+	notes.Set("throughput", jsonutils.NewInt(throughput))
+	notes.Set("overlay_bytes", jsonutils.NewInt(overlay))
+	notes.Set("estimated_downtime", jsonutils.NewInt(downtime))
+	db.OpsLog.LogEvent(guest, db.ACT_VM_RELOCATING, notes, task.UserCred)
+
+	if downtime >= 0 && downtime <= int64(input.MaxDowntimeSeconds) {
+		task.Params.Set("stopped", jsonutils.JSONTrue)
+		task.Params.Set("stopped_at", jsonutils.NewInt(time.Now().Unix()))
+		task.SetStage("OnRelocateSourceStopped", nil)
+		guest.StartGuestStopTask(ctx, task.UserCred, 60, false, false, task.GetTaskId())
+		return
+	}
+	if round < api.GUEST_RELOCATE_MAX_PRECOPY_ROUNDS {
+		task.startRound(ctx, guest)
+		return
+	}
+	task.taskFailed(ctx, guest, jsonutils.NewString(fmt.Sprintf("estimated downtime %ds exceeds %ds after %d rounds", downtime, input.MaxDowntimeSeconds, round)))
+}
+
+func (task *GuestRelocateTask) OnRelocateSourceStopped(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
+	guest.SetStatus(ctx, task.UserCred, api.VM_RELOCATING, "")
+	task.syncNextDisk(ctx, guest, 0)
+}
+
+func (task *GuestRelocateTask) OnRelocateSourceStoppedFailed(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
+	task.taskFailed(ctx, guest, data)
+}
+
+func (task *GuestRelocateTask) onFinalSynced(ctx context.Context, guest *models.SGuest) {
+	targetGuest := task.getTargetGuest()
+	if targetGuest == nil {
+		task.taskFailed(ctx, guest, jsonutils.NewString("target guest not found"))
+		return
+	}
+	// persist the marker before the first update, a switchover broken halfway
+	// must not roll back and delete the relocated guest owning moved disks
+	params := jsonutils.NewDict()
+	params.Set("switched", jsonutils.JSONTrue)
+	err := task.SaveParams(params)
+	if err != nil {
+		task.taskFailed(ctx, guest, jsonutils.NewString(fmt.Sprintf("save params %s", err)))
+		return
+	}
+	err = guest.OnRelocateSwitchover(ctx, task.UserCred, targetGuest, task.getStringMap("target_storages"), task.getStringMap("disk_paths"))
+	if err != nil {
+		task.taskFailed(ctx, guest, jsonutils.NewString(fmt.Sprintf("switchover %s", err)))
+		return
+	}
+
+	// deploy with the create action re-plumbs the nics inside the guest
+	kwargs := jsonutils.NewDict()
+	kwargs.Set("reset_password", jsonutils.JSONFalse)
+	task.SetStage("OnRelocateTargetDeployed", nil)
+	err = targetGuest.StartGuestDeployTask(ctx, task.UserCred, kwargs, "create", task.GetTaskId())
+	if err != nil {
+		task.taskFailed(ctx, guest, jsonutils.NewString(fmt.Sprintf("StartGuestDeployTask %s", err)))
+		return
+	}
+}
+
+func (task *GuestRelocateTask) OnRelocateTargetDeployed(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
+	targetGuest := task.getTargetGuest()
+	task.SetStage("OnRelocateTargetStarted", nil)
+	if task.isSourceRunning() {
+		targetGuest.StartGueststartTask(ctx, task.UserCred, nil, task.GetTaskId())
+		return
+	}
+	targetGuest.SetStatus(ctx, task.UserCred, api.VM_READY, "")
+	task.OnRelocateTargetStarted(ctx, guest, nil)
+}
+
+func (task *GuestRelocateTask) OnRelocateTargetDeployedFailed(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
+	task.taskFailed(ctx, guest, data)
+}
+
+func (task *GuestRelocateTask) OnRelocateTargetStarted(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
+	if stoppedAt, _ := task.Params.Int("stopped_at"); stoppedAt > 0 {
+		notes := jsonutils.NewDict()
+		notes.Set("downtime", jsonutils.NewInt(time.Now().Unix()-stoppedAt))
+		db.OpsLog.LogEvent(guest, db.ACT_VM_RELOCATING, notes, task.UserCred)
+	}
+	task.deallocNextSourceDisk(ctx, guest, 0)
+}
+
+func (task *GuestRelocateTask) OnRelocateTargetStartedFailed(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
+	task.taskFailed(ctx, guest, data)
+}
+
+// deallocNextSourceDisk removes the disk files left on the source host
+func (task *GuestRelocateTask) deallocNextSourceDisk(ctx context.Context, guest *models.SGuest, idx int) {
+	disks, err := task.getDisks()
+	if err != nil {
+		task.taskFailed(ctx, guest, jsonutils.NewString(err.Error()))
+		return
+	}
+	if idx >= len(disks) {
+		task.deleteNextRelocateSnapshot(ctx, guest, 0)
+		return
+	}
+	storageId := task.getStringMap("source_storages")[disks[idx].Id]
+	storage := models.StorageManager.FetchStorageById(storageId)
+	if storage == nil {
+		log.Warningf("source storage %s of disk %s not found", storageId, disks[idx].Name)
+		task.deallocNextSourceDisk(ctx, guest, idx+1)
+		return
+	}
+	host, err := storage.GetMasterHost()
+	if err != nil {
+		log.Warningf("GetMasterHost of storage %s: %s", storage.Name, err)
+		task.deallocNextSourceDisk(ctx, guest, idx+1)
+		return
+	}
+	driver, err := host.GetHostDriver()
+	if err != nil {
+		log.Warningf("GetHostDriver of host %s: %s", host.Name, err)
+		task.deallocNextSourceDisk(ctx, guest, idx+1)
+		return
+	}
+	task.Params.Set("disk_index", jsonutils.NewInt(int64(idx)))
+	task.SetStage("OnRelocateSourceDiskDeallocated", nil)
+	err = driver.RequestDeallocateDiskOnHost(ctx, host, storage, &disks[idx], true, task)
+	if err != nil {
+		log.Warningf("deallocate source disk %s: %s", disks[idx].Name, err)
+		task.deallocNextSourceDisk(ctx, guest, idx+1)
+	}
+}
+
+func (task *GuestRelocateTask) OnRelocateSourceDiskDeallocated(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
+	idx, _ := task.Params.Int("disk_index")
+	task.deallocNextSourceDisk(ctx, guest, int(idx)+1)
+}
+
+func (task *GuestRelocateTask) OnRelocateSourceDiskDeallocatedFailed(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
+	// leftover files on the source host do not fail the relocation
+	log.Warningf("deallocate source disk failed: %s", data)
+	task.OnRelocateSourceDiskDeallocated(ctx, guest, data)
+}
+
+func (task *GuestRelocateTask) taskComplete(ctx context.Context, guest *models.SGuest) {
+	guest.SetStatus(ctx, task.UserCred, api.VM_RELOCATED, "")
+	db.OpsLog.LogEvent(guest, db.ACT_VM_RELOCATE, task.getInput(), task.UserCred)
+	logclient.AddActionLogWithStartable(task, guest, logclient.ACT_VM_RELOCATE, task.getInput(), task.UserCred, true)
+	task.SetStageComplete(ctx, nil)
+	// the source keeps nothing but its nics now
+	err := guest.StartDeleteGuestTask(ctx, task.UserCred, "", api.ServerDeleteInput{OverridePendingDelete: true})
+	if err != nil {
+		log.Errorf("delete relocated source guest %s: %s", guest.Name, err)
+	}
+}
@@ -40,6 +40,26 @@ func init() {
 	taskman.RegisterTask(GuestSchedStartTask{})
 }
 
+// GetRecoveryKind asks the host whether the guest is started when the start
+// request was sent, the other stages wait for their subtasks
+func (self *GuestStartTask) GetRecoveryKind(stage string) string {
+	if stage == "OnStartComplete" {
+		return taskman.TASK_RECOVERY_REQUERY
+	}
+	return taskman.TASK_RECOVERY_WAIT
+}
+
+func (self *GuestStartTask) RequeryStage(ctx context.Context, stage string) (jsonutils.JSONObject, error) {
+	running, err := self.requeryGuestRunning(ctx, self.getGuest())
+	if err != nil {
+		return nil, errors.Wrap(err, "requeryGuestRunning")
+	}
+	if !running {
+		return nil, errors.Errorf("guest is not running on host")
+	}
+	return jsonutils.NewDict(), nil
+}
+
 func (self *GuestStartTask) OnInit(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
 	guest := obj.(*models.SGuest)
 	self.AttachReleasedDevices(ctx, guest)
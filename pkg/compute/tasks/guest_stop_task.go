@@ -37,6 +37,26 @@ func init() {
 	taskman.RegisterTask(GuestStopAndFreezeTask{})
 }
 
+// GetRecoveryKind asks the host whether the guest is stopped when the stop
+// request was sent, the other stages wait for their subtasks
+func (self *GuestStopTask) GetRecoveryKind(stage string) string {
+	if stage == "OnGuestStopTaskComplete" {
+		return taskman.TASK_RECOVERY_REQUERY
+	}
+	return taskman.TASK_RECOVERY_WAIT
+}
+
+func (self *GuestStopTask) RequeryStage(ctx context.Context, stage string) (jsonutils.JSONObject, error) {
+	running, err := self.requeryGuestRunning(ctx, self.getGuest())
+	if err != nil {
+		return nil, errors.Wrap(err, "requeryGuestRunning")
+	}
+	if running {
+		return nil, errors.Errorf("guest is still running on host")
+	}
+	return jsonutils.NewDict(), nil
+}
+
 func (self *GuestStopTask) OnInit(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
 	guest := obj.(*models.SGuest)
 	db.OpsLog.LogEvent(guest, db.ACT_STOPPING, nil, self.UserCred)
@@ -37,6 +37,11 @@ func init() {
 	taskman.RegisterTask(GuestSyncstatusTask{})
 }
 
+// GetRecoveryKind syncing status is idempotent, so just do it again
+func (self *GuestSyncstatusTask) GetRecoveryKind(stage string) string {
+	return taskman.TASK_RECOVERY_RESUME
+}
+
 func (self *GuestSyncstatusTask) OnInit(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
 	guest := obj.(*models.SGuest)
 	host, err := guest.GetHost()
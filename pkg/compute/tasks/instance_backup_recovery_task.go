@@ -136,6 +136,10 @@ func (self *InstanceBackupRecoveryTask) OnCreateGuest(ctx context.Context, ib *m
 		sysDisk.SnapshotId = backups[0].DiskConfig.SnapshotId
 		return nil
 	})
+	if err := ib.RestoreVtpmState(ctx, self.UserCred, guest); err != nil {
+		self.taskFailed(ctx, ib, jsonutils.NewString(err.Error()))
+		return
+	}
 	self.taskSuccess(ctx, ib)
 }
 
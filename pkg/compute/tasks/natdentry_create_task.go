@@ -16,9 +16,7 @@ package tasks
 
 import (
 	"context"
-	"time"
 
-	"yunion.io/x/cloudmux/pkg/cloudprovider"
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/pkg/errors"
 
@@ -87,42 +85,15 @@ func (self *SNatDEntryCreateTask) OnAssociateEipComplete(ctx context.Context, dn
 		self.taskFailed(ctx, dnat, errors.Wrapf(err, "dnat.GetNatgateway"))
 		return
 	}
-	iNat, err := nat.GetINatGateway(ctx)
-	if err != nil {
-		self.taskFailed(ctx, dnat, errors.Wrapf(err, "nat.GetINatGateway"))
-		return
-	}
-
-	eip, err := dnat.GetEip()
-	if err != nil {
-		self.taskFailed(ctx, dnat, errors.Wrapf(err, "dnat.GetEip"))
-		return
-	}
 
-	// construct a DNat RUle
-	rule := cloudprovider.SNatDRule{
-		Protocol:     dnat.IpProtocol,
-		InternalIP:   dnat.InternalIP,
-		InternalPort: dnat.InternalPort,
-		ExternalIP:   dnat.ExternalIP,
-		ExternalPort: dnat.ExternalPort,
-		ExternalIPID: eip.ExternalId,
-	}
-	iDnat, err := iNat.CreateINatDEntry(rule)
+	region, err := nat.GetRegion()
 	if err != nil {
-		self.taskFailed(ctx, dnat, errors.Wrapf(err, "iNat.CreateINatDEntry"))
+		self.taskFailed(ctx, dnat, errors.Wrapf(err, "nat.GetRegion"))
 		return
 	}
-
-	err = db.SetExternalId(dnat, self.UserCred, iDnat.GetGlobalId())
-	if err != nil {
-		self.taskFailed(ctx, dnat, errors.Wrapf(err, "db.SetExternalId(%s)", iDnat.GetGlobalId()))
-		return
-	}
-
-	err = cloudprovider.WaitStatus(iDnat, api.NAT_STAUTS_AVAILABLE, 10*time.Second, 5*time.Minute)
+	err = region.GetDriver().RequestCreateNatDEntry(ctx, self.GetUserCred(), nat, dnat)
 	if err != nil {
-		self.taskFailed(ctx, dnat, errors.Wrapf(err, "cloudprovider.WaitStatus"))
+		self.taskFailed(ctx, dnat, errors.Wrapf(err, "RequestCreateNatDEntry"))
 		return
 	}
 
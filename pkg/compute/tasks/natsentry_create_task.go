@@ -16,9 +16,7 @@ package tasks
 
 import (
 	"context"
-	"time"
 
-	"yunion.io/x/cloudmux/pkg/cloudprovider"
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/pkg/errors"
 
@@ -87,48 +85,15 @@ func (self *SNatSEntryCreateTask) OnAssociateEipComplete(ctx context.Context, sn
 		self.taskFailed(ctx, snat, errors.Wrapf(err, "snat.GetNatgateway"))
 		return
 	}
-	iNat, err := nat.GetINatGateway(ctx)
-	if err != nil {
-		self.taskFailed(ctx, snat, errors.Wrapf(err, "nat.GetINatGateway"))
-		return
-	}
-
-	eip, err := snat.GetEip()
-	if err != nil {
-		self.taskFailed(ctx, snat, errors.Wrapf(err, "snat.GetEip"))
-		return
-	}
-
-	// construct a DNat RUle
-	rule := cloudprovider.SNatSRule{
-		ExternalIP:   snat.IP,
-		ExternalIPID: eip.ExternalId,
-	}
-	if len(snat.SourceCIDR) > 0 {
-		rule.SourceCIDR = snat.SourceCIDR
-	} else {
-		network, err := snat.GetNetwork()
-		if err != nil {
-			self.taskFailed(ctx, snat, errors.Wrapf(err, "snat.GetNetwork"))
-			return
-		}
-		rule.NetworkID = network.ExternalId
-	}
-	iSnat, err := iNat.CreateINatSEntry(rule)
-	if err != nil {
-		self.taskFailed(ctx, snat, errors.Wrapf(err, "CreateINatSEntry"))
-		return
-	}
 
-	err = db.SetExternalId(snat, self.UserCred, iSnat.GetGlobalId())
+	region, err := nat.GetRegion()
 	if err != nil {
-		self.taskFailed(ctx, snat, errors.Wrapf(err, "db.SetExternalId(%s)", iSnat.GetGlobalId()))
+		self.taskFailed(ctx, snat, errors.Wrapf(err, "nat.GetRegion"))
 		return
 	}
-
-	err = cloudprovider.WaitStatus(iSnat, api.NAT_STAUTS_AVAILABLE, 10*time.Second, 5*time.Minute)
+	err = region.GetDriver().RequestCreateNatSEntry(ctx, self.GetUserCred(), nat, snat)
 	if err != nil {
-		self.taskFailed(ctx, snat, errors.Wrapf(err, "cloudprovider.WaitStatus(iSnat)"))
+		self.taskFailed(ctx, snat, errors.Wrapf(err, "RequestCreateNatSEntry"))
 		return
 	}
 
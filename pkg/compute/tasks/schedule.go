@@ -20,6 +20,7 @@ import (
 	"sort"
 
 	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
 
 	api "yunion.io/x/onecloud/pkg/apis/compute"
 	schedapi "yunion.io/x/onecloud/pkg/apis/scheduler"
@@ -57,6 +58,13 @@ type IScheduleTask interface {
 	OnScheduleFailed(ctx context.Context, reason jsonutils.JSONObject)
 }
 
+// IPreemptScheduleTask is implemented by the schedule task whose object is
+// able to preempt lower priority guests when no host fits it, it returns
+// true if the object is taken over by preemption
+type IPreemptScheduleTask interface {
+	OnSchedulePreempt(ctx context.Context, obj IScheduleModel, reason string, index int) bool
+}
+
 type SSchedTask struct {
 	taskman.STask
 	input *schedapi.ScheduleInput
@@ -209,6 +217,10 @@ func onSchedulerResults(
 		result := results[idx]
 
 		if len(result.Error) != 0 {
+			if preemptTask, ok := task.(IPreemptScheduleTask); ok && preemptTask.OnSchedulePreempt(ctx, obj, result.Error, idx) {
+				succCount += 1
+				continue
+			}
 			onObjScheduleFail(ctx, task, obj, jsonutils.NewString(result.Error), idx)
 			continue
 		}
@@ -240,6 +252,7 @@ func onMasterSlaveScheduleSucc(
 	task.SaveScheduleResultWithBackup(ctx, obj, master, slave, index)
 	models.HostManager.ClearSchedDescSessionCache(master.HostId, master.SessionId)
 	models.HostManager.ClearSchedDescSessionCache(slave.HostId, slave.SessionId)
+	linkSchedDecision(ctx, obj, master.SessionId)
 }
 
 func onScheduleSucc(
@@ -255,6 +268,17 @@ func onScheduleSucc(
 
 	task.SaveScheduleResult(ctx, obj, candidate, index)
 	models.HostManager.ClearSchedDescSessionCache(candidate.HostId, candidate.SessionId)
+	linkSchedDecision(ctx, obj, candidate.SessionId)
+}
+
+func linkSchedDecision(ctx context.Context, obj IScheduleModel, sessionId string) {
+	if obj.Keyword() != models.GuestManager.Keyword() {
+		return
+	}
+	err := models.SchedDecisionManager.LinkGuest(ctx, sessionId, obj.GetId())
+	if err != nil {
+		log.Errorf("link guest %s to schedule decision %s: %v", obj.GetId(), sessionId, err)
+	}
 }
 
 func getBatchParamsAtIndex(task taskman.ITask, index int) *jsonutils.JSONDict {
@@ -17,7 +17,6 @@ package tasks
 import (
 	"context"
 
-	"yunion.io/x/cloudmux/pkg/cloudprovider"
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/pkg/errors"
 
@@ -52,52 +51,28 @@ func (self *VpcPeeringConnectionCreateTask) OnInit(ctx context.Context, obj db.I
 		return
 	}
 
-	peerVpc, err := peer.GetPeerVpc()
+	region, err := vpc.GetRegion()
 	if err != nil {
-		self.taskFailed(ctx, peer, errors.Wrapf(err, "GetPeerVpc"))
+		self.taskFailed(ctx, peer, errors.Wrapf(err, "GetRegion"))
 		return
 	}
 
-	iVpc, err := vpc.GetIVpc(ctx)
+	self.SetStage("OnCreateComplete", nil)
+	err = region.GetDriver().RequestCreateVpcPeeringConnection(ctx, self.GetUserCred(), peer, self)
 	if err != nil {
-		self.taskFailed(ctx, peer, errors.Wrapf(err, "GetIVpc"))
-		return
-	}
-
-	iPeerVpc, err := peerVpc.GetIVpc(ctx)
-	if err != nil {
-		self.taskFailed(ctx, peer, errors.Wrapf(err, "GetIVpc"))
-		return
-	}
-
-	opts := &cloudprovider.VpcPeeringConnectionCreateOptions{
-		Name:          peer.Name,
-		Desc:          peer.Description,
-		Bandwidth:     peer.Bandwidth,
-		PeerVpcId:     iPeerVpc.GetId(),
-		PeerRegionId:  iPeerVpc.GetRegion().GetId(),
-		PeerAccountId: iPeerVpc.GetAuthorityOwnerId(),
-	}
-	iPeerConnection, err := iVpc.CreateICloudVpcPeeringConnection(opts)
-	if err != nil {
-		self.taskFailed(ctx, peer, errors.Wrapf(err, "CreateICloudVpcPeeringConnection"))
-		return
-	}
-	err = iPeerVpc.AcceptICloudVpcPeeringConnection(iPeerConnection.GetGlobalId())
-	if err != nil {
-		self.taskFailed(ctx, peer, errors.Wrapf(err, "AcceptICloudVpcPeeringConnection"))
+		self.taskFailed(ctx, peer, errors.Wrapf(err, "RequestCreateVpcPeeringConnection"))
 		return
 	}
+}
 
-	iPeerConnection.Refresh()
-	err = peer.SyncWithCloudPeerConnection(ctx, self.GetUserCred(), iPeerConnection)
-	if err != nil {
-		self.taskFailed(ctx, peer, errors.Wrapf(err, "SyncWithCloudPeerConnection"))
-		return
-	}
+func (self *VpcPeeringConnectionCreateTask) OnCreateComplete(ctx context.Context, peer *models.SVpcPeeringConnection, data jsonutils.JSONObject) {
 	self.taskComplete(ctx, peer)
 }
 
+func (self *VpcPeeringConnectionCreateTask) OnCreateCompleteFailed(ctx context.Context, peer *models.SVpcPeeringConnection, data jsonutils.JSONObject) {
+	self.taskFailed(ctx, peer, errors.Error(data.String()))
+}
+
 func (self *VpcPeeringConnectionCreateTask) taskComplete(ctx context.Context, peer *models.SVpcPeeringConnection) {
 	logclient.AddActionLogWithStartable(self, peer, logclient.ACT_CREATE, nil, self.UserCred, true)
 	self.SetStageComplete(ctx, nil)
@@ -16,8 +16,8 @@ package tasks
 
 import (
 	"context"
+	"database/sql"
 
-	"yunion.io/x/cloudmux/pkg/cloudprovider"
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/pkg/errors"
 
@@ -54,36 +54,32 @@ func (self *VpcPeeringConnectionDeleteTask) OnInit(ctx context.Context, obj db.I
 
 	vpc, err := peer.GetVpc()
 	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			self.taskComplete(ctx, peer)
+			return
+		}
 		self.taskFailed(ctx, peer, errors.Wrapf(err, "GetVpc"))
 		return
 	}
 
-	iVpc, err := vpc.GetIVpc(ctx)
-	if err != nil {
-		self.taskFailed(ctx, peer, errors.Wrapf(err, "GetIVpc"))
-		return
-	}
-
-	if len(peer.ExternalId) == 0 {
-		self.taskComplete(ctx, peer)
-		return
-	}
-
-	iPeer, err := iVpc.GetICloudVpcPeeringConnectionById(peer.ExternalId)
+	region, err := vpc.GetRegion()
 	if err != nil {
-		if errors.Cause(err) != cloudprovider.ErrNotFound {
-			self.taskFailed(ctx, peer, errors.Wrapf(err, "GetICloudVpcPeeringConnectionById(%s)", peer.ExternalId))
-			return
-		}
-		self.taskComplete(ctx, peer)
+		self.taskFailed(ctx, peer, errors.Wrapf(err, "GetRegion"))
 		return
 	}
 
-	err = iPeer.Delete()
+	self.SetStage("OnDeleteComplete", nil)
+	err = region.GetDriver().RequestDeleteVpcPeeringConnection(ctx, self.GetUserCred(), peer, self)
 	if err != nil {
-		self.taskFailed(ctx, peer, errors.Wrapf(err, "Delete"))
+		self.taskFailed(ctx, peer, errors.Wrapf(err, "RequestDeleteVpcPeeringConnection"))
 		return
 	}
+}
 
+func (self *VpcPeeringConnectionDeleteTask) OnDeleteComplete(ctx context.Context, peer *models.SVpcPeeringConnection, data jsonutils.JSONObject) {
 	self.taskComplete(ctx, peer)
 }
+
+func (self *VpcPeeringConnectionDeleteTask) OnDeleteCompleteFailed(ctx context.Context, peer *models.SVpcPeeringConnection, data jsonutils.JSONObject) {
+	self.taskFailed(ctx, peer, errors.Error(data.String()))
+}
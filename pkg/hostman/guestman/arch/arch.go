@@ -30,6 +30,7 @@ type Arch interface {
 	GenerateQgaDesc(qgaPath string) *desc.SGuestQga
 	GeneratePvpanicDesc() *desc.SGuestPvpanic
 	GenerateIsaSerialDesc() *desc.SGuestIsaSerial
+	GenerateTpmDesc(socketPath string) *desc.SGuestTpm
 }
 
 type KVMGuestInstance interface {
@@ -80,6 +81,18 @@ func (*archBase) GenerateQgaDesc(qgaPath string) *desc.SGuestQga {
 	}
 }
 
+func (*archBase) generateTpmDesc(socketPath, model string) *desc.SGuestTpm {
+	chardev := desc.NewCharDev("socket", "chrtpm", "")
+	chardev.Options = map[string]string{
+		"path": socketPath,
+	}
+	return &desc.SGuestTpm{
+		Chardev: chardev,
+		Model:   model,
+		Id:      "tpm0",
+	}
+}
+
 func (*archBase) GeneratePvpanicDesc() *desc.SGuestPvpanic {
 	return nil
 }
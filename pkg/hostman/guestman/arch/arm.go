@@ -35,6 +35,10 @@ type ARM struct {
 	archBase
 }
 
+func (a *ARM) GenerateTpmDesc(socketPath string) *desc.SGuestTpm {
+	return a.generateTpmDesc(socketPath, "tpm-tis-device")
+}
+
 // -device scsi-cd,drive=cd0,share-rw=true
 // if=none,file=%s,id=cd0,media=cdrom
 func (*ARM) GenerateCdromDesc(osName string, cdrom *desc.SGuestCdrom) {
@@ -53,6 +53,10 @@ func (*X86) GenerateIsaSerialDesc() *desc.SGuestIsaSerial {
 	}
 }
 
+func (x *X86) GenerateTpmDesc(socketPath string) *desc.SGuestTpm {
+	return x.generateTpmDesc(socketPath, "tpm-crb")
+}
+
 func (*X86) GenerateCdromDesc(osName string, cdrom *desc.SGuestCdrom) {
 	var id, devType string
 	var driveOpts map[string]string
@@ -0,0 +1,266 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guestman
+
+import (
+	"runtime/debug"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/shirou/gopsutil/mem"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/hostman/guestman/desc"
+	"yunion.io/x/onecloud/pkg/hostman/monitor"
+	"yunion.io/x/onecloud/pkg/hostman/options"
+)
+
+// Guests with mem balloon enabled get a virtio-balloon device with free page
+// reporting. The balloon controller inflates the balloons of running guests
+// when available host memory drops below MemBalloonReclaimPercent and
+// deflates them again once it rises above MemBalloonReleasePercent, a guest
+// is never ballooned below its floor. Memory held by the balloons is reported
+// to region with host ping so that the scheduler counts it as free.
+
+func (s *SKVMGuestInstance) initBalloonDesc(pciRoot *desc.PCIController) {
+	if s.Desc.MemBalloon {
+		s.Desc.Balloon = &desc.SGuestBalloon{
+			PCIDevice: desc.NewPCIDevice(pciRoot.CType, "virtio-balloon-pci", "balloon0"),
+		}
+	} else {
+		s.Desc.Balloon = nil
+	}
+}
+
+func (s *SKVMGuestInstance) getBalloonFloorMb() int64 {
+	floor := s.Desc.MemBalloonFloor
+	if floor <= 0 {
+		floor = s.Desc.Mem * int64(options.HostOptions.MemBalloonFloorPercent) / 100
+	}
+	if floor > s.Desc.Mem {
+		floor = s.Desc.Mem
+	}
+	return floor
+}
+
+func (s *SKVMGuestInstance) isBalloonAvailable() bool {
+	return s.Desc.Balloon != nil && s.IsRunning() && s.Monitor != nil
+}
+
+func (s *SKVMGuestInstance) queryBalloonActualMb() (int64, error) {
+	type result struct {
+		actual int64
+		err    string
+	}
+	res := make(chan result, 1)
+	s.Monitor.GetBalloonActual(func(actual int64, err string) {
+		res <- result{actual, err}
+	})
+	select {
+	case <-time.After(monitorCommandTimeout):
+		return 0, errors.Wrap(errors.ErrTimeout, "query balloon")
+	case r := <-res:
+		if len(r.err) > 0 {
+			return 0, errors.Error(r.err)
+		}
+		atomic.StoreInt64(&s.balloonActualMb, r.actual)
+		return r.actual, nil
+	}
+}
+
+func (s *SKVMGuestInstance) setBalloonMb(sizeMb int64) error {
+	err := monitorCall(func(cb monitor.StringCallback) {
+		s.Monitor.SetBalloon(sizeMb, cb)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "set balloon to %dMB", sizeMb)
+	}
+	log.Infof("guest %s balloon target set to %dMB", s.GetName(), sizeMb)
+	return nil
+}
+
+// getBalloonReclaimedMb returns the memory size held by the balloon, which
+// is valid after the controller queried the balloon at least once
+func (s *SKVMGuestInstance) getBalloonReclaimedMb() int64 {
+	actual := atomic.LoadInt64(&s.balloonActualMb)
+	if actual <= 0 || actual >= s.Desc.Mem {
+		return 0
+	}
+	return s.Desc.Mem - actual
+}
+
+func (m *SGuestManager) getBalloonGuests() []*SKVMGuestInstance {
+	guests := make([]*SKVMGuestInstance, 0)
+	m.Servers.Range(func(k, v interface{}) bool {
+		guest, ok := v.(*SKVMGuestInstance)
+		if ok && guest.isBalloonAvailable() {
+			guests = append(guests, guest)
+		}
+		return true
+	})
+	return guests
+}
+
+// GetBalloonReclaimedMemMb sums up memory held by balloons of running guests
+func (m *SGuestManager) GetBalloonReclaimedMemMb() int {
+	var total int64
+	for _, guest := range m.getBalloonGuests() {
+		total += guest.getBalloonReclaimedMb()
+	}
+	return int(total)
+}
+
+func (m *SGuestManager) startMemBalloonController() {
+	if !options.HostOptions.EnableMemBalloonController {
+		return
+	}
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				debug.PrintStack()
+				log.Errorf("Mem balloon controller failed %s", r)
+			}
+		}()
+		interval := time.Duration(options.HostOptions.MemBalloonCheckIntervalSeconds) * time.Second
+		for {
+			time.Sleep(interval)
+			if err := m.adjustMemBalloons(); err != nil {
+				log.Errorf("adjust mem balloons: %s", err)
+			}
+		}
+	}()
+}
+
+type balloonGuest struct {
+	guest  *SKVMGuestInstance
+	mem    int64
+	actual int64
+	floor  int64
+
+	// target is the new balloon size planned, 0 to leave it alone
+	target int64
+}
+
+func minInt64(vals ...int64) int64 {
+	ret := vals[0]
+	for _, v := range vals[1:] {
+		if v < ret {
+			ret = v
+		}
+	}
+	return ret
+}
+
+// planBalloons decides the balloon targets of guests by available memory of
+// host.  Balloons below their floors, which may be raised by user, give the
+// memory back first.  When available memory is below lowMb the guests with
+// the most reclaimable memory are inflated first, when it is above highMb
+// the guests ballooned the most are deflated first, each by at most stepMb
+func planBalloons(guests []*balloonGuest, availMb, lowMb, highMb, stepMb int64) {
+	for _, g := range guests {
+		if g.actual < g.floor {
+			g.target = g.floor
+			availMb -= g.floor - g.actual
+		}
+	}
+	current := func(g *balloonGuest) int64 {
+		if g.target > 0 {
+			return g.target
+		}
+		return g.actual
+	}
+
+	sorted := make([]*balloonGuest, len(guests))
+	copy(sorted, guests)
+	if availMb < lowMb {
+		need := lowMb - availMb
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return current(sorted[i])-sorted[i].floor > current(sorted[j])-sorted[j].floor
+		})
+		for _, g := range sorted {
+			if need <= 0 {
+				break
+			}
+			reclaimable := current(g) - g.floor
+			if reclaimable <= 0 {
+				continue
+			}
+			step := minInt64(reclaimable, stepMb, need)
+			g.target = current(g) - step
+			need -= step
+		}
+	} else if availMb > highMb {
+		spare := availMb - highMb
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].mem-current(sorted[i]) > sorted[j].mem-current(sorted[j])
+		})
+		for _, g := range sorted {
+			if spare <= 0 {
+				break
+			}
+			ballooned := g.mem - current(g)
+			if ballooned <= 0 {
+				continue
+			}
+			step := minInt64(ballooned, stepMb, spare)
+			g.target = current(g) + step
+			spare -= step
+		}
+	}
+}
+
+func (m *SGuestManager) adjustMemBalloons() error {
+	guests := make([]*balloonGuest, 0)
+	for _, guest := range m.getBalloonGuests() {
+		actual, err := guest.queryBalloonActualMb()
+		if err != nil {
+			log.Warningf("guest %s query balloon: %s", guest.GetName(), err)
+			continue
+		}
+		guests = append(guests, &balloonGuest{
+			guest:  guest,
+			mem:    guest.Desc.Mem,
+			actual: actual,
+			floor:  guest.getBalloonFloorMb(),
+		})
+	}
+	if len(guests) == 0 {
+		return nil
+	}
+
+	info, err := mem.VirtualMemory()
+	if err != nil {
+		return errors.Wrap(err, "VirtualMemory")
+	}
+	totalMb := int64(info.Total / 1024 / 1024)
+	availMb := int64(info.Available / 1024 / 1024)
+	lowMb := totalMb * int64(options.HostOptions.MemBalloonReclaimPercent) / 100
+	highMb := totalMb * int64(options.HostOptions.MemBalloonReleasePercent) / 100
+	stepMb := int64(options.HostOptions.MemBalloonStepMb)
+
+	planBalloons(guests, availMb, lowMb, highMb, stepMb)
+	for _, g := range guests {
+		if g.target <= 0 || g.target == g.actual {
+			continue
+		}
+		if err := g.guest.setBalloonMb(g.target); err != nil {
+			log.Errorf("guest %s: %s", g.guest.GetName(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guestman
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlanBalloons(t *testing.T) {
+	type guest struct {
+		mem, actual, floor int64
+	}
+	cases := []struct {
+		name    string
+		guests  []guest
+		availMb int64
+		want    []int64
+	}{
+		{
+			name:    "between watermarks",
+			guests:  []guest{{4096, 4096, 2048}, {4096, 3072, 2048}},
+			availMb: 5000,
+			want:    []int64{0, 0},
+		},
+		{
+			name:    "inflate the most reclaimable first",
+			guests:  []guest{{4096, 3072, 2048}, {8192, 8192, 2048}},
+			availMb: 1800,
+			want:    []int64{0, 7992},
+		},
+		{
+			name:    "inflate by steps across guests",
+			guests:  []guest{{4096, 4096, 2048}, {4096, 4096, 2048}},
+			availMb: 1000,
+			want:    []int64{3584, 3608},
+		},
+		{
+			name:    "never inflate below floor",
+			guests:  []guest{{4096, 2148, 2048}},
+			availMb: 0,
+			want:    []int64{2048},
+		},
+		{
+			name:    "deflate the most ballooned first",
+			guests:  []guest{{4096, 3584, 2048}, {4096, 2048, 2048}},
+			availMb: 8300,
+			want:    []int64{0, 2348},
+		},
+		{
+			name:    "never deflate above memory size",
+			guests:  []guest{{4096, 3996, 2048}},
+			availMb: 10000,
+			want:    []int64{4096},
+		},
+		{
+			name:    "raised floor gives memory back first",
+			guests:  []guest{{4096, 1024, 2048}, {8192, 8192, 1024}},
+			availMb: 2500,
+			want:    []int64{2048, 7680},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			guests := make([]*balloonGuest, 0, len(c.guests))
+			for _, g := range c.guests {
+				guests = append(guests, &balloonGuest{mem: g.mem, actual: g.actual, floor: g.floor})
+			}
+			// low 2000MB, high 8000MB, step 512MB
+			planBalloons(guests, c.availMb, 2000, 8000, 512)
+			got := make([]int64, 0, len(guests))
+			for _, g := range guests {
+				got = append(got, g.target)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("want targets %v, got %v", c.want, got)
+			}
+		})
+	}
+}
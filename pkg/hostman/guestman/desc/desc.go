@@ -136,6 +136,18 @@ type SGuestHardwareDesc struct {
 	Pvpanic   *SGuestPvpanic   `json:",omitempty"`
 	IsaSerial *SGuestIsaSerial `json:",omitempty"`
 
+	// emulated TPM 2.0 backed by swtpm
+	Vtpm bool
+	Tpm  *SGuestTpm `json:",omitempty"`
+
+	// virtiofs shared directories
+	Filesystems []*SGuestFilesystem `json:",omitempty"`
+
+	// virtio-balloon, guest memory is never ballooned below MemBalloonFloor MB
+	MemBalloon      bool
+	MemBalloonFloor int64
+	Balloon         *SGuestBalloon `json:",omitempty"`
+
 	Usb            *UsbController   `json:",omitempty"`
 	PCIControllers []*PCIController `json:",omitempty"`
 
@@ -165,6 +177,31 @@ type VirtSerialPort struct {
 	Options map[string]string `json:",omitempty"`
 }
 
+type SGuestTpm struct {
+	Chardev *CharDev
+	// tpm-crb, tpm-tis-device
+	Model string
+	Id    string
+}
+
+type SGuestFilesystem struct {
+	*PCIDevice `json:",omitempty"`
+
+	Tag string
+	// host_path or mount_target
+	SourceType string
+	// host directory or nfs export
+	Source   string
+	ReadOnly bool
+
+	// vhost-user socket of virtiofsd
+	Chardev *CharDev `json:",omitempty"`
+}
+
+type SGuestBalloon struct {
+	*PCIDevice
+}
+
 type SGuestPvpanic struct {
 	Ioport uint // default ioport 1285(0x505)
 	Id     string
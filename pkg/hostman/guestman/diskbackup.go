@@ -0,0 +1,246 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guestman
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/utils"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/hostman/hostutils"
+	"yunion.io/x/onecloud/pkg/hostman/monitor"
+	"yunion.io/x/onecloud/pkg/hostman/storageman"
+	"yunion.io/x/onecloud/pkg/httperrors"
+)
+
+const (
+	monitorCommandTimeout = 30 * time.Second
+	backupJobTimeout      = 12 * time.Hour
+)
+
+func (m *SGuestManager) DoDiskBitmapBackup(ctx context.Context, params interface{}) (jsonutils.JSONObject, error) {
+	input, ok := params.(*SDiskBackup)
+	if !ok {
+		return nil, hostutils.ParamsError
+	}
+	guest, ok := m.GetKVMServer(input.Sid)
+	if !ok {
+		return nil, httperrors.NewNotFoundError("guest %s not found", input.Sid)
+	}
+	return guest.DoDiskBitmapBackup(ctx, input)
+}
+
+func monitorCall(call func(cb monitor.StringCallback)) error {
+	res := make(chan string, 1)
+	call(func(r string) {
+		res <- r
+	})
+	select {
+	case <-time.After(monitorCommandTimeout):
+		return errors.Wrap(errors.ErrTimeout, "monitor command")
+	case r := <-res:
+		if len(r) > 0 {
+			return errors.Error(r)
+		}
+		return nil
+	}
+}
+
+func (s *SKVMGuestInstance) getDiskDrive(disk storageman.IDisk) (string, error) {
+	for i := range s.Desc.Disks {
+		if s.Desc.Disks[i].DiskId == disk.GetId() {
+			return fmt.Sprintf("drive_%d", s.Desc.Disks[i].Index), nil
+		}
+	}
+	return "", errors.Wrapf(errors.ErrNotFound, "drive of disk %s", disk.GetId())
+}
+
+func (s *SKVMGuestInstance) getBlock(drive string) (*monitor.QemuBlock, error) {
+	res := make(chan []monitor.QemuBlock, 1)
+	s.Monitor.GetBlocks(func(blocks []monitor.QemuBlock) {
+		res <- blocks
+	})
+	select {
+	case <-time.After(monitorCommandTimeout):
+		return nil, errors.Wrap(errors.ErrTimeout, "query blocks")
+	case blocks := <-res:
+		for i := range blocks {
+			if blocks[i].Device == drive {
+				return &blocks[i], nil
+			}
+		}
+	}
+	return nil, errors.Wrapf(errors.ErrNotFound, "block %s", drive)
+}
+
+type sBitmapBackupPlan struct {
+	mode string
+	// the bitmap recording the changes since the parent backup, empty for a
+	// full backup
+	readBitmap string
+	// the bitmap added atomically with the backup job, recording the changes
+	// since this backup, empty for a differential backup
+	newBitmap string
+	// the bitmaps of the former chain links which are no longer needed
+	staleBitmaps []string
+}
+
+// planBitmapBackup never clears the bitmap being read, the backup adds its
+// own bitmap instead, so a failed backup leaves the chain untouched. The
+// bitmap of the chain tip is kept until the region records a newer tip.
+func planBitmapBackup(input *storageman.SDiskBitmapBackup, bitmaps []string) sBitmapBackupPlan {
+	plan := sBitmapBackupPlan{mode: input.BackupMode}
+	if plan.mode != api.DISK_BACKUP_MODE_FULL {
+		plan.readBitmap = input.DirtyBitmap
+		if !utils.IsInStringArray(plan.readBitmap, bitmaps) {
+			// the bitmap is lost, e.g. the disk image was replaced by a snapshot
+			log.Warningf("dirty bitmap %s not found, fallback to full backup", plan.readBitmap)
+			plan.mode, plan.readBitmap = api.DISK_BACKUP_MODE_FULL, ""
+		}
+	}
+	if plan.mode != api.DISK_BACKUP_MODE_DIFFERENTIAL {
+		plan.newBitmap = input.NewDirtyBitmap
+	}
+	for _, name := range bitmaps {
+		if !strings.HasPrefix(name, api.DISK_BACKUP_DIRTY_BITMAP_PREFIX) {
+			continue
+		}
+		if name == plan.readBitmap || name == input.KeepDirtyBitmap {
+			continue
+		}
+		plan.staleBitmaps = append(plan.staleBitmaps, name)
+	}
+	return plan
+}
+
+func (s *SKVMGuestInstance) removeDirtyBitmap(drive, name string) error {
+	return monitorCall(func(cb monitor.StringCallback) {
+		s.Monitor.BlockDirtyBitmapRemove(drive, name, cb)
+	})
+}
+
+// DoDiskBitmapBackup exports the clusters changed since the parent backup,
+// which are recorded by the persistent dirty bitmap of the parent, every full
+// or incremental backup adds its own bitmap atomically with the backup job
+func (s *SKVMGuestInstance) DoDiskBitmapBackup(ctx context.Context, input *SDiskBackup) (jsonutils.JSONObject, error) {
+	if !s.IsRunning() || s.Monitor == nil {
+		return nil, httperrors.NewInvalidStatusError("guest %s is not running", s.Id)
+	}
+	drive, err := s.getDiskDrive(input.Disk)
+	if err != nil {
+		return nil, err
+	}
+	block, err := s.getBlock(drive)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := planBitmapBackup(input.SDiskBitmapBackup, block.GetDirtyBitmapNames())
+	for _, name := range plan.staleBitmaps {
+		err := s.removeDirtyBitmap(drive, name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "remove dirty bitmap %s", name)
+		}
+	}
+
+	syncMode, bitmapMode := "full", ""
+	if plan.mode != api.DISK_BACKUP_MODE_FULL {
+		// the bitmap being read is left untouched whatever the job result
+		syncMode, bitmapMode = "bitmap", "never"
+	}
+
+	backupTmpDir, err := storageman.EnsureBackupDir()
+	if err != nil {
+		return nil, errors.Wrap(err, "EnsureBackupDir")
+	}
+	defer storageman.CleanupDirOrFile(backupTmpDir)
+	target := path.Join(backupTmpDir, input.BackupId)
+
+	jobId := fmt.Sprintf("backup_%s", input.BackupId)
+	done := make(chan string, 1)
+	s.backupJobs.Store(jobId, done)
+	defer s.backupJobs.Delete(jobId)
+
+	err = monitorCall(func(cb monitor.StringCallback) {
+		s.Monitor.DriveBackupBitmap(cb, jobId, drive, target, plan.readBitmap, syncMode, bitmapMode, plan.newBitmap)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "start backup job of %s", drive)
+	}
+	succ := false
+	defer func() {
+		if succ || len(plan.newBitmap) == 0 {
+			return
+		}
+		// the backup is not recorded, its bitmap would never be read
+		err := s.removeDirtyBitmap(drive, plan.newBitmap)
+		if err != nil {
+			log.Errorf("remove dirty bitmap %s of failed backup: %v", plan.newBitmap, err)
+		}
+	}()
+	select {
+	case <-time.After(backupJobTimeout):
+		s.Monitor.CancelBlockJob(jobId, true, func(string) {})
+		return nil, errors.Wrapf(errors.ErrTimeout, "backup job %s", jobId)
+	case reason := <-done:
+		if len(reason) > 0 {
+			return nil, errors.Errorf("backup job %s: %s", jobId, reason)
+		}
+	}
+
+	sizeMb, err := storageman.SaveBitmapBackup(ctx, target, input.SDiskBitmapBackup)
+	if err != nil {
+		return nil, errors.Wrap(err, "SaveBitmapBackup")
+	}
+	succ = true
+	bitmap := plan.newBitmap
+	if len(bitmap) == 0 {
+		bitmap = plan.readBitmap
+	}
+	res := jsonutils.NewDict()
+	res.Set("size_mb", jsonutils.NewInt(int64(sizeMb)))
+	res.Set("backup_mode", jsonutils.NewString(plan.mode))
+	res.Set("dirty_bitmap", jsonutils.NewString(bitmap))
+	return res, nil
+}
+
+// eventBackupJobDone notifies the waiting dirty bitmap backup, returns false
+// if the event is not of such a job
+func (s *SKVMGuestInstance) eventBackupJobDone(event *monitor.Event) bool {
+	jobId, _ := event.Data["device"].(string)
+	done, ok := s.backupJobs.Load(jobId)
+	if !ok {
+		return false
+	}
+	reason := ""
+	if event.Event == `"BLOCK_JOB_CANCELLED"` {
+		reason = "cancelled"
+	} else if e, ok := event.Data["error"]; ok {
+		reason = fmt.Sprintf("%v", e)
+	}
+	select {
+	case done.(chan string) <- reason:
+	default:
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guestman
+
+import (
+	"reflect"
+	"testing"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/hostman/storageman"
+)
+
+func TestPlanBitmapBackup(t *testing.T) {
+	cases := []struct {
+		name    string
+		input   storageman.SDiskBitmapBackup
+		bitmaps []string
+		want    sBitmapBackupPlan
+	}{
+		{
+			name: "full keeps chain tip until recorded",
+			input: storageman.SDiskBitmapBackup{
+				BackupMode:      api.DISK_BACKUP_MODE_FULL,
+				NewDirtyBitmap:  "backup-3",
+				KeepDirtyBitmap: "backup-2",
+			},
+			bitmaps: []string{"backup-1", "backup-2", "other"},
+			want: sBitmapBackupPlan{
+				mode:         api.DISK_BACKUP_MODE_FULL,
+				newBitmap:    "backup-3",
+				staleBitmaps: []string{"backup-1"},
+			},
+		},
+		{
+			name: "incremental reads parent and adds own bitmap",
+			input: storageman.SDiskBitmapBackup{
+				BackupMode:      api.DISK_BACKUP_MODE_INCREMENTAL,
+				DirtyBitmap:     "backup-2",
+				NewDirtyBitmap:  "backup-3",
+				KeepDirtyBitmap: "backup-2",
+			},
+			bitmaps: []string{"backup-1", "backup-2", "backup-x"},
+			want: sBitmapBackupPlan{
+				mode:         api.DISK_BACKUP_MODE_INCREMENTAL,
+				readBitmap:   "backup-2",
+				newBitmap:    "backup-3",
+				staleBitmaps: []string{"backup-1", "backup-x"},
+			},
+		},
+		{
+			name: "differential adds no bitmap",
+			input: storageman.SDiskBitmapBackup{
+				BackupMode:      api.DISK_BACKUP_MODE_DIFFERENTIAL,
+				DirtyBitmap:     "backup-2",
+				NewDirtyBitmap:  "backup-3",
+				KeepDirtyBitmap: "backup-2",
+			},
+			bitmaps: []string{"backup-2"},
+			want: sBitmapBackupPlan{
+				mode:       api.DISK_BACKUP_MODE_DIFFERENTIAL,
+				readBitmap: "backup-2",
+			},
+		},
+		{
+			name: "lost bitmap falls back to full",
+			input: storageman.SDiskBitmapBackup{
+				BackupMode:      api.DISK_BACKUP_MODE_DIFFERENTIAL,
+				DirtyBitmap:     "backup-2",
+				NewDirtyBitmap:  "backup-3",
+				KeepDirtyBitmap: "backup-2",
+			},
+			bitmaps: []string{"backup-1"},
+			want: sBitmapBackupPlan{
+				mode:         api.DISK_BACKUP_MODE_FULL,
+				newBitmap:    "backup-3",
+				staleBitmaps: []string{"backup-1"},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := planBitmapBackup(&c.input, c.bitmaps)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("want %#v, got %#v", c.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guestman
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"yunion.io/x/log"
+
+	"yunion.io/x/onecloud/pkg/apis"
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/hostman/hostinfo"
+	"yunion.io/x/onecloud/pkg/hostman/hostutils"
+	"yunion.io/x/onecloud/pkg/util/fileutils2"
+	"yunion.io/x/onecloud/pkg/util/procutils"
+)
+
+// Helper daemons of a guest (swtpm, virtiofsd) run detached from the host
+// agent, so nothing reaps them. While the qemu monitor is connected their pid
+// files are polled and a dead daemon is restarted, or reported if qemu is
+// unable to reconnect to it.
+
+const guestDaemonCheckInterval = 10 * time.Second
+
+type sGuestDaemon struct {
+	name    string
+	pidFile string
+	// restart brings the daemon back, nil if qemu can't reconnect to a new one
+	restart func() error
+}
+
+type sGuestDaemonSupervisor struct {
+	lock sync.Mutex
+	stop chan struct{}
+}
+
+func isPidFileAlive(pidFile string) bool {
+	pid, _ := fileutils2.FileGetContents(pidFile)
+	pid = strings.TrimSpace(pid)
+	if len(pid) == 0 {
+		return false
+	}
+	return procutils.NewRemoteCommandAsFarAsPossible("kill", "-0", pid).Run() == nil
+}
+
+func (s *SKVMGuestInstance) getGuestDaemons() []sGuestDaemon {
+	daemons := []sGuestDaemon{}
+	if s.Desc.Tpm != nil {
+		daemons = append(daemons, sGuestDaemon{
+			name:    "swtpm",
+			pidFile: s.getSwtpmPidFilePath(),
+		})
+	}
+	for i := range s.Desc.Filesystems {
+		idx, fs := i, s.Desc.Filesystems[i]
+		daemons = append(daemons, sGuestDaemon{
+			name:    fmt.Sprintf("virtiofsd of %s", fs.Tag),
+			pidFile: s.getVirtiofsPidFilePath(idx),
+			restart: func() error {
+				return s.startVirtiofsd(idx, fs)
+			},
+		})
+	}
+	return daemons
+}
+
+func (s *SKVMGuestInstance) startGuestDaemonSupervisor() {
+	if len(s.getGuestDaemons()) == 0 {
+		return
+	}
+	sup := &s.daemonSupervisor
+	sup.lock.Lock()
+	defer sup.lock.Unlock()
+	if sup.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	sup.stop = stop
+	go s.superviseGuestDaemons(stop)
+}
+
+func (s *SKVMGuestInstance) stopGuestDaemonSupervisor() {
+	sup := &s.daemonSupervisor
+	sup.lock.Lock()
+	defer sup.lock.Unlock()
+	if sup.stop != nil {
+		close(sup.stop)
+		sup.stop = nil
+	}
+}
+
+func (s *SKVMGuestInstance) superviseGuestDaemons(stop chan struct{}) {
+	ticker := time.NewTicker(guestDaemonCheckInterval)
+	defer ticker.Stop()
+	// daemons already reported dead, avoid reporting them every round
+	reported := map[string]bool{}
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if !s.IsRunning() {
+				continue
+			}
+			for _, daemon := range s.getGuestDaemons() {
+				s.checkGuestDaemon(daemon, reported)
+			}
+		}
+	}
+}
+
+func (s *SKVMGuestInstance) checkGuestDaemon(daemon sGuestDaemon, reported map[string]bool) {
+	if isPidFileAlive(daemon.pidFile) {
+		delete(reported, daemon.name)
+		return
+	}
+	if daemon.restart != nil {
+		log.Warningf("guest %s %s exited, restarting", s.GetName(), daemon.name)
+		if err := daemon.restart(); err != nil {
+			log.Errorf("guest %s restart %s: %v", s.GetName(), daemon.name, err)
+		}
+		return
+	}
+	if reported[daemon.name] {
+		return
+	}
+	reported[daemon.name] = true
+	log.Errorf("guest %s %s exited, it is unavailable until the guest restarts", s.GetName(), daemon.name)
+	statusInput := &apis.PerformStatusInput{
+		Status:      api.VM_RUNNING,
+		Reason:      daemon.name + " exited unexpectedly",
+		PowerStates: GetPowerStates(s),
+		HostId:      hostinfo.Instance().HostId,
+	}
+	if _, err := hostutils.UpdateServerStatus(context.Background(), s.Id, statusInput); err != nil {
+		log.Errorf("failed update guest status %s", err)
+	}
+}
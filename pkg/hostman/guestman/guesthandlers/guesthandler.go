@@ -74,6 +74,7 @@ func AddGuestTaskHandler(prefix string, app *appsrv.Application) {
 			"io-throttle":              guestIoThrottle,
 			"snapshot":                 guestSnapshot,
 			"delete-snapshot":          guestDeleteSnapshot,
+			"disk-backup":              guestDiskBackup,
 			"reload-disk-snapshot":     guestReloadDiskSnapshot,
 			"src-prepare-migrate":      guestSrcPrepareMigrate,
 			"dest-prepare-migrate":     guestDestPrepareMigrate,
@@ -107,6 +108,10 @@ func AddGuestTaskHandler(prefix string, app *appsrv.Application) {
 			"qga-set-network":          qgaSetNetwork,
 			"qga-get-os-info":          qgaGetOsInfo,
 			"start-rescue":             guestStartRescue,
+			"vtpm-export":              guestVtpmExport,
+			"vtpm-import":              guestVtpmImport,
+			"vtpm-backup":              guestVtpmBackup,
+			"vtpm-restore":             guestVtpmRestore,
 		} {
 			app.AddHandler("POST",
 				fmt.Sprintf("%s/%s/<sid>/%s", prefix, keyWord, action),
@@ -435,6 +440,7 @@ func guestDestPrepareMigrateInternal(ctx context.Context, userCred mcclient.Toke
 	params.MemorySnapshotsUri = msUri
 	msIds, _ := jsonutils.GetStringArray(body, "src_memory_snapshots")
 	params.SrcMemorySnapshots = msIds
+	params.VtpmState, _ = body.GetString("vtpm_state")
 
 	params.UserCred = userCred
 
@@ -694,6 +700,52 @@ func guestSnapshot(ctx context.Context, userCred mcclient.TokenCredential, sid s
 	return nil, nil
 }
 
+func guestDiskBackup(ctx context.Context, userCred mcclient.TokenCredential, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	diskId, err := body.GetString("disk_id")
+	if err != nil {
+		return nil, httperrors.NewMissingParameterError("disk_id")
+	}
+	backupInfo := &storageman.SDiskBitmapBackup{}
+	err = body.Unmarshal(backupInfo)
+	if err != nil {
+		return nil, httperrors.NewInputParameterError("unmarshal backup info: %v", err)
+	}
+	for k, v := range map[string]string{
+		"backup_id":         backupInfo.BackupId,
+		"backup_storage_id": backupInfo.BackupStorageId,
+		"backup_mode":       backupInfo.BackupMode,
+		"new_dirty_bitmap":  backupInfo.NewDirtyBitmap,
+	} {
+		if len(v) == 0 {
+			return nil, httperrors.NewMissingParameterError(k)
+		}
+	}
+	guest, ok := guestman.GetGuestManager().GetKVMServer(sid)
+	if !ok {
+		return nil, httperrors.NewNotFoundError("guest %s not found", sid)
+	}
+	var disk storageman.IDisk
+	for _, d := range guest.GetDesc().Disks {
+		if diskId == d.DiskId {
+			disk, err = storageman.GetManager().GetDiskById(diskId)
+			if err != nil {
+				return nil, errors.Wrapf(err, "GetDiskById(%s)", diskId)
+			}
+			break
+		}
+	}
+	if disk == nil {
+		return nil, httperrors.NewNotFoundError("Disk not found")
+	}
+	backupInfo.UserCred = userCred
+	hostutils.DelayTask(ctx, guestman.GetGuestManager().DoDiskBitmapBackup, &guestman.SDiskBackup{
+		SDiskBitmapBackup: backupInfo,
+		Sid:               sid,
+		Disk:              disk,
+	})
+	return nil, nil
+}
+
 func guestDeleteSnapshot(ctx context.Context, userCred mcclient.TokenCredential, sid string, body jsonutils.JSONObject) (interface{}, error) {
 	deleteSnapshot, err := body.GetString("delete_snapshot")
 	if err != nil {
@@ -993,3 +1045,67 @@ func qgaGetOsInfo(ctx context.Context, userCred mcclient.TokenCredential, sid st
 func guestStartRescue(ctx context.Context, userCred mcclient.TokenCredential, sid string, body jsonutils.JSONObject) (interface{}, error) {
 	return guestman.GetGuestManager().GuestStartRescue(ctx, userCred, sid, body)
 }
+
+func guestVtpmExport(ctx context.Context, userCred mcclient.TokenCredential, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	guest, err := guestman.GetGuestManager().GetVtpmServer(sid)
+	if err != nil {
+		return nil, err
+	}
+	return guest.ExportVtpmState()
+}
+
+func guestVtpmImport(ctx context.Context, userCred mcclient.TokenCredential, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	input := new(hostapi.GuestVtpmState)
+	if err := body.Unmarshal(input); err != nil {
+		return nil, httperrors.NewInputParameterError("unmarshal input: %v", err)
+	}
+	if len(input.State) == 0 {
+		return nil, httperrors.NewMissingParameterError("state")
+	}
+	guest, err := guestman.GetGuestManager().GetVtpmServer(sid)
+	if err != nil {
+		return nil, err
+	}
+	return nil, guest.ImportVtpmState(input)
+}
+
+func fetchVtpmBackupInput(body jsonutils.JSONObject) (*hostapi.GuestVtpmBackupRequest, error) {
+	input := new(hostapi.GuestVtpmBackupRequest)
+	if err := body.Unmarshal(input); err != nil {
+		return nil, httperrors.NewInputParameterError("unmarshal input: %v", err)
+	}
+	if len(input.BackupId) == 0 {
+		return nil, httperrors.NewMissingParameterError("backup_id")
+	}
+	if len(input.BackupStorageId) == 0 {
+		return nil, httperrors.NewMissingParameterError("backup_storage_id")
+	}
+	if input.BackupStorageAccessInfo == nil {
+		return nil, httperrors.NewMissingParameterError("backup_storage_access_info")
+	}
+	return input, nil
+}
+
+func guestVtpmBackup(ctx context.Context, userCred mcclient.TokenCredential, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	input, err := fetchVtpmBackupInput(body)
+	if err != nil {
+		return nil, err
+	}
+	guest, err := guestman.GetGuestManager().GetVtpmServer(sid)
+	if err != nil {
+		return nil, err
+	}
+	return nil, guest.BackupVtpmState(ctx, input)
+}
+
+func guestVtpmRestore(ctx context.Context, userCred mcclient.TokenCredential, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	input, err := fetchVtpmBackupInput(body)
+	if err != nil {
+		return nil, err
+	}
+	guest, err := guestman.GetGuestManager().GetVtpmServer(sid)
+	if err != nil {
+		return nil, err
+	}
+	return nil, guest.RestoreVtpmState(ctx, input)
+}
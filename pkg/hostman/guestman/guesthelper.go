@@ -76,6 +76,9 @@ type SDestPrepareMigrate struct {
 	MemorySnapshotsUri string
 	SrcMemorySnapshots []string
 
+	// TPM state of the guest for cold migration
+	VtpmState string
+
 	UserCred mcclient.TokenCredential
 }
 
@@ -138,10 +141,9 @@ type SMemorySnapshotDelete struct {
 }
 
 type SDiskBackup struct {
-	Sid        string
-	SnapshotId string
-	BackupId   string
-	Disk       storageman.IDisk
+	*storageman.SDiskBitmapBackup
+	Sid  string
+	Disk storageman.IDisk
 }
 
 type SDeleteDiskSnapshot struct {
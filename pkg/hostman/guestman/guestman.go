@@ -110,6 +110,8 @@ type SGuestManager struct {
 
 	// container related members
 	containerProbeManager prober.Manager
+
+	ioQos *sIoQosController
 }
 
 func NewGuestManager(host hostutils.IHost, serversPath string) (*SGuestManager, error) {
@@ -122,6 +124,7 @@ func NewGuestManager(host hostutils.IHost, serversPath string) (*SGuestManager,
 	manager.UnknownServers = new(sync.Map)
 	manager.ServersLock = &sync.Mutex{}
 	manager.TrafficLock = &sync.Mutex{}
+	manager.ioQos = newIoQosController()
 	manager.GuestStartWorker = appsrv.NewWorkerManager("GuestStart", 1, appsrv.DEFAULT_BACKLOG, false)
 
 	// manager.StartCpusetBalancer()
@@ -358,6 +361,9 @@ func (m *SGuestManager) OnLoadExistingGuestsComplete() {
 	}
 
 	go m.verifyDirtyServers()
+	m.startMemBalloonController()
+	m.startIoQosController()
+	m.startOvnAclLogCollector()
 
 	if !options.HostOptions.EnableCpuBinding {
 		m.ClenaupCpuset()
@@ -1013,12 +1019,19 @@ func (m *SGuestManager) GuestIoThrottle(ctx context.Context, params interface{})
 		if iops, ok := guestIoThrottle.Input.IOPS[diskId]; ok {
 			guest.GetDesc().Disks[i].Iops = iops
 		}
+		if bpsMin, ok := guestIoThrottle.Input.BpsMin[diskId]; ok {
+			guest.GetDesc().Disks[i].BpsMin = bpsMin
+		}
+		if iopsMin, ok := guestIoThrottle.Input.IopsMin[diskId]; ok {
+			guest.GetDesc().Disks[i].IopsMin = iopsMin
+		}
 	}
 	if err := SaveLiveDesc(guest, guest.GetDesc()); err != nil {
 		return nil, errors.Wrap(err, "guest save desc")
 	}
 
 	if guest.IsRunning() {
+		m.resetGuestIoQos(guest)
 		guest.BlockIoThrottle(ctx)
 		return nil, nil
 	}
@@ -1134,6 +1147,13 @@ func (m *SGuestManager) DestPrepareMigrate(ctx context.Context, params interface
 		body.Add(jsonutils.Marshal(preparedMs), "dest_prepared_memory_snapshots")
 	}
 
+	if !migParams.LiveMigrate && len(migParams.VtpmState) > 0 {
+		err := guest.ImportVtpmState(&hostapi.GuestVtpmState{State: migParams.VtpmState})
+		if err != nil {
+			return nil, errors.Wrap(err, "import vtpm state")
+		}
+	}
+
 	if migParams.LiveMigrate {
 		startParams := jsonutils.NewDict()
 		startParams.Set("qemu_version", jsonutils.NewString(migParams.QemuVersion))
@@ -2601,6 +2601,12 @@ func (task *SGuestHotplugCpuMemTask) onGetSlotIndex(index int) {
 			opts["policy"] = "bind"
 		}
 
+	} else if task.needSharedMem() {
+		objType = "memory-backend-memfd"
+		opts = map[string]string{
+			"size":  fmt.Sprintf("%dM", task.addMemSize),
+			"share": "on",
+		}
 	} else {
 		objType = "memory-backend-ram"
 		opts = map[string]string{
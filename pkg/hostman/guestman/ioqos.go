@@ -0,0 +1,443 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guestman
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/hostman/monitor"
+	"yunion.io/x/onecloud/pkg/hostman/options"
+)
+
+// The io qos controller samples block stats of running guests and adjusts
+// their disk throttles. When the average io latency of the host exceeds
+// IoQosLatencyThresholdMs, busy disks are tightened step by step but never
+// below their iops_min/bps_min, otherwise limits are relaxed back to the
+// static io throttle of the disk. Disks of a project sharing an io budget of
+// the host are capped to the budget proportionally to their usage.
+
+const (
+	IO_QOS_REASON_BUDGET     = "budget"
+	IO_QOS_REASON_CONTENTION = "contention"
+	IO_QOS_REASON_RELAX      = "relax"
+)
+
+// SIoQosDecision is the io limit of a guest disk decided by the controller
+type SIoQosDecision struct {
+	GuestId   string
+	GuestName string
+	ProjectId string
+	DiskId    string
+	Drive     string
+
+	Iops      float64
+	Bps       float64
+	LatencyMs float64
+
+	// 0 means unlimited
+	IopsLimit int64
+	BpsLimit  int64
+	Reason    string
+}
+
+type ioQosSample struct {
+	stats monitor.BlockStats
+	at    time.Time
+}
+
+type ioQosDisk struct {
+	guest     *SKVMGuestInstance
+	projectId string
+	diskId    string
+	drive     string
+
+	// static limits and minimums of the disk, 0 means unlimited
+	bps, iops       int64
+	bpsMin, iopsMin int64
+
+	// rates measured in the last interval
+	bpsRate, iopsRate float64
+	latencyMs         float64
+
+	// limits currently applied and planned by the controller
+	curBps, curIops int64
+	newBps, newIops int64
+	reason          string
+}
+
+type sIoQosController struct {
+	lock sync.Mutex
+
+	budgets   map[string]api.HostIoQosBudget
+	samples   map[string]ioQosSample
+	applied   map[string][2]int64
+	decisions []SIoQosDecision
+}
+
+func newIoQosController() *sIoQosController {
+	return &sIoQosController{
+		budgets: map[string]api.HostIoQosBudget{},
+		samples: map[string]ioQosSample{},
+		applied: map[string][2]int64{},
+	}
+}
+
+// SetIoQosBudgets updates project io budgets of the host, sent by region on host ping
+func (m *SGuestManager) SetIoQosBudgets(budgets []api.HostIoQosBudget) {
+	ret := map[string]api.HostIoQosBudget{}
+	for _, budget := range budgets {
+		if len(budget.ProjectId) > 0 {
+			ret[budget.ProjectId] = budget
+		}
+	}
+	m.ioQos.lock.Lock()
+	defer m.ioQos.lock.Unlock()
+	m.ioQos.budgets = ret
+}
+
+// GetIoQosDecisions returns the io limits decided by the last round of the controller
+func (m *SGuestManager) GetIoQosDecisions() []SIoQosDecision {
+	m.ioQos.lock.Lock()
+	defer m.ioQos.lock.Unlock()
+	return m.ioQos.decisions
+}
+
+// resetGuestIoQos forgets the limits applied to the guest disks, which are
+// overwritten by the static io throttle
+func (m *SGuestManager) resetGuestIoQos(guest *SKVMGuestInstance) {
+	m.ioQos.lock.Lock()
+	defer m.ioQos.lock.Unlock()
+	for _, disk := range guest.Desc.Disks {
+		delete(m.ioQos.applied, ioQosDiskKey(guest.GetId(), disk.Index))
+	}
+}
+
+func ioQosDiskKey(guestId string, index int8) string {
+	return fmt.Sprintf("%s/drive_%d", guestId, index)
+}
+
+func (s *SKVMGuestInstance) queryBlockStats() ([]monitor.BlockStats, error) {
+	type result struct {
+		stats []monitor.BlockStats
+		err   string
+	}
+	res := make(chan result, 1)
+	s.Monitor.GetBlockStats(func(stats []monitor.BlockStats, err string) {
+		res <- result{stats, err}
+	})
+	select {
+	case <-time.After(monitorCommandTimeout):
+		return nil, errors.Wrap(errors.ErrTimeout, "query blockstats")
+	case r := <-res:
+		if len(r.err) > 0 {
+			return nil, errors.Error(r.err)
+		}
+		return r.stats, nil
+	}
+}
+
+// queryBlockThrottles reads the io throttles in effect from qemu, keyed by drive
+func (s *SKVMGuestInstance) queryBlockThrottles() (map[string][2]int64, error) {
+	res := make(chan []monitor.QemuBlock, 1)
+	s.Monitor.GetBlocks(func(blocks []monitor.QemuBlock) {
+		res <- blocks
+	})
+	select {
+	case <-time.After(monitorCommandTimeout):
+		return nil, errors.Wrap(errors.ErrTimeout, "query block")
+	case blocks := <-res:
+		if blocks == nil {
+			return nil, errors.Error("query block failed")
+		}
+		ret := map[string][2]int64{}
+		for i := range blocks {
+			ret[blocks[i].Device] = [2]int64{blocks[i].Inserted.Bps, blocks[i].Inserted.Iops}
+		}
+		return ret, nil
+	}
+}
+
+// currentIoThrottle returns the bps and iops limits in effect on a disk: the
+// ones applied by the controller, else the live ones read from qemu, which
+// survive a restart of the host agent, else the static io throttle of the disk
+func currentIoThrottle(key, drive string, static [2]int64, applied, live map[string][2]int64) [2]int64 {
+	if cur, ok := applied[key]; ok {
+		return cur
+	}
+	if cur, ok := live[drive]; ok {
+		return cur
+	}
+	return static
+}
+
+func (m *SGuestManager) startIoQosController() {
+	if !options.HostOptions.EnableIoQosController {
+		return
+	}
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				debug.PrintStack()
+				log.Errorf("Io qos controller failed %s", r)
+			}
+		}()
+		interval := time.Duration(options.HostOptions.IoQosCheckIntervalSeconds) * time.Second
+		for {
+			time.Sleep(interval)
+			if err := m.adjustIoQos(); err != nil {
+				log.Errorf("adjust io qos: %s", err)
+			}
+		}
+	}()
+}
+
+func (m *SGuestManager) collectIoQosDisks() []*ioQosDisk {
+	disks := make([]*ioQosDisk, 0)
+	samples := map[string]ioQosSample{}
+	m.Servers.Range(func(k, v interface{}) bool {
+		guest, ok := v.(*SKVMGuestInstance)
+		if !ok || !guest.IsRunning() || guest.Monitor == nil {
+			return true
+		}
+		stats, err := guest.queryBlockStats()
+		if err != nil {
+			log.Warningf("guest %s query blockstats: %s", guest.GetName(), err)
+			return true
+		}
+		// limits left by a previous controller are unknown after a restart
+		var live map[string][2]int64
+		for _, d := range guest.Desc.Disks {
+			if _, ok := m.ioQos.applied[ioQosDiskKey(guest.GetId(), d.Index)]; !ok {
+				live, err = guest.queryBlockThrottles()
+				if err != nil {
+					log.Warningf("guest %s query block: %s", guest.GetName(), err)
+				}
+				break
+			}
+		}
+		now := time.Now()
+		statsMap := map[string]monitor.BlockStats{}
+		for i := range stats {
+			statsMap[stats[i].Device] = stats[i]
+		}
+		for _, d := range guest.Desc.Disks {
+			drive := fmt.Sprintf("drive_%d", d.Index)
+			stat, ok := statsMap[drive]
+			if !ok {
+				continue
+			}
+			key := ioQosDiskKey(guest.GetId(), d.Index)
+			samples[key] = ioQosSample{stats: stat, at: now}
+			disk := &ioQosDisk{
+				guest:     guest,
+				diskId:    d.DiskId,
+				drive:     drive,
+				bps:       int64(d.Bps),
+				iops:      int64(d.Iops),
+				bpsMin:    int64(d.BpsMin),
+				iopsMin:   int64(d.IopsMin),
+				projectId: guest.Desc.TenantId,
+			}
+			cur := currentIoThrottle(key, drive, [2]int64{disk.bps, disk.iops}, m.ioQos.applied, live)
+			disk.curBps, disk.curIops = cur[0], cur[1]
+			prev, ok := m.ioQos.samples[key]
+			if !ok {
+				continue
+			}
+			dt := now.Sub(prev.at).Seconds()
+			if dt <= 0 {
+				continue
+			}
+			ops := (stat.RdOperations - prev.stats.RdOperations) + (stat.WrOperations - prev.stats.WrOperations)
+			bytes := (stat.RdBytes - prev.stats.RdBytes) + (stat.WrBytes - prev.stats.WrBytes)
+			if ops < 0 || bytes < 0 {
+				// guest restarted, counters are reset
+				continue
+			}
+			disk.iopsRate = float64(ops) / dt
+			disk.bpsRate = float64(bytes) / dt
+			if ops > 0 {
+				timeNs := (stat.RdTotalTimeNs - prev.stats.RdTotalTimeNs) + (stat.WrTotalTimeNs - prev.stats.WrTotalTimeNs)
+				disk.latencyMs = float64(timeNs) / float64(ops) / 1e6
+			}
+			disks = append(disks, disk)
+		}
+		return true
+	})
+	m.ioQos.samples = samples
+	return disks
+}
+
+func (m *SGuestManager) adjustIoQos() error {
+	m.ioQos.lock.Lock()
+	defer m.ioQos.lock.Unlock()
+
+	disks := m.collectIoQosDisks()
+	planIoQos(disks, m.ioQos.budgets, float64(options.HostOptions.IoQosLatencyThresholdMs), int64(options.HostOptions.IoQosStepPercent))
+
+	decisions := make([]SIoQosDecision, 0, len(disks))
+	for _, disk := range disks {
+		key := fmt.Sprintf("%s/%s", disk.guest.GetId(), disk.drive)
+		// keep the limits read from qemu even if reapplying them fails
+		m.ioQos.applied[key] = [2]int64{disk.curBps, disk.curIops}
+		if disk.newBps != disk.curBps || disk.newIops != disk.curIops {
+			err := monitorCall(func(cb monitor.StringCallback) {
+				disk.guest.Monitor.BlockIoThrottle(disk.drive, disk.newBps, disk.newIops, cb)
+			})
+			if err != nil {
+				log.Errorf("guest %s %s set io throttle: %s", disk.guest.GetName(), disk.drive, err)
+				continue
+			}
+			log.Infof("guest %s %s io throttle set to bps %d iops %d: %s", disk.guest.GetName(), disk.drive, disk.newBps, disk.newIops, disk.reason)
+		}
+		m.ioQos.applied[key] = [2]int64{disk.newBps, disk.newIops}
+		decisions = append(decisions, SIoQosDecision{
+			GuestId:   disk.guest.GetId(),
+			GuestName: disk.guest.GetName(),
+			ProjectId: disk.projectId,
+			DiskId:    disk.diskId,
+			Drive:     disk.drive,
+			Iops:      disk.iopsRate,
+			Bps:       disk.bpsRate,
+			LatencyMs: disk.latencyMs,
+			IopsLimit: disk.newIops,
+			BpsLimit:  disk.newBps,
+			Reason:    disk.reason,
+		})
+	}
+	m.ioQos.decisions = decisions
+	return nil
+}
+
+// minLimit returns the tighter one of two limits, 0 means unlimited
+func minLimit(a, b int64) int64 {
+	if a <= 0 {
+		return b
+	}
+	if b <= 0 || a < b {
+		return a
+	}
+	return b
+}
+
+// clampLimit keeps the limit between the disk minimum and its static limit
+func clampLimit(limit, min, static int64) int64 {
+	limit = minLimit(limit, static)
+	if limit > 0 && limit < min {
+		limit = min
+	}
+	return limit
+}
+
+func tightenLimit(cur int64, rate float64, min int64, step int64) int64 {
+	if rate <= float64(min) {
+		return cur
+	}
+	limit := int64(rate) * (100 - step) / 100
+	if limit < min {
+		limit = min
+	}
+	return minLimit(cur, limit)
+}
+
+func relaxLimit(cur int64, rate float64, static int64, step int64) int64 {
+	if cur <= 0 {
+		return cur
+	}
+	if static <= 0 && rate < float64(cur*(100-step)/100) {
+		// the disk does not press against its limit anymore
+		return 0
+	}
+	return minLimit(cur*(100+step)/100+1, static)
+}
+
+// planIoQos decides the new limits of disks
+func planIoQos(disks []*ioQosDisk, budgets map[string]api.HostIoQosBudget, latencyThresholdMs float64, step int64) {
+	var totalOps, weightedLatency float64
+	for _, disk := range disks {
+		totalOps += disk.iopsRate
+		weightedLatency += disk.iopsRate * disk.latencyMs
+	}
+	contended := totalOps > 0 && weightedLatency/totalOps > latencyThresholdMs
+
+	for _, disk := range disks {
+		disk.newBps, disk.newIops = disk.curBps, disk.curIops
+		if contended {
+			disk.newBps = tightenLimit(disk.curBps, disk.bpsRate, disk.bpsMin, step)
+			disk.newIops = tightenLimit(disk.curIops, disk.iopsRate, disk.iopsMin, step)
+			if disk.newBps != disk.curBps || disk.newIops != disk.curIops {
+				disk.reason = IO_QOS_REASON_CONTENTION
+			}
+		} else {
+			disk.newBps = relaxLimit(disk.curBps, disk.bpsRate, disk.bps, step)
+			disk.newIops = relaxLimit(disk.curIops, disk.iopsRate, disk.iops, step)
+			if disk.newBps != disk.curBps || disk.newIops != disk.curIops {
+				disk.reason = IO_QOS_REASON_RELAX
+			}
+		}
+	}
+
+	projectDisks := map[string][]*ioQosDisk{}
+	for _, disk := range disks {
+		if _, ok := budgets[disk.projectId]; ok {
+			projectDisks[disk.projectId] = append(projectDisks[disk.projectId], disk)
+		}
+	}
+	for projectId, pDisks := range projectDisks {
+		budget := budgets[projectId]
+		var bpsSum, iopsSum float64
+		for _, disk := range pDisks {
+			bpsSum += disk.bpsRate
+			iopsSum += disk.iopsRate
+		}
+		for _, disk := range pDisks {
+			bpsCap := budgetCap(int64(budget.Bps), disk.bpsRate, bpsSum, len(pDisks))
+			iopsCap := budgetCap(int64(budget.Iops), disk.iopsRate, iopsSum, len(pDisks))
+			newBps, newIops := minLimit(disk.newBps, bpsCap), minLimit(disk.newIops, iopsCap)
+			if newBps != disk.newBps || newIops != disk.newIops {
+				disk.newBps, disk.newIops = newBps, newIops
+				disk.reason = IO_QOS_REASON_BUDGET
+			}
+		}
+	}
+
+	for _, disk := range disks {
+		disk.newBps = clampLimit(disk.newBps, disk.bpsMin, disk.bps)
+		disk.newIops = clampLimit(disk.newIops, disk.iopsMin, disk.iops)
+	}
+}
+
+// budgetCap shares the project budget among its disks, a disk gets the
+// budget proportional to its usage when the project exceeds the budget,
+// otherwise it may use the headroom left
+func budgetCap(budget int64, rate, sum float64, count int) int64 {
+	if budget <= 0 {
+		return 0
+	}
+	if sum <= 0 {
+		return budget / int64(count)
+	}
+	if sum > float64(budget) {
+		return int64(float64(budget) * rate / sum)
+	}
+	return int64(rate + float64(budget) - sum)
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guestman
+
+import (
+	"testing"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+)
+
+func TestPlanIoQos(t *testing.T) {
+	t.Run("contention keeps minimum", func(t *testing.T) {
+		busy := &ioQosDisk{iopsRate: 1000, latencyMs: 50, iopsMin: 900, bpsRate: 1 << 20}
+		idle := &ioQosDisk{iopsRate: 10, latencyMs: 50, iopsMin: 100}
+		planIoQos([]*ioQosDisk{busy, idle}, nil, 20, 20)
+		if busy.newIops != 900 || busy.reason != IO_QOS_REASON_CONTENTION {
+			t.Errorf("busy disk iops limit %d reason %s", busy.newIops, busy.reason)
+		}
+		if busy.newBps != (1<<20)*80/100 {
+			t.Errorf("busy disk bps limit %d", busy.newBps)
+		}
+		if idle.newIops != 0 || len(idle.reason) > 0 {
+			t.Errorf("idle disk should not be limited, got %d", idle.newIops)
+		}
+	})
+	t.Run("relax to static", func(t *testing.T) {
+		disk := &ioQosDisk{iopsRate: 500, latencyMs: 1, iops: 1000, curIops: 900}
+		planIoQos([]*ioQosDisk{disk}, nil, 20, 20)
+		if disk.newIops != 1000 || disk.reason != IO_QOS_REASON_RELAX {
+			t.Errorf("disk iops limit %d reason %s", disk.newIops, disk.reason)
+		}
+		unlimited := &ioQosDisk{iopsRate: 10, latencyMs: 1, curIops: 900}
+		planIoQos([]*ioQosDisk{unlimited}, nil, 20, 20)
+		if unlimited.newIops != 0 {
+			t.Errorf("disk should be unlimited, got %d", unlimited.newIops)
+		}
+	})
+	t.Run("project budget", func(t *testing.T) {
+		budgets := map[string]api.HostIoQosBudget{"p1": {ProjectId: "p1", Iops: 1000}}
+		d1 := &ioQosDisk{projectId: "p1", iopsRate: 1500, latencyMs: 1}
+		d2 := &ioQosDisk{projectId: "p1", iopsRate: 500, latencyMs: 1, iopsMin: 400}
+		other := &ioQosDisk{projectId: "p2", iopsRate: 3000, latencyMs: 1}
+		planIoQos([]*ioQosDisk{d1, d2, other}, budgets, 20, 20)
+		if d1.newIops != 750 || d1.reason != IO_QOS_REASON_BUDGET {
+			t.Errorf("d1 iops limit %d reason %s", d1.newIops, d1.reason)
+		}
+		if d2.newIops != 400 {
+			t.Errorf("d2 should keep its minimum, got %d", d2.newIops)
+		}
+		if other.newIops != 0 {
+			t.Errorf("other project should not be limited, got %d", other.newIops)
+		}
+	})
+}
+
+func TestCurrentIoThrottle(t *testing.T) {
+	static := [2]int64{100 << 20, 1000}
+	applied := map[string][2]int64{"g1/drive_0": {50 << 20, 500}}
+	live := map[string][2]int64{"drive_0": {80 << 20, 800}, "drive_1": {60 << 20, 600}}
+	cases := []struct {
+		name    string
+		key     string
+		drive   string
+		applied map[string][2]int64
+		live    map[string][2]int64
+		want    [2]int64
+	}{
+		{"applied", "g1/drive_0", "drive_0", applied, live, [2]int64{50 << 20, 500}},
+		{"live after restart", "g1/drive_1", "drive_1", applied, live, [2]int64{60 << 20, 600}},
+		{"query failed", "g1/drive_1", "drive_1", applied, nil, static},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := currentIoThrottle(c.key, c.drive, static, c.applied, c.live)
+			if got != c.want {
+				t.Errorf("want %v, got %v", c.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,359 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guestman
+
+import (
+	"context"
+	"io"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/hostman/guestman/desc"
+	"yunion.io/x/onecloud/pkg/hostman/hostutils"
+	"yunion.io/x/onecloud/pkg/hostman/options"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/logclient"
+	"yunion.io/x/onecloud/pkg/util/ovnutils"
+)
+
+// The ovn acl log collector follows the log file of ovn-controller and
+// sends acl log entries of security group rules with logging enabled to
+// logger service.  Entries of the same flow read in one round are counted
+// as one, and each guest gets at most one acl_log action log per round.
+
+// max bytes of ovn-controller log read per round, older ones are skipped
+const ovnAclLogMaxReadBytes = 4 * 1024 * 1024
+
+// max distinct flows of a guest sent per round, the rest are only counted
+const ovnAclLogMaxFlows = 64
+
+// SOvnAclLogBatchNotes is the notes of an acl_log action log
+type SOvnAclLogBatchNotes struct {
+	Flows []*SOvnAclLogNotes `json:"flows"`
+	// number of log entries of flows not in Flows
+	Skipped int `json:"skipped"`
+}
+
+// SOvnAclLogNotes is acl log entries of a flow
+type SOvnAclLogNotes struct {
+	// time of the first and the last entry
+	Time     string `json:"time"`
+	LastTime string `json:"last_time"`
+	Count    int    `json:"count"`
+
+	Ifname    string `json:"ifname"`
+	Mac       string `json:"mac"`
+	Ip        string `json:"ip"`
+	NetworkId string `json:"network_id"`
+
+	// empty for the implicit rules of the guest
+	RuleId    string `json:"rule_id"`
+	Verdict   string `json:"verdict"`
+	Direction string `json:"direction"`
+
+	Protocol string `json:"protocol"`
+	SrcIp    string `json:"src_ip"`
+	DstIp    string `json:"dst_ip"`
+	// empty when entries of the flow come from different source ports
+	SrcPort string `json:"src_port"`
+	DstPort string `json:"dst_port"`
+}
+
+// flowKey identifies a flow regardless of its source port, which is
+// usually an ephemeral one
+func (n *SOvnAclLogNotes) flowKey() string {
+	return strings.Join([]string{
+		n.Mac, n.RuleId, n.Verdict, n.Direction, n.Protocol, n.SrcIp, n.DstIp, n.DstPort,
+	}, "/")
+}
+
+type ovnAclLogBatch struct {
+	guest *ovnAclLogGuest
+	notes *SOvnAclLogBatchNotes
+	flows map[string]*SOvnAclLogNotes
+}
+
+type ovnAclLogGuest struct {
+	id    string
+	name  string
+	owner *db.SOwnerId
+}
+
+func (g *ovnAclLogGuest) GetId() string {
+	return g.id
+}
+
+func (g *ovnAclLogGuest) GetName() string {
+	return g.name
+}
+
+func (g *ovnAclLogGuest) Keyword() string {
+	return "server"
+}
+
+func (g *ovnAclLogGuest) GetOwnerId() mcclient.IIdentityProvider {
+	return g.owner
+}
+
+type ovnAclLogNic struct {
+	guest *ovnAclLogGuest
+	nic   *desc.SGuestNetwork
+}
+
+type ovnAclLogReader struct {
+	path   string
+	file   *os.File
+	ino    uint64
+	offset int64
+	// incomplete last line
+	partial string
+}
+
+// readLines returns lines appended since the last call.  The file is
+// reopened when rotated and read from the start when truncated
+func (r *ovnAclLogReader) readLines() ([]string, error) {
+	fi, err := os.Stat(r.path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "stat %s", r.path)
+	}
+	var ino uint64
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		ino = st.Ino
+	}
+	if r.file == nil || r.ino != ino {
+		file, err := os.Open(r.path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "open %s", r.path)
+		}
+		if r.file == nil {
+			// skip history on start
+			r.offset = fi.Size()
+		} else {
+			r.file.Close()
+			r.offset = 0
+		}
+		r.file = file
+		r.ino = ino
+		r.partial = ""
+	} else if fi.Size() < r.offset {
+		r.offset = 0
+		r.partial = ""
+	}
+
+	size := fi.Size() - r.offset
+	if size <= 0 {
+		return nil, nil
+	}
+	if size > ovnAclLogMaxReadBytes {
+		log.Warningf("ovn acl log: skip %d bytes of %s", size-ovnAclLogMaxReadBytes, r.path)
+		r.offset = fi.Size() - ovnAclLogMaxReadBytes
+		r.partial = ""
+		size = ovnAclLogMaxReadBytes
+	}
+	buf := make([]byte, size)
+	n, err := r.file.ReadAt(buf, r.offset)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrapf(err, "read %s", r.path)
+	}
+	r.offset += int64(n)
+
+	lines := strings.Split(r.partial+string(buf[:n]), "\n")
+	r.partial = lines[len(lines)-1]
+	return lines[:len(lines)-1], nil
+}
+
+func (m *SGuestManager) startOvnAclLogCollector() {
+	if !options.HostOptions.EnableOvnAclLog {
+		return
+	}
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				debug.PrintStack()
+				log.Errorf("Ovn acl log collector failed %s", r)
+			}
+		}()
+		reader := &ovnAclLogReader{
+			path: options.HostOptions.OvnControllerLogPath,
+		}
+		interval := time.Duration(options.HostOptions.OvnAclLogIntervalSeconds) * time.Second
+		for {
+			time.Sleep(interval)
+			if err := m.collectOvnAclLog(reader); err != nil {
+				log.Errorf("collect ovn acl log: %s", err)
+			}
+		}
+	}()
+}
+
+func (m *SGuestManager) collectOvnAclLog(reader *ovnAclLogReader) error {
+	lines, err := reader.readLines()
+	if err != nil {
+		return err
+	}
+	var entries []*ovnutils.SAclLog
+	for _, line := range lines {
+		if entry, ok := ovnutils.ParseAclLog(line); ok {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	batches := aggregateOvnAclLog(entries, m.ovnNicsByMac())
+	if len(batches) == 0 {
+		return nil
+	}
+	userCred := hostutils.GetComputeSession(context.Background()).GetToken()
+	for _, batch := range batches {
+		// dropped packets are what acl log is for, not failures
+		logclient.AddSimpleActionLog(batch.guest, logclient.ACT_ACL_LOG, batch.notes, userCred, true)
+	}
+	return nil
+}
+
+// aggregateOvnAclLog counts acl log entries by flow and groups flows by
+// guest.  Batches are ordered by guest id and flows by their first entry
+func aggregateOvnAclLog(entries []*ovnutils.SAclLog, nics map[string]*ovnAclLogNic) []*ovnAclLogBatch {
+	batches := map[string]*ovnAclLogBatch{}
+	for _, entry := range entries {
+		nic, notes := ovnAclLogToNotes(entry, nics)
+		if nic == nil {
+			continue
+		}
+		batch, ok := batches[nic.guest.id]
+		if !ok {
+			batch = &ovnAclLogBatch{
+				guest: nic.guest,
+				notes: &SOvnAclLogBatchNotes{},
+				flows: map[string]*SOvnAclLogNotes{},
+			}
+			batches[nic.guest.id] = batch
+		}
+		key := notes.flowKey()
+		if flow, ok := batch.flows[key]; ok {
+			flow.Count += 1
+			flow.LastTime = notes.Time
+			if flow.SrcPort != notes.SrcPort {
+				flow.SrcPort = ""
+			}
+			continue
+		}
+		if len(batch.notes.Flows) >= ovnAclLogMaxFlows {
+			batch.notes.Skipped += 1
+			continue
+		}
+		notes.Count = 1
+		notes.LastTime = notes.Time
+		batch.flows[key] = notes
+		batch.notes.Flows = append(batch.notes.Flows, notes)
+	}
+	ret := make([]*ovnAclLogBatch, 0, len(batches))
+	for _, batch := range batches {
+		ret = append(ret, batch)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].guest.id < ret[j].guest.id
+	})
+	return ret
+}
+
+func (m *SGuestManager) ovnNicsByMac() map[string]*ovnAclLogNic {
+	ret := map[string]*ovnAclLogNic{}
+	m.Servers.Range(func(k, v interface{}) bool {
+		guest, ok := v.(*SKVMGuestInstance)
+		if !ok || guest.Desc == nil {
+			return true
+		}
+		g := &ovnAclLogGuest{
+			id:   guest.Desc.Uuid,
+			name: guest.Desc.Name,
+			owner: &db.SOwnerId{
+				ProjectId: guest.Desc.TenantId,
+				DomainId:  guest.Desc.DomainId,
+			},
+		}
+		for _, nic := range guest.Desc.Nics {
+			if nic.Vpc.Provider != api.VPC_PROVIDER_OVN {
+				continue
+			}
+			ret[strings.ToLower(nic.Mac)] = &ovnAclLogNic{
+				guest: g,
+				nic:   nic,
+			}
+		}
+		return true
+	})
+	return ret
+}
+
+// ovnAclLogToNotes finds the local nic of the acl log entry by the mac
+// address of its logical port
+func ovnAclLogToNotes(entry *ovnutils.SAclLog, nics map[string]*ovnAclLogNic) (*ovnAclLogNic, *SOvnAclLogNotes) {
+	var (
+		srcMac = strings.ToLower(entry.Flow["dl_src"])
+		dstMac = strings.ToLower(entry.Flow["dl_dst"])
+		dir    = entry.Direction
+		nic    *ovnAclLogNic
+	)
+	switch dir {
+	case ovnutils.AclLogDirectionToLport:
+		nic = nics[dstMac]
+	case ovnutils.AclLogDirectionFromLport:
+		nic = nics[srcMac]
+	default:
+		if nic = nics[dstMac]; nic != nil {
+			dir = ovnutils.AclLogDirectionToLport
+		} else if nic = nics[srcMac]; nic != nil {
+			dir = ovnutils.AclLogDirectionFromLport
+		}
+	}
+	if nic == nil {
+		return nil, nil
+	}
+
+	notes := &SOvnAclLogNotes{
+		Time:      entry.Time,
+		Ifname:    nic.nic.Ifname,
+		Mac:       nic.nic.Mac,
+		Ip:        nic.nic.Ip,
+		NetworkId: nic.nic.NetId,
+		Verdict:   entry.Verdict,
+		Direction: dir,
+		Protocol:  entry.Protocol,
+		SrcIp:     entry.Flow["nw_src"],
+		DstIp:     entry.Flow["nw_dst"],
+		SrcPort:   entry.Flow["tp_src"],
+		DstPort:   entry.Flow["tp_dst"],
+	}
+	if entry.Name != "default" {
+		notes.RuleId = entry.Name
+	}
+	if notes.SrcIp == "" {
+		notes.SrcIp = entry.Flow["ipv6_src"]
+		notes.DstIp = entry.Flow["ipv6_dst"]
+	}
+	return nic, notes
+}
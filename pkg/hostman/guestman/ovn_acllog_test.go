@@ -0,0 +1,187 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guestman
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/hostman/guestman/desc"
+	"yunion.io/x/onecloud/pkg/util/ovnutils"
+)
+
+func TestOvnAclLogReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ovn-controller.log")
+	appendLog := func(s string) {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		f.WriteString(s)
+	}
+	readLines := func(r *ovnAclLogReader, want ...string) {
+		t.Helper()
+		got, err := r.readLines()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(want) || (len(want) > 0 && !reflect.DeepEqual(got, want)) {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+
+	appendLog("old\n")
+	r := &ovnAclLogReader{path: path}
+	readLines(r)
+	appendLog("a\nb")
+	readLines(r, "a")
+	appendLog("c\n")
+	readLines(r, "bc")
+
+	// rotated
+	os.Rename(path, path+".1")
+	appendLog("d\n")
+	readLines(r, "d")
+
+	// truncated
+	os.Truncate(path, 0)
+	readLines(r)
+	appendLog("e\n")
+	readLines(r, "e")
+}
+
+func TestOvnAclLogToNotes(t *testing.T) {
+	nic := &desc.SGuestNetwork{}
+	nic.Mac = "00:22:33:44:55:66"
+	nic.Ip = "10.0.0.2"
+	nic.Ifname = "vnic-1"
+	nic.NetId = "net-1"
+	nic.Vpc.Provider = api.VPC_PROVIDER_OVN
+	nics := map[string]*ovnAclLogNic{
+		nic.Mac: {guest: &ovnAclLogGuest{id: "guest-1"}, nic: nic},
+	}
+
+	entry := &ovnutils.SAclLog{
+		Name:     "rule-1",
+		Verdict:  "drop",
+		Protocol: "tcp",
+		Flow: map[string]string{
+			"dl_src": "00:00:00:00:00:01",
+			"dl_dst": "00:22:33:44:55:66",
+			"nw_src": "10.0.0.1",
+			"nw_dst": "10.0.0.2",
+			"tp_src": "51234",
+			"tp_dst": "22",
+		},
+	}
+	got, notes := ovnAclLogToNotes(entry, nics)
+	if got == nil || got.guest.id != "guest-1" {
+		t.Fatalf("nic not found")
+	}
+	want := &SOvnAclLogNotes{
+		Ifname:    "vnic-1",
+		Mac:       "00:22:33:44:55:66",
+		Ip:        "10.0.0.2",
+		NetworkId: "net-1",
+		RuleId:    "rule-1",
+		Verdict:   "drop",
+		Direction: ovnutils.AclLogDirectionToLport,
+		Protocol:  "tcp",
+		SrcIp:     "10.0.0.1",
+		DstIp:     "10.0.0.2",
+		SrcPort:   "51234",
+		DstPort:   "22",
+	}
+	if !reflect.DeepEqual(notes, want) {
+		t.Errorf("got %#v, want %#v", notes, want)
+	}
+
+	entry.Direction = ovnutils.AclLogDirectionFromLport
+	if got, _ := ovnAclLogToNotes(entry, nics); got != nil {
+		t.Errorf("from-lport entry of remote mac should be ignored")
+	}
+}
+
+func TestAggregateOvnAclLog(t *testing.T) {
+	nic1 := &desc.SGuestNetwork{}
+	nic1.Mac = "00:22:33:44:55:66"
+	nic2 := &desc.SGuestNetwork{}
+	nic2.Mac = "00:22:33:44:55:77"
+	nics := map[string]*ovnAclLogNic{
+		nic1.Mac: {guest: &ovnAclLogGuest{id: "guest-2"}, nic: nic1},
+		nic2.Mac: {guest: &ovnAclLogGuest{id: "guest-1"}, nic: nic2},
+	}
+	newEntry := func(time, dstMac, srcPort, dstPort string) *ovnutils.SAclLog {
+		return &ovnutils.SAclLog{
+			Time:      time,
+			Name:      "rule-1",
+			Verdict:   "drop",
+			Direction: ovnutils.AclLogDirectionToLport,
+			Protocol:  "tcp",
+			Flow: map[string]string{
+				"dl_src": "00:00:00:00:00:01",
+				"dl_dst": dstMac,
+				"nw_src": "10.0.0.1",
+				"nw_dst": "10.0.0.2",
+				"tp_src": srcPort,
+				"tp_dst": dstPort,
+			},
+		}
+	}
+	entries := []*ovnutils.SAclLog{
+		newEntry("t1", nic1.Mac, "51234", "22"),
+		newEntry("t2", nic1.Mac, "51235", "22"),
+		newEntry("t3", nic1.Mac, "51236", "80"),
+		newEntry("t4", nic2.Mac, "51237", "22"),
+		newEntry("t5", nic2.Mac, "51237", "22"),
+		newEntry("t6", "00:00:00:00:00:02", "51238", "22"),
+	}
+	for i := 0; i < ovnAclLogMaxFlows; i++ {
+		entries = append(entries, newEntry("t7", nic2.Mac, "51239", fmt.Sprintf("%d", 1000+i)))
+	}
+
+	batches := aggregateOvnAclLog(entries, nics)
+	if len(batches) != 2 {
+		t.Fatalf("want 2 batches, got %d", len(batches))
+	}
+	if batches[0].guest.id != "guest-1" || batches[1].guest.id != "guest-2" {
+		t.Fatalf("batches not ordered by guest id")
+	}
+
+	notes := batches[1].notes
+	if len(notes.Flows) != 2 || notes.Skipped != 0 {
+		t.Fatalf("guest-2: want 2 flows and 0 skipped, got %d and %d", len(notes.Flows), notes.Skipped)
+	}
+	flow := notes.Flows[0]
+	if flow.Count != 2 || flow.Time != "t1" || flow.LastTime != "t2" || flow.SrcPort != "" || flow.DstPort != "22" {
+		t.Errorf("guest-2: unexpected first flow %#v", flow)
+	}
+	if flow := notes.Flows[1]; flow.Count != 1 || flow.SrcPort != "51236" {
+		t.Errorf("guest-2: unexpected second flow %#v", flow)
+	}
+
+	notes = batches[0].notes
+	if len(notes.Flows) != ovnAclLogMaxFlows || notes.Skipped != 1 {
+		t.Fatalf("guest-1: want %d flows and 1 skipped, got %d and %d", ovnAclLogMaxFlows, len(notes.Flows), notes.Skipped)
+	}
+	if flow := notes.Flows[0]; flow.Count != 2 || flow.SrcPort != "51237" {
+		t.Errorf("guest-1: unexpected first flow %#v", flow)
+	}
+}
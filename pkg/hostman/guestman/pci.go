@@ -99,6 +99,9 @@ func (s *SKVMGuestInstance) initGuestDevicesDesc(pciRoot, pciBridge *desc.PCICon
 	s.initQgaDesc()
 	s.initPvpanicDesc()
 	s.initIsaSerialDesc()
+	s.initTpmDesc()
+	s.initFilesystemsDesc(pciRoot)
+	s.initBalloonDesc(pciRoot)
 	return nil
 }
 
@@ -714,6 +717,20 @@ func (s *SKVMGuestInstance) ensurePciAddresses() error {
 		}
 	}
 
+	if s.Desc.Balloon != nil {
+		err = s.ensureDevicePciAddress(s.Desc.Balloon.PCIDevice, -1, nil)
+		if err != nil {
+			return errors.Wrap(err, "ensure balloon pci address")
+		}
+	}
+
+	for i := 0; i < len(s.Desc.Filesystems); i++ {
+		err = s.ensureDevicePciAddress(s.Desc.Filesystems[i].PCIDevice, -1, nil)
+		if err != nil {
+			return errors.Wrapf(err, "ensure filesystem %s pci address", s.Desc.Filesystems[i].Tag)
+		}
+	}
+
 	anonymousPCIDevs := s.Desc.AnonymousPCIDevs[:0]
 	for i := 0; i < len(s.Desc.AnonymousPCIDevs); i++ {
 		if s.isMachineDefaultAddress(s.Desc.AnonymousPCIDevs[i].PCIAddr) {
@@ -822,6 +839,8 @@ func (s *SKVMGuestInstance) initGuestDescFromExistingGuest(
 	s.initQgaDesc()
 	s.initPvpanicDesc()
 	s.initIsaSerialDesc()
+	s.initTpmDesc()
+	s.initFilesystemsDesc(pciRoot)
 	s.Desc.VdiDevice = new(desc.SGuestVdi)
 
 	for i := 0; i < len(pciInfoList[0].Devices); i++ {
@@ -990,6 +1009,19 @@ func (s *SKVMGuestInstance) initGuestDescFromExistingGuest(
 						}
 					}
 				}
+			case strings.HasPrefix(pciInfoList[0].Devices[i].QdevID, "fs"):
+				indexStr := strings.TrimPrefix(pciInfoList[0].Devices[i].QdevID, "fs")
+				index, err := strconv.Atoi(indexStr)
+				if err != nil || index >= len(s.Desc.Filesystems) {
+					log.Errorf("failed parse filesystem pci id %s", pciInfoList[0].Devices[i].QdevID)
+					unknownDevices = append(unknownDevices, pciInfoList[0].Devices[i])
+					continue
+				}
+				s.Desc.Filesystems[index].PCIDevice.PCIAddr = pciAddr
+				err = s.ensureDevicePciAddress(s.Desc.Filesystems[index].PCIDevice, -1, nil)
+				if err != nil {
+					return errors.Wrapf(err, "ensure filesystem %s pci address", s.Desc.Filesystems[index].Tag)
+				}
 			case strings.HasPrefix(pciInfoList[0].Devices[i].QdevID, "netdev-"):
 				ifname := strings.TrimPrefix(pciInfoList[0].Devices[i].QdevID, "netdev-")
 				for i := 0; i < len(s.Desc.Nics); i++ {
@@ -24,6 +24,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -98,6 +99,12 @@ type SKVMInstanceRuntime struct {
 	needSyncStreamDisks bool
 	blockJobTigger      map[string]chan struct{}
 	quorumFailed        int32
+	// dirty bitmap backup jobs waiting for completion
+	backupJobs sync.Map
+	// guest memory size in MB left by balloon, 0 means unknown
+	balloonActualMb int64
+	// watches swtpm and virtiofsd while the monitor is connected
+	daemonSupervisor sGuestDaemonSupervisor
 
 	StartupTask *SGuestResumeTask
 	MigrateTask *SGuestLiveMigrateTask
@@ -325,6 +332,9 @@ func (s *SKVMGuestInstance) initLiveDescFromSourceGuest(srcDesc *desc.SGuestDesc
 	srcDesc.SGuestRegionDesc = s.SourceDesc.SGuestRegionDesc
 	srcDesc.SGuestControlDesc = s.SourceDesc.SGuestControlDesc
 	srcDesc.SGuestMetaDesc = s.SourceDesc.SGuestMetaDesc
+	if srcDesc.Tpm != nil && srcDesc.Tpm.Chardev != nil {
+		srcDesc.Tpm.Chardev.Options = map[string]string{"path": s.getSwtpmSocketPath()}
+	}
 	for i := 0; i < len(srcDesc.Cdroms); i++ {
 		if i == len(s.SourceDesc.Cdroms) {
 			break
@@ -763,6 +773,12 @@ func (s *SKVMGuestInstance) asyncScriptStart(ctx context.Context, params interfa
 		err = s.saveScripts(data)
 		if err != nil {
 			goto finally
+		} else if err = s.startSwtpm(); err != nil {
+			s.scriptStop()
+			goto finally
+		} else if err = s.startVirtiofsds(); err != nil {
+			s.scriptStop()
+			goto finally
 		} else {
 			err = s.scriptStart(ctx)
 			if err == nil {
@@ -1027,7 +1043,11 @@ func (s *SKVMGuestInstance) StartMonitor(ctx context.Context, cb func(), isScrip
 func (s *SKVMGuestInstance) onReceiveQMPEvent(event *monitor.Event) {
 	switch event.Event {
 	case `"BLOCK_JOB_READY"`, `"BLOCK_JOB_COMPLETED"`:
-		s.eventBlockJobReady(event)
+		if !s.eventBackupJobDone(event) {
+			s.eventBlockJobReady(event)
+		}
+	case `"BLOCK_JOB_CANCELLED"`:
+		s.eventBackupJobDone(event)
 	case `"BLOCK_JOB_ERROR"`:
 		s.eventBlockJobError(event)
 	case `"GUEST_PANICKED"`:
@@ -1208,6 +1228,7 @@ func (s *SKVMGuestInstance) SyncMirrorJobFailed(reason string) {
 
 func (s *SKVMGuestInstance) onMonitorConnected(ctx context.Context) {
 	log.Infof("Monitor connected ...")
+	s.startGuestDaemonSupervisor()
 	s.Monitor.GetVersion(func(v string) {
 		s.onGetQemuVersion(ctx, v)
 	})
@@ -1580,6 +1601,7 @@ func (s *SKVMGuestInstance) guestRun(ctx context.Context) {
 func (s *SKVMGuestInstance) onMonitorDisConnect(err error) {
 	log.Errorf("Guest %s on Monitor Disconnect reason: %v", s.Id, err)
 	s.CleanStartupTask()
+	s.stopGuestDaemonSupervisor()
 	s.scriptStop()
 	s.SyncStatus(fmt.Sprintf("monitor disconnect %v", err))
 	if s.guestAgent != nil {
@@ -2505,6 +2527,7 @@ func (s *SKVMGuestInstance) SyncConfig(
 	s.Desc.SGuestProjectDesc = guestDesc.SGuestProjectDesc
 	s.Desc.SGuestRegionDesc = guestDesc.SGuestRegionDesc
 	s.Desc.SGuestMetaDesc = guestDesc.SGuestMetaDesc
+	s.Desc.MemBalloonFloor = guestDesc.MemBalloonFloor
 
 	SaveLiveDesc(s, s.Desc)
 
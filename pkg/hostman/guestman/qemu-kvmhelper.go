@@ -233,6 +233,11 @@ func (s *SKVMGuestInstance) isMemcleanEnabled() bool {
 	return s.Desc.Metadata["enable_memclean"] == "true"
 }
 
+// guest memory must be shared with vhost-user backends such as virtiofsd
+func (s *SKVMGuestInstance) needSharedMem() bool {
+	return s.isMemcleanEnabled() || s.hasFilesystems()
+}
+
 func (s *SKVMGuestInstance) getMachine() string {
 	machine := s.Desc.Machine
 	if machine == "" {
@@ -696,6 +701,13 @@ func (s *SKVMGuestInstance) generateStopScript(data *jsonutils.JSONDict) string
 	cmd += "  rm -f $PID_FILE\n"
 	cmd += "fi\n"
 
+	if s.Desc.Tpm != nil {
+		cmd += s.generateSwtpmStopScript()
+	}
+	if s.hasFilesystems() {
+		cmd += s.generateVirtiofsStopScript()
+	}
+
 	cmd += fmt.Sprintf("for d in $(ls -d /dev/hugepages/%s*)\n", uuid)
 	cmd += "do\n"
 	cmd += "  if [ -d $d ]; then\n"
@@ -903,7 +915,7 @@ func (s *SKVMGuestInstance) initMemDesc(memSizeMB int64) error {
 func (s *SKVMGuestInstance) memObjectType() string {
 	if s.manager.host.IsHugepagesEnabled() {
 		return "memory-backend-file"
-	} else if s.isMemcleanEnabled() {
+	} else if s.needSharedMem() {
 		return "memory-backend-memfd"
 	} else {
 		return "memory-backend-ram"
@@ -976,7 +988,7 @@ func (s *SKVMGuestInstance) getMemObjectOptions(memSizeMB int64, memPathSuffix s
 			opts["host-nodes"] = fmt.Sprintf("%d", *hostNodes)
 			opts["policy"] = "bind"
 		}
-	} else if s.isMemcleanEnabled() {
+	} else if s.needSharedMem() {
 		opts = map[string]string{
 			"size":  fmt.Sprintf("%dM", memSizeMB),
 			"share": "on", "prealloc": "on",
@@ -1075,6 +1087,14 @@ func (s *SKVMGuestInstance) initPvpanicDesc() {
 	}
 }
 
+func (s *SKVMGuestInstance) initTpmDesc() {
+	if s.Desc.Vtpm {
+		s.Desc.Tpm = s.archMan.GenerateTpmDesc(s.getSwtpmSocketPath())
+	} else {
+		s.Desc.Tpm = nil
+	}
+}
+
 func (s *SKVMGuestInstance) initIsaSerialDesc() {
 	if !s.disableIsaSerialDev() {
 		s.Desc.IsaSerial = s.archMan.GenerateIsaSerialDesc()
@@ -20,6 +20,7 @@ import (
 	"strings"
 
 	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/version"
 	"yunion.io/x/pkg/utils"
 
 	api "yunion.io/x/onecloud/pkg/apis/compute"
@@ -630,6 +631,30 @@ func generatePvpanicDeviceOption(pvpanic *desc.SGuestPvpanic) string {
 	return fmt.Sprintf("-device pvpanic,id=%s,ioport=0x%x", pvpanic.Id, pvpanic.Ioport)
 }
 
+func generateTpmOptions(tpm *desc.SGuestTpm) []string {
+	return []string{
+		chardevOption(tpm.Chardev),
+		fmt.Sprintf("-tpmdev emulator,id=%s,chardev=%s", tpm.Id, tpm.Chardev.Id),
+		fmt.Sprintf("-device %s,tpmdev=%s", tpm.Model, tpm.Id),
+	}
+}
+
+func generateFilesystemOptions(fs *desc.SGuestFilesystem) []string {
+	return []string{
+		chardevOption(fs.Chardev),
+		generatePCIDeviceOption(fs.PCIDevice) + fmt.Sprintf(",chardev=%s,tag=%s", fs.Chardev.Id, fs.Tag),
+	}
+}
+
+// free page reporting is available since qemu 5.1
+func generateBalloonOption(balloon *desc.SGuestBalloon, qemuVersion Version) string {
+	cmd := generatePCIDeviceOption(balloon.PCIDevice) + ",deflate-on-oom=on"
+	if qemuVersion == "" || version.GE(string(qemuVersion), "5.1.0") {
+		cmd += ",free-page-reporting=on"
+	}
+	return cmd
+}
+
 func getMigrateOptions(drvOpt QemuOptions, input *GenerateStartOptionsInput) []string {
 	opts := make([]string, 0)
 	if input.NeedMigrate {
@@ -875,6 +900,21 @@ func GenerateStartOptions(
 		opts = append(opts, generateISASerialOptions(input.GuestDesc.IsaSerial)...)
 	}
 
+	// tpm device
+	if input.GuestDesc.Tpm != nil {
+		opts = append(opts, generateTpmOptions(input.GuestDesc.Tpm)...)
+	}
+
+	// virtiofs devices
+	for _, fs := range input.GuestDesc.Filesystems {
+		opts = append(opts, generateFilesystemOptions(fs)...)
+	}
+
+	// memory balloon
+	if input.GuestDesc.Balloon != nil {
+		opts = append(opts, generateBalloonOption(input.GuestDesc.Balloon, input.QemuVersion))
+	}
+
 	// migrate options
 	opts = append(opts, getMigrateOptions(drvOpt, input)...)
 
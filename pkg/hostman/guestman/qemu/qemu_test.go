@@ -18,6 +18,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"yunion.io/x/onecloud/pkg/hostman/guestman/desc"
 )
 
 func Test_baseOptions(t *testing.T) {
@@ -44,3 +46,44 @@ func Test_baseOptions(t *testing.T) {
 	assert.Equal("-vnc :5900,password", opt.VNC(5900, true))
 	assert.Equal("-vnc :5900", opt.VNC(5900, false))
 }
+
+func Test_generateTpmOptions(t *testing.T) {
+	chardev := desc.NewCharDev("socket", "chrtpm", "")
+	chardev.Options = map[string]string{"path": "/tmp/swtpm.sock"}
+	assert.Equal(t, []string{
+		"-chardev socket,id=chrtpm,path=/tmp/swtpm.sock",
+		"-tpmdev emulator,id=tpm0,chardev=chrtpm",
+		"-device tpm-crb,tpmdev=tpm0",
+	}, generateTpmOptions(&desc.SGuestTpm{
+		Chardev: chardev,
+		Model:   "tpm-crb",
+		Id:      "tpm0",
+	}))
+}
+
+func Test_generateFilesystemOptions(t *testing.T) {
+	chardev := desc.NewCharDev("socket", "chr-fs0", "")
+	chardev.Options = map[string]string{"path": "/tmp/virtiofs0.sock"}
+	pciDev := desc.NewPCIDevice(desc.CONTROLLER_TYPE_PCI_ROOT, "vhost-user-fs-pci", "fs0")
+	pciDev.PCIAddr = &desc.PCIAddr{Bus: 0, Slot: 6}
+	assert.Equal(t, []string{
+		"-chardev socket,id=chr-fs0,path=/tmp/virtiofs0.sock",
+		"-device vhost-user-fs-pci,id=fs0,bus=pci.0,addr=0x06,chardev=chr-fs0,tag=data",
+	}, generateFilesystemOptions(&desc.SGuestFilesystem{
+		PCIDevice: pciDev,
+		Tag:       "data",
+		Chardev:   chardev,
+	}))
+}
+
+func Test_generateBalloonOption(t *testing.T) {
+	pciDev := desc.NewPCIDevice(desc.CONTROLLER_TYPE_PCI_ROOT, "virtio-balloon-pci", "balloon0")
+	pciDev.PCIAddr = &desc.PCIAddr{Bus: 0, Slot: 7}
+	balloon := &desc.SGuestBalloon{PCIDevice: pciDev}
+	assert.Equal(t,
+		"-device virtio-balloon-pci,id=balloon0,bus=pci.0,addr=0x07,deflate-on-oom=on",
+		generateBalloonOption(balloon, Version_4_2_0))
+	assert.Equal(t,
+		"-device virtio-balloon-pci,id=balloon0,bus=pci.0,addr=0x07,deflate-on-oom=on,free-page-reporting=on",
+		generateBalloonOption(balloon, Version_9_0_1))
+}
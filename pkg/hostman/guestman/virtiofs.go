@@ -0,0 +1,177 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guestman
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/hostman/guestman/desc"
+	"yunion.io/x/onecloud/pkg/hostman/options"
+	"yunion.io/x/onecloud/pkg/util/fileutils2"
+	"yunion.io/x/onecloud/pkg/util/procutils"
+)
+
+// Each shared directory of a guest is served by a virtiofsd process through a
+// vhost-user socket. Like swtpm, virtiofsd is started right before qemu and
+// exits once qemu disconnects. If it dies earlier the guest supervisor starts
+// a new one, which qemu reconnects to. NFS backed sources are mounted under the
+// guest home dir first.
+
+const virtiofsdStartTimeout = 10 * time.Second
+
+func (s *SKVMGuestInstance) getVirtiofsSocketPath(idx int) string {
+	// keep it short, unix socket path is limited to 108 bytes
+	return path.Join(s.HomeDir(), fmt.Sprintf("virtiofs%d.sock", idx))
+}
+
+func (s *SKVMGuestInstance) getVirtiofsPidFilePath(idx int) string {
+	return path.Join(s.HomeDir(), fmt.Sprintf("virtiofs%d.pid", idx))
+}
+
+func (s *SKVMGuestInstance) getVirtiofsLogPath(idx int) string {
+	return path.Join(s.HomeDir(), fmt.Sprintf("virtiofs%d.log", idx))
+}
+
+func (s *SKVMGuestInstance) getVirtiofsNfsMountPath(tag string) string {
+	return path.Join(s.HomeDir(), "virtiofs", tag)
+}
+
+func (s *SKVMGuestInstance) hasFilesystems() bool {
+	return len(s.Desc.Filesystems) > 0
+}
+
+func (s *SKVMGuestInstance) initFilesystemsDesc(pciRoot *desc.PCIController) {
+	for i, fs := range s.Desc.Filesystems {
+		id := fmt.Sprintf("fs%d", i)
+		fs.PCIDevice = desc.NewPCIDevice(pciRoot.CType, "vhost-user-fs-pci", id)
+		fs.Chardev = desc.NewCharDev("socket", "chr-"+id, "")
+		fs.Chardev.Options = map[string]string{
+			"path":      s.getVirtiofsSocketPath(i),
+			"reconnect": "1",
+		}
+	}
+}
+
+func waitUnixSocket(sockPath string, timeout time.Duration) error {
+	start := time.Now()
+	for !fileutils2.Exists(sockPath) {
+		if time.Since(start) > timeout {
+			return errors.Wrapf(errors.ErrTimeout, "wait socket %s", sockPath)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return nil
+}
+
+func (s *SKVMGuestInstance) prepareFilesystemSource(fs *desc.SGuestFilesystem) (string, error) {
+	switch fs.SourceType {
+	case api.GUEST_FILESYSTEM_SOURCE_HOST_PATH:
+		if !fileutils2.IsDir(fs.Source) {
+			return "", errors.Wrapf(errors.ErrNotFound, "host path %s", fs.Source)
+		}
+		return fs.Source, nil
+	case api.GUEST_FILESYSTEM_SOURCE_MOUNT_TARGET:
+		mountPath := s.getVirtiofsNfsMountPath(fs.Tag)
+		if err := procutils.NewRemoteCommandAsFarAsPossible("mountpoint", "-q", mountPath).Run(); err == nil {
+			return mountPath, nil
+		}
+		if err := os.MkdirAll(mountPath, 0755); err != nil {
+			return "", errors.Wrapf(err, "mkdir %s", mountPath)
+		}
+		args := []string{"-t", "nfs"}
+		if fs.ReadOnly {
+			args = append(args, "-o", "ro")
+		}
+		args = append(args, fs.Source, mountPath)
+		output, err := procutils.NewRemoteCommandAsFarAsPossible("mount", args...).Output()
+		if err != nil {
+			return "", errors.Wrapf(err, "mount %s: %s", fs.Source, output)
+		}
+		return mountPath, nil
+	default:
+		return "", errors.Wrapf(errors.ErrNotSupported, "source type %s", fs.SourceType)
+	}
+}
+
+func (s *SKVMGuestInstance) startVirtiofsd(idx int, fs *desc.SGuestFilesystem) error {
+	sharedDir, err := s.prepareFilesystemSource(fs)
+	if err != nil {
+		return errors.Wrapf(err, "prepare filesystem %s", fs.Tag)
+	}
+	sockPath := s.getVirtiofsSocketPath(idx)
+	os.Remove(sockPath)
+	args := []string{
+		"--socket-path=" + sockPath,
+		"--shared-dir=" + sharedDir,
+		"--cache=auto",
+	}
+	if fs.ReadOnly {
+		args = append(args, "--readonly")
+	}
+	// the shell only detaches virtiofsd, every value is passed as a separate
+	// argument and never parsed by it
+	daemonArgs := []string{
+		"-c", `pid_file=$1; log_file=$2; shift 2; nohup "$@" > "$log_file" 2>&1 & echo $! > "$pid_file"`,
+		"virtiofsd", s.getVirtiofsPidFilePath(idx), s.getVirtiofsLogPath(idx),
+		options.HostOptions.VirtiofsdPath,
+	}
+	daemonArgs = append(daemonArgs, args...)
+	output, err := procutils.NewRemoteCommandAsFarAsPossible("sh", daemonArgs...).Output()
+	if err != nil {
+		return errors.Wrapf(err, "start virtiofsd: %s", output)
+	}
+	if err := waitUnixSocket(sockPath, virtiofsdStartTimeout); err != nil {
+		return errors.Wrapf(err, "virtiofsd of %s", fs.Tag)
+	}
+	return nil
+}
+
+// startVirtiofsds launches one virtiofsd for every shared directory of the guest
+func (s *SKVMGuestInstance) startVirtiofsds() error {
+	for i, fs := range s.Desc.Filesystems {
+		if err := s.startVirtiofsd(i, fs); err != nil {
+			return err
+		}
+		log.Infof("guest %s virtiofsd of %s started", s.GetName(), fs.Tag)
+	}
+	return nil
+}
+
+// generateVirtiofsStopScript kills virtiofsd left behind and umounts nfs sources
+func (s *SKVMGuestInstance) generateVirtiofsStopScript() string {
+	cmd := ""
+	for i, fs := range s.Desc.Filesystems {
+		cmd += fmt.Sprintf("VIRTIOFS_PID_FILE=%s\n", s.getVirtiofsPidFilePath(i))
+		cmd += "if [ -f $VIRTIOFS_PID_FILE ]; then\n"
+		cmd += "  kill -9 `cat $VIRTIOFS_PID_FILE` > /dev/null 2>&1\n"
+		cmd += "  rm -f $VIRTIOFS_PID_FILE\n"
+		cmd += "fi\n"
+		cmd += fmt.Sprintf("rm -f %s\n", s.getVirtiofsSocketPath(i))
+		if fs.SourceType == api.GUEST_FILESYSTEM_SOURCE_MOUNT_TARGET {
+			mountPath := s.getVirtiofsNfsMountPath(fs.Tag)
+			cmd += fmt.Sprintf("if mountpoint -q %s; then\n", mountPath)
+			cmd += fmt.Sprintf("  umount %s\n", mountPath)
+			cmd += "fi\n"
+		}
+	}
+	return cmd
+}
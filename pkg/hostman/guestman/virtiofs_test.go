@@ -0,0 +1,224 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guestman
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"yunion.io/x/pkg/errors"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/hostman/guestman/desc"
+	"yunion.io/x/onecloud/pkg/hostman/options"
+	"yunion.io/x/onecloud/pkg/util/fileutils2"
+)
+
+// fakeVirtiofsd creates the socket and records its arguments, then waits to
+// be killed like a virtiofsd serving a guest
+const fakeVirtiofsd = `#!/bin/sh
+for arg in "$@"; do
+  case "$arg" in
+    --socket-path=*) touch "${arg#--socket-path=}" ;;
+  esac
+done
+echo "$@"
+exec sleep 60
+`
+
+func newVirtiofsTestGuest(t *testing.T, filesystems ...*desc.SGuestFilesystem) *SKVMGuestInstance {
+	s := newVtpmTestGuest(t, false)
+	s.Desc.Filesystems = filesystems
+	return s
+}
+
+func TestPrepareFilesystemSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "virtiofs-shared")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "file")
+	if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	cases := []struct {
+		name    string
+		fs      desc.SGuestFilesystem
+		want    string
+		wantErr error
+	}{
+		{
+			name: "host dir",
+			fs:   desc.SGuestFilesystem{Tag: "data", SourceType: api.GUEST_FILESYSTEM_SOURCE_HOST_PATH, Source: dir},
+			want: dir,
+		},
+		{
+			name:    "missing host dir",
+			fs:      desc.SGuestFilesystem{Tag: "data", SourceType: api.GUEST_FILESYSTEM_SOURCE_HOST_PATH, Source: path.Join(dir, "missing")},
+			wantErr: errors.ErrNotFound,
+		},
+		{
+			name:    "host file",
+			fs:      desc.SGuestFilesystem{Tag: "data", SourceType: api.GUEST_FILESYSTEM_SOURCE_HOST_PATH, Source: file},
+			wantErr: errors.ErrNotFound,
+		},
+		{
+			name:    "unknown source type",
+			fs:      desc.SGuestFilesystem{Tag: "data", SourceType: "cifs", Source: dir},
+			wantErr: errors.ErrNotSupported,
+		},
+	}
+	s := newVirtiofsTestGuest(t)
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := s.prepareFilesystemSource(&c.fs)
+			if errors.Cause(err) != c.wantErr {
+				t.Fatalf("want error %v, got %v", c.wantErr, err)
+			}
+			if got != c.want {
+				t.Errorf("want shared dir %q, got %q", c.want, got)
+			}
+		})
+	}
+}
+
+func TestInitFilesystemsDesc(t *testing.T) {
+	s := newVirtiofsTestGuest(t,
+		&desc.SGuestFilesystem{Tag: "data"},
+		&desc.SGuestFilesystem{Tag: "logs"},
+	)
+	s.initFilesystemsDesc(&desc.PCIController{CType: desc.CONTROLLER_TYPE_PCI_ROOT})
+	for i, fs := range s.Desc.Filesystems {
+		if fs.PCIDevice == nil || fs.DevType != "vhost-user-fs-pci" {
+			t.Errorf("filesystem %d: unexpected pci device %#v", i, fs.PCIDevice)
+		}
+		if fs.Chardev == nil || fs.Chardev.Options["path"] != s.getVirtiofsSocketPath(i) {
+			t.Errorf("filesystem %d: unexpected chardev %#v", i, fs.Chardev)
+		}
+	}
+	if len(s.getVirtiofsSocketPath(0)) >= 108 {
+		t.Errorf("socket path %s too long", s.getVirtiofsSocketPath(0))
+	}
+}
+
+func waitPidGone(pid string) bool {
+	for i := 0; i < 50; i++ {
+		stat, err := fileutils2.FileGetContents(path.Join("/proc", pid, "stat"))
+		// a killed daemon may linger as a zombie until it is reaped
+		if err != nil || strings.Contains(stat, ") Z ") {
+			return true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return false
+}
+
+func TestVirtiofsdProcess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "virtiofs-shared")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	virtiofsd := path.Join(dir, "virtiofsd")
+	if err := ioutil.WriteFile(virtiofsd, []byte(fakeVirtiofsd), 0755); err != nil {
+		t.Fatalf("write virtiofsd: %v", err)
+	}
+	oldPath := options.HostOptions.VirtiofsdPath
+	options.HostOptions.VirtiofsdPath = virtiofsd
+	defer func() { options.HostOptions.VirtiofsdPath = oldPath }()
+
+	s := newVirtiofsTestGuest(t, &desc.SGuestFilesystem{
+		Tag:        "data",
+		SourceType: api.GUEST_FILESYSTEM_SOURCE_HOST_PATH,
+		Source:     dir,
+		ReadOnly:   true,
+	})
+	stopScript := s.generateVirtiofsStopScript()
+	defer exec.Command("sh", "-c", stopScript).Run()
+
+	if err := s.startVirtiofsds(); err != nil {
+		t.Fatalf("startVirtiofsds: %v", err)
+	}
+	pidFile := s.getVirtiofsPidFilePath(0)
+	if !isPidFileAlive(pidFile) {
+		t.Fatalf("virtiofsd is not running")
+	}
+	if !fileutils2.Exists(s.getVirtiofsSocketPath(0)) {
+		t.Errorf("socket %s not created", s.getVirtiofsSocketPath(0))
+	}
+	var args string
+	for i := 0; i < 50 && len(args) == 0; i++ {
+		args, _ = fileutils2.FileGetContents(s.getVirtiofsLogPath(0))
+		time.Sleep(100 * time.Millisecond)
+	}
+	want := "--socket-path=" + s.getVirtiofsSocketPath(0) + " --shared-dir=" + dir + " --cache=auto --readonly"
+	if strings.TrimSpace(args) != want {
+		t.Errorf("want args %q, got %q", want, args)
+	}
+
+	daemons := s.getGuestDaemons()
+	if len(daemons) != 1 || daemons[0].restart == nil {
+		t.Fatalf("want one restartable daemon, got %#v", daemons)
+	}
+	pid, _ := fileutils2.FileGetContents(pidFile)
+	pid = strings.TrimSpace(pid)
+
+	// a live daemon is left alone
+	s.checkGuestDaemon(daemons[0], map[string]bool{})
+	if newPid, _ := fileutils2.FileGetContents(pidFile); strings.TrimSpace(newPid) != pid {
+		t.Errorf("live virtiofsd %s is restarted as %s", pid, newPid)
+	}
+
+	// a dead daemon is restarted
+	if err := exec.Command("kill", "-9", pid).Run(); err != nil {
+		t.Fatalf("kill virtiofsd: %v", err)
+	}
+	if !waitPidGone(pid) {
+		t.Fatalf("virtiofsd %s not killed", pid)
+	}
+	// an unreaped zombie still answers kill -0, drop its pid file
+	os.Remove(pidFile)
+	s.checkGuestDaemon(daemons[0], map[string]bool{})
+	newPid, _ := fileutils2.FileGetContents(pidFile)
+	newPid = strings.TrimSpace(newPid)
+	if len(newPid) == 0 || newPid == pid || !isPidFileAlive(pidFile) {
+		t.Fatalf("virtiofsd is not restarted, pid %q", newPid)
+	}
+
+	// the stop script kills the daemon and cleans up
+	if output, err := exec.Command("sh", "-c", stopScript).CombinedOutput(); err != nil {
+		t.Fatalf("stop script: %v %s", err, output)
+	}
+	if !waitPidGone(newPid) {
+		t.Errorf("virtiofsd %s not killed by stop script", newPid)
+	}
+	if fileutils2.Exists(pidFile) || fileutils2.Exists(s.getVirtiofsSocketPath(0)) {
+		t.Errorf("pid file or socket left behind")
+	}
+}
+
+func TestWaitUnixSocketTimeout(t *testing.T) {
+	err := waitUnixSocket("/nonexistent/virtiofs.sock", 200*time.Millisecond)
+	if errors.Cause(err) != errors.ErrTimeout {
+		t.Errorf("want timeout, got %v", err)
+	}
+}
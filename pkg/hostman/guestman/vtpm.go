@@ -0,0 +1,297 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guestman
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	hostapi "yunion.io/x/onecloud/pkg/apis/host"
+	"yunion.io/x/onecloud/pkg/hostman/monitor"
+	"yunion.io/x/onecloud/pkg/hostman/options"
+	"yunion.io/x/onecloud/pkg/hostman/storageman"
+	"yunion.io/x/onecloud/pkg/hostman/storageman/backupstorage"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/util/fileutils2"
+	"yunion.io/x/onecloud/pkg/util/procutils"
+)
+
+// The vTPM of a guest is emulated by a swtpm process serving qemu through a
+// unix socket, the TPM state is kept in the guest home dir. swtpm is started
+// right before qemu and exits as soon as qemu closes the connection, so both
+// share the same lifetime. qemu can't reconnect to a new swtpm, so if it dies
+// earlier the guest supervisor only reports it.
+
+const swtpmStartTimeout = 10 * time.Second
+
+func (s *SKVMGuestInstance) getVtpmStateDir() string {
+	return path.Join(s.HomeDir(), "vtpm")
+}
+
+func (s *SKVMGuestInstance) getSwtpmSocketPath() string {
+	return path.Join(s.HomeDir(), "swtpm.sock")
+}
+
+func (s *SKVMGuestInstance) getSwtpmPidFilePath() string {
+	return path.Join(s.HomeDir(), "swtpm.pid")
+}
+
+func (s *SKVMGuestInstance) getSwtpmLogPath() string {
+	return path.Join(s.HomeDir(), "swtpm.log")
+}
+
+func (s *SKVMGuestInstance) getSwtpmPid() string {
+	pid, _ := fileutils2.FileGetContents(s.getSwtpmPidFilePath())
+	return strings.TrimSpace(pid)
+}
+
+func (s *SKVMGuestInstance) isSwtpmRunning() bool {
+	return isPidFileAlive(s.getSwtpmPidFilePath())
+}
+
+func (s *SKVMGuestInstance) getSwtpmArgs() []string {
+	return []string{
+		"socket", "--tpm2",
+		"--tpmstate", fmt.Sprintf("dir=%s,mode=0600", s.getVtpmStateDir()),
+		"--ctrl", fmt.Sprintf("type=unixio,path=%s,mode=0600", s.getSwtpmSocketPath()),
+		"--pid", fmt.Sprintf("file=%s", s.getSwtpmPidFilePath()),
+		"--log", fmt.Sprintf("file=%s,level=20", s.getSwtpmLogPath()),
+		"--terminate", "--daemon",
+	}
+}
+
+// startSwtpm launches the swtpm of the guest if not running yet
+func (s *SKVMGuestInstance) startSwtpm() error {
+	if s.Desc.Tpm == nil {
+		return nil
+	}
+	if s.isSwtpmRunning() {
+		return nil
+	}
+	stateDir := s.getVtpmStateDir()
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return errors.Wrapf(err, "mkdir %s", stateDir)
+	}
+	sockPath := s.getSwtpmSocketPath()
+	os.Remove(sockPath)
+	output, err := procutils.NewRemoteCommandAsFarAsPossible(options.HostOptions.SwtpmPath, s.getSwtpmArgs()...).Output()
+	if err != nil {
+		return errors.Wrapf(err, "start swtpm: %s", output)
+	}
+	if err := waitUnixSocket(sockPath, swtpmStartTimeout); err != nil {
+		return errors.Wrap(err, "swtpm")
+	}
+	log.Infof("guest %s swtpm started, pid %s", s.GetName(), s.getSwtpmPid())
+	return nil
+}
+
+// generateSwtpmStopScript kills the swtpm in case qemu never connected to it
+func (s *SKVMGuestInstance) generateSwtpmStopScript() string {
+	cmd := fmt.Sprintf("SWTPM_PID_FILE=%s\n", s.getSwtpmPidFilePath())
+	cmd += "if [ -f $SWTPM_PID_FILE ]; then\n"
+	cmd += "  kill -9 `cat $SWTPM_PID_FILE` > /dev/null 2>&1\n"
+	cmd += "  rm -f $SWTPM_PID_FILE\n"
+	cmd += "fi\n"
+	cmd += fmt.Sprintf("rm -f %s\n", s.getSwtpmSocketPath())
+	return cmd
+}
+
+func (s *SKVMGuestInstance) exportVtpmState(target string) error {
+	stateDir := s.getVtpmStateDir()
+	if !fileutils2.Exists(stateDir) {
+		if err := os.MkdirAll(stateDir, 0700); err != nil {
+			return errors.Wrapf(err, "mkdir %s", stateDir)
+		}
+	}
+	return s.withVcpusPaused(func() error {
+		output, err := procutils.NewRemoteCommandAsFarAsPossible("tar", "-czf", target, "-C", stateDir, ".").Output()
+		if err != nil {
+			return errors.Wrapf(err, "tar %s: %s", stateDir, output)
+		}
+		return nil
+	})
+}
+
+func monitorCallString(call func(cb monitor.StringCallback)) (string, error) {
+	res := make(chan string, 1)
+	call(func(r string) {
+		res <- r
+	})
+	select {
+	case <-time.After(monitorCommandTimeout):
+		return "", errors.Wrap(errors.ErrTimeout, "monitor command")
+	case r := <-res:
+		return r, nil
+	}
+}
+
+// withVcpusPaused runs f with the vcpus of a running guest paused, swtpm only
+// writes its state while serving TPM commands issued by the guest
+func (s *SKVMGuestInstance) withVcpusPaused(f func() error) error {
+	if !s.IsRunning() || s.Monitor == nil {
+		return f()
+	}
+	return withMonitorVcpusPaused(s.GetName(), s.Monitor, f)
+}
+
+func withMonitorVcpusPaused(name string, m monitor.Monitor, f func() error) error {
+	status, err := monitorCallString(m.QueryStatus)
+	if err != nil {
+		return errors.Wrap(err, "query status")
+	}
+	if status != "running" {
+		return f()
+	}
+	res, err := monitorCallString(func(cb monitor.StringCallback) {
+		m.SimpleCommand("stop", cb)
+	})
+	if err != nil {
+		return errors.Wrap(err, "stop")
+	}
+	if strings.Contains(strings.ToLower(res), "error") {
+		return errors.Errorf("stop: %s", res)
+	}
+	defer func() {
+		res, err := monitorCallString(func(cb monitor.StringCallback) {
+			m.SimpleCommand("cont", cb)
+		})
+		if err != nil || strings.Contains(strings.ToLower(res), "error") {
+			log.Errorf("guest %s cont after vtpm export: %s %v", name, res, err)
+		}
+	}()
+	return f()
+}
+
+// importVtpmState replaces the TPM state, which is only possible while swtpm
+// is not running
+func (s *SKVMGuestInstance) importVtpmState(src string) error {
+	if !s.IsStopped() || s.isSwtpmRunning() {
+		return httperrors.NewInvalidStatusError("guest %s is not stopped", s.Id)
+	}
+	stateDir := s.getVtpmStateDir()
+	if err := os.RemoveAll(stateDir); err != nil {
+		return errors.Wrapf(err, "remove %s", stateDir)
+	}
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return errors.Wrapf(err, "mkdir %s", stateDir)
+	}
+	output, err := procutils.NewRemoteCommandAsFarAsPossible("tar", "-xzf", src, "-C", stateDir).Output()
+	if err != nil {
+		return errors.Wrapf(err, "untar %s: %s", src, output)
+	}
+	return nil
+}
+
+func (s *SKVMGuestInstance) checkVtpm() error {
+	if !s.Desc.Vtpm {
+		return httperrors.NewBadRequestError("guest %s has no vtpm", s.Id)
+	}
+	return nil
+}
+
+func (s *SKVMGuestInstance) withVtpmTempFile(f func(tmpFile string) error) error {
+	tmpDir, err := storageman.EnsureBackupDir()
+	if err != nil {
+		return errors.Wrap(err, "EnsureBackupDir")
+	}
+	defer storageman.CleanupDirOrFile(tmpDir)
+	return f(path.Join(tmpDir, s.Id+".vtpm"))
+}
+
+func (s *SKVMGuestInstance) ExportVtpmState() (*hostapi.GuestVtpmState, error) {
+	if err := s.checkVtpm(); err != nil {
+		return nil, err
+	}
+	ret := new(hostapi.GuestVtpmState)
+	err := s.withVtpmTempFile(func(tmpFile string) error {
+		if err := s.exportVtpmState(tmpFile); err != nil {
+			return err
+		}
+		data, err := os.ReadFile(tmpFile)
+		if err != nil {
+			return errors.Wrapf(err, "read %s", tmpFile)
+		}
+		ret.State = base64.StdEncoding.EncodeToString(data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (s *SKVMGuestInstance) ImportVtpmState(input *hostapi.GuestVtpmState) error {
+	if err := s.checkVtpm(); err != nil {
+		return err
+	}
+	data, err := base64.StdEncoding.DecodeString(input.State)
+	if err != nil {
+		return httperrors.NewInputParameterError("invalid vtpm state: %v", err)
+	}
+	return s.withVtpmTempFile(func(tmpFile string) error {
+		if err := os.WriteFile(tmpFile, data, 0600); err != nil {
+			return errors.Wrapf(err, "write %s", tmpFile)
+		}
+		return s.importVtpmState(tmpFile)
+	})
+}
+
+func (s *SKVMGuestInstance) BackupVtpmState(ctx context.Context, input *hostapi.GuestVtpmBackupRequest) error {
+	if err := s.checkVtpm(); err != nil {
+		return err
+	}
+	backupStorage, err := backupstorage.GetBackupStorage(input.BackupStorageId, input.BackupStorageAccessInfo)
+	if err != nil {
+		return errors.Wrap(err, "GetBackupStorage")
+	}
+	return s.withVtpmTempFile(func(tmpFile string) error {
+		if err := s.exportVtpmState(tmpFile); err != nil {
+			return err
+		}
+		return backupStorage.SaveBackupFrom(ctx, tmpFile, input.BackupId)
+	})
+}
+
+func (s *SKVMGuestInstance) RestoreVtpmState(ctx context.Context, input *hostapi.GuestVtpmBackupRequest) error {
+	if err := s.checkVtpm(); err != nil {
+		return err
+	}
+	backupStorage, err := backupstorage.GetBackupStorage(input.BackupStorageId, input.BackupStorageAccessInfo)
+	if err != nil {
+		return errors.Wrap(err, "GetBackupStorage")
+	}
+	return s.withVtpmTempFile(func(tmpFile string) error {
+		if err := backupStorage.RestoreBackupTo(ctx, tmpFile, input.BackupId); err != nil {
+			return errors.Wrap(err, "RestoreBackupTo")
+		}
+		return s.importVtpmState(tmpFile)
+	})
+}
+
+func (m *SGuestManager) GetVtpmServer(sid string) (*SKVMGuestInstance, error) {
+	guest, ok := m.GetKVMServer(sid)
+	if !ok {
+		return nil, httperrors.NewNotFoundError("guest %s not found", sid)
+	}
+	return guest, nil
+}
@@ -0,0 +1,235 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guestman
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/hostman/guestman/desc"
+	"yunion.io/x/onecloud/pkg/hostman/monitor"
+)
+
+func newVtpmTestGuest(t *testing.T, vtpm bool) *SKVMGuestInstance {
+	dir, err := ioutil.TempDir("", "vtpm")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	s := &SKVMGuestInstance{
+		sBaseGuestInstance: &sBaseGuestInstance{
+			Id:      "guest-id",
+			manager: &SGuestManager{ServersPath: dir},
+			Desc:    &desc.SGuestDesc{},
+		},
+	}
+	s.Desc.Uuid = s.Id
+	s.Desc.Vtpm = vtpm
+	if err := os.MkdirAll(s.HomeDir(), 0755); err != nil {
+		t.Fatalf("mkdir home: %v", err)
+	}
+	return s
+}
+
+func TestSwtpmArgs(t *testing.T) {
+	s := newVtpmTestGuest(t, true)
+	home := s.HomeDir()
+	want := []string{
+		"socket", "--tpm2",
+		"--tpmstate", fmt.Sprintf("dir=%s/vtpm,mode=0600", home),
+		"--ctrl", fmt.Sprintf("type=unixio,path=%s/swtpm.sock,mode=0600", home),
+		"--pid", fmt.Sprintf("file=%s/swtpm.pid", home),
+		"--log", fmt.Sprintf("file=%s/swtpm.log,level=20", home),
+		"--terminate", "--daemon",
+	}
+	if got := s.getSwtpmArgs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("want args %v, got %v", want, got)
+	}
+}
+
+func TestVtpmStateRoundTrip(t *testing.T) {
+	s := newVtpmTestGuest(t, true)
+	stateDir := s.getVtpmStateDir()
+	if stateDir != path.Join(s.HomeDir(), "vtpm") {
+		t.Fatalf("unexpected state dir %s", stateDir)
+	}
+
+	// the state dir of a guest never started is created on export
+	empty := path.Join(s.HomeDir(), "empty.tar.gz")
+	if err := s.exportVtpmState(empty); err != nil {
+		t.Fatalf("export empty state: %v", err)
+	}
+	if fi, err := os.Stat(stateDir); err != nil || fi.Mode().Perm() != 0700 {
+		t.Fatalf("state dir not created with mode 0700: %v", err)
+	}
+
+	state := path.Join(stateDir, "tpm2-00.permall")
+	if err := ioutil.WriteFile(state, []byte("tpm state"), 0600); err != nil {
+		t.Fatalf("write state: %v", err)
+	}
+	target := path.Join(s.HomeDir(), "state.tar.gz")
+	if err := s.exportVtpmState(target); err != nil {
+		t.Fatalf("export state: %v", err)
+	}
+
+	// the import replaces the whole state dir
+	if err := ioutil.WriteFile(state, []byte("changed"), 0600); err != nil {
+		t.Fatalf("write state: %v", err)
+	}
+	if err := ioutil.WriteFile(path.Join(stateDir, "stale"), nil, 0600); err != nil {
+		t.Fatalf("write stale: %v", err)
+	}
+	if err := s.importVtpmState(target); err != nil {
+		t.Fatalf("import state: %v", err)
+	}
+	data, err := ioutil.ReadFile(state)
+	if err != nil || string(data) != "tpm state" {
+		t.Errorf("want state restored, got %q %v", data, err)
+	}
+	if _, err := os.Stat(path.Join(stateDir, "stale")); !os.IsNotExist(err) {
+		t.Errorf("stale file is not removed: %v", err)
+	}
+
+	if err := s.importVtpmState(empty); err != nil {
+		t.Fatalf("import empty state: %v", err)
+	}
+	if files, _ := ioutil.ReadDir(stateDir); len(files) != 0 {
+		t.Errorf("want empty state dir, got %d files", len(files))
+	}
+}
+
+func TestVtpmErrors(t *testing.T) {
+	t.Run("no vtpm", func(t *testing.T) {
+		s := newVtpmTestGuest(t, false)
+		if _, err := s.ExportVtpmState(); err == nil {
+			t.Errorf("export of guest without vtpm succeeded")
+		}
+		if err := s.ImportVtpmState(nil); err == nil {
+			t.Errorf("import of guest without vtpm succeeded")
+		}
+	})
+	t.Run("import while swtpm running", func(t *testing.T) {
+		s := newVtpmTestGuest(t, true)
+		pid := fmt.Sprintf("%d\n", os.Getpid())
+		if err := ioutil.WriteFile(s.getSwtpmPidFilePath(), []byte(pid), 0644); err != nil {
+			t.Fatalf("write pid: %v", err)
+		}
+		if err := s.importVtpmState(path.Join(s.HomeDir(), "state.tar.gz")); err == nil {
+			t.Errorf("import while swtpm running succeeded")
+		}
+	})
+	t.Run("import broken state", func(t *testing.T) {
+		s := newVtpmTestGuest(t, true)
+		broken := path.Join(s.HomeDir(), "broken.tar.gz")
+		if err := ioutil.WriteFile(broken, []byte("not a tarball"), 0600); err != nil {
+			t.Fatalf("write broken: %v", err)
+		}
+		if err := s.importVtpmState(broken); err == nil {
+			t.Errorf("import of broken state succeeded")
+		}
+	})
+}
+
+type vtpmTestMonitor struct {
+	monitor.Monitor
+
+	status  string
+	stopRes string
+	cmds    []string
+}
+
+func (m *vtpmTestMonitor) QueryStatus(cb monitor.StringCallback) {
+	cb(m.status)
+}
+
+func (m *vtpmTestMonitor) SimpleCommand(cmd string, cb monitor.StringCallback) {
+	m.cmds = append(m.cmds, cmd)
+	if cmd == "stop" {
+		cb(m.stopRes)
+		return
+	}
+	cb("")
+}
+
+func TestWithMonitorVcpusPaused(t *testing.T) {
+	errExport := errors.Error("export failed")
+	cases := []struct {
+		name     string
+		status   string
+		stopRes  string
+		fErr     error
+		wantCmds []string
+		wantCall bool
+		wantErr  bool
+	}{
+		{
+			name:     "running guest is paused and resumed",
+			status:   "running",
+			wantCmds: []string{"stop", "cont"},
+			wantCall: true,
+		},
+		{
+			name:     "paused guest is left paused",
+			status:   "paused",
+			wantCall: true,
+		},
+		{
+			name:     "failed stop skips export",
+			status:   "running",
+			stopRes:  "Error: failed to stop",
+			wantCmds: []string{"stop"},
+			wantErr:  true,
+		},
+		{
+			name:     "failed export still resumes",
+			status:   "running",
+			fErr:     errExport,
+			wantCmds: []string{"stop", "cont"},
+			wantCall: true,
+			wantErr:  true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m := &vtpmTestMonitor{status: c.status, stopRes: c.stopRes}
+			called := false
+			err := withMonitorVcpusPaused("guest", m, func() error {
+				called = true
+				if len(m.cmds) > 0 && m.cmds[len(m.cmds)-1] != "stop" {
+					t.Errorf("vcpus not paused during export: %v", m.cmds)
+				}
+				return c.fErr
+			})
+			if (err != nil) != c.wantErr {
+				t.Errorf("want error %v, got %v", c.wantErr, err)
+			}
+			if c.fErr != nil && errors.Cause(err) != c.fErr {
+				t.Errorf("want export error, got %v", err)
+			}
+			if called != c.wantCall {
+				t.Errorf("want export called %v, got %v", c.wantCall, called)
+			}
+			if len(m.cmds) != len(c.wantCmds) || (len(m.cmds) > 0 && !reflect.DeepEqual(m.cmds, c.wantCmds)) {
+				t.Errorf("want commands %v, got %v", c.wantCmds, m.cmds)
+			}
+		})
+	}
+}
@@ -116,6 +116,7 @@ func (p *SHostPingTask) payload() api.SHostPingInput {
 	memFree := int(info.Available / 1024 / 1024)
 	memUsed := memTotal - memFree
 	data.MemoryUsedMb = memUsed
+	data.MemBalloonReclaimedMb = guestman.GetGuestManager().GetBalloonReclaimedMemMb()
 	data.QgaRunningGuestIds = guestman.GetGuestManager().GetQgaRunningGuests()
 	return data
 }
@@ -149,6 +150,13 @@ func (p *SHostPingTask) ping(div int, hostId string) error {
 		} else {
 			log.Errorf("get catalog from res %s: %v", res.String(), err)
 		}
+		budgets := make([]api.HostIoQosBudget, 0)
+		if res.Contains(api.HOSTMETA_IO_QOS_BUDGETS) {
+			if err := res.Unmarshal(&budgets, api.HOSTMETA_IO_QOS_BUDGETS); err != nil {
+				log.Errorf("unmarshal io qos budgets: %v", err)
+			}
+		}
+		guestman.GetGuestManager().SetIoQosBudgets(budgets)
 	}
 	return nil
 }
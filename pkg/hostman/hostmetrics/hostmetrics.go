@@ -138,7 +138,41 @@ func (m *SHostMetricsCollector) collectReportData() string {
 	if len(m.waitingReportData) > 60 {
 		m.waitingReportData = m.waitingReportData[1:]
 	}
-	return m.guestMonitor.CollectReportData()
+	data := m.guestMonitor.CollectReportData()
+	if qosData := collectIoQosReportData(); len(qosData) > 0 {
+		if len(data) > 0 {
+			data += "\n"
+		}
+		data += qosData
+	}
+	return data
+}
+
+// collectIoQosReportData reports the disk limits decided by io qos controller
+func collectIoQosReportData() string {
+	if !options.HostOptions.EnableIoQosController {
+		return ""
+	}
+	ret := []string{}
+	for _, d := range guestman.GetGuestManager().GetIoQosDecisions() {
+		tags := []string{
+			"vm_id=" + d.GuestId,
+			"vm_name=" + strings.ReplaceAll(d.GuestName, " ", "+"),
+			"disk_id=" + d.DiskId,
+			"drive=" + d.Drive,
+			hostconsts.TELEGRAF_TAG_KEY_BRAND + "=" + hostconsts.TELEGRAF_TAG_ONECLOUD_BRAND,
+			hostconsts.TELEGRAF_TAG_KEY_RES_TYPE + "=host",
+		}
+		if len(d.ProjectId) > 0 {
+			tags = append(tags, "tenant_id="+d.ProjectId)
+		}
+		if len(d.Reason) > 0 {
+			tags = append(tags, "reason="+d.Reason)
+		}
+		ret = append(ret, fmt.Sprintf("host_io_qos,%s iops=%f,bps=%f,latency_ms=%f,iops_limit=%d,bps_limit=%d",
+			strings.Join(tags, ","), d.Iops, d.Bps, d.LatencyMs, d.IopsLimit, d.BpsLimit))
+	}
+	return strings.Join(ret, "\n")
 }
 
 func NewHostMetricsCollector(csp stats.ContainerStatsProvider) *SHostMetricsCollector {
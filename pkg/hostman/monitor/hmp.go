@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -431,6 +432,18 @@ func (m *HmpMonitor) DriveBackup(callback StringCallback, drive, target, syncMod
 	m.Query(cmd, callback)
 }
 
+func (m *HmpMonitor) DriveBackupBitmap(callback StringCallback, jobId, drive, target, bitmap, syncMode, bitmapMode, newBitmap string) {
+	go callback("hmp not support command drive-backup with dirty bitmap")
+}
+
+func (m *HmpMonitor) BlockDirtyBitmapAdd(node, name string, persistent bool, callback StringCallback) {
+	go callback("hmp not support command block-dirty-bitmap-add")
+}
+
+func (m *HmpMonitor) BlockDirtyBitmapRemove(node, name string, callback StringCallback) {
+	go callback("hmp not support command block-dirty-bitmap-remove")
+}
+
 func (m *HmpMonitor) BlockStream(drive string, callback StringCallback) {
 	var (
 		speed = 500 // limit 500 MB/s
@@ -518,6 +531,29 @@ func (m *HmpMonitor) GetMemdevList(callback MemdevListCallback) {
 	go callback(nil, "hmp unsupport get memdev list")
 }
 
+func (m *HmpMonitor) SetBalloon(sizeMB int64, callback StringCallback) {
+	m.Query(fmt.Sprintf("balloon %d", sizeMB), callback)
+}
+
+var hmpBalloonActualReg = regexp.MustCompile(`actual=(\d+)`)
+
+func (m *HmpMonitor) GetBalloonActual(callback BalloonCallback) {
+	var cb = func(output string) {
+		match := hmpBalloonActualReg.FindStringSubmatch(output)
+		if len(match) < 2 {
+			callback(0, fmt.Sprintf("unexpected balloon info: %s", output))
+			return
+		}
+		actual, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			callback(0, err.Error())
+			return
+		}
+		callback(actual, "")
+	}
+	m.Query("info balloon", cb)
+}
+
 func (m *HmpMonitor) ObjectAdd(objectType string, params map[string]string, callback StringCallback) {
 	var paramsKvs = []string{}
 	for k, v := range params {
@@ -532,6 +568,47 @@ func (m *HmpMonitor) BlockIoThrottle(driveName string, bps, iops int64, callback
 	m.Query(cmd, callback)
 }
 
+var hmpBlockStatsKvReg = regexp.MustCompile(`(\w+)=(\d+)`)
+
+// parseHmpBlockStats parses output of info blockstats, one device per line:
+// drive_0: rd_bytes=512 wr_bytes=0 rd_operations=1 ...
+func parseHmpBlockStats(output string) []BlockStats {
+	stats := make([]BlockStats, 0)
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		pos := strings.Index(line, ":")
+		if pos <= 0 {
+			continue
+		}
+		stat := BlockStats{Device: line[:pos]}
+		for _, kv := range hmpBlockStatsKvReg.FindAllStringSubmatch(line[pos+1:], -1) {
+			val, _ := strconv.ParseInt(kv[2], 10, 64)
+			switch kv[1] {
+			case "rd_bytes":
+				stat.RdBytes = val
+			case "wr_bytes":
+				stat.WrBytes = val
+			case "rd_operations":
+				stat.RdOperations = val
+			case "wr_operations":
+				stat.WrOperations = val
+			case "rd_total_time_ns":
+				stat.RdTotalTimeNs = val
+			case "wr_total_time_ns":
+				stat.WrTotalTimeNs = val
+			}
+		}
+		stats = append(stats, stat)
+	}
+	return stats
+}
+
+func (m *HmpMonitor) GetBlockStats(callback BlockStatsCallback) {
+	m.Query("info blockstats", func(output string) {
+		callback(parseHmpBlockStats(output), "")
+	})
+}
+
 func (m *HmpMonitor) CancelBlockJob(driveName string, force bool, callback StringCallback) {
 	cmd := "block_job_cancel "
 	if force {
@@ -39,3 +39,19 @@ func TestHmpMonitor_Connect(t *testing.T) {
 	time.Sleep(3 * time.Second)
 	m.Disconnect()
 }
+
+func TestParseHmpBlockStats(t *testing.T) {
+	output := "drive_0: rd_bytes=4096 wr_bytes=512 rd_operations=8 wr_operations=1 flush_operations=0 wr_total_time_ns=1000 rd_total_time_ns=2000 flush_total_time_ns=0\r\n" +
+		"drive_1: rd_bytes=0 wr_bytes=0 rd_operations=0 wr_operations=0\r\n"
+	stats := parseHmpBlockStats(output)
+	if len(stats) != 2 {
+		t.Fatalf("expect 2 devices, got %d", len(stats))
+	}
+	want := BlockStats{Device: "drive_0", RdBytes: 4096, WrBytes: 512, RdOperations: 8, WrOperations: 1, RdTotalTimeNs: 2000, WrTotalTimeNs: 1000}
+	if stats[0] != want {
+		t.Errorf("got %#v want %#v", stats[0], want)
+	}
+	if stats[1].Device != "drive_1" {
+		t.Errorf("unexpected device %s", stats[1].Device)
+	}
+}
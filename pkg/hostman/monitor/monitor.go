@@ -27,6 +27,22 @@ import (
 
 type StringCallback func(string)
 
+// BalloonCallback receives the actual memory size of guest in MB
+type BalloonCallback func(actualMB int64, err string)
+
+// BlockStats is the accumulated io counters of a block device
+type BlockStats struct {
+	Device        string `json:"device"`
+	RdBytes       int64  `json:"rd_bytes"`
+	WrBytes       int64  `json:"wr_bytes"`
+	RdOperations  int64  `json:"rd_operations"`
+	WrOperations  int64  `json:"wr_operations"`
+	RdTotalTimeNs int64  `json:"rd_total_time_ns"`
+	WrTotalTimeNs int64  `json:"wr_total_time_ns"`
+}
+
+type BlockStatsCallback func(stats []BlockStats, err string)
+
 type BlockJob struct {
 	server string
 
@@ -58,7 +74,9 @@ type QemuBlock struct {
 	Qdev      string
 	TrayOpen  bool
 	Type      string
-	Inserted  struct {
+	// dirty bitmaps reported by qemu before 4.2
+	DirtyBitmaps []DirtyBitmap `json:"dirty-bitmaps"`
+	Inserted     struct {
 		Ro               bool
 		Drv              string
 		Encrypted        bool
@@ -80,6 +98,7 @@ type QemuBlock struct {
 		IopsSize         int64
 		DetectZeroes     string
 		WriteThreshold   int
+		DirtyBitmaps     []DirtyBitmap `json:"dirty-bitmaps"`
 		Image            struct {
 			Filename              string
 			Format                string
@@ -105,6 +124,36 @@ type QemuBlock struct {
 	}
 }
 
+type DirtyBitmap struct {
+	Name        string
+	Recording   bool
+	Busy        bool
+	Persistent  bool
+	Count       int64
+	Granularity int64
+}
+
+func (b *QemuBlock) GetDirtyBitmap(name string) *DirtyBitmap {
+	for _, bitmaps := range [][]DirtyBitmap{b.Inserted.DirtyBitmaps, b.DirtyBitmaps} {
+		for i := range bitmaps {
+			if bitmaps[i].Name == name {
+				return &bitmaps[i]
+			}
+		}
+	}
+	return nil
+}
+
+func (b *QemuBlock) GetDirtyBitmapNames() []string {
+	names := []string{}
+	for _, bitmaps := range [][]DirtyBitmap{b.Inserted.DirtyBitmaps, b.DirtyBitmaps} {
+		for i := range bitmaps {
+			names = append(names, bitmaps[i].Name)
+		}
+	}
+	return names
+}
+
 type MigrationInfo struct {
 	Status                *MigrationStatus  `json:"status,omitempty"`
 	RAM                   *MigrationStats   `json:"ram,omitempty"`
@@ -208,6 +257,9 @@ type Monitor interface {
 	GeMemtSlotIndex(func(index int))
 	GetMemoryDevicesInfo(QueryMemoryDevicesCallback)
 	GetMemdevList(MemdevListCallback)
+	// SetBalloon asks the guest balloon driver to resize guest memory to sizeMB
+	SetBalloon(sizeMB int64, callback StringCallback)
+	GetBalloonActual(callback BalloonCallback)
 
 	GetBlocks(callback func([]QemuBlock))
 	EjectCdrom(dev string, callback StringCallback)
@@ -225,6 +277,12 @@ type Monitor interface {
 	BlockStream(drive string, callback StringCallback)
 	DriveMirror(callback StringCallback, drive, target, syncMode, format string, unmap, blockReplication bool, speed int64)
 	DriveBackup(callback StringCallback, drive, target, syncMode, format string)
+	// DriveBackupBitmap starts a backup job exporting the clusters recorded by
+	// the dirty bitmap, or the whole disk if bitmap is empty, newBitmap is
+	// added atomically with the job if set
+	DriveBackupBitmap(callback StringCallback, jobId, drive, target, bitmap, syncMode, bitmapMode, newBitmap string)
+	BlockDirtyBitmapAdd(node, name string, persistent bool, callback StringCallback)
+	BlockDirtyBitmapRemove(node, name string, callback StringCallback)
 	BlockJobComplete(drive string, cb StringCallback)
 	BlockReopenImage(drive, newImagePath, format string, cb StringCallback)
 	SnapshotBlkdev(drive, newImagePath, format string, reuse bool, cb StringCallback)
@@ -247,6 +305,7 @@ type Monitor interface {
 
 	ResizeDisk(driveName string, sizeMB int64, callback StringCallback)
 	BlockIoThrottle(driveName string, bps, iops int64, callback StringCallback)
+	GetBlockStats(callback BlockStatsCallback)
 	CancelBlockJob(driveName string, force bool, callback StringCallback)
 
 	NetdevAdd(id, netType string, params map[string]string, callback StringCallback)
@@ -819,6 +819,85 @@ func (m *QmpMonitor) DriveBackup(callback StringCallback, drive, target, syncMod
 	m.Query(cmd, cb)
 }
 
+func (m *QmpMonitor) DriveBackupBitmap(callback StringCallback, jobId, drive, target, bitmap, syncMode, bitmapMode, newBitmap string) {
+	var (
+		cb = func(res *Response) {
+			callback(m.actionResult(res))
+		}
+		args = map[string]interface{}{
+			"job-id": jobId,
+			"device": drive,
+			"target": target,
+			"sync":   syncMode,
+			"format": "qcow2",
+		}
+	)
+	if len(bitmap) > 0 {
+		args["bitmap"] = bitmap
+	}
+	if len(bitmapMode) > 0 {
+		args["bitmap-mode"] = bitmapMode
+	}
+	if len(newBitmap) == 0 {
+		m.Query(&Command{Execute: "drive-backup", Args: args}, cb)
+		return
+	}
+	// the new bitmap starts recording at the same point of the backup
+	cmd := &Command{
+		Execute: "transaction",
+		Args: map[string]interface{}{
+			"actions": []interface{}{
+				map[string]interface{}{
+					"type": "block-dirty-bitmap-add",
+					"data": map[string]interface{}{
+						"node":       drive,
+						"name":       newBitmap,
+						"persistent": true,
+					},
+				},
+				map[string]interface{}{
+					"type": "drive-backup",
+					"data": args,
+				},
+			},
+		},
+	}
+	m.Query(cmd, cb)
+}
+
+func (m *QmpMonitor) BlockDirtyBitmapAdd(node, name string, persistent bool, callback StringCallback) {
+	var (
+		cb = func(res *Response) {
+			callback(m.actionResult(res))
+		}
+		cmd = &Command{
+			Execute: "block-dirty-bitmap-add",
+			Args: map[string]interface{}{
+				"node":       node,
+				"name":       name,
+				"persistent": persistent,
+			},
+		}
+	)
+	m.Query(cmd, cb)
+}
+
+func (m *QmpMonitor) BlockDirtyBitmapRemove(node, name string, callback StringCallback) {
+	var (
+		cb = func(res *Response) {
+			callback(m.actionResult(res))
+		}
+		cmd = &Command{
+			Execute: "block-dirty-bitmap-remove",
+			Args: map[string]interface{}{
+				"node": node,
+				"name": name,
+			},
+		}
+	)
+	m.Query(cmd, cb)
+}
+
 func (m *QmpMonitor) BlockStream(drive string, callback StringCallback) {
 	var (
 		speed = 5 * 100 * 1024 * 1024 // limit 500 MB/s
@@ -971,11 +1050,79 @@ func (m *QmpMonitor) GetMemdevList(callback MemdevListCallback) {
 	m.Query(cmd, cb)
 }
 
+func (m *QmpMonitor) SetBalloon(sizeMB int64, callback StringCallback) {
+	var (
+		cb = func(res *Response) {
+			callback(m.actionResult(res))
+		}
+		cmd = &Command{
+			Execute: "balloon",
+			Args:    map[string]interface{}{"value": sizeMB * 1024 * 1024},
+		}
+	)
+	m.Query(cmd, cb)
+}
+
+func (m *QmpMonitor) GetBalloonActual(callback BalloonCallback) {
+	var (
+		cb = func(res *Response) {
+			if res.ErrorVal != nil {
+				callback(0, res.ErrorVal.Error())
+				return
+			}
+			info := struct {
+				Actual int64 `json:"actual"`
+			}{}
+			if err := json.Unmarshal(res.Return, &info); err != nil {
+				callback(0, err.Error())
+				return
+			}
+			callback(info.Actual/1024/1024, "")
+		}
+		cmd = &Command{
+			Execute: "query-balloon",
+		}
+	)
+	m.Query(cmd, cb)
+}
+
 func (m *QmpMonitor) BlockIoThrottle(driveName string, bps, iops int64, callback StringCallback) {
 	cmd := fmt.Sprintf("block_set_io_throttle %s %d 0 0 %d 0 0", driveName, bps, iops)
 	m.HumanMonitorCommand(cmd, callback)
 }
 
+func (m *QmpMonitor) GetBlockStats(callback BlockStatsCallback) {
+	var (
+		cb = func(res *Response) {
+			if res.ErrorVal != nil {
+				callback(nil, res.ErrorVal.Error())
+				return
+			}
+			devs := []struct {
+				Device string     `json:"device"`
+				Stats  BlockStats `json:"stats"`
+			}{}
+			if err := json.Unmarshal(res.Return, &devs); err != nil {
+				callback(nil, err.Error())
+				return
+			}
+			stats := make([]BlockStats, 0, len(devs))
+			for i := range devs {
+				if len(devs[i].Device) == 0 {
+					continue
+				}
+				devs[i].Stats.Device = devs[i].Device
+				stats = append(stats, devs[i].Stats)
+			}
+			callback(stats, "")
+		}
+		cmd = &Command{
+			Execute: "query-blockstats",
+		}
+	)
+	m.Query(cmd, cb)
+}
+
 func (m *QmpMonitor) CancelBlockJob(driveName string, force bool, callback StringCallback) {
 	cmd := "block_job_cancel "
 	if force {
@@ -99,6 +99,25 @@ type SHostOptions struct {
 
 	ChntpwPath string `help:"path to chntpw tool" default:"/usr/local/bin/chntpw.static"`
 	OvmfPath   string `help:"Path to OVMF.fd" default:"/opt/cloud/contrib/OVMF.fd"`
+	SwtpmPath  string `help:"Path to swtpm emulating the vTPM of guest" default:"/usr/bin/swtpm"`
+
+	VirtiofsdPath string `help:"Path to virtiofsd serving guest shared directories" default:"/usr/libexec/virtiofsd"`
+
+	EnableMemBalloonController     bool `help:"Reclaim guest memory through balloon when host memory is under pressure" default:"false"`
+	MemBalloonCheckIntervalSeconds int  `help:"Interval in seconds of memory balloon controller" default:"30"`
+	MemBalloonReclaimPercent       int  `help:"Inflate guest balloons when host available memory is below this percent" default:"10"`
+	MemBalloonReleasePercent       int  `help:"Deflate guest balloons when host available memory is above this percent" default:"25"`
+	MemBalloonStepMb               int  `help:"Max memory size in MB a guest balloon is inflated or deflated per round" default:"512"`
+	MemBalloonFloorPercent         int  `help:"Percent of guest memory kept by balloon if the guest has no floor" default:"50"`
+
+	EnableIoQosController     bool `help:"Adjust guest disk io throttles by host io contention and project io budgets" default:"false"`
+	IoQosCheckIntervalSeconds int  `help:"Interval in seconds of io qos controller" default:"10"`
+	IoQosLatencyThresholdMs   int  `help:"Host disks are regarded as contended when average io latency of guests exceeds this value" default:"20"`
+	IoQosStepPercent          int  `help:"Max percent a disk io limit is tightened or relaxed per round" default:"20"`
+
+	EnableOvnAclLog          bool   `help:"Send security group acl log of ovn-controller to logger service" default:"false"`
+	OvnControllerLogPath     string `help:"Path of ovn-controller log file" default:"/var/log/ovn/ovn-controller.log"`
+	OvnAclLogIntervalSeconds int    `help:"Interval in seconds of reading acl log of ovn-controller" default:"5"`
 
 	LinuxDefaultRootUser    bool `help:"Default account for linux system is root"`
 	WindowsDefaultAdminUser bool `default:"true" help:"Default account for Windows system is Administrator"`
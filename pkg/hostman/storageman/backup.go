@@ -34,6 +34,7 @@ import (
 	"yunion.io/x/onecloud/pkg/hostman/storageman/backupstorage"
 	_ "yunion.io/x/onecloud/pkg/hostman/storageman/backupstorage/nfs"
 	_ "yunion.io/x/onecloud/pkg/hostman/storageman/backupstorage/object"
+	_ "yunion.io/x/onecloud/pkg/hostman/storageman/backupstorage/repository"
 	"yunion.io/x/onecloud/pkg/mcclient/auth"
 	identity_modules "yunion.io/x/onecloud/pkg/mcclient/modules/identity"
 	"yunion.io/x/onecloud/pkg/util/fileutils2"
@@ -75,6 +76,11 @@ func doBackupDisk(ctx context.Context, snapshotPath string, diskBackup *SDiskBac
 	}
 	defer CleanupDirOrFile(backupTmpDir)
 
+	backupStorage, err := backupstorage.GetBackupStorage(diskBackup.BackupStorageId, diskBackup.BackupStorageAccessInfo)
+	if err != nil {
+		return 0, errors.Wrap(err, "GetBackupStorage")
+	}
+
 	backupPath := path.Join(backupTmpDir, diskBackup.BackupId)
 	var newImageSizeMb int
 
@@ -102,7 +108,8 @@ func doBackupDisk(ctx context.Context, snapshotPath string, diskBackup *SDiskBac
 		if len(encKey) > 0 {
 			img.SetPassword(encKey)
 		}
-		newImage, err := img.Clone(backupPath, qemuimgfmt.QCOW2, true)
+		// compressed images hardly deduplicate
+		newImage, err := img.Clone(backupPath, qemuimgfmt.QCOW2, !backupstorage.IsDeduplicated(backupStorage))
 		if err != nil {
 			return 0, errors.Wrap(err, "unable to backup snapshot")
 		}
@@ -110,17 +117,139 @@ func doBackupDisk(ctx context.Context, snapshotPath string, diskBackup *SDiskBac
 		newImageSizeMb = newImage.GetActualSizeMB()
 	}
 
-	backupStorage, err := backupstorage.GetBackupStorage(diskBackup.BackupStorageId, diskBackup.BackupStorageAccessInfo)
+	err = backupStorage.SaveBackupFrom(ctx, backupPath, diskBackup.BackupId)
+	if err != nil {
+		return 0, errors.Wrap(err, "SaveBackupFrom")
+	}
+
+	return newImageSizeMb, nil
+}
+
+// SaveBitmapBackup uploads the image exported by a dirty bitmap backup job
+// as is, the clusters not exported stay unallocated so that the image can be
+// rebased onto its parent
+func SaveBitmapBackup(ctx context.Context, backupPath string, backup *SDiskBitmapBackup) (int, error) {
+	img, err := qemuimg.NewQemuImage(backupPath)
+	if err != nil {
+		return 0, errors.Wrap(err, "NewQemuImage")
+	}
+	backupStorage, err := backupstorage.GetBackupStorage(backup.BackupStorageId, backup.BackupStorageAccessInfo)
 	if err != nil {
 		return 0, errors.Wrap(err, "GetBackupStorage")
 	}
+	err = backupStorage.SaveBackupFrom(ctx, backupPath, backup.BackupId)
+	if err != nil {
+		return 0, errors.Wrap(err, "SaveBackupFrom")
+	}
+	return img.GetActualSizeMB(), nil
+}
 
-	err = backupStorage.SaveBackupFrom(ctx, backupPath, diskBackup.BackupId)
+// rebuildBackupChain downloads the ancestors of a backup from the full
+// backup down, and rebases every link onto its parent
+func rebuildBackupChain(ctx context.Context, backupStorage backupstorage.IBackupStorage, backupTmpDir string, chain []string, backupPath string) error {
+	backingPath := ""
+	for _, backupId := range chain {
+		linkPath := path.Join(backupTmpDir, backupId)
+		err := backupStorage.RestoreBackupTo(ctx, linkPath, backupId)
+		if err != nil {
+			return errors.Wrapf(err, "RestoreBackupTo %s", backupId)
+		}
+		if len(backingPath) > 0 {
+			err = rebaseBackupLink(linkPath, backingPath)
+			if err != nil {
+				return err
+			}
+		}
+		backingPath = linkPath
+	}
+	if len(backingPath) == 0 {
+		return nil
+	}
+	return rebaseBackupLink(backupPath, backingPath)
+}
+
+func rebaseBackupLink(linkPath, backingPath string) error {
+	img, err := qemuimg.NewQemuImage(linkPath)
+	if err != nil {
+		return errors.Wrapf(err, "NewQemuImage %s", linkPath)
+	}
+	// unsafe rebase only rewrites the header, the clusters not exported by
+	// the link are read from the parent
+	err = img.Rebase(backingPath, true)
+	if err != nil {
+		return errors.Wrapf(err, "rebase %s onto %s", linkPath, backingPath)
+	}
+	return nil
+}
+
+// DoConsolidateBackup merges the ancestors of a chained backup into it, the
+// backup is replaced by a full one in the backup storage
+func DoConsolidateBackup(ctx context.Context, info *SStorageConsolidateBackup) (int, error) {
+	backupTmpDir, err := EnsureBackupDir()
+	if err != nil {
+		return 0, errors.Wrap(err, "EnsureBackupDir")
+	}
+	defer CleanupDirOrFile(backupTmpDir)
+
+	backupStorage, err := backupstorage.GetBackupStorage(info.BackupStorageId, info.BackupStorageAccessInfo)
+	if err != nil {
+		return 0, errors.Wrap(err, "GetBackupStorage")
+	}
+	backupPath := path.Join(backupTmpDir, info.BackupId)
+	err = backupStorage.RestoreBackupTo(ctx, backupPath, info.BackupId)
+	if err != nil {
+		return 0, errors.Wrap(err, "RestoreBackupTo")
+	}
+	err = rebuildBackupChain(ctx, backupStorage, backupTmpDir, info.BackupChain, backupPath)
+	if err != nil {
+		return 0, errors.Wrap(err, "rebuildBackupChain")
+	}
+	img, err := qemuimg.NewQemuImage(backupPath)
+	if err != nil {
+		return 0, errors.Wrap(err, "NewQemuImage")
+	}
+	fullPath := backupPath + ".full"
+	fullImg, err := img.Clone(fullPath, qemuimgfmt.QCOW2, !backupstorage.IsDeduplicated(backupStorage))
+	if err != nil {
+		return 0, errors.Wrap(err, "flatten backup chain")
+	}
+	err = backupStorage.SaveBackupFrom(ctx, fullPath, info.BackupId)
 	if err != nil {
 		return 0, errors.Wrap(err, "SaveBackupFrom")
 	}
+	return fullImg.GetActualSizeMB(), nil
+}
 
-	return newImageSizeMb, nil
+// DoVerifyBackupRepository checks the chunks referenced by the backups in a
+// repository backup storage
+func DoVerifyBackupRepository(ctx context.Context, info *SStorageBackupRepository) (*api.SBackupRepositoryVerifyResult, error) {
+	repo, err := getBackupRepository(info)
+	if err != nil {
+		return nil, err
+	}
+	return repo.Verify(ctx, info.CheckData)
+}
+
+// DoGcBackupRepository removes the chunks no longer referenced by any backup
+// in a repository backup storage
+func DoGcBackupRepository(ctx context.Context, info *SStorageBackupRepository) (*api.SBackupRepositoryGcResult, error) {
+	repo, err := getBackupRepository(info)
+	if err != nil {
+		return nil, err
+	}
+	return repo.Gc(ctx, info.DryRun)
+}
+
+func getBackupRepository(info *SStorageBackupRepository) (backupstorage.IBackupRepository, error) {
+	backupStorage, err := backupstorage.GetBackupStorage(info.BackupStorageId, info.BackupStorageAccessInfo)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetBackupStorage")
+	}
+	repo, ok := backupStorage.(backupstorage.IBackupRepository)
+	if !ok {
+		return nil, errors.Wrapf(errors.ErrNotSupported, "backup storage %s is not a repository", info.BackupStorageId)
+	}
+	return repo, nil
 }
 
 type IDiskCreator interface {
@@ -147,6 +276,12 @@ func doRestoreDisk(ctx context.Context, dc IDiskCreator, input *SDiskCreateByDis
 	}
 
 	backupInput := diskInfo.Backup
+	if len(backupInput.BackupChain) > 0 {
+		err = rebuildBackupChain(ctx, backupStorage, backupTmpDir, backupInput.BackupChain, backupPath)
+		if err != nil {
+			return errors.Wrap(err, "rebuildBackupChain")
+		}
+	}
 
 	if backupInput.BackupAsTar != nil {
 		return doRestoreTarDisk(ctx, dc, disk, input, destImgPath, backupPath)
@@ -230,6 +365,7 @@ func doRestoreTarDisk(ctx context.Context, dc IDiskCreator, disk IDisk, input *S
 const (
 	PackageDiskFilename     = "disk"
 	PackageMetadataFilename = "metadata"
+	PackageVtpmFilename     = "vtpm"
 )
 
 func DoInstancePackBackup(ctx context.Context, backupInfo SStoragePackInstanceBackup) (string, error) {
@@ -263,6 +399,14 @@ func DoInstancePackBackup(ctx context.Context, backupInfo SStoragePackInstanceBa
 			}
 		}
 	}
+	if len(backupInfo.VtpmBackupId) > 0 {
+		// download vtpm state
+		packageVtpmPath := path.Join(packagePath, PackageVtpmFilename)
+		err := backupStorage.RestoreBackupTo(ctx, packageVtpmPath, backupInfo.VtpmBackupId)
+		if err != nil {
+			return "", errors.Wrapf(err, "RestoreBackupTo %s %s", backupInfo.VtpmBackupId, packageVtpmPath)
+		}
+	}
 	{
 		// save snapshot metadata
 		packageMetadataPath := path.Join(packagePath, PackageMetadataFilename)
@@ -376,6 +520,18 @@ func DoInstanceUnpackBackup(ctx context.Context, backupInfo SStorageUnpackInstan
 				return nil, nil, errors.Wrapf(err, "SaveBackupFrom %s %s", packageDiskPath, backupId)
 			}
 		}
+		if metadata.HasVtpm {
+			vtpmBackupId := db.DefaultUUIDGenerator() + ".vtpm"
+			packageVtpmPath := path.Join(packagePath, PackageVtpmFilename)
+			err := backupStorage.SaveBackupFrom(ctx, packageVtpmPath, vtpmBackupId)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "SaveBackupFrom %s %s", packageVtpmPath, vtpmBackupId)
+			}
+			if metadata.Metadata == nil {
+				metadata.Metadata = map[string]string{}
+			}
+			metadata.Metadata[api.INSTANCE_BACKUP_METADATA_VTPM_BACKUP_ID] = vtpmBackupId
+		}
 	}
 
 	return backupIds, metadata, nil
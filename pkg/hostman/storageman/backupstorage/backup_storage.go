@@ -17,9 +17,12 @@ package backupstorage
 import (
 	"context"
 	"sync"
+	"time"
 
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/pkg/errors"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
 )
 
 type IBackupStorageFactory interface {
@@ -54,6 +57,45 @@ type IBackupStorage interface {
 	IsOnline() (bool, string, error)
 }
 
+// IBackupBlobStore is the key value view of a backup storage backend, on which
+// the chunk repository is built. Blob operations are only valid between Open
+// and Close
+type IBackupBlobStore interface {
+	Open() error
+	Close() error
+
+	PutBlob(ctx context.Context, key string, data []byte) error
+	GetBlob(ctx context.Context, key string) ([]byte, error)
+	RemoveBlob(ctx context.Context, key string) error
+	IsBlobExists(ctx context.Context, key string) (bool, error)
+	ListBlobs(ctx context.Context, prefix string) ([]SBlobInfo, error)
+
+	IsOnline() (bool, string, error)
+}
+
+type SBlobInfo struct {
+	Key       string
+	SizeBytes int64
+	ModTime   time.Time
+}
+
+// IDedupBackupStorage is implemented by the backup storage deduplicating the
+// saved files itself, which prefers uncompressed images
+type IDedupBackupStorage interface {
+	IsDeduplicated() bool
+}
+
+func IsDeduplicated(bs IBackupStorage) bool {
+	dbs, ok := bs.(IDedupBackupStorage)
+	return ok && dbs.IsDeduplicated()
+}
+
+// IBackupRepository is implemented by the chunk repository
+type IBackupRepository interface {
+	Verify(ctx context.Context, checkData bool) (*api.SBackupRepositoryVerifyResult, error)
+	Gc(ctx context.Context, dryRun bool) (*api.SBackupRepositoryGcResult, error)
+}
+
 var factories []IBackupStorageFactory
 var backupStoragePool map[string]IBackupStorage
 var backupStorageLock *sync.Mutex
@@ -0,0 +1,139 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nfs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/hostman/storageman/backupstorage"
+	"yunion.io/x/onecloud/pkg/util/fileutils2"
+)
+
+func NewNFSBlobStore(backupStorageId, nfsHost, nfsSharedDir string) backupstorage.IBackupBlobStore {
+	return newNFSBackupStorage(backupStorageId, nfsHost, nfsSharedDir)
+}
+
+func (s *SNFSBackupStorage) Open() error {
+	return s.checkAndMount()
+}
+
+func (s *SNFSBackupStorage) Close() error {
+	return s.unMount()
+}
+
+func (s *SNFSBackupStorage) getBlobPath(key string) string {
+	return path.Join(s.Path, key)
+}
+
+func (s *SNFSBackupStorage) PutBlob(ctx context.Context, key string, data []byte) error {
+	filename := s.getBlobPath(key)
+	err := os.MkdirAll(path.Dir(filename), 0755)
+	if err != nil {
+		return errors.Wrapf(err, "mkdir %s", path.Dir(filename))
+	}
+	// write to a temporary file of its own first, so that a blob is either
+	// complete or absent, and concurrent writers of the same key do not
+	// clobber each other's temporary files
+	tmpFile, err := ioutil.TempFile(path.Dir(filename), path.Base(filename)+".*.tmp")
+	if err != nil {
+		return errors.Wrapf(err, "create temporary file of %s", key)
+	}
+	tmpFilename := tmpFile.Name()
+	err = func() error {
+		defer tmpFile.Close()
+		if _, err := tmpFile.Write(data); err != nil {
+			return errors.Wrapf(err, "write %s", tmpFilename)
+		}
+		if err := tmpFile.Chmod(0644); err != nil {
+			return errors.Wrapf(err, "chmod %s", tmpFilename)
+		}
+		return nil
+	}()
+	if err != nil {
+		os.Remove(tmpFilename)
+		return err
+	}
+	err = os.Rename(tmpFilename, filename)
+	if err != nil {
+		os.Remove(tmpFilename)
+		if fileutils2.Exists(filename) {
+			// put by a concurrent writer, chunks of the same key have the
+			// same content
+			return nil
+		}
+		return errors.Wrapf(err, "rename %s", tmpFilename)
+	}
+	return nil
+}
+
+func (s *SNFSBackupStorage) GetBlob(ctx context.Context, key string) ([]byte, error) {
+	data, err := ioutil.ReadFile(s.getBlobPath(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Wrap(errors.ErrNotFound, key)
+		}
+		return nil, errors.Wrapf(err, "read %s", key)
+	}
+	return data, nil
+}
+
+func (s *SNFSBackupStorage) RemoveBlob(ctx context.Context, key string) error {
+	err := os.Remove(s.getBlobPath(key))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "remove %s", key)
+	}
+	return nil
+}
+
+func (s *SNFSBackupStorage) IsBlobExists(ctx context.Context, key string) (bool, error) {
+	return fileutils2.Exists(s.getBlobPath(key)), nil
+}
+
+func (s *SNFSBackupStorage) ListBlobs(ctx context.Context, prefix string) ([]backupstorage.SBlobInfo, error) {
+	blobs := make([]backupstorage.SBlobInfo, 0)
+	root := s.getBlobPath(prefix)
+	if !fileutils2.Exists(root) {
+		return blobs, nil
+	}
+	err := filepath.Walk(root, func(filename string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(filename, ".tmp") {
+			return nil
+		}
+		key, err := filepath.Rel(s.Path, filename)
+		if err != nil {
+			return err
+		}
+		blobs = append(blobs, backupstorage.SBlobInfo{
+			Key:       key,
+			SizeBytes: info.Size(),
+			ModTime:   info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "walk %s", root)
+	}
+	return blobs, nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nfs
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestPutBlobConcurrently(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nfs-blob")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	s := &SNFSBackupStorage{Path: dir, lock: &sync.Mutex{}}
+
+	ctx := context.Background()
+	key := "chunks/ab/abcdef"
+	data := bytes.Repeat([]byte("chunk"), 4096)
+	wg := &sync.WaitGroup{}
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- s.PutBlob(ctx, key, data)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("PutBlob: %v", err)
+		}
+	}
+
+	got, err := s.GetBlob(ctx, key)
+	if err != nil {
+		t.Fatalf("GetBlob: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("blob content mismatch")
+	}
+	blobs, err := s.ListBlobs(ctx, "chunks")
+	if err != nil {
+		t.Fatalf("ListBlobs: %v", err)
+	}
+	if len(blobs) != 1 || blobs[0].Key != key {
+		t.Errorf("want only blob %s, got %#v", key, blobs)
+	}
+	files, err := ioutil.ReadDir(dir + "/chunks/ab")
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(files) != 1 {
+		t.Errorf("temporary files left: %d files", len(files))
+	}
+	if mode := files[0].Mode().Perm(); mode != 0644 {
+		t.Errorf("want mode 0644, got %o", mode)
+	}
+}
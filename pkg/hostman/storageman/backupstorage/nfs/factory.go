@@ -31,6 +31,9 @@ func (factory *sNfsBackupStorageFactory) NewBackupStore(backupStroageId string,
 	if err != nil {
 		return nil, errors.Wrap(err, "Unmarshal access info")
 	}
+	if len(accessInfo.RepositoryBackend) > 0 {
+		return nil, errors.Wrap(httperrors.ErrInputParameter, "repository backup storage")
+	}
 	if len(accessInfo.NfsHost) == 0 {
 		return nil, errors.Wrap(httperrors.ErrInputParameter, "need nfs_host in backup_storage_access_info")
 	}
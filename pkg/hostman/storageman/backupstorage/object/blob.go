@@ -0,0 +1,108 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package object
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+
+	"yunion.io/x/cloudmux/pkg/cloudprovider"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/hostman/storageman/backupstorage"
+)
+
+func NewObjectBlobStore(backupStorageId, bucketUrl, accessKey, secret string) (backupstorage.IBackupBlobStore, error) {
+	return newObjectBackupStorage(backupStorageId, bucketUrl, accessKey, secret)
+}
+
+func (s *SObjectBackupStorage) Open() error {
+	return nil
+}
+
+func (s *SObjectBackupStorage) Close() error {
+	return nil
+}
+
+func (s *SObjectBackupStorage) PutBlob(ctx context.Context, key string, data []byte) error {
+	bucket, err := s.getBucket()
+	if err != nil {
+		return errors.Wrap(err, "getBucket")
+	}
+	err = cloudprovider.UploadObject(ctx, bucket, key, 0, bytes.NewReader(data), int64(len(data)), cloudprovider.ACLPrivate, "", nil, false)
+	if err != nil {
+		return errors.Wrapf(err, "UploadObject %s", key)
+	}
+	return nil
+}
+
+func (s *SObjectBackupStorage) GetBlob(ctx context.Context, key string) ([]byte, error) {
+	bucket, err := s.getBucket()
+	if err != nil {
+		return nil, errors.Wrap(err, "getBucket")
+	}
+	reader, err := bucket.GetObject(ctx, key, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetObject %s", key)
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %s", key)
+	}
+	return data, nil
+}
+
+func (s *SObjectBackupStorage) RemoveBlob(ctx context.Context, key string) error {
+	bucket, err := s.getBucket()
+	if err != nil {
+		return errors.Wrap(err, "getBucket")
+	}
+	err = bucket.DeleteObject(ctx, key)
+	if err != nil {
+		return errors.Wrapf(err, "DeleteObject %s", key)
+	}
+	return nil
+}
+
+func (s *SObjectBackupStorage) IsBlobExists(ctx context.Context, key string) (bool, error) {
+	return s.isObjectExists(key, func(key string) string { return key })
+}
+
+func (s *SObjectBackupStorage) ListBlobs(ctx context.Context, prefix string) ([]backupstorage.SBlobInfo, error) {
+	bucket, err := s.getBucket()
+	if err != nil {
+		return nil, errors.Wrap(err, "getBucket")
+	}
+	objs, err := cloudprovider.GetAllObjects(bucket, prefix, true)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetAllObjects %s", prefix)
+	}
+	blobs := make([]backupstorage.SBlobInfo, 0, len(objs))
+	for _, obj := range objs {
+		if strings.HasSuffix(obj.GetKey(), "/") {
+			// directory placeholder
+			continue
+		}
+		blobs = append(blobs, backupstorage.SBlobInfo{
+			Key:       obj.GetKey(),
+			SizeBytes: obj.GetSizeBytes(),
+			ModTime:   obj.GetLastModified(),
+		})
+	}
+	return blobs, nil
+}
@@ -31,6 +31,9 @@ func (factory *sObjectBackupStorageFactory) NewBackupStore(backupStroageId strin
 	if err != nil {
 		return nil, errors.Wrap(err, "Unmarshal access info")
 	}
+	if len(accessInfo.RepositoryBackend) > 0 {
+		return nil, errors.Wrap(httperrors.ErrInputParameter, "repository backup storage")
+	}
 	if len(accessInfo.ObjectBucketUrl) == 0 {
 		return nil, errors.Wrap(httperrors.ErrInputParameter, "need object_bucket_url in backup_storage_access_info")
 	}
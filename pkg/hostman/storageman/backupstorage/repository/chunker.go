@@ -0,0 +1,128 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"yunion.io/x/pkg/errors"
+)
+
+// The disk images are split by content defined chunking, so that an insertion
+// or deletion only changes the chunks around it. The cut points are found by a
+// gear rolling hash with normalized chunking: a harder mask before the average
+// size and an easier one after it, which keeps the sizes close to average.
+const (
+	chunkMinSize = 256 * 1024
+	chunkAvgSize = 1024 * 1024
+	chunkMaxSize = 4 * 1024 * 1024
+
+	// the masks check the high bits, which depend on the most recent bytes
+	chunkMaskS = uint64(1<<22-1) << (64 - 22)
+	chunkMaskL = uint64(1<<18-1) << (64 - 18)
+)
+
+// gearTable must never change, otherwise the chunks no longer deduplicate
+// against the existing ones
+var gearTable [256]uint64
+
+func init() {
+	for i := range gearTable {
+		sum := sha256.Sum256([]byte(fmt.Sprintf("gear-%d", i)))
+		gearTable[i] = binary.LittleEndian.Uint64(sum[:8])
+	}
+}
+
+// cutPoint returns the length of the first chunk of data
+func cutPoint(data []byte) int {
+	n := len(data)
+	if n <= chunkMinSize {
+		return n
+	}
+	if n > chunkMaxSize {
+		n = chunkMaxSize
+	}
+	normal := chunkAvgSize
+	if normal > n {
+		normal = n
+	}
+	var h uint64
+	i := chunkMinSize
+	for ; i < normal; i++ {
+		h = (h << 1) + gearTable[data[i]]
+		if h&chunkMaskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		h = (h << 1) + gearTable[data[i]]
+		if h&chunkMaskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+type sChunker struct {
+	reader io.Reader
+	buf    []byte
+	start  int
+	end    int
+	eof    bool
+}
+
+func newChunker(reader io.Reader) *sChunker {
+	return &sChunker{
+		reader: reader,
+		buf:    make([]byte, chunkMaxSize),
+	}
+}
+
+func (c *sChunker) fill() error {
+	copy(c.buf, c.buf[c.start:c.end])
+	c.end -= c.start
+	c.start = 0
+	for c.end < len(c.buf) && !c.eof {
+		n, err := c.reader.Read(c.buf[c.end:])
+		c.end += n
+		if err == io.EOF {
+			c.eof = true
+		} else if err != nil {
+			return errors.Wrap(err, "read")
+		}
+	}
+	return nil
+}
+
+// Next returns the next chunk, which is only valid until the next call, or
+// io.EOF at the end of the input
+func (c *sChunker) Next() ([]byte, error) {
+	if c.end-c.start < chunkMaxSize && !c.eof {
+		err := c.fill()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.start == c.end {
+		return nil, io.EOF
+	}
+	n := cutPoint(c.buf[c.start:c.end])
+	chunk := c.buf[c.start : c.start+n]
+	c.start += n
+	return chunk, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repository
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func randomData(seed int64, size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func splitChunks(t *testing.T, data []byte) [][]byte {
+	chunks := [][]byte{}
+	chunker := newChunker(bytes.NewReader(data))
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		chunks = append(chunks, append([]byte{}, chunk...))
+	}
+	return chunks
+}
+
+func TestChunker(t *testing.T) {
+	data := randomData(1, 20*1024*1024+123)
+	chunks := splitChunks(t, data)
+	joined := bytes.Join(chunks, nil)
+	if !bytes.Equal(joined, data) {
+		t.Fatalf("chunks do not add up to the data")
+	}
+	for i, chunk := range chunks {
+		if len(chunk) > chunkMaxSize {
+			t.Errorf("chunk %d size %d exceeds max", i, len(chunk))
+		}
+		if i < len(chunks)-1 && len(chunk) < chunkMinSize {
+			t.Errorf("chunk %d size %d below min", i, len(chunk))
+		}
+	}
+
+	// the cut points are content defined, inserting bytes only changes the
+	// chunks around the insertion
+	shifted := append([]byte("inserted"), data...)
+	ids := map[string]bool{}
+	codec, _ := newCodec("key")
+	for _, chunk := range chunks {
+		ids[codec.ChunkId(chunk)] = true
+	}
+	shared := 0
+	shiftedChunks := splitChunks(t, shifted)
+	for _, chunk := range shiftedChunks {
+		if ids[codec.ChunkId(chunk)] {
+			shared++
+		}
+	}
+	if shared < len(shiftedChunks)-2 {
+		t.Errorf("only %d of %d chunks shared after insertion", shared, len(shiftedChunks))
+	}
+}
+
+func TestChunkerEmpty(t *testing.T) {
+	if chunks := splitChunks(t, nil); len(chunks) != 0 {
+		t.Errorf("want no chunk, got %d", len(chunks))
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repository
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+
+	"github.com/pierrec/lz4/v4"
+
+	"yunion.io/x/pkg/errors"
+)
+
+const (
+	blobVersion = 1
+
+	blobFlagRaw = 0
+	blobFlagLz4 = 1
+)
+
+// sCodec compresses and encrypts every blob of the repository on its own.
+// Chunks are named by a keyed hash of the plain content, so that equal chunks
+// deduplicate while the names reveal nothing without the repository key.
+type sCodec struct {
+	idKey    []byte
+	keyCheck string
+	aead     cipher.AEAD
+}
+
+func deriveKey(master []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+func newCodec(repositoryKey string) (*sCodec, error) {
+	if len(repositoryKey) == 0 {
+		return nil, errors.Wrap(errors.ErrEmpty, "repository key")
+	}
+	master := sha256.Sum256([]byte(repositoryKey))
+	block, err := aes.NewCipher(deriveKey(master[:], "chunk-encrypt"))
+	if err != nil {
+		return nil, errors.Wrap(err, "NewCipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "NewGCM")
+	}
+	return &sCodec{
+		idKey:    deriveKey(master[:], "chunk-id"),
+		keyCheck: hex.EncodeToString(deriveKey(master[:], "key-check")),
+		aead:     aead,
+	}, nil
+}
+
+func (c *sCodec) ChunkId(data []byte) string {
+	mac := hmac.New(sha256.New, c.idKey)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Encode returns version | nonce | sealed(flag | plain size | payload), the
+// blob key is authenticated as well so that blobs cannot be swapped
+func (c *sCodec) Encode(key string, data []byte) ([]byte, error) {
+	plain := make([]byte, 5+len(data))
+	compressor := lz4.Compressor{}
+	n, err := compressor.CompressBlock(data, plain[5:])
+	if err == nil && n > 0 && n < len(data) {
+		plain[0] = blobFlagLz4
+		plain = plain[:5+n]
+	} else {
+		plain[0] = blobFlagRaw
+		copy(plain[5:], data)
+	}
+	binary.BigEndian.PutUint32(plain[1:5], uint32(len(data)))
+
+	nonceSize := c.aead.NonceSize()
+	out := make([]byte, 1+nonceSize, 1+nonceSize+len(plain)+c.aead.Overhead())
+	out[0] = blobVersion
+	_, err = rand.Read(out[1:])
+	if err != nil {
+		return nil, errors.Wrap(err, "generate nonce")
+	}
+	return c.aead.Seal(out, out[1:], plain, []byte(key)), nil
+}
+
+func (c *sCodec) Decode(key string, blob []byte) ([]byte, error) {
+	nonceSize := c.aead.NonceSize()
+	if len(blob) < 1+nonceSize {
+		return nil, errors.Wrapf(errors.ErrInvalidFormat, "blob %s too short", key)
+	}
+	if blob[0] != blobVersion {
+		return nil, errors.Wrapf(errors.ErrInvalidFormat, "blob %s version %d", key, blob[0])
+	}
+	plain, err := c.aead.Open(nil, blob[1:1+nonceSize], blob[1+nonceSize:], []byte(key))
+	if err != nil {
+		return nil, errors.Wrapf(err, "decrypt blob %s", key)
+	}
+	if len(plain) < 5 {
+		return nil, errors.Wrapf(errors.ErrInvalidFormat, "blob %s header", key)
+	}
+	size := int(binary.BigEndian.Uint32(plain[1:5]))
+	switch plain[0] {
+	case blobFlagRaw:
+		if len(plain)-5 != size {
+			return nil, errors.Wrapf(errors.ErrInvalidFormat, "blob %s size %d != %d", key, len(plain)-5, size)
+		}
+		return plain[5:], nil
+	case blobFlagLz4:
+		data := make([]byte, size)
+		n, err := lz4.UncompressBlock(plain[5:], data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "uncompress blob %s", key)
+		}
+		if n != size {
+			return nil, errors.Wrapf(errors.ErrInvalidFormat, "blob %s size %d != %d", key, n, size)
+		}
+		return data, nil
+	default:
+		return nil, errors.Wrapf(errors.ErrInvalidFormat, "blob %s flag %d", key, plain[0])
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repository
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCodec(t *testing.T) {
+	codec, err := newCodec("key")
+	if err != nil {
+		t.Fatalf("newCodec: %v", err)
+	}
+	for _, data := range [][]byte{
+		{},
+		bytes.Repeat([]byte("a"), 64*1024),
+		randomData(2, 64*1024),
+	} {
+		blob, err := codec.Encode("chunk", data)
+		if err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		if len(data) > 0 && bytes.Contains(blob, data[:32]) {
+			t.Errorf("blob is not encrypted")
+		}
+		got, err := codec.Decode("chunk", blob)
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("decoded data mismatch")
+		}
+		// the key is authenticated, a blob could not be moved to another key
+		if _, err := codec.Decode("other", blob); err == nil {
+			t.Errorf("decode under another key should fail")
+		}
+	}
+
+	other, _ := newCodec("other key")
+	blob, _ := codec.Encode("chunk", []byte("data"))
+	if _, err := other.Decode("chunk", blob); err == nil {
+		t.Errorf("decode with another repository key should fail")
+	}
+	if other.keyCheck == codec.keyCheck || other.ChunkId([]byte("data")) == codec.ChunkId([]byte("data")) {
+		t.Errorf("key check and chunk id should depend on the repository key")
+	}
+	if _, err := newCodec(""); err == nil {
+		t.Errorf("empty repository key should be rejected")
+	}
+}
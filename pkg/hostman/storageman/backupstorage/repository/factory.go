@@ -0,0 +1,62 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repository
+
+import (
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/hostman/storageman/backupstorage"
+	"yunion.io/x/onecloud/pkg/hostman/storageman/backupstorage/nfs"
+	"yunion.io/x/onecloud/pkg/hostman/storageman/backupstorage/object"
+	"yunion.io/x/onecloud/pkg/httperrors"
+)
+
+type sRepositoryBackupStorageFactory struct{}
+
+func (factory *sRepositoryBackupStorageFactory) NewBackupStore(backupStroageId string, backupStorageAccessInfo *jsonutils.JSONDict) (backupstorage.IBackupStorage, error) {
+	accessInfo := api.SBackupStorageAccessInfo{}
+	err := backupStorageAccessInfo.Unmarshal(&accessInfo)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unmarshal access info")
+	}
+	if len(accessInfo.RepositoryKey) == 0 {
+		return nil, errors.Wrap(httperrors.ErrInputParameter, "need repository_key in backup_storage_access_info")
+	}
+	var store backupstorage.IBackupBlobStore
+	switch api.TBackupStorageType(accessInfo.RepositoryBackend) {
+	case api.BACKUPSTORAGE_TYPE_NFS:
+		if len(accessInfo.NfsHost) == 0 || len(accessInfo.NfsSharedDir) == 0 {
+			return nil, errors.Wrap(httperrors.ErrInputParameter, "need nfs_host and nfs_shared_dir in backup_storage_access_info")
+		}
+		store = nfs.NewNFSBlobStore(backupStroageId, accessInfo.NfsHost, accessInfo.NfsSharedDir)
+	case api.BACKUPSTORAGE_TYPE_OBJECT_STORAGE:
+		if len(accessInfo.ObjectBucketUrl) == 0 || len(accessInfo.ObjectAccessKey) == 0 || len(accessInfo.ObjectSecret) == 0 {
+			return nil, errors.Wrap(httperrors.ErrInputParameter, "need object_bucket_url, object_access_key and object_secret in backup_storage_access_info")
+		}
+		store, err = object.NewObjectBlobStore(backupStroageId, accessInfo.ObjectBucketUrl, accessInfo.ObjectAccessKey, accessInfo.ObjectSecret)
+		if err != nil {
+			return nil, errors.Wrap(err, "NewObjectBlobStore")
+		}
+	default:
+		return nil, errors.Wrapf(httperrors.ErrInputParameter, "invalid repository_backend %q in backup_storage_access_info", accessInfo.RepositoryBackend)
+	}
+	return newRepositoryBackupStorage(backupStroageId, store, accessInfo.RepositoryKey)
+}
+
+func init() {
+	backupstorage.RegisterFactory(&sRepositoryBackupStorageFactory{})
+}
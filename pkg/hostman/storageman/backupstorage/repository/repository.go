@@ -0,0 +1,598 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repository
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/stringutils"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/hostman/storageman/backupstorage"
+	"yunion.io/x/onecloud/pkg/httperrors"
+)
+
+// Layout of the repository on the blob store:
+//
+//	repository/config              version and key check
+//	repository/chunks/<xx>/<id>    chunks shared by all backups
+//	repository/backups/<id>        manifest of a disk backup
+//	repository/backuppacks/<id>    manifest of an instance backup pack
+//	repository/locks/<kind>-<uuid> locks between saving and garbage collection
+const (
+	repositoryPrefix  = "repository"
+	configKey         = repositoryPrefix + "/config"
+	chunkPrefix       = repositoryPrefix + "/chunks/"
+	backupPrefix      = repositoryPrefix + "/backups/"
+	backupPackPrefix  = repositoryPrefix + "/backuppacks/"
+	lockPrefix        = repositoryPrefix + "/locks/"
+	repositoryVersion = 1
+	lockKindShared    = "shared"
+	lockKindExclusive = "exclusive"
+)
+
+var (
+	// the lock blob is rewritten periodically by its holder, a lock not
+	// refreshed for lockStaleTimeout is left by a crashed holder
+	lockRefreshInterval = 5 * time.Minute
+	lockStaleTimeout    = 30 * time.Minute
+)
+
+var ErrorRepositoryBusy error = errors.Error("RepositoryBusy")
+
+type sRepositoryConfig struct {
+	Version  int    `json:"version"`
+	KeyCheck string `json:"key_check"`
+}
+
+type sManifestChunk struct {
+	Id   string `json:"id"`
+	Size int    `json:"size"`
+}
+
+type sManifest struct {
+	Version   int              `json:"version"`
+	SizeBytes int64            `json:"size_bytes"`
+	Chunks    []sManifestChunk `json:"chunks"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+type SRepositoryBackupStorage struct {
+	BackupStorageId string
+
+	store backupstorage.IBackupBlobStore
+	codec *sCodec
+
+	lock        *sync.Mutex
+	initialized bool
+}
+
+func newRepositoryBackupStorage(backupStorageId string, store backupstorage.IBackupBlobStore, repositoryKey string) (*SRepositoryBackupStorage, error) {
+	codec, err := newCodec(repositoryKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "newCodec")
+	}
+	return &SRepositoryBackupStorage{
+		BackupStorageId: backupStorageId,
+		store:           store,
+		codec:           codec,
+		lock:            &sync.Mutex{},
+	}, nil
+}
+
+func getChunkKey(id string) string {
+	return chunkPrefix + id[:2] + "/" + id
+}
+
+func getBackupKey(backupId string) string {
+	return backupPrefix + backupId
+}
+
+func getBackupPackKey(backupInstanceId string) string {
+	return backupPackPrefix + backupInstanceId
+}
+
+func (s *SRepositoryBackupStorage) IsDeduplicated() bool {
+	return true
+}
+
+// open opens the blob store and checks the repository key against the
+// config, the config is written by the first user of the repository
+func (s *SRepositoryBackupStorage) open(ctx context.Context) error {
+	err := s.store.Open()
+	if err != nil {
+		return errors.Wrap(err, "open blob store")
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.initialized {
+		return nil
+	}
+	err = s.checkConfig(ctx)
+	if err != nil {
+		s.store.Close()
+		return err
+	}
+	s.initialized = true
+	return nil
+}
+
+func (s *SRepositoryBackupStorage) checkConfig(ctx context.Context) error {
+	data, err := s.store.GetBlob(ctx, configKey)
+	if err != nil {
+		if errors.Cause(err) != errors.ErrNotFound {
+			exist, err2 := s.store.IsBlobExists(ctx, configKey)
+			if err2 != nil || exist {
+				return errors.Wrap(err, "get config")
+			}
+		}
+		conf := sRepositoryConfig{
+			Version:  repositoryVersion,
+			KeyCheck: s.codec.keyCheck,
+		}
+		err = s.store.PutBlob(ctx, configKey, []byte(jsonutils.Marshal(conf).String()))
+		if err != nil {
+			return errors.Wrap(err, "put config")
+		}
+		return nil
+	}
+	obj, err := jsonutils.Parse(data)
+	if err != nil {
+		return errors.Wrap(err, "parse config")
+	}
+	conf := sRepositoryConfig{}
+	err = obj.Unmarshal(&conf)
+	if err != nil {
+		return errors.Wrap(err, "unmarshal config")
+	}
+	if conf.Version > repositoryVersion {
+		return errors.Wrapf(errors.ErrNotSupported, "repository version %d", conf.Version)
+	}
+	if conf.KeyCheck != s.codec.keyCheck {
+		return errors.Wrap(httperrors.ErrInvalidCredential, "repository key mismatch")
+	}
+	return nil
+}
+
+func (s *SRepositoryBackupStorage) close() {
+	s.store.Close()
+}
+
+type sRepositoryLock struct {
+	key  string
+	stop chan struct{}
+	done chan struct{}
+}
+
+// acquireLock puts a lock blob then checks the conflicting locks, as both
+// sides put before check, at least one of the racing parties backs off.
+// Saving takes a shared lock, garbage collection takes an exclusive one.
+// The lock is refreshed until released, so a long save is never taken as
+// stale.
+func (s *SRepositoryBackupStorage) acquireLock(ctx context.Context, kind string) (*sRepositoryLock, error) {
+	lock := &sRepositoryLock{
+		key:  lockPrefix + kind + "-" + stringutils.UUID4(),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	hostname, _ := os.Hostname()
+	err := s.store.PutBlob(ctx, lock.key, []byte(hostname))
+	if err != nil {
+		return nil, errors.Wrap(err, "put lock")
+	}
+	go s.refreshLock(ctx, lock, []byte(hostname))
+	locks, err := s.store.ListBlobs(ctx, lockPrefix)
+	if err != nil {
+		s.releaseLock(ctx, lock)
+		return nil, errors.Wrap(err, "list locks")
+	}
+	for _, other := range locks {
+		if other.Key == lock.key || time.Since(other.ModTime) > lockStaleTimeout {
+			continue
+		}
+		name := path.Base(other.Key)
+		if kind == lockKindExclusive || strings.HasPrefix(name, lockKindExclusive+"-") {
+			s.releaseLock(ctx, lock)
+			return nil, errors.Wrapf(ErrorRepositoryBusy, "locked by %s", name)
+		}
+	}
+	return lock, nil
+}
+
+func (s *SRepositoryBackupStorage) refreshLock(ctx context.Context, lock *sRepositoryLock, data []byte) {
+	defer close(lock.done)
+	ticker := time.NewTicker(lockRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lock.stop:
+			return
+		case <-ticker.C:
+			err := s.store.PutBlob(ctx, lock.key, data)
+			if err != nil {
+				log.Errorf("refresh repository lock %s: %v", lock.key, err)
+			}
+		}
+	}
+}
+
+func (s *SRepositoryBackupStorage) releaseLock(ctx context.Context, lock *sRepositoryLock) {
+	close(lock.stop)
+	<-lock.done
+	err := s.store.RemoveBlob(ctx, lock.key)
+	if err != nil {
+		log.Errorf("remove repository lock %s: %v", lock.key, err)
+	}
+}
+
+func (s *SRepositoryBackupStorage) putManifest(ctx context.Context, key string, manifest *sManifest) error {
+	blob, err := s.codec.Encode(key, []byte(jsonutils.Marshal(manifest).String()))
+	if err != nil {
+		return errors.Wrap(err, "encode manifest")
+	}
+	return s.store.PutBlob(ctx, key, blob)
+}
+
+func (s *SRepositoryBackupStorage) getManifest(ctx context.Context, key string) (*sManifest, error) {
+	blob, err := s.store.GetBlob(ctx, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "get manifest")
+	}
+	data, err := s.codec.Decode(key, blob)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode manifest")
+	}
+	obj, err := jsonutils.Parse(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse manifest")
+	}
+	manifest := &sManifest{}
+	err = obj.Unmarshal(manifest)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshal manifest")
+	}
+	return manifest, nil
+}
+
+func (s *SRepositoryBackupStorage) getChunk(ctx context.Context, id string) ([]byte, error) {
+	key := getChunkKey(id)
+	blob, err := s.store.GetBlob(ctx, key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get chunk %s", id)
+	}
+	data, err := s.codec.Decode(key, blob)
+	if err != nil {
+		return nil, err
+	}
+	if s.codec.ChunkId(data) != id {
+		return nil, errors.Wrapf(errors.ErrInvalidFormat, "chunk %s checksum mismatch", id)
+	}
+	return data, nil
+}
+
+// saveFile splits the file into chunks and uploads the chunks not yet in the
+// repository, the manifest is written last so that a backup is either
+// complete or absent
+func (s *SRepositoryBackupStorage) saveFile(ctx context.Context, srcFilename string, manifestKey string) error {
+	err := s.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+	lock, err := s.acquireLock(ctx, lockKindShared)
+	if err != nil {
+		return err
+	}
+	defer s.releaseLock(ctx, lock)
+
+	file, err := os.Open(srcFilename)
+	if err != nil {
+		return errors.Wrapf(err, "open %s", srcFilename)
+	}
+	defer file.Close()
+
+	manifest := &sManifest{
+		Version:   repositoryVersion,
+		Chunks:    make([]sManifestChunk, 0),
+		CreatedAt: time.Now().UTC(),
+	}
+	saved := map[string]bool{}
+	var newChunks, newBytes int64
+	chunker := newChunker(file)
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrapf(err, "read %s", srcFilename)
+		}
+		id := s.codec.ChunkId(chunk)
+		manifest.Chunks = append(manifest.Chunks, sManifestChunk{Id: id, Size: len(chunk)})
+		manifest.SizeBytes += int64(len(chunk))
+		if saved[id] {
+			continue
+		}
+		key := getChunkKey(id)
+		exist, err := s.store.IsBlobExists(ctx, key)
+		if err != nil {
+			return errors.Wrapf(err, "check chunk %s", id)
+		}
+		if !exist {
+			blob, err := s.codec.Encode(key, chunk)
+			if err != nil {
+				return errors.Wrapf(err, "encode chunk %s", id)
+			}
+			err = s.store.PutBlob(ctx, key, blob)
+			if err != nil {
+				return errors.Wrapf(err, "put chunk %s", id)
+			}
+			newChunks++
+			newBytes += int64(len(blob))
+		}
+		saved[id] = true
+	}
+	err = s.putManifest(ctx, manifestKey, manifest)
+	if err != nil {
+		return errors.Wrapf(err, "put manifest %s", manifestKey)
+	}
+	log.Infof("saved %s to repository %s: %d bytes in %d chunks, %d new chunks of %d bytes", srcFilename, s.BackupStorageId, manifest.SizeBytes, len(manifest.Chunks), newChunks, newBytes)
+	return nil
+}
+
+func (s *SRepositoryBackupStorage) restoreFile(ctx context.Context, targetFilename string, manifestKey string) error {
+	err := s.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	manifest, err := s.getManifest(ctx, manifestKey)
+	if err != nil {
+		return errors.Wrap(err, manifestKey)
+	}
+	file, err := os.OpenFile(targetFilename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "open %s", targetFilename)
+	}
+	defer file.Close()
+	for _, chunk := range manifest.Chunks {
+		data, err := s.getChunk(ctx, chunk.Id)
+		if err != nil {
+			return err
+		}
+		if len(data) != chunk.Size {
+			return errors.Wrapf(errors.ErrInvalidFormat, "chunk %s size %d != %d", chunk.Id, len(data), chunk.Size)
+		}
+		_, err = file.Write(data)
+		if err != nil {
+			return errors.Wrapf(err, "write %s", targetFilename)
+		}
+	}
+	return nil
+}
+
+// removeFile only removes the manifest, the chunks no longer referenced are
+// removed by garbage collection
+func (s *SRepositoryBackupStorage) removeFile(ctx context.Context, manifestKey string) error {
+	err := s.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+	return s.store.RemoveBlob(ctx, manifestKey)
+}
+
+func (s *SRepositoryBackupStorage) isFileExists(manifestKey string) (bool, error) {
+	ctx := context.Background()
+	err := s.open(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer s.close()
+	return s.store.IsBlobExists(ctx, manifestKey)
+}
+
+func (s *SRepositoryBackupStorage) SaveBackupFrom(ctx context.Context, srcFilename string, backupId string) error {
+	return s.saveFile(ctx, srcFilename, getBackupKey(backupId))
+}
+
+func (s *SRepositoryBackupStorage) RestoreBackupTo(ctx context.Context, targetFilename string, backupId string) error {
+	return s.restoreFile(ctx, targetFilename, getBackupKey(backupId))
+}
+
+func (s *SRepositoryBackupStorage) RemoveBackup(ctx context.Context, backupId string) error {
+	return s.removeFile(ctx, getBackupKey(backupId))
+}
+
+func (s *SRepositoryBackupStorage) IsBackupExists(backupId string) (bool, error) {
+	return s.isFileExists(getBackupKey(backupId))
+}
+
+func (s *SRepositoryBackupStorage) SaveBackupInstanceFrom(ctx context.Context, srcFilename string, backupInstanceId string) error {
+	return s.saveFile(ctx, srcFilename, getBackupPackKey(backupInstanceId))
+}
+
+func (s *SRepositoryBackupStorage) RestoreBackupInstanceTo(ctx context.Context, targetFilename string, backupInstanceId string) error {
+	return s.restoreFile(ctx, targetFilename, getBackupPackKey(backupInstanceId))
+}
+
+func (s *SRepositoryBackupStorage) RemoveBackupInstance(ctx context.Context, backupInstanceId string) error {
+	return s.removeFile(ctx, getBackupPackKey(backupInstanceId))
+}
+
+func (s *SRepositoryBackupStorage) IsBackupInstanceExists(backupInstanceId string) (bool, error) {
+	return s.isFileExists(getBackupPackKey(backupInstanceId))
+}
+
+func (s *SRepositoryBackupStorage) IsOnline() (bool, string, error) {
+	return s.store.IsOnline()
+}
+
+// listManifests returns the chunks referenced by each manifest
+func (s *SRepositoryBackupStorage) listManifests(ctx context.Context) (map[string][]string, error) {
+	manifests := map[string][]string{}
+	for _, prefix := range []string{backupPrefix, backupPackPrefix} {
+		blobs, err := s.store.ListBlobs(ctx, prefix)
+		if err != nil {
+			return nil, errors.Wrapf(err, "list %s", prefix)
+		}
+		for _, blob := range blobs {
+			manifest, err := s.getManifest(ctx, blob.Key)
+			if err != nil {
+				return nil, errors.Wrap(err, blob.Key)
+			}
+			ids := make([]string, len(manifest.Chunks))
+			for i := range manifest.Chunks {
+				ids[i] = manifest.Chunks[i].Id
+			}
+			manifests[path.Base(blob.Key)] = ids
+		}
+	}
+	return manifests, nil
+}
+
+// listChunks returns the chunks in the repository by id
+func (s *SRepositoryBackupStorage) listChunks(ctx context.Context) (map[string]backupstorage.SBlobInfo, error) {
+	blobs, err := s.store.ListBlobs(ctx, chunkPrefix)
+	if err != nil {
+		return nil, errors.Wrapf(err, "list %s", chunkPrefix)
+	}
+	chunks := make(map[string]backupstorage.SBlobInfo, len(blobs))
+	for _, blob := range blobs {
+		chunks[path.Base(blob.Key)] = blob
+	}
+	return chunks, nil
+}
+
+// Verify checks that every chunk referenced by the manifests exists, and that
+// its content matches its id if checkData
+func (s *SRepositoryBackupStorage) Verify(ctx context.Context, checkData bool) (*api.SBackupRepositoryVerifyResult, error) {
+	err := s.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.close()
+	lock, err := s.acquireLock(ctx, lockKindShared)
+	if err != nil {
+		return nil, err
+	}
+	defer s.releaseLock(ctx, lock)
+
+	manifests, err := s.listManifests(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := s.listChunks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := &api.SBackupRepositoryVerifyResult{
+		Manifests:     len(manifests),
+		Chunks:        len(chunks),
+		BrokenBackups: []string{},
+	}
+	bad := map[string]bool{}
+	checked := map[string]bool{}
+	for backupId, ids := range manifests {
+		broken := false
+		for _, id := range ids {
+			if isBad, ok := bad[id]; ok {
+				broken = broken || isBad
+				continue
+			}
+			if checked[id] {
+				continue
+			}
+			if _, ok := chunks[id]; !ok {
+				log.Errorf("chunk %s of backup %s is missing", id, backupId)
+				result.MissingChunks++
+				bad[id], broken = true, true
+				continue
+			}
+			if checkData {
+				_, err := s.getChunk(ctx, id)
+				if err != nil {
+					log.Errorf("chunk %s of backup %s is corrupt: %v", id, backupId, err)
+					result.CorruptChunks++
+					bad[id], broken = true, true
+					continue
+				}
+			}
+			checked[id] = true
+		}
+		if broken {
+			result.BrokenBackups = append(result.BrokenBackups, backupId)
+		}
+	}
+	return result, nil
+}
+
+// Gc removes the chunks not referenced by any manifest, the chunks uploaded by
+// a running save are protected by the exclusive lock
+func (s *SRepositoryBackupStorage) Gc(ctx context.Context, dryRun bool) (*api.SBackupRepositoryGcResult, error) {
+	err := s.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.close()
+	lock, err := s.acquireLock(ctx, lockKindExclusive)
+	if err != nil {
+		return nil, err
+	}
+	defer s.releaseLock(ctx, lock)
+
+	manifests, err := s.listManifests(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := s.listChunks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	referenced := map[string]bool{}
+	for _, ids := range manifests {
+		for _, id := range ids {
+			referenced[id] = true
+		}
+	}
+	result := &api.SBackupRepositoryGcResult{
+		Manifests: len(manifests),
+		Chunks:    len(chunks),
+	}
+	for id, blob := range chunks {
+		if referenced[id] {
+			continue
+		}
+		if !dryRun {
+			err := s.store.RemoveBlob(ctx, blob.Key)
+			if err != nil {
+				return result, errors.Wrapf(err, "remove chunk %s", id)
+			}
+		}
+		result.RemovedChunks++
+		result.RemovedBytes += blob.SizeBytes
+	}
+	return result, nil
+}
@@ -0,0 +1,251 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repository
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/hostman/storageman/backupstorage"
+)
+
+type sMemBlobStore struct {
+	lock  sync.Mutex
+	blobs map[string][]byte
+	mtime map[string]time.Time
+}
+
+func newMemBlobStore() *sMemBlobStore {
+	return &sMemBlobStore{
+		blobs: map[string][]byte{},
+		mtime: map[string]time.Time{},
+	}
+}
+
+func (m *sMemBlobStore) Open() error  { return nil }
+func (m *sMemBlobStore) Close() error { return nil }
+
+func (m *sMemBlobStore) PutBlob(ctx context.Context, key string, data []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.blobs[key] = append([]byte{}, data...)
+	m.mtime[key] = time.Now()
+	return nil
+}
+
+func (m *sMemBlobStore) GetBlob(ctx context.Context, key string) ([]byte, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	data, ok := m.blobs[key]
+	if !ok {
+		return nil, errors.ErrNotFound
+	}
+	return data, nil
+}
+
+func (m *sMemBlobStore) RemoveBlob(ctx context.Context, key string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.blobs, key)
+	delete(m.mtime, key)
+	return nil
+}
+
+func (m *sMemBlobStore) IsBlobExists(ctx context.Context, key string) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	_, ok := m.blobs[key]
+	return ok, nil
+}
+
+func (m *sMemBlobStore) ListBlobs(ctx context.Context, prefix string) ([]backupstorage.SBlobInfo, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	infos := []backupstorage.SBlobInfo{}
+	for key, data := range m.blobs {
+		if strings.HasPrefix(key, prefix) {
+			infos = append(infos, backupstorage.SBlobInfo{Key: key, SizeBytes: int64(len(data)), ModTime: m.mtime[key]})
+		}
+	}
+	return infos, nil
+}
+
+func (m *sMemBlobStore) IsOnline() (bool, string, error) { return true, "", nil }
+
+func (m *sMemBlobStore) count(prefix string) int {
+	infos, _ := m.ListBlobs(context.Background(), prefix)
+	return len(infos)
+}
+
+func writeTempFile(t *testing.T, dir, name string, data []byte) string {
+	filename := path.Join(dir, name)
+	err := ioutil.WriteFile(filename, data, 0600)
+	if err != nil {
+		t.Fatalf("write %s: %v", filename, err)
+	}
+	return filename
+}
+
+func TestRepositorySaveRestoreGc(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "repository")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := newMemBlobStore()
+	repo, err := newRepositoryBackupStorage("bs", store, "key")
+	if err != nil {
+		t.Fatalf("newRepositoryBackupStorage: %v", err)
+	}
+
+	base := randomData(3, 12*1024*1024)
+	changed := append(append([]byte{}, base...), randomData(4, 1024*1024)...)
+	err = repo.SaveBackupFrom(ctx, writeTempFile(t, dir, "base", base), "b1")
+	if err != nil {
+		t.Fatalf("save b1: %v", err)
+	}
+	b1Chunks := store.count(chunkPrefix)
+	err = repo.SaveBackupFrom(ctx, writeTempFile(t, dir, "changed", changed), "b2")
+	if err != nil {
+		t.Fatalf("save b2: %v", err)
+	}
+	if newChunks := store.count(chunkPrefix) - b1Chunks; newChunks > 2 {
+		t.Errorf("appending data should add few chunks, got %d", newChunks)
+	}
+	if store.count(lockPrefix) != 0 {
+		t.Errorf("lock is not released")
+	}
+
+	restored := path.Join(dir, "restored")
+	err = repo.RestoreBackupTo(ctx, restored, "b2")
+	if err != nil {
+		t.Fatalf("restore b2: %v", err)
+	}
+	data, _ := ioutil.ReadFile(restored)
+	if !bytes.Equal(data, changed) {
+		t.Errorf("restored data mismatch")
+	}
+
+	other, _ := newRepositoryBackupStorage("bs", store, "other key")
+	if err := other.RestoreBackupTo(ctx, restored, "b2"); err == nil {
+		t.Errorf("restore with another repository key should fail")
+	}
+
+	err = repo.RemoveBackup(ctx, "b2")
+	if err != nil {
+		t.Fatalf("remove b2: %v", err)
+	}
+	result, err := repo.Gc(ctx, true)
+	if err != nil {
+		t.Fatalf("dry run gc: %v", err)
+	}
+	if result.RemovedChunks == 0 || store.count(chunkPrefix) != b1Chunks+result.RemovedChunks {
+		t.Errorf("dry run gc should only count the unreferenced chunks, got %d", result.RemovedChunks)
+	}
+	_, err = repo.Gc(ctx, false)
+	if err != nil {
+		t.Fatalf("gc: %v", err)
+	}
+	if store.count(chunkPrefix) != b1Chunks {
+		t.Errorf("gc should keep the %d chunks of b1, got %d", b1Chunks, store.count(chunkPrefix))
+	}
+	verify, err := repo.Verify(ctx, true)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if len(verify.BrokenBackups) != 0 {
+		t.Errorf("broken backups after gc: %v", verify.BrokenBackups)
+	}
+	err = repo.RestoreBackupTo(ctx, restored, "b1")
+	if err != nil {
+		t.Fatalf("restore b1 after gc: %v", err)
+	}
+	data, _ = ioutil.ReadFile(restored)
+	if !bytes.Equal(data, base) {
+		t.Errorf("restored data of b1 mismatch after gc")
+	}
+}
+
+func TestRepositoryLock(t *testing.T) {
+	ctx := context.Background()
+	store := newMemBlobStore()
+	repo, _ := newRepositoryBackupStorage("bs", store, "key")
+
+	shared, err := repo.acquireLock(ctx, lockKindShared)
+	if err != nil {
+		t.Fatalf("acquire shared lock: %v", err)
+	}
+	shared2, err := repo.acquireLock(ctx, lockKindShared)
+	if err != nil {
+		t.Fatalf("shared locks should not conflict: %v", err)
+	}
+	repo.releaseLock(ctx, shared2)
+	_, err = repo.Gc(ctx, true)
+	if errors.Cause(err) != ErrorRepositoryBusy {
+		t.Errorf("gc should be blocked by save, got %v", err)
+	}
+	repo.releaseLock(ctx, shared)
+
+	// a lock not refreshed is left by a crashed holder
+	store.PutBlob(ctx, lockPrefix+lockKindShared+"-crashed", nil)
+	store.mtime[lockPrefix+lockKindShared+"-crashed"] = time.Now().Add(-lockStaleTimeout - time.Minute)
+	_, err = repo.Gc(ctx, true)
+	if err != nil {
+		t.Errorf("stale lock should be ignored, got %v", err)
+	}
+}
+
+func TestRepositoryLockRefresh(t *testing.T) {
+	ctx := context.Background()
+	store := newMemBlobStore()
+	repo, _ := newRepositoryBackupStorage("bs", store, "key")
+
+	interval := lockRefreshInterval
+	lockRefreshInterval = 10 * time.Millisecond
+	defer func() {
+		lockRefreshInterval = interval
+	}()
+
+	lock, err := repo.acquireLock(ctx, lockKindShared)
+	if err != nil {
+		t.Fatalf("acquire lock: %v", err)
+	}
+	store.lock.Lock()
+	store.mtime[lock.key] = time.Now().Add(-lockStaleTimeout - time.Minute)
+	store.lock.Unlock()
+	time.Sleep(50 * time.Millisecond)
+
+	store.lock.Lock()
+	mtime := store.mtime[lock.key]
+	store.lock.Unlock()
+	if time.Since(mtime) > lockStaleTimeout {
+		t.Errorf("lock of a running save is not refreshed")
+	}
+	repo.releaseLock(ctx, lock)
+	if store.count(lockPrefix) != 0 {
+		t.Errorf("lock is not removed after release")
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"os"
 
 	"yunion.io/x/cloudmux/pkg/cloudprovider"
 	"yunion.io/x/jsonutils"
@@ -303,6 +304,14 @@ func diskDelete(ctx context.Context, userCred mcclient.TokenCredential, storage
 	}
 	if disk != nil {
 		hostutils.DelayTask(ctx, disk.Delete, input)
+	} else if input.CleanSnapshots {
+		// the snapshot chain may exist without the disk file, e.g. fetched by
+		// a relocation aborted before the final sync
+		disk = storage.CreateDisk(diskId)
+		hostutils.DelayTask(ctx, func(ctx context.Context, params interface{}) (jsonutils.JSONObject, error) {
+			defer storage.RemoveDisk(disk)
+			return nil, disk.DeleteAllSnapshot(false)
+		}, nil)
 	} else {
 		hostutils.DelayTask(ctx, nil, nil)
 	}
@@ -362,6 +371,9 @@ func diskSrcMigratePrepare(ctx context.Context, userCred mcclient.TokenCredentia
 	if hasTemplate {
 		ret.Set("sys_disk_has_template", jsonutils.JSONTrue)
 	}
+	if fi, err := os.Stat(disk.GetPath()); err == nil {
+		ret.Set("disk_actual_size", jsonutils.NewInt(fi.Size()))
+	}
 	return ret, nil
 }
 
@@ -385,6 +397,10 @@ func diskMigrate(ctx context.Context, userCred mcclient.TokenCredential, storage
 
 	outChainSnaps, _ := body.GetArray("out_chain_snapshots")
 	diskSnapsChain, _ := body.GetArray("disk_snaps_chain")
+	fetchedSnaps := []string{}
+	if body.Contains("fetched_snapshots") {
+		body.Unmarshal(&fetchedSnaps, "fetched_snapshots")
+	}
 
 	params := storageman.SDiskMigrate{
 		DiskId:  diskId,
@@ -400,6 +416,8 @@ func diskMigrate(ctx context.Context, userCred mcclient.TokenCredential, storage
 
 		OutChainSnaps: outChainSnaps,
 		SnapsChain:    diskSnapsChain,
+		SnapshotsOnly: jsonutils.QueryBoolean(body, "snapshots_only", false),
+		FetchedSnaps:  fetchedSnaps,
 	}
 	hostutils.DelayTask(ctx, storage.DiskMigrate, &params)
 	return nil, nil
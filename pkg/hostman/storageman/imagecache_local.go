@@ -30,6 +30,7 @@ import (
 	"yunion.io/x/log"
 	"yunion.io/x/pkg/errors"
 	"yunion.io/x/pkg/util/httputils"
+	"yunion.io/x/pkg/util/qemuimgfmt"
 
 	"yunion.io/x/onecloud/pkg/apis"
 	api "yunion.io/x/onecloud/pkg/apis/compute"
@@ -62,6 +63,8 @@ type SLocalImageCache struct {
 
 	remoteFile    *remotefile.SRemoteFile
 	accessDirLock sync.Mutex
+
+	signature *sImageSignature
 }
 
 func NewLocalImageCache(imageId string, imagecacheManager IImageCacheManger) *SLocalImageCache {
@@ -202,6 +205,18 @@ func (l *SLocalImageCache) prepare(ctx context.Context, input api.CacheImageInpu
 		return false, errors.Wrapf(err, "GetServiceURL(%s)", apis.SERVICE_TYPE_IMAGE)
 	}
 	url += fmt.Sprintf("/images/%s", l.imageId)
+	l.signature, err = fetchImageSignature(ctx, l.imageId)
+	if err != nil {
+		return false, errors.Wrap(err, "fetchImageSignature")
+	}
+	if l.signature != nil {
+		// only the original file carries the signature, converted subformats
+		// do not, it is fetched and converted to the cached qcow2 locally
+		url += fmt.Sprintf("?format=%s&scope=system", l.signature.DiskFormat)
+		l.remoteFile = remotefile.NewRemoteFile(ctx, url,
+			l.getSignedPath(), false, "", -1, nil, l.getSignedPath(), "")
+		return false, nil
+	}
 	if len(input.Format) == 0 {
 		input.Format = "qcow2"
 	}
@@ -212,6 +227,93 @@ func (l *SLocalImageCache) prepare(ctx context.Context, input api.CacheImageInpu
 	return false, nil
 }
 
+func (l *SLocalImageCache) getSignedPath() string {
+	return l.GetTmpPath() + ".signed"
+}
+
+func removeImageCacheFile(filePath string) {
+	if fileutils2.Exists(filePath) {
+		if err := os.Remove(filePath); err != nil {
+			log.Errorf("remove %s: %v", filePath, err)
+		}
+	}
+}
+
+// fetchSigned fetches the original file of the signed image, verifies its
+// signature, then converts it to the cached file, or uses it directly if it
+// is already qcow2.  A cached file verified before is kept as long as its
+// checksum is not changed
+func (l *SLocalImageCache) fetchSigned(callback func(progress, progressMbps float64, totalSizeMb int64)) (*remotefile.SImageDesc, error) {
+	cachedPath := l.GetPath()
+	if fileutils2.Exists(cachedPath) && l.Desc != nil && l.Desc.SignatureVerified {
+		chksum, err := fileutils2.MD5(cachedPath)
+		if err == nil && chksum == l.Desc.Chksum {
+			desc := *l.Desc
+			return &desc, nil
+		}
+		log.Warningf("verified image %s changed locally, fetching it again", l.imageId)
+	}
+
+	signedPath := l.getSignedPath()
+	// a leftover is never trusted, the remote file skips downloading if exists
+	removeImageCacheFile(signedPath)
+	defer removeImageCacheFile(signedPath)
+	err := l.remoteFile.Fetch(callback)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetch signed original of image %s", l.imageId)
+	}
+	info, err := l.remoteFile.GetInfo()
+	if err != nil {
+		return nil, errors.Wrap(err, "remoteFile.GetInfo")
+	}
+	err = l.signature.Verify(signedPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "verify signature of image %s", l.imageId)
+	}
+	log.Infof("image %s signature verified", l.imageId)
+
+	img, err := qemuimg.NewQemuImage(signedPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "NewQemuImage(%s)", signedPath)
+	}
+	if !img.IsValid() {
+		return nil, fmt.Errorf("invalid signed image %s", img.String())
+	}
+	tmpPath := l.GetTmpPath()
+	removeImageCacheFile(tmpPath)
+	if img.Format == qemuimgfmt.QCOW2 {
+		err = os.Rename(signedPath, tmpPath)
+	} else {
+		err = img.Convert2Qcow2To(tmpPath, false, "", "", "")
+	}
+	if err != nil {
+		removeImageCacheFile(tmpPath)
+		return nil, errors.Wrapf(err, "convert %s image %s to qcow2", img.Format, l.imageId)
+	}
+	err = os.Rename(tmpPath, cachedPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "rename %s", tmpPath)
+	}
+
+	chksum, err := fileutils2.MD5(cachedPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fileutils2.MD5(%s)", cachedPath)
+	}
+	fi, err := os.Stat(cachedPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "os.Stat(%s)", cachedPath)
+	}
+	return &remotefile.SImageDesc{
+		Name:              info.Name,
+		Format:            string(qemuimgfmt.QCOW2),
+		Chksum:            chksum,
+		Path:              cachedPath,
+		SizeMb:            fi.Size() / 1024 / 1024,
+		AccessAt:          fi.ModTime(),
+		SignatureVerified: true,
+	}, nil
+}
+
 func (l *SLocalImageCache) fetch(ctx context.Context, input api.CacheImageInput, callback func(progress, progressMbps float64, totalSizeMb int64)) error {
 	// Whether successful or not, fetch should reset the condition variable and wakes up other waiters
 	defer func() {
@@ -220,7 +322,7 @@ func (l *SLocalImageCache) fetch(ctx context.Context, input api.CacheImageInput,
 		l.cond.Broadcast()
 		l.cond.L.Unlock()
 	}()
-	var _fetch = func() error {
+	var _fetch = func(getInfo func() (*remotefile.SImageDesc, error)) error {
 		if len(l.Manager.GetId()) > 0 {
 			_, err := hostutils.RemoteStoragecacheCacheImage(ctx,
 				l.Manager.GetId(), l.imageId, "active", l.GetPath())
@@ -232,7 +334,7 @@ func (l *SLocalImageCache) fetch(ctx context.Context, input api.CacheImageInput,
 		defer l.cond.L.Unlock()
 
 		var err error
-		l.Desc, err = l.remoteFile.GetInfo()
+		l.Desc, err = getInfo()
 		if err != nil {
 			return errors.Wrapf(err, "remoteFile.GetInfo")
 		}
@@ -255,15 +357,24 @@ func (l *SLocalImageCache) fetch(ctx context.Context, input api.CacheImageInput,
 		}
 		return nil
 	}
+	if l.signature != nil {
+		desc, err := l.fetchSigned(callback)
+		if err != nil {
+			return errors.Wrap(err, "fetchSigned")
+		}
+		return _fetch(func() (*remotefile.SImageDesc, error) {
+			return desc, nil
+		})
+	}
 	if fileutils2.Exists(l.GetPath()) {
 		if input.SkipChecksumIfExists {
 			if err := l.remoteFile.FillAttributes(callback); err != nil {
 				return errors.Wrap(err, "fetch remote attribute")
 			}
-			return _fetch()
+			return _fetch(l.remoteFile.GetInfo)
 		} else {
 			if err := l.remoteFile.VerifyIntegrity(callback); err == nil {
-				return _fetch()
+				return _fetch(l.remoteFile.GetInfo)
 			} else {
 				log.Warningf("Verify remotefile checksum error: %v, starting fetching it", err)
 			}
@@ -273,7 +384,7 @@ func (l *SLocalImageCache) fetch(ctx context.Context, input api.CacheImageInput,
 	if err != nil {
 		return errors.Wrapf(err, "remoteFile.Fetch")
 	}
-	return _fetch()
+	return _fetch(l.remoteFile.GetInfo)
 }
 
 func (l *SLocalImageCache) Remove(ctx context.Context) error {
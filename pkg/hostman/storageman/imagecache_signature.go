@@ -0,0 +1,86 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storageman
+
+import (
+	"context"
+
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/hostman/hostutils"
+	imagemodules "yunion.io/x/onecloud/pkg/mcclient/modules/image"
+	"yunion.io/x/onecloud/pkg/util/imagesign"
+)
+
+// sImageSignature is the detached signature of a glance image together
+// with the public key it was made with
+type sImageSignature struct {
+	Signature  string
+	DiskFormat string
+
+	key *imagesign.SPublicKey
+}
+
+// fetchImageSignature returns nil for unsigned images. The signing key is
+// checked the same way as the image service does: it must be enabled and
+// belong to the domain of the image.
+func fetchImageSignature(ctx context.Context, imageId string) (*sImageSignature, error) {
+	s := hostutils.GetImageSession(ctx)
+	img, err := imagemodules.Images.GetById(s, imageId, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Images.GetById %s", imageId)
+	}
+	signature, _ := img.GetString("signature")
+	if len(signature) == 0 {
+		return nil, nil
+	}
+	ret := &sImageSignature{Signature: signature}
+	ret.DiskFormat, _ = img.GetString("disk_format")
+	keyId, _ := img.GetString("signing_key_id")
+	keyObj, err := imagemodules.ImageSigningKeys.GetById(s, keyId, nil)
+	if err != nil {
+		return nil, errors.Wrapf(imagesign.ErrUntrustedKey, "fetch signing key %s: %v", keyId, err)
+	}
+	key := struct {
+		Name      string
+		Enabled   bool
+		DomainId  string
+		Algorithm string
+		PublicKey string
+	}{}
+	err = keyObj.Unmarshal(&key)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unmarshal signing key")
+	}
+	if !key.Enabled {
+		return nil, errors.Wrapf(imagesign.ErrUntrustedKey, "signing key %s disabled", key.Name)
+	}
+	if domainId, _ := img.GetString("domain_id"); domainId != key.DomainId {
+		return nil, errors.Wrapf(imagesign.ErrUntrustedKey, "signing key %s not in domain of image", key.Name)
+	}
+	ret.key, err = imagesign.ParsePublicKey(key.Algorithm, key.PublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "ParsePublicKey")
+	}
+	return ret, nil
+}
+
+func (sig *sImageSignature) Verify(path string) error {
+	err := imagesign.VerifyFile(path, sig.key, sig.Signature)
+	if err != nil {
+		return errors.Wrapf(err, "verify with key %s", sig.key.Fingerprint)
+	}
+	return nil
+}
@@ -45,6 +45,10 @@ type SImageDesc struct {
 	SizeMb int64  `json:"size"`
 
 	AccessAt time.Time `json:"access_at"`
+
+	// SignatureVerified is set for the cached file converted from a signed
+	// original whose signature is verified
+	SignatureVerified bool `json:"signature_verified,omitempty"`
 }
 
 type SRemoteFile struct {
@@ -30,6 +30,7 @@ import (
 	"yunion.io/x/pkg/errors"
 	"yunion.io/x/pkg/util/qemuimgfmt"
 	"yunion.io/x/pkg/util/timeutils"
+	"yunion.io/x/pkg/utils"
 
 	"yunion.io/x/onecloud/pkg/apis"
 	api "yunion.io/x/onecloud/pkg/apis/compute"
@@ -882,23 +883,45 @@ func (s *SLocalStorage) DiskMigrate(ctx context.Context, params interface{}) (js
 	snapshots := input.SnapsChain
 	diskOutChainSnaps := input.OutChainSnaps
 	// prepare disk snapshot dir
-	if len(snapshots) > 0 && !fileutils2.Exists(disk.GetSnapshotDir()) {
+	if (len(snapshots) > 0 || len(diskOutChainSnaps) > 0) && !fileutils2.Exists(disk.GetSnapshotDir()) {
 		output, err := procutils.NewCommand("mkdir", "-p", disk.GetSnapshotDir()).Output()
 		if err != nil {
 			return nil, errors.Wrapf(err, "mkdir %s failed: %s", disk.GetSnapshotDir(), output)
 		}
 	}
 
+	var fetchedBytes int64
+	fetched := []string{}
+	fetchSnapshot := func(snapId, snapshotPath string) (bool, error) {
+		fetched = append(fetched, snapId)
+		if utils.IsInStringArray(snapId, input.FetchedSnaps) && fileutils2.Exists(snapshotPath) {
+			return false, nil
+		}
+		snapshotUrl := fmt.Sprintf("%s/%s/%s/%s",
+			input.SnapshotsUri, input.SrcStorageId, input.DiskId, snapId)
+		log.Infof("Disk %s snapshot %s url: %s", input.DiskId, snapId, snapshotUrl)
+		if err := s.CreateSnapshotFormUrl(ctx, snapshotUrl, input.DiskId, snapshotPath); err != nil {
+			return false, errors.Wrap(err, "create from snapshot url failed")
+		}
+		if fi, err := os.Stat(snapshotPath); err == nil {
+			fetchedBytes += fi.Size()
+		}
+		return true, nil
+	}
+
 	baseImagePath := ""
 	templateId := input.TemplateId
 	for i, snapshotId := range snapshots {
 		snapId, _ := snapshotId.GetString()
-		snapshotUrl := fmt.Sprintf("%s/%s/%s/%s",
-			input.SnapshotsUri, input.SrcStorageId, input.DiskId, snapId)
 		snapshotPath := path.Join(disk.GetSnapshotDir(), snapId)
-		log.Infof("Disk %s snapshot %s url: %s", input.DiskId, snapId, snapshotUrl)
-		if err := s.CreateSnapshotFormUrl(ctx, snapshotUrl, input.DiskId, snapshotPath); err != nil {
-			return nil, errors.Wrap(err, "create from snapshot url failed")
+		isNew, err := fetchSnapshot(snapId, snapshotPath)
+		if err != nil {
+			return nil, err
+		}
+		// snapshots fetched earlier are already rebased
+		if !isNew {
+			baseImagePath = snapshotPath
+			continue
 		}
 		if i == 0 && len(templateId) > 0 && input.SysDiskHasTemplate {
 			templatePath := path.Join(storageManager.LocalStorageImagecacheManager.GetPath(), templateId)
@@ -915,15 +938,19 @@ func (s *SLocalStorage) DiskMigrate(ctx context.Context, params interface{}) (js
 
 	for _, snapshotId := range diskOutChainSnaps {
 		snapId, _ := snapshotId.GetString()
-		snapshotUrl := fmt.Sprintf("%s/%s/%s/%s",
-			input.SnapshotsUri, input.SrcStorageId, input.DiskId, snapId)
 		snapshotPath := path.Join(disk.GetSnapshotDir(), snapId)
-		log.Infof("Disk %s snapshot %s url: %s", input.DiskId, snapId, snapshotUrl)
-		if err := s.CreateSnapshotFormUrl(ctx, snapshotUrl, input.DiskId, snapshotPath); err != nil {
-			return nil, errors.Wrap(err, "create from snapshot url failed")
+		if _, err := fetchSnapshot(snapId, snapshotPath); err != nil {
+			return nil, err
 		}
 	}
 
+	res := jsonutils.NewDict()
+	res.Set("fetched_snapshots", jsonutils.NewStringArray(fetched))
+	if input.SnapshotsOnly {
+		res.Set("fetched_bytes", jsonutils.NewInt(fetchedBytes))
+		return res, nil
+	}
+
 	// download disk form remote url
 	diskUrl := fmt.Sprintf("%s/%s/%s", input.DiskUri, input.SrcStorageId, input.DiskId)
 	err := disk.CreateFromUrl(ctx, diskUrl, 0, func(progress, progressMbps float64, totalSizeMb int64) {
@@ -943,10 +970,13 @@ func (s *SLocalStorage) DiskMigrate(ctx context.Context, params interface{}) (js
 			return nil, err
 		}
 	}
+	if fi, err := os.Stat(disk.GetPath()); err == nil {
+		fetchedBytes += fi.Size()
+	}
 
-	res := jsonutils.NewDict()
+	res.Set("fetched_bytes", jsonutils.NewInt(fetchedBytes))
 	res.Set("disk_path", jsonutils.NewString(disk.GetPath()))
-	return nil, nil
+	return res, nil
 }
 
 func (s *SLocalStorage) CreateDiskFromSnapshot(ctx context.Context, disk IDisk, input *SDiskCreateByDiskinfo) (jsonutils.JSONObject, error) {
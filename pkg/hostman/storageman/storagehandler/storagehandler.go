@@ -71,6 +71,15 @@ func AddStorageHandler(prefix string, app *appsrv.Application) {
 		app.AddHandler("POST",
 			fmt.Sprintf("%s/%s/delete-backup", prefix, keyWords),
 			auth.Authenticate(storageDeleteBackup))
+		app.AddHandler("POST",
+			fmt.Sprintf("%s/%s/consolidate-backup", prefix, keyWords),
+			auth.Authenticate(storageConsolidateBackup))
+		app.AddHandler("POST",
+			fmt.Sprintf("%s/%s/verify-backup-storage", prefix, keyWords),
+			auth.Authenticate(storageVerifyBackupStorage))
+		app.AddHandler("POST",
+			fmt.Sprintf("%s/%s/gc-backup-storage", prefix, keyWords),
+			auth.Authenticate(storageGcBackupStorage))
 		app.AddHandler("POST",
 			fmt.Sprintf("%s/%s/sync-backup", prefix, keyWords),
 			auth.Authenticate(storageSyncBackup))
@@ -413,6 +422,80 @@ func storageDeleteBackup(ctx context.Context, w http.ResponseWriter, r *http.Req
 	hostutils.ResponseOk(ctx, w)
 }
 
+func storageConsolidateBackup(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	_, _, body := appsrv.FetchEnv(ctx, w, r)
+	if !checkOptions(ctx, w, body, "backup_id", "backup_chain", "backup_storage_id", "backup_storage_access_info") {
+		return
+	}
+	cb := storageman.SStorageConsolidateBackup{}
+	err := body.Unmarshal(&cb)
+	if err != nil {
+		hostutils.Response(ctx, w, httperrors.NewInputParameterError(err.Error()))
+		return
+	}
+	hostutils.DelayTask(ctx, consolidateBackup, &cb)
+	hostutils.ResponseOk(ctx, w)
+}
+
+func consolidateBackup(ctx context.Context, params interface{}) (jsonutils.JSONObject, error) {
+	cbParams := params.(*storageman.SStorageConsolidateBackup)
+	sizeMb, err := storageman.DoConsolidateBackup(ctx, cbParams)
+	if err != nil {
+		return nil, errors.Wrap(err, "DoConsolidateBackup")
+	}
+	ret := jsonutils.NewDict()
+	ret.Set("size_mb", jsonutils.NewInt(int64(sizeMb)))
+	return ret, nil
+}
+
+func fetchBackupRepositoryParams(ctx context.Context, w http.ResponseWriter, r *http.Request) *storageman.SStorageBackupRepository {
+	_, _, body := appsrv.FetchEnv(ctx, w, r)
+	if !checkOptions(ctx, w, body, "backup_storage_id", "backup_storage_access_info") {
+		return nil
+	}
+	br := storageman.SStorageBackupRepository{}
+	err := body.Unmarshal(&br)
+	if err != nil {
+		hostutils.Response(ctx, w, httperrors.NewInputParameterError(err.Error()))
+		return nil
+	}
+	return &br
+}
+
+func storageVerifyBackupStorage(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	br := fetchBackupRepositoryParams(ctx, w, r)
+	if br == nil {
+		return
+	}
+	hostutils.DelayTask(ctx, verifyBackupStorage, br)
+	hostutils.ResponseOk(ctx, w)
+}
+
+func verifyBackupStorage(ctx context.Context, params interface{}) (jsonutils.JSONObject, error) {
+	result, err := storageman.DoVerifyBackupRepository(ctx, params.(*storageman.SStorageBackupRepository))
+	if err != nil {
+		return nil, errors.Wrap(err, "DoVerifyBackupRepository")
+	}
+	return jsonutils.Marshal(result), nil
+}
+
+func storageGcBackupStorage(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	br := fetchBackupRepositoryParams(ctx, w, r)
+	if br == nil {
+		return
+	}
+	hostutils.DelayTask(ctx, gcBackupStorage, br)
+	hostutils.ResponseOk(ctx, w)
+}
+
+func gcBackupStorage(ctx context.Context, params interface{}) (jsonutils.JSONObject, error) {
+	result, err := storageman.DoGcBackupRepository(ctx, params.(*storageman.SStorageBackupRepository))
+	if err != nil {
+		return nil, errors.Wrap(err, "DoGcBackupRepository")
+	}
+	return jsonutils.Marshal(result), nil
+}
+
 func checkOptions(ctx context.Context, w http.ResponseWriter, body jsonutils.JSONObject, options ...string) bool {
 	for _, option := range options {
 		if body.Contains(option) {
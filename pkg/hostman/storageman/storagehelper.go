@@ -47,6 +47,12 @@ type SDiskMigrate struct {
 	DiskUri            string
 	SysDiskHasTemplate bool
 
+	// SnapshotsOnly only fetches the snapshot chain, the top disk is left for a
+	// later call once the guest is stopped
+	SnapshotsOnly bool
+	// FetchedSnaps are snapshots already fetched by an earlier call
+	FetchedSnaps []string
+
 	Storage IStorage
 }
 
@@ -85,6 +91,38 @@ type SDiskBackup struct {
 	UserCred mcclient.TokenCredential
 }
 
+type SDiskBitmapBackup struct {
+	BackupId                string              `json:"backup_id"`
+	BackupStorageId         string              `json:"backup_storage_id"`
+	BackupStorageAccessInfo *jsonutils.JSONDict `json:"backup_storage_access_info"`
+
+	// full, incremental or differential
+	BackupMode string `json:"backup_mode"`
+	// dirty bitmap of the parent backup, read by incremental and differential backups
+	DirtyBitmap string `json:"dirty_bitmap"`
+	// dirty bitmap of this backup, added by full and incremental backups
+	NewDirtyBitmap string `json:"new_dirty_bitmap"`
+	// dirty bitmap of the chain tip recorded by region, kept until a newer tip is recorded
+	KeepDirtyBitmap string `json:"keep_dirty_bitmap"`
+
+	UserCred mcclient.TokenCredential
+}
+
+type SStorageConsolidateBackup struct {
+	BackupId string `json:"backup_id"`
+	// ancestors of the backup from the full backup down to the parent
+	BackupChain             []string            `json:"backup_chain"`
+	BackupStorageId         string              `json:"backup_storage_id"`
+	BackupStorageAccessInfo *jsonutils.JSONDict `json:"backup_storage_access_info"`
+}
+
+type SStorageBackupRepository struct {
+	BackupStorageId         string              `json:"backup_storage_id"`
+	BackupStorageAccessInfo *jsonutils.JSONDict `json:"backup_storage_access_info"`
+	CheckData               bool                `json:"check_data"`
+	DryRun                  bool                `json:"dry_run"`
+}
+
 type SStorageBackup struct {
 	BackupId                string
 	BackupLocalPath         string
@@ -105,6 +143,7 @@ type SStoragePackInstanceBackup struct {
 	BackupStorageId         string
 	BackupStorageAccessInfo *jsonutils.JSONDict
 	BackupIds               []string
+	VtpmBackupId            string
 	Metadata                api.InstanceBackupPackMetadata
 }
 
@@ -0,0 +1,264 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/qemuimgfmt"
+	"yunion.io/x/pkg/util/streamutils"
+	"yunion.io/x/pkg/utils"
+
+	api "yunion.io/x/onecloud/pkg/apis/image"
+	"yunion.io/x/onecloud/pkg/appsrv"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/lockman"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/ovfutils"
+	"yunion.io/x/onecloud/pkg/util/qemuimg"
+)
+
+// GetDetailsDownload streams the image in the requested export format. A
+// format that is not cached yet is converted by ImageExportTask and kept as a
+// subformat, until then the request is answered with 202 and the conversion
+// status, so the client polls instead of holding the connection.
+func (self *SImage) GetDetailsDownload(ctx context.Context, userCred mcclient.TokenCredential, query api.ImageDownloadInput) (jsonutils.JSONObject, error) {
+	if self.IsGuestImage.IsTrue() {
+		return nil, httperrors.NewUnsupportOperationError("image %s is part of a guest image, download it separately", self.Name)
+	}
+	if self.Status != api.IMAGE_STATUS_ACTIVE {
+		return nil, httperrors.NewInvalidStatusError("cannot download in status %s", self.Status)
+	}
+	filePath, format := self.Location, self.DiskFormat
+	if len(query.Format) > 0 && query.Format != self.DiskFormat {
+		subimg, err := self.prepareExport(ctx, userCred, query.Format)
+		if err != nil {
+			return nil, err
+		}
+		if subimg.Status != api.IMAGE_STATUS_ACTIVE {
+			return nil, sendExportStatus(ctx, subimg)
+		}
+		filePath, format = subimg.Location, subimg.Format
+	}
+	if len(filePath) == 0 {
+		return nil, httperrors.NewInvalidStatusError("empty file path")
+	}
+
+	appParams := appsrv.AppContextGetParams(ctx)
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": fmt.Sprintf("%s.%s", self.Name, format)})
+	appParams.Response.Header().Set("Content-Disposition", disposition)
+	return nil, sendImageFile(ctx, filePath)
+}
+
+// prepareExport returns the subformat of the export format, starting its
+// conversion unless it is active or being converted
+func (self *SImage) prepareExport(ctx context.Context, userCred mcclient.TokenCredential, format string) (*SImageSubformat, error) {
+	if !utils.IsInStringArray(format, api.ImageExportFormats) {
+		return nil, httperrors.NewInputParameterError("unsupported export format %s, choose from %s", format, api.ImageExportFormats)
+	}
+	if self.GetImageType() != api.ImageTypeTemplate {
+		return nil, httperrors.NewUnsupportOperationError("%s image can not be exported as %s", self.DiskFormat, format)
+	}
+	if self.isEncrypted() {
+		return nil, httperrors.NewUnsupportOperationError("encrypted image can not be exported as %s", format)
+	}
+
+	lockman.LockRawObject(ctx, ImageSubformatManager.Keyword(), self.Id+format)
+	defer lockman.ReleaseRawObject(ctx, ImageSubformatManager.Keyword(), self.Id+format)
+
+	subimg := ImageSubformatManager.FetchSubImage(self.Id, format)
+	if subimg == nil {
+		err := self.newSubformat(ctx, qemuimgfmt.String2ImageFormat(format), false)
+		if err != nil {
+			return nil, errors.Wrapf(err, "newSubformat %s", format)
+		}
+		subimg = ImageSubformatManager.FetchSubImage(self.Id, format)
+		if subimg == nil {
+			return nil, errors.Wrapf(errors.ErrNotFound, "subformat %s", format)
+		}
+	}
+	if subimg.Status == api.IMAGE_STATUS_ACTIVE {
+		return subimg, nil
+	}
+	running, err := self.isExportRunning(format)
+	if err != nil {
+		return nil, errors.Wrap(err, "isExportRunning")
+	}
+	if !running {
+		_, err := db.Update(subimg, func() error {
+			subimg.Status = api.IMAGE_STATUS_SAVING
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "update subformat status")
+		}
+		err = self.StartExportTask(ctx, userCred, format)
+		if err != nil {
+			return nil, errors.Wrap(err, "StartExportTask")
+		}
+	}
+	return subimg, nil
+}
+
+func (self *SImage) isExportRunning(format string) (bool, error) {
+	isOpen := true
+	q := taskman.TaskManager.QueryTasksOfObject(self, time.Time{}, &isOpen).Equals("task_name", "ImageExportTask")
+	tasks := make([]taskman.STask, 0)
+	err := db.FetchModelObjects(taskman.TaskManager, q, &tasks)
+	if err != nil {
+		return false, errors.Wrap(err, "FetchModelObjects")
+	}
+	for i := range tasks {
+		if f, _ := tasks[i].Params.GetString("format"); f == format {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (self *SImage) StartExportTask(ctx context.Context, userCred mcclient.TokenCredential, format string) error {
+	params := jsonutils.NewDict()
+	params.Set("format", jsonutils.NewString(format))
+	task, err := taskman.TaskManager.NewTask(ctx, "ImageExportTask", self, userCred, params, "", "", nil)
+	if err != nil {
+		return errors.Wrap(err, "NewTask")
+	}
+	task.ScheduleRun(nil)
+	return nil
+}
+
+// DoExport converts the image to the export format for ImageExportTask
+func (self *SImage) DoExport(format string) error {
+	subimg := ImageSubformatManager.FetchSubImage(self.Id, format)
+	if subimg == nil {
+		return errors.Wrapf(errors.ErrNotFound, "subformat %s", format)
+	}
+	return subimg.Save(self)
+}
+
+func sendExportStatus(ctx context.Context, subimg *SImageSubformat) error {
+	ret := jsonutils.NewDict()
+	ret.Set("format", jsonutils.NewString(subimg.Format))
+	ret.Set("status", jsonutils.NewString(subimg.Status))
+	appParams := appsrv.AppContextGetParams(ctx)
+	appParams.Response.Header().Set("Content-Type", "application/json")
+	appParams.Response.WriteHeader(http.StatusAccepted)
+	_, err := appParams.Response.Write([]byte(ret.String()))
+	return err
+}
+
+func sendImageFile(ctx context.Context, filePath string) error {
+	size, rc, err := GetImage(ctx, filePath)
+	if err != nil {
+		return errors.Wrap(err, "get image")
+	}
+	defer rc.Close()
+
+	appParams := appsrv.AppContextGetParams(ctx)
+	appParams.Response.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+
+	_, err = streamutils.StreamPipe(rc, appParams.Response, false, nil)
+	if err != nil {
+		return httperrors.NewGeneralError(err)
+	}
+	return nil
+}
+
+// exportTo writes the image as targetFormat to location for the storage
+// drivers. An ova packs a streamOptimized vmdk with a generated ovf descriptor.
+func (self *SImage) exportTo(location string, targetFormat string) (int64, error) {
+	img, err := self.getQemuImage()
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to image.getQemuImage")
+	}
+	if targetFormat == api.IMAGE_DISK_FORMAT_OVA {
+		return self.exportOva(img, location)
+	}
+	nimg, err := img.Clone(location, qemuimgfmt.String2ImageFormat(targetFormat), true)
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to img.Clone")
+	}
+	return nimg.ActualSizeBytes, nil
+}
+
+func (self *SImage) exportOva(img *qemuimg.SQemuImage, location string) (int64, error) {
+	dir := location + ".d"
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return 0, errors.Wrapf(err, "MkdirAll %s", dir)
+	}
+	defer os.RemoveAll(dir)
+
+	diskName := fmt.Sprintf("%s-disk1.vmdk", self.Id)
+	disk, err := img.Clone(filepath.Join(dir, diskName), qemuimgfmt.VMDK, true)
+	if err != nil {
+		return 0, errors.Wrap(err, "clone streamOptimized vmdk")
+	}
+	desc := &ovfutils.SOvfDescriptor{
+		Name:     self.Name,
+		MemoryMB: int64(self.MinRamMB),
+		Firmware: ovfutils.FIRMWARE_BIOS,
+		Disks: []ovfutils.SOvfDisk{
+			{
+				DiskId:        "vmdisk1",
+				FileHref:      diskName,
+				CapacityBytes: disk.SizeBytes,
+				Format:        api.IMAGE_DISK_FORMAT_VMDK,
+			},
+		},
+	}
+	properties, err := ImagePropertyManager.GetProperties(self.Id)
+	if err != nil {
+		return 0, errors.Wrap(err, "GetProperties")
+	}
+	desc.OsType = properties[api.IMAGE_OS_TYPE]
+	desc.OsArch = properties[api.IMAGE_OS_ARCH]
+	if properties[api.IMAGE_UEFI_SUPPORT] == "true" {
+		desc.Firmware = ovfutils.FIRMWARE_UEFI
+	}
+
+	ovfPath, err := ovfutils.WriteOvfPackage(dir, self.Id, desc)
+	if err != nil {
+		return 0, errors.Wrap(err, "WriteOvfPackage")
+	}
+	reader, _, err := ovfutils.NewOvaReader(ovfPath)
+	if err != nil {
+		return 0, errors.Wrap(err, "NewOvaReader")
+	}
+	defer reader.Close()
+	fp, err := os.Create(location)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Create %s", location)
+	}
+	defer fp.Close()
+	size, err := io.Copy(fp, reader)
+	if err != nil {
+		os.Remove(location)
+		return 0, errors.Wrapf(err, "write %s", location)
+	}
+	return size, nil
+}
@@ -18,6 +18,8 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"time"
@@ -34,6 +36,7 @@ import (
 	"yunion.io/x/sqlchemy"
 
 	"yunion.io/x/onecloud/pkg/apis"
+	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
 	api "yunion.io/x/onecloud/pkg/apis/image"
 	"yunion.io/x/onecloud/pkg/appsrv"
 	"yunion.io/x/onecloud/pkg/cloudcommon/db"
@@ -43,7 +46,10 @@ import (
 	"yunion.io/x/onecloud/pkg/httperrors"
 	"yunion.io/x/onecloud/pkg/image/options"
 	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/mcclient/auth"
+	"yunion.io/x/onecloud/pkg/mcclient/modules/compute"
 	"yunion.io/x/onecloud/pkg/util/logclient"
+	"yunion.io/x/onecloud/pkg/util/ovfutils"
 	"yunion.io/x/onecloud/pkg/util/rbacutils"
 	"yunion.io/x/onecloud/pkg/util/stringutils2"
 )
@@ -769,3 +775,229 @@ func (img *SGuestImage) PerformSetClassMetadata(ctx context.Context, userCred mc
 	}
 	return nil, nil
 }
+
+// createFromOvf registers the disks of an ova/ovf package as a guest image,
+// the first disk becomes the root image and the rest data images. Everything
+// goes through the normal create path of the user, a partly imported guest
+// image is purged on failure.
+func (manager *SGuestImageManager) createFromOvf(ctx context.Context, userCred mcclient.TokenCredential,
+	pkg *SImage, desc *ovfutils.SOvfDescriptor, dir string) (*SGuestImage, error) {
+
+	ownerId := pkg.GetOwnerId()
+	input := api.GuestImageCreateInput{}
+	input.GenerateName = pkg.Name
+	input.Description = pkg.Description
+	input.OsArch = desc.OsArch
+	for i := range desc.Disks {
+		input.Images = append(input.Images, api.GuestImageCreateInputSubimage{DiskFormat: desc.Disks[i].Format})
+	}
+	params := jsonutils.Marshal(input).(*jsonutils.JSONDict)
+	model, err := db.DoCreate(manager, ctx, userCred, nil, params, ownerId)
+	if err != nil {
+		return nil, errors.Wrap(err, "create guest image")
+	}
+	gi := model.(*SGuestImage)
+	func() {
+		lockman.LockObject(ctx, gi)
+		defer lockman.ReleaseObject(ctx, gi)
+
+		gi.SSharableVirtualResourceBase.PostCreate(ctx, userCred, ownerId, nil, params)
+	}()
+	db.OpsLog.LogEvent(gi, db.ACT_CREATE, gi.GetShortDesc(ctx), userCred)
+
+	pendingUsage := SQuota{Image: len(desc.Disks)}
+	pendingUsage.SetKeys(imageCreateInput2QuotaKeys("qcow2", ownerId))
+	defer quotas.CancelPendingUsage(ctx, userCred, &pendingUsage, &pendingUsage, true)
+
+	meta := map[string]interface{}{
+		api.GUEST_IMAGE_OVF_PRODUCT:     desc.Product.Product,
+		api.GUEST_IMAGE_OVF_VENDOR:      desc.Product.Vendor,
+		api.GUEST_IMAGE_OVF_VERSION:     desc.Product.FullVersion,
+		api.GUEST_IMAGE_OVF_PRODUCT_URL: desc.Product.ProductUrl,
+		api.GUEST_IMAGE_OVF_VENDOR_URL:  desc.Product.VendorUrl,
+		api.GUEST_IMAGE_OVF_SOURCE:      pkg.Name,
+	}
+	if len(desc.Product.FullVersion) == 0 {
+		meta[api.GUEST_IMAGE_OVF_VERSION] = desc.Product.Version
+	}
+	err = gi.SetAllMetadata(ctx, meta, userCred)
+	if err != nil {
+		log.Errorf("set ovf metadata of guest image %s: %s", gi.Name, err)
+	}
+
+	gi.SetStatus(ctx, userCred, api.IMAGE_STATUS_SAVING, "import ovf")
+	for i := range desc.Disks {
+		err := gi.importOvfDisk(ctx, userCred, i, desc, dir)
+		if err != nil {
+			gi.CleanupOvfImport(ctx, userCred)
+			return nil, errors.Wrapf(err, "import disk %s", desc.Disks[i].FileHref)
+		}
+	}
+	return gi, nil
+}
+
+func (gi *SGuestImage) importOvfDisk(ctx context.Context, userCred mcclient.TokenCredential,
+	index int, desc *ovfutils.SOvfDescriptor, dir string) error {
+
+	disk := desc.Disks[index]
+	ownerId := gi.GetOwnerId()
+	input := api.ImageCreateInput{}
+	input.GenerateName = fmt.Sprintf("%s-%s", gi.Name, "root")
+	if index > 0 {
+		input.GenerateName = fmt.Sprintf("%s-%s-%d", gi.Name, "data", index)
+	}
+	input.DiskFormat = disk.Format
+	input.IsGuestImage = &[]bool{true}[0]
+	input.IsData = &[]bool{index > 0}[0]
+	input.Protected = &[]bool{true}[0]
+	if index == 0 {
+		input.MinRamMB = &[]int32{int32(desc.MemoryMB)}[0]
+		input.Properties = map[string]string{
+			api.IMAGE_OS_TYPE: desc.OsType,
+			api.IMAGE_OS_ARCH: desc.OsArch,
+		}
+		if desc.Firmware == ovfutils.FIRMWARE_UEFI {
+			input.Properties[api.IMAGE_UEFI_SUPPORT] = "true"
+		}
+		if len(disk.Driver) > 0 {
+			input.Properties["disk_driver"] = disk.Driver
+		}
+		if len(desc.Nics) > 0 {
+			input.Properties["net_driver"] = desc.Nics[0].Model
+		}
+	}
+	params := jsonutils.Marshal(input).(*jsonutils.JSONDict)
+	params.Set("os_arch", jsonutils.NewString(desc.OsArch))
+	model, err := db.DoCreate(ImageManager, ctx, userCred, nil, params, ownerId)
+	if err != nil {
+		return errors.Wrap(err, "create image")
+	}
+	image := model.(*SImage)
+	func() {
+		lockman.LockObject(ctx, image)
+		defer lockman.ReleaseObject(ctx, image)
+
+		image.SSharableVirtualResourceBase.PostCreate(ctx, userCred, ownerId, nil, params)
+	}()
+	_, err = GuestImageJointManager.CreateGuestImageJoint(ctx, gi.Id, image.Id)
+	if err != nil {
+		image.OnJointFailed(ctx, userCred)
+		image.startDeleteImageTask(ctx, userCred, "", false, true)
+		return errors.Wrap(err, "CreateGuestImageJoint")
+	}
+	if len(input.Properties) > 0 {
+		err = ImagePropertyManager.SaveProperties(ctx, userCred, image.Id, jsonutils.Marshal(input.Properties))
+		if err != nil {
+			log.Errorf("save ovf properties of image %s: %s", image.Name, err)
+		}
+	}
+
+	image.SetStatus(ctx, userCred, api.IMAGE_STATUS_SAVING, "import ovf")
+	path := filepath.Join(dir, filepath.Base(disk.FileHref))
+	err = func() error {
+		fp, err := os.Open(path)
+		if err != nil {
+			return errors.Wrapf(err, "Open %s", path)
+		}
+		defer fp.Close()
+		stat, err := fp.Stat()
+		if err != nil {
+			return errors.Wrap(err, "Stat")
+		}
+		return image.SaveImageFromStream(fp, stat.Size(), true)
+	}()
+	if err != nil {
+		image.OnSaveFailed(ctx, userCred, jsonutils.NewString(err.Error()))
+		return err
+	}
+	os.Remove(path)
+	image.OnSaveSuccess(ctx, userCred, "import ovf success")
+	return nil
+}
+
+// StartOvfPipelines runs the pipeline of every sub image as a subtask of the
+// ovf import task, which resumes once all of them finished
+func (gi *SGuestImage) StartOvfPipelines(ctx context.Context, userCred mcclient.TokenCredential, parentTaskId string) error {
+	images, err := GuestImageJointManager.GetImagesByGuestImageId(gi.Id)
+	if err != nil {
+		return errors.Wrap(err, "GetImagesByGuestImageId")
+	}
+	for i := range images {
+		err := images[i].startImagePipelineTask(ctx, userCred, false, parentTaskId)
+		if err != nil {
+			return errors.Wrapf(err, "start pipeline of image %s", images[i].Name)
+		}
+	}
+	return nil
+}
+
+// OnOvfPipelinesComplete checks that every sub image became active, otherwise
+// the guest image is purged
+func (gi *SGuestImage) OnOvfPipelinesComplete(ctx context.Context, userCred mcclient.TokenCredential) error {
+	err := gi.checkStatus(ctx, userCred)
+	if err != nil {
+		return errors.Wrap(err, "checkStatus")
+	}
+	if gi.Status != api.IMAGE_STATUS_ACTIVE {
+		gi.CleanupOvfImport(ctx, userCred)
+		return errors.Wrapf(httperrors.ErrInvalidStatus, "guest image %s status %s", gi.Name, gi.Status)
+	}
+	return nil
+}
+
+// CleanupOvfImport purges a guest image whose import didn't complete
+func (gi *SGuestImage) CleanupOvfImport(ctx context.Context, userCred mcclient.TokenCredential) {
+	gi.SetStatus(ctx, userCred, api.IMAGE_STATUS_KILLED, "import ovf failed")
+	err := gi.startDeleteTask(ctx, userCred, "", true, true)
+	if err != nil {
+		log.Errorf("purge guest image %s: %s", gi.Name, err)
+	}
+}
+
+// CreateOvfGuestTemplate creates a server template from the virtual hardware
+// of an ovf descriptor so that the appliance can be launched in one step
+func (gi *SGuestImage) CreateOvfGuestTemplate(ctx context.Context, userCred mcclient.TokenCredential, desc *ovfutils.SOvfDescriptor) (string, error) {
+	content := computeapi.ServerCreateInput{
+		ServerConfigs: &computeapi.ServerConfigs{
+			Hypervisor: computeapi.HYPERVISOR_KVM,
+		},
+		VcpuCount:    desc.CpuCount,
+		VmemSize:     int(desc.MemoryMB),
+		OsType:       desc.OsType,
+		GuestImageID: gi.Id,
+	}
+	if desc.Firmware == ovfutils.FIRMWARE_UEFI {
+		content.Bios = "UEFI"
+	}
+	for i, disk := range desc.Disks {
+		content.Disks = append(content.Disks, &computeapi.DiskConfig{
+			Index:  i,
+			Driver: disk.Driver,
+			SizeMb: int(disk.CapacityBytes / 1024 / 1024),
+		})
+	}
+	for i, nic := range desc.Nics {
+		content.Networks = append(content.Networks, &computeapi.NetworkConfig{
+			Index:  i,
+			Driver: nic.Model,
+		})
+	}
+
+	params := jsonutils.NewDict()
+	params.Set("generate_name", jsonutils.NewString(gi.Name))
+	params.Set("description", jsonutils.NewString(fmt.Sprintf("imported from ovf %s", desc.Name)))
+	params.Set("project_id", jsonutils.NewString(gi.ProjectId))
+	params.Set("content", jsonutils.Marshal(content))
+
+	s := auth.GetSession(ctx, userCred, options.Options.Region)
+	ret, err := compute.GuestTemplate.Create(s, params)
+	if err != nil {
+		return "", errors.Wrap(err, "GuestTemplate.Create")
+	}
+	templateId, _ := ret.GetString("id")
+	err = gi.SetMetadata(ctx, api.GUEST_IMAGE_GUEST_TEMPLATE, templateId, userCred)
+	if err != nil {
+		log.Errorf("set guest template of guest image %s: %s", gi.Name, err)
+	}
+	return templateId, nil
+}
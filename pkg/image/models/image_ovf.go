@@ -0,0 +1,153 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/httputils"
+
+	api "yunion.io/x/onecloud/pkg/apis/image"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/image/options"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/ovfutils"
+)
+
+// IsOvfPackage reports whether the image is an ova archive or ovf descriptor
+// waiting to be imported as a guest image
+func (self *SImage) IsOvfPackage() bool {
+	return self.DiskFormat == api.IMAGE_DISK_FORMAT_OVA || self.DiskFormat == api.IMAGE_DISK_FORMAT_OVF
+}
+
+func (self *SImage) StartImportOvfTask(ctx context.Context, userCred mcclient.TokenCredential, copyFrom string, parentTaskId string) error {
+	params := jsonutils.NewDict()
+	if len(copyFrom) > 0 {
+		params.Set("copy_from", jsonutils.NewString(copyFrom))
+	}
+	self.SetStatus(ctx, userCred, api.IMAGE_STATUS_CONVERTING, "import ovf")
+	task, err := taskman.TaskManager.NewTask(ctx, "ImageImportOvfTask", self, userCred, params, parentTaskId, "", nil)
+	if err != nil {
+		return errors.Wrap(err, "NewTask")
+	}
+	task.ScheduleRun(nil)
+	return nil
+}
+
+func (self *SImage) getOvfWorkDir() string {
+	return self.GetLocalPath("ovf.d")
+}
+
+// ImportOvf unpacks the package and registers its disks as a guest image.
+// For a bare ovf descriptor the disk files are fetched relative to copyFrom.
+func (self *SImage) ImportOvf(ctx context.Context, userCred mcclient.TokenCredential, copyFrom string) (*SGuestImage, *ovfutils.SOvfDescriptor, error) {
+	dir := self.getOvfWorkDir()
+	defer os.RemoveAll(dir)
+
+	descPath := self.GetLocalPath("")
+	if self.DiskFormat == api.IMAGE_DISK_FORMAT_OVA {
+		content, err := ovfutils.ExtractOva(self.GetLocalPath(""), dir)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "ExtractOva")
+		}
+		if len(content.Manifest) > 0 {
+			err = ovfutils.VerifyManifest(content.Manifest, dir)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "VerifyManifest")
+			}
+		}
+		descPath = content.Descriptor
+	} else if len(copyFrom) == 0 {
+		return nil, nil, httperrors.NewInputParameterError("ovf descriptor has no disk files, upload an ova or import it by url")
+	}
+
+	desc, err := ovfutils.ParseOvfFile(descPath)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "ParseOvfFile")
+	}
+	log.Infof("import ovf %s: %s", self.Name, desc)
+
+	if self.DiskFormat == api.IMAGE_DISK_FORMAT_OVF {
+		err = os.MkdirAll(dir, 0755)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "MkdirAll %s", dir)
+		}
+		for i := range desc.Disks {
+			err = fetchOvfFile(ctx, copyFrom, desc.Disks[i].FileHref, dir)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "fetch %s", desc.Disks[i].FileHref)
+			}
+		}
+	}
+
+	gi, err := GuestImageManager.createFromOvf(ctx, userCred, self, desc, dir)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "createFromOvf")
+	}
+	return gi, desc, nil
+}
+
+func fetchOvfFile(ctx context.Context, descUrl string, href string, dir string) error {
+	base, err := url.Parse(descUrl)
+	if err != nil {
+		return errors.Wrapf(err, "parse %s", descUrl)
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return errors.Wrapf(err, "parse %s", href)
+	}
+	resolved := base.ResolveReference(ref)
+	// hrefs are validated by the parser already, never leave the source server
+	if resolved.Scheme != base.Scheme || resolved.Host != base.Host {
+		return errors.Wrapf(httperrors.ErrForbidden, "%s is outside of %s", href, descUrl)
+	}
+	fileUrl := resolved.String()
+
+	client := httputils.GetTimeoutClient(0)
+	transport := httputils.GetTransport(true)
+	transport.Proxy = options.Options.HttpTransportProxyFunc()
+	client.Transport = transport
+	resp, err := httputils.Request(client, ctx, httputils.GET, fileUrl, http.Header{}, nil, false)
+	if err != nil {
+		return errors.Wrapf(err, "GET %s", fileUrl)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errors.Errorf("GET %s: %s", fileUrl, resp.Status)
+	}
+
+	fp, err := os.Create(filepath.Join(dir, filepath.Base(href)))
+	if err != nil {
+		return errors.Wrap(err, "Create")
+	}
+	defer fp.Close()
+	_, err = io.Copy(fp, resp.Body)
+	return err
+}
+
+// OnOvfImportComplete drops the package once its disks live in the guest image
+func (self *SImage) OnOvfImportComplete(ctx context.Context, userCred mcclient.TokenCredential) error {
+	self.unprotectImage()
+	return self.startDeleteImageTask(ctx, userCred, "", false, true)
+}
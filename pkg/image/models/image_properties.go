@@ -19,6 +19,7 @@ import (
 
 	"yunion.io/x/jsonutils"
 
+	api "yunion.io/x/onecloud/pkg/apis/image"
 	"yunion.io/x/onecloud/pkg/cloudcommon/db"
 	"yunion.io/x/onecloud/pkg/mcclient"
 )
@@ -82,6 +83,10 @@ func (manager *SImagePropertyManager) GetProperties(imageId string) (map[string]
 func (manager *SImagePropertyManager) SaveProperties(ctx context.Context, userCred mcclient.TokenCredential, imageId string, props jsonutils.JSONObject) error {
 	propsJson := props.(*jsonutils.JSONDict)
 	for _, k := range propsJson.SortedKeys() {
+		if k == api.IMAGE_SIGNATURE_STATUS {
+			// maintained by signature verification only
+			continue
+		}
 		v, _ := propsJson.GetString(k)
 		_, err := manager.SaveProperty(ctx, userCred, imageId, k, v)
 		if err != nil {
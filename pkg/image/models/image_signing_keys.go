@@ -0,0 +1,337 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/utils"
+	"yunion.io/x/sqlchemy"
+
+	"yunion.io/x/onecloud/pkg/apis"
+	api "yunion.io/x/onecloud/pkg/apis/image"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/imagesign"
+	"yunion.io/x/onecloud/pkg/util/logclient"
+	"yunion.io/x/onecloud/pkg/util/stringutils2"
+)
+
+type SImageSigningKeyManager struct {
+	db.SEnabledStatusDomainLevelResourceBaseManager
+}
+
+var ImageSigningKeyManager *SImageSigningKeyManager
+
+func init() {
+	ImageSigningKeyManager = &SImageSigningKeyManager{
+		SEnabledStatusDomainLevelResourceBaseManager: db.NewEnabledStatusDomainLevelResourceBaseManager(
+			SImageSigningKey{},
+			"image_signing_keys_tbl",
+			"image_signing_key",
+			"image_signing_keys",
+		),
+	}
+	ImageSigningKeyManager.SetVirtualObject(ImageSigningKeyManager)
+}
+
+// SImageSigningKey is a publisher key registered in a domain, images of the
+// domain carrying a detached signature are verified against it
+type SImageSigningKey struct {
+	db.SEnabledStatusDomainLevelResourceBase
+
+	// 签名算法
+	Algorithm string `width:"16" charset:"ascii" nullable:"false" list:"user" create:"required"`
+	// PEM 格式的公钥或证书
+	PublicKey string `type:"text" nullable:"false" get:"user" create:"required"`
+	// 公钥指纹
+	Fingerprint string `width:"64" charset:"ascii" nullable:"false" index:"true" list:"user"`
+}
+
+func (manager *SImageSigningKeyManager) ValidateCreateData(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	ownerId mcclient.IIdentityProvider,
+	query jsonutils.JSONObject,
+	input api.ImageSigningKeyCreateInput,
+) (api.ImageSigningKeyCreateInput, error) {
+	var err error
+	input.EnabledStatusDomainLevelResourceCreateInput, err = manager.SEnabledStatusDomainLevelResourceBaseManager.ValidateCreateData(ctx, userCred, ownerId, query, input.EnabledStatusDomainLevelResourceCreateInput)
+	if err != nil {
+		return input, errors.Wrap(err, "SEnabledStatusDomainLevelResourceBaseManager.ValidateCreateData")
+	}
+	if !utils.IsInStringArray(input.Algorithm, []string{api.IMAGE_SIGNING_ALGORITHM_ED25519, api.IMAGE_SIGNING_ALGORITHM_X509}) {
+		return input, httperrors.NewInputParameterError("invalid algorithm %q", input.Algorithm)
+	}
+	if len(input.PublicKey) == 0 {
+		return input, httperrors.NewMissingParameterError("public_key")
+	}
+	key, err := imagesign.ParsePublicKey(input.Algorithm, input.PublicKey)
+	if err != nil {
+		return input, httperrors.NewInputParameterError("invalid public_key: %v", err)
+	}
+	cnt, err := manager.Query().Equals("domain_id", ownerId.GetProjectDomainId()).Equals("fingerprint", key.Fingerprint).CountWithError()
+	if err != nil {
+		return input, errors.Wrap(err, "CountWithError")
+	}
+	if cnt > 0 {
+		return input, httperrors.NewDuplicateResourceError("public key %s already registered", key.Fingerprint)
+	}
+	input.Status = apis.STATUS_AVAILABLE
+	if input.Enabled == nil {
+		input.Enabled = &[]bool{true}[0]
+	}
+	return input, nil
+}
+
+func (key *SImageSigningKey) CustomizeCreate(ctx context.Context, userCred mcclient.TokenCredential, ownerId mcclient.IIdentityProvider, query jsonutils.JSONObject, data jsonutils.JSONObject) error {
+	pub, err := imagesign.ParsePublicKey(key.Algorithm, key.PublicKey)
+	if err != nil {
+		return errors.Wrap(err, "ParsePublicKey")
+	}
+	key.Fingerprint = pub.Fingerprint
+	return key.SEnabledStatusDomainLevelResourceBase.CustomizeCreate(ctx, userCred, ownerId, query, data)
+}
+
+func (manager *SImageSigningKeyManager) ListItemFilter(
+	ctx context.Context,
+	q *sqlchemy.SQuery,
+	userCred mcclient.TokenCredential,
+	query api.ImageSigningKeyListInput,
+) (*sqlchemy.SQuery, error) {
+	q, err := manager.SEnabledStatusDomainLevelResourceBaseManager.ListItemFilter(ctx, q, userCred, query.EnabledStatusDomainLevelResourceListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SEnabledStatusDomainLevelResourceBaseManager.ListItemFilter")
+	}
+	if len(query.Algorithm) > 0 {
+		q = q.In("algorithm", query.Algorithm)
+	}
+	if len(query.Fingerprint) > 0 {
+		q = q.In("fingerprint", query.Fingerprint)
+	}
+	return q, nil
+}
+
+func (manager *SImageSigningKeyManager) OrderByExtraFields(
+	ctx context.Context,
+	q *sqlchemy.SQuery,
+	userCred mcclient.TokenCredential,
+	query api.ImageSigningKeyListInput,
+) (*sqlchemy.SQuery, error) {
+	q, err := manager.SEnabledStatusDomainLevelResourceBaseManager.OrderByExtraFields(ctx, q, userCred, query.EnabledStatusDomainLevelResourceListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SEnabledStatusDomainLevelResourceBaseManager.OrderByExtraFields")
+	}
+	return q, nil
+}
+
+func (manager *SImageSigningKeyManager) QueryDistinctExtraField(q *sqlchemy.SQuery, field string) (*sqlchemy.SQuery, error) {
+	q, err := manager.SEnabledStatusDomainLevelResourceBaseManager.QueryDistinctExtraField(q, field)
+	if err == nil {
+		return q, nil
+	}
+	return q, httperrors.ErrNotFound
+}
+
+func (manager *SImageSigningKeyManager) FetchCustomizeColumns(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	objs []interface{},
+	fields stringutils2.SSortedStrings,
+	isList bool,
+) []api.ImageSigningKeyDetails {
+	rows := make([]api.ImageSigningKeyDetails, len(objs))
+	baseRows := manager.SEnabledStatusDomainLevelResourceBaseManager.FetchCustomizeColumns(ctx, userCred, query, objs, fields, isList)
+	keyIds := make([]string, len(objs))
+	for i := range rows {
+		rows[i] = api.ImageSigningKeyDetails{
+			EnabledStatusDomainLevelResourceDetails: baseRows[i],
+		}
+		keyIds[i] = objs[i].(*SImageSigningKey).Id
+	}
+
+	images := ImageManager.Query().SubQuery()
+	q := images.Query(images.Field("signing_key_id"), sqlchemy.COUNT("image_count"))
+	q = q.In("signing_key_id", keyIds).GroupBy(images.Field("signing_key_id"))
+	counts := []struct {
+		SigningKeyId string
+		ImageCount   int
+	}{}
+	err := q.All(&counts)
+	if err != nil {
+		log.Errorf("query image count of signing keys: %v", err)
+		return rows
+	}
+	countMap := map[string]int{}
+	for _, c := range counts {
+		countMap[c.SigningKeyId] = c.ImageCount
+	}
+	for i := range rows {
+		rows[i].ImageCount = countMap[keyIds[i]]
+	}
+	return rows
+}
+
+func (key *SImageSigningKey) ValidateDeleteCondition(ctx context.Context, info jsonutils.JSONObject) error {
+	if key.Enabled.IsTrue() {
+		return httperrors.NewInvalidStatusError("signing key is enabled, disable it before deleting")
+	}
+	return key.SEnabledStatusDomainLevelResourceBase.ValidateDeleteCondition(ctx, nil)
+}
+
+func (manager *SImageSigningKeyManager) fetchSigningKey(ctx context.Context, userCred mcclient.TokenCredential, keyId string) (*SImageSigningKey, error) {
+	obj, err := manager.FetchByIdOrName(ctx, userCred, keyId)
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, httperrors.NewResourceNotFoundError2(manager.Keyword(), keyId)
+		}
+		return nil, errors.Wrap(err, "FetchByIdOrName")
+	}
+	return obj.(*SImageSigningKey), nil
+}
+
+// verifySignature checks the detached signature of the local image file
+// and returns the resulting signature status
+func (img *SImage) verifySignature() (string, error) {
+	if len(img.Signature) == 0 {
+		return api.IMAGE_SIGNATURE_STATUS_UNSIGNED, nil
+	}
+	obj, err := ImageSigningKeyManager.FetchById(img.SigningKeyId)
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return api.IMAGE_SIGNATURE_STATUS_UNTRUSTED, errors.Wrapf(imagesign.ErrUntrustedKey, "signing key %s not found", img.SigningKeyId)
+		}
+		return "", errors.Wrap(err, "fetch signing key")
+	}
+	key := obj.(*SImageSigningKey)
+	if !key.Enabled.IsTrue() {
+		return api.IMAGE_SIGNATURE_STATUS_UNTRUSTED, errors.Wrapf(imagesign.ErrUntrustedKey, "signing key %s disabled", key.Name)
+	}
+	if key.DomainId != img.DomainId {
+		return api.IMAGE_SIGNATURE_STATUS_UNTRUSTED, errors.Wrapf(imagesign.ErrUntrustedKey, "signing key %s not in domain of image", key.Name)
+	}
+	pub, err := imagesign.ParsePublicKey(key.Algorithm, key.PublicKey)
+	if err != nil {
+		return "", errors.Wrap(err, "ParsePublicKey")
+	}
+	err = imagesign.VerifyFile(img.GetLocalLocation(), pub, img.Signature)
+	switch errors.Cause(err) {
+	case nil:
+		return api.IMAGE_SIGNATURE_STATUS_VERIFIED, nil
+	case imagesign.ErrInvalidSignature:
+		return api.IMAGE_SIGNATURE_STATUS_INVALID, err
+	case imagesign.ErrUntrustedKey:
+		return api.IMAGE_SIGNATURE_STATUS_UNTRUSTED, err
+	default:
+		return "", err
+	}
+}
+
+// DoVerifySignature verifies the image and records the result in the
+// signature_status property
+func (img *SImage) DoVerifySignature(ctx context.Context, userCred mcclient.TokenCredential) (string, error) {
+	status, err := img.verifySignature()
+	if len(status) == 0 {
+		return status, errors.Wrap(err, "verifySignature")
+	}
+	_, e := ImagePropertyManager.SaveProperty(ctx, userCred, img.Id, api.IMAGE_SIGNATURE_STATUS, status)
+	if e != nil {
+		return status, errors.Wrap(e, "save signature status")
+	}
+	if status != api.IMAGE_SIGNATURE_STATUS_UNSIGNED {
+		notes := status
+		if err != nil {
+			notes = err.Error()
+		}
+		db.OpsLog.LogEvent(img, db.ACT_UPDATE, notes, userCred)
+		logclient.AddSimpleActionLog(img, logclient.ACT_IMAGE_VERIFY, notes, userCred, status == api.IMAGE_SIGNATURE_STATUS_VERIFIED)
+	}
+	return status, nil
+}
+
+func (img *SImage) getSignatureStatus() string {
+	prop, _ := ImagePropertyManager.GetProperty(img.Id, api.IMAGE_SIGNATURE_STATUS)
+	if prop == nil {
+		return ""
+	}
+	return prop.Value
+}
+
+// 重新校验镜像签名, 可同时更换签名
+func (img *SImage) PerformVerifySignature(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input api.PerformVerifySignatureInput) (jsonutils.JSONObject, error) {
+	if img.Status != api.IMAGE_STATUS_ACTIVE {
+		return nil, httperrors.NewInvalidStatusError("cannot verify signature in status %s", img.Status)
+	}
+	if !img.isLocal() {
+		return nil, httperrors.NewNotSupportedError("image is not stored locally")
+	}
+	if len(input.Signature) > 0 {
+		key, signature, err := ImageSigningKeyManager.validateSignature(ctx, userCred, img.GetOwnerId(), input.Signature, input.SigningKeyId)
+		if err != nil {
+			return nil, err
+		}
+		_, err = db.Update(img, func() error {
+			img.Signature = signature
+			img.SigningKeyId = key.Id
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "update signature")
+		}
+	} else if len(img.Signature) == 0 {
+		return nil, httperrors.NewMissingParameterError("signature")
+	}
+	return nil, img.StartVerifySignatureTask(ctx, userCred, "")
+}
+
+func (img *SImage) StartVerifySignatureTask(ctx context.Context, userCred mcclient.TokenCredential, parentTaskId string) error {
+	task, err := taskman.TaskManager.NewTask(ctx, "ImageVerifySignatureTask", img, userCred, nil, parentTaskId, "", nil)
+	if err != nil {
+		return errors.Wrap(err, "NewTask")
+	}
+	task.ScheduleRun(nil)
+	return nil
+}
+
+// validateSignature checks the signing key is usable by the image owner and
+// returns the signature in canonical base64
+func (manager *SImageSigningKeyManager) validateSignature(ctx context.Context, userCred mcclient.TokenCredential, ownerId mcclient.IIdentityProvider, signature, keyId string) (*SImageSigningKey, string, error) {
+	if len(keyId) == 0 {
+		return nil, "", httperrors.NewMissingParameterError("signing_key_id")
+	}
+	sig, err := imagesign.DecodeSignature(signature)
+	if err != nil {
+		return nil, "", httperrors.NewInputParameterError("invalid signature: %v", err)
+	}
+	key, err := manager.fetchSigningKey(ctx, userCred, keyId)
+	if err != nil {
+		return nil, "", err
+	}
+	if key.DomainId != ownerId.GetProjectDomainId() {
+		return nil, "", httperrors.NewInputParameterError("signing key %s does not belong to domain of image", key.Name)
+	}
+	if !key.Enabled.IsTrue() {
+		return nil, "", httperrors.NewInvalidStatusError("signing key %s is disabled", key.Name)
+	}
+	return key, base64.StdEncoding.EncodeToString(sig), nil
+}
@@ -23,7 +23,6 @@ import (
 	"os"
 	"path"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 
@@ -157,6 +156,11 @@ type SImage struct {
 
 	// 加密状态, "",encrypting,encrypted
 	EncryptStatus string `width:"16" charset:"ascii" nullable:"true" get:"user" list:"user"`
+
+	// 镜像签名, 镜像文件 SHA-256 摘要的签名, base64 编码
+	Signature string `type:"text" nullable:"true" get:"user" create:"optional"`
+	// 签名密钥ID
+	SigningKeyId string `width:"36" charset:"ascii" nullable:"true" get:"user" list:"user" create:"optional"`
 }
 
 func (manager *SImageManager) CustomizeHandlerInfo(info *appsrv.SHandlerInfo) {
@@ -251,21 +255,7 @@ func (self *SImage) CustomizedGetDetailsBody(ctx context.Context, userCred mccli
 		return nil, httperrors.NewInvalidStatusError("empty file path")
 	}
 
-	size, rc, err := GetImage(ctx, filePath)
-	if err != nil {
-		return nil, errors.Wrap(err, "get image")
-	}
-	defer rc.Close()
-
-	appParams := appsrv.AppContextGetParams(ctx)
-	appParams.Response.Header().Set("Content-Length", strconv.FormatInt(size, 10))
-
-	_, err = streamutils.StreamPipe(rc, appParams.Response, false, nil)
-	if err != nil {
-		return nil, httperrors.NewGeneralError(err)
-	}
-
-	return nil, nil
+	return nil, sendImageFile(ctx, filePath)
 }
 
 func (self *SImage) getMoreDetails(out api.ImageDetails) api.ImageDetails {
@@ -397,6 +387,24 @@ func (manager *SImageManager) ValidateCreateData(
 		return input, errors.Wrap(err, "SEncryptedResourceManager.ValidateCreateData")
 	}
 
+	if len(input.Signature) > 0 {
+		if input.DiskFormat == api.IMAGE_DISK_FORMAT_OVA || input.DiskFormat == api.IMAGE_DISK_FORMAT_OVF {
+			return input, httperrors.NewInputParameterError("signature is not supported for %s package", input.DiskFormat)
+		}
+		if input.EncryptKeyId != nil && len(*input.EncryptKeyId) > 0 {
+			// encryption rewrites the image, the signature would no longer match
+			return input, httperrors.NewConflictError("signed image cannot be encrypted")
+		}
+		key, signature, err := ImageSigningKeyManager.validateSignature(ctx, userCred, ownerId, input.Signature, input.SigningKeyId)
+		if err != nil {
+			return input, err
+		}
+		input.Signature = signature
+		input.SigningKeyId = key.Id
+	} else if len(input.SigningKeyId) > 0 {
+		return input, httperrors.NewMissingParameterError("signature")
+	}
+
 	// If this image is the part of guest image (contains "guest_image_id"),
 	// we do not need to check and set pending quota
 	// because that pending quota has been checked and set in SGuestImage.ValidateCreateData
@@ -535,12 +543,15 @@ func (self *SImage) SaveImageFromStream(reader io.Reader, totalSize int64, calCh
 
 		virtualSizeBytes := int64(0)
 		format := ""
-		img, err := qemuimg.NewQemuImage(localPath)
-		if err != nil {
-			return errors.Wrapf(err, "NewQemuImage %s", localPath)
+		// ova/ovf packages are unpacked by ImageImportOvfTask, not probed by qemu-img
+		if !self.IsOvfPackage() {
+			img, err := qemuimg.NewQemuImage(localPath)
+			if err != nil {
+				return errors.Wrapf(err, "NewQemuImage %s", localPath)
+			}
+			format = string(img.Format)
+			virtualSizeBytes = img.SizeBytes
 		}
-		format = string(img.Format)
-		virtualSizeBytes = img.SizeBytes
 
 		var fastChksum string
 		if calChecksum {
@@ -633,6 +644,10 @@ func (self *SImage) PostCreate(ctx context.Context, userCred mcclient.TokenCrede
 		}
 
 		self.OnSaveSuccess(ctx, userCred, "create upload success")
+		if self.IsOvfPackage() {
+			self.StartImportOvfTask(ctx, userCred, "", "")
+			return
+		}
 		self.StartImagePipeline(ctx, userCred, false)
 	} else {
 		copyFrom := appParams.Request.Header.Get(modules.IMAGE_META_COPY_FROM)
@@ -647,13 +662,19 @@ func (self *SImage) PostCreate(ctx context.Context, userCred mcclient.TokenCrede
 // will recalculate checksum in the end
 func (self *SImage) StartImagePipeline(
 	ctx context.Context, userCred mcclient.TokenCredential, skipProbe bool,
+) error {
+	return self.startImagePipelineTask(ctx, userCred, skipProbe, "")
+}
+
+func (self *SImage) startImagePipelineTask(
+	ctx context.Context, userCred mcclient.TokenCredential, skipProbe bool, parentTaskId string,
 ) error {
 	data := jsonutils.NewDict()
 	if skipProbe {
 		data.Set("skip_probe", jsonutils.JSONTrue)
 	}
 	task, err := taskman.TaskManager.NewTask(
-		ctx, "ImagePipelineTask", self, userCred, data, "", "", nil)
+		ctx, "ImagePipelineTask", self, userCred, data, parentTaskId, "", nil)
 	if err != nil {
 		return err
 	}
@@ -700,8 +721,12 @@ func (self *SImage) ValidateUpdateData(ctx context.Context, userCred mcclient.To
 				}
 				self.OnSaveSuccess(ctx, userCred, "update upload success")
 				data.Remove("status")
-				// For guest image, DoConvertAfterProbe is not necessary.
-				self.StartImagePipeline(ctx, userCred, false)
+				if self.IsOvfPackage() {
+					self.StartImportOvfTask(ctx, userCred, "", "")
+				} else {
+					// For guest image, DoConvertAfterProbe is not necessary.
+					self.StartImagePipeline(ctx, userCred, false)
+				}
 			} else {
 				copyFrom := appParams.Request.Header.Get(modules.IMAGE_META_COPY_FROM)
 				compress := appParams.Request.Header.Get(modules.IMAGE_META_COMPRESS_FORMAT)
@@ -1030,6 +1055,8 @@ func (self *SImage) GetImageType() api.TImageType {
 		return api.ImageTypeISO
 	} else if self.DiskFormat == api.IMAGE_DISK_FORMAT_TGZ {
 		return api.ImageTypeTarGzip
+	} else if self.IsOvfPackage() {
+		return api.ImageTypeOvf
 	} else {
 		return api.ImageTypeTemplate
 	}
@@ -1107,7 +1134,7 @@ func (img *SImage) isEncrypted() bool {
 }
 
 func (self *SImage) makeSubImages(ctx context.Context) error {
-	if self.GetImageType() == api.ImageTypeISO || self.GetImageType() == api.ImageTypeTarGzip {
+	if self.GetImageType() == api.ImageTypeISO || self.GetImageType() == api.ImageTypeTarGzip || self.GetImageType() == api.ImageTypeOvf {
 		// do not convert iso
 		return nil
 	}
@@ -1338,6 +1365,7 @@ func (manager *SImageManager) ListItemFilter(
 	propFilter([]string{api.IMAGE_OS_ARCH}, query.OsArchs, query.OsArchPreciseMatch)
 	propFilter([]string{api.IMAGE_OS_TYPE}, query.OsTypes, query.OsTypePreciseMatch)
 	propFilter([]string{api.IMAGE_OS_DISTRO, "distro"}, query.Distributions, query.DistributionPreciseMatch)
+	propFilter([]string{api.IMAGE_SIGNATURE_STATUS}, query.SignatureStatus, true)
 
 	return q, nil
 }
@@ -1433,6 +1461,10 @@ func (self *SImage) DoCheckStatus(ctx context.Context, userCred mcclient.TokenCr
 	if utils.IsInStringArray(self.Status, api.ImageDeadStatus) {
 		return
 	}
+	if self.IsOvfPackage() {
+		// ova/ovf packages only live until ImageImportOvfTask finishes
+		return
+	}
 	if IsCheckStatusEnabled(self) {
 		if self.isActive(useFast, true) {
 			if self.Status != api.IMAGE_STATUS_ACTIVE {
@@ -1945,6 +1977,10 @@ func (img *SImage) doConvert(ctx context.Context, userCred mcclient.TokenCredent
 	} else {
 		supportedFormats := make([]string, 0)
 		for i := 0; i < len(subimgs); i += 1 {
+			if !utils.IsInStringArray(subimgs[i].Format, options.Options.TargetImageFormats) && utils.IsInStringArray(subimgs[i].Format, api.ImageExportFormats) {
+				// converted on download, left to ImageExportTask
+				continue
+			}
 			if !utils.IsInStringArray(subimgs[i].Format, options.Options.TargetImageFormats) && subimgs[i].Format != img.DiskFormat {
 				// no need to have this subformat
 				err := subimgs[i].cleanup(ctx, userCred)
@@ -2048,6 +2084,17 @@ func (img *SImage) setEncryptStatus(userCred mcclient.TokenCredential, status st
 func (img *SImage) Pipeline(ctx context.Context, userCred mcclient.TokenCredential, skipProbe bool) error {
 	updated := false
 	needChecksum := false
+	// verify signature of the uploaded file before anything touches it
+	if len(img.getSignatureStatus()) == 0 && img.isLocal() {
+		status, err := img.DoVerifySignature(ctx, userCred)
+		if err != nil {
+			return errors.Wrap(err, "DoVerifySignature")
+		}
+		if status == api.IMAGE_SIGNATURE_STATUS_INVALID {
+			img.OnSaveFailed(ctx, userCred, jsonutils.NewString("image signature mismatch"))
+			return errors.Wrap(httperrors.ErrInvalidStatus, "image signature mismatch")
+		}
+	}
 	// do probe
 	if !skipProbe {
 		alterd, err := img.doProbeImageInfo(ctx, userCred)
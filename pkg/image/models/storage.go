@@ -22,7 +22,6 @@ import (
 	"strings"
 
 	"yunion.io/x/pkg/errors"
-	"yunion.io/x/pkg/util/qemuimgfmt"
 
 	"yunion.io/x/onecloud/pkg/apis/image"
 	"yunion.io/x/onecloud/pkg/image/drivers/s3"
@@ -122,17 +121,13 @@ func (s *LocalStorage) GetImage(ctx context.Context, imagePath string) (int64, i
 
 func (s *LocalStorage) ConvertImage(ctx context.Context, image *SImage, targetFormat string, progresser func(saved int64)) (*SConverImageInfo, error) {
 	location := image.GetPath(targetFormat)
-	img, err := image.getQemuImage()
+	sizeBytes, err := image.exportTo(location, targetFormat)
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to image.getQemuImage")
-	}
-	nimg, err := img.Clone(location, qemuimgfmt.String2ImageFormat(targetFormat), true)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to img.Clone")
+		return nil, errors.Wrapf(err, "export to %s", targetFormat)
 	}
 	return &SConverImageInfo{
 		Location:  fmt.Sprintf("%s%s", LocalFilePrefix, location),
-		SizeBytes: nimg.ActualSizeBytes,
+		SizeBytes: sizeBytes,
 	}, nil
 }
 
@@ -197,13 +192,9 @@ func (s *S3Storage) ConvertImage(ctx context.Context, image *SImage, targetForma
 		return nil, err
 	}
 	location := fmt.Sprintf("%s/%s.%s", tempDir, image.GetId(), targetFormat)
-	img, err := image.getQemuImage()
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to image.getQemuImage")
-	}
-	nimg, err := img.Clone(location, qemuimgfmt.String2ImageFormat(targetFormat), true)
+	sizeBytes, err := image.exportTo(location, targetFormat)
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to img.Clone")
+		return nil, errors.Wrapf(err, "export to %s", targetFormat)
 	}
 	defer s.CleanTempfile(location)
 	s3Location, err := s.SaveImage(ctx, location, progresser)
@@ -212,7 +203,7 @@ func (s *S3Storage) ConvertImage(ctx context.Context, image *SImage, targetForma
 	}
 	return &SConverImageInfo{
 		Location:  s3Location,
-		SizeBytes: nimg.ActualSizeBytes,
+		SizeBytes: sizeBytes,
 	}, nil
 }
 
@@ -102,7 +102,12 @@ func (self *ImageCopyFromUrlTask) OnInit(ctx context.Context, obj db.IStandalone
 func (self *ImageCopyFromUrlTask) OnImageImportComplete(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
 	image := obj.(*models.SImage)
 	image.OnSaveTaskSuccess(self, self.UserCred, "create upload success")
-	image.StartImagePipeline(ctx, self.UserCred, false)
+	if image.IsOvfPackage() {
+		copyFrom, _ := self.Params.GetString("copy_from")
+		image.StartImportOvfTask(ctx, self.UserCred, copyFrom, "")
+	} else {
+		image.StartImagePipeline(ctx, self.UserCred, false)
+	}
 	self.SetStageComplete(ctx, nil)
 }
 
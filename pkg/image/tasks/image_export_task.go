@@ -0,0 +1,56 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tasks
+
+import (
+	"context"
+
+	"yunion.io/x/jsonutils"
+
+	"yunion.io/x/onecloud/pkg/appsrv"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
+	"yunion.io/x/onecloud/pkg/image/models"
+	"yunion.io/x/onecloud/pkg/util/logclient"
+)
+
+// ImageExportTask converts an image to an export format requested by download
+type ImageExportTask struct {
+	taskman.STask
+}
+
+func init() {
+	exportWorker := appsrv.NewWorkerManager("ImageExportTaskWorkerManager", 2, 512, true)
+	taskman.RegisterTaskAndWorker(ImageExportTask{}, exportWorker)
+}
+
+func (self *ImageExportTask) OnInit(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
+	image := obj.(*models.SImage)
+	format, _ := self.Params.GetString("format")
+	self.SetStage("OnExported", nil)
+	taskman.LocalTaskRun(self, func() (jsonutils.JSONObject, error) {
+		return nil, image.DoExport(format)
+	})
+}
+
+func (self *ImageExportTask) OnExported(ctx context.Context, image *models.SImage, data jsonutils.JSONObject) {
+	logclient.AddActionLogWithStartable(self, image, logclient.ACT_IMAGE_EXPORT, self.Params, self.UserCred, true)
+	self.SetStageComplete(ctx, nil)
+}
+
+func (self *ImageExportTask) OnExportedFailed(ctx context.Context, image *models.SImage, data jsonutils.JSONObject) {
+	logclient.AddActionLogWithStartable(self, image, logclient.ACT_IMAGE_EXPORT, data, self.UserCred, false)
+	self.SetStageFailed(ctx, data)
+}
@@ -0,0 +1,135 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tasks
+
+import (
+	"context"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/appsrv"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
+	"yunion.io/x/onecloud/pkg/image/models"
+	"yunion.io/x/onecloud/pkg/util/logclient"
+	"yunion.io/x/onecloud/pkg/util/ovfutils"
+)
+
+type ImageImportOvfTask struct {
+	taskman.STask
+}
+
+var ovfImportWorker *appsrv.SWorkerManager
+
+func init() {
+	ovfImportWorker = appsrv.NewWorkerManager("ImageImportOvfTaskWorkerManager", 2, 512, true)
+	taskman.RegisterTask(ImageImportOvfTask{})
+}
+
+func (self *ImageImportOvfTask) OnInit(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
+	image := obj.(*models.SImage)
+	copyFrom, _ := self.Params.GetString("copy_from")
+
+	self.SetStage("OnOvfImported", nil)
+	taskman.LocalTaskRunWithWorkers(self, func() (jsonutils.JSONObject, error) {
+		gi, desc, err := image.ImportOvf(ctx, self.UserCred, copyFrom)
+		if err != nil {
+			return nil, err
+		}
+		ret := jsonutils.NewDict()
+		ret.Set("guest_image_id", jsonutils.NewString(gi.Id))
+		ret.Set("ovf", jsonutils.Marshal(desc))
+		return ret, nil
+	}, ovfImportWorker)
+}
+
+func (self *ImageImportOvfTask) OnOvfImported(ctx context.Context, image *models.SImage, data jsonutils.JSONObject) {
+	self.SaveParams(data.(*jsonutils.JSONDict))
+	gi, err := self.getGuestImage()
+	if err != nil {
+		self.taskFailed(ctx, image, jsonutils.NewString(err.Error()))
+		return
+	}
+	self.SetStage("OnSubImagesPipelined", nil)
+	err = gi.StartOvfPipelines(ctx, self.UserCred, self.GetTaskId())
+	if err != nil {
+		gi.CleanupOvfImport(ctx, self.UserCred)
+		self.taskFailed(ctx, image, jsonutils.NewString(err.Error()))
+	}
+}
+
+func (self *ImageImportOvfTask) getGuestImage() (*models.SGuestImage, error) {
+	guestImageId, _ := self.Params.GetString("guest_image_id")
+	obj, err := models.GuestImageManager.FetchById(guestImageId)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetch guest image %s", guestImageId)
+	}
+	return obj.(*models.SGuestImage), nil
+}
+
+// the result of the last pipeline is passed on, so the sub images are checked
+// in both success and failure cases
+func (self *ImageImportOvfTask) OnSubImagesPipelined(ctx context.Context, image *models.SImage, data jsonutils.JSONObject) {
+	gi, err := self.getGuestImage()
+	if err != nil {
+		self.taskFailed(ctx, image, jsonutils.NewString(err.Error()))
+		return
+	}
+	err = gi.OnOvfPipelinesComplete(ctx, self.UserCred)
+	if err != nil {
+		self.taskFailed(ctx, image, jsonutils.NewString(err.Error()))
+		return
+	}
+	desc := &ovfutils.SOvfDescriptor{}
+	self.Params.Unmarshal(desc, "ovf")
+
+	self.SetStage("OnGuestTemplateCreated", nil)
+	taskman.LocalTaskRunWithWorkers(self, func() (jsonutils.JSONObject, error) {
+		templateId, err := gi.CreateOvfGuestTemplate(ctx, self.UserCred, desc)
+		if err != nil {
+			return nil, errors.Wrap(err, "CreateOvfGuestTemplate")
+		}
+		return jsonutils.Marshal(map[string]string{"guest_template_id": templateId}), nil
+	}, ovfImportWorker)
+}
+
+func (self *ImageImportOvfTask) OnSubImagesPipelinedFailed(ctx context.Context, image *models.SImage, data jsonutils.JSONObject) {
+	self.OnSubImagesPipelined(ctx, image, data)
+}
+
+func (self *ImageImportOvfTask) taskFailed(ctx context.Context, image *models.SImage, reason jsonutils.JSONObject) {
+	image.OnSaveTaskFailed(self, self.UserCred, reason)
+	logclient.AddActionLogWithStartable(self, image, logclient.ACT_IMAGE_IMPORT_OVF, reason, self.UserCred, false)
+	self.SetStageFailed(ctx, reason)
+}
+
+func (self *ImageImportOvfTask) OnOvfImportedFailed(ctx context.Context, image *models.SImage, data jsonutils.JSONObject) {
+	self.taskFailed(ctx, image, data)
+}
+
+func (self *ImageImportOvfTask) OnGuestTemplateCreated(ctx context.Context, image *models.SImage, data jsonutils.JSONObject) {
+	self.SaveParams(data.(*jsonutils.JSONDict))
+	logclient.AddActionLogWithStartable(self, image, logclient.ACT_IMAGE_IMPORT_OVF, self.Params, self.UserCred, true)
+	image.OnOvfImportComplete(ctx, self.UserCred)
+	self.SetStageComplete(ctx, nil)
+}
+
+// the guest image is usable without a template, so only the template step is reported as failed
+func (self *ImageImportOvfTask) OnGuestTemplateCreatedFailed(ctx context.Context, image *models.SImage, data jsonutils.JSONObject) {
+	logclient.AddActionLogWithStartable(self, image, logclient.ACT_IMAGE_IMPORT_OVF, data, self.UserCred, false)
+	image.OnOvfImportComplete(ctx, self.UserCred)
+	self.SetStageFailed(ctx, data)
+}
@@ -0,0 +1,35 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compute
+
+import (
+	"yunion.io/x/onecloud/pkg/mcclient/modulebase"
+	"yunion.io/x/onecloud/pkg/mcclient/modules"
+)
+
+var (
+	CapacityReservations modulebase.ResourceManager
+)
+
+func init() {
+	CapacityReservations = modules.NewComputeManager("capacity_reservation", "capacity_reservations",
+		[]string{"ID", "Name", "Status", "Zone", "Hosts", "Cpu_count", "Mem_size",
+			"Storage_size", "Isolated_device_count", "Dev_model", "Start_at", "End_at",
+			"Used_cpu_count", "Used_mem_size", "Used_storage_size", "Used_isolated_device_count",
+			"Project"},
+		[]string{})
+
+	modules.RegisterCompute(&CapacityReservations)
+}
@@ -0,0 +1,33 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compute
+
+import (
+	"yunion.io/x/onecloud/pkg/mcclient/modulebase"
+	"yunion.io/x/onecloud/pkg/mcclient/modules"
+)
+
+var (
+	SchedDecisions modulebase.ResourceManager
+)
+
+func init() {
+	SchedDecisions = modules.NewComputeManager("sched_decision", "sched_decisions",
+		[]string{"ID", "Session_id", "Status", "Algorithm", "Hypervisor",
+			"Guest_ids", "Host_ids", "Elapsed_ms", "Error", "Created_at"},
+		[]string{})
+
+	modules.RegisterCompute(&SchedDecisions)
+}
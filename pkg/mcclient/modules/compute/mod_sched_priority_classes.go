@@ -0,0 +1,40 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compute
+
+import (
+	"yunion.io/x/onecloud/pkg/mcclient/modulebase"
+	"yunion.io/x/onecloud/pkg/mcclient/modules"
+)
+
+var (
+	SchedPriorityClasses modulebase.ResourceManager
+	SchedPreemptions     modulebase.ResourceManager
+)
+
+func init() {
+	SchedPriorityClasses = modules.NewComputeManager("sched_priority_class", "sched_priority_classes",
+		[]string{"ID", "Name", "Value", "Preemption_policy", "Victim_action",
+			"Guest_count", "Description"},
+		[]string{"Project_ids"})
+
+	SchedPreemptions = modules.NewComputeManager("sched_preemption", "sched_preemptions",
+		[]string{"ID", "Server", "Priority", "Host", "Status", "Dry_run",
+			"Victims", "Reason", "Created_at"},
+		[]string{})
+
+	modules.RegisterCompute(&SchedPriorityClasses)
+	modules.RegisterCompute(&SchedPreemptions)
+}
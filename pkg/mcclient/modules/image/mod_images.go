@@ -24,6 +24,7 @@ import (
 
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
 	"yunion.io/x/pkg/util/httputils"
 	"yunion.io/x/pkg/util/printutils"
 	"yunion.io/x/pkg/utils"
@@ -577,6 +578,37 @@ func (this *ImageManager) Download2(s *mcclient.ClientSession, id string, format
 	}
 }
 
+// ErrImageExportConverting is returned by Export while the server is still
+// converting the image, the caller should retry later
+const ErrImageExportConverting = errors.Error("ImageExportConverting")
+
+// Export downloads the image converted to format, the server converts and
+// caches formats that are not available yet in the background
+func (this *ImageManager) Export(s *mcclient.ClientSession, id string, format string) (io.ReadCloser, int64, error) {
+	path := fmt.Sprintf("/%s/%s/download", this.URLPath(), url.PathEscape(id))
+	if len(format) > 0 {
+		path = fmt.Sprintf("%s?format=%s", path, url.QueryEscape(format))
+	}
+	resp, err := modulebase.RawRequest(this.ResourceManager, s, "GET", path, nil, nil)
+	if err == nil && resp.StatusCode == http.StatusAccepted {
+		_, body, err := s.ParseJSONResponse("", resp, nil)
+		if err != nil {
+			return nil, -1, err
+		}
+		status, _ := body.GetString("status")
+		return nil, -1, errors.Wrapf(ErrImageExportConverting, "status %s", status)
+	}
+	if err == nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		sizeBytes, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+		if err != nil {
+			sizeBytes = -1
+		}
+		return resp.Body, sizeBytes, nil
+	}
+	_, _, err = s.ParseJSONResponse("", resp, err)
+	return nil, -1, err
+}
+
 var (
 	Images ImageManager
 )
@@ -91,6 +91,33 @@ func (this *SchedulerManager) Test(s *mcclient.ClientSession, params *api.Schedu
 	return obj, err
 }
 
+// Preempt asks scheduler for the host and the lower priority guests to
+// evict when the request has no fitting host
+func (this *SchedulerManager) Preempt(s *mcclient.ClientSession, input *api.ScheduleInput) (*api.PreemptOutput, error) {
+	url := newSchedURL("preempt")
+	input.Count = 1
+	_, obj, err := modulebase.JsonRequest(this.ResourceManager, s, "POST", url, nil, input.JSON(input))
+	if err != nil {
+		return nil, err
+	}
+	output := new(api.PreemptOutput)
+	err = obj.Unmarshal(output)
+	if err != nil {
+		return nil, fmt.Errorf("Not a valid response: %v", err)
+	}
+	return output, nil
+}
+
+// Snapshot exports the candidate cache of scheduler for offline simulation
+func (this *SchedulerManager) Snapshot(s *mcclient.ClientSession) (jsonutils.JSONObject, error) {
+	url := newSchedURL("snapshot")
+	_, obj, err := modulebase.JsonRequest(this.ResourceManager, s, "POST", url, nil, jsonutils.NewDict())
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
 func (this *SchedulerManager) DoForecast(s *mcclient.ClientSession, params jsonutils.JSONObject) (jsonutils.JSONObject, error) {
 	projectId := s.GetProjectId()
 	domainId := s.GetProjectDomainId()
@@ -27,6 +27,8 @@ type DiskBackupListOptions struct {
 	BackupStorageId  string `help:"backup storage id" json:"backup_storage_id"`
 	IsInstanceBackup *bool  `help:"if part of instance backup" json:"is_instance_backup"`
 	OrderByDiskName  string
+	BackupMode       []string `help:"filter by backup mode" choices:"full|incremental|differential" json:"backup_mode"`
+	ParentBackupId   string   `help:"filter by the backup depended on" json:"parent_backup_id"`
 }
 
 func (opts *DiskBackupListOptions) Params() (jsonutils.JSONObject, error) {
@@ -59,6 +61,7 @@ type DiskBackupCreateOptions struct {
 	AsTarContainerId string   `help:"container id of tar process"`
 	AsTarIncludeFile []string `help:"include file path of tar process"`
 	AsTarExcludeFile []string `help:"exclude file path of tar process"`
+	BackupMode       string   `help:"export changed data of running kvm guest by dirty bitmap" choices:"full|incremental|differential"`
 
 	DISKID          string `help:"disk id" json:"disk_id"`
 	BACKUPSTORAGEID string `help:"back storage id" json:"backup_storage_id"`
@@ -68,7 +71,10 @@ func (opts *DiskBackupCreateOptions) Params() (jsonutils.JSONObject, error) {
 	input := &computeapi.DiskBackupCreateInput{
 		DiskId:          opts.DISKID,
 		BackupStorageId: opts.BACKUPSTORAGEID,
-		BackupAsTar:     new(computeapi.DiskBackupAsTarInput),
+		BackupMode:      opts.BackupMode,
+	}
+	if opts.AsTarContainerId != "" || len(opts.AsTarIncludeFile) > 0 || len(opts.AsTarExcludeFile) > 0 {
+		input.BackupAsTar = new(computeapi.DiskBackupAsTarInput)
 	}
 	input.Name = opts.NAME
 	input.Description = opts.Desc
@@ -99,6 +105,10 @@ func (opt *DiskBackupRecoveryOptions) Params() (jsonutils.JSONObject, error) {
 	return params, nil
 }
 
+type DiskBackupConsolidateOptions struct {
+	DiskBackupIdOptions
+}
+
 type DiskBackupSyncstatusOptions struct {
 	DiskBackupIdOptions
 }
@@ -133,7 +143,7 @@ func (opts *BackupStorageIdOptions) Params() (jsonutils.JSONObject, error) {
 
 type BackupStorageCreateOptions struct {
 	options.BaseCreateOptions
-	StorageType string `help:"storage type" choices:"nfs|object"`
+	StorageType string `help:"storage type" choices:"nfs|object|repository"`
 
 	NfsHost      string `help:"nfs host, required when storage_type is nfs"`
 	NfsSharedDir string `help:"nfs shared dir, required when storage_type is nfs" `
@@ -142,6 +152,9 @@ type BackupStorageCreateOptions struct {
 	ObjectAccessKey string `help:"object storage access key, required when storage_type is object"`
 	ObjectSecret    string `help:"object storage secret, required when storage_type is object"`
 
+	RepositoryBackend string `help:"backend of repository, required when storage_type is repository" choices:"nfs|object"`
+	RepositoryKey     string `help:"key encrypting the repository, generated if not given"`
+
 	CapacityMb int `help:"capacity, unit mb"`
 }
 
@@ -164,6 +177,24 @@ func (opts *BackupStorageUpdateOptions) Params() (jsonutils.JSONObject, error) {
 	return jsonutils.Marshal(opts), nil
 }
 
+type BackupStorageVerifyOptions struct {
+	BackupStorageIdOptions
+	CheckData bool `help:"read and check the content of every chunk"`
+}
+
+func (opts *BackupStorageVerifyOptions) Params() (jsonutils.JSONObject, error) {
+	return jsonutils.Marshal(map[string]bool{"check_data": opts.CheckData}), nil
+}
+
+type BackupStorageGcOptions struct {
+	BackupStorageIdOptions
+	DryRun bool `help:"only count the chunks to remove"`
+}
+
+func (opts *BackupStorageGcOptions) Params() (jsonutils.JSONObject, error) {
+	return jsonutils.Marshal(map[string]bool{"dry_run": opts.DryRun}), nil
+}
+
 type InstanceBackupListOptions struct {
 	options.BaseListOptions
 
@@ -0,0 +1,81 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compute
+
+import (
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/fileutils"
+
+	"yunion.io/x/onecloud/pkg/mcclient/options"
+)
+
+type CapacityReservationListOptions struct {
+	options.BaseListOptions
+
+	Zone   string `help:"filter by zone id or name" json:"zone_id"`
+	Host   string `help:"filter by the reserved host id or name" json:"host_id"`
+	Active *bool  `help:"only list the reservations in effect" negative:"inactive"`
+}
+
+func (opts *CapacityReservationListOptions) Params() (jsonutils.JSONObject, error) {
+	return options.ListStructToParams(opts)
+}
+
+type CapacityReservationCreateOptions struct {
+	NAME string `help:"name of the reservation"`
+
+	Zone                string   `help:"reserve on all hosts of the zone" json:"zone_id"`
+	Host                []string `help:"reserve on the hosts" json:"hosts"`
+	CpuCount            int      `help:"reserved vcpu count"`
+	MemSize             string   `help:"reserved memory size, e.g. 16G"`
+	StorageSize         string   `help:"reserved local storage size, e.g. 500G"`
+	IsolatedDeviceCount int      `help:"reserved isolated device count"`
+	DevModel            string   `help:"model of reserved isolated devices"`
+	StartAt             string   `help:"start time of the reservation, default now, e.g. 2026-10-01T00:00:00Z"`
+	EndAt               string   `help:"end time of the reservation"`
+	Duration            string   `help:"duration of the reservation if end-at not set, e.g. 72h"`
+	Desc                string   `help:"description" json:"description"`
+}
+
+func (opts *CapacityReservationCreateOptions) Params() (jsonutils.JSONObject, error) {
+	params, err := options.StructToParams(opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range []string{"mem_size", "storage_size"} {
+		sizeStr, _ := params.GetString(key)
+		if len(sizeStr) > 0 {
+			size, err := fileutils.GetSizeMb(sizeStr, 'M', 1024)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid %s", key)
+			}
+			params.Set(key, jsonutils.NewInt(int64(size)))
+		}
+	}
+	return params, nil
+}
+
+type CapacityReservationUpdateOptions struct {
+	options.BaseIdOptions
+
+	Name  string `help:"new name"`
+	EndAt string `help:"new end time of the reservation"`
+	Desc  string `help:"description" json:"description"`
+}
+
+func (opts *CapacityReservationUpdateOptions) Params() (jsonutils.JSONObject, error) {
+	return options.StructToParams(opts)
+}
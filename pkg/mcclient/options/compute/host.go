@@ -15,9 +15,14 @@
 package compute
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+
 	"yunion.io/x/jsonutils"
 
 	"yunion.io/x/onecloud/pkg/apis/baremetal"
+	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
 	"yunion.io/x/onecloud/pkg/mcclient/options"
 )
 
@@ -98,6 +103,31 @@ func (o *HostReserveCpusOptions) Params() (jsonutils.JSONObject, error) {
 	return options.StructToParams(o)
 }
 
+type HostSetIoQosOptions struct {
+	options.BaseIdsOptions
+	Budget []string `help:"Project io budget, format project:iops:bps, 0 means unlimited, empty to clear all budgets"`
+}
+
+func (o *HostSetIoQosOptions) Params() (jsonutils.JSONObject, error) {
+	input := computeapi.HostSetIoQosInput{}
+	for _, b := range o.Budget {
+		segs := strings.Split(b, ":")
+		if len(segs) != 3 {
+			return nil, fmt.Errorf("invalid budget %s, should be project:iops:bps", b)
+		}
+		iops, err := strconv.Atoi(segs[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid iops %s", segs[1])
+		}
+		bps, err := strconv.Atoi(segs[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid bps %s", segs[2])
+		}
+		input.Budgets = append(input.Budgets, computeapi.HostIoQosBudget{Project: segs[0], Iops: iops, Bps: bps})
+	}
+	return jsonutils.Marshal(input), nil
+}
+
 type HostAutoMigrateOnHostDownOptions struct {
 	options.BaseIdsOptions
 	AutoMigrateOnHostDown     string `help:"Auto migrate on host down" choices:"enable|disable" default:"disable"`
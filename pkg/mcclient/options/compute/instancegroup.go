@@ -15,6 +15,9 @@
 package compute
 
 import (
+	"strconv"
+	"strings"
+
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/pkg/errors"
 
@@ -50,6 +53,8 @@ type InstanceGroupCreateOptions struct {
 	SchedStrategy   string `help:"scheduler strategy"`
 	Granularity     string `help:"the upper limit number of guests with this group in a host"`
 	ForceDispersion bool   `help:"force to make guest dispersion"`
+
+	SpreadConstraint []string `help:"topology spread constraint, e.g. topology_key=schedtag:rack,max_skew=1,when_unsatisfiable=schedule_anyway" json:"-"`
 }
 
 func (opts *InstanceGroupCreateOptions) Params() (jsonutils.JSONObject, error) {
@@ -57,6 +62,13 @@ func (opts *InstanceGroupCreateOptions) Params() (jsonutils.JSONObject, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "StructToParams")
 	}
+	if len(opts.SpreadConstraint) > 0 {
+		constraints, err := parseGroupSpreadConstraints(opts.SpreadConstraint)
+		if err != nil {
+			return nil, err
+		}
+		params.Set("spread_constraints", jsonutils.Marshal(constraints))
+	}
 	return params, nil
 }
 
@@ -66,6 +78,8 @@ type InstanceGroupUpdateOptions struct {
 	Name            string `help:"New name to change"`
 	Granularity     string `help:"the upper limit number of guests with this group in a host"`
 	ForceDispersion string `help:"force to make guest dispersion" choices:"yes|no" json:"-"`
+
+	SpreadConstraint []string `help:"topology spread constraint, e.g. topology_key=zone,max_skew=1" json:"-"`
 }
 
 func (opts *InstanceGroupUpdateOptions) Params() (jsonutils.JSONObject, error) {
@@ -78,9 +92,45 @@ func (opts *InstanceGroupUpdateOptions) Params() (jsonutils.JSONObject, error) {
 	} else {
 		params.Set("force_dispersion", jsonutils.JSONFalse)
 	}
+	if len(opts.SpreadConstraint) > 0 {
+		constraints, err := parseGroupSpreadConstraints(opts.SpreadConstraint)
+		if err != nil {
+			return nil, err
+		}
+		params.Set("spread_constraints", jsonutils.Marshal(constraints))
+	}
 	return params, nil
 }
 
+func parseGroupSpreadConstraints(descs []string) (api.GroupSpreadConstraints, error) {
+	constraints := api.GroupSpreadConstraints{}
+	for _, desc := range descs {
+		constraint := api.GroupSpreadConstraint{}
+		for _, kv := range strings.Split(desc, ",") {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 {
+				return nil, errors.Errorf("invalid spread constraint %q", desc)
+			}
+			switch parts[0] {
+			case "topology_key":
+				constraint.TopologyKey = parts[1]
+			case "max_skew":
+				skew, err := strconv.Atoi(parts[1])
+				if err != nil {
+					return nil, errors.Wrapf(err, "invalid max_skew %q", parts[1])
+				}
+				constraint.MaxSkew = skew
+			case "when_unsatisfiable":
+				constraint.WhenUnsatisfiable = parts[1]
+			default:
+				return nil, errors.Errorf("unknown spread constraint key %q", parts[0])
+			}
+		}
+		constraints = append(constraints, constraint)
+	}
+	return constraints, nil
+}
+
 type InstanceGroupBindGuestsOptions struct {
 	options.BaseIdOptions
 	Guest []string `help:"ID or Name of Guest"`
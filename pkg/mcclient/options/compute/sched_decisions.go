@@ -0,0 +1,46 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compute
+
+import (
+	"yunion.io/x/jsonutils"
+
+	"yunion.io/x/onecloud/pkg/mcclient/options"
+)
+
+type SchedDecisionListOptions struct {
+	options.BaseListOptions
+
+	SessionId []string `help:"filter by schedule session id"`
+	Status    []string `help:"filter by schedule result" choices:"success|failed"`
+	Server    string   `help:"filter by server id or name" json:"server_id"`
+	Host      string   `help:"filter by selected host id" json:"host_id"`
+}
+
+func (opts *SchedDecisionListOptions) Params() (jsonutils.JSONObject, error) {
+	return options.ListStructToParams(opts)
+}
+
+type SchedDecisionIdOptions struct {
+	ID string `help:"ID of the sched decision to show"`
+}
+
+func (opts *SchedDecisionIdOptions) GetId() string {
+	return opts.ID
+}
+
+func (opts *SchedDecisionIdOptions) Params() (jsonutils.JSONObject, error) {
+	return nil, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compute
+
+import (
+	"yunion.io/x/jsonutils"
+
+	"yunion.io/x/onecloud/pkg/mcclient/options"
+)
+
+type SchedPriorityClassListOptions struct {
+	options.BaseListOptions
+
+	PreemptionPolicy []string `help:"filter by preemption policy" choices:"never|preempt_lower_priority"`
+	Project          string   `help:"filter by the project taking the class as default" json:"project_id"`
+}
+
+func (opts *SchedPriorityClassListOptions) Params() (jsonutils.JSONObject, error) {
+	return options.ListStructToParams(opts)
+}
+
+type SchedPriorityClassCreateOptions struct {
+	NAME string `help:"name of the priority class"`
+
+	Value            int      `help:"priority value, the larger the higher"`
+	PreemptionPolicy string   `help:"preemption policy" choices:"never|preempt_lower_priority"`
+	VictimAction     string   `help:"action on the preempted guests" choices:"stop|migrate"`
+	Project          []string `help:"projects taking this class as default" json:"projects"`
+	Desc             string   `help:"description" json:"description"`
+}
+
+func (opts *SchedPriorityClassCreateOptions) Params() (jsonutils.JSONObject, error) {
+	return options.StructToParams(opts)
+}
+
+type SchedPriorityClassUpdateOptions struct {
+	options.BaseIdOptions
+
+	Name             string   `help:"new name"`
+	Value            *int     `help:"priority value, the larger the higher"`
+	PreemptionPolicy string   `help:"preemption policy" choices:"never|preempt_lower_priority"`
+	VictimAction     string   `help:"action on the preempted guests" choices:"stop|migrate"`
+	Project          []string `help:"projects taking this class as default" json:"projects"`
+	Desc             string   `help:"description" json:"description"`
+}
+
+func (opts *SchedPriorityClassUpdateOptions) Params() (jsonutils.JSONObject, error) {
+	return options.StructToParams(opts)
+}
+
+type SchedPreemptionListOptions struct {
+	options.BaseListOptions
+
+	Server string   `help:"filter by preemptor server id or name" json:"server_id"`
+	Host   string   `help:"filter by host id" json:"host_id"`
+	Status []string `help:"filter by status" choices:"dry_run|evicting|success|failed"`
+}
+
+func (opts *SchedPreemptionListOptions) Params() (jsonutils.JSONObject, error) {
+	return options.ListStructToParams(opts)
+}
+
+type SchedPreemptionIdOptions struct {
+	ID string `help:"ID of the sched preemption to show"`
+}
+
+func (opts *SchedPreemptionIdOptions) GetId() string {
+	return opts.ID
+}
+
+func (opts *SchedPreemptionIdOptions) Params() (jsonutils.JSONObject, error) {
+	return nil, nil
+}
@@ -94,6 +94,8 @@ type SchedtagCreateOptions struct {
 	Desc     string `help:"Description"`
 	Scope    string `help:"Resource scope" choices:"system|domain|project"`
 	Type     string `help:"Resource type" choices:"hosts|storages|networks|cloudproviders|cloudregions|zones"`
+
+	TopologyKey string `help:"Topology key of instance group spread constraint schedtag:<topology_key>"`
 }
 
 func (o SchedtagCreateOptions) Params() (jsonutils.JSONObject, error) {
@@ -111,6 +113,9 @@ func (o SchedtagCreateOptions) Params() (jsonutils.JSONObject, error) {
 	if len(o.Scope) > 0 {
 		params.Add(jsonutils.NewString(o.Scope), "scope")
 	}
+	if len(o.TopologyKey) > 0 {
+		params.Add(jsonutils.NewString(o.TopologyKey), "topology_key")
+	}
 
 	return params, nil
 }
@@ -121,6 +126,7 @@ type SchedtagUpdateOptions struct {
 	Strategy      string `help:"Policy" choices:"require|exclude|prefer|avoid"`
 	Desc          string `help:"Description"`
 	ClearStrategy bool   `help:"Clear default schedule policy"`
+	TopologyKey   string `help:"Topology key of instance group spread constraint schedtag:<topology_key>"`
 }
 
 func (o SchedtagUpdateOptions) GetId() string {
@@ -141,6 +147,9 @@ func (o SchedtagUpdateOptions) Params() (jsonutils.JSONObject, error) {
 	if o.ClearStrategy {
 		params.Add(jsonutils.NewString(""), "default_strategy")
 	}
+	if len(o.TopologyKey) > 0 {
+		params.Add(jsonutils.NewString(o.TopologyKey), "topology_key")
+	}
 	if params.Size() == 0 {
 		return nil, fmt.Errorf("No valid data to update")
 	}
@@ -51,6 +51,8 @@ type SecgroupCreateOptions struct {
 	VpcId string
 	Tags  []string
 	Rules []string `help:"security rule to create"`
+
+	AclLog bool `help:"Log hits of all rules, only for OVN vpc"`
 }
 
 func (opts *SecgroupCreateOptions) Params() (jsonutils.JSONObject, error) {
@@ -43,6 +43,9 @@ type SecGroupRulesCreateOptions struct {
 	RULE     string `json:"-"`
 	Priority int64  `help:"priority of Rule" default:"50"`
 	Desc     string `help:"Description" json:"description"`
+	AclLog   bool   `help:"Log hits of this rule, only for OVN vpc"`
+
+	PeerSecgroupId string `help:"Match addresses of guests in peer secgroup, only for OVN vpc"`
 }
 
 func (opts *SecGroupRulesCreateOptions) Params() (jsonutils.JSONObject, error) {
@@ -50,7 +53,7 @@ func (opts *SecGroupRulesCreateOptions) Params() (jsonutils.JSONObject, error) {
 	if err != nil {
 		return nil, errors.Wrapf(err, "invalid rule %s", opts.RULE)
 	}
-	return jsonutils.Marshal(map[string]interface{}{
+	params := map[string]interface{}{
 		"direction":   rule.Direction,
 		"action":      rule.Action,
 		"protocol":    rule.Protocol,
@@ -59,7 +62,12 @@ func (opts *SecGroupRulesCreateOptions) Params() (jsonutils.JSONObject, error) {
 		"priority":    opts.Priority,
 		"description": opts.Desc,
 		"secgroup_id": opts.SECGROUP,
-	}), nil
+		"acl_log":     opts.AclLog,
+	}
+	if len(opts.PeerSecgroupId) > 0 {
+		params["peer_secgroup_id"] = opts.PeerSecgroupId
+	}
+	return jsonutils.Marshal(params), nil
 }
 
 type SecGroupRulesUpdateOptions struct {
@@ -71,6 +79,7 @@ type SecGroupRulesUpdateOptions struct {
 	Cidr     string `help:"Cidr of rule"`
 	Action   string `help:"filter Actin of rule" choices:"allow|deny"`
 	Desc     string `help:"Description" metavar:"Description"`
+	AclLog   string `help:"Log hits of this rule, only for OVN vpc" choices:"on|off"`
 }
 
 func (opts *SecGroupRulesUpdateOptions) Params() (jsonutils.JSONObject, error) {
@@ -96,5 +105,8 @@ func (opts *SecGroupRulesUpdateOptions) Params() (jsonutils.JSONObject, error) {
 	if len(opts.Action) > 0 {
 		params.Add(jsonutils.NewString(opts.Action), "action")
 	}
+	if len(opts.AclLog) > 0 {
+		params.Add(jsonutils.NewBool(opts.AclLog == "on"), "acl_log")
+	}
 	return params, nil
 }
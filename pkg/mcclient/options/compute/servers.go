@@ -278,19 +278,27 @@ type ServerCreateCommonConfig struct {
 		--disk 'snpahost_id=1ceb8c6d-6571-451d-8957-4bd3a871af85'
 	" nargs:"+"`
 	DiskSchedtag []string `help:"Disk schedtag description, e.g. '0:<tag>:<strategy>'"`
+
+	SchedAlgorithm string `help:"Schedule algorithm" choices:"default|binpack"`
+
+	PriorityClass string `help:"Schedule priority class id or name"`
+	PreemptDryRun bool   `help:"Only record the preemption plan when no host fits"`
 }
 
 func (o ServerCreateCommonConfig) Data() (*computeapi.ServerConfigs, error) {
 	data := &computeapi.ServerConfigs{
-		PreferManager: o.Manager,
-		PreferRegion:  o.Region,
-		PreferZone:    o.Zone,
-		PreferWire:    o.Wire,
-		PreferHost:    o.Host,
-		ResourceType:  o.ResourceType,
-		Count:         o.Count,
-		Networks:      make([]*computeapi.NetworkConfig, 0),
-		Disks:         make([]*computeapi.DiskConfig, 0),
+		PreferManager:   o.Manager,
+		PreferRegion:    o.Region,
+		PreferZone:      o.Zone,
+		PreferWire:      o.Wire,
+		PreferHost:      o.Host,
+		ResourceType:    o.ResourceType,
+		Count:           o.Count,
+		Networks:        make([]*computeapi.NetworkConfig, 0),
+		Disks:           make([]*computeapi.DiskConfig, 0),
+		SchedAlgorithm:  o.SchedAlgorithm,
+		PriorityClassId: o.PriorityClass,
+		PreemptDryRun:   o.PreemptDryRun,
 	}
 	for i, n := range o.Net {
 		net, err := cmdline.ParseNetworkConfig(n, i)
@@ -458,6 +466,9 @@ type ServerCreateOptionalOptions struct {
 	Vdi              string   `help:"VDI protocool" choices:"vnc|spice"`
 	Bios             string   `help:"BIOS" choices:"BIOS|UEFI"`
 	Machine          string   `help:"Machine type" choices:"pc|q35"`
+	Vtpm             bool     `help:"Attach a TPM 2.0 device emulated by swtpm"`
+	MemBalloon       bool     `help:"Attach a virtio balloon device to reclaim free memory"`
+	MemBalloonFloor  int      `help:"Memory size in MB never reclaimed by balloon"`
 	Desc             string   `help:"Description" metavar:"<DESCRIPTION>" json:"description"`
 	Boot             string   `help:"Boot device" metavar:"<BOOT_DEVICE>" choices:"disk|cdrom" json:"-"`
 	EnableCloudInit  bool     `help:"Enable cloud-init service"`
@@ -567,6 +578,9 @@ func (opts *ServerCreateOptionalOptions) OptionalParams() (*computeapi.ServerCre
 		Vdi:                opts.Vdi,
 		Bios:               opts.Bios,
 		Machine:            opts.Machine,
+		Vtpm:               opts.Vtpm,
+		MemBalloon:         opts.MemBalloon,
+		MemBalloonFloor:    opts.MemBalloonFloor,
 		ShutdownBehavior:   opts.ShutdownBehavior,
 		AutoStart:          opts.AutoStart,
 		Duration:           opts.Duration,
@@ -698,6 +712,10 @@ type ServerUpdateOptions struct {
 	Machine          string `help:"Machine type" choices:"q35|pc"`
 
 	IsDaemon *bool `help:"Daemon server" negative:"no-daemon"`
+	Vtpm     *bool `help:"Attach a TPM 2.0 device emulated by swtpm" negative:"no-vtpm"`
+
+	MemBalloon      *bool `help:"Attach a virtio balloon device" negative:"no-mem-balloon"`
+	MemBalloonFloor *int  `help:"Memory size in MB never reclaimed by balloon"`
 
 	PendingDeletedAt string `help:"change pending deleted time"`
 
@@ -1210,6 +1228,48 @@ func (o *ServerLiveMigrateOptions) Params() (jsonutils.JSONObject, error) {
 	return options.StructToParams(o)
 }
 
+type ServerRelocateOptions struct {
+	ID           string   `help:"ID of server" json:"-"`
+	TargetRegion string   `help:"Target region id or name" required:"true"`
+	TargetZone   string   `help:"Target zone id or name"`
+	PreferHost   string   `help:"Target host id or name"`
+	Net          []string `help:"Target network of each nic, format: <index>:<network>[:<address>]" required:"true"`
+	MaxDowntime  int      `help:"Max allowed downtime in seconds"`
+}
+
+func (o *ServerRelocateOptions) GetId() string {
+	return o.ID
+}
+
+func (o *ServerRelocateOptions) Params() (jsonutils.JSONObject, error) {
+	input := computeapi.ServerRelocateInput{
+		TargetRegion:       o.TargetRegion,
+		TargetZone:         o.TargetZone,
+		PreferHost:         o.PreferHost,
+		MaxDowntimeSeconds: o.MaxDowntime,
+	}
+	for _, n := range o.Net {
+		parts := strings.Split(n, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("invalid net %q, expect <index>:<network>[:<address>]", n)
+		}
+		idx, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid nic index %q", parts[0])
+		}
+		net := computeapi.ServerRelocateNetworkInput{Index: idx, Network: parts[1]}
+		if len(parts) == 3 {
+			net.Address = parts[2]
+		}
+		input.Networks = append(input.Networks, net)
+	}
+	return jsonutils.Marshal(input), nil
+}
+
+func (o *ServerRelocateOptions) Description() string {
+	return "Relocate server into another region"
+}
+
 type ServerSetLiveMigrateParamsOptions struct {
 	ID              string `help:"ID of server" json:"-"`
 	MaxBandwidthMB  *int64 `help:"live migrate downtime, unit MB"`
@@ -1314,6 +1374,9 @@ type ServerIoThrottle struct {
 
 	DiskBps  map[string]int `help:"disk bps of throttle, input diskId=BPS" json:"bps"`
 	DiskIOPS map[string]int `help:"disk iops of throttle, input diskId=IOPS" json:"iops"`
+
+	DiskBpsMin  map[string]int `help:"disk bps kept under host io contention, input diskId=BPS" json:"bps_min"`
+	DiskIOPSMin map[string]int `help:"disk iops kept under host io contention, input diskId=IOPS" json:"iops_min"`
 }
 
 func (o *ServerIoThrottle) Params() (jsonutils.JSONObject, error) {
@@ -1499,6 +1562,15 @@ func (o *ServerVncOptions) Params() (jsonutils.JSONObject, error) {
 	return jsonutils.Marshal(o), nil
 }
 
+type ServerSchedDecisionsOptions struct {
+	ServerIdOptions
+	Limit *int `help:"max number of decisions to show, default 10"`
+}
+
+func (o *ServerSchedDecisionsOptions) Params() (jsonutils.JSONObject, error) {
+	return jsonutils.Marshal(o), nil
+}
+
 type ServerIsoOptions struct {
 	ServerIdOptions
 	Ordinal int `help:"server iso ordinal, default 0"`
@@ -1537,3 +1609,26 @@ type ServerSetOSInfoOptions struct {
 func (o *ServerSetOSInfoOptions) Params() (jsonutils.JSONObject, error) {
 	return jsonutils.Marshal(o), nil
 }
+
+type ServerAttachFilesystemOptions struct {
+	ServerIdOptions
+	TAG           string `help:"Mount tag used in guest, e.g. mount -t virtiofs <tag> /mnt"`
+	SourceType    string `help:"Source of the shared directory" choices:"host_path|mount_target" default:"host_path"`
+	HostPath      string `help:"Host directory to share, admin only"`
+	MountTargetId string `help:"ID or name of NFS mount target to share"`
+	SubPath       string `help:"Sub directory of the NFS file system"`
+	ReadOnly      bool   `help:"Share as read only"`
+}
+
+func (o *ServerAttachFilesystemOptions) Params() (jsonutils.JSONObject, error) {
+	return options.StructToParams(o)
+}
+
+type ServerDetachFilesystemOptions struct {
+	ServerIdOptions
+	TAG string `help:"Mount tag of the shared directory"`
+}
+
+func (o *ServerDetachFilesystemOptions) Params() (jsonutils.JSONObject, error) {
+	return options.StructToParams(o)
+}
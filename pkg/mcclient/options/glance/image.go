@@ -36,6 +36,7 @@ type ImageListOptions struct {
 	OsArchPreciseMatch       bool     `help:"OS arch precise match"`
 	Distribution             []string `help:"Distribution filter, e.g. 'CentOS, Ubuntu, Debian, Windows'"`
 	DistributionPreciseMatch bool     `help:"Distribution precise match"`
+	SignatureStatus          []string `help:"Signature verification status" choices:"unsigned|verified|untrusted|invalid"`
 }
 
 func (o *ImageListOptions) Params() (jsonutils.JSONObject, error) {
@@ -89,6 +90,9 @@ func (o *ImageListOptions) Params() (jsonutils.JSONObject, error) {
 	if o.DistributionPreciseMatch {
 		params.Add(jsonutils.JSONTrue, "distribution_precise_match")
 	}
+	if len(o.SignatureStatus) > 0 {
+		params.Add(jsonutils.NewStringArray(o.SignatureStatus), "signature_status")
+	}
 	return params, nil
 }
 
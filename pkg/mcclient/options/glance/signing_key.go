@@ -0,0 +1,67 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glance
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"yunion.io/x/jsonutils"
+
+	"yunion.io/x/onecloud/pkg/mcclient/options"
+)
+
+type ImageSigningKeyListOptions struct {
+	options.BaseListOptions
+
+	Algorithm   []string `help:"filter by signing algorithm" choices:"ed25519|x509"`
+	Fingerprint []string `help:"filter by public key fingerprint"`
+}
+
+func (opts *ImageSigningKeyListOptions) Params() (jsonutils.JSONObject, error) {
+	return options.ListStructToParams(opts)
+}
+
+type ImageSigningKeyCreateOptions struct {
+	options.EnabledStatusCreateOptions
+
+	ALGORITHM string `help:"signing algorithm" choices:"ed25519|x509"`
+	PUBLICKEY string `help:"path to PEM encoded ed25519 public key or x509 certificate" json:"-" metavar:"PUBLIC_KEY_FILE"`
+}
+
+func (opts *ImageSigningKeyCreateOptions) Params() (jsonutils.JSONObject, error) {
+	params, err := options.StructToParams(opts)
+	if err != nil {
+		return nil, err
+	}
+	pem, err := ioutil.ReadFile(opts.PUBLICKEY)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %s", opts.PUBLICKEY, err)
+	}
+	params.Set("public_key", jsonutils.NewString(string(pem)))
+	return params, nil
+}
+
+type ImageSigningKeyIdOptions struct {
+	ID string `help:"ID or name of signing key"`
+}
+
+func (opts *ImageSigningKeyIdOptions) GetId() string {
+	return opts.ID
+}
+
+func (opts *ImageSigningKeyIdOptions) Params() (jsonutils.JSONObject, error) {
+	return nil, nil
+}
@@ -0,0 +1,200 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicates
+
+import (
+	"context"
+	"fmt"
+
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/sets"
+
+	computemodels "yunion.io/x/onecloud/pkg/compute/models"
+	"yunion.io/x/onecloud/pkg/scheduler/core"
+)
+
+// sCapacityHold is the unused part of a reservation and the free resources
+// of its host pool
+type sCapacityHold struct {
+	name  string
+	hosts sets.String
+	model string
+
+	// unused reserved amount
+	cpu     int64
+	mem     int64
+	storage int64
+	devs    int64
+
+	// free amount of the pool
+	freeCpu     int64
+	freeMem     int64
+	freeStorage int64
+	freeDevs    int64
+
+	// free amount of each pool host, cpu, memory, storage and devices
+	hostFree map[string][4]int64
+}
+
+// CapacityReservationPredicate keeps the unused capacity of the active
+// reservations from the guests of other projects, the owner project of a
+// reservation is not restricted by it
+type CapacityReservationPredicate struct {
+	BasePredicate
+
+	holds []*sCapacityHold
+}
+
+func (p *CapacityReservationPredicate) Name() string {
+	return "capacity_reservation"
+}
+
+func (p *CapacityReservationPredicate) Clone() core.FitPredicate {
+	return &CapacityReservationPredicate{}
+}
+
+func positive(v int) int64 {
+	if v < 0 {
+		return 0
+	}
+	return int64(v)
+}
+
+func (p *CapacityReservationPredicate) PreExecute(ctx context.Context, u *core.Unit, cs []core.Candidater) (bool, error) {
+	d := u.SchedData()
+	reservations, err := computemodels.CapacityReservationManager.FetchActiveReservations()
+	if err != nil {
+		return false, errors.Wrap(err, "FetchActiveReservations")
+	}
+	for i := range reservations {
+		r := &reservations[i]
+		if r.ProjectId == d.Project {
+			continue
+		}
+		usage, err := r.GetUsage()
+		if err != nil {
+			return false, errors.Wrapf(err, "GetUsage of reservation %s", r.Name)
+		}
+		hold := &sCapacityHold{
+			name:    r.Name,
+			model:   r.DevModel,
+			cpu:     positive(r.CpuCount - usage.UsedCpuCount),
+			mem:     positive(r.MemSize - usage.UsedMemSize),
+			storage: positive(r.StorageSize - usage.UsedStorageSize),
+			devs:    positive(r.IsolatedDeviceCount - usage.UsedIsolatedDeviceCount),
+		}
+		if hold.cpu+hold.mem+hold.storage+hold.devs == 0 {
+			continue
+		}
+		hostIds, err := r.GetPoolHostIds()
+		if err != nil {
+			return false, errors.Wrapf(err, "GetPoolHostIds of reservation %s", r.Name)
+		}
+		hold.hosts = sets.NewString(hostIds...)
+		hold.hostFree = make(map[string][4]int64)
+		p.holds = append(p.holds, hold)
+	}
+	if len(p.holds) == 0 {
+		return false, nil
+	}
+	for _, c := range cs {
+		getter := c.Getter()
+		for _, hold := range p.holds {
+			if !hold.hosts.Has(c.IndexKey()) {
+				continue
+			}
+			free := [4]int64{getter.FreeCPUCount(false), getter.FreeMemorySize(false), 0, 0}
+			for _, s := range getter.Storages() {
+				if s.IsLocal() {
+					free[2] += s.FreeCapacity
+				}
+			}
+			if len(hold.model) > 0 {
+				free[3] = int64(len(getter.UnusedIsolatedDevicesByModel(hold.model)))
+			} else {
+				free[3] = int64(len(getter.UnusedIsolatedDevices()))
+			}
+			hold.hostFree[c.IndexKey()] = free
+			hold.freeCpu += free[0]
+			hold.freeMem += free[1]
+			hold.freeStorage += free[2]
+			hold.freeDevs += free[3]
+		}
+	}
+	return true, nil
+}
+
+// allowedCount returns how many guests a pool host is able to take without
+// eating into the reserved amount, the reserved amount is split across the
+// pool hosts in proportion to their free amount so that the allowance of
+// all the hosts sums up to no more than the allowance of the pool
+func allowedCount(hostFree, poolFree, reserved, req int64) (int64, bool) {
+	if reserved <= 0 || req <= 0 {
+		return 0, false
+	}
+	if poolFree < reserved || hostFree <= 0 {
+		return 0, true
+	}
+	// ceil of the host share so the flooring never grants extra guests
+	hostReserved := (reserved*hostFree + poolFree - 1) / poolFree
+	if hostFree < hostReserved {
+		return 0, true
+	}
+	return (hostFree - hostReserved) / req, true
+}
+
+func (p *CapacityReservationPredicate) Execute(ctx context.Context, u *core.Unit, c core.Candidater) (bool, []core.PredicateFailureReason, error) {
+	h := NewPredicateHelper(p, u, c)
+	d := u.SchedData()
+
+	var diskSize int64
+	for _, disk := range d.Disks {
+		diskSize += int64(disk.SizeMb)
+	}
+
+	capacity := int64(-1)
+	for _, hold := range p.holds {
+		if !hold.hosts.Has(c.IndexKey()) {
+			continue
+		}
+		var devCount int64
+		for _, dev := range d.IsolatedDevices {
+			if len(hold.model) == 0 || dev.Model == hold.model {
+				devCount += 1
+			}
+		}
+		hostFree := hold.hostFree[c.IndexKey()]
+		for _, req := range [][4]int64{
+			{hostFree[0], hold.freeCpu, hold.cpu, int64(d.Ncpu)},
+			{hostFree[1], hold.freeMem, hold.mem, int64(d.Memory)},
+			{hostFree[2], hold.freeStorage, hold.storage, diskSize},
+			{hostFree[3], hold.freeDevs, hold.devs, devCount},
+		} {
+			cnt, limited := allowedCount(req[0], req[1], req[2], req[3])
+			if limited && (capacity < 0 || cnt < capacity) {
+				capacity = cnt
+			}
+		}
+		if capacity == 0 {
+			h.Exclude(fmt.Sprintf("capacity of host %s is reserved by %s", c.Getter().Name(), hold.name))
+			return h.GetResult()
+		}
+	}
+	if capacity > 0 {
+		h.SetCapacity(capacity)
+	}
+
+	return h.GetResult()
+}
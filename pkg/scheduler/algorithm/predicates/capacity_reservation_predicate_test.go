@@ -0,0 +1,248 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicates
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"yunion.io/x/pkg/util/sets"
+
+	"yunion.io/x/onecloud/pkg/apis/compute"
+	apisdu "yunion.io/x/onecloud/pkg/apis/scheduler"
+	"yunion.io/x/onecloud/pkg/scheduler/api"
+	"yunion.io/x/onecloud/pkg/scheduler/core"
+	"yunion.io/x/onecloud/pkg/scheduler/test/mock"
+)
+
+func TestAllowedCount(t *testing.T) {
+	cases := []struct {
+		name                              string
+		hostFree, poolFree, reserved, req int64
+		want                              int64
+		wantLimited                       bool
+	}{
+		{
+			name:     "nothing reserved",
+			hostFree: 16, poolFree: 32, reserved: 0, req: 2,
+		},
+		{
+			name:     "nothing requested",
+			hostFree: 16, poolFree: 32, reserved: 8, req: 0,
+		},
+		{
+			// 16 cpus reserved, 8 of them consumed by the owner
+			name:     "partially consumed reservation",
+			hostFree: 16, poolFree: 24, reserved: 8, req: 2,
+			want: 5, wantLimited: true,
+		},
+		{
+			name:     "share of the smaller host",
+			hostFree: 8, poolFree: 24, reserved: 8, req: 2,
+			want: 2, wantLimited: true,
+		},
+		{
+			name:     "share rounded up",
+			hostFree: 10, poolFree: 30, reserved: 10, req: 1,
+			want: 6, wantLimited: true,
+		},
+		{
+			name:     "single host pool",
+			hostFree: 16, poolFree: 16, reserved: 8, req: 4,
+			want: 2, wantLimited: true,
+		},
+		{
+			name:     "fully reserved pool",
+			hostFree: 16, poolFree: 24, reserved: 24, req: 1,
+			want: 0, wantLimited: true,
+		},
+		{
+			name:     "pool short of reserved",
+			hostFree: 16, poolFree: 20, reserved: 24, req: 1,
+			want: 0, wantLimited: true,
+		},
+		{
+			name:     "host without free",
+			hostFree: 0, poolFree: 24, reserved: 8, req: 1,
+			want: 0, wantLimited: true,
+		},
+		{
+			name:     "request larger than the host allowance",
+			hostFree: 16, poolFree: 24, reserved: 8, req: 12,
+			want: 0, wantLimited: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, limited := allowedCount(c.hostFree, c.poolFree, c.reserved, c.req)
+			if got != c.want || limited != c.wantLimited {
+				t.Errorf("want %d %v, got %d %v", c.want, c.wantLimited, got, limited)
+			}
+		})
+	}
+
+	// the allowance of the pool hosts never eats into the reserved amount
+	hostFrees := []int64{7, 11, 13}
+	for reserved := int64(1); reserved <= 31; reserved++ {
+		var total int64
+		for _, hostFree := range hostFrees {
+			cnt, _ := allowedCount(hostFree, 31, reserved, 1)
+			total += cnt
+		}
+		if total > 31-reserved {
+			t.Errorf("reserved %d: pool hosts allow %d guests over %d", reserved, total, 31-reserved)
+		}
+	}
+}
+
+func newCapacityReservationTestUnit(ncpu, memory int, devs ...string) *core.Unit {
+	isolatedDevices := make([]*compute.IsolatedDeviceConfig, 0, len(devs))
+	for _, model := range devs {
+		isolatedDevices = append(isolatedDevices, &compute.IsolatedDeviceConfig{Model: model})
+	}
+	info := &api.SchedInfo{
+		ScheduleInput: &apisdu.ScheduleInput{
+			ServerConfig: apisdu.ServerConfig{
+				ServerConfigs: &compute.ServerConfigs{
+					Disks:           []*compute.DiskConfig{{SizeMb: 10240}},
+					IsolatedDevices: isolatedDevices,
+				},
+				Ncpu:    ncpu,
+				Memory:  memory,
+				Project: "other-project",
+			},
+		},
+	}
+	return core.NewScheduleUnit(info, nil)
+}
+
+func newCapacityReservationTestCandidate(ctrl *gomock.Controller, id string) core.Candidater {
+	getter := mock.NewMockCandidatePropertyGetter(ctrl)
+	getter.EXPECT().Name().Return(id).AnyTimes()
+	c := mock.NewMockCandidater(ctrl)
+	c.EXPECT().IndexKey().Return(id).AnyTimes()
+	c.EXPECT().Getter().Return(getter).AnyTimes()
+	return c
+}
+
+func TestCapacityReservationPredicateExecute(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// 16 of the 24 reserved cpus are consumed, the free cpus of the pool
+	// are 16 on h1 and 8 on h2
+	cpuHold := func() *sCapacityHold {
+		return &sCapacityHold{
+			name:    "cpu",
+			hosts:   sets.NewString("h1", "h2"),
+			cpu:     8,
+			freeCpu: 24,
+			freeMem: 98304,
+			hostFree: map[string][4]int64{
+				"h1": {16, 65536, 0, 0},
+				"h2": {8, 32768, 0, 0},
+			},
+		}
+	}
+	// 1 of the 2 reserved A100s is consumed, overlapping with the cpu hold on h2
+	devHold := func() *sCapacityHold {
+		return &sCapacityHold{
+			name:     "gpu",
+			hosts:    sets.NewString("h2", "h3"),
+			model:    "A100",
+			devs:     1,
+			freeDevs: 2,
+			hostFree: map[string][4]int64{
+				"h2": {8, 32768, 0, 1},
+				"h3": {32, 65536, 0, 1},
+			},
+		}
+	}
+	cases := []struct {
+		name    string
+		holds   []*sCapacityHold
+		host    string
+		unit    *core.Unit
+		want    bool
+		wantCap int64
+	}{
+		{
+			name:    "host out of the pool",
+			holds:   []*sCapacityHold{cpuHold()},
+			host:    "h4",
+			unit:    newCapacityReservationTestUnit(2, 1024),
+			want:    true,
+			wantCap: core.EmptyCapacity,
+		},
+		{
+			name:    "allowance of the larger host",
+			holds:   []*sCapacityHold{cpuHold()},
+			host:    "h1",
+			unit:    newCapacityReservationTestUnit(2, 1024),
+			want:    true,
+			wantCap: 5,
+		},
+		{
+			name:    "allowance of the smaller host",
+			holds:   []*sCapacityHold{cpuHold()},
+			host:    "h2",
+			unit:    newCapacityReservationTestUnit(2, 1024),
+			want:    true,
+			wantCap: 2,
+		},
+		{
+			name:    "request over the allowance",
+			holds:   []*sCapacityHold{cpuHold()},
+			host:    "h2",
+			unit:    newCapacityReservationTestUnit(8, 1024),
+			want:    false,
+			wantCap: 0,
+		},
+		{
+			name:    "devices of other model are not held",
+			holds:   []*sCapacityHold{cpuHold(), devHold()},
+			host:    "h2",
+			unit:    newCapacityReservationTestUnit(2, 1024, "T4"),
+			want:    true,
+			wantCap: 2,
+		},
+		{
+			name:    "overlapping reservations take the smaller allowance",
+			holds:   []*sCapacityHold{cpuHold(), devHold()},
+			host:    "h2",
+			unit:    newCapacityReservationTestUnit(2, 1024, "A100"),
+			want:    false,
+			wantCap: 0,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := &CapacityReservationPredicate{holds: c.holds}
+			candidate := newCapacityReservationTestCandidate(ctrl, c.host)
+			ok, reasons, err := p.Execute(context.Background(), c.unit, candidate)
+			if err != nil {
+				t.Fatalf("Execute: %v", err)
+			}
+			if ok != c.want {
+				t.Errorf("want %v, got %v: %v", c.want, ok, reasons)
+			}
+			if got := c.unit.GetCapacityOfName(c.host, p.Name()); got != c.wantCap {
+				t.Errorf("want capacity %d, got %d", c.wantCap, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guest
+
+import (
+	"context"
+
+	"yunion.io/x/onecloud/pkg/scheduler/algorithm/predicates"
+	"yunion.io/x/onecloud/pkg/scheduler/core"
+)
+
+// TopologySpreadPredicate filters the candidates which break the hard
+// topology spread constraints of the instance groups
+type TopologySpreadPredicate struct {
+	predicates.BasePredicate
+
+	spread *core.TopologySpread
+}
+
+func (p *TopologySpreadPredicate) Name() string {
+	return "host_topology_spread"
+}
+
+func (p *TopologySpreadPredicate) Clone() core.FitPredicate {
+	return &TopologySpreadPredicate{}
+}
+
+func (p *TopologySpreadPredicate) PreExecute(ctx context.Context, u *core.Unit, cs []core.Candidater) (bool, error) {
+	groups := u.SchedData().InstanceGroupsDetail
+	if len(groups) == 0 {
+		return false, nil
+	}
+	p.spread = u.TopologySpread(cs)
+	return p.spread.HasHardConstraints(), nil
+}
+
+func (p *TopologySpreadPredicate) Execute(ctx context.Context, u *core.Unit, c core.Candidater) (bool, []core.PredicateFailureReason, error) {
+	h := predicates.NewPredicateHelper(p, u, c)
+
+	if reason, ok := p.spread.CheckHard(c.IndexKey()); !ok {
+		h.Exclude(reason)
+	}
+
+	return h.GetResult()
+}
@@ -0,0 +1,162 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guest
+
+import (
+	"yunion.io/x/onecloud/pkg/scheduler/algorithm/priorities"
+	"yunion.io/x/onecloud/pkg/scheduler/cache/candidate"
+	"yunion.io/x/onecloud/pkg/scheduler/core"
+)
+
+const binpackMaxScore = 10
+
+// binpackScore return a score of 0-10 by the utilisation of a resource
+// after the request is placed, the fuller the host the higher the score
+func binpackScore(total, free, request int64) int {
+	if total <= 0 {
+		return 0
+	}
+	used := total - free + request
+	if used <= 0 {
+		return 0
+	}
+	if used >= total {
+		return binpackMaxScore
+	}
+	return int(used * binpackMaxScore / total)
+}
+
+// BinpackCPUPriority prefers the host with the highest cpu commit rate
+type BinpackCPUPriority struct {
+	priorities.BasePriority
+}
+
+func (p *BinpackCPUPriority) Name() string {
+	return "host_binpack_cpu"
+}
+
+func (p *BinpackCPUPriority) Clone() core.Priority {
+	return &BinpackCPUPriority{}
+}
+
+func (p *BinpackCPUPriority) Map(u *core.Unit, c core.Candidater) (core.HostPriority, error) {
+	h := priorities.NewPriorityHelper(p, u, c)
+
+	getter := c.Getter()
+	h.SetScore(binpackScore(getter.TotalCPUCount(false), getter.FreeCPUCount(false), int64(u.SchedData().Ncpu)))
+
+	return h.GetResult()
+}
+
+// BinpackMemoryPriority prefers the host with the highest memory commit rate
+type BinpackMemoryPriority struct {
+	priorities.BasePriority
+}
+
+func (p *BinpackMemoryPriority) Name() string {
+	return "host_binpack_memory"
+}
+
+func (p *BinpackMemoryPriority) Clone() core.Priority {
+	return &BinpackMemoryPriority{}
+}
+
+func (p *BinpackMemoryPriority) Map(u *core.Unit, c core.Candidater) (core.HostPriority, error) {
+	h := priorities.NewPriorityHelper(p, u, c)
+
+	getter := c.Getter()
+	h.SetScore(binpackScore(getter.TotalMemorySize(false), getter.FreeMemorySize(false), int64(u.SchedData().Memory)))
+
+	return h.GetResult()
+}
+
+// BinpackStoragePriority prefers the host whose storages matching the
+// requested disk backends are the most utilised
+type BinpackStoragePriority struct {
+	priorities.BasePriority
+}
+
+func (p *BinpackStoragePriority) Name() string {
+	return "host_binpack_storage"
+}
+
+func (p *BinpackStoragePriority) Clone() core.Priority {
+	return &BinpackStoragePriority{}
+}
+
+func (p *BinpackStoragePriority) PreExecute(u *core.Unit, cs []core.Candidater) (bool, []core.PredicateFailureReason, error) {
+	driver := u.GetHypervisorDriver()
+	if driver != nil && !driver.DoScheduleStorageFilter() {
+		return false, nil, nil
+	}
+	return len(u.SchedData().Disks) > 0, nil, nil
+}
+
+func (p *BinpackStoragePriority) Map(u *core.Unit, c core.Candidater) (core.HostPriority, error) {
+	h := priorities.NewPriorityHelper(p, u, c)
+
+	reqSizes := make(map[string]int64)
+	for _, d := range u.SchedData().Disks {
+		reqSizes[d.Backend] += int64(d.SizeMb)
+	}
+
+	var total, free, request int64
+	for backend, size := range reqSizes {
+		found := false
+		for _, s := range c.Getter().Storages() {
+			if !candidate.IsStorageBackendMediumMatch(s, backend, "") {
+				continue
+			}
+			found = true
+			total += int64(float32(s.GetCapacity()) * s.GetOvercommitBound())
+			free += s.FreeCapacity
+		}
+		if found {
+			request += size
+		}
+	}
+	h.SetScore(binpackScore(total, free, request))
+
+	return h.GetResult()
+}
+
+// BinpackIsolatedDevicePriority prefers the host with the most isolated
+// devices already in use when the request asks for isolated devices
+type BinpackIsolatedDevicePriority struct {
+	priorities.BasePriority
+}
+
+func (p *BinpackIsolatedDevicePriority) Name() string {
+	return "host_binpack_isolated_device"
+}
+
+func (p *BinpackIsolatedDevicePriority) Clone() core.Priority {
+	return &BinpackIsolatedDevicePriority{}
+}
+
+func (p *BinpackIsolatedDevicePriority) PreExecute(u *core.Unit, cs []core.Candidater) (bool, []core.PredicateFailureReason, error) {
+	return len(u.SchedData().IsolatedDevices) > 0, nil, nil
+}
+
+func (p *BinpackIsolatedDevicePriority) Map(u *core.Unit, c core.Candidater) (core.HostPriority, error) {
+	h := priorities.NewPriorityHelper(p, u, c)
+
+	getter := c.Getter()
+	total := int64(len(getter.GetIsolatedDevices()))
+	free := int64(len(getter.UnusedIsolatedDevices()))
+	h.SetScore(binpackScore(total, free, int64(len(u.SchedData().IsolatedDevices))))
+
+	return h.GetResult()
+}
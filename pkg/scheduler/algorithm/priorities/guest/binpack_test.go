@@ -0,0 +1,53 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guest
+
+import (
+	"testing"
+)
+
+func TestBinpackScore(t *testing.T) {
+	cases := []struct {
+		name    string
+		total   int64
+		free    int64
+		request int64
+		want    int
+	}{
+		{"no capacity", 0, 0, 1, 0},
+		{"empty host no request", 10, 10, 0, 0},
+		{"empty host", 10, 10, 1, 1},
+		{"half used", 10, 5, 1, 6},
+		{"becomes full", 10, 2, 2, binpackMaxScore},
+		{"overcommitted", 10, -2, 1, binpackMaxScore},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := binpackScore(c.total, c.free, c.request); got != c.want {
+				t.Errorf("want %d, got %d", c.want, got)
+			}
+		})
+	}
+
+	// the fuller host of the same size scores higher
+	var prev int
+	for free := int64(16); free >= 0; free -= 4 {
+		got := binpackScore(16, free, 1)
+		if got < prev {
+			t.Errorf("score %d of free %d is lower than %d of a less used host", got, free, prev)
+		}
+		prev = got
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guest
+
+import (
+	"yunion.io/x/onecloud/pkg/scheduler/algorithm/priorities"
+	"yunion.io/x/onecloud/pkg/scheduler/core"
+)
+
+// TopologySpreadPriority avoids the candidates which break the soft
+// topology spread constraints of the instance groups
+type TopologySpreadPriority struct {
+	priorities.BasePriority
+
+	spread *core.TopologySpread
+}
+
+func (p *TopologySpreadPriority) Name() string {
+	return "guest_topology_spread"
+}
+
+func (p *TopologySpreadPriority) Clone() core.Priority {
+	return &TopologySpreadPriority{}
+}
+
+func (p *TopologySpreadPriority) PreExecute(u *core.Unit, cs []core.Candidater) (bool, []core.PredicateFailureReason, error) {
+	if len(u.SchedData().InstanceGroupsDetail) == 0 {
+		return false, nil, nil
+	}
+	p.spread = u.TopologySpread(cs)
+	return p.spread.HasSoftConstraints(), nil, nil
+}
+
+func (p *TopologySpreadPriority) Map(u *core.Unit, c core.Candidater) (core.HostPriority, error) {
+	h := priorities.NewPriorityHelper(p, u, c)
+
+	if skew := p.spread.SoftSkew(c.IndexKey()); skew > 0 {
+		h.SetScore(-1 * skew)
+	}
+
+	return h.GetResult()
+}
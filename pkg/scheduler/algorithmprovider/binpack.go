@@ -0,0 +1,40 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package algorithmprovider
+
+import (
+	"yunion.io/x/pkg/util/sets"
+
+	priorityguest "yunion.io/x/onecloud/pkg/scheduler/algorithm/priorities/guest"
+	"yunion.io/x/onecloud/pkg/scheduler/factory"
+)
+
+func init() {
+	// BinpackProvider shares predicates with DefaultProvider, only the
+	// priorities differ: the most utilised host that still fits wins
+	factory.RegisterAlgorithmProvider(factory.BinpackProvider, defaultPredicates(), binpackPriorities())
+}
+
+func binpackPriorities() sets.String {
+	return sets.NewString(
+		factory.RegisterPriority("guest-binpack-cpu", &priorityguest.BinpackCPUPriority{}, 1),
+		factory.RegisterPriority("guest-binpack-memory", &priorityguest.BinpackMemoryPriority{}, 1),
+		factory.RegisterPriority("guest-binpack-storage", &priorityguest.BinpackStoragePriority{}, 1),
+		factory.RegisterPriority("guest-binpack-isolated-device", &priorityguest.BinpackIsolatedDevicePriority{}, 1),
+		factory.RegisterPriority("guest-creating", &priorityguest.CreatingPriority{}, 1),
+		factory.RegisterPriority("guest-cpunumapin", &priorityguest.CpuNumaPinPriority{}, 1),
+		factory.RegisterPriority("guest-topology-spread", &priorityguest.TopologySpreadPriority{}, 1),
+	)
+}
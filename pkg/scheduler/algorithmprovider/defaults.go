@@ -49,6 +49,8 @@ func defaultPredicates() sets.String {
 		factory.RegisterFitPredicate("p-CloudproviderschedtagFilter", predicates.NewCloudproviderSchedtagPredicate()),
 		factory.RegisterFitPredicate("q-CloudregionschedtagFilter", predicates.NewCloudregionSchedtagPredicate()),
 		factory.RegisterFitPredicate("r-ZoneschedtagFilter", predicates.NewZoneSchedtagPredicate()),
+		factory.RegisterFitPredicate("s-GuestTopologySpreadFilter", &predicateguest.TopologySpreadPredicate{}),
+		factory.RegisterFitPredicate("t-CapacityReservationFilter", &predicates.CapacityReservationPredicate{}),
 		factory.RegisterFitPredicate("z-QuotaFilter", &predicates.SQuotaPredicate{}),
 	)
 }
@@ -60,5 +62,6 @@ func defaultPriorities() sets.String {
 		factory.RegisterPriority("guest-creating", &priorityguest.CreatingPriority{}, 1),
 		factory.RegisterPriority("guest-capacity", &priorityguest.CapacityPriority{}, 1),
 		factory.RegisterPriority("guest-cpunumapin", &priorityguest.CpuNumaPinPriority{}, 1),
+		factory.RegisterPriority("guest-topology-spread", &priorityguest.TopologySpreadPriority{}, 1),
 	)
 }
@@ -50,6 +50,10 @@ type SchedInfo struct {
 
 	InstanceGroupsDetail map[string]*models.SGroup
 
+	// IgnorePredicates is only set internally by preemption planning, the
+	// resources checked by these predicates are released by the victims
+	IgnorePredicates map[string]bool `json:"-"`
+
 	UserCred mcclient.TokenCredential
 }
 
@@ -1316,6 +1316,19 @@ func (b *HostBuilder) fillGuestsCpuNumaPin(desc *HostDesc, host *computemodels.S
 	return b.buildHostTopo(desc, reservedCpus, int(hugepageSizeKb), nodeHugepages, hostTopo)
 }
 
+// getBalloonReclaimedFreeMem returns the part of memory reclaimed by guest
+// balloons counted as free, the balloons deflate again when the guests need
+// the memory back, so only a capped ratio of it is counted
+func getBalloonReclaimedFreeMem(reclaimedMb int, ratio float32) int64 {
+	if ratio <= 0 || reclaimedMb <= 0 {
+		return 0
+	}
+	if ratio > 1 {
+		ratio = 1
+	}
+	return int64(float32(reclaimedMb) * ratio)
+}
+
 func (b *HostBuilder) fillGuestsResourceInfo(desc *HostDesc, host *computemodels.SHost) error {
 	var (
 		guestCount          int64
@@ -1418,6 +1431,8 @@ func (b *HostBuilder) fillGuestsResourceInfo(desc *HostDesc, host *computemodels
 		}
 	}
 
+	memFreeSize += getBalloonReclaimedFreeMem(desc.MemBalloonReclaimed, o.Options.BalloonReclaimedMemoryRatio)
+
 	// free memory size calculate
 	rsvdUseMem := desc.GuestReservedResourceUsed.MemorySize
 	memFreeSize = memFreeSize + rsvdUseMem - desc.GetReservedMemSize()
@@ -19,6 +19,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"yunion.io/x/log"
 	"yunion.io/x/pkg/tristate"
@@ -406,6 +407,18 @@ type Unit struct {
 	SelectPriorityMap        map[string]SSelectPriority
 	SelectPriorityUpdaterMap map[string]SSelectPriorityUpdater
 	SelectPriorityLock       sync.Mutex
+
+	// FilteredCandidates are the candidates passed all predicates
+	FilteredCandidates []Candidater
+
+	predicateElapsed     map[string]time.Duration
+	predicateElapsedLock sync.Mutex
+
+	topologySpread     *TopologySpread
+	topologySpreadLock sync.Mutex
+
+	// priorityWeights are the weights of priorities keyed by priority name
+	priorityWeights map[string]int
 }
 
 func NewScheduleUnit(info *api.SchedInfo, schedManager interface{}) *Unit {
@@ -430,10 +443,31 @@ func NewScheduleUnit(info *api.SchedInfo, schedManager interface{}) *Unit {
 
 		SelectPriorityMap:        spmap,
 		SelectPriorityUpdaterMap: spumap,
+
+		predicateElapsed: make(map[string]time.Duration),
 	}
 	return unit
 }
 
+// AddPredicateElapsed accumulates the time spent by a predicate over all candidates
+func (u *Unit) AddPredicateElapsed(name string, elapsed time.Duration) {
+	u.predicateElapsedLock.Lock()
+	defer u.predicateElapsedLock.Unlock()
+
+	u.predicateElapsed[name] += elapsed
+}
+
+func (u *Unit) GetPredicateElapsed() map[string]time.Duration {
+	u.predicateElapsedLock.Lock()
+	defer u.predicateElapsedLock.Unlock()
+
+	ret := make(map[string]time.Duration, len(u.predicateElapsed))
+	for name, elapsed := range u.predicateElapsed {
+		ret[name] = elapsed
+	}
+	return ret
+}
+
 func (u *Unit) Info() string {
 	return u.SchedInfo.JSON(u.SchedInfo).String()
 }
@@ -635,11 +669,26 @@ func (u *Unit) setScore(id string, val score.SScore, prefer tristate.TriState) {
 		u.ScoreMap[id] = scoreObj
 	}
 
+	if weight, ok := u.priorityWeights[val.Name]; ok {
+		val.Score *= score.TScore(weight)
+	}
 	scoreObj.ScoreBucket.SetScore(val, prefer)
 
 	log.V(10).Infof("SetScore: %q -> %s, prefer: %s", id, val.String(), prefer)
 }
 
+// SetPriorityWeights makes the scores set afterwards multiplied by the
+// weight of the priority setting them
+func (u *Unit) SetPriorityWeights(priorities []PriorityConfig) {
+	u.scoreLock.Lock()
+	defer u.scoreLock.Unlock()
+
+	u.priorityWeights = make(map[string]int, len(priorities))
+	for _, p := range priorities {
+		u.priorityWeights[p.Name] = p.Weight
+	}
+}
+
 func (u *Unit) SetScore(id string, val score.SScore) {
 	u.setScore(id, val, tristate.None)
 }
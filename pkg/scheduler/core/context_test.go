@@ -0,0 +1,33 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"testing"
+
+	"yunion.io/x/onecloud/pkg/scheduler/api"
+	"yunion.io/x/onecloud/pkg/scheduler/core/score"
+)
+
+func TestUnitPriorityWeights(t *testing.T) {
+	unit := NewScheduleUnit(&api.SchedInfo{}, nil)
+	unit.SetPriorityWeights([]PriorityConfig{{Name: "host_capacity", Weight: 3}, {Name: "host_lowload", Weight: 1}})
+	unit.SetScore("host1", score.NewScore(2, "host_capacity"))
+	unit.SetScore("host1", score.NewScore(5, "host_lowload"))
+	unit.SetScore("host1", score.NewScore(1, "unweighted"))
+	if got := unit.GetScore("host1").ScoreBucket.NormalScore(); got != 2*3+5+1 {
+		t.Errorf("expect weighted score %d, got %d", 2*3+5+1, got)
+	}
+}
@@ -29,6 +29,7 @@ import (
 	utiltrace "yunion.io/x/pkg/util/trace"
 	"yunion.io/x/pkg/util/workqueue"
 
+	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
 	o "yunion.io/x/onecloud/pkg/scheduler/options"
 )
 
@@ -101,6 +102,15 @@ func NewGenericScheduler(s Scheduler) (*GenericScheduler, error) {
 	return g, nil
 }
 
+// PriorityWeights return weights of priorities keyed by priority name
+func (g *GenericScheduler) PriorityWeights() map[string]int {
+	ret := make(map[string]int, len(g.priorities))
+	for _, p := range g.priorities {
+		ret[p.Name] = p.Weight
+	}
+	return ret
+}
+
 func (g *GenericScheduler) Schedule(ctx context.Context, unit *Unit, candidates []Candidater, helper IResultHelper) (*ScheduleResult, error) {
 	startTime := time.Now()
 	defer func() {
@@ -136,6 +146,8 @@ func (g *GenericScheduler) Schedule(ctx context.Context, unit *Unit, candidates
 		return nil, err
 	}
 
+	unit.FilteredCandidates = filteredCandidates
+
 	// if there is no candidate and not from scheduler/test api will return
 	if len(filteredCandidates) == 0 && !isSuggestion {
 		return nil, &FitError{
@@ -339,6 +351,7 @@ func SelectHosts(unit *Unit, priorityList HostPriorityList) ([]*SelectedCandidat
 	count := schedData.Count
 	isSuggestion := unit.SchedInfo.IsSuggestion
 	bestEffort := unit.SchedInfo.BestEffort
+	binpack := schedData.SchedAlgorithm == computeapi.SCHED_ALGORITHM_BINPACK
 	selectedCandidates := []*SelectedCandidate{}
 
 	plugins := unit.AllSelectPlugins()
@@ -368,6 +381,11 @@ completed:
 			}
 			selectedItem.Count++
 			count--
+			// binpack fills up the host before moving on to the next one
+			for binpack && count > 0 && unit.GetCapacity(hostID) > selectedItem.Count {
+				selectedItem.Count++
+				count--
+			}
 			// if capacity of the host large than selected count, this host can be added to priorityList.
 			if unit.GetCapacity(hostID) > selectedItem.Count {
 				priorityList0 = append(priorityList0, it)
@@ -463,10 +481,15 @@ func preExecPredicate(ctx context.Context, unit *Unit, candidates []Candidater,
 	// analysor := newPredicateAnalysor("preExecPredicate")
 	// defer analysor.ShowResult()
 	for name, predicate := range predicates {
+		if unit.SchedInfo.IgnorePredicates[predicate.Name()] {
+			continue
+		}
 		// analysor.Start(name)
 		// generate new FitPredicates because of race condition?
 		newPredicate := predicate.Clone()
+		start := time.Now()
 		ok, err := newPredicate.PreExecute(ctx, unit, candidates)
+		unit.AddPredicateElapsed(newPredicate.Name(), time.Since(start))
 		// analysor.End(name, time.Now())
 		if err != nil {
 			return nil, err
@@ -542,7 +565,9 @@ func unitFitsOnCandidate(
 	for _, predicate := range predicates {
 		// n := fmt.Sprintf("%s for %s", predicate.Name(), candidate.Getter().Name())
 		// analysor.Start(n)
+		start := time.Now()
 		fit, reasons, err = predicate.Execute(ctx, unit, candidate)
+		unit.AddPredicateElapsed(predicate.Name(), time.Since(start))
 		// analysor.End(n, time.Now())
 		logs = append(logs, toLog(fit, reasons, err, predicate.Name()))
 		if err != nil {
@@ -598,6 +623,7 @@ func PrioritizeCandidates(
 	if err != nil {
 		return nil, err
 	}
+	unit.SetPriorityWeights(newPriorities)
 	// Max : 3 * len(newPriorities)
 	errsChannel := make(chan error, 3*len(newPriorities))
 	for i := range newPriorities {
@@ -651,9 +677,7 @@ func PrioritizeCandidates(
 
 	for i, candidate := range candidates {
 		result = append(result, HostPriority{Host: candidates[i].IndexKey(), Score: *newScore(), Candidate: candidates[i]})
-		//for j := range newPriorities {
-		//result[i].Score += results[j][i].Score * newPriorities[j].Weight
-		//}
+		// the scores are weighted by Unit.SetPriorityWeights when set
 		result[i].Score = unit.GetScore(candidate.IndexKey())
 	}
 	if log.V(10) {
@@ -0,0 +1,122 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"testing"
+
+	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
+	schedapi "yunion.io/x/onecloud/pkg/apis/scheduler"
+	"yunion.io/x/onecloud/pkg/scheduler/api"
+	"yunion.io/x/onecloud/pkg/scheduler/core/score"
+)
+
+// testCandidate only answers IndexKey, which is all SelectHosts needs
+type testCandidate struct {
+	Candidater
+	id string
+}
+
+func (c *testCandidate) IndexKey() string {
+	return c.id
+}
+
+func TestSelectHostsBinpack(t *testing.T) {
+	hosts := []struct {
+		id       string
+		score    int
+		capacity int64
+	}{
+		{"host-idle", 1, 4},
+		{"host-busy", 9, 2},
+		{"host-half", 5, 4},
+	}
+	cases := []struct {
+		name      string
+		algorithm string
+		count     int
+		want      map[string]int64
+	}{
+		{
+			name:      "binpack fills the most loaded host first",
+			algorithm: computeapi.SCHED_ALGORITHM_BINPACK,
+			count:     3,
+			want:      map[string]int64{"host-busy": 2, "host-half": 1},
+		},
+		{
+			name:      "binpack moves on after host is full",
+			algorithm: computeapi.SCHED_ALGORITHM_BINPACK,
+			count:     7,
+			want:      map[string]int64{"host-busy": 2, "host-half": 4, "host-idle": 1},
+		},
+		{
+			name:  "default spreads one by one",
+			count: 3,
+			want:  map[string]int64{"host-busy": 1, "host-half": 1, "host-idle": 1},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			input := &schedapi.ScheduleInput{}
+			input.ServerConfigs = &computeapi.ServerConfigs{}
+			info := &api.SchedInfo{ScheduleInput: input}
+			info.Count = c.count
+			info.SchedAlgorithm = c.algorithm
+			unit := NewScheduleUnit(info, nil)
+			priorityList := HostPriorityList{}
+			for _, h := range hosts {
+				unit.SetCapacity(h.id, "test", NewNormalCounter(h.capacity))
+				unit.SetScore(h.id, score.NewScore(score.TScore(h.score), "host_binpack_cpu"))
+				priorityList = append(priorityList, HostPriority{
+					Host:      h.id,
+					Score:     unit.GetScore(h.id),
+					Candidate: &testCandidate{id: h.id},
+				})
+			}
+			selected, err := SelectHosts(unit, priorityList)
+			if err != nil {
+				t.Fatalf("SelectHosts: %v", err)
+			}
+			got := map[string]int64{}
+			for _, sc := range selected {
+				if sc.Count > 0 {
+					got[sc.Candidate.IndexKey()] = sc.Count
+				}
+			}
+			if len(got) != len(c.want) {
+				t.Fatalf("want %v, got %v", c.want, got)
+			}
+			for id, cnt := range c.want {
+				if got[id] != cnt {
+					t.Errorf("want %v, got %v", c.want, got)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestPriorityWeights(t *testing.T) {
+	g := &GenericScheduler{
+		priorities: []PriorityConfig{
+			{Name: "host-memory", Weight: 2},
+			{Name: "host-cpu", Weight: 1},
+		},
+	}
+	weights := g.PriorityWeights()
+	if len(weights) != 2 || weights["host-memory"] != 2 || weights["host-cpu"] != 1 {
+		t.Errorf("unexpected priority weights %v", weights)
+	}
+}
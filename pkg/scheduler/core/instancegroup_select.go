@@ -34,10 +34,27 @@ func transToInstanceGroupSchedResult(result *SchedResultItemList, schedInfo *api
 	}
 	guestInfos, backGuestInfos, groups := generateGuestInfo(schedInfo)
 	hosts := buildHosts(result, groups)
+	var ts *TopologySpread
+	if result.Unit != nil && hasSpreadConstraints(schedInfo.InstanceGroupsDetail) {
+		cs := make([]Candidater, 0, len(result.Data))
+		for _, item := range result.Data {
+			cs = append(cs, item.Candidater)
+		}
+		ts = result.Unit.TopologySpread(cs)
+	}
 	if len(backGuestInfos) > 0 {
-		return getBackupSchedResult(hosts, guestInfos, backGuestInfos, schedInfo.SessionId)
+		return getBackupSchedResult(hosts, guestInfos, backGuestInfos, schedInfo.SessionId, ts)
+	}
+	return getSchedResult(hosts, guestInfos, schedInfo.SessionId, ts)
+}
+
+func hasSpreadConstraints(groups map[string]*models.SGroup) bool {
+	for _, group := range groups {
+		if group != nil && len(group.SpreadConstraints) > 0 {
+			return true
+		}
 	}
-	return getSchedResult(hosts, guestInfos, schedInfo.SessionId)
+	return false
 }
 
 type sGuestInfo struct {
@@ -212,22 +229,22 @@ func hostsIndex(hostId string, hosts []*sSchedResultItem) int {
 }
 
 // getBackupSchedResult return the ScheduleOutput for guest without backup
-func getSchedResult(hosts []*sSchedResultItem, guestInfos []sGuestInfo, sid string) *schedapi.ScheduleOutput {
+func getSchedResult(hosts []*sSchedResultItem, guestInfos []sGuestInfo, sid string, ts *TopologySpread) *schedapi.ScheduleOutput {
 	apiResults := make([]*schedapi.CandidateResource, 0)
 	storageUsed :=
 		NewStorageUsed()
 	var i int = 0
 	for ; i < len(guestInfos); i++ {
-		host := selectHost(hosts, guestInfos[i], nil, true)
+		host := selectHost(hosts, guestInfos[i], nil, true, ts)
 		if host == nil {
-			host = selectHost(hosts, guestInfos[i], nil, false)
+			host = selectHost(hosts, guestInfos[i], nil, false, ts)
 			if host == nil {
 				er := &schedapi.CandidateResource{Error: fmt.Sprintf("no suitable Host for No.%d Guest", i+1)}
 				apiResults = append(apiResults, er)
 				break
 			}
 		}
-		markHostUsed(host, guestInfos[i], nil)
+		markHostUsed(host, guestInfos[i], nil, ts)
 		tr := host.ToCandidateResource(storageUsed)
 		tr.SessionId = sid
 		apiResults = append(apiResults, tr)
@@ -242,7 +259,7 @@ func getSchedResult(hosts []*sSchedResultItem, guestInfos []sGuestInfo, sid stri
 }
 
 // getBackupSchedResult return the ScheduleOutput for guest with backup
-func getBackupSchedResult(hosts []*sSchedResultItem, guestInfos, backGuestInfos []sGuestInfo, sid string) *schedapi.ScheduleOutput {
+func getBackupSchedResult(hosts []*sSchedResultItem, guestInfos, backGuestInfos []sGuestInfo, sid string, ts *TopologySpread) *schedapi.ScheduleOutput {
 	wireHostMap := buildWireHosts(hosts)
 	apiResults := make([]*schedapi.CandidateResource, 0, len(guestInfos))
 	nowireIds := sets.NewString()
@@ -254,23 +271,23 @@ func getBackupSchedResult(hosts []*sSchedResultItem, guestInfos, backGuestInfos
 			if nowireIds.Has(wireid) {
 				continue
 			}
-			masterItem := selectHost(hosts, guestInfos[i], &isMaster, true)
+			masterItem := selectHost(hosts, guestInfos[i], &isMaster, true, ts)
 			if masterItem == nil {
-				masterItem = selectHost(hosts, guestInfos[i], &isMaster, false)
+				masterItem = selectHost(hosts, guestInfos[i], &isMaster, false, ts)
 				if masterItem == nil {
 					nowireIds.Insert(wireid)
 					continue
 				}
 			}
 			// mark master used for now
-			markHostUsed(masterItem, guestInfos[i], &isMaster)
-			backupItem := selectHost(hosts, backGuestInfos[i], &isBackup, false)
+			markHostUsed(masterItem, guestInfos[i], &isMaster, ts)
+			backupItem := selectHost(hosts, backGuestInfos[i], &isBackup, false, nil)
 			if backupItem == nil {
 				nowireIds.Insert(wireid)
-				unMarkHostUsed(masterItem, guestInfos[i], &isMaster)
+				unMarkHostUsed(masterItem, guestInfos[i], &isMaster, ts)
 				continue
 			}
-			markHostUsed(backupItem, backGuestInfos[i], &isBackup)
+			markHostUsed(backupItem, backGuestInfos[i], &isBackup, nil)
 			canRe := masterItem.ToCandidateResource(storageUsed)
 			canRe.BackupCandidate = backupItem.ToCandidateResource(storageUsed)
 			canRe.SessionId = sid
@@ -289,10 +306,13 @@ func getBackupSchedResult(hosts []*sSchedResultItem, guestInfos, backGuestInfos
 	return ret
 }
 
-func markHostUsed(host *sSchedResultItem, guestInfo sGuestInfo, isBackup *bool) {
+func markHostUsed(host *sSchedResultItem, guestInfo sGuestInfo, isBackup *bool, ts *TopologySpread) {
 	for gid := range guestInfo.instanceGroupsDetail {
 		host.instanceGroupCapacity[gid] = host.instanceGroupCapacity[gid] - 1
 	}
+	if ts != nil {
+		ts.Place(host.ID, 1)
+	}
 	host.Capacity--
 	host.Count++
 	if isBackup == nil {
@@ -306,10 +326,13 @@ func markHostUsed(host *sSchedResultItem, guestInfo sGuestInfo, isBackup *bool)
 }
 
 // unMarkHostUsed is the reverse operation of markHostUsed
-func unMarkHostUsed(host *sSchedResultItem, guestInfo sGuestInfo, isBackup *bool) {
+func unMarkHostUsed(host *sSchedResultItem, guestInfo sGuestInfo, isBackup *bool, ts *TopologySpread) {
 	for gid := range guestInfo.instanceGroupsDetail {
 		host.instanceGroupCapacity[gid] = host.instanceGroupCapacity[gid] + 1
 	}
+	if ts != nil {
+		ts.Place(host.ID, -1)
+	}
 	host.Capacity++
 	host.Count--
 	if isBackup == nil {
@@ -325,7 +348,8 @@ func unMarkHostUsed(host *sSchedResultItem, guestInfo sGuestInfo, isBackup *bool
 // selectHost select host from hosts for guest described by guestInfo.
 // If forced is true, all instanceGroups will be forced.
 // Otherwise, the instanceGroups with ForceDispersion 'false' will be unforced.
-func selectHost(hosts []*sSchedResultItem, guestInfo sGuestInfo, isBackup *bool, forced bool) *sSchedResultItem {
+// The hard topology spread constraints tracked by ts are always forced.
+func selectHost(hosts []*sSchedResultItem, guestInfo sGuestInfo, isBackup *bool, forced bool, ts *TopologySpread) *sSchedResultItem {
 	sortHosts(hosts, &guestInfo, isBackup)
 	var idx = -1
 	if len(guestInfo.preferHost) > 0 {
@@ -350,6 +374,11 @@ Loop:
 				continue Loop
 			}
 		}
+		if ts != nil {
+			if _, ok := ts.CheckHard(host.ID); !ok {
+				continue
+			}
+		}
 		idx = i
 		choosed = true
 		break
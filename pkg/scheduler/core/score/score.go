@@ -17,6 +17,7 @@ package score
 import (
 	"fmt"
 	"math"
+	"sort"
 	"strings"
 
 	"yunion.io/x/pkg/tristate"
@@ -116,6 +117,35 @@ func (b *ScoreBucket) NormalScore() int {
 	return b.normalScore.Total()
 }
 
+type SScoreDetail struct {
+	Name  string
+	Kind  string
+	Score int
+}
+
+// Details return every score set in the bucket, sorted by kind and name
+func (b *ScoreBucket) Details() []SScoreDetail {
+	ret := make([]SScoreDetail, 0)
+	for _, kind := range []struct {
+		name string
+		vals scores
+	}{
+		{"prefer", b.preferScore},
+		{"avoid", b.avoidScore},
+		{"normal", b.normalScore},
+	} {
+		names := make([]string, 0, len(kind.vals))
+		for name := range kind.vals {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			ret = append(ret, SScoreDetail{Name: name, Kind: kind.name, Score: kind.vals[name]})
+		}
+	}
+	return ret
+}
+
 func (b *ScoreBucket) debugString(kind string, vals map[string]int) string {
 	return fmt.Sprintf("%s: %v", kind, vals)
 }
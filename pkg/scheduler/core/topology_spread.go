@@ -0,0 +1,231 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/compute/models"
+	"yunion.io/x/onecloud/pkg/scheduler/data_manager/schedtag"
+)
+
+type sTopologySpreadConstraint struct {
+	computeapi.GroupSpreadConstraint
+
+	groupId string
+	// domains is the topology domain of each candidate, candidate without
+	// the topology key is not in any domain
+	domains map[string]string
+	// counts is the guest count of the group in each domain
+	counts map[string]int
+}
+
+func (c *sTopologySpreadConstraint) minCount() int {
+	min := -1
+	for _, cnt := range c.counts {
+		if min < 0 || cnt < min {
+			min = cnt
+		}
+	}
+	if min < 0 {
+		return 0
+	}
+	return min
+}
+
+// skew returns the skew of the domain after one more guest placed on candidate
+func (c *sTopologySpreadConstraint) skew(candidateId string) (string, int, bool) {
+	domain, ok := c.domains[candidateId]
+	if !ok {
+		return "", 0, false
+	}
+	return domain, c.counts[domain] + 1 - c.minCount(), true
+}
+
+func (c *sTopologySpreadConstraint) String() string {
+	return fmt.Sprintf("%s:%s", c.groupId, c.TopologyKey)
+}
+
+// TopologySpread tracks the guest count of instance groups in every topology
+// domain of the spread constraints
+type TopologySpread struct {
+	constraints []*sTopologySpreadConstraint
+}
+
+func NewTopologySpread(groups map[string]*models.SGroup, cs []Candidater) *TopologySpread {
+	ts := &TopologySpread{
+		constraints: make([]*sTopologySpreadConstraint, 0),
+	}
+	groupIds := make([]string, 0, len(groups))
+	for id, group := range groups {
+		if group == nil {
+			continue
+		}
+		groupIds = append(groupIds, id)
+	}
+	sort.Strings(groupIds)
+	for _, id := range groupIds {
+		for _, sc := range groups[id].SpreadConstraints {
+			c := &sTopologySpreadConstraint{
+				GroupSpreadConstraint: sc,
+				groupId:               id,
+				domains:               make(map[string]string),
+				counts:                make(map[string]int),
+			}
+			for _, candidate := range cs {
+				domain := getTopologyDomain(candidate, sc)
+				if len(domain) == 0 {
+					continue
+				}
+				c.domains[candidate.IndexKey()] = domain
+				c.counts[domain] += getCandidateGroupCount(candidate, id)
+			}
+			ts.constraints = append(ts.constraints, c)
+		}
+	}
+	return ts
+}
+
+func getCandidateGroupCount(c Candidater, groupId string) int {
+	getter := c.Getter()
+	count := 0
+	if group, ok := getter.InstanceGroups()[groupId]; ok {
+		count += group.ReferCount
+	}
+	if pending := getter.GetPendingUsage(); pending != nil {
+		if group, ok := pending.InstanceGroupUsage[groupId]; ok {
+			count += group.ReferCount
+		}
+	}
+	return count
+}
+
+func getTopologyDomain(c Candidater, sc computeapi.GroupSpreadConstraint) string {
+	getter := c.Getter()
+	kind, arg := sc.ParseTopologyKey()
+	switch kind {
+	case computeapi.GROUP_TOPOLOGY_KEY_ZONE:
+		if zone := getter.Zone(); zone != nil {
+			return zone.GetId()
+		}
+	case "schedtag":
+		return schedtagTopologyDomain(schedtag.GetCandidateSchedtags(models.HostManager.KeywordPlural(), getter.Id()), arg)
+	case "metadata":
+		if host := getter.Host(); host != nil {
+			return host.GetMetadata(context.Background(), arg, nil)
+		}
+	}
+	return ""
+}
+
+// schedtagTopologyDomain returns the first by name of schedtags with the
+// topology key
+func schedtagTopologyDomain(tags []schedtag.ISchedtag, key string) string {
+	names := []string{}
+	for _, tag := range tags {
+		if tag.GetTopologyKey() == key {
+			names = append(names, tag.GetName())
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+func (ts *TopologySpread) HasHardConstraints() bool {
+	for _, c := range ts.constraints {
+		if c.IsHard() {
+			return true
+		}
+	}
+	return false
+}
+
+func (ts *TopologySpread) HasSoftConstraints() bool {
+	for _, c := range ts.constraints {
+		if !c.IsHard() {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckHard returns the reason if placing one more guest on the candidate
+// breaks any hard constraint
+func (ts *TopologySpread) CheckHard(candidateId string) (string, bool) {
+	for _, c := range ts.constraints {
+		if !c.IsHard() {
+			continue
+		}
+		domain, skew, ok := c.skew(candidateId)
+		if !ok {
+			return fmt.Sprintf("no topology domain of %s", c), false
+		}
+		if skew > c.MaxSkew {
+			return fmt.Sprintf("skew %d of domain %s exceeds max skew %d of %s", skew, domain, c.MaxSkew, c), false
+		}
+	}
+	return "", true
+}
+
+// SoftSkew returns the sum of the exceeded skew of the soft constraints
+// when one more guest placed on the candidate
+func (ts *TopologySpread) SoftSkew(candidateId string) int {
+	exceeded := 0
+	for _, c := range ts.constraints {
+		if c.IsHard() {
+			continue
+		}
+		_, skew, ok := c.skew(candidateId)
+		if !ok {
+			continue
+		}
+		if skew > c.MaxSkew {
+			exceeded += skew - c.MaxSkew
+		}
+	}
+	return exceeded
+}
+
+// Place records count guests placed on the candidate, negative count
+// revert the placement
+func (ts *TopologySpread) Place(candidateId string, count int) {
+	for _, c := range ts.constraints {
+		if domain, ok := c.domains[candidateId]; ok {
+			c.counts[domain] += count
+		}
+	}
+}
+
+// TopologySpread returns the spread tracker of the instance groups of the
+// unit, it's built by the first caller with candidates
+func (u *Unit) TopologySpread(cs []Candidater) *TopologySpread {
+	u.topologySpreadLock.Lock()
+	defer u.topologySpreadLock.Unlock()
+
+	if u.topologySpread == nil {
+		u.topologySpread = NewTopologySpread(u.SchedInfo.InstanceGroupsDetail, cs)
+		// the migrating guest leaves its source host
+		if len(u.SchedInfo.HostId) > 0 {
+			u.topologySpread.Place(u.SchedInfo.HostId, -1)
+		}
+	}
+	return u.topologySpread
+}
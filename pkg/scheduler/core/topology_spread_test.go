@@ -0,0 +1,116 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"testing"
+
+	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/scheduler/data_manager/schedtag"
+)
+
+func TestTopologySpread(t *testing.T) {
+	newConstraint := func(when string) *sTopologySpreadConstraint {
+		return &sTopologySpreadConstraint{
+			GroupSpreadConstraint: computeapi.GroupSpreadConstraint{
+				TopologyKey:       computeapi.GROUP_TOPOLOGY_KEY_ZONE,
+				MaxSkew:           1,
+				WhenUnsatisfiable: when,
+			},
+			groupId: "group1",
+			domains: map[string]string{
+				"host1": "zone1",
+				"host2": "zone1",
+				"host3": "zone2",
+			},
+			counts: map[string]int{
+				"zone1": 1,
+				"zone2": 0,
+			},
+		}
+	}
+
+	ts := &TopologySpread{
+		constraints: []*sTopologySpreadConstraint{newConstraint(computeapi.GROUP_SPREAD_DO_NOT_SCHEDULE)},
+	}
+	for _, c := range []struct {
+		host string
+		want bool
+	}{
+		{"host1", false},
+		{"host2", false},
+		{"host3", true},
+		{"host4", false},
+	} {
+		if _, ok := ts.CheckHard(c.host); ok != c.want {
+			t.Errorf("CheckHard %s got %v want %v", c.host, ok, c.want)
+		}
+	}
+	ts.Place("host3", 1)
+	if _, ok := ts.CheckHard("host1"); !ok {
+		t.Errorf("host1 should be allowed after placing on host3")
+	}
+	ts.Place("host3", -1)
+
+	ts = &TopologySpread{
+		constraints: []*sTopologySpreadConstraint{newConstraint(computeapi.GROUP_SPREAD_SCHEDULE_ANYWAY)},
+	}
+	if _, ok := ts.CheckHard("host1"); !ok {
+		t.Errorf("soft constraint should not be checked as hard")
+	}
+	if skew := ts.SoftSkew("host1"); skew != 1 {
+		t.Errorf("SoftSkew host1 got %d want 1", skew)
+	}
+	if skew := ts.SoftSkew("host3"); skew != 0 {
+		t.Errorf("SoftSkew host3 got %d want 0", skew)
+	}
+}
+
+type testSchedtag struct {
+	schedtag.ISchedtag
+	name string
+	key  string
+}
+
+func (t *testSchedtag) GetName() string {
+	return t.name
+}
+
+func (t *testSchedtag) GetTopologyKey() string {
+	return t.key
+}
+
+func TestSchedtagTopologyDomain(t *testing.T) {
+	tags := []schedtag.ISchedtag{
+		&testSchedtag{name: "zone-ssd"},
+		&testSchedtag{name: "rack-b", key: "rack"},
+		&testSchedtag{name: "rack-a", key: "rack"},
+		&testSchedtag{name: "row-1", key: "rack-row"},
+	}
+	cases := []struct {
+		key  string
+		want string
+	}{
+		{"rack", "rack-a"},
+		{"rack-row", "row-1"},
+		{"zone", ""},
+		{"rac", ""},
+	}
+	for _, c := range cases {
+		if got := schedtagTopologyDomain(tags, c.key); got != c.want {
+			t.Errorf("key %q: want %q, got %q", c.key, c.want, got)
+		}
+	}
+}
@@ -284,6 +284,7 @@ type ISchedtag interface {
 	GetName() string
 	GetId() string
 	GetDefaultStrategy() string
+	GetTopologyKey() string
 
 	getResources() ([]models.IModelWithSchedtag, error)
 }
@@ -302,6 +303,10 @@ func (st *schedtag) GetDefaultStrategy() string {
 	return st.SSchedtag.DefaultStrategy
 }
 
+func (st *schedtag) GetTopologyKey() string {
+	return st.SSchedtag.TopologyKey
+}
+
 func (st *schedtag) getResources() ([]models.IModelWithSchedtag, error) {
 	return st.SSchedtag.GetResources()
 }
@@ -37,6 +37,8 @@ type PriorityFunctionFactory func() (core.PriorityPreFunction, core.PriorityMapF
 type PriorityConfigFactory struct {
 	MapReduceFunction PriorityFunctionFactory
 	Weight            int
+	// PriorityName is the name of core.Priority, also used as its score name
+	PriorityName string
 }
 
 var (
@@ -53,6 +55,7 @@ var (
 const (
 	DefaultProvider   = "DefaultProvider"
 	BaremetalProvider = "BaremetalProvider"
+	BinpackProvider   = "BinpackProvider"
 )
 
 // RegisterAlgorithmProvider registers a new algorithm provider with the
@@ -117,7 +120,8 @@ func RegisterPriority(name string, priority core.Priority, weight int) string {
 			p := priority.Clone()
 			return p.PreExecute, p.Map, p.Reduce
 		},
-		Weight: weight,
+		Weight:       weight,
+		PriorityName: priority.Name(),
 	}
 	return name
 }
@@ -134,6 +138,7 @@ func getPriorityConfigs(names sets.String) ([]core.PriorityConfig, error) {
 		}
 		preFunc, mapFunc, reduceFunc := factory.MapReduceFunction()
 		configs = append(configs, core.PriorityConfig{
+			Name:   factory.PriorityName,
 			Pre:    preFunc,
 			Map:    mapFunc,
 			Reduce: reduceFunc,
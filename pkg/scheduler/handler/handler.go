@@ -67,8 +67,12 @@ func schedulerActionHandler(c *gin.Context) {
 		doSchedulerTest(c)
 	case "forecast":
 		doSchedulerForecast(c)
+	case "preempt":
+		doSchedulerPreempt(c)
 	case "candidate-list":
 		doCandidateList(c)
+	case "snapshot":
+		doSnapshot(c)
 	case "cleanup":
 		doCleanup(c)
 	case "history-list":
@@ -145,6 +149,26 @@ func doSchedulerForecast(c *gin.Context) {
 	c.JSON(http.StatusOK, result.ForecastResult)
 }
 
+func doSchedulerPreempt(c *gin.Context) {
+	if !schedman.IsReady() {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("Global scheduler not init"))
+		return
+	}
+
+	schedInfo, err := api.FetchSchedInfo(c.Request)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := schedman.Preempt(schedInfo)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
 func doCandidateList(c *gin.Context) {
 	args, err := api.NewCandidateListArgs(c.Request.Body)
 	if err != nil {
@@ -161,6 +185,25 @@ func doCandidateList(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
+func doSnapshot(c *gin.Context) {
+	userCred, err := api.FetchUserCred(c.Request)
+	if err != nil {
+		c.AbortWithError(http.StatusUnauthorized, err)
+		return
+	}
+	if !userCred.HasSystemAdminPrivilege() {
+		c.AbortWithError(http.StatusForbidden, fmt.Errorf("only system admin can export snapshot"))
+		return
+	}
+
+	result, err := schedman.Snapshot()
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	c.JSON(http.StatusOK, jsonutils.Marshal(result).Interface())
+}
+
 func doCandidateDetail(c *gin.Context, id string) {
 	userCred, err := api.FetchUserCred(c.Request)
 	if err != nil {
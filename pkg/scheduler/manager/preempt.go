@@ -0,0 +1,216 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"fmt"
+	"sort"
+
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/rbacscope"
+
+	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
+	schedapi "yunion.io/x/onecloud/pkg/apis/scheduler"
+	computemodels "yunion.io/x/onecloud/pkg/compute/models"
+	"yunion.io/x/onecloud/pkg/scheduler/api"
+	o "yunion.io/x/onecloud/pkg/scheduler/options"
+)
+
+// the predicates ignored when looking for the hosts to preempt, the
+// resources they check are released by evicting the victims
+var preemptIgnoreFilters = []string{"host_cpu", "host_memory"}
+
+type sPreemptPlan struct {
+	hostId  string
+	victims []computeapi.SchedPreemptionVictim
+}
+
+func (p *sPreemptPlan) maxVictimPriority() int {
+	max := 0
+	for i, v := range p.victims {
+		if i == 0 || v.Priority > max {
+			max = v.Priority
+		}
+	}
+	return max
+}
+
+// betterThan prefers the plan evicting guests with lower priority, then
+// the plan evicting fewer guests
+func (p *sPreemptPlan) betterThan(o *sPreemptPlan) bool {
+	if o == nil {
+		return true
+	}
+	if len(p.victims) == 0 || len(o.victims) == 0 {
+		return len(p.victims) < len(o.victims)
+	}
+	if p.maxVictimPriority() != o.maxVictimPriority() {
+		return p.maxVictimPriority() < o.maxVictimPriority()
+	}
+	if len(p.victims) != len(o.victims) {
+		return len(p.victims) < len(o.victims)
+	}
+	return p.hostId < o.hostId
+}
+
+// selectPreemptVictims picks the guests with lower priority than the
+// preemptor until the cpu and memory deficit are covered, guests with the
+// lowest priority and the most resources are picked first
+func selectPreemptVictims(needCpu, needMem int64, priority int, guests []computeapi.SchedPreemptionVictim) ([]computeapi.SchedPreemptionVictim, bool) {
+	victims := []computeapi.SchedPreemptionVictim{}
+	if needCpu <= 0 && needMem <= 0 {
+		return victims, true
+	}
+	candidates := []computeapi.SchedPreemptionVictim{}
+	for _, g := range guests {
+		if g.Priority < priority {
+			candidates = append(candidates, g)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Priority != candidates[j].Priority {
+			return candidates[i].Priority < candidates[j].Priority
+		}
+		if candidates[i].VmemSize != candidates[j].VmemSize {
+			return candidates[i].VmemSize > candidates[j].VmemSize
+		}
+		return candidates[i].VcpuCount > candidates[j].VcpuCount
+	})
+	for _, g := range candidates {
+		if needCpu <= 0 && needMem <= 0 {
+			break
+		}
+		victims = append(victims, g)
+		needCpu -= int64(g.VcpuCount)
+		needMem -= int64(g.VmemSize)
+	}
+	if needCpu > 0 || needMem > 0 {
+		return nil, false
+	}
+	return victims, true
+}
+
+// fetchPreemptableGuests returns the running guests on the hosts keyed by
+// host id, only the guests within the preempt scope of the requester
+func fetchPreemptableGuests(hostIds []string, info *api.SchedInfo) (map[string][]computeapi.SchedPreemptionVictim, error) {
+	guests := make([]computemodels.SGuest, 0)
+	q := computemodels.GuestManager.Query().In("host_id", hostIds).Equals("status", computeapi.VM_RUNNING)
+	q = computemodels.FilterPreemptableGuests(q, rbacscope.TRbacScope(info.PreemptScope), info.Project, info.Domain)
+	err := q.All(&guests)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetch running guests of hosts")
+	}
+	priorities, err := computemodels.SchedPriorityClassManager.GetGuestsPriority(guests)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetGuestsPriority")
+	}
+	ret := make(map[string][]computeapi.SchedPreemptionVictim)
+	for i := range guests {
+		ret[guests[i].HostId] = append(ret[guests[i].HostId], computeapi.SchedPreemptionVictim{
+			GuestId:   guests[i].Id,
+			Name:      guests[i].Name,
+			Priority:  priorities[guests[i].Id],
+			VcpuCount: guests[i].VcpuCount,
+			VmemSize:  guests[i].VmemSize,
+		})
+	}
+	return ret, nil
+}
+
+// Preempt finds the host and the victims whose eviction makes the host fit
+// the schedule request, the request is only planned and nothing is evicted
+func Preempt(info *api.SchedInfo) (*schedapi.PreemptOutput, error) {
+	output := new(schedapi.PreemptOutput)
+	priorityClassId := ""
+	if info.ServerConfigs != nil {
+		priorityClassId = info.PriorityClassId
+	}
+	pc, err := computemodels.SchedPriorityClassManager.FetchGuestPriorityClass(priorityClassId, info.Project)
+	if err != nil {
+		return nil, errors.Wrap(err, "FetchGuestPriorityClass")
+	}
+	if pc == nil || !pc.CanPreempt() {
+		output.Error = "priority class not allow to preempt"
+		return output, nil
+	}
+	output.Priority = pc.Value
+	if pc.VictimAction != computeapi.PREEMPT_VICTIM_ACTION_MIGRATE && !o.Options.IgnoreNonrunningGuests {
+		// the resources of stopped guests are still counted, stopping the
+		// victims releases nothing
+		output.Error = "stopping victims releases no capacity when ignore_nonrunning_guests is disabled"
+		return output, nil
+	}
+
+	info.IsSuggestion = true
+	info.ShowSuggestionDetails = true
+	info.SuggestionAll = true
+	info.IgnorePredicates = make(map[string]bool)
+	for _, filter := range preemptIgnoreFilters {
+		info.IgnorePredicates[filter] = true
+	}
+	result, err := Schedule(info)
+	if err != nil {
+		return nil, errors.Wrap(err, "Schedule")
+	}
+	hostIds := []string{}
+	if result.ForecastResult != nil {
+		for _, c := range result.ForecastResult.Candidates {
+			if len(c.Error) == 0 && len(c.HostId) > 0 {
+				hostIds = append(hostIds, c.HostId)
+			}
+		}
+	}
+	if len(hostIds) == 0 {
+		output.Error = "no host fits the request even if all the lower priority guests evicted"
+		return output, nil
+	}
+	candidates, err := GetCandidateManager().GetCandidatesByIds("host", hostIds)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetCandidatesByIds")
+	}
+
+	count := int64(info.Count)
+	if count <= 0 {
+		count = 1
+	}
+	hostGuests, err := fetchPreemptableGuests(hostIds, info)
+	if err != nil {
+		return nil, err
+	}
+	var best *sPreemptPlan
+	for _, c := range candidates {
+		getter := c.Getter()
+		needCpu := int64(info.Ncpu)*count - getter.FreeCPUCount(false)
+		needMem := int64(info.Memory)*count - getter.FreeMemorySize(false)
+		victims, ok := selectPreemptVictims(needCpu, needMem, pc.Value, hostGuests[getter.Id()])
+		if !ok {
+			continue
+		}
+		plan := &sPreemptPlan{hostId: getter.Id(), victims: victims}
+		if plan.betterThan(best) {
+			best = plan
+		}
+	}
+	if best == nil {
+		output.Error = fmt.Sprintf("no lower priority guests to evict on %d candidate hosts", len(candidates))
+		return output, nil
+	}
+	for i := range best.victims {
+		best.victims[i].Action = pc.VictimAction
+	}
+	output.HostId = best.hostId
+	output.Victims = best.victims
+	return output, nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"testing"
+
+	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
+)
+
+func TestSelectPreemptVictims(t *testing.T) {
+	guests := []computeapi.SchedPreemptionVictim{
+		{GuestId: "high", Priority: 100, VcpuCount: 8, VmemSize: 16384},
+		{GuestId: "low-small", Priority: 0, VcpuCount: 1, VmemSize: 1024},
+		{GuestId: "low-large", Priority: 0, VcpuCount: 4, VmemSize: 8192},
+		{GuestId: "mid", Priority: 10, VcpuCount: 2, VmemSize: 4096},
+	}
+
+	victims, ok := selectPreemptVictims(4, 8192, 50, guests)
+	if !ok || len(victims) != 1 || victims[0].GuestId != "low-large" {
+		t.Errorf("expect low-large evicted, got %v %v", victims, ok)
+	}
+
+	victims, ok = selectPreemptVictims(6, 12000, 50, guests)
+	if !ok || len(victims) != 3 || victims[2].GuestId != "mid" {
+		t.Errorf("expect 3 victims end with mid, got %v %v", victims, ok)
+	}
+
+	if _, ok := selectPreemptVictims(16, 0, 50, guests); ok {
+		t.Errorf("higher priority guest should not be evicted")
+	}
+
+	victims, ok = selectPreemptVictims(0, 0, 50, guests)
+	if !ok || len(victims) != 0 {
+		t.Errorf("expect no victims when host fits, got %v %v", victims, ok)
+	}
+
+	low := &sPreemptPlan{hostId: "h1", victims: []computeapi.SchedPreemptionVictim{{Priority: 0}, {Priority: 0}}}
+	mid := &sPreemptPlan{hostId: "h2", victims: []computeapi.SchedPreemptionVictim{{Priority: 10}}}
+	if !low.betterThan(mid) || mid.betterThan(low) {
+		t.Errorf("plan evicting lower priority guests should be better")
+	}
+}
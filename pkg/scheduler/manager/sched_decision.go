@@ -0,0 +1,121 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+
+	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
+	computemodels "yunion.io/x/onecloud/pkg/compute/models"
+	"yunion.io/x/onecloud/pkg/scheduler/core"
+	o "yunion.io/x/onecloud/pkg/scheduler/options"
+)
+
+// recordSchedDecision persists why the candidates of a real schedule
+// request are chosen or rejected, the failure of recording is only logged
+func recordSchedDecision(ctx context.Context, unit *core.Unit, weights map[string]int, result *core.ScheduleResult, schedErr error, elapsed time.Duration) {
+	if o.Options.DisableSchedDecisionRecord || unit == nil {
+		return
+	}
+	schedInfo := unit.SchedInfo
+	if schedInfo.IsSuggestion {
+		return
+	}
+
+	decision := &computemodels.SSchedDecision{
+		SessionId:  schedInfo.SessionId,
+		Hypervisor: schedInfo.Hypervisor,
+		Algorithm:  computeapi.SCHED_ALGORITHM_DEFAULT,
+		Status:     computeapi.SCHED_DECISION_STATUS_SUCCESS,
+		Request:    jsonutils.Marshal(schedInfo.ScheduleInput),
+		ElapsedMs:  elapsed.Milliseconds(),
+	}
+	if schedInfo.ServerConfigs != nil && len(schedInfo.SchedAlgorithm) > 0 {
+		decision.Algorithm = schedInfo.SchedAlgorithm
+	}
+
+	guestIds := []string{}
+	if len(schedInfo.Id) > 0 {
+		guestIds = append(guestIds, schedInfo.Id)
+	}
+	for _, g := range schedInfo.ForGuests {
+		guestIds = append(guestIds, g.Id)
+	}
+	decision.GuestIds = strings.Join(guestIds, ",")
+
+	counts := make(map[string]int64)
+	hostIds := []string{}
+	if result != nil && result.Result != nil {
+		for _, c := range result.Result.Candidates {
+			if len(c.Error) > 0 {
+				continue
+			}
+			if _, ok := counts[c.HostId]; !ok {
+				hostIds = append(hostIds, c.HostId)
+			}
+			counts[c.HostId] += 1
+		}
+	}
+	decision.HostIds = strings.Join(hostIds, ",")
+	if schedErr != nil {
+		decision.Status = computeapi.SCHED_DECISION_STATUS_FAILED
+		decision.Error = schedErr.Error()
+	} else if len(hostIds) == 0 {
+		decision.Status = computeapi.SCHED_DECISION_STATUS_FAILED
+		if result != nil && result.Result != nil && len(result.Result.Candidates) > 0 {
+			decision.Error = result.Result.Candidates[0].Error
+		}
+	}
+
+	for _, c := range unit.FilteredCandidates {
+		id := c.IndexKey()
+		candidate := computeapi.SchedDecisionCandidate{
+			HostId:     id,
+			HostName:   c.Getter().Name(),
+			Count:      counts[id],
+			Capacity:   unit.GetCapacity(id),
+			Priorities: []computeapi.SchedDecisionPriorityScore{},
+		}
+		for _, detail := range unit.GetScore(id).Details() {
+			candidate.Priorities = append(candidate.Priorities, computeapi.SchedDecisionPriorityScore{
+				Name:   detail.Name,
+				Kind:   detail.Kind,
+				Score:  detail.Score,
+				Weight: weights[detail.Name],
+			})
+		}
+		decision.Candidates = append(decision.Candidates, candidate)
+	}
+
+	for name, elapsed := range unit.GetPredicateElapsed() {
+		decision.Predicates = append(decision.Predicates, computeapi.SchedDecisionPredicateElapsed{
+			Name:      name,
+			ElapsedMs: float64(elapsed.Microseconds()) / 1000,
+		})
+	}
+	sort.Slice(decision.Predicates, func(i, j int) bool {
+		return decision.Predicates[i].Name < decision.Predicates[j].Name
+	})
+
+	if err := computemodels.SchedDecisionManager.Record(ctx, decision); err != nil {
+		log.Errorf("record schedule decision of session %s: %v", decision.SessionId, err)
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/pkg/errors"
 
+	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
 	"yunion.io/x/onecloud/pkg/scheduler/api"
 	"yunion.io/x/onecloud/pkg/scheduler/core"
 	"yunion.io/x/onecloud/pkg/scheduler/data_manager"
@@ -81,7 +82,7 @@ func NewHostCandidatesProvider(s Scheduler) *HostCandidatesProvider {
 }
 
 func (h *HostCandidatesProvider) ProviderType() string {
-	return factory.DefaultProvider
+	return guestAlgorithmProviderName(h.scheduler.SchedData())
 }
 
 func (h *HostCandidatesProvider) CandidateType() string {
@@ -163,6 +164,15 @@ func (s *BaseScheduler) BeforePredicate() error {
 	return nil
 }
 
+// guestAlgorithmProviderName return the algorithm provider selected by
+// sched_algorithm of request or matched schedpolicy
+func guestAlgorithmProviderName(info *api.SchedInfo) string {
+	if info.ServerConfigs != nil && info.SchedAlgorithm == computeapi.SCHED_ALGORITHM_BINPACK {
+		return factory.BinpackProvider
+	}
+	return factory.DefaultProvider
+}
+
 // GuestScheduler for guest type schedule
 type GuestScheduler struct {
 	*BaseScheduler
@@ -176,7 +186,7 @@ func newGuestScheduler(manager *SchedulerManager, info *api.SchedInfo) (*GuestSc
 		return nil, err
 	}
 
-	algorithmProvider, err := factory.GetAlgorithmProvider(factory.DefaultProvider)
+	algorithmProvider, err := factory.GetAlgorithmProvider(guestAlgorithmProviderName(info))
 	if err != nil {
 		return nil, err
 	}
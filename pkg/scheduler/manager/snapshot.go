@@ -0,0 +1,55 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"time"
+
+	"yunion.io/x/pkg/errors"
+
+	candidatecache "yunion.io/x/onecloud/pkg/scheduler/cache/candidate"
+	"yunion.io/x/onecloud/pkg/scheduler/data_manager/schedtag"
+	"yunion.io/x/onecloud/pkg/scheduler/simulate"
+)
+
+// Snapshot exports the host candidates in cache, which is the input of
+// 'scheduler simulate'
+func Snapshot() (*simulate.SSnapshot, error) {
+	hosts, err := GetCandidateHostsDesc()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetCandidateHostsDesc")
+	}
+	ret := &simulate.SSnapshot{
+		CreatedAt: time.Now(),
+		Hosts:     make([]simulate.SSnapshotHost, 0, len(hosts)),
+	}
+	for _, c := range hosts {
+		desc, ok := c.(*candidatecache.HostDesc)
+		if !ok {
+			continue
+		}
+		tags := schedtag.GetCandidateSchedtags("hosts", desc.Id)
+		stags := make([]simulate.SSnapshotSchedtag, len(tags))
+		for i, tag := range tags {
+			stags[i] = simulate.SSnapshotSchedtag{
+				Id:              tag.GetId(),
+				Name:            tag.GetName(),
+				DefaultStrategy: tag.GetDefaultStrategy(),
+			}
+		}
+		ret.Hosts = append(ret.Hosts, simulate.NewSnapshotHost(desc, stags))
+	}
+	return ret, nil
+}
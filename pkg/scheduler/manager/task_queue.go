@@ -102,7 +102,9 @@ func (te *TaskExecutor) execute(ctx context.Context) (*core.ScheduleResult, erro
 	schedInfo := te.unit.SchedInfo
 	// generate result helper
 	helper := GenerateResultHelper(schedInfo)
+	startTime := time.Now()
 	result, err := genericScheduler.Schedule(ctx, te.unit, candidates, helper)
+	recordSchedDecision(ctx, te.unit, genericScheduler.PriorityWeights(), result, err, time.Since(startTime))
 	if err != nil {
 		return nil, errors.Wrap(err, "genericScheduler.Schedule")
 	}
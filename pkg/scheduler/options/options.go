@@ -32,14 +32,16 @@ type SchedulerOptions struct {
 }
 
 type SchedOptions struct {
-	SchedulerPort           int  `help:"The port that the scheduler's http service runs on" default:"8897"`
-	IgnoreFakeDeletedGuests bool `help:"Ignore fake deleted guests when build host memory and cpu size" default:"false"`
+	SchedulerPort               int     `help:"The port that the scheduler's http service runs on" default:"8897"`
+	IgnoreFakeDeletedGuests     bool    `help:"Ignore fake deleted guests when build host memory and cpu size" default:"false"`
+	BalloonReclaimedMemoryRatio float32 `help:"Ratio of memory reclaimed by guest balloons counted as free memory of host, 0 to not count it, at most 1" default:"0"`
 
 	AlwaysCheckAllPredicates    bool   `help:"Excute all predicates when scheduling" default:"false"`
 	DisableBaremetalPredicates  bool   `help:"Switch to trigger baremetal related predicates" default:"false"`
 	SchedulerTestLimit          int    `help:"Scheduler test items' limitations" default:"100"`
 	SchedulerHistoryLimit       int    `help:"Scheduler history items' limitations" default:"1000"`
 	SchedulerHistoryCleanPeriod string `help:"Scheduler history cleanup period" default:"60s"`
+	DisableSchedDecisionRecord  bool   `help:"Disable recording placement decisions into database" default:"false"`
 
 	// parallelization options
 	HostBuildParallelizeSize int `help:"Number of host description build parallelization" default:"14"`
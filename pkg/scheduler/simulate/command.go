@@ -0,0 +1,126 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulate
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/structarg"
+
+	schedapi "yunion.io/x/onecloud/pkg/apis/scheduler"
+	"yunion.io/x/onecloud/pkg/cloudcommon/cmdline"
+)
+
+type SimulateOptions struct {
+	Snapshot    string   `help:"Candidate cache snapshot file exported by 'climc scheduler-snapshot'" required:"true"`
+	Requests    string   `help:"JSON file of the create requests list, each in the format of scheduler-test input, e.g. [{\"vcpu_count\":2,\"vmem_size\":2048,\"disk.0\":\"30g\",\"count\":3}]" required:"true"`
+	Provider    string   `help:"Algorithm provider" default:"DefaultProvider"`
+	CpuCmtbound float32  `help:"Overwrite cpu overcommit bound of all hosts"`
+	MemCmtbound float32  `help:"Overwrite memory overcommit bound of all hosts"`
+	Weight      []string `help:"Overwrite priority weight keyed by priority name, e.g. host_capacity=2"`
+	Output      string   `help:"Write result to file instead of stdout"`
+}
+
+func loadRequests(path string) ([]*schedapi.ScheduleInput, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %s", path)
+	}
+	obj, err := jsonutils.Parse(content)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse %s", path)
+	}
+	objs, err := obj.GetArray()
+	if err != nil {
+		return nil, errors.Wrap(err, "requests should be a list")
+	}
+	ret := make([]*schedapi.ScheduleInput, len(objs))
+	for i := range objs {
+		ret[i], err = cmdline.FetchScheduleInputByJSON(objs[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "request %d", i)
+		}
+	}
+	return ret, nil
+}
+
+func parseWeights(weights []string) (map[string]int, error) {
+	ret := make(map[string]int)
+	for _, w := range weights {
+		parts := strings.SplitN(w, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid weight %s", w)
+		}
+		weight, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid weight %s", w)
+		}
+		ret[parts[0]] = weight
+	}
+	return ret, nil
+}
+
+// Run is the entry of 'scheduler simulate' command
+func Run(args []string) error {
+	opts := &SimulateOptions{}
+	parser, err := structarg.NewArgumentParserWithHelp(opts, "scheduler simulate",
+		"Replay create requests against a snapshot of scheduler candidate cache offline", "")
+	if err != nil {
+		return errors.Wrap(err, "NewArgumentParser")
+	}
+	err = parser.ParseArgs(args, false)
+	if parser.IsHelpSet() {
+		fmt.Print(parser.HelpString())
+		return nil
+	}
+	if err != nil {
+		fmt.Print(parser.Usage())
+		return err
+	}
+
+	snapshot, err := LoadSnapshot(opts.Snapshot)
+	if err != nil {
+		return errors.Wrap(err, "LoadSnapshot")
+	}
+	requests, err := loadRequests(opts.Requests)
+	if err != nil {
+		return errors.Wrap(err, "loadRequests")
+	}
+	weights, err := parseWeights(opts.Weight)
+	if err != nil {
+		return err
+	}
+	sim, err := NewSimulator(snapshot, SConfig{
+		Provider:    opts.Provider,
+		CPUCmtbound: opts.CpuCmtbound,
+		MemCmtbound: opts.MemCmtbound,
+		Weights:     weights,
+	})
+	if err != nil {
+		return errors.Wrap(err, "NewSimulator")
+	}
+	result := jsonutils.Marshal(sim.Run(context.Background(), requests)).PrettyString()
+	if len(opts.Output) > 0 {
+		return ioutil.WriteFile(opts.Output, []byte(result), 0644)
+	}
+	fmt.Println(result)
+	return nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulate
+
+import (
+	"context"
+	"fmt"
+
+	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/scheduler/algorithm/predicates"
+	"yunion.io/x/onecloud/pkg/scheduler/core"
+	"yunion.io/x/onecloud/pkg/scheduler/core/score"
+)
+
+// HostSchedtagPredicate checks the host schedtags recorded in snapshot,
+// it takes the place of the host schedtag predicate which reads schedtags
+// from region
+type HostSchedtagPredicate struct {
+	predicates.BasePredicate
+
+	hostTags map[string][]SSnapshotSchedtag
+	allTags  []SSnapshotSchedtag
+
+	requireTags []computeapi.SchedtagConfig
+	excludeTags []computeapi.SchedtagConfig
+	preferTags  []computeapi.SchedtagConfig
+	avoidTags   []computeapi.SchedtagConfig
+}
+
+func newHostSchedtagPredicate(hostTags map[string][]SSnapshotSchedtag) *HostSchedtagPredicate {
+	p := &HostSchedtagPredicate{
+		hostTags: hostTags,
+		allTags:  []SSnapshotSchedtag{},
+	}
+	tagIds := make(map[string]bool)
+	for _, tags := range hostTags {
+		for _, tag := range tags {
+			if !tagIds[tag.Id] {
+				tagIds[tag.Id] = true
+				p.allTags = append(p.allTags, tag)
+			}
+		}
+	}
+	return p
+}
+
+func (p *HostSchedtagPredicate) Name() string {
+	return "host_schedtag"
+}
+
+func (p *HostSchedtagPredicate) Clone() core.FitPredicate {
+	return newHostSchedtagPredicate(p.hostTags)
+}
+
+func (p *HostSchedtagPredicate) PreExecute(ctx context.Context, u *core.Unit, cs []core.Candidater) (bool, error) {
+	reqTags := predicates.GetInputSchedtagByType(u.SchedData().Schedtags, "", "hosts")
+	appended := make(map[string]bool)
+	for _, reqTag := range reqTags {
+		tag := *reqTag
+		for _, t := range p.allTags {
+			if tag.Id == t.Id || tag.Id == t.Name {
+				tag.Id = t.Id
+				if len(tag.Strategy) == 0 {
+					tag.Strategy = t.DefaultStrategy
+				}
+			}
+		}
+		p.appendTag(tag, 10)
+		appended[tag.Id] = true
+	}
+	for _, t := range p.allTags {
+		if !appended[t.Id] {
+			p.appendTag(computeapi.SchedtagConfig{Id: t.Id, Strategy: t.DefaultStrategy}, 1)
+		}
+	}
+	return len(p.requireTags)+len(p.excludeTags)+len(p.preferTags)+len(p.avoidTags) > 0, nil
+}
+
+func (p *HostSchedtagPredicate) appendTag(tag computeapi.SchedtagConfig, defaultWeight int) {
+	if tag.Weight <= 0 {
+		tag.Weight = defaultWeight
+	}
+	switch tag.Strategy {
+	case computeapi.STRATEGY_REQUIRE:
+		p.requireTags = append(p.requireTags, tag)
+	case computeapi.STRATEGY_EXCLUDE:
+		p.excludeTags = append(p.excludeTags, tag)
+	case computeapi.STRATEGY_PREFER:
+		p.preferTags = append(p.preferTags, tag)
+	case computeapi.STRATEGY_AVOID:
+		p.avoidTags = append(p.avoidTags, tag)
+	}
+}
+
+func hasSchedtag(tags []SSnapshotSchedtag, id string) bool {
+	for _, tag := range tags {
+		if tag.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *HostSchedtagPredicate) Execute(ctx context.Context, u *core.Unit, c core.Candidater) (bool, []core.PredicateFailureReason, error) {
+	h := predicates.NewPredicateHelper(p, u, c)
+
+	tags := p.hostTags[c.IndexKey()]
+	for _, tag := range p.excludeTags {
+		if hasSchedtag(tags, tag.Id) {
+			h.Exclude(fmt.Sprintf("schedtag %q exclude host %s", tag.Id, c.Getter().Name()))
+			return h.GetResult()
+		}
+	}
+	for _, tag := range p.requireTags {
+		if !hasSchedtag(tags, tag.Id) {
+			h.Exclude(fmt.Sprintf("host %s need schedtag: %q", c.Getter().Name(), tag.Id))
+			return h.GetResult()
+		}
+	}
+	for _, tag := range p.preferTags {
+		if hasSchedtag(tags, tag.Id) {
+			u.SetPreferScore(c.IndexKey(), score.NewScore(score.TScore(tag.Weight*core.PriorityStep), tag.Id))
+		}
+	}
+	for _, tag := range p.avoidTags {
+		if hasSchedtag(tags, tag.Id) {
+			u.SetAvoidScore(c.IndexKey(), score.NewScore(score.TScore(tag.Weight*core.PriorityStep), tag.Id))
+		}
+	}
+
+	return h.GetResult()
+}
@@ -0,0 +1,342 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/sets"
+
+	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
+	schedapi "yunion.io/x/onecloud/pkg/apis/scheduler"
+	_ "yunion.io/x/onecloud/pkg/compute/guestdrivers"
+	_ "yunion.io/x/onecloud/pkg/scheduler/algorithmprovider"
+	"yunion.io/x/onecloud/pkg/scheduler/api"
+	"yunion.io/x/onecloud/pkg/scheduler/cache/candidate"
+	"yunion.io/x/onecloud/pkg/scheduler/core"
+	"yunion.io/x/onecloud/pkg/scheduler/factory"
+)
+
+const hostSchedtagPredicateKey = "c-GuestHostschedtagFilter"
+
+// the predicates only reading candidate cache, others query region
+// database or the data managers synced from region
+var offlinePredicates = sets.NewString(
+	"a-GuestHostStatusFilter",
+	"b-GuestHypervisorFilter",
+	"d-GuestMigrateFilter",
+	"e-GuestDomainFilter",
+	"e-GuestImageFilter",
+	"g-GuestCPUFilter",
+	"h-GuestMemoryFilter",
+	"i-GuestStorageFilter",
+	"k-GuestIsolatedDeviceFilter",
+	"l-GuestResourceTypeFilter",
+)
+
+// SConfig is the what-if changes applied to the snapshot before simulation
+type SConfig struct {
+	// algorithm provider, DefaultProvider if empty
+	Provider string
+	// overwrite the cpu and memory overcommit bound of all hosts if positive
+	CPUCmtbound float32
+	MemCmtbound float32
+	// overwrite the weight of priorities keyed by priority name
+	Weights map[string]int
+}
+
+type SPlacement struct {
+	Request int    `json:"request"`
+	Index   int    `json:"index"`
+	HostId  string `json:"host_id"`
+	Host    string `json:"host"`
+	Error   string `json:"error"`
+}
+
+type SHostUsage struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+
+	CPUCmtbound float32 `json:"cpu_cmtbound"`
+	MemCmtbound float32 `json:"mem_cmtbound"`
+
+	TotalCPUCount int64   `json:"total_cpu_count"`
+	FreeCPUCount  int64   `json:"free_cpu_count"`
+	CPUUsage      float64 `json:"cpu_usage"`
+	TotalMemSize  int64   `json:"total_mem_size"`
+	FreeMemSize   int64   `json:"free_mem_size"`
+	MemUsage      float64 `json:"mem_usage"`
+
+	TotalStorageSize int64   `json:"total_storage_size"`
+	FreeStorageSize  int64   `json:"free_storage_size"`
+	StorageUsage     float64 `json:"storage_usage"`
+
+	GuestCount  int64 `json:"guest_count"`
+	PlacedCount int   `json:"placed_count"`
+}
+
+type SResult struct {
+	Placements   []SPlacement `json:"placements"`
+	Hosts        []SHostUsage `json:"hosts"`
+	SuccessCount int          `json:"success_count"`
+	FailureCount int          `json:"failure_count"`
+	// the number of hosts filtered out by each predicate, summed over the
+	// requests not fully placed
+	FailedPredicates map[string]int `json:"failed_predicates"`
+}
+
+type sScheduler struct {
+	predicates map[string]core.FitPredicate
+	priorities []core.PriorityConfig
+}
+
+func (s *sScheduler) BeforePredicate() error {
+	return nil
+}
+
+func (s *sScheduler) Predicates() (map[string]core.FitPredicate, error) {
+	return s.predicates, nil
+}
+
+func (s *sScheduler) PriorityConfigs() ([]core.PriorityConfig, error) {
+	return s.priorities, nil
+}
+
+type SSimulator struct {
+	hosts     []*candidate.HostDesc
+	hostMap   map[string]*candidate.HostDesc
+	placed    map[string]int
+	scheduler *core.GenericScheduler
+}
+
+func NewSimulator(snapshot *SSnapshot, conf SConfig) (*SSimulator, error) {
+	providerName := conf.Provider
+	if len(providerName) == 0 {
+		providerName = factory.DefaultProvider
+	}
+	provider, err := factory.GetAlgorithmProvider(providerName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetAlgorithmProvider %s", providerName)
+	}
+	preds, err := factory.GetPredicates(provider.FitPredicateKeys.Intersection(offlinePredicates))
+	if err != nil {
+		return nil, errors.Wrap(err, "GetPredicates")
+	}
+	priorities, err := factory.GetPriorityConfigs(provider.PriorityKeys)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetPriorityConfigs")
+	}
+	names := sets.NewString()
+	for i := range priorities {
+		names.Insert(priorities[i].Name)
+		if weight, ok := conf.Weights[priorities[i].Name]; ok {
+			priorities[i].Weight = weight
+		}
+	}
+	for name := range conf.Weights {
+		if !names.Has(name) {
+			return nil, errors.Errorf("unknown priority %s of provider %s, available: %s", name, providerName, strings.Join(names.List(), ","))
+		}
+	}
+
+	sim := &SSimulator{
+		hosts:   make([]*candidate.HostDesc, len(snapshot.Hosts)),
+		hostMap: make(map[string]*candidate.HostDesc),
+		placed:  make(map[string]int),
+	}
+	hostTags := make(map[string][]SSnapshotSchedtag)
+	for i, host := range snapshot.Hosts {
+		desc := host.Desc
+		if conf.CPUCmtbound > 0 {
+			total := int64(float32(desc.CpuCount) * conf.CPUCmtbound)
+			desc.FreeCPUCount += total - desc.TotalCPUCount
+			desc.TotalCPUCount = total
+			desc.CPUCmtbound = conf.CPUCmtbound
+			desc.SHost.CpuCmtbound = conf.CPUCmtbound
+		}
+		if conf.MemCmtbound > 0 {
+			total := int64(float32(desc.MemSize) * conf.MemCmtbound)
+			desc.FreeMemSize += total - desc.TotalMemSize
+			desc.TotalMemSize = total
+			desc.MemCmtbound = conf.MemCmtbound
+			desc.SHost.MemCmtbound = conf.MemCmtbound
+		}
+		sim.hosts[i] = desc
+		sim.hostMap[desc.Id] = desc
+		hostTags[desc.Id] = host.Schedtags
+	}
+	if provider.FitPredicateKeys.Has(hostSchedtagPredicateKey) {
+		preds[hostSchedtagPredicateKey] = newHostSchedtagPredicate(hostTags)
+	}
+
+	sim.scheduler, err = core.NewGenericScheduler(&sScheduler{predicates: preds, priorities: priorities})
+	if err != nil {
+		return nil, errors.Wrap(err, "NewGenericScheduler")
+	}
+	return sim, nil
+}
+
+func (sim *SSimulator) candidates() []core.Candidater {
+	ret := make([]core.Candidater, len(sim.hosts))
+	for i := range sim.hosts {
+		ret[i] = sim.hosts[i]
+	}
+	return ret
+}
+
+// Run schedules the requests one by one, each placed guest consumes the
+// resources of its host before the next request
+func (sim *SSimulator) Run(ctx context.Context, inputs []*schedapi.ScheduleInput) *SResult {
+	ret := &SResult{
+		Placements:       []SPlacement{},
+		FailedPredicates: make(map[string]int),
+	}
+	for i, input := range inputs {
+		if input.Count <= 0 {
+			input.Count = 1
+		}
+		if len(input.Provider) == 0 {
+			input.Provider = computeapi.CLOUD_PROVIDER_ONECLOUD
+		}
+		info := api.NewSchedInfo(input)
+		info.SessionId = fmt.Sprintf("simulate-%d", i)
+		unit := core.NewScheduleUnit(info, nil)
+
+		placements := make([]SPlacement, 0, input.Count)
+		result, err := sim.scheduler.Schedule(ctx, unit, sim.candidates(), core.SResultHelperFunc(core.ResultHelp))
+		if err == nil {
+			for _, res := range result.Result.Candidates {
+				placement := SPlacement{HostId: res.HostId, Host: res.Name, Error: res.Error}
+				if len(res.Error) == 0 {
+					sim.allocate(info, res)
+				}
+				placements = append(placements, placement)
+			}
+		}
+		for len(placements) < input.Count {
+			msg := "Out of resource"
+			if err != nil {
+				msg = err.Error()
+			}
+			placements = append(placements, SPlacement{Error: msg})
+		}
+
+		failed := false
+		for j := range placements {
+			placements[j].Request = i
+			placements[j].Index = j
+			if len(placements[j].Error) > 0 {
+				failed = true
+				ret.FailureCount += 1
+			} else {
+				ret.SuccessCount += 1
+			}
+		}
+		if failed {
+			for stage, fcs := range unit.FailedCandidateMap {
+				ret.FailedPredicates[stage] += len(fcs.Candidates)
+			}
+		}
+		ret.Placements = append(ret.Placements, placements...)
+	}
+	ret.Hosts = sim.hostUsages()
+	return ret
+}
+
+// allocate takes the resources of a placed guest from its host
+func (sim *SSimulator) allocate(info *api.SchedInfo, res *schedapi.CandidateResource) {
+	desc, ok := sim.hostMap[res.HostId]
+	if !ok {
+		return
+	}
+	sim.placed[desc.Id] += 1
+
+	desc.FreeCPUCount -= int64(info.Ncpu)
+	desc.RunningCPUCount += int64(info.Ncpu)
+	desc.RequiredCPUCount += int64(info.Ncpu)
+	desc.FreeMemSize -= int64(info.Memory)
+	desc.RunningMemSize += int64(info.Memory)
+	desc.RequiredMemSize += int64(info.Memory)
+	desc.GuestCount += 1
+	desc.RunningGuestCount += 1
+	desc.Tenants[info.Project] += 1
+
+	for i, disk := range info.Disks {
+		storageId := ""
+		if i < len(res.Disks) && len(res.Disks[i].StorageIds) > 0 {
+			storageId = res.Disks[i].StorageIds[0]
+		}
+		var storage *api.CandidateStorage
+		for _, s := range desc.Storages {
+			if len(storageId) > 0 {
+				if s.Id == storageId {
+					storage = s
+					break
+				}
+			} else if candidate.IsStorageBackendMediumMatch(s, disk.Backend, disk.Medium) {
+				if storage == nil || s.FreeCapacity > storage.FreeCapacity {
+					storage = s
+				}
+			}
+		}
+		if storage != nil {
+			storage.FreeCapacity -= int64(disk.SizeMb)
+			storage.ActualFreeCapacity -= int64(disk.SizeMb)
+		}
+	}
+}
+
+func usageRate(total, free int64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(total-free) / float64(total)
+}
+
+func (sim *SSimulator) hostUsages() []SHostUsage {
+	ret := make([]SHostUsage, len(sim.hosts))
+	for i, desc := range sim.hosts {
+		getter := desc.Getter()
+		usage := SHostUsage{
+			Id:          desc.Id,
+			Name:        desc.Name,
+			CPUCmtbound: desc.CPUCmtbound,
+			MemCmtbound: desc.MemCmtbound,
+
+			TotalCPUCount: getter.TotalCPUCount(false),
+			FreeCPUCount:  getter.FreeCPUCount(false),
+			TotalMemSize:  getter.TotalMemorySize(false),
+			FreeMemSize:   getter.FreeMemorySize(false),
+
+			TotalStorageSize: desc.GetTotalLocalStorageSize(false),
+			FreeStorageSize:  desc.GetFreeLocalStorageSize(false),
+
+			GuestCount:  desc.GuestCount,
+			PlacedCount: sim.placed[desc.Id],
+		}
+		usage.CPUUsage = usageRate(usage.TotalCPUCount, usage.FreeCPUCount)
+		usage.MemUsage = usageRate(usage.TotalMemSize, usage.FreeMemSize)
+		usage.StorageUsage = usageRate(usage.TotalStorageSize, usage.FreeStorageSize)
+		ret[i] = usage
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
@@ -0,0 +1,144 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulate
+
+import (
+	"context"
+	"testing"
+
+	"yunion.io/x/jsonutils"
+
+	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
+	schedapi "yunion.io/x/onecloud/pkg/apis/scheduler"
+	computemodels "yunion.io/x/onecloud/pkg/compute/models"
+	"yunion.io/x/onecloud/pkg/scheduler/api"
+	"yunion.io/x/onecloud/pkg/scheduler/cache/candidate"
+)
+
+func newTestHost(id string, cpu, mem int) *candidate.HostDesc {
+	zone := &computemodels.SZone{}
+	zone.Id = "zone"
+	zone.Status = "enable"
+
+	host := &computemodels.SHost{}
+	host.Id, host.Name = id, id
+	host.ZoneId = zone.Id
+	host.HostType = computeapi.HOST_TYPE_HYPERVISOR
+	host.HostStatus = computeapi.HOST_ONLINE
+	host.Status = computeapi.HOST_STATUS_RUNNING
+	host.Enabled = "true"
+	host.IsPublic = true
+	host.PublicScope = "system"
+	host.ResourceType = computeapi.HostResourceTypeShared
+	host.CpuCount = cpu
+	host.MemSize = mem
+
+	storage := &computemodels.SStorage{}
+	storage.Id = id + "-local"
+	storage.Status = computeapi.STORAGE_ONLINE
+	storage.Enabled = "true"
+	storage.StorageType = computeapi.STORAGE_LOCAL
+	storage.Capacity = 100 * 1024
+	storage.Cmtbound = 1.0
+	storage.IsSysDiskStore = "true"
+
+	return &candidate.HostDesc{
+		BaseHostDesc: &candidate.BaseHostDesc{
+			SHost:    host,
+			Zone:     zone,
+			Storages: []*api.CandidateStorage{{SStorage: storage, FreeCapacity: storage.Capacity, ActualFreeCapacity: storage.Capacity}},
+		},
+		CPUCmtbound:   1,
+		TotalCPUCount: int64(cpu),
+		FreeCPUCount:  int64(cpu),
+		MemCmtbound:   1,
+		TotalMemSize:  int64(mem),
+		FreeMemSize:   int64(mem),
+	}
+}
+
+func newTestInput(cpu, mem, count int) *schedapi.ScheduleInput {
+	input := new(schedapi.ScheduleInput)
+	input.ServerConfig.ServerConfigs = &computeapi.ServerConfigs{
+		Hypervisor: computeapi.HYPERVISOR_KVM,
+		Count:      count,
+		Disks: []*computeapi.DiskConfig{
+			{SizeMb: 10 * 1024, Backend: computeapi.STORAGE_LOCAL},
+		},
+	}
+	input.Ncpu = cpu
+	input.Memory = mem
+	return input
+}
+
+func TestSimulate(t *testing.T) {
+	snapshot := &SSnapshot{}
+	for _, h := range []*candidate.HostDesc{newTestHost("host1", 8, 8192), newTestHost("host2", 4, 4096)} {
+		snapshot.Hosts = append(snapshot.Hosts, NewSnapshotHost(h, []SSnapshotSchedtag{}))
+	}
+	snapshot.Hosts[1].Schedtags = []SSnapshotSchedtag{{Id: "tag-ssd", Name: "ssd"}}
+
+	// round trip as exported by scheduler
+	data := jsonutils.Marshal(snapshot)
+	snapshot = new(SSnapshot)
+	if err := data.Unmarshal(snapshot); err != nil {
+		t.Fatalf("unmarshal snapshot: %v", err)
+	}
+	for _, h := range snapshot.Hosts {
+		fillHostDesc(h.Desc)
+	}
+
+	sim, err := NewSimulator(snapshot, SConfig{CPUCmtbound: 2})
+	if err != nil {
+		t.Fatalf("NewSimulator: %v", err)
+	}
+	tagged := newTestInput(2, 1024, 1)
+	tagged.Schedtags = []*computeapi.SchedtagConfig{{Id: "ssd", Strategy: computeapi.STRATEGY_REQUIRE}}
+	result := sim.Run(context.Background(), []*schedapi.ScheduleInput{
+		tagged,
+		newTestInput(4, 4096, 2),
+		newTestInput(64, 1024, 1),
+	})
+
+	if result.Placements[0].HostId != "host2" {
+		t.Errorf("schedtag required request should be placed to host2, got %#v", result.Placements[0])
+	}
+	if result.SuccessCount != 3 || result.FailureCount != 1 {
+		t.Errorf("expect 3 success and 1 failure, got %d %d", result.SuccessCount, result.FailureCount)
+	}
+	if result.FailedPredicates["host_cpu"] != 2 {
+		t.Errorf("expect 2 hosts filtered by cpu, got %v", result.FailedPredicates)
+	}
+	totalCpus := map[string]int64{"host1": 16, "host2": 8}
+	for _, h := range result.Hosts {
+		if h.TotalCPUCount != totalCpus[h.Id] {
+			t.Errorf("host %s cpu overcommit not applied: %d", h.Id, h.TotalCPUCount)
+		}
+	}
+	placed := result.Hosts[0].PlacedCount + result.Hosts[1].PlacedCount
+	if placed != 3 || result.Hosts[0].FreeStorageSize+result.Hosts[1].FreeStorageSize != 2*100*1024-3*10*1024 {
+		t.Errorf("unexpected host usage %#v", result.Hosts)
+	}
+}
+
+func TestSimulateWeights(t *testing.T) {
+	snapshot := &SSnapshot{}
+	if _, err := NewSimulator(snapshot, SConfig{Weights: map[string]int{"host_capacity": 2}}); err != nil {
+		t.Errorf("weight of known priority should be accepted: %v", err)
+	}
+	if _, err := NewSimulator(snapshot, SConfig{Weights: map[string]int{"guest-capacity": 2}}); err == nil {
+		t.Errorf("weight of unknown priority should be rejected")
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulate
+
+import (
+	"io/ioutil"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/cloudcommon/types"
+	"yunion.io/x/onecloud/pkg/scheduler/api"
+	"yunion.io/x/onecloud/pkg/scheduler/cache/candidate"
+)
+
+// SSnapshotSchedtag is a host schedtag recorded in snapshot
+type SSnapshotSchedtag struct {
+	Id              string `json:"id"`
+	Name            string `json:"name"`
+	DefaultStrategy string `json:"default_strategy"`
+}
+
+type SSnapshotHost struct {
+	Desc      *candidate.HostDesc `json:"desc"`
+	Schedtags []SSnapshotSchedtag `json:"schedtags"`
+}
+
+// SSnapshot is the state of host candidates exported from a running
+// scheduler
+type SSnapshot struct {
+	CreatedAt time.Time       `json:"created_at"`
+	Hosts     []SSnapshotHost `json:"hosts"`
+}
+
+// NewSnapshotHost copies the host desc of candidate cache, the credentials
+// and the numa topology are not exported
+func NewSnapshotHost(desc *candidate.HostDesc, schedtags []SSnapshotSchedtag) SSnapshotHost {
+	host := *desc.SHost
+	host.IpmiInfo = nil
+	host.EnableNumaAllocate = false
+
+	base := *desc.BaseHostDesc
+	base.SHost = &host
+	base.IpmiInfo = types.SIPMIInfo{}
+	base.Cloudaccount = nil
+
+	ret := *desc
+	ret.BaseHostDesc = &base
+	ret.EnableCpuNumaAllocate = false
+	ret.HostTopo = &candidate.SHostTopo{CPUCmtbound: int(desc.CPUCmtbound)}
+	return SSnapshotHost{
+		Desc:      &ret,
+		Schedtags: schedtags,
+	}
+}
+
+func LoadSnapshot(path string) (*SSnapshot, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %s", path)
+	}
+	obj, err := jsonutils.Parse(content)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse %s", path)
+	}
+	snapshot := new(SSnapshot)
+	err = obj.Unmarshal(snapshot)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unmarshal snapshot")
+	}
+	for i, host := range snapshot.Hosts {
+		if host.Desc == nil || host.Desc.BaseHostDesc == nil || host.Desc.SHost == nil {
+			return nil, errors.Errorf("invalid host at index %d", i)
+		}
+		fillHostDesc(host.Desc)
+	}
+	return snapshot, nil
+}
+
+// fillHostDesc sets the fields omitted or dropped by export, which are
+// dereferenced by candidate getter
+func fillHostDesc(desc *candidate.HostDesc) {
+	if desc.HostTopo == nil {
+		desc.HostTopo = &candidate.SHostTopo{CPUCmtbound: int(desc.CPUCmtbound)}
+	}
+	if desc.GuestReservedResource == nil {
+		desc.GuestReservedResource = candidate.NewReservedResource(0, 0, 0)
+	}
+	if desc.GuestReservedResourceUsed == nil {
+		desc.GuestReservedResourceUsed = candidate.NewReservedResource(0, 0, 0)
+	}
+	if desc.Tenants == nil {
+		desc.Tenants = make(map[string]int64)
+	}
+	if desc.InstanceGroups == nil {
+		desc.InstanceGroups = make(map[string]*api.CandidateGroup)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imagesign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"yunion.io/x/pkg/errors"
+)
+
+const (
+	ALGORITHM_ED25519 = "ed25519"
+	ALGORITHM_X509    = "x509"
+
+	ErrInvalidSignature = errors.Error("signature mismatch")
+	ErrUntrustedKey     = errors.Error("untrusted signing key")
+)
+
+// SPublicKey is a publisher key that signatures are checked against.
+// A signature covers the SHA-256 digest of the image file.
+type SPublicKey struct {
+	Algorithm   string
+	Fingerprint string
+
+	key  crypto.PublicKey
+	cert *x509.Certificate
+}
+
+// ParsePublicKey accepts a PEM encoded PKIX ed25519 public key or a PEM
+// encoded x509 certificate carrying an RSA, ECDSA or ed25519 key
+func ParsePublicKey(algorithm string, pemData string) (*SPublicKey, error) {
+	block, _ := pem.Decode([]byte(strings.TrimSpace(pemData)))
+	if block == nil {
+		return nil, errors.Wrap(errors.ErrInvalidFormat, "no pem block found")
+	}
+	ret := &SPublicKey{Algorithm: algorithm}
+	switch algorithm {
+	case ALGORITHM_ED25519:
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "ParsePKIXPublicKey")
+		}
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, errors.Wrapf(errors.ErrInvalidFormat, "not an ed25519 public key")
+		}
+		ret.key = pub
+	case ALGORITHM_X509:
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "ParseCertificate")
+		}
+		switch cert.PublicKey.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		default:
+			return nil, errors.Wrapf(errors.ErrNotSupported, "certificate public key algorithm %s", cert.PublicKeyAlgorithm)
+		}
+		ret.key = cert.PublicKey
+		ret.cert = cert
+	default:
+		return nil, errors.Wrapf(errors.ErrNotSupported, "algorithm %q", algorithm)
+	}
+	sum := sha256.Sum256(block.Bytes)
+	ret.Fingerprint = hex.EncodeToString(sum[:])
+	return ret, nil
+}
+
+// Verify checks signature against the SHA-256 digest of the signed file
+func (k *SPublicKey) Verify(digest []byte, signature []byte) error {
+	if k.cert != nil {
+		now := time.Now()
+		if now.Before(k.cert.NotBefore) || now.After(k.cert.NotAfter) {
+			return errors.Wrapf(ErrUntrustedKey, "certificate valid from %s to %s", k.cert.NotBefore, k.cert.NotAfter)
+		}
+	}
+	var ok bool
+	switch pub := k.key.(type) {
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(pub, digest, signature)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(pub, digest, signature)
+	}
+	if !ok {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// DecodeSignature accepts standard base64 with or without padding. Spaces are
+// taken as '+' mangled by form or query unescaping on the way.
+func DecodeSignature(signature string) ([]byte, error) {
+	signature = strings.ReplaceAll(strings.TrimSpace(signature), " ", "+")
+	if sig, err := base64.StdEncoding.DecodeString(signature); err == nil {
+		return sig, nil
+	}
+	sig, err := base64.RawStdEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode base64 signature")
+	}
+	return sig, nil
+}
+
+// FileDigest returns the SHA-256 digest that signatures are made over
+func FileDigest(path string) ([]byte, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Open %s", path)
+	}
+	defer fp.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, fp)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %s", path)
+	}
+	return h.Sum(nil), nil
+}
+
+// VerifyFile checks a base64 encoded detached signature of the file at path
+func VerifyFile(path string, key *SPublicKey, signature string) error {
+	sig, err := DecodeSignature(signature)
+	if err != nil {
+		return errors.Wrap(ErrInvalidSignature, err.Error())
+	}
+	digest, err := FileDigest(path)
+	if err != nil {
+		return errors.Wrap(err, "FileDigest")
+	}
+	return key.Verify(digest, sig)
+}
@@ -0,0 +1,130 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imagesign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"yunion.io/x/pkg/errors"
+)
+
+func writeImage(t *testing.T, content []byte) string {
+	dir, err := ioutil.TempDir("", "imagesign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "image.qcow2")
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func selfSignedCert(t *testing.T, pub, priv interface{}, notAfter time.Time) string {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "image publisher"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestEd25519(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+	key, err := ParsePublicKey(ALGORITHM_ED25519, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	if err != nil {
+		t.Fatalf("ParsePublicKey: %v", err)
+	}
+	if len(key.Fingerprint) != 64 {
+		t.Errorf("unexpected fingerprint %s", key.Fingerprint)
+	}
+
+	path := writeImage(t, []byte("golden image"))
+	digest, _ := FileDigest(path)
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, digest))
+	if err := VerifyFile(path, key, sig); err != nil {
+		t.Errorf("VerifyFile: %v", err)
+	}
+
+	ioutil.WriteFile(path, []byte("tampered image"), 0644)
+	if err := VerifyFile(path, key, sig); errors.Cause(err) != ErrInvalidSignature {
+		t.Errorf("expect invalid signature, got %v", err)
+	}
+	if err := VerifyFile(path, key, "!!not base64"); errors.Cause(err) != ErrInvalidSignature {
+		t.Errorf("expect invalid signature for bad encoding, got %v", err)
+	}
+}
+
+func TestX509(t *testing.T) {
+	path := writeImage(t, []byte("golden image"))
+	digest, _ := FileDigest(path)
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaSig, _ := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest)
+	ecSig, _ := ecdsa.SignASN1(rand.Reader, ecKey, digest)
+
+	cases := []struct {
+		name    string
+		cert    string
+		sig     []byte
+		wantErr error
+	}{
+		{"rsa", selfSignedCert(t, &rsaKey.PublicKey, rsaKey, time.Now().Add(time.Hour)), rsaSig, nil},
+		{"ecdsa", selfSignedCert(t, &ecKey.PublicKey, ecKey, time.Now().Add(time.Hour)), ecSig, nil},
+		{"ecdsa wrong signature", selfSignedCert(t, &ecKey.PublicKey, ecKey, time.Now().Add(time.Hour)), rsaSig, ErrInvalidSignature},
+		{"expired", selfSignedCert(t, &rsaKey.PublicKey, rsaKey, time.Now().Add(-time.Minute)), rsaSig, ErrUntrustedKey},
+	}
+	for _, c := range cases {
+		key, err := ParsePublicKey(ALGORITHM_X509, c.cert)
+		if err != nil {
+			t.Errorf("%s: ParsePublicKey: %v", c.name, err)
+			continue
+		}
+		err = VerifyFile(path, key, base64.StdEncoding.EncodeToString(c.sig))
+		if errors.Cause(err) != c.wantErr {
+			t.Errorf("%s: want %v got %v", c.name, c.wantErr, err)
+		}
+	}
+
+	if _, err := ParsePublicKey(ALGORITHM_ED25519, selfSignedCert(t, &rsaKey.PublicKey, rsaKey, time.Now().Add(time.Hour))); err == nil {
+		t.Errorf("expect error parsing certificate as ed25519 key")
+	}
+}
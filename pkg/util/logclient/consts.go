@@ -35,6 +35,8 @@ const (
 	ACT_ENABLE                       = "enable"
 	ACT_GUEST_ATTACH_ISOLATED_DEVICE = "guest_attach_isolated_device"
 	ACT_GUEST_DETACH_ISOLATED_DEVICE = "guest_detach_isolated_device"
+	ACT_GUEST_ATTACH_FILESYSTEM      = "guest_attach_filesystem"
+	ACT_GUEST_DETACH_FILESYSTEM      = "guest_detach_filesystem"
 	ACT_MERGE                        = "merge"
 	ACT_MERGE_FROM                   = "merge_from"
 	ACT_OFFLINE                      = "offline"
@@ -108,6 +110,7 @@ const (
 	ACT_ATTACH_NETWORK               = "attach_network"
 	ACT_DETACH_NETWORK               = "detach_network"
 	ACT_VM_CONVERT                   = "vm_convert"
+	ACT_VM_RELOCATE                  = "vm_relocate"
 	ACT_FREEZE                       = "freeze"
 	ACT_UNFREEZE                     = "unfreeze"
 	// 到期释放
@@ -124,8 +127,11 @@ const (
 	ACT_OPEN_PUBLIC_CONNECTION  = "open_public_connection"
 	ACT_CLOSE_PUBLIC_CONNECTION = "close_public_connection"
 
-	ACT_IMAGE_SAVE  = "image_save"
-	ACT_IMAGE_PROBE = "image_probe"
+	ACT_IMAGE_SAVE       = "image_save"
+	ACT_IMAGE_PROBE      = "image_probe"
+	ACT_IMAGE_IMPORT_OVF = "image_import_ovf"
+	ACT_IMAGE_VERIFY     = "image_verify"
+	ACT_IMAGE_EXPORT     = "image_export"
 
 	ACT_AUTHENTICATE = "authenticate"
 	ACT_LOGOUT       = "logout"
@@ -283,6 +289,9 @@ const (
 
 	ACT_COLLECT_METRICS = "collect_metrics"
 
+	ACT_VERIFY          = "verify"
+	ACT_GARBAGE_COLLECT = "garbage_collect"
+
 	ACT_CONFIGURE            = "configure"
 	ACT_ACTIVATE             = "activate"
 	ACT_SUSPEND              = "suspend"
@@ -292,4 +301,6 @@ const (
 	ACT_TRANSFERRED_REJECTED = "trans_rejected"
 	ACT_ADD_RATE             = "add_rate"
 	ACT_REMOVE_RATE          = "remove_rate"
+
+	ACT_ACL_LOG = "acl_log"
 )
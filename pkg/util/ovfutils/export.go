@@ -0,0 +1,329 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovfutils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/osprofile"
+
+	"yunion.io/x/onecloud/pkg/apis"
+)
+
+const ovfTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<Envelope xmlns="http://schemas.dmtf.org/ovf/envelope/1" xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1" xmlns:rasd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData" xmlns:vssd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_VirtualSystemSettingData" xmlns:vmw="http://www.vmware.com/schema/ovf">
+  <References>
+{{- range .Disks }}
+    <File ovf:href="{{ xml .FileHref }}" ovf:id="file-{{ .DiskId }}" ovf:size="{{ .FileSize }}"/>
+{{- end }}
+  </References>
+  <DiskSection>
+    <Info>Virtual disk information</Info>
+{{- range .Disks }}
+    <Disk ovf:capacity="{{ .CapacityBytes }}" ovf:capacityAllocationUnits="byte" ovf:diskId="{{ .DiskId }}" ovf:fileRef="file-{{ .DiskId }}" ovf:format="http://www.vmware.com/interfaces/specifications/vmdk.html#streamOptimized"/>
+{{- end }}
+  </DiskSection>
+{{- if .Networks }}
+  <NetworkSection>
+    <Info>The list of logical networks</Info>
+{{- range .Networks }}
+    <Network ovf:name="{{ xml . }}">
+      <Description>{{ xml . }}</Description>
+    </Network>
+{{- end }}
+  </NetworkSection>
+{{- end }}
+  <VirtualSystem ovf:id="{{ xml .Name }}">
+    <Info>A virtual machine</Info>
+    <Name>{{ xml .Name }}</Name>
+    <OperatingSystemSection ovf:id="{{ .OsId }}" vmw:osType="{{ .VmwOsType }}">
+      <Info>The kind of installed guest operating system</Info>
+      <Description>{{ xml .OsDescription }}</Description>
+    </OperatingSystemSection>
+    <VirtualHardwareSection>
+      <Info>Virtual hardware requirements</Info>
+      <System>
+        <vssd:ElementName>Virtual Hardware Family</vssd:ElementName>
+        <vssd:InstanceID>0</vssd:InstanceID>
+        <vssd:VirtualSystemIdentifier>{{ xml .Name }}</vssd:VirtualSystemIdentifier>
+        <vssd:VirtualSystemType>vmx-13</vssd:VirtualSystemType>
+      </System>
+{{- range .Items }}
+      <Item>
+{{- if .AddressOnParent }}
+        <rasd:AddressOnParent>{{ .AddressOnParent }}</rasd:AddressOnParent>
+{{- end }}
+{{- if .AllocationUnits }}
+        <rasd:AllocationUnits>{{ .AllocationUnits }}</rasd:AllocationUnits>
+{{- end }}
+{{- if .Connection }}
+        <rasd:AutomaticAllocation>true</rasd:AutomaticAllocation>
+        <rasd:Connection>{{ xml .Connection }}</rasd:Connection>
+{{- end }}
+        <rasd:ElementName>{{ xml .ElementName }}</rasd:ElementName>
+{{- if .HostResource }}
+        <rasd:HostResource>{{ .HostResource }}</rasd:HostResource>
+{{- end }}
+        <rasd:InstanceID>{{ .InstanceID }}</rasd:InstanceID>
+{{- if .Parent }}
+        <rasd:Parent>{{ .Parent }}</rasd:Parent>
+{{- end }}
+{{- if .ResourceSubType }}
+        <rasd:ResourceSubType>{{ .ResourceSubType }}</rasd:ResourceSubType>
+{{- end }}
+        <rasd:ResourceType>{{ .ResourceType }}</rasd:ResourceType>
+{{- if .VirtualQuantity }}
+        <rasd:VirtualQuantity>{{ .VirtualQuantity }}</rasd:VirtualQuantity>
+{{- end }}
+      </Item>
+{{- end }}
+      <vmw:Config ovf:required="false" vmw:key="firmware" vmw:value="{{ .VmwFirmware }}"/>
+    </VirtualHardwareSection>
+  </VirtualSystem>
+</Envelope>
+`
+
+var ovfTmpl = template.Must(template.New("ovf").Funcs(template.FuncMap{
+	"xml": func(s string) (string, error) {
+		buf := &bytes.Buffer{}
+		err := xml.EscapeText(buf, []byte(s))
+		return buf.String(), err
+	},
+}).Parse(ovfTemplate))
+
+type sOvfTemplateItem struct {
+	InstanceID      int
+	ElementName     string
+	ResourceType    int
+	ResourceSubType string
+	VirtualQuantity int64
+	AllocationUnits string
+	HostResource    string
+	Parent          int
+	AddressOnParent string
+	Connection      string
+}
+
+type sOvfTemplateData struct {
+	SOvfDescriptor
+
+	OsId        int
+	VmwOsType   string
+	VmwFirmware string
+	Networks    []string
+	Items       []sOvfTemplateItem
+}
+
+// GenerateOvf renders a descriptor whose disks are streamOptimized vmdk files,
+// the layout vSphere content libraries and OVF tool expect
+func GenerateOvf(desc *SOvfDescriptor) ([]byte, error) {
+	if len(desc.Disks) == 0 {
+		return nil, errors.Wrap(errors.ErrEmpty, "no disk")
+	}
+	data := sOvfTemplateData{
+		SOvfDescriptor: *desc,
+		VmwFirmware:    "bios",
+	}
+	if desc.Firmware == FIRMWARE_UEFI {
+		data.VmwFirmware = "efi"
+	}
+	data.OsId, data.VmwOsType = vmwOsType(desc.OsType, desc.OsArch)
+	if len(data.OsDescription) == 0 {
+		data.OsDescription = data.VmwOsType
+	}
+	cpu, mem := int64(desc.CpuCount), desc.MemoryMB
+	if cpu <= 0 {
+		cpu = 1
+	}
+	if mem <= 0 {
+		mem = 1024
+	}
+
+	id := 0
+	nextId := func() int {
+		id++
+		return id
+	}
+	data.Items = append(data.Items, sOvfTemplateItem{
+		InstanceID:      nextId(),
+		ElementName:     fmt.Sprintf("%d virtual CPU(s)", cpu),
+		ResourceType:    RESOURCE_TYPE_CPU,
+		VirtualQuantity: cpu,
+		AllocationUnits: "hertz * 10^6",
+	}, sOvfTemplateItem{
+		InstanceID:      nextId(),
+		ElementName:     fmt.Sprintf("%dMB of memory", mem),
+		ResourceType:    RESOURCE_TYPE_MEMORY,
+		VirtualQuantity: mem,
+		AllocationUnits: "byte * 2^20",
+	})
+
+	// disks sharing a driver are attached to the same controller
+	controllers := map[string]int{}
+	units := map[string]int{}
+	for i := range desc.Disks {
+		disk := desc.Disks[i]
+		driver := disk.Driver
+		if len(driver) == 0 {
+			driver = DISK_DRIVER_SCSI
+		}
+		ctrl, ok := controllers[driver]
+		if !ok {
+			ctrl = nextId()
+			controllers[driver] = ctrl
+			resType, subType := controllerResource(driver)
+			data.Items = append(data.Items, sOvfTemplateItem{
+				InstanceID:      ctrl,
+				ElementName:     fmt.Sprintf("%s controller 0", strings.ToUpper(driver)),
+				ResourceType:    resType,
+				ResourceSubType: subType,
+			})
+		}
+		data.Items = append(data.Items, sOvfTemplateItem{
+			InstanceID:      nextId(),
+			ElementName:     fmt.Sprintf("Hard disk %d", i+1),
+			ResourceType:    RESOURCE_TYPE_DISK,
+			HostResource:    "ovf:/disk/" + disk.DiskId,
+			Parent:          ctrl,
+			AddressOnParent: fmt.Sprintf("%d", units[driver]),
+		})
+		units[driver]++
+	}
+
+	networks := map[string]bool{}
+	for i, nic := range desc.Nics {
+		network := nic.Network
+		if len(network) == 0 {
+			network = "VM Network"
+		}
+		if !networks[network] {
+			networks[network] = true
+			data.Networks = append(data.Networks, network)
+		}
+		data.Items = append(data.Items, sOvfTemplateItem{
+			InstanceID:      nextId(),
+			ElementName:     fmt.Sprintf("Network adapter %d", i+1),
+			ResourceType:    RESOURCE_TYPE_ETHERNET,
+			ResourceSubType: nicSubType(nic.Model),
+			Connection:      network,
+		})
+	}
+
+	buf := &bytes.Buffer{}
+	err := ovfTmpl.Execute(buf, data)
+	if err != nil {
+		return nil, errors.Wrap(err, "render ovf")
+	}
+	return buf.Bytes(), nil
+}
+
+func controllerResource(driver string) (int, string) {
+	switch driver {
+	case DISK_DRIVER_IDE:
+		return RESOURCE_TYPE_IDE_CONTROLLER, ""
+	case DISK_DRIVER_SATA:
+		return RESOURCE_TYPE_SATA_CONTROLLER, "vmware.sata.ahci"
+	case DISK_DRIVER_PVSCSI:
+		return RESOURCE_TYPE_SCSI_CONTROLLER, "VirtualSCSI"
+	}
+	return RESOURCE_TYPE_SCSI_CONTROLLER, "lsilogic"
+}
+
+func nicSubType(model string) string {
+	switch model {
+	case NIC_MODEL_E1000:
+		return "E1000"
+	}
+	return "VmxNet3"
+}
+
+func vmwOsType(osType, osArch string) (int, string) {
+	switch osType {
+	case osprofile.OS_TYPE_WINDOWS:
+		return 1, "windows9Server64Guest"
+	case osprofile.OS_TYPE_MACOS:
+		return 1, "darwin64Guest"
+	}
+	if osArch == apis.OS_ARCH_AARCH64 {
+		return 101, "arm64Guest"
+	}
+	return 101, "otherLinux64Guest"
+}
+
+// WriteOvfPackage writes the descriptor and a SHA256 manifest next to the
+// disk files already in dir and returns the descriptor path. File sizes of
+// the disks are filled from dir.
+func WriteOvfPackage(dir string, name string, desc *SOvfDescriptor) (string, error) {
+	for i := range desc.Disks {
+		st, err := os.Stat(filepath.Join(dir, desc.Disks[i].FileHref))
+		if err != nil {
+			return "", errors.Wrapf(err, "Stat %s", desc.Disks[i].FileHref)
+		}
+		desc.Disks[i].FileSize = st.Size()
+	}
+	content, err := GenerateOvf(desc)
+	if err != nil {
+		return "", errors.Wrap(err, "GenerateOvf")
+	}
+	ovfPath := filepath.Join(dir, name+".ovf")
+	err = ioutil.WriteFile(ovfPath, content, 0644)
+	if err != nil {
+		return "", errors.Wrapf(err, "WriteFile %s", ovfPath)
+	}
+
+	manifest := &bytes.Buffer{}
+	files := []string{filepath.Base(ovfPath)}
+	for _, disk := range desc.Disks {
+		files = append(files, disk.FileHref)
+	}
+	for _, f := range files {
+		digest, err := fileSha256(filepath.Join(dir, f))
+		if err != nil {
+			return "", errors.Wrapf(err, "digest %s", f)
+		}
+		fmt.Fprintf(manifest, "SHA256(%s)= %s\n", f, digest)
+	}
+	mfPath := filepath.Join(dir, name+".mf")
+	err = ioutil.WriteFile(mfPath, manifest.Bytes(), 0644)
+	if err != nil {
+		return "", errors.Wrapf(err, "WriteFile %s", mfPath)
+	}
+	return ovfPath, nil
+}
+
+func fileSha256(path string) (string, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, fp)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,241 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovfutils
+
+import (
+	"archive/tar"
+	"bufio"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"yunion.io/x/pkg/errors"
+)
+
+// SOvaContent describes the files extracted from an OVA archive
+type SOvaContent struct {
+	Dir        string
+	Descriptor string
+	Manifest   string
+}
+
+// ExtractOva unpacks an OVA (a plain tar archive) into dir and returns the
+// path of its OVF descriptor. Entries are flattened to their base name so that
+// a crafted archive cannot write outside dir.
+func ExtractOva(ovaPath string, dir string) (*SOvaContent, error) {
+	fp, err := os.Open(ovaPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Open %s", ovaPath)
+	}
+	defer fp.Close()
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, errors.Wrapf(err, "MkdirAll %s", dir)
+	}
+
+	ret := &SOvaContent{Dir: dir}
+	tr := tar.NewReader(fp)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "tar.Next")
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		name := filepath.Base(hdr.Name)
+		if name == "." || name == "/" || strings.HasPrefix(name, "..") {
+			continue
+		}
+		target := filepath.Join(dir, name)
+		err = extractFile(tr, target)
+		if err != nil {
+			return nil, errors.Wrapf(err, "extract %s", hdr.Name)
+		}
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".ovf":
+			if len(ret.Descriptor) == 0 {
+				ret.Descriptor = target
+			}
+		case ".mf":
+			ret.Manifest = target
+		}
+	}
+	if len(ret.Descriptor) == 0 {
+		return nil, errors.Wrap(errors.ErrNotFound, "no ovf descriptor in ova")
+	}
+	return ret, nil
+}
+
+func extractFile(reader io.Reader, target string) error {
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, reader)
+	return err
+}
+
+var manifestLineRegexp = regexp.MustCompile(`^(SHA1|SHA256|SHA512)\s*\((.+)\)\s*=\s*([0-9a-fA-F]+)$`)
+
+type sManifestEntry struct {
+	Algorithm string
+	Digest    string
+}
+
+func parseManifest(path string) (map[string]sManifestEntry, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Open %s", path)
+	}
+	defer fp.Close()
+
+	ret := map[string]sManifestEntry{}
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		m := manifestLineRegexp.FindStringSubmatch(line)
+		if len(m) != 4 {
+			return nil, errors.Errorf("invalid manifest line %q", line)
+		}
+		ret[m[2]] = sManifestEntry{Algorithm: m[1], Digest: strings.ToLower(m[3])}
+	}
+	return ret, scanner.Err()
+}
+
+// VerifyManifest checks every file listed in the .mf manifest against its digest
+func VerifyManifest(manifest string, dir string) error {
+	entries, err := parseManifest(manifest)
+	if err != nil {
+		return errors.Wrap(err, "parseManifest")
+	}
+	for name, entry := range entries {
+		var h hash.Hash
+		switch entry.Algorithm {
+		case "SHA1":
+			h = sha1.New()
+		case "SHA256":
+			h = sha256.New()
+		case "SHA512":
+			h = sha512.New()
+		}
+		path := filepath.Join(dir, filepath.Base(name))
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			// files not shipped with the package, e.g. nvram, are not used by import
+			continue
+		}
+		err := func() error {
+			fp, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer fp.Close()
+			_, err = io.Copy(h, fp)
+			return err
+		}()
+		if err != nil {
+			return errors.Wrapf(err, "digest %s", name)
+		}
+		if digest := hex.EncodeToString(h.Sum(nil)); digest != entry.Digest {
+			return errors.Errorf("%s digest mismatch: expect %s got %s", name, entry.Digest, digest)
+		}
+	}
+	return nil
+}
+
+// NewOvaReader streams an ovf descriptor together with its manifest and disk
+// files as an OVA archive, so that an OVF + VMDK set can be uploaded as one file
+func NewOvaReader(ovfPath string) (io.ReadCloser, int64, error) {
+	desc, err := ParseOvfFile(ovfPath)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "ParseOvfFile")
+	}
+	dir := filepath.Dir(ovfPath)
+	// the descriptor must be the first entry of an OVA
+	files := []string{ovfPath}
+	manifest := strings.TrimSuffix(ovfPath, filepath.Ext(ovfPath)) + ".mf"
+	if _, err := os.Stat(manifest); err == nil {
+		files = append(files, manifest)
+	}
+	for _, disk := range desc.Disks {
+		files = append(files, filepath.Join(dir, filepath.Base(disk.FileHref)))
+	}
+
+	var size int64
+	sizes := make([]int64, len(files))
+	for i, f := range files {
+		name := filepath.Base(f)
+		if len(name) >= 100 {
+			return nil, 0, errors.Errorf("file name %s too long for ova", name)
+		}
+		st, err := os.Stat(f)
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "Stat %s", f)
+		}
+		sizes[i] = st.Size()
+		// one header block plus content padded to 512 bytes
+		size += 512 + (st.Size()+511)/512*512
+	}
+	// two zero blocks terminate the archive
+	size += 1024
+
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		for i, f := range files {
+			err := func() error {
+				hdr := &tar.Header{
+					Name:     filepath.Base(f),
+					Mode:     0644,
+					Size:     sizes[i],
+					Typeflag: tar.TypeReg,
+					Format:   tar.FormatUSTAR,
+				}
+				err := tw.WriteHeader(hdr)
+				if err != nil {
+					return errors.Wrapf(err, "WriteHeader %s", f)
+				}
+				fp, err := os.Open(f)
+				if err != nil {
+					return errors.Wrapf(err, "Open %s", f)
+				}
+				defer fp.Close()
+				_, err = io.CopyN(tw, fp, sizes[i])
+				return err
+			}()
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.CloseWithError(tw.Close())
+	}()
+	return pr, size, nil
+}
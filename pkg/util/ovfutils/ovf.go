@@ -0,0 +1,466 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovfutils
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/osprofile"
+
+	"yunion.io/x/onecloud/pkg/apis"
+)
+
+// CIM resource types used in VirtualHardwareSection items
+const (
+	RESOURCE_TYPE_CPU             = 3
+	RESOURCE_TYPE_MEMORY          = 4
+	RESOURCE_TYPE_IDE_CONTROLLER  = 5
+	RESOURCE_TYPE_SCSI_CONTROLLER = 6
+	RESOURCE_TYPE_ETHERNET        = 10
+	RESOURCE_TYPE_DISK            = 17
+	RESOURCE_TYPE_SATA_CONTROLLER = 20
+)
+
+const (
+	FIRMWARE_BIOS = "bios"
+	FIRMWARE_UEFI = "uefi"
+
+	DISK_DRIVER_IDE    = "ide"
+	DISK_DRIVER_SCSI   = "scsi"
+	DISK_DRIVER_PVSCSI = "pvscsi"
+	DISK_DRIVER_SATA   = "sata"
+	DISK_DRIVER_VIRTIO = "virtio"
+
+	NIC_MODEL_E1000   = "e1000"
+	NIC_MODEL_VMXNET3 = "vmxnet3"
+	NIC_MODEL_VIRTIO  = "virtio"
+)
+
+type sFile struct {
+	Id          string `xml:"id,attr"`
+	Href        string `xml:"href,attr"`
+	Size        int64  `xml:"size,attr"`
+	Compression string `xml:"compression,attr"`
+}
+
+type sDisk struct {
+	DiskId                  string `xml:"diskId,attr"`
+	FileRef                 string `xml:"fileRef,attr"`
+	Capacity                string `xml:"capacity,attr"`
+	CapacityAllocationUnits string `xml:"capacityAllocationUnits,attr"`
+	Format                  string `xml:"format,attr"`
+}
+
+type sNetwork struct {
+	Name        string `xml:"name,attr"`
+	Description string `xml:"Description"`
+}
+
+type sItem struct {
+	InstanceID      string   `xml:"InstanceID"`
+	ElementName     string   `xml:"ElementName"`
+	ResourceType    int      `xml:"ResourceType"`
+	ResourceSubType string   `xml:"ResourceSubType"`
+	VirtualQuantity int64    `xml:"VirtualQuantity"`
+	AllocationUnits string   `xml:"AllocationUnits"`
+	HostResource    []string `xml:"HostResource"`
+	Parent          string   `xml:"Parent"`
+	AddressOnParent string   `xml:"AddressOnParent"`
+	Connection      []string `xml:"Connection"`
+}
+
+type sConfig struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type sVirtualHardware struct {
+	Items             []sItem   `xml:"Item"`
+	StorageItems      []sItem   `xml:"StorageItem"`
+	EthernetPortItems []sItem   `xml:"EthernetPortItem"`
+	Configs           []sConfig `xml:"Config"`
+}
+
+type sOperatingSystem struct {
+	Id          string `xml:"id,attr"`
+	OsType      string `xml:"osType,attr"`
+	Description string `xml:"Description"`
+}
+
+type sProduct struct {
+	Product     string `xml:"Product"`
+	Vendor      string `xml:"Vendor"`
+	Version     string `xml:"Version"`
+	FullVersion string `xml:"FullVersion"`
+	ProductUrl  string `xml:"ProductUrl"`
+	VendorUrl   string `xml:"VendorUrl"`
+}
+
+type sVirtualSystem struct {
+	Id              string            `xml:"id,attr"`
+	Name            string            `xml:"Name"`
+	OperatingSystem sOperatingSystem  `xml:"OperatingSystemSection"`
+	Hardware        *sVirtualHardware `xml:"VirtualHardwareSection"`
+	Products        []sProduct        `xml:"ProductSection"`
+}
+
+type sEnvelope struct {
+	XMLName    xml.Name        `xml:"Envelope"`
+	References []sFile         `xml:"References>File"`
+	Disks      []sDisk         `xml:"DiskSection>Disk"`
+	Networks   []sNetwork      `xml:"NetworkSection>Network"`
+	System     *sVirtualSystem `xml:"VirtualSystem"`
+	Collection *struct{}       `xml:"VirtualSystemCollection"`
+}
+
+type SOvfDisk struct {
+	DiskId        string
+	FileHref      string
+	FileSize      int64
+	CapacityBytes int64
+	Format        string
+	Driver        string
+}
+
+type SOvfNic struct {
+	Name    string
+	Network string
+	Model   string
+}
+
+type SOvfProduct struct {
+	Product     string
+	Vendor      string
+	Version     string
+	FullVersion string
+	ProductUrl  string
+	VendorUrl   string
+}
+
+type SOvfDescriptor struct {
+	Name          string
+	OsType        string
+	OsArch        string
+	OsDescription string
+	CpuCount      int
+	MemoryMB      int64
+	Firmware      string
+	Disks         []SOvfDisk
+	Nics          []SOvfNic
+	Product       SOvfProduct
+}
+
+func ParseOvfFile(path string) (*SOvfDescriptor, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ReadFile %s", path)
+	}
+	return ParseOvf(content)
+}
+
+func ParseOvf(content []byte) (*SOvfDescriptor, error) {
+	env := sEnvelope{}
+	err := xml.Unmarshal(content, &env)
+	if err != nil {
+		return nil, errors.Wrap(err, "xml.Unmarshal")
+	}
+	if env.System == nil {
+		if env.Collection != nil {
+			return nil, errors.Wrap(errors.ErrNotSupported, "multiple virtual systems")
+		}
+		return nil, errors.Wrap(errors.ErrNotFound, "VirtualSystem")
+	}
+	if env.System.Hardware == nil {
+		return nil, errors.Wrap(errors.ErrNotFound, "VirtualHardwareSection")
+	}
+
+	desc := &SOvfDescriptor{
+		Name:          env.System.Name,
+		OsDescription: env.System.OperatingSystem.Description,
+		Firmware:      FIRMWARE_BIOS,
+	}
+	if len(desc.Name) == 0 {
+		desc.Name = env.System.Id
+	}
+	osHint := strings.ToLower(env.System.OperatingSystem.OsType + " " + env.System.OperatingSystem.Description)
+	desc.OsType = parseOsType(osHint)
+	desc.OsArch = parseOsArch(osHint)
+	if len(env.System.Products) > 0 {
+		p := env.System.Products[0]
+		desc.Product = SOvfProduct{
+			Product:     p.Product,
+			Vendor:      p.Vendor,
+			Version:     p.Version,
+			FullVersion: p.FullVersion,
+			ProductUrl:  p.ProductUrl,
+			VendorUrl:   p.VendorUrl,
+		}
+	}
+
+	hw := env.System.Hardware
+	for _, conf := range hw.Configs {
+		if strings.EqualFold(conf.Key, "firmware") && strings.EqualFold(conf.Value, "efi") {
+			desc.Firmware = FIRMWARE_UEFI
+		}
+	}
+
+	files := map[string]sFile{}
+	for _, f := range env.References {
+		files[f.Id] = f
+	}
+	disks := map[string]sDisk{}
+	for _, d := range env.Disks {
+		disks[d.DiskId] = d
+	}
+
+	items := make([]sItem, 0, len(hw.Items)+len(hw.StorageItems)+len(hw.EthernetPortItems))
+	items = append(items, hw.Items...)
+	items = append(items, hw.StorageItems...)
+	items = append(items, hw.EthernetPortItems...)
+	controllers := map[string]string{}
+	for _, item := range items {
+		switch item.ResourceType {
+		case RESOURCE_TYPE_IDE_CONTROLLER, RESOURCE_TYPE_SCSI_CONTROLLER, RESOURCE_TYPE_SATA_CONTROLLER:
+			controllers[item.InstanceID] = controllerDriver(item.ResourceType, item.ResourceSubType)
+		}
+	}
+
+	used := map[string]bool{}
+	for _, item := range items {
+		switch item.ResourceType {
+		case RESOURCE_TYPE_CPU:
+			desc.CpuCount += int(item.VirtualQuantity)
+		case RESOURCE_TYPE_MEMORY:
+			unit, err := allocationUnitsBytes(item.AllocationUnits, 1024*1024)
+			if err != nil {
+				return nil, errors.Wrapf(err, "memory allocation units")
+			}
+			desc.MemoryMB += item.VirtualQuantity * unit / 1024 / 1024
+		case RESOURCE_TYPE_ETHERNET:
+			nic := SOvfNic{
+				Name:  item.ElementName,
+				Model: nicModel(item.ResourceSubType),
+			}
+			if len(item.Connection) > 0 {
+				nic.Network = item.Connection[0]
+			}
+			desc.Nics = append(desc.Nics, nic)
+		case RESOURCE_TYPE_DISK:
+			if len(item.HostResource) == 0 {
+				continue
+			}
+			disk, err := resolveDisk(item.HostResource[0], disks, files)
+			if err != nil {
+				return nil, errors.Wrapf(err, "disk item %s", item.InstanceID)
+			}
+			disk.Driver = controllers[item.Parent]
+			used[disk.FileHref] = true
+			desc.Disks = append(desc.Disks, *disk)
+		}
+	}
+	// disks not attached to any controller still belong to the appliance
+	for _, d := range env.Disks {
+		f, ok := files[d.FileRef]
+		if !ok || used[f.Href] {
+			continue
+		}
+		disk, err := resolveDisk("ovf:/disk/"+d.DiskId, disks, files)
+		if err != nil {
+			return nil, errors.Wrapf(err, "disk %s", d.DiskId)
+		}
+		used[disk.FileHref] = true
+		desc.Disks = append(desc.Disks, *disk)
+	}
+	if len(desc.Disks) == 0 {
+		return nil, errors.Wrap(errors.ErrNotFound, "no disk in descriptor")
+	}
+	return desc, nil
+}
+
+// validateFileHref makes sure a file reference stays inside the package, the
+// disks of a bare ovf are fetched relative to the descriptor url
+func validateFileHref(href string) error {
+	u, err := url.Parse(href)
+	if err != nil {
+		return errors.Wrapf(err, "parse href %s", href)
+	}
+	if len(u.Scheme) > 0 || len(u.Host) > 0 || len(u.Opaque) > 0 || len(u.RawQuery) > 0 || len(u.Fragment) > 0 {
+		return errors.Wrapf(errors.ErrNotSupported, "href %s is not a relative file path", href)
+	}
+	p := path.Clean(u.Path)
+	if path.IsAbs(p) || p == "." || p == ".." || strings.HasPrefix(p, "../") || strings.Contains(p, "\\") {
+		return errors.Wrapf(errors.ErrNotSupported, "href %s is outside of the package", href)
+	}
+	return nil
+}
+
+func resolveDisk(hostResource string, disks map[string]sDisk, files map[string]sFile) (*SOvfDisk, error) {
+	res := strings.TrimPrefix(hostResource, "ovf:")
+	switch {
+	case strings.HasPrefix(res, "/disk/"):
+		diskId := strings.TrimPrefix(res, "/disk/")
+		d, ok := disks[diskId]
+		if !ok {
+			return nil, errors.Wrapf(errors.ErrNotFound, "disk %s", diskId)
+		}
+		f, ok := files[d.FileRef]
+		if !ok {
+			return nil, errors.Wrapf(errors.ErrNotFound, "file %s of disk %s", d.FileRef, diskId)
+		}
+		if err := validateFileHref(f.Href); err != nil {
+			return nil, err
+		}
+		if len(f.Compression) > 0 && f.Compression != "identity" {
+			return nil, errors.Wrapf(errors.ErrNotSupported, "file %s compression %s", f.Href, f.Compression)
+		}
+		disk := &SOvfDisk{
+			DiskId:   diskId,
+			FileHref: f.Href,
+			FileSize: f.Size,
+			Format:   parseDiskFormat(d.Format),
+		}
+		if len(d.Capacity) > 0 {
+			capacity, err := strconv.ParseInt(d.Capacity, 10, 64)
+			if err != nil {
+				return nil, errors.Wrapf(err, "capacity %s", d.Capacity)
+			}
+			unit, err := allocationUnitsBytes(d.CapacityAllocationUnits, 1)
+			if err != nil {
+				return nil, errors.Wrapf(err, "capacity allocation units")
+			}
+			disk.CapacityBytes = capacity * unit
+		}
+		return disk, nil
+	case strings.HasPrefix(res, "/file/"):
+		fileId := strings.TrimPrefix(res, "/file/")
+		f, ok := files[fileId]
+		if !ok {
+			return nil, errors.Wrapf(errors.ErrNotFound, "file %s", fileId)
+		}
+		if err := validateFileHref(f.Href); err != nil {
+			return nil, err
+		}
+		return &SOvfDisk{
+			DiskId:   fileId,
+			FileHref: f.Href,
+			FileSize: f.Size,
+		}, nil
+	}
+	return nil, errors.Wrapf(errors.ErrNotSupported, "host resource %s", hostResource)
+}
+
+var allocationUnitsRegexp = regexp.MustCompile(`^byte\s*\*\s*(\d+)\s*\^\s*(\d+)$`)
+
+// allocationUnitsBytes converts DSP0004 programmatic units such as "byte * 2^20" into bytes
+func allocationUnitsBytes(units string, defaultUnit int64) (int64, error) {
+	units = strings.TrimSpace(units)
+	switch strings.ToLower(units) {
+	case "":
+		return defaultUnit, nil
+	case "byte", "bytes":
+		return 1, nil
+	case "kilobytes", "kb":
+		return 1024, nil
+	case "megabytes", "mb":
+		return 1024 * 1024, nil
+	case "gigabytes", "gb":
+		return 1024 * 1024 * 1024, nil
+	}
+	m := allocationUnitsRegexp.FindStringSubmatch(strings.ToLower(units))
+	if len(m) != 3 {
+		return 0, errors.Wrapf(errors.ErrNotSupported, "allocation units %q", units)
+	}
+	base, _ := strconv.ParseInt(m[1], 10, 64)
+	exp, _ := strconv.ParseInt(m[2], 10, 64)
+	ret := int64(1)
+	for i := int64(0); i < exp; i++ {
+		ret *= base
+	}
+	return ret, nil
+}
+
+func controllerDriver(resourceType int, subType string) string {
+	subType = strings.ToLower(subType)
+	switch resourceType {
+	case RESOURCE_TYPE_IDE_CONTROLLER:
+		return DISK_DRIVER_IDE
+	case RESOURCE_TYPE_SCSI_CONTROLLER:
+		switch subType {
+		case "virtualscsi":
+			return DISK_DRIVER_PVSCSI
+		case "virtio", "virtio-scsi":
+			return DISK_DRIVER_VIRTIO
+		}
+		return DISK_DRIVER_SCSI
+	case RESOURCE_TYPE_SATA_CONTROLLER:
+		return DISK_DRIVER_SATA
+	}
+	return ""
+}
+
+func nicModel(subType string) string {
+	subType = strings.ToLower(subType)
+	switch {
+	case strings.HasPrefix(subType, "vmxnet"):
+		return NIC_MODEL_VMXNET3
+	case strings.HasPrefix(subType, "virtio"):
+		return NIC_MODEL_VIRTIO
+	case strings.HasPrefix(subType, "e1000"), subType == "pcnet32":
+		return NIC_MODEL_E1000
+	}
+	return NIC_MODEL_VIRTIO
+}
+
+func parseDiskFormat(format string) string {
+	format = strings.ToLower(format)
+	switch {
+	case strings.Contains(format, "vmdk"):
+		return "vmdk"
+	case strings.Contains(format, "qcow"):
+		return "qcow2"
+	case strings.Contains(format, "vhd"):
+		return "vhd"
+	}
+	return ""
+}
+
+func parseOsType(hint string) string {
+	switch {
+	case strings.Contains(hint, "darwin"), strings.Contains(hint, "mac os"):
+		return osprofile.OS_TYPE_MACOS
+	case strings.Contains(hint, "win"):
+		return osprofile.OS_TYPE_WINDOWS
+	}
+	return osprofile.OS_TYPE_LINUX
+}
+
+func parseOsArch(hint string) string {
+	if strings.Contains(hint, "arm64") || strings.Contains(hint, "aarch64") {
+		return apis.OS_ARCH_AARCH64
+	}
+	return apis.OS_ARCH_X86_64
+}
+
+func (d SOvfDescriptor) String() string {
+	return fmt.Sprintf("%s cpu=%d mem=%dM firmware=%s disks=%d nics=%d", d.Name, d.CpuCount, d.MemoryMB, d.Firmware, len(d.Disks), len(d.Nics))
+}
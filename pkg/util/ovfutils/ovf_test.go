@@ -0,0 +1,305 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovfutils
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testOvf = `<?xml version="1.0" encoding="UTF-8"?>
+<Envelope vmw:buildId="build-1" xmlns="http://schemas.dmtf.org/ovf/envelope/1" xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1" xmlns:rasd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData" xmlns:vmw="http://www.vmware.com/schema/ovf">
+  <References>
+    <File ovf:href="appliance-disk1.vmdk" ovf:id="file1" ovf:size="1024"/>
+    <File ovf:href="appliance-disk2.vmdk" ovf:id="file2" ovf:size="2048"/>
+  </References>
+  <DiskSection>
+    <Info>Virtual disk information</Info>
+    <Disk ovf:capacity="20" ovf:capacityAllocationUnits="byte * 2^30" ovf:diskId="vmdisk1" ovf:fileRef="file1" ovf:format="http://www.vmware.com/interfaces/specifications/vmdk.html#streamOptimized"/>
+    <Disk ovf:capacity="10737418240" ovf:diskId="vmdisk2" ovf:fileRef="file2" ovf:format="http://www.vmware.com/interfaces/specifications/vmdk.html#streamOptimized"/>
+  </DiskSection>
+  <NetworkSection>
+    <Info>The list of logical networks</Info>
+    <Network ovf:name="VM Network"/>
+  </NetworkSection>
+  <VirtualSystem ovf:id="appliance">
+    <Info>A virtual machine</Info>
+    <Name>appliance</Name>
+    <OperatingSystemSection ovf:id="101" vmw:osType="ubuntu64Guest">
+      <Description>Ubuntu Linux (64-bit)</Description>
+    </OperatingSystemSection>
+    <VirtualHardwareSection>
+      <Item>
+        <rasd:AllocationUnits>hertz * 10^6</rasd:AllocationUnits>
+        <rasd:ElementName>2 virtual CPU(s)</rasd:ElementName>
+        <rasd:InstanceID>1</rasd:InstanceID>
+        <rasd:ResourceType>3</rasd:ResourceType>
+        <rasd:VirtualQuantity>2</rasd:VirtualQuantity>
+      </Item>
+      <Item>
+        <rasd:AllocationUnits>byte * 2^20</rasd:AllocationUnits>
+        <rasd:ElementName>4096MB of memory</rasd:ElementName>
+        <rasd:InstanceID>2</rasd:InstanceID>
+        <rasd:ResourceType>4</rasd:ResourceType>
+        <rasd:VirtualQuantity>4096</rasd:VirtualQuantity>
+      </Item>
+      <Item>
+        <rasd:ElementName>SCSI Controller 0</rasd:ElementName>
+        <rasd:InstanceID>3</rasd:InstanceID>
+        <rasd:ResourceSubType>VirtualSCSI</rasd:ResourceSubType>
+        <rasd:ResourceType>6</rasd:ResourceType>
+      </Item>
+      <Item>
+        <rasd:AddressOnParent>0</rasd:AddressOnParent>
+        <rasd:ElementName>Hard Disk 1</rasd:ElementName>
+        <rasd:HostResource>ovf:/disk/vmdisk1</rasd:HostResource>
+        <rasd:InstanceID>4</rasd:InstanceID>
+        <rasd:Parent>3</rasd:Parent>
+        <rasd:ResourceType>17</rasd:ResourceType>
+      </Item>
+      <Item>
+        <rasd:AutomaticAllocation>true</rasd:AutomaticAllocation>
+        <rasd:Connection>VM Network</rasd:Connection>
+        <rasd:ElementName>Network adapter 1</rasd:ElementName>
+        <rasd:InstanceID>5</rasd:InstanceID>
+        <rasd:ResourceSubType>VmxNet3</rasd:ResourceSubType>
+        <rasd:ResourceType>10</rasd:ResourceType>
+      </Item>
+      <vmw:Config ovf:required="false" vmw:key="firmware" vmw:value="efi"/>
+    </VirtualHardwareSection>
+    <ProductSection>
+      <Info>Information about the installed software</Info>
+      <Product>Appliance</Product>
+      <Vendor>Example Inc.</Vendor>
+      <Version>1.2</Version>
+      <FullVersion>1.2.3</FullVersion>
+    </ProductSection>
+  </VirtualSystem>
+</Envelope>`
+
+func TestParseOvf(t *testing.T) {
+	desc, err := ParseOvf([]byte(testOvf))
+	if err != nil {
+		t.Fatalf("ParseOvf: %v", err)
+	}
+	if desc.Name != "appliance" || desc.CpuCount != 2 || desc.MemoryMB != 4096 {
+		t.Errorf("unexpected hardware %s", desc)
+	}
+	if desc.Firmware != FIRMWARE_UEFI || desc.OsType != "Linux" || desc.OsArch != "x86_64" {
+		t.Errorf("unexpected firmware/os %s %s %s", desc.Firmware, desc.OsType, desc.OsArch)
+	}
+	if len(desc.Disks) != 2 {
+		t.Fatalf("expect 2 disks, got %d", len(desc.Disks))
+	}
+	if d := desc.Disks[0]; d.FileHref != "appliance-disk1.vmdk" || d.CapacityBytes != 20*1024*1024*1024 || d.Driver != DISK_DRIVER_PVSCSI || d.Format != "vmdk" {
+		t.Errorf("unexpected disk0 %#v", d)
+	}
+	if d := desc.Disks[1]; d.FileHref != "appliance-disk2.vmdk" || d.CapacityBytes != 10737418240 || d.Driver != "" {
+		t.Errorf("unexpected disk1 %#v", d)
+	}
+	if len(desc.Nics) != 1 || desc.Nics[0].Model != NIC_MODEL_VMXNET3 || desc.Nics[0].Network != "VM Network" {
+		t.Errorf("unexpected nics %#v", desc.Nics)
+	}
+	if desc.Product.Vendor != "Example Inc." || desc.Product.FullVersion != "1.2.3" {
+		t.Errorf("unexpected product %#v", desc.Product)
+	}
+}
+
+func TestAllocationUnitsBytes(t *testing.T) {
+	cases := []struct {
+		units string
+		want  int64
+	}{
+		{"", 7},
+		{"byte", 1},
+		{"byte * 2^20", 1024 * 1024},
+		{"byte*2^30", 1024 * 1024 * 1024},
+		{"MegaBytes", 1024 * 1024},
+	}
+	for _, c := range cases {
+		got, err := allocationUnitsBytes(c.units, 7)
+		if err != nil {
+			t.Errorf("%q: %v", c.units, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%q: want %d got %d", c.units, c.want, got)
+		}
+	}
+	if _, err := allocationUnitsBytes("hertz * 10^6", 1); err == nil {
+		t.Errorf("expect error for non byte units")
+	}
+}
+
+func TestValidateFileHref(t *testing.T) {
+	cases := []struct {
+		href string
+		ok   bool
+	}{
+		{"disk1.vmdk", true},
+		{"disks/disk1.vmdk", true},
+		{"./disk1.vmdk", true},
+		{"", false},
+		{"../disk1.vmdk", false},
+		{"disks/../../disk1.vmdk", false},
+		{"%2e%2e/disk1.vmdk", false},
+		{"/etc/passwd", false},
+		{"http://169.254.169.254/latest", false},
+		{"//internal/disk1.vmdk", false},
+		{"file:///etc/passwd", false},
+		{"disk1.vmdk?x=1", false},
+	}
+	for _, c := range cases {
+		err := validateFileHref(c.href)
+		if (err == nil) != c.ok {
+			t.Errorf("%q: expect ok %v got %v", c.href, c.ok, err)
+		}
+	}
+}
+
+func TestExtractOva(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "ovfutils")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	disk := []byte("fake disk content")
+	sum := sha256.Sum256(disk)
+	files := []struct {
+		name    string
+		content []byte
+	}{
+		{"appliance.ovf", []byte(testOvf)},
+		{"appliance.mf", []byte(fmt.Sprintf("SHA256(appliance-disk1.vmdk)= %s\n", hex.EncodeToString(sum[:])))},
+		{"../appliance-disk1.vmdk", disk},
+	}
+	ovaPath := filepath.Join(tmp, "appliance.ova")
+	fp, err := os.Create(ovaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(fp)
+	for _, f := range files {
+		tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.content)), Typeflag: tar.TypeReg})
+		tw.Write(f.content)
+	}
+	tw.Close()
+	fp.Close()
+
+	dir := filepath.Join(tmp, "extract")
+	content, err := ExtractOva(ovaPath, dir)
+	if err != nil {
+		t.Fatalf("ExtractOva: %v", err)
+	}
+	if content.Descriptor != filepath.Join(dir, "appliance.ovf") {
+		t.Errorf("unexpected descriptor %s", content.Descriptor)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "appliance-disk1.vmdk")); err != nil {
+		t.Errorf("disk not extracted into dir: %v", err)
+	}
+	if err := VerifyManifest(content.Manifest, dir); err != nil {
+		t.Errorf("VerifyManifest: %v", err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "appliance-disk1.vmdk"), []byte("tampered"), 0644)
+	if err := VerifyManifest(content.Manifest, dir); err == nil {
+		t.Errorf("expect digest mismatch")
+	}
+}
+
+func TestNewOvaReader(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "ovfutils")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	ovfPath := filepath.Join(tmp, "appliance.ovf")
+	ioutil.WriteFile(ovfPath, []byte(testOvf), 0644)
+	ioutil.WriteFile(filepath.Join(tmp, "appliance-disk1.vmdk"), []byte("disk1"), 0644)
+	ioutil.WriteFile(filepath.Join(tmp, "appliance-disk2.vmdk"), make([]byte, 1000), 0644)
+
+	reader, size, err := NewOvaReader(ovfPath)
+	if err != nil {
+		t.Fatalf("NewOvaReader: %v", err)
+	}
+	defer reader.Close()
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("read ova: %v", err)
+	}
+	if int64(len(content)) != size {
+		t.Fatalf("expect size %d got %d", size, len(content))
+	}
+
+	ovaPath := filepath.Join(tmp, "appliance.ova")
+	ioutil.WriteFile(ovaPath, content, 0644)
+	ova, err := ExtractOva(ovaPath, filepath.Join(tmp, "extract"))
+	if err != nil {
+		t.Fatalf("ExtractOva: %v", err)
+	}
+	if _, err := ParseOvfFile(ova.Descriptor); err != nil {
+		t.Errorf("ParseOvfFile: %v", err)
+	}
+}
+
+func TestWriteOvfPackage(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "ovfutils")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	ioutil.WriteFile(filepath.Join(tmp, "export-disk1.vmdk"), []byte("stream vmdk"), 0644)
+	desc := &SOvfDescriptor{
+		Name:     "centos <7>",
+		OsType:   "Linux",
+		OsArch:   "x86_64",
+		Firmware: FIRMWARE_UEFI,
+		Disks: []SOvfDisk{
+			{DiskId: "vmdisk1", FileHref: "export-disk1.vmdk", CapacityBytes: 10 * 1024 * 1024 * 1024},
+		},
+		Nics: []SOvfNic{{Model: NIC_MODEL_VMXNET3}},
+	}
+	ovfPath, err := WriteOvfPackage(tmp, "export", desc)
+	if err != nil {
+		t.Fatalf("WriteOvfPackage: %v", err)
+	}
+	if err := VerifyManifest(filepath.Join(tmp, "export.mf"), tmp); err != nil {
+		t.Errorf("VerifyManifest: %v", err)
+	}
+	parsed, err := ParseOvfFile(ovfPath)
+	if err != nil {
+		t.Fatalf("ParseOvfFile: %v", err)
+	}
+	if parsed.Name != desc.Name || parsed.CpuCount != 1 || parsed.MemoryMB != 1024 || parsed.Firmware != FIRMWARE_UEFI {
+		t.Errorf("unexpected descriptor %s", parsed)
+	}
+	if len(parsed.Disks) != 1 {
+		t.Fatalf("expect 1 disk, got %d", len(parsed.Disks))
+	}
+	if d := parsed.Disks[0]; d.FileSize != 11 || d.CapacityBytes != desc.Disks[0].CapacityBytes || d.Driver != DISK_DRIVER_SCSI || d.Format != "vmdk" {
+		t.Errorf("unexpected disk %#v", d)
+	}
+	if len(parsed.Nics) != 1 || parsed.Nics[0].Model != NIC_MODEL_VMXNET3 || parsed.Nics[0].Network != "VM Network" {
+		t.Errorf("unexpected nics %#v", parsed.Nics)
+	}
+}
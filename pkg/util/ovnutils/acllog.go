@@ -0,0 +1,85 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovnutils
+
+import (
+	"strings"
+)
+
+const (
+	AclLogDirectionToLport   = "to-lport"
+	AclLogDirectionFromLport = "from-lport"
+)
+
+// SAclLog is an acl log entry written by ovn-controller, e.g.
+//
+//	2023-05-10T08:12:01.123Z|00042|acl_log(ovn_pinctrl0)|INFO|name="<name>", verdict=drop, severity=alert, direction=to-lport: tcp,vlan_tci=0x0000,dl_src=..,dl_dst=..,nw_src=..,nw_dst=..,tp_src=..,tp_dst=..
+//
+// Direction is missing in logs of older ovn versions
+type SAclLog struct {
+	Time      string
+	Name      string
+	Verdict   string
+	Severity  string
+	Direction string
+
+	Protocol string
+	Flow     map[string]string
+}
+
+// ParseAclLog parses a line of ovn-controller log.  It returns false if
+// the line is not an acl log entry
+func ParseAclLog(line string) (*SAclLog, bool) {
+	parts := strings.SplitN(strings.TrimSpace(line), "|", 5)
+	if len(parts) != 5 || !strings.HasPrefix(parts[2], "acl_log") {
+		return nil, false
+	}
+	hdr, flow, ok := strings.Cut(parts[4], ": ")
+	if !ok {
+		return nil, false
+	}
+	entry := &SAclLog{
+		Time: parts[0],
+		Flow: map[string]string{},
+	}
+	for _, kv := range strings.Split(hdr, ", ") {
+		k, v, _ := strings.Cut(kv, "=")
+		v = strings.Trim(v, `"`)
+		switch k {
+		case "name":
+			entry.Name = v
+		case "verdict":
+			entry.Verdict = v
+		case "severity":
+			entry.Severity = v
+		case "direction":
+			entry.Direction = v
+		}
+	}
+	for i, kv := range strings.Split(strings.TrimSpace(flow), ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			if i == 0 {
+				entry.Protocol = k
+			}
+			continue
+		}
+		entry.Flow[k] = v
+	}
+	if entry.Verdict == "" {
+		return nil, false
+	}
+	return entry, true
+}
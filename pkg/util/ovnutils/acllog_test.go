@@ -0,0 +1,89 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovnutils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAclLog(t *testing.T) {
+	cases := []struct {
+		in  string
+		out *SAclLog
+	}{
+		{
+			in: `2023-05-10T08:12:01.123Z|00042|acl_log(ovn_pinctrl0)|INFO|name="9e8c7a3d-1c1e-4f6b-8a55-0d3f2b8f1a11", verdict=drop, severity=alert, direction=to-lport: tcp,vlan_tci=0x0000,dl_src=00:00:00:00:00:01,dl_dst=00:22:33:44:55:66,nw_src=10.0.0.1,nw_dst=10.0.0.2,nw_tos=0,nw_ecn=0,nw_ttl=64,tp_src=51234,tp_dst=3389,tcp_flags=syn`,
+			out: &SAclLog{
+				Time:      "2023-05-10T08:12:01.123Z",
+				Name:      "9e8c7a3d-1c1e-4f6b-8a55-0d3f2b8f1a11",
+				Verdict:   "drop",
+				Severity:  "alert",
+				Direction: AclLogDirectionToLport,
+				Protocol:  "tcp",
+				Flow: map[string]string{
+					"vlan_tci":  "0x0000",
+					"dl_src":    "00:00:00:00:00:01",
+					"dl_dst":    "00:22:33:44:55:66",
+					"nw_src":    "10.0.0.1",
+					"nw_dst":    "10.0.0.2",
+					"nw_tos":    "0",
+					"nw_ecn":    "0",
+					"nw_ttl":    "64",
+					"tp_src":    "51234",
+					"tp_dst":    "3389",
+					"tcp_flags": "syn",
+				},
+			},
+		},
+		{
+			in: `2021-01-02T03:04:05.000Z|00007|acl_log(ovn_pinctrl0)|INFO|name="default", verdict=allow, severity=info: arp,vlan_tci=0x0000,dl_src=00:22:33:44:55:66,dl_dst=ff:ff:ff:ff:ff:ff`,
+			out: &SAclLog{
+				Time:     "2021-01-02T03:04:05.000Z",
+				Name:     "default",
+				Verdict:  "allow",
+				Severity: "info",
+				Protocol: "arp",
+				Flow: map[string]string{
+					"vlan_tci": "0x0000",
+					"dl_src":   "00:22:33:44:55:66",
+					"dl_dst":   "ff:ff:ff:ff:ff:ff",
+				},
+			},
+		},
+		{
+			in: `2021-01-02T03:04:05.000Z|00008|binding|INFO|Claiming lport iface-xx for this chassis.`,
+		},
+		{
+			in: `garbage`,
+		},
+	}
+	for _, c := range cases {
+		got, ok := ParseAclLog(c.in)
+		if c.out == nil {
+			if ok {
+				t.Errorf("want not acl log, got %#v, input: %s", got, c.in)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("want acl log, got nothing, input: %s", c.in)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.out) {
+			t.Errorf("got: %#v, want: %#v", got, c.out)
+		}
+	}
+}
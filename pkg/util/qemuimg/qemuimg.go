@@ -40,6 +40,9 @@ var (
 	ErrUnsupportedFormat = errors.Error("unsupported format")
 )
 
+// VHDX is only written by export, qemuimgfmt does not list it
+const VHDX = qemuimgfmt.TImageFormat("vhdx")
+
 type TIONiceLevel int
 
 const (
@@ -351,6 +354,8 @@ func convertOther(srcInfo, destInfo SImageInfo, compact bool, workerOpions []str
 	if destInfo.Format.String() == "vmdk" { // for esxi vmdk
 		cmdline = append(cmdline, "-o")
 		cmdline = append(cmdline, vmdkOptions(compact)...)
+	} else if destInfo.Format == VHDX { // for hyper-v
+		cmdline = append(cmdline, "-o", "subformat=dynamic")
 	}
 	cmdline = append(cmdline, srcInfo.Path, destInfo.Path)
 	log.Infof("XXXX qemu-img command: %s", cmdline)
@@ -472,6 +477,8 @@ func (img *SQemuImage) Clone(name string, format qemuimgfmt.TImageFormat, compac
 		return img.CloneRaw(name)
 	case qemuimgfmt.VHD:
 		return img.CloneVhd(name)
+	case VHDX:
+		return img.CloneVhdx(name)
 	default:
 		return nil, ErrUnsupportedFormat
 	}
@@ -608,6 +615,10 @@ func (img *SQemuImage) CloneVhd(name string) (*SQemuImage, error) {
 	return img.clone(name, qemuimgfmt.VHD, false, "", "", "")
 }
 
+func (img *SQemuImage) CloneVhdx(name string) (*SQemuImage, error) {
+	return img.clone(name, VHDX, false, "", "", "")
+}
+
 func (img *SQemuImage) CloneRaw(name string) (*SQemuImage, error) {
 	return img.clone(name, qemuimgfmt.RAW, false, "", "", "")
 }
@@ -31,6 +31,8 @@ type Vpc struct {
 
 	Wire     *Wire    `json:"-"`
 	Networks Networks `json:"-"`
+
+	NatGateways NatGateways `json:"-"`
 }
 
 func (el *Vpc) Copy() *Vpc {
@@ -230,6 +232,7 @@ type Elasticip struct {
 	Guestnetwork        *Guestnetwork        `json:"-"`
 	Groupnetwork        *Groupnetwork        `json:"-"`
 	LoadbalancerNetwork *LoadbalancerNetwork `json:"-"`
+	NatGateway          *NatGateway          `json:"-"`
 }
 
 func (el *Elasticip) Copy() *Elasticip {
@@ -371,3 +374,104 @@ func (el *LoadbalancerAcl) Copy() *LoadbalancerAcl {
 		SLoadbalancerAcl: el.SLoadbalancerAcl,
 	}
 }
+
+type NatGateway struct {
+	compute_models.SNatGateway
+
+	Vpc         *Vpc        `json:"-"`
+	Elasticips  Elasticips  `json:"-"`
+	NatSEntries NatSEntries `json:"-"`
+	NatDEntries NatDEntries `json:"-"`
+}
+
+func (el *NatGateway) Copy() *NatGateway {
+	return &NatGateway{
+		SNatGateway: el.SNatGateway,
+	}
+}
+
+func (el *NatGateway) OrderedNatSEntries() []*NatSEntry {
+	entries := make([]*NatSEntry, 0, len(el.NatSEntries))
+	for _, entry := range el.NatSEntries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Id < entries[j].Id
+	})
+	return entries
+}
+
+func (el *NatGateway) OrderedNatDEntries() []*NatDEntry {
+	entries := make([]*NatDEntry, 0, len(el.NatDEntries))
+	for _, entry := range el.NatDEntries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Id < entries[j].Id
+	})
+	return entries
+}
+
+type VpcPeeringConnection struct {
+	compute_models.SVpcPeeringConnection
+
+	Vpc     *Vpc `json:"-"`
+	PeerVpc *Vpc `json:"-"`
+}
+
+func (el *VpcPeeringConnection) Copy() *VpcPeeringConnection {
+	return &VpcPeeringConnection{
+		SVpcPeeringConnection: el.SVpcPeeringConnection,
+	}
+}
+
+type NatSEntry struct {
+	compute_models.SNatSEntry
+
+	NatGateway *NatGateway `json:"-"`
+}
+
+func (el *NatSEntry) Copy() *NatSEntry {
+	return &NatSEntry{
+		SNatSEntry: el.SNatSEntry,
+	}
+}
+
+type NatDEntry struct {
+	compute_models.SNatDEntry
+
+	NatGateway *NatGateway `json:"-"`
+}
+
+func (el *NatDEntry) Copy() *NatDEntry {
+	return &NatDEntry{
+		SNatDEntry: el.SNatDEntry,
+	}
+}
+
+type NetTapService struct {
+	compute_models.SNetTapService
+
+	// Guest is set for tap services of type guest
+	Guest *Guest `json:"-"`
+}
+
+func (el *NetTapService) Copy() *NetTapService {
+	return &NetTapService{
+		SNetTapService: el.SNetTapService,
+	}
+}
+
+type NetTapFlow struct {
+	compute_models.SNetTapFlow
+
+	NetTapService *NetTapService `json:"-"`
+	// Guestnetwork is the mirrored guest nic, set for flows of type vnic
+	Guestnetwork *Guestnetwork `json:"-"`
+}
+
+func (el *NetTapFlow) Copy() *NetTapFlow {
+	return &NetTapFlow{
+		SNetTapFlow: el.SNetTapFlow,
+	}
+}
@@ -54,6 +54,15 @@ type (
 	LoadbalancerNetworks  map[string]*LoadbalancerNetwork // key: networkId/loadbalancerId
 	LoadbalancerListeners map[string]*LoadbalancerListener
 	LoadbalancerAcls      map[string]*LoadbalancerAcl
+
+	NatGateways map[string]*NatGateway
+	NatSEntries map[string]*NatSEntry
+	NatDEntries map[string]*NatDEntry
+
+	VpcPeeringConnections map[string]*VpcPeeringConnection
+
+	NetTapServices map[string]*NetTapService
+	NetTapFlows    map[string]*NetTapFlow
 )
 
 func (set Vpcs) ModelManager() mcclient_modulebase.IBaseManager {
@@ -125,6 +134,45 @@ func (ms Vpcs) joinRouteTables(subEntries RouteTables) bool {
 	return correct
 }
 
+func (ms Vpcs) joinNatGateways(subEntries NatGateways) bool {
+	for _, m := range ms {
+		m.NatGateways = NatGateways{}
+	}
+	for subId, subEntry := range subEntries {
+		vpcId := subEntry.VpcId
+		m, ok := ms[vpcId]
+		if !ok {
+			// this can happen for nat gateways of external vpcs
+			log.Warningf("vpc_id %s of nat gateway %s(%s) is not present", vpcId, subEntry.Name, subEntry.Id)
+			delete(subEntries, subId)
+			continue
+		}
+		subEntry.Vpc = m
+		m.NatGateways[subEntry.Id] = subEntry
+	}
+	return true
+}
+
+func (ms Vpcs) joinVpcPeeringConnections(subEntries VpcPeeringConnections) bool {
+	for subId, subEntry := range subEntries {
+		m, ok := ms[subEntry.VpcId]
+		if !ok {
+			log.Warningf("vpc_id %s of vpc peering connection %s(%s) is not present", subEntry.VpcId, subEntry.Name, subEntry.Id)
+			delete(subEntries, subId)
+			continue
+		}
+		peer, ok := ms[subEntry.PeerVpcId]
+		if !ok {
+			log.Warningf("peer_vpc_id %s of vpc peering connection %s(%s) is not present", subEntry.PeerVpcId, subEntry.Name, subEntry.Id)
+			delete(subEntries, subId)
+			continue
+		}
+		subEntry.Vpc = m
+		subEntry.PeerVpc = peer
+	}
+	return true
+}
+
 func (ms Vpcs) joinNetworks(subEntries Networks) bool {
 	for _, m := range ms {
 		m.Networks = Networks{}
@@ -1139,3 +1187,275 @@ func (set LoadbalancerAcls) Copy() apihelper.IModelSet {
 	}
 	return setCopy
 }
+
+func (set NatGateways) ModelManager() mcclient_modulebase.IBaseManager {
+	return &mcclient_modules.NatGateways
+}
+
+func (set NatGateways) DBModelManager() db.IModelManager {
+	return models.NatGatewayManager
+}
+
+func (set NatGateways) NewModel() db.IModel {
+	return &NatGateway{}
+}
+
+func (set NatGateways) AddModel(i db.IModel) {
+	m := i.(*NatGateway)
+	set[m.Id] = m
+}
+
+func (set NatGateways) Copy() apihelper.IModelSet {
+	setCopy := NatGateways{}
+	for id, el := range set {
+		setCopy[id] = el.Copy()
+	}
+	return setCopy
+}
+
+func (set NatGateways) ModelFilter() []string {
+	return []string{"external_id.isnullorempty()"}
+}
+
+func (set NatGateways) joinElasticips(subEntries Elasticips) bool {
+	for _, m := range set {
+		m.Elasticips = Elasticips{}
+	}
+	correct := true
+	for _, subEntry := range subEntries {
+		if subEntry.AssociateType != computeapis.EIP_ASSOCIATE_TYPE_NAT_GATEWAY {
+			continue
+		}
+		m, ok := set[subEntry.AssociateId]
+		if !ok {
+			log.Errorf("elasticip %s(%s) associated with non-existent nat gateway %s",
+				subEntry.Name, subEntry.Id, subEntry.AssociateId)
+			correct = false
+			continue
+		}
+		subEntry.NatGateway = m
+		m.Elasticips[subEntry.Id] = subEntry
+	}
+	return correct
+}
+
+func (set NatGateways) joinNatSEntries(subEntries NatSEntries) bool {
+	for _, m := range set {
+		m.NatSEntries = NatSEntries{}
+	}
+	for subId, subEntry := range subEntries {
+		m, ok := set[subEntry.NatgatewayId]
+		if !ok {
+			log.Warningf("nat gateway %s of snat entry %s(%s) is not present", subEntry.NatgatewayId, subEntry.Name, subEntry.Id)
+			delete(subEntries, subId)
+			continue
+		}
+		subEntry.NatGateway = m
+		m.NatSEntries[subEntry.Id] = subEntry
+	}
+	return true
+}
+
+func (set NatGateways) joinNatDEntries(subEntries NatDEntries) bool {
+	for _, m := range set {
+		m.NatDEntries = NatDEntries{}
+	}
+	for subId, subEntry := range subEntries {
+		m, ok := set[subEntry.NatgatewayId]
+		if !ok {
+			log.Warningf("nat gateway %s of dnat entry %s(%s) is not present", subEntry.NatgatewayId, subEntry.Name, subEntry.Id)
+			delete(subEntries, subId)
+			continue
+		}
+		subEntry.NatGateway = m
+		m.NatDEntries[subEntry.Id] = subEntry
+	}
+	return true
+}
+
+func (set NatSEntries) ModelManager() mcclient_modulebase.IBaseManager {
+	return &mcclient_modules.NatSTable
+}
+
+func (set NatSEntries) DBModelManager() db.IModelManager {
+	return models.NatSEntryManager
+}
+
+func (set NatSEntries) NewModel() db.IModel {
+	return &NatSEntry{}
+}
+
+func (set NatSEntries) AddModel(i db.IModel) {
+	m := i.(*NatSEntry)
+	set[m.Id] = m
+}
+
+func (set NatSEntries) Copy() apihelper.IModelSet {
+	setCopy := NatSEntries{}
+	for id, el := range set {
+		setCopy[id] = el.Copy()
+	}
+	return setCopy
+}
+
+func (set NatSEntries) ModelFilter() []string {
+	return []string{"external_id.isnullorempty()"}
+}
+
+func (set NatDEntries) ModelManager() mcclient_modulebase.IBaseManager {
+	return &mcclient_modules.NatDTable
+}
+
+func (set NatDEntries) DBModelManager() db.IModelManager {
+	return models.NatDEntryManager
+}
+
+func (set NatDEntries) NewModel() db.IModel {
+	return &NatDEntry{}
+}
+
+func (set NatDEntries) AddModel(i db.IModel) {
+	m := i.(*NatDEntry)
+	set[m.Id] = m
+}
+
+func (set NatDEntries) Copy() apihelper.IModelSet {
+	setCopy := NatDEntries{}
+	for id, el := range set {
+		setCopy[id] = el.Copy()
+	}
+	return setCopy
+}
+
+func (set NatDEntries) ModelFilter() []string {
+	return []string{"external_id.isnullorempty()"}
+}
+
+func (set VpcPeeringConnections) ModelManager() mcclient_modulebase.IBaseManager {
+	return &mcclient_modules.VpcPeeringConnections
+}
+
+func (set VpcPeeringConnections) DBModelManager() db.IModelManager {
+	return models.VpcPeeringConnectionManager
+}
+
+func (set VpcPeeringConnections) NewModel() db.IModel {
+	return &VpcPeeringConnection{}
+}
+
+func (set VpcPeeringConnections) AddModel(i db.IModel) {
+	m := i.(*VpcPeeringConnection)
+	set[m.Id] = m
+}
+
+func (set VpcPeeringConnections) Copy() apihelper.IModelSet {
+	setCopy := VpcPeeringConnections{}
+	for id, el := range set {
+		setCopy[id] = el.Copy()
+	}
+	return setCopy
+}
+
+func (set VpcPeeringConnections) ModelFilter() []string {
+	return []string{"external_id.isnullorempty()"}
+}
+
+func (set NetTapServices) ModelManager() mcclient_modulebase.IBaseManager {
+	return &mcclient_modules.NetTapServices
+}
+
+func (set NetTapServices) DBModelManager() db.IModelManager {
+	return models.NetTapServiceManager
+}
+
+func (set NetTapServices) NewModel() db.IModel {
+	return &NetTapService{}
+}
+
+func (set NetTapServices) AddModel(i db.IModel) {
+	m := i.(*NetTapService)
+	set[m.Id] = m
+}
+
+func (set NetTapServices) Copy() apihelper.IModelSet {
+	setCopy := NetTapServices{}
+	for id, el := range set {
+		setCopy[id] = el.Copy()
+	}
+	return setCopy
+}
+
+func (set NetTapServices) joinGuests(subEntries Guests) bool {
+	for _, m := range set {
+		m.Guest = nil
+		if m.Type != computeapis.TapServiceGuest {
+			continue
+		}
+		guest, ok := subEntries[m.TargetId]
+		if !ok {
+			// the guest could be pending_deleted
+			log.Warningf("guest %s of tap service %s(%s) is not present", m.TargetId, m.Name, m.Id)
+			continue
+		}
+		m.Guest = guest
+	}
+	return true
+}
+
+func (set NetTapFlows) ModelManager() mcclient_modulebase.IBaseManager {
+	return &mcclient_modules.NetTapFlows
+}
+
+func (set NetTapFlows) DBModelManager() db.IModelManager {
+	return models.NetTapFlowManager
+}
+
+func (set NetTapFlows) NewModel() db.IModel {
+	return &NetTapFlow{}
+}
+
+func (set NetTapFlows) AddModel(i db.IModel) {
+	m := i.(*NetTapFlow)
+	set[m.Id] = m
+}
+
+func (set NetTapFlows) Copy() apihelper.IModelSet {
+	setCopy := NetTapFlows{}
+	for id, el := range set {
+		setCopy[id] = el.Copy()
+	}
+	return setCopy
+}
+
+func (set NetTapFlows) joinNetTapServices(subEntries NetTapServices) bool {
+	for subId, m := range set {
+		srv, ok := subEntries[m.TapId]
+		if !ok {
+			log.Warningf("tap service %s of tap flow %s(%s) is not present", m.TapId, m.Name, m.Id)
+			delete(set, subId)
+			continue
+		}
+		m.NetTapService = srv
+	}
+	return true
+}
+
+func (set NetTapFlows) joinGuestnetworks(subEntries Guests) bool {
+	for _, m := range set {
+		m.Guestnetwork = nil
+		if m.Type != computeapis.TapFlowGuestNic {
+			continue
+		}
+		guest, ok := subEntries[m.SourceId]
+		if !ok {
+			continue
+		}
+		for _, gn := range guest.Guestnetworks {
+			if gn.MacAddr == m.MacAddr && gn.NetworkId == m.NetId {
+				m.Guestnetwork = gn
+				break
+			}
+		}
+	}
+	return true
+}
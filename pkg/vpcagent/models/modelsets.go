@@ -50,6 +50,15 @@ type ModelSetsMaxUpdatedAt struct {
 	LoadbalancerNetworks  time.Time
 	LoadbalancerListeners time.Time
 	LoadbalancerAcls      time.Time
+
+	NatGateways time.Time
+	NatSEntries time.Time
+	NatDEntries time.Time
+
+	VpcPeeringConnections time.Time
+
+	NetTapServices time.Time
+	NetTapFlows    time.Time
 }
 
 func NewModelSetsMaxUpdatedAt() *ModelSetsMaxUpdatedAt {
@@ -77,6 +86,15 @@ func NewModelSetsMaxUpdatedAt() *ModelSetsMaxUpdatedAt {
 		LoadbalancerNetworks:  apihelper.PseudoZeroTime,
 		LoadbalancerListeners: apihelper.PseudoZeroTime,
 		LoadbalancerAcls:      apihelper.PseudoZeroTime,
+
+		NatGateways: apihelper.PseudoZeroTime,
+		NatSEntries: apihelper.PseudoZeroTime,
+		NatDEntries: apihelper.PseudoZeroTime,
+
+		VpcPeeringConnections: apihelper.PseudoZeroTime,
+
+		NetTapServices: apihelper.PseudoZeroTime,
+		NetTapFlows:    apihelper.PseudoZeroTime,
 	}
 }
 
@@ -105,6 +123,15 @@ type ModelSets struct {
 	LoadbalancerNetworks  LoadbalancerNetworks
 	LoadbalancerListeners LoadbalancerListeners
 	LoadbalancerAcls      LoadbalancerAcls
+
+	NatGateways NatGateways
+	NatSEntries NatSEntries
+	NatDEntries NatDEntries
+
+	VpcPeeringConnections VpcPeeringConnections
+
+	NetTapServices NetTapServices
+	NetTapFlows    NetTapFlows
 }
 
 func NewModelSets() *ModelSets {
@@ -133,6 +160,15 @@ func NewModelSets() *ModelSets {
 		LoadbalancerNetworks:  LoadbalancerNetworks{},
 		LoadbalancerListeners: LoadbalancerListeners{},
 		LoadbalancerAcls:      LoadbalancerAcls{},
+
+		NatGateways: NatGateways{},
+		NatSEntries: NatSEntries{},
+		NatDEntries: NatDEntries{},
+
+		VpcPeeringConnections: VpcPeeringConnections{},
+
+		NetTapServices: NetTapServices{},
+		NetTapFlows:    NetTapFlows{},
 	}
 }
 
@@ -163,6 +199,15 @@ func (mss *ModelSets) ModelSetList() []apihelper.IModelSet {
 		mss.LoadbalancerNetworks,
 		mss.LoadbalancerListeners,
 		mss.LoadbalancerAcls,
+
+		mss.NatGateways,
+		mss.NatSEntries,
+		mss.NatDEntries,
+
+		mss.VpcPeeringConnections,
+
+		mss.NetTapServices,
+		mss.NetTapFlows,
 	}
 }
 
@@ -196,6 +241,15 @@ func (mss *ModelSets) copy_() *ModelSets {
 		LoadbalancerNetworks:  mss.LoadbalancerNetworks.Copy().(LoadbalancerNetworks),
 		LoadbalancerListeners: mss.LoadbalancerListeners.Copy().(LoadbalancerListeners),
 		LoadbalancerAcls:      mss.LoadbalancerAcls.Copy().(LoadbalancerAcls),
+
+		NatGateways: mss.NatGateways.Copy().(NatGateways),
+		NatSEntries: mss.NatSEntries.Copy().(NatSEntries),
+		NatDEntries: mss.NatDEntries.Copy().(NatDEntries),
+
+		VpcPeeringConnections: mss.VpcPeeringConnections.Copy().(VpcPeeringConnections),
+
+		NetTapServices: mss.NetTapServices.Copy().(NetTapServices),
+		NetTapFlows:    mss.NetTapFlows.Copy().(NetTapFlows),
 	}
 	return mssCopy
 }
@@ -289,6 +343,22 @@ func (mss *ModelSets) join() bool {
 	msg = append(msg, "mss.LoadbalancerNetworks.joinLoadbalancerListeners(mss.LoadbalancerListeners)")
 	p = append(p, mss.LoadbalancerListeners.joinLoadbalancerAcls(mss.LoadbalancerAcls))
 	msg = append(msg, "mss.LoadbalancerListeners.joinLoadbalancerAcls(mss.LoadbalancerAcls)")
+	p = append(p, mss.Vpcs.joinNatGateways(mss.NatGateways))
+	msg = append(msg, "mss.Vpcs.joinNatGateways(mss.NatGateways)")
+	p = append(p, mss.NatGateways.joinElasticips(mss.Elasticips))
+	msg = append(msg, "mss.NatGateways.joinElasticips(mss.Elasticips)")
+	p = append(p, mss.NatGateways.joinNatSEntries(mss.NatSEntries))
+	msg = append(msg, "mss.NatGateways.joinNatSEntries(mss.NatSEntries)")
+	p = append(p, mss.NatGateways.joinNatDEntries(mss.NatDEntries))
+	msg = append(msg, "mss.NatGateways.joinNatDEntries(mss.NatDEntries)")
+	p = append(p, mss.Vpcs.joinVpcPeeringConnections(mss.VpcPeeringConnections))
+	msg = append(msg, "mss.Vpcs.joinVpcPeeringConnections(mss.VpcPeeringConnections)")
+	p = append(p, mss.NetTapServices.joinGuests(mss.Guests))
+	msg = append(msg, "mss.NetTapServices.joinGuests(mss.Guests)")
+	p = append(p, mss.NetTapFlows.joinNetTapServices(mss.NetTapServices))
+	msg = append(msg, "mss.NetTapFlows.joinNetTapServices(mss.NetTapServices)")
+	p = append(p, mss.NetTapFlows.joinGuestnetworks(mss.Guests))
+	msg = append(msg, "mss.NetTapFlows.joinGuestnetworks(mss.Guests)")
 	p = append(p, mss.DnsZones.joinRecords(mss.DnsRecords))
 	msg = append(msg, "mss.Vpcs.joinRecords(mss.DnsRecords)")
 	ret := true
@@ -15,14 +15,19 @@
 package models
 
 import (
-	"sort"
-
 	"yunion.io/x/pkg/util/secrules"
 
 	compute_models "yunion.io/x/onecloud/pkg/compute/models"
 )
 
-func (el *Guest) OrderedSecurityGroupRules() []*SecurityGroupRule {
+const (
+	SecurityGroupRuleBasePriority      = 100
+	AdminSecurityGroupRuleBasePriority = 1000
+)
+
+// ImplicitSecurityGroupRules returns rules applied to all guest nics before
+// those from security groups
+func ImplicitSecurityGroupRules(aclLog bool) []*SecurityGroupRule {
 	// deny any incoming traffic and allow ARP
 	rs := []*SecurityGroupRule{
 		{
@@ -43,21 +48,33 @@ func (el *Guest) OrderedSecurityGroupRules() []*SecurityGroupRule {
 			},
 		},
 	}
-	for _, secgroup := range el.SecurityGroups {
-		rs = append(rs, secgroup.securityGroupRules(100)...)
-	}
-	if el.AdminSecurityGroup != nil {
-		rs = append(rs, el.AdminSecurityGroup.securityGroupRules(1000)...)
+	for _, r := range rs {
+		r.AclLog = aclLog
 	}
-	sort.Slice(rs, SecurityGroupRuleLessFunc(rs))
 	return rs
 }
 
-func (el *SecurityGroup) securityGroupRules(basePriority int64) []*SecurityGroupRule {
+// SecurityGroupAclLog tells whether hits of the implicit rules should be
+// logged, which is the case when any security group of the guest has it
+func (el *Guest) SecurityGroupAclLog() bool {
+	for _, secgroup := range el.SecurityGroups {
+		if secgroup.AclLog {
+			return true
+		}
+	}
+	return false
+}
+
+// PrioritizedRules returns copies of rules with priority offset by
+// basePriority
+func (el *SecurityGroup) PrioritizedRules(basePriority int64) []*SecurityGroupRule {
 	rs := make([]*SecurityGroupRule, 0, len(el.SecurityGroupRules))
 	for _, r := range el.SecurityGroupRules {
 		r = r.Copy()
 		r.Priority += int(basePriority)
+		if el.AclLog {
+			r.AclLog = true
+		}
 		rs = append(rs, r)
 	}
 	return rs
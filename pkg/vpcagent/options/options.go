@@ -43,6 +43,13 @@ type VpcAgentOptions struct {
 	OvnNorthDatabase       string `help:"address for accessing ovn north database.  Default to local unix socket"`
 	OvnUnderlayMtu         int    `help:"mtu of ovn underlay network" default:"1500"`
 
+	OvnNatGatewayChassis     []string `help:"chassis names to host nat gateway ports, in descending order of priority"`
+	OvnNatGatewayNetworkName string   `help:"provider network name of the localnet port for nat gateways, must be present in ovn-bridge-mappings of gateway chassis" default:"natgw"`
+
+	OvnAclLogRate int `help:"max number of security group acl log entries per second of each chassis" default:"100"`
+
+	EnableOvnMirror bool `help:"mirror traffic of tap flows created with enable_ovn_tap_mirror of region with ovn mirrors, requires ovn 25.03 or later" default:"false"`
+
 	DhcpLeaseTime   int `default:"100663296" help:"DHCP lease time in seconds"`
 	DhcpRenewalTime int `default:"67108864" help:"DHCP renewal time in seconds"`
 
@@ -77,6 +84,10 @@ func (opts *Options) ValidateThenInit() error {
 		opts.OvnUnderlayMtu = 576
 	}
 
+	if opts.OvnAclLogRate <= 0 {
+		opts.OvnAclLogRate = 1
+	}
+
 	return nil
 }
 
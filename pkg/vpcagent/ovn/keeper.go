@@ -45,6 +45,12 @@ const (
 type OVNNorthboundKeeper struct {
 	DB  ovn_nb.OVNNorthbound
 	cli *ovnutil.OvnNbCtl
+
+	// uuids of Logical_Router_Policy rows claimed in this round, the table
+	// has no external_ids to carry the version mark
+	claimedPolicies map[string]bool
+	// names of security group port groups known to exist in this round
+	claimedPgs map[string]bool
 }
 
 func DumpOVNNorthbound(ctx context.Context, cli *ovnutil.OvnNbCtl) (*OVNNorthboundKeeper, error) {
@@ -59,6 +65,13 @@ func DumpOVNNorthbound(ctx context.Context, cli *ovnutil.OvnNbCtl) (*OVNNorthbou
 		&db.DHCPOptions,
 		&db.QoS,
 		&db.DNS,
+		&db.NAT,
+		&db.GatewayChassis,
+		&db.LoadBalancer,
+		&db.Meter,
+		&db.PortGroup,
+		&db.AddressSet,
+		&db.LogicalRouterPolicy,
 	}
 	args := []string{"--format=json", "list", "<tbl>"}
 	for _, itbl := range itbls {
@@ -73,6 +86,9 @@ func DumpOVNNorthbound(ctx context.Context, cli *ovnutil.OvnNbCtl) (*OVNNorthbou
 	keeper := &OVNNorthboundKeeper{
 		DB:  db,
 		cli: cli,
+
+		claimedPolicies: map[string]bool{},
+		claimedPgs:      map[string]bool{},
 	}
 	return keeper, nil
 }
@@ -259,6 +275,33 @@ func (keeper *OVNNorthboundKeeper) ClaimVpc(ctx context.Context, vpc *agentmodel
 	return keeper.cli.Must(ctx, "ClaimVpc", args)
 }
 
+// ClaimAclLogMeter makes the meter referenced by acls of security group
+// rules with logging enabled.  The rate is kept in external_ids so that a
+// change of OvnAclLogRate replaces the meter
+func (keeper *OVNNorthboundKeeper) ClaimAclLogMeter(ctx context.Context, opts *options.Options) error {
+	rate := fmt.Sprintf("%d", opts.OvnAclLogRate)
+	meter := &ovn_nb.Meter{
+		Name: aclLogMeterName,
+		Unit: "pktps",
+		ExternalIds: map[string]string{
+			externalKeyAclLogRate: rate,
+		},
+	}
+	band := &ovn_nb.MeterBand{
+		Action: "drop",
+		Rate:   int64(opts.OvnAclLogRate),
+	}
+	allFound, args := cmp(&keeper.DB, rate, meter)
+	if allFound {
+		return nil
+	}
+	args = append(args, ovnCreateArgs(band, "aclLogBand")...)
+	meter.Bands = []string{"@aclLogBand"}
+	args = append(args, ovnCreateArgs(meter, "aclLogMeter")...)
+	keeper.cli.Must(ctx, "ClaimAclLogMeter", args)
+	return nil
+}
+
 func (keeper *OVNNorthboundKeeper) ClaimNetwork(ctx context.Context, network *agentmodels.Network, opts *options.Options) error {
 	var (
 		vpc   = network.Vpc
@@ -583,7 +626,6 @@ func (keeper *OVNNorthboundKeeper) ClaimGuestnetwork(ctx context.Context, guestn
 		lportName       = gnpName(guestnetwork.NetworkId, guestnetwork.Ifname)
 		ocVersion       = fmt.Sprintf("%s.%d", guestnetwork.UpdatedAt, guestnetwork.UpdateVersion)
 		ocGnrDefaultRef = fmt.Sprintf("gnrDefault/%s/%s/%s", vpc.Id, guestnetwork.GuestId, guestnetwork.Ifname)
-		ocAclRef        = fmt.Sprintf("acl/%s/%s/%s", network.Id, guestnetwork.GuestId, guestnetwork.Ifname)
 		ocQosRef        = fmt.Sprintf("qos/%s/%s/%s", network.Id, guestnetwork.GuestId, guestnetwork.Ifname)
 		ocQosEipRef     = fmt.Sprintf("qos-eip/%s/%s/%s/v2", vpc.Id, guestnetwork.GuestId, guestnetwork.Ifname)
 	)
@@ -739,27 +781,6 @@ func (keeper *OVNNorthboundKeeper) ClaimGuestnetwork(ctx context.Context, guestn
 		}
 	}
 
-	var acls []*ovn_nb.ACL
-	{
-		enableIPv6 := false
-		if len(guestnetwork.Ip6Addr) > 0 {
-			enableIPv6 = true
-		}
-		sgrs := guest.OrderedSecurityGroupRules()
-		for _, sgr := range sgrs {
-			// kvm not support peer secgroup
-			acl, err := ruleToAcl(lportName, sgr, enableIPv6)
-			if err != nil {
-				log.Errorf("converting security group rule to acl: %v", err)
-				break
-			}
-			acl.ExternalIds = map[string]string{
-				externalKeyOcRef: ocAclRef,
-			}
-			acls = append(acls, acl)
-		}
-	}
-
 	irows := []types.IRow{
 		gnp,
 		dhcpOpt,
@@ -770,9 +791,6 @@ func (keeper *OVNNorthboundKeeper) ClaimGuestnetwork(ctx context.Context, guestn
 	if gnrDefault != nil {
 		irows = append(irows, gnrDefault)
 	}
-	for _, acl := range acls {
-		irows = append(irows, acl)
-	}
 	for _, qos := range qosVif {
 		irows = append(irows, qos)
 	}
@@ -784,6 +802,16 @@ func (keeper *OVNNorthboundKeeper) ClaimGuestnetwork(ctx context.Context, guestn
 		return nil
 	}
 
+	pgNames := guestnetworkPgNames(guestnetwork)
+	for _, pgName := range pgNames {
+		if !keeper.claimedPgs[pgName] {
+			// the port is created in the same transaction as its port group
+			// membership, and is left to the next round rather than created
+			// without acls of its security groups
+			return errors.Errorf("port group %s of %s is not claimed", pgName, lportName)
+		}
+	}
+
 	args = append(args, ovnCreateArgs(gnp, gnp.Name)...)
 	args = append(args, ovnCreateArgs(dhcpOpt, dhcpOptName)...)
 	args = append(args, "--", "add", "Logical_Switch_Port", gnp.Name, "dhcpv4_options", "@"+dhcpOptName)
@@ -796,10 +824,8 @@ func (keeper *OVNNorthboundKeeper) ClaimGuestnetwork(ctx context.Context, guestn
 		args = append(args, ovnCreateArgs(gnrDefault, "gnrDefault")...)
 		args = append(args, "--", "add", "Logical_Router", vpcExtLrName(vpc.Id), "static_routes", "@gnrDefault")
 	}
-	for i, acl := range acls {
-		ref := fmt.Sprintf("acl%d", i)
-		args = append(args, ovnCreateArgs(acl, ref)...)
-		args = append(args, "--", "add", "Logical_Switch", netLsName(guestnetwork.NetworkId), "acls", "@"+ref)
+	for _, pgName := range pgNames {
+		args = append(args, "--", "add", "Port_Group", pgName, "ports", "@"+gnp.Name)
 	}
 	for i, qos := range qosVif {
 		ref := fmt.Sprintf("qosVif%d", i)
@@ -812,7 +838,8 @@ func (keeper *OVNNorthboundKeeper) ClaimGuestnetwork(ctx context.Context, guestn
 		args = append(args, ovnCreateArgs(qosEipOut, "qosEipOut")...)
 		args = append(args, "--", "add", "Logical_Switch", vpcEipLsName(vpc.Id), "qos_rules", "@qosEipOut")
 	}
-	return keeper.cli.Must(ctx, "ClaimGuestnetwork", args)
+	keeper.cli.Must(ctx, "ClaimGuestnetwork", args)
+	return nil
 }
 
 func (keeper *OVNNorthboundKeeper) ClaimRoutes(ctx context.Context, vpc *agentmodels.Vpc, routes resolvedRoutes) error {
@@ -1216,12 +1243,20 @@ func (keeper *OVNNorthboundKeeper) Mark(ctx context.Context) {
 		&db.DHCPOptions,
 		&db.QoS,
 		&db.DNS,
+		&db.NAT,
+		&db.GatewayChassis,
+		&db.LoadBalancer,
+		&db.Meter,
+		&db.PortGroup,
+		&db.AddressSet,
 	}
 	for _, itbl := range itbls {
 		for _, irow := range itbl.Rows() {
 			irow.RemoveExternalId(externalKeyOcVersion)
 		}
 	}
+	keeper.claimedPolicies = map[string]bool{}
+	keeper.claimedPgs = map[string]bool{}
 }
 
 func (keeper *OVNNorthboundKeeper) Sweep(ctx context.Context) error {
@@ -1234,6 +1269,10 @@ func (keeper *OVNNorthboundKeeper) Sweep(ctx context.Context) error {
 		&db.LogicalRouter,
 		&db.DHCPOptions,
 		&db.DNS,
+		&db.LoadBalancer,
+		&db.Meter,
+		&db.PortGroup,
+		&db.AddressSet,
 	}
 	var irows []types.IRow
 	for _, itbl := range itbls {
@@ -1271,12 +1310,52 @@ func (keeper *OVNNorthboundKeeper) Sweep(ctx context.Context) error {
 				for _, ls := range db.LogicalSwitch.FindACLReferrer_acls(irow.OvsdbUuid()) {
 					args = append(args, "--", "--if-exists", "remove", "Logical_Switch", ls.Name, "acls", irow.OvsdbUuid())
 				}
+				for _, pg := range db.PortGroup.FindACLReferrer_acls(irow.OvsdbUuid()) {
+					args = append(args, "--", "--if-exists", "remove", "Port_Group", pg.Name, "acls", irow.OvsdbUuid())
+				}
 			}
 		}
 		if len(args) > 0 {
 			keeper.cli.Must(ctx, "Sweep acls", args)
 		}
 	}
+	{
+		var args []string
+		for _, irow := range db.NAT.Rows() {
+			_, ok := irow.GetExternalId(externalKeyOcVersion)
+			if !ok {
+				for _, lr := range db.LogicalRouter.FindNATReferrer_nat(irow.OvsdbUuid()) {
+					args = append(args, "--", "--if-exists", "remove", "Logical_Router", lr.Name, "nat", irow.OvsdbUuid())
+				}
+			}
+		}
+		for _, irow := range db.GatewayChassis.Rows() {
+			_, ok := irow.GetExternalId(externalKeyOcVersion)
+			if !ok {
+				for _, lrp := range db.LogicalRouterPort.FindGatewayChassisReferrer_gateway_chassis(irow.OvsdbUuid()) {
+					args = append(args, "--", "--if-exists", "remove", "Logical_Router_Port", lrp.Name, "gateway_chassis", irow.OvsdbUuid())
+				}
+			}
+		}
+		if len(args) > 0 {
+			keeper.cli.Must(ctx, "Sweep nat", args)
+		}
+	}
+	{
+		var args []string
+		for _, irow := range db.LogicalRouterPolicy.Rows() {
+			row := irow.(*ovn_nb.LogicalRouterPolicy)
+			if row.Priority != natgwPolicyPriority || keeper.claimedPolicies[row.Uuid] {
+				continue
+			}
+			for _, lr := range db.LogicalRouter.FindLogicalRouterPolicyReferrer_policies(row.Uuid) {
+				args = append(args, "--", "--if-exists", "remove", "Logical_Router", lr.Name, "policies", row.Uuid)
+			}
+		}
+		if len(args) > 0 {
+			keeper.cli.Must(ctx, "Sweep router policies", args)
+		}
+	}
 	{ //  remove unused QoS rows
 		var args []string
 		for _, irow := range db.QoS.Rows() {
@@ -50,3 +50,11 @@ func HashSubnetDhcpMac(netId string) string {
 func HashSubnetMetadataMac(netId string) string {
 	return HashMac(netId, "md")
 }
+
+func HashNatGatewayMac(natgwId string) string {
+	return HashMac(natgwId, "natgw")
+}
+
+func HashVpcPeeringMac(peerId string, vpcId string) string {
+	return HashMac(peerId, vpcId, "peer")
+}
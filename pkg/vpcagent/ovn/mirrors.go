@@ -0,0 +1,345 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovn
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"yunion.io/x/log"
+	"yunion.io/x/ovsdb/cli_util"
+	"yunion.io/x/ovsdb/types"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/utils"
+
+	apis "yunion.io/x/onecloud/pkg/apis/compute"
+	agentmodels "yunion.io/x/onecloud/pkg/vpcagent/models"
+)
+
+const (
+	// externalKeyOcMirror holds the signature of a claimed mirror, a row
+	// whose signature differs is replaced
+	externalKeyOcMirror = "oc-mirror"
+
+	tapMirrorRulePriority = 100
+
+	tapMirrorTypeLport = "lport"
+)
+
+// tapMirror is a Mirror row desired for a tap flow on a vpc guest nic
+type tapMirror struct {
+	name  string
+	flow  string
+	lport string
+
+	typ    string
+	sink   string
+	filter string
+	index  int
+	// match of the Mirror_Rule, empty to mirror all packets of lport
+	match string
+}
+
+func (m *tapMirror) signature() string {
+	return fmt.Sprintf("%s/%s/%s/%d/%s", m.typ, m.sink, m.filter, m.index, m.match)
+}
+
+// ovnMirror is a row of the Mirror table
+type ovnMirror struct {
+	Uuid        string
+	Name        string
+	ExternalIds map[string]string
+	// MirrorRules is empty for ovn before 25.03
+	MirrorRules []string
+}
+
+func tapMirrorFilter(direction string) string {
+	switch direction {
+	case apis.TapFlowDirectionIn:
+		// packets sent to the guest nic
+		return "to-lport"
+	case apis.TapFlowDirectionOut:
+		return "from-lport"
+	default:
+		return "both"
+	}
+}
+
+func tapMirrorMatch(protocol string, cidr string) string {
+	var (
+		parts []string
+		af    string
+	)
+	if cidr != "" {
+		af = "ip4"
+		if strings.Contains(cidr, ":") {
+			af = "ip6"
+		}
+		parts = append(parts, fmt.Sprintf("(%s.src == %s || %s.dst == %s)", af, cidr, af, cidr))
+	}
+	switch protocol {
+	case apis.TapFlowProtocolTcp:
+		parts = append(parts, "tcp")
+	case apis.TapFlowProtocolUdp:
+		parts = append(parts, "udp")
+	case apis.TapFlowProtocolIcmp:
+		switch af {
+		case "ip4":
+			parts = append(parts, "icmp4")
+		case "ip6":
+			parts = append(parts, "icmp6")
+		default:
+			parts = append(parts, "(icmp4 || icmp6)")
+		}
+	}
+	return strings.Join(parts, " && ")
+}
+
+// resolveTapMirrors returns mirrors of enabled tap flows on guest nics in
+// vpc networks that are marked as ovn mirrors, ordered by flow id.  The
+// other flows, including those to host tap services, are mirrored by host
+// agents on br-vpc.
+//
+// Packets mirrored to a guest tap service are delivered by ovn to the nic of
+// the tap guest in the same network and can be filtered by protocol and
+// cidr.  Packets mirrored to a remote tap service are encapsulated in gre or
+// erspan by the chassis of the mirrored port
+func resolveTapMirrors(flows agentmodels.NetTapFlows) []*tapMirror {
+	flowIds := make([]string, 0, len(flows))
+	for id := range flows {
+		flowIds = append(flowIds, id)
+	}
+	sort.Strings(flowIds)
+
+	mirrors := make([]*tapMirror, 0, len(flowIds))
+	for _, id := range flowIds {
+		flow := flows[id]
+		if flow.Type != apis.TapFlowGuestNic || !flow.OvnMirror || !flow.Enabled.IsTrue() {
+			continue
+		}
+		var (
+			srv = flow.NetTapService
+			gn  = flow.Guestnetwork
+		)
+		if srv == nil || !srv.Enabled.IsTrue() || gn == nil || gn.Guest == nil {
+			continue
+		}
+		if gn.Network == nil || gn.Network.Vpc == nil || gn.Network.Vpc.Id == apis.DEFAULT_VPC_ID {
+			// classic nics are mirrored by host agents
+			continue
+		}
+		m := &tapMirror{
+			name:   tapMirrorName(flow.Id),
+			flow:   flow.Id,
+			lport:  gnpName(gn.NetworkId, gn.Ifname),
+			filter: tapMirrorFilter(flow.Direction),
+		}
+		switch srv.Type {
+		case apis.TapServiceGuest:
+			if srv.Guest == nil {
+				continue
+			}
+			var sinkGn *agentmodels.Guestnetwork
+			for _, tgn := range srv.Guest.Guestnetworks {
+				if tgn.NetworkId != gn.NetworkId {
+					continue
+				}
+				if sinkGn == nil || tgn.RowId < sinkGn.RowId {
+					sinkGn = tgn
+				}
+			}
+			if sinkGn == nil {
+				log.Warningf("tap flow %s(%s): guest %s of tap service has no nic in network %s",
+					flow.Name, flow.Id, srv.TargetId, gn.NetworkId)
+				continue
+			}
+			m.typ = tapMirrorTypeLport
+			m.sink = gnpName(sinkGn.NetworkId, sinkGn.Ifname)
+			m.match = tapMirrorMatch(flow.Protocol, flow.Cidr)
+		case apis.TapServiceRemote:
+			m.typ = srv.Encap
+			m.sink = srv.RemoteIp
+			m.index = srv.TunnelKey
+		default:
+			continue
+		}
+		mirrors = append(mirrors, m)
+	}
+	return mirrors
+}
+
+func (keeper *OVNNorthboundKeeper) listRows(ctx context.Context, tbl string, columns ...string) (*cli_util.List, error) {
+	args := []string{"--format=json"}
+	if len(columns) > 0 {
+		args = append(args, "--columns="+strings.Join(columns, ","))
+	}
+	args = append(args, "list", tbl)
+	res := keeper.cli.Must(ctx, "List "+tbl, args)
+	list := &cli_util.List{}
+	if err := json.Unmarshal([]byte(res.Output), list); err != nil {
+		return nil, errors.Wrapf(err, "Unmarshal %s:\n%s", tbl, res.Output)
+	}
+	if len(columns) > 0 && len(list.Headings) != len(columns) {
+		return nil, errors.Errorf("list %s: want columns %v, got %v", tbl, columns, list.Headings)
+	}
+	return list, nil
+}
+
+// dumpMirrors lists Mirror rows and the mirror_rules of each
+// Logical_Switch_Port.  Both columns are absent from the vendored schema and
+// are parsed here.  It is called after guest ports are claimed, so the refs
+// of recreated ports are current
+func (keeper *OVNNorthboundKeeper) dumpMirrors(ctx context.Context) ([]*ovnMirror, map[string][]string, error) {
+	// all columns are listed, mirror_rules is absent before ovn 25.03
+	mirrorList, err := keeper.listRows(ctx, "Mirror")
+	if err != nil {
+		return nil, nil, err
+	}
+	colIdx := map[string]int{}
+	for i, heading := range mirrorList.Headings {
+		colIdx[heading] = i
+	}
+	for _, col := range []string{"_uuid", "name", "external_ids"} {
+		if _, ok := colIdx[col]; !ok {
+			return nil, nil, errors.Errorf("list Mirror: no column %s in %v", col, mirrorList.Headings)
+		}
+	}
+	mirrors := make([]*ovnMirror, 0, len(mirrorList.Data))
+	for _, row := range mirrorList.Data {
+		m := &ovnMirror{
+			Uuid:        types.EnsureUuid(row[colIdx["_uuid"]]),
+			Name:        types.EnsureString(row[colIdx["name"]]),
+			ExternalIds: types.EnsureMapStringString(row[colIdx["external_ids"]]),
+		}
+		if idx, ok := colIdx["mirror_rules"]; ok {
+			m.MirrorRules = types.EnsureUuidMultiples(row[idx])
+		}
+		mirrors = append(mirrors, m)
+	}
+	lspList, err := keeper.listRows(ctx, "Logical_Switch_Port", "name", "mirror_rules")
+	if err != nil {
+		return nil, nil, err
+	}
+	lspRefs := make(map[string][]string, len(lspList.Data))
+	for _, row := range lspList.Data {
+		lspRefs[types.EnsureString(row[0])] = types.EnsureUuidMultiples(row[1])
+	}
+	return mirrors, lspRefs, nil
+}
+
+func tapMirrorCreateArgs(m *tapMirror, ref string) []string {
+	args := []string{"--", "--id=@" + ref, "create", "Mirror"}
+	args = append(args, types.OvsdbCmdArgsString("name", m.name)...)
+	args = append(args, types.OvsdbCmdArgsString("type", m.typ)...)
+	args = append(args, types.OvsdbCmdArgsString("sink", m.sink)...)
+	args = append(args, types.OvsdbCmdArgsString("filter", m.filter)...)
+	args = append(args, types.OvsdbCmdArgsInteger("index", int64(m.index))...)
+	args = append(args, types.OvsdbCmdArgsMapStringString("external_ids", map[string]string{
+		externalKeyOcRef:    m.flow,
+		externalKeyOcMirror: m.signature(),
+	})...)
+	if m.match == "" {
+		return args
+	}
+	ruleRef := ref + "Rule"
+	ruleArgs := []string{"--", "--id=@" + ruleRef, "create", "Mirror_Rule"}
+	ruleArgs = append(ruleArgs, types.OvsdbCmdArgsString("match", m.match)...)
+	ruleArgs = append(ruleArgs, types.OvsdbCmdArgsString("action", "mirror")...)
+	ruleArgs = append(ruleArgs, types.OvsdbCmdArgsInteger("priority", tapMirrorRulePriority)...)
+	args = append(args, "mirror_rules=@"+ruleRef)
+	return append(ruleArgs, args...)
+}
+
+// ClaimTapMirrors makes Mirror rows match mirrors and attaches them to the
+// mirrored ports.  Mirrors with oc-ref that are not claimed, including old
+// rows of changed mirrors, are detached and destroyed with their
+// Mirror_Rule rows.
+//
+// Mirror and the lport type with Mirror_Rule require OVN 25.03 or later.
+// When EnableOvnMirror is not set, it is called with no mirrors to sweep
+// the rows claimed before
+func (keeper *OVNNorthboundKeeper) ClaimTapMirrors(ctx context.Context, mirrors []*tapMirror) error {
+	if len(mirrors) == 0 {
+		res := keeper.cli.Run(ctx, []string{"--columns=_uuid", "list", "Mirror"})
+		if res.Err != nil {
+			// ovn without Mirror table has no rows to sweep
+			log.Debugf("list Mirror: %s", res.Error())
+			return nil
+		}
+	}
+	rows, lspRefs, err := keeper.dumpMirrors(ctx)
+	if err != nil {
+		return errors.Wrap(err, "dump mirrors")
+	}
+	rowsByName := make(map[string]*ovnMirror, len(rows))
+	for _, row := range rows {
+		rowsByName[row.Name] = row
+	}
+
+	var (
+		claimed = map[string]bool{}
+		creates []*tapMirror
+		attach  []string
+	)
+	for _, m := range mirrors {
+		refs, ok := lspRefs[m.lport]
+		if !ok {
+			// port of the guest nic is not created yet
+			continue
+		}
+		row := rowsByName[m.name]
+		if row == nil || row.ExternalIds[externalKeyOcMirror] != m.signature() {
+			creates = append(creates, m)
+			continue
+		}
+		claimed[row.Uuid] = true
+		if !utils.IsInStringArray(row.Uuid, refs) {
+			attach = append(attach, "--", "add", "Logical_Switch_Port", m.lport, "mirror_rules", row.Uuid)
+		}
+	}
+
+	// stale rows go first, a changed mirror is recreated with the same name
+	var sweep []string
+	for _, row := range rows {
+		if _, ok := row.ExternalIds[externalKeyOcRef]; !ok || claimed[row.Uuid] {
+			continue
+		}
+		for lsp, refs := range lspRefs {
+			if utils.IsInStringArray(row.Uuid, refs) {
+				sweep = append(sweep, "--", "--if-exists", "remove", "Logical_Switch_Port", lsp, "mirror_rules", row.Uuid)
+			}
+		}
+		sweep = append(sweep, "--", "--if-exists", "destroy", "Mirror", row.Uuid)
+		for _, rule := range row.MirrorRules {
+			sweep = append(sweep, "--", "--if-exists", "destroy", "Mirror_Rule", rule)
+		}
+	}
+	if len(sweep) > 0 {
+		keeper.cli.Must(ctx, "Sweep mirrors", sweep)
+	}
+	if len(attach) > 0 {
+		keeper.cli.Must(ctx, "ClaimTapMirrors attach", attach)
+	}
+	for _, m := range creates {
+		// one transaction each, the row ids do not span batches
+		args := tapMirrorCreateArgs(m, "tapMirror")
+		args = append(args, "--", "add", "Logical_Switch_Port", m.lport, "mirror_rules", "@tapMirror")
+		keeper.cli.Must(ctx, "ClaimTapMirrors", args)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovn
+
+import (
+	"testing"
+
+	"yunion.io/x/pkg/tristate"
+
+	apis "yunion.io/x/onecloud/pkg/apis/compute"
+	agentmodels "yunion.io/x/onecloud/pkg/vpcagent/models"
+)
+
+func TestTapMirrorMatch(t *testing.T) {
+	cases := []struct {
+		protocol string
+		cidr     string
+		want     string
+	}{
+		{apis.TapFlowProtocolAny, "", ""},
+		{apis.TapFlowProtocolTcp, "", "tcp"},
+		{apis.TapFlowProtocolIcmp, "", "(icmp4 || icmp6)"},
+		{apis.TapFlowProtocolAny, "10.0.0.0/8", "(ip4.src == 10.0.0.0/8 || ip4.dst == 10.0.0.0/8)"},
+		{apis.TapFlowProtocolIcmp, "fd00::/64", "(ip6.src == fd00::/64 || ip6.dst == fd00::/64) && icmp6"},
+		{apis.TapFlowProtocolUdp, "10.0.1.0/24", "(ip4.src == 10.0.1.0/24 || ip4.dst == 10.0.1.0/24) && udp"},
+	}
+	for _, c := range cases {
+		got := tapMirrorMatch(c.protocol, c.cidr)
+		if got != c.want {
+			t.Errorf("protocol %s cidr %q: want %q, got %q", c.protocol, c.cidr, c.want, got)
+		}
+	}
+}
+
+func TestResolveTapMirrors(t *testing.T) {
+	vpc := &agentmodels.Vpc{}
+	vpc.Id = "vpc-0"
+	network := &agentmodels.Network{Vpc: vpc}
+	network.Id = "net-0"
+
+	newGuestnetwork := func(guestId string, rowId int64, ifname string) *agentmodels.Guestnetwork {
+		guest := &agentmodels.Guest{Guestnetworks: agentmodels.Guestnetworks{}}
+		guest.Id = guestId
+		gn := &agentmodels.Guestnetwork{Guest: guest, Network: network}
+		gn.RowId = rowId
+		gn.GuestId = guestId
+		gn.NetworkId = network.Id
+		gn.Ifname = ifname
+		guest.Guestnetworks[ifname] = gn
+		return gn
+	}
+	srcGn := newGuestnetwork("guest-src", 1, "vnet-src")
+	sinkGn := newGuestnetwork("guest-ids", 2, "vnet-ids")
+
+	guestSrv := &agentmodels.NetTapService{Guest: sinkGn.Guest}
+	guestSrv.Id = "tap-guest"
+	guestSrv.Type = apis.TapServiceGuest
+	guestSrv.TargetId = sinkGn.GuestId
+	guestSrv.Enabled = tristate.True
+
+	remoteSrv := &agentmodels.NetTapService{}
+	remoteSrv.Id = "tap-remote"
+	remoteSrv.Type = apis.TapServiceRemote
+	remoteSrv.RemoteIp = "192.168.0.100"
+	remoteSrv.Encap = apis.TapServiceEncapErspan
+	remoteSrv.TunnelKey = 7
+	remoteSrv.Enabled = tristate.True
+
+	newFlow := func(id string, srv *agentmodels.NetTapService, direction string) *agentmodels.NetTapFlow {
+		flow := &agentmodels.NetTapFlow{
+			NetTapService: srv,
+			Guestnetwork:  srcGn,
+		}
+		flow.Id = id
+		flow.Type = apis.TapFlowGuestNic
+		flow.TapId = srv.Id
+		flow.Direction = direction
+		flow.Protocol = apis.TapFlowProtocolAny
+		flow.OvnMirror = true
+		flow.Enabled = tristate.True
+		return flow
+	}
+	flowGuest := newFlow("flow-0", guestSrv, apis.TapFlowDirectionIn)
+	flowGuest.Protocol = apis.TapFlowProtocolTcp
+	flowRemote := newFlow("flow-1", remoteSrv, apis.TapFlowDirectionBoth)
+	flowDisabled := newFlow("flow-2", remoteSrv, apis.TapFlowDirectionOut)
+	flowDisabled.Enabled = tristate.False
+
+	flows := agentmodels.NetTapFlows{
+		flowGuest.Id:    flowGuest,
+		flowRemote.Id:   flowRemote,
+		flowDisabled.Id: flowDisabled,
+	}
+	mirrors := resolveTapMirrors(flows)
+	if len(mirrors) != 2 {
+		t.Fatalf("want 2 mirrors, got %d", len(mirrors))
+	}
+	lport := gnpName(network.Id, srcGn.Ifname)
+	{
+		m := mirrors[0]
+		if m.name != tapMirrorName(flowGuest.Id) || m.lport != lport {
+			t.Errorf("guest mirror: bad name %s or lport %s", m.name, m.lport)
+		}
+		if m.typ != tapMirrorTypeLport || m.sink != gnpName(network.Id, sinkGn.Ifname) {
+			t.Errorf("guest mirror: want lport sink to tap guest nic, got %s %s", m.typ, m.sink)
+		}
+		if m.filter != "to-lport" || m.match != "tcp" {
+			t.Errorf("guest mirror: bad filter %s or match %q", m.filter, m.match)
+		}
+	}
+	{
+		m := mirrors[1]
+		if m.typ != apis.TapServiceEncapErspan || m.sink != remoteSrv.RemoteIp || m.index != remoteSrv.TunnelKey {
+			t.Errorf("remote mirror: bad type %s, sink %s or index %d", m.typ, m.sink, m.index)
+		}
+		if m.filter != "both" || m.match != "" {
+			t.Errorf("remote mirror: bad filter %s or match %q", m.filter, m.match)
+		}
+	}
+
+	// a changed target changes the signature
+	sig := mirrors[1].signature()
+	remoteSrv.TunnelKey = 8
+	if mirrors := resolveTapMirrors(flows); mirrors[1].signature() == sig {
+		t.Errorf("signature does not cover tunnel key")
+	}
+
+	// flows not marked as ovn mirrors are left to host agents on br-vpc
+	flowGuest.OvnMirror = false
+	if mirrors := resolveTapMirrors(flows); len(mirrors) != 1 || mirrors[0].flow != flowRemote.Id {
+		t.Errorf("want only the mirror of %s, got %d mirrors", flowRemote.Id, len(mirrors))
+	}
+
+	// classic nics are left to host agents
+	vpc.Id = apis.DEFAULT_VPC_ID
+	if mirrors := resolveTapMirrors(flows); len(mirrors) != 0 {
+		t.Errorf("want no mirrors for classic nics, got %d", len(mirrors))
+	}
+}
@@ -16,6 +16,7 @@ package ovn
 
 import (
 	"fmt"
+	"strings"
 )
 
 func vpcLrName(vpcId string) string {
@@ -81,6 +82,69 @@ func vpcEipLspName(vpcId string, eipgwId string) string {
 	return fmt.Sprintf("vpc-ep/%s/%s", vpcId, eipgwId)
 }
 
+// natgw
+func natgwLsName(natgwId string) string {
+	return fmt.Sprintf("natgw/%s", natgwId)
+}
+
+func natgwLnpName(natgwId string) string {
+	return fmt.Sprintf("natgw-ln/%s", natgwId)
+}
+
+func natgwRnpName(natgwId string) string {
+	return fmt.Sprintf("vpc-rn/%s", natgwId)
+}
+
+func natgwNrpName(natgwId string) string {
+	return fmt.Sprintf("vpc-nr/%s", natgwId)
+}
+
+func natgwGcName(natgwId string, chassis string) string {
+	return fmt.Sprintf("vpc-rn/%s/%s", natgwId, chassis)
+}
+
+func natgwLbName(natgwId string, proto string) string {
+	return fmt.Sprintf("natgw-lb/%s/%s", natgwId, proto)
+}
+
+// vpc peering
+func vpcPeerLsName(peerId string) string {
+	return fmt.Sprintf("vpc-peer/%s", peerId)
+}
+
+func vpcPeerRpName(peerId string, vpcId string) string {
+	return fmt.Sprintf("vpc-rp/%s/%s", peerId, vpcId)
+}
+
+func vpcPeerPrName(peerId string, vpcId string) string {
+	return fmt.Sprintf("vpc-pr/%s/%s", peerId, vpcId)
+}
+
+// security group port groups and address sets
+//
+// Their names are referred to in acl match and can only contain letters,
+// digits and underscores
+const (
+	sgDefaultPgName    = "pg_default"
+	sgDefaultLogPgName = "pg_default_log"
+)
+
+func ovnIdent(s string) string {
+	return strings.ReplaceAll(s, "-", "_")
+}
+
+func sgPgName(vpcId string, secgroupId string) string {
+	return ovnIdent(fmt.Sprintf("pg_%s_%s", vpcId, secgroupId))
+}
+
+func sgAdminPgName(vpcId string, secgroupId string) string {
+	return ovnIdent(fmt.Sprintf("pga_%s_%s", vpcId, secgroupId))
+}
+
+func sgAsName(vpcId string, secgroupId string, af string) string {
+	return ovnIdent(fmt.Sprintf("as_%s_%s_%s", vpcId, secgroupId, af))
+}
+
 func netLsName(netId string) string {
 	return fmt.Sprintf("subnet/%s", netId)
 }
@@ -114,3 +178,7 @@ func vipName(netId string, groupId string, ipaddr string) string {
 func lbpName(lbId string) string {
 	return fmt.Sprintf("iface/lb/%s", lbId)
 }
+
+func tapMirrorName(flowId string) string {
+	return fmt.Sprintf("tap/%s", flowId)
+}
@@ -0,0 +1,421 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovn
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"yunion.io/x/log"
+	"yunion.io/x/ovsdb/schema/ovn_nb"
+	"yunion.io/x/ovsdb/types"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/netutils"
+	"yunion.io/x/pkg/utils"
+
+	apis "yunion.io/x/onecloud/pkg/apis/compute"
+	agentmodels "yunion.io/x/onecloud/pkg/vpcagent/models"
+	"yunion.io/x/onecloud/pkg/vpcagent/options"
+	"yunion.io/x/onecloud/pkg/vpcagent/ovn/mac"
+)
+
+const (
+	// natgwPolicyPriority is the priority of router policies steering
+	// traffic covered by nat entries to the nat gateway
+	natgwPolicyPriority = 1000
+)
+
+type natGatewayRows struct {
+	ls       *ovn_nb.LogicalSwitch
+	lnp      *ovn_nb.LogicalSwitchPort
+	nrp      *ovn_nb.LogicalSwitchPort
+	rnp      *ovn_nb.LogicalRouterPort
+	gcs      []*ovn_nb.GatewayChassis
+	nats     []*ovn_nb.NAT
+	lbs      []*ovn_nb.LoadBalancer
+	policies []*ovn_nb.LogicalRouterPolicy
+}
+
+// ClaimNatGateway attaches the nat gateway to the vpc router through a
+// distributed gateway port bridged to the eip network, then programs snat
+// and dnat entries as NAT rules and load balancer vips on the vpc router.
+//
+// The gateway port is scheduled on chassis listed in
+// OvnNatGatewayChassis.  OVN moves it to the next chassis by priority when
+// the active one fails
+func (keeper *OVNNorthboundKeeper) ClaimNatGateway(ctx context.Context, natgw *agentmodels.NatGateway, peers agentmodels.VpcPeeringConnections, opts *options.Options) error {
+	var (
+		ocVersion = fmt.Sprintf("%s.%d", natgw.UpdatedAt, natgw.UpdateVersion)
+		lrName    = vpcLrName(natgw.Vpc.Id)
+	)
+	rows, err := buildNatGatewayRows(natgw, peers, opts)
+	if err != nil {
+		return err
+	}
+	if rows == nil {
+		// no eip bound yet
+		return nil
+	}
+
+	irows := []types.IRow{
+		rows.ls,
+		rows.lnp,
+		rows.nrp,
+		rows.rnp,
+	}
+	for _, gc := range rows.gcs {
+		irows = append(irows, gc)
+	}
+	for _, nat := range rows.nats {
+		irows = append(irows, nat)
+	}
+	for _, lb := range rows.lbs {
+		irows = append(irows, lb)
+	}
+	allFound, args := cmp(&keeper.DB, ocVersion, irows...)
+	policyArgs := keeper.claimRouterPolicies(lrName, rows.policies)
+	if allFound && len(policyArgs) == 0 {
+		return nil
+	}
+
+	if !allFound {
+		args = append(args, ovnCreateArgs(rows.ls, rows.ls.Name)...)
+		args = append(args, ovnCreateArgs(rows.lnp, rows.lnp.Name)...)
+		args = append(args, ovnCreateArgs(rows.nrp, rows.nrp.Name)...)
+		args = append(args, ovnCreateArgs(rows.rnp, rows.rnp.Name)...)
+		args = append(args, "--", "add", "Logical_Switch", rows.ls.Name, "ports", "@"+rows.lnp.Name, "@"+rows.nrp.Name)
+		args = append(args, "--", "add", "Logical_Router", lrName, "ports", "@"+rows.rnp.Name)
+		for i, gc := range rows.gcs {
+			ref := fmt.Sprintf("gc%d", i)
+			args = append(args, ovnCreateArgs(gc, ref)...)
+			args = append(args, "--", "add", "Logical_Router_Port", rows.rnp.Name, "gateway_chassis", "@"+ref)
+		}
+		for i, nat := range rows.nats {
+			ref := fmt.Sprintf("nat%d", i)
+			args = append(args, ovnCreateArgs(nat, ref)...)
+			args = append(args, "--", "add", "Logical_Router", lrName, "nat", "@"+ref)
+		}
+		for i, lb := range rows.lbs {
+			ref := fmt.Sprintf("lb%d", i)
+			args = append(args, ovnCreateArgs(lb, ref)...)
+			args = append(args, "--", "add", "Logical_Router", lrName, "load_balancer", "@"+ref)
+		}
+	}
+	args = append(args, policyArgs...)
+	keeper.cli.Must(ctx, "ClaimNatGateway", args)
+	return nil
+}
+
+// claimRouterPolicies marks policies already on the router and returns
+// arguments creating the missing ones.  Logical_Router_Policy has no
+// external_ids, claimed rows are remembered by the keeper for Sweep
+func (keeper *OVNNorthboundKeeper) claimRouterPolicies(lrName string, policies []*ovn_nb.LogicalRouterPolicy) []string {
+	var args []string
+	for i, policy := range policies {
+		found := false
+		for j := range keeper.DB.LogicalRouterPolicy {
+			row := &keeper.DB.LogicalRouterPolicy[j]
+			if !row.MatchNonZeros(policy) {
+				continue
+			}
+			for _, lr := range keeper.DB.LogicalRouter.FindLogicalRouterPolicyReferrer_policies(row.Uuid) {
+				if lr.Name == lrName {
+					found = true
+					break
+				}
+			}
+			if found {
+				keeper.claimedPolicies[row.Uuid] = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		ref := fmt.Sprintf("natPolicy%d", i)
+		args = append(args, ovnCreateArgs(policy, ref)...)
+		args = append(args, "--", "add", "Logical_Router", lrName, "policies", "@"+ref)
+	}
+	return args
+}
+
+func buildNatGatewayRows(natgw *agentmodels.NatGateway, peers agentmodels.VpcPeeringConnections, opts *options.Options) (*natGatewayRows, error) {
+	vpc := natgw.Vpc
+	if len(opts.OvnNatGatewayChassis) == 0 {
+		return nil, errors.Errorf("nat gateway %s(%s): no gateway chassis configured", natgw.Name, natgw.Id)
+	}
+
+	var (
+		eips   []*agentmodels.Elasticip
+		eipNet *agentmodels.Network
+		eipIps = map[string]bool{}
+	)
+	for _, eip := range natgw.Elasticips {
+		if eip.Network != nil {
+			eips = append(eips, eip)
+		}
+	}
+	sort.Slice(eips, func(i, j int) bool {
+		return eips[i].IpAddr < eips[j].IpAddr
+	})
+	var networks []string
+	for _, eip := range eips {
+		if eipNet == nil {
+			eipNet = eip.Network
+		} else if eip.NetworkId != eipNet.Id {
+			log.Warningf("nat gateway %s(%s): eip %s is not in network %s", natgw.Name, natgw.Id, eip.IpAddr, eipNet.Id)
+			continue
+		}
+		eipIps[eip.IpAddr] = true
+		networks = append(networks, fmt.Sprintf("%s/%d", eip.IpAddr, eipNet.GuestIpMask))
+	}
+	if eipNet == nil {
+		return nil, nil
+	}
+
+	rows := &natGatewayRows{}
+	rows.ls = &ovn_nb.LogicalSwitch{
+		Name: natgwLsName(natgw.Id),
+	}
+	rows.lnp = &ovn_nb.LogicalSwitchPort{
+		Name:      natgwLnpName(natgw.Id),
+		Type:      "localnet",
+		Addresses: []string{"unknown"},
+		Options: map[string]string{
+			"network_name": opts.OvnNatGatewayNetworkName,
+		},
+	}
+	if eipNet.VlanId > 1 {
+		tag := int64(eipNet.VlanId)
+		rows.lnp.TagRequest = &tag
+	}
+	rows.nrp = &ovn_nb.LogicalSwitchPort{
+		Name:      natgwNrpName(natgw.Id),
+		Type:      "router",
+		Addresses: []string{"router"},
+		Options: map[string]string{
+			"router-port": natgwRnpName(natgw.Id),
+		},
+	}
+	rows.rnp = &ovn_nb.LogicalRouterPort{
+		Name:     natgwRnpName(natgw.Id),
+		Mac:      mac.HashNatGatewayMac(natgw.Id),
+		Networks: networks,
+	}
+	for i, chassis := range opts.OvnNatGatewayChassis {
+		rows.gcs = append(rows.gcs, &ovn_nb.GatewayChassis{
+			Name:        natgwGcName(natgw.Id, chassis),
+			ChassisName: chassis,
+			Priority:    int64(len(opts.OvnNatGatewayChassis) - i),
+		})
+	}
+
+	var (
+		ocNatRef = fmt.Sprintf("nat/%s", natgw.Id)
+		prefixes []string
+		lbVips   = map[string]map[string]string{}
+	)
+	addPrefix := func(prefix string) {
+		for _, p := range prefixes {
+			if p == prefix {
+				return
+			}
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	for _, snat := range natgw.OrderedNatSEntries() {
+		if !eipIps[snat.IP] {
+			log.Warningf("snat entry %s(%s): eip %s is not bound to nat gateway", snat.Name, snat.Id, snat.IP)
+			continue
+		}
+		logicalIp := snat.SourceCIDR
+		if logicalIp == "" {
+			network, ok := vpc.Networks[snat.NetworkId]
+			if !ok {
+				log.Warningf("snat entry %s(%s): network %s not found in vpc", snat.Name, snat.Id, snat.NetworkId)
+				continue
+			}
+			logicalIp = fmt.Sprintf("%s/%d", network.GetNetAddr().String(), network.GuestIpMask)
+		}
+		rows.nats = append(rows.nats, &ovn_nb.NAT{
+			Type:       "snat",
+			ExternalIp: snat.IP,
+			LogicalIp:  logicalIp,
+			ExternalIds: map[string]string{
+				externalKeyOcRef: ocNatRef,
+			},
+		})
+		addPrefix(logicalIp)
+	}
+	for _, dnat := range natgw.OrderedNatDEntries() {
+		if !eipIps[dnat.ExternalIP] {
+			log.Warningf("dnat entry %s(%s): eip %s is not bound to nat gateway", dnat.Name, dnat.Id, dnat.ExternalIP)
+			continue
+		}
+		if dnat.ExternalPort == 0 && dnat.InternalPort == 0 {
+			rows.nats = append(rows.nats, &ovn_nb.NAT{
+				Type:       "dnat",
+				ExternalIp: dnat.ExternalIP,
+				LogicalIp:  dnat.InternalIP,
+				ExternalIds: map[string]string{
+					externalKeyOcRef: ocNatRef,
+				},
+			})
+		} else {
+			proto := strings.ToLower(dnat.IpProtocol)
+			vips, ok := lbVips[proto]
+			if !ok {
+				vips = map[string]string{}
+				lbVips[proto] = vips
+			}
+			vip := fmt.Sprintf("%s:%d", dnat.ExternalIP, dnat.ExternalPort)
+			vips[vip] = fmt.Sprintf("%s:%d", dnat.InternalIP, dnat.InternalPort)
+		}
+		addPrefix(dnat.InternalIP + "/32")
+	}
+
+	{
+		protos := make([]string, 0, len(lbVips))
+		for proto := range lbVips {
+			protos = append(protos, proto)
+		}
+		sort.Strings(protos)
+		for _, proto := range protos {
+			rows.lbs = append(rows.lbs, &ovn_nb.LoadBalancer{
+				Name:     natgwLbName(natgw.Id, proto),
+				Protocol: ptr(proto),
+				Vips:     lbVips[proto],
+			})
+		}
+	}
+
+	// Traffic of the covered addresses, dnat replies included, is rerouted
+	// to the gateway port unless it is destined to the vpc itself, its peers
+	// or the host mapped addresses.  Routes of guests with an eip of their
+	// own are left in effect
+	var (
+		dstExcludes = natgwDstExcludes(vpc, peers)
+		eipAddrs    = vpcEipAddrs(vpc)
+	)
+	for _, prefix := range prefixes {
+		match := natgwPolicyMatch(prefix, dstExcludes, eipAddrs)
+		if match == "" {
+			continue
+		}
+		rows.policies = append(rows.policies, &ovn_nb.LogicalRouterPolicy{
+			Priority: natgwPolicyPriority,
+			Match:    match,
+			Action:   "reroute",
+			Nexthop:  ptr(eipNet.GuestGateway),
+		})
+	}
+	return rows, nil
+}
+
+// natgwDstExcludes returns destinations not to be rerouted to the nat
+// gateway: cidr blocks of the vpc and its active peers and the host mapped
+// addresses
+func natgwDstExcludes(vpc *agentmodels.Vpc, peers agentmodels.VpcPeeringConnections) []string {
+	var ret []string
+	addCidrs := func(cidrBlock string) {
+		for _, cidr := range strings.Split(cidrBlock, ",") {
+			cidr = strings.TrimSpace(cidr)
+			if cidr != "" && !utils.IsInStringArray(cidr, ret) {
+				ret = append(ret, cidr)
+			}
+		}
+	}
+	addCidrs(vpc.CidrBlock)
+	ordered := make([]*agentmodels.VpcPeeringConnection, 0, len(peers))
+	for _, peer := range peers {
+		ordered = append(ordered, peer)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		return ordered[i].Id < ordered[j].Id
+	})
+	for _, peer := range ordered {
+		if peer.Vpc == nil || peer.PeerVpc == nil || peer.Status != apis.VPC_PEERING_CONNECTION_STATUS_ACTIVE {
+			continue
+		}
+		if peer.VpcId == vpc.Id {
+			addCidrs(peer.PeerVpc.CidrBlock)
+		} else if peer.PeerVpcId == vpc.Id {
+			addCidrs(peer.Vpc.CidrBlock)
+		}
+	}
+	mapped := apis.VpcMappedCidr()
+	addCidrs(mapped.String())
+	return ret
+}
+
+// vpcEipAddrs returns addresses in the vpc with an eip of their own, they
+// are routed to the eip gateway
+func vpcEipAddrs(vpc *agentmodels.Vpc) []string {
+	var ret []string
+	if !vpcHasEipgw(vpc) {
+		return ret
+	}
+	for _, network := range vpc.Networks {
+		for _, gn := range network.Guestnetworks {
+			if gn.Elasticip != nil {
+				ret = append(ret, gn.IpAddr)
+			}
+		}
+		for _, gn := range network.Groupnetworks {
+			if gn.Elasticip != nil {
+				ret = append(ret, gn.IpAddr)
+			}
+		}
+		for _, ln := range network.LoadbalancerNetworks {
+			if ln.Elasticip != nil {
+				ret = append(ret, ln.IpAddr)
+			}
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// natgwPolicyMatch matches traffic from the prefix except that to the
+// excluded destinations or from the excluded addresses inside the prefix.
+// An empty string is returned when the prefix is excluded as a whole
+func natgwPolicyMatch(prefix string, dstExcludes, srcExcludes []string) string {
+	pref, err := netutils.NewIPV4Prefix(prefix)
+	if err != nil {
+		log.Warningf("invalid nat prefix %s: %v", prefix, err)
+		return ""
+	}
+	var srcs []string
+	for _, src := range srcExcludes {
+		addr, err := netutils.NewIPV4Addr(src)
+		if err != nil || !pref.Contains(addr) {
+			continue
+		}
+		if pref.MaskLen == 32 {
+			return ""
+		}
+		srcs = append(srcs, src)
+	}
+	match := fmt.Sprintf("ip4.src == %s", prefix)
+	if len(dstExcludes) > 0 {
+		match += fmt.Sprintf(" && ip4.dst != {%s}", strings.Join(dstExcludes, ", "))
+	}
+	if len(srcs) > 0 {
+		match += fmt.Sprintf(" && ip4.src != {%s}", strings.Join(srcs, ", "))
+	}
+	return match
+}
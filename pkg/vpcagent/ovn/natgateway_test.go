@@ -0,0 +1,160 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovn
+
+import (
+	"testing"
+
+	apis "yunion.io/x/onecloud/pkg/apis/compute"
+	agentmodels "yunion.io/x/onecloud/pkg/vpcagent/models"
+	"yunion.io/x/onecloud/pkg/vpcagent/options"
+)
+
+func TestBuildNatGatewayRows(t *testing.T) {
+	vpc := &agentmodels.Vpc{
+		Networks: agentmodels.Networks{},
+	}
+	vpc.Id = "vpc-0"
+	vpc.CidrBlock = "10.0.0.0/16"
+	vpc.ExternalAccessMode = apis.VPC_EXTERNAL_ACCESS_MODE_EIP
+
+	network := &agentmodels.Network{
+		Vpc:           vpc,
+		Guestnetworks: agentmodels.Guestnetworks{},
+	}
+	network.Id = "net-0"
+	network.GuestIpStart = "10.0.1.2"
+	network.GuestIpEnd = "10.0.1.254"
+	network.GuestIpMask = 24
+	vpc.Networks[network.Id] = network
+	{
+		// a guest with an eip of its own
+		gn := &agentmodels.Guestnetwork{
+			Network:   network,
+			Elasticip: &agentmodels.Elasticip{},
+		}
+		gn.IpAddr = "10.0.1.5"
+		network.Guestnetworks["gn-0"] = gn
+	}
+
+	peerVpc := &agentmodels.Vpc{}
+	peerVpc.Id = "vpc-1"
+	peerVpc.CidrBlock = "172.16.0.0/16"
+	peer := &agentmodels.VpcPeeringConnection{
+		Vpc:     vpc,
+		PeerVpc: peerVpc,
+	}
+	peer.Id = "peer-0"
+	peer.VpcId = vpc.Id
+	peer.PeerVpcId = peerVpc.Id
+	peer.Status = apis.VPC_PEERING_CONNECTION_STATUS_ACTIVE
+	peers := agentmodels.VpcPeeringConnections{peer.Id: peer}
+
+	eipNet := &agentmodels.Network{}
+	eipNet.Id = "net-eip"
+	eipNet.GuestIpMask = 24
+	eipNet.GuestGateway = "192.168.0.1"
+	eip := &agentmodels.Elasticip{
+		Network: eipNet,
+	}
+	eip.Id = "eip-0"
+	eip.IpAddr = "192.168.0.10"
+	eip.NetworkId = eipNet.Id
+
+	natgw := &agentmodels.NatGateway{
+		Vpc:         vpc,
+		Elasticips:  agentmodels.Elasticips{eip.Id: eip},
+		NatSEntries: agentmodels.NatSEntries{},
+		NatDEntries: agentmodels.NatDEntries{},
+	}
+	natgw.Id = "natgw-0"
+	{
+		snat := &agentmodels.NatSEntry{NatGateway: natgw}
+		snat.Id = "snat-0"
+		snat.IP = eip.IpAddr
+		snat.NetworkId = network.Id
+		natgw.NatSEntries[snat.Id] = snat
+	}
+	{
+		dnat := &agentmodels.NatDEntry{NatGateway: natgw}
+		dnat.Id = "dnat-0"
+		dnat.ExternalIP = eip.IpAddr
+		dnat.ExternalPort = 2222
+		dnat.InternalIP = "10.0.1.6"
+		dnat.InternalPort = 22
+		dnat.IpProtocol = "tcp"
+		natgw.NatDEntries[dnat.Id] = dnat
+	}
+	{
+		// the guest routes through its own eip, no reroute for it
+		dnat := &agentmodels.NatDEntry{NatGateway: natgw}
+		dnat.Id = "dnat-1"
+		dnat.ExternalIP = eip.IpAddr
+		dnat.InternalIP = "10.0.1.5"
+		natgw.NatDEntries[dnat.Id] = dnat
+	}
+
+	t.Run("no chassis", func(t *testing.T) {
+		_, err := buildNatGatewayRows(natgw, peers, &options.Options{})
+		if err == nil {
+			t.Errorf("expect error without gateway chassis")
+		}
+	})
+
+	opts := &options.Options{}
+	opts.OvnNatGatewayChassis = []string{"chassis-a", "chassis-b"}
+	opts.OvnNatGatewayNetworkName = "natgw"
+	rows, err := buildNatGatewayRows(natgw, peers, opts)
+	if err != nil {
+		t.Fatalf("buildNatGatewayRows: %v", err)
+	}
+	if len(rows.rnp.Networks) != 1 || rows.rnp.Networks[0] != "192.168.0.10/24" {
+		t.Errorf("gateway port networks: %v", rows.rnp.Networks)
+	}
+	if len(rows.gcs) != 2 || rows.gcs[0].ChassisName != "chassis-a" || rows.gcs[0].Priority <= rows.gcs[1].Priority {
+		t.Errorf("gateway chassis should follow the configured order")
+	}
+	if len(rows.nats) != 2 || rows.nats[0].Type != "snat" || rows.nats[0].LogicalIp != "10.0.1.0/24" || rows.nats[1].Type != "dnat" {
+		t.Errorf("unexpected nat rules")
+	}
+	if len(rows.lbs) != 1 || rows.lbs[0].Vips["192.168.0.10:2222"] != "10.0.1.6:22" {
+		t.Errorf("unexpected load balancers")
+	}
+
+	excludes := "ip4.dst != {10.0.0.0/16, 172.16.0.0/16, 100.64.0.0/17}"
+	want := []string{
+		"ip4.src == 10.0.1.0/24 && " + excludes + " && ip4.src != {10.0.1.5}",
+		"ip4.src == 10.0.1.6/32 && " + excludes,
+	}
+	if len(rows.policies) != len(want) {
+		t.Fatalf("want %d policies, got %d", len(want), len(rows.policies))
+	}
+	for i, policy := range rows.policies {
+		if policy.Match != want[i] {
+			t.Errorf("policy %d: want %q, got %q", i, want[i], policy.Match)
+		}
+		if policy.Action != "reroute" || policy.Nexthop == nil || *policy.Nexthop != "192.168.0.1" || policy.Priority != natgwPolicyPriority {
+			t.Errorf("policy %d should reroute to the eip gateway", i)
+		}
+	}
+
+	t.Run("no eip", func(t *testing.T) {
+		natgw := &agentmodels.NatGateway{Vpc: vpc}
+		rows, err := buildNatGatewayRows(natgw, peers, opts)
+		if err != nil || rows != nil {
+			t.Errorf("expect nothing without eip, got %v %v", rows, err)
+		}
+	})
+}
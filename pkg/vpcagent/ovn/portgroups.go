@@ -0,0 +1,407 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovn
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"yunion.io/x/ovsdb/schema/ovn_nb"
+	"yunion.io/x/ovsdb/types"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/utils"
+
+	apis "yunion.io/x/onecloud/pkg/apis/compute"
+	agentmodels "yunion.io/x/onecloud/pkg/vpcagent/models"
+)
+
+// sgAclBatch limits the number of acls created in one ovn-nbctl call.
+// Creating an acl and adding it to port group must not be split into
+// different transactions
+const sgAclBatch = 32
+
+type sgPortGroup struct {
+	name       string
+	vpcId      string
+	ocRef      string
+	rules      []*agentmodels.SecurityGroupRule
+	lports     []string
+	enableIPv6 bool
+}
+
+type sgAddressSet struct {
+	name  string
+	ocRef string
+	addrs []string
+}
+
+// sgPortGroups is the desired state of security groups in ovn northbound.
+//
+// Each security group used in a vpc is a port group of guest nics in that
+// vpc, and the admin security group has its own port group as its rules
+// come with different priorities.  The implicit rules are port groups of
+// all guest nics.  Peer security group referred to by rules is an address
+// set of member nic addresses in the same vpc and vpcs peered with it, as
+// traffic through vpc peering connections keeps its source addresses
+type sgPortGroups struct {
+	pgs map[string]*sgPortGroup
+	ass map[string]*sgAddressSet
+}
+
+// guestnetworkPgNames returns names of port groups the guest nic is a member of
+func guestnetworkPgNames(guestnetwork *agentmodels.Guestnetwork) []string {
+	var (
+		guest = guestnetwork.Guest
+		vpcId = guestnetwork.Network.Vpc.Id
+		r     = []string{sgDefaultPgName}
+	)
+	if guest.SecurityGroupAclLog() {
+		r[0] = sgDefaultLogPgName
+	}
+	for _, secgroup := range guest.SecurityGroups {
+		r = append(r, sgPgName(vpcId, secgroup.Id))
+	}
+	if guest.AdminSecurityGroup != nil {
+		r = append(r, sgAdminPgName(vpcId, guest.AdminSecurityGroup.Id))
+	}
+	sort.Strings(r[1:])
+	return r
+}
+
+// peeredVpcIds returns ids of vpcs connected by active peering connections
+// keyed by vpc id
+func peeredVpcIds(peers agentmodels.VpcPeeringConnections) map[string][]string {
+	r := map[string][]string{}
+	for _, peer := range peers {
+		if peer.Vpc == nil || peer.PeerVpc == nil {
+			continue
+		}
+		if peer.Status != apis.VPC_PEERING_CONNECTION_STATUS_ACTIVE {
+			continue
+		}
+		r[peer.VpcId] = append(r[peer.VpcId], peer.PeerVpcId)
+		r[peer.PeerVpcId] = append(r[peer.PeerVpcId], peer.VpcId)
+	}
+	for _, ids := range r {
+		sort.Strings(ids)
+	}
+	return r
+}
+
+func resolveSecgroupPortGroups(vpcs agentmodels.Vpcs, peers agentmodels.VpcPeeringConnections) *sgPortGroups {
+	sgpgs := &sgPortGroups{
+		pgs: map[string]*sgPortGroup{},
+		ass: map[string]*sgAddressSet{},
+	}
+	addPg := func(name, vpcId, ocRef string, rules func() []*agentmodels.SecurityGroupRule) *sgPortGroup {
+		pg, ok := sgpgs.pgs[name]
+		if !ok {
+			pg = &sgPortGroup{
+				name:  name,
+				vpcId: vpcId,
+				ocRef: ocRef,
+				rules: rules(),
+			}
+			sort.SliceStable(pg.rules, func(i, j int) bool {
+				return pg.rules[i].Id < pg.rules[j].Id
+			})
+			sgpgs.pgs[name] = pg
+		}
+		return pg
+	}
+	// addresses of security group members keyed by vpc and secgroup id
+	memberAddrs := map[[2]string][2][]string{}
+	for _, vpc := range vpcs {
+		if vpc.Id == apis.DEFAULT_VPC_ID {
+			continue
+		}
+		for _, network := range vpc.Networks {
+			for _, guestnetwork := range network.Guestnetworks {
+				guest := guestnetwork.Guest
+				if guest == nil {
+					continue
+				}
+				var (
+					lport      = gnpName(guestnetwork.NetworkId, guestnetwork.Ifname)
+					pgs        []*sgPortGroup
+					secgroups  []*agentmodels.SecurityGroup
+					ip4s, ip6s []string
+				)
+				aclLog := guest.SecurityGroupAclLog()
+				defaultPgName := sgDefaultPgName
+				if aclLog {
+					defaultPgName = sgDefaultLogPgName
+				}
+				pgs = append(pgs, addPg(defaultPgName, "", fmt.Sprintf("sg/default/%v", aclLog),
+					func() []*agentmodels.SecurityGroupRule {
+						return agentmodels.ImplicitSecurityGroupRules(aclLog)
+					},
+				))
+				for _, secgroup := range guest.SecurityGroups {
+					pgs = append(pgs, addPg(sgPgName(vpc.Id, secgroup.Id), vpc.Id, fmt.Sprintf("sg/%s/%s", vpc.Id, secgroup.Id),
+						func() []*agentmodels.SecurityGroupRule {
+							return secgroup.PrioritizedRules(agentmodels.SecurityGroupRuleBasePriority)
+						},
+					))
+					secgroups = append(secgroups, secgroup)
+				}
+				if secgroup := guest.AdminSecurityGroup; secgroup != nil {
+					pgs = append(pgs, addPg(sgAdminPgName(vpc.Id, secgroup.Id), vpc.Id, fmt.Sprintf("sga/%s/%s", vpc.Id, secgroup.Id),
+						func() []*agentmodels.SecurityGroupRule {
+							return secgroup.PrioritizedRules(agentmodels.AdminSecurityGroupRuleBasePriority)
+						},
+					))
+					secgroups = append(secgroups, secgroup)
+				}
+				for _, pg := range pgs {
+					pg.lports = append(pg.lports, lport)
+					if len(guestnetwork.Ip6Addr) > 0 {
+						pg.enableIPv6 = true
+					}
+				}
+
+				ip4s = append(ip4s, guestnetwork.IpAddr)
+				for _, na := range guestnetwork.SubIPs {
+					ip4s = append(ip4s, na.IpAddr)
+				}
+				if len(guestnetwork.Ip6Addr) > 0 {
+					ip6s = append(ip6s, guestnetwork.Ip6Addr)
+				}
+				for _, secgroup := range secgroups {
+					k := [2]string{vpc.Id, secgroup.Id}
+					v := memberAddrs[k]
+					v[0] = append(v[0], ip4s...)
+					v[1] = append(v[1], ip6s...)
+					memberAddrs[k] = v
+				}
+			}
+		}
+	}
+	peered := peeredVpcIds(peers)
+	for _, pg := range sgpgs.pgs {
+		for _, rule := range pg.rules {
+			if rule.PeerSecgroupId == "" {
+				continue
+			}
+			for i, af := range []string{"ip4", "ip6"} {
+				name := sgAsName(pg.vpcId, rule.PeerSecgroupId, af)
+				if _, ok := sgpgs.ass[name]; ok {
+					continue
+				}
+				addrs := append([]string(nil), memberAddrs[[2]string{pg.vpcId, rule.PeerSecgroupId}][i]...)
+				for _, vpcId := range peered[pg.vpcId] {
+					addrs = append(addrs, memberAddrs[[2]string{vpcId, rule.PeerSecgroupId}][i]...)
+				}
+				as := &sgAddressSet{
+					name:  name,
+					ocRef: fmt.Sprintf("as/%s/%s/%s", pg.vpcId, rule.PeerSecgroupId, af),
+					addrs: addrs,
+				}
+				sort.Strings(as.addrs)
+				sgpgs.ass[name] = as
+			}
+		}
+	}
+	return sgpgs
+}
+
+// ClaimSecgroupPortGroups makes port groups and address sets for security
+// groups.  Acls, member ports and addresses of existing rows are added and
+// removed in place, so that change of guest nics and security group rules
+// touches only port groups and address sets involved.  Stale acls are
+// removed at sweep stage
+func (keeper *OVNNorthboundKeeper) ClaimSecgroupPortGroups(ctx context.Context, sgpgs *sgPortGroups) error {
+	var errs []error
+	asNames := make([]string, 0, len(sgpgs.ass))
+	for name := range sgpgs.ass {
+		asNames = append(asNames, name)
+	}
+	sort.Strings(asNames)
+	for _, name := range asNames {
+		keeper.claimSgAddressSet(ctx, sgpgs.ass[name])
+	}
+
+	pgNames := make([]string, 0, len(sgpgs.pgs))
+	for name := range sgpgs.pgs {
+		pgNames = append(pgNames, name)
+	}
+	sort.Strings(pgNames)
+	for _, name := range pgNames {
+		if err := keeper.claimSgPortGroup(ctx, sgpgs.pgs[name]); err != nil {
+			errs = append(errs, errors.Wrapf(err, "port group %s", name))
+		}
+	}
+	return errors.NewAggregate(errs)
+}
+
+func (keeper *OVNNorthboundKeeper) claimSgAddressSet(ctx context.Context, sgas *sgAddressSet) {
+	var (
+		ocVersion = sgas.ocRef
+		as        = &ovn_nb.AddressSet{
+			Name: sgas.name,
+			ExternalIds: map[string]string{
+				externalKeyOcRef: sgas.ocRef,
+			},
+		}
+		args []string
+	)
+	if asFound := keeper.DB.AddressSet.FindOneMatchNonZeros(as); asFound != nil {
+		asFound.SetExternalId(externalKeyOcVersion, ocVersion)
+		adds, dels := stringsDiff(sgas.addrs, asFound.Addresses)
+		if len(adds) > 0 {
+			args = append(args, "--", "add", "Address_Set", as.Name, "addresses")
+			for _, addr := range adds {
+				args = append(args, types.OvsdbCmdArgString(addr))
+			}
+		}
+		if len(dels) > 0 {
+			args = append(args, "--", "remove", "Address_Set", as.Name, "addresses")
+			for _, addr := range dels {
+				args = append(args, types.OvsdbCmdArgString(addr))
+			}
+		}
+	} else {
+		as.Addresses = sgas.addrs
+		_, args = cmp(&keeper.DB, ocVersion, as)
+		args = append(args, ovnCreateArgs(as, "as")...)
+	}
+	if len(args) > 0 {
+		keeper.cli.Must(ctx, "claimSgAddressSet", args)
+	}
+}
+
+func (keeper *OVNNorthboundKeeper) claimSgPortGroup(ctx context.Context, sgpg *sgPortGroup) error {
+	var (
+		ocVersion = sgpg.ocRef
+		errs      []error
+		acls      []*ovn_nb.ACL
+		aclKeys   = map[string]bool{}
+	)
+	for _, rule := range sgpg.rules {
+		acl, err := ruleToAcl(sgpg.vpcId, sgpg.name, rule, sgpg.enableIPv6)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "rule %s", rule.Id))
+			continue
+		}
+		acl.ExternalIds = map[string]string{
+			externalKeyOcRef: sgpg.ocRef,
+		}
+		if acl.Log {
+			acl.ExternalIds[externalKeyAclLog] = "on"
+		}
+		// duplicate rules make the same acl
+		k := fmt.Sprintf("%s/%d/%s/%s/%v", acl.Direction, acl.Priority, acl.Action, acl.Match, acl.Log)
+		if aclKeys[k] {
+			continue
+		}
+		aclKeys[k] = true
+		acls = append(acls, acl)
+	}
+
+	var ports []string
+	for _, lport := range sgpg.lports {
+		lsp := keeper.DB.LogicalSwitchPort.GetByName(&ovn_nb.LogicalSwitchPort{Name: lport})
+		if lsp != nil {
+			// new ports are added to port groups when being created
+			ports = append(ports, lsp.Uuid)
+		}
+	}
+
+	var (
+		pg = &ovn_nb.PortGroup{
+			Name: sgpg.name,
+			ExternalIds: map[string]string{
+				externalKeyOcRef: sgpg.ocRef,
+			},
+		}
+		pgAcls  []string
+		pgPorts []string
+	)
+	if pgFound := keeper.DB.PortGroup.FindOneMatchNonZeros(pg); pgFound != nil {
+		pgFound.SetExternalId(externalKeyOcVersion, ocVersion)
+		pgAcls = pgFound.Acls
+		pgPorts = pgFound.Ports
+	} else {
+		_, args := cmp(&keeper.DB, ocVersion, pg)
+		args = append(args, ovnCreateArgs(pg, "pg")...)
+		keeper.cli.Must(ctx, "claimSgPortGroup", args)
+	}
+	keeper.claimedPgs[pg.Name] = true
+
+	var (
+		args []string
+		n    int
+	)
+	for i, acl := range acls {
+		aclFound := keeper.DB.ACL.FindOneMatchNonZeros(acl)
+		if aclFound != nil && utils.IsInStringArray(aclFound.Uuid, pgAcls) {
+			aclFound.SetExternalId(externalKeyOcVersion, ocVersion)
+			continue
+		}
+		ref := fmt.Sprintf("acl%d", i)
+		args = append(args, ovnCreateArgs(acl, ref)...)
+		args = append(args, "--", "add", "Port_Group", pg.Name, "acls", "@"+ref)
+		if n++; n%sgAclBatch == 0 {
+			keeper.cli.Must(ctx, "claimSgPortGroup acls", args)
+			args = nil
+		}
+	}
+	if len(args) > 0 {
+		keeper.cli.Must(ctx, "claimSgPortGroup acls", args)
+		args = nil
+	}
+
+	adds, dels := stringsDiff(ports, pgPorts)
+	if len(adds) > 0 {
+		args = append(args, "--", "add", "Port_Group", pg.Name, "ports")
+		for _, port := range adds {
+			args = append(args, types.OvsdbCmdArgUuid(port))
+		}
+	}
+	if len(dels) > 0 {
+		args = append(args, "--", "remove", "Port_Group", pg.Name, "ports")
+		for _, port := range dels {
+			args = append(args, types.OvsdbCmdArgUuid(port))
+		}
+	}
+	if len(args) > 0 {
+		keeper.cli.Must(ctx, "claimSgPortGroup ports", args)
+	}
+	return errors.NewAggregate(errs)
+}
+
+// stringsDiff returns elements of want missing from have, and those of have
+// not in want
+func stringsDiff(want, have []string) (adds, dels []string) {
+	wantSet := make(map[string]bool, len(want))
+	for _, s := range want {
+		wantSet[s] = true
+	}
+	haveSet := make(map[string]bool, len(have))
+	for _, s := range have {
+		haveSet[s] = true
+		if !wantSet[s] {
+			dels = append(dels, s)
+		}
+	}
+	for _, s := range want {
+		if !haveSet[s] {
+			adds = append(adds, s)
+			haveSet[s] = true
+		}
+	}
+	return adds, dels
+}
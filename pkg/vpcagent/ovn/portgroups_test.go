@@ -0,0 +1,256 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovn
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"yunion.io/x/pkg/util/secrules"
+
+	apis "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/compute/models"
+	agentmodels "yunion.io/x/onecloud/pkg/vpcagent/models"
+)
+
+func TestResolveSecgroupPortGroups(t *testing.T) {
+	sgWeb := &agentmodels.SecurityGroup{
+		SecurityGroupRules: agentmodels.SecurityGroupRules{},
+	}
+	sgWeb.Id = "sg-web"
+	sgDb := &agentmodels.SecurityGroup{
+		SecurityGroupRules: agentmodels.SecurityGroupRules{},
+	}
+	sgDb.Id = "sg-db"
+	sgDb.AclLog = true
+	sgAdmin := &agentmodels.SecurityGroup{
+		SecurityGroupRules: agentmodels.SecurityGroupRules{},
+	}
+	sgAdmin.Id = "sg-admin"
+	{
+		// db allows mysql from web
+		rule := &agentmodels.SecurityGroupRule{
+			SSecurityGroupRule: models.SSecurityGroupRule{
+				Id:             "rule-mysql",
+				Priority:       10,
+				Direction:      string(secrules.SecurityRuleIngress),
+				Action:         string(secrules.SecurityRuleAllow),
+				Protocol:       secrules.PROTO_TCP,
+				Ports:          "3306",
+				PeerSecgroupId: sgWeb.Id,
+			},
+		}
+		sgDb.SecurityGroupRules[rule.Id] = rule
+	}
+
+	vpc := &agentmodels.Vpc{
+		Networks: agentmodels.Networks{},
+	}
+	vpc.Id = "vpc-0"
+	network := &agentmodels.Network{
+		Vpc:           vpc,
+		Guestnetworks: agentmodels.Guestnetworks{},
+	}
+	network.Id = "net-0"
+	vpc.Networks[network.Id] = network
+
+	addGuest := func(id, ipAddr, ip6Addr string, secgroups ...*agentmodels.SecurityGroup) *agentmodels.Guest {
+		guest := &agentmodels.Guest{
+			SecurityGroups: agentmodels.SecurityGroups{},
+		}
+		guest.Id = id
+		for _, secgroup := range secgroups {
+			guest.SecurityGroups[secgroup.Id] = secgroup
+		}
+		gn := &agentmodels.Guestnetwork{
+			Guest:   guest,
+			Network: network,
+		}
+		gn.GuestId = id
+		gn.NetworkId = network.Id
+		gn.Ifname = id + "-eth0"
+		gn.IpAddr = ipAddr
+		gn.Ip6Addr = ip6Addr
+		network.Guestnetworks[id] = gn
+		return guest
+	}
+	addGuest("web0", "10.0.0.10", "", sgWeb)
+	addGuest("web1", "10.0.0.11", "fd00::11", sgWeb)
+	db0 := addGuest("db0", "10.0.0.20", "", sgDb)
+	db0.AdminSecurityGroup = sgAdmin
+
+	sgpgs := resolveSecgroupPortGroups(agentmodels.Vpcs{vpc.Id: vpc}, nil)
+
+	lports := func(pgName string) []string {
+		pg, ok := sgpgs.pgs[pgName]
+		if !ok {
+			t.Fatalf("port group %s not found", pgName)
+		}
+		r := append([]string(nil), pg.lports...)
+		sort.Strings(r)
+		return r
+	}
+	wantLports := map[string][]string{
+		sgDefaultPgName:                   {gnpName(network.Id, "web0-eth0"), gnpName(network.Id, "web1-eth0")},
+		sgDefaultLogPgName:                {gnpName(network.Id, "db0-eth0")},
+		sgPgName(vpc.Id, sgWeb.Id):        {gnpName(network.Id, "web0-eth0"), gnpName(network.Id, "web1-eth0")},
+		sgPgName(vpc.Id, sgDb.Id):         {gnpName(network.Id, "db0-eth0")},
+		sgAdminPgName(vpc.Id, "sg-admin"): {gnpName(network.Id, "db0-eth0")},
+	}
+	if len(sgpgs.pgs) != len(wantLports) {
+		t.Errorf("want %d port groups, got %d", len(wantLports), len(sgpgs.pgs))
+	}
+	for pgName, want := range wantLports {
+		if got := lports(pgName); !reflect.DeepEqual(got, want) {
+			t.Errorf("port group %s: want lports %v, got %v", pgName, want, got)
+		}
+	}
+	if !sgpgs.pgs[sgPgName(vpc.Id, sgWeb.Id)].enableIPv6 {
+		t.Errorf("port group of web should have ipv6 enabled")
+	}
+	if sgpgs.pgs[sgPgName(vpc.Id, sgDb.Id)].enableIPv6 {
+		t.Errorf("port group of db should have ipv6 disabled")
+	}
+	for _, rule := range sgpgs.pgs[sgDefaultLogPgName].rules {
+		if !rule.AclLog {
+			t.Errorf("implicit rules of %s should be logged", sgDefaultLogPgName)
+		}
+	}
+	if rules := sgpgs.pgs[sgPgName(vpc.Id, sgDb.Id)].rules; len(rules) != 1 || rules[0].Priority != 10+agentmodels.SecurityGroupRuleBasePriority {
+		t.Errorf("unexpected rules of db port group")
+	}
+
+	wantAddrs := map[string][]string{
+		"as_vpc_0_sg_web_ip4": {"10.0.0.10", "10.0.0.11"},
+		"as_vpc_0_sg_web_ip6": {"fd00::11"},
+	}
+	if len(sgpgs.ass) != len(wantAddrs) {
+		t.Errorf("want %d address sets, got %d", len(wantAddrs), len(sgpgs.ass))
+	}
+	for asName, want := range wantAddrs {
+		as, ok := sgpgs.ass[asName]
+		if !ok {
+			t.Errorf("address set %s not found", asName)
+			continue
+		}
+		if !reflect.DeepEqual(as.addrs, want) {
+			t.Errorf("address set %s: want %v, got %v", asName, want, as.addrs)
+		}
+	}
+}
+
+func TestResolveSecgroupPortGroupsPeering(t *testing.T) {
+	sgWeb := &agentmodels.SecurityGroup{
+		SecurityGroupRules: agentmodels.SecurityGroupRules{},
+	}
+	sgWeb.Id = "sg-web"
+	sgDb := &agentmodels.SecurityGroup{
+		SecurityGroupRules: agentmodels.SecurityGroupRules{},
+	}
+	sgDb.Id = "sg-db"
+	{
+		rule := &agentmodels.SecurityGroupRule{
+			SSecurityGroupRule: models.SSecurityGroupRule{
+				Id:             "rule-mysql",
+				Priority:       10,
+				Direction:      string(secrules.SecurityRuleIngress),
+				Action:         string(secrules.SecurityRuleAllow),
+				Protocol:       secrules.PROTO_TCP,
+				Ports:          "3306",
+				PeerSecgroupId: sgWeb.Id,
+			},
+		}
+		sgDb.SecurityGroupRules[rule.Id] = rule
+	}
+
+	vpcs := agentmodels.Vpcs{}
+	addVpc := func(id string) *agentmodels.Network {
+		vpc := &agentmodels.Vpc{
+			Networks: agentmodels.Networks{},
+		}
+		vpc.Id = id
+		network := &agentmodels.Network{
+			Vpc:           vpc,
+			Guestnetworks: agentmodels.Guestnetworks{},
+		}
+		network.Id = "net-" + id
+		vpc.Networks[network.Id] = network
+		vpcs[vpc.Id] = vpc
+		return network
+	}
+	addGuest := func(network *agentmodels.Network, id, ipAddr string, secgroup *agentmodels.SecurityGroup) {
+		guest := &agentmodels.Guest{
+			SecurityGroups: agentmodels.SecurityGroups{
+				secgroup.Id: secgroup,
+			},
+		}
+		guest.Id = id
+		gn := &agentmodels.Guestnetwork{
+			Guest:   guest,
+			Network: network,
+		}
+		gn.GuestId = id
+		gn.NetworkId = network.Id
+		gn.Ifname = id + "-eth0"
+		gn.IpAddr = ipAddr
+		network.Guestnetworks[id] = gn
+	}
+	net0 := addVpc("vpc-0")
+	net1 := addVpc("vpc-1")
+	net2 := addVpc("vpc-2")
+	addGuest(net0, "db0", "10.0.0.20", sgDb)
+	addGuest(net0, "web0", "10.0.0.10", sgWeb)
+	addGuest(net1, "web1", "10.1.0.10", sgWeb)
+	addGuest(net2, "web2", "10.2.0.10", sgWeb)
+
+	newPeer := func(id, vpcId, peerVpcId, status string) *agentmodels.VpcPeeringConnection {
+		peer := &agentmodels.VpcPeeringConnection{
+			Vpc:     vpcs[vpcId],
+			PeerVpc: vpcs[peerVpcId],
+		}
+		peer.Id = id
+		peer.VpcId = vpcId
+		peer.PeerVpcId = peerVpcId
+		peer.Status = status
+		return peer
+	}
+	peers := agentmodels.VpcPeeringConnections{
+		"peer-1": newPeer("peer-1", "vpc-1", "vpc-0", apis.VPC_PEERING_CONNECTION_STATUS_ACTIVE),
+		"peer-2": newPeer("peer-2", "vpc-0", "vpc-2", apis.VPC_PEERING_CONNECTION_STATUS_DELETING),
+	}
+
+	sgpgs := resolveSecgroupPortGroups(vpcs, peers)
+	as, ok := sgpgs.ass["as_vpc_0_sg_web_ip4"]
+	if !ok {
+		t.Fatalf("address set of sg-web in vpc-0 not found")
+	}
+	if want := []string{"10.0.0.10", "10.1.0.10"}; !reflect.DeepEqual(as.addrs, want) {
+		t.Errorf("want %v, got %v", want, as.addrs)
+	}
+}
+
+func TestStringsDiff(t *testing.T) {
+	adds, dels := stringsDiff(
+		[]string{"a", "b", "c", "c"},
+		[]string{"b", "d"},
+	)
+	if want := []string{"a", "c"}; !reflect.DeepEqual(adds, want) {
+		t.Errorf("adds: want %v, got %v", want, adds)
+	}
+	if want := []string{"d"}; !reflect.DeepEqual(dels, want) {
+		t.Errorf("dels: want %v, got %v", want, dels)
+	}
+}
@@ -37,7 +37,23 @@ const (
 	aclDirFromLport = "from-lport"
 )
 
-func ruleToAcl(lport string, rule *agentmodels.SecurityGroupRule, enableIPv6 bool) (*ovn_nb.ACL, error) {
+const (
+	// aclLogMeterName names the meter rate limiting acl log of all vpcs
+	aclLogMeterName = "acl-log"
+
+	// aclLogNameDefault is logged for the implicit rules which have no id
+	aclLogNameDefault = "default"
+
+	externalKeyAclLogRate = "acl-log-rate"
+
+	// externalKeyAclLog tells apart acls with logging on, as zero valued
+	// log column is not compared when matching rows
+	externalKeyAclLog = "acl-log"
+)
+
+// ruleToAcl converts rule into acl of port group pg.  Peer security group
+// of the rule refers to address sets of the same vpc
+func ruleToAcl(vpcId string, pg string, rule *agentmodels.SecurityGroupRule, enableIPv6 bool) (*ovn_nb.ACL, error) {
 	var (
 		dir    string
 		action string
@@ -54,12 +70,12 @@ func ruleToAcl(lport string, rule *agentmodels.SecurityGroupRule, enableIPv6 boo
 		dir = aclDirToLport
 		l3subfn = "src"
 		l4subfn = "dst"
-		matches = append(matches, fmt.Sprintf("outport == %q", lport))
+		matches = append(matches, fmt.Sprintf("outport == @%s", pg))
 	case secrules.SecurityRuleEgress:
 		dir = aclDirFromLport
 		l3subfn = "dst"
 		l4subfn = "dst"
-		matches = append(matches, fmt.Sprintf("inport == %q", lport))
+		matches = append(matches, fmt.Sprintf("inport == @%s", pg))
 	default:
 		return nil, errors.Wrapf(errBadSecgroupRule, "unknown direction %q", rule.Direction)
 	}
@@ -79,7 +95,15 @@ func ruleToAcl(lport string, rule *agentmodels.SecurityGroupRule, enableIPv6 boo
 		} else {
 			matches = append(matches, "ip4")
 		}
-		if cidr := strings.TrimSpace(rule.CIDR); cidr != "" {
+		if peer := rule.PeerSecgroupId; peer != "" {
+			as4 := sgAsName(vpcId, peer, "ip4")
+			if enableIPv6 {
+				as6 := sgAsName(vpcId, peer, "ip6")
+				matches = append(matches, fmt.Sprintf("(ip4.%s == $%s || ip6.%s == $%s)", l3subfn, as4, l3subfn, as6))
+			} else {
+				matches = append(matches, fmt.Sprintf("ip4.%s == $%s", l3subfn, as4))
+			}
+		} else if cidr := strings.TrimSpace(rule.CIDR); cidr != "" {
 			if regutils.MatchCIDR(cidr) {
 				matches = append(matches, fmt.Sprintf("ip4.%s == %s", l3subfn, cidr))
 			} else if regutils.MatchCIDR6(cidr) {
@@ -188,6 +212,22 @@ func ruleToAcl(lport string, rule *agentmodels.SecurityGroupRule, enableIPv6 boo
 		Match:     match,
 		Action:    action,
 	}
+	if rule.AclLog {
+		// ovn-controller logs hits of the acl with its name, which
+		// is used by hostman to find the rule
+		name := rule.Id
+		if name == "" {
+			name = aclLogNameDefault
+		}
+		severity := "info"
+		if action == "drop" {
+			severity = "alert"
+		}
+		acl.Log = true
+		acl.Name = &name
+		acl.Severity = &severity
+		acl.Meter = ptr(aclLogMeterName)
+	}
 
 	return acl, nil
 }
@@ -42,7 +42,7 @@ import (
 )
 
 func TestRuleToACL(t *testing.T) {
-	lport := "local-port120"
+	pg := "pg_vpc_sg"
 	cases := []struct {
 		rule *agentmodels.SecurityGroupRule
 		ipv6 bool
@@ -62,7 +62,7 @@ func TestRuleToACL(t *testing.T) {
 			acl: &ovn_nb.ACL{
 				Direction: aclDirFromLport,
 				Action:    "drop",
-				Match:     fmt.Sprintf("inport == %q && ip4 && ip4.dst == 100.10.10.0/24", lport),
+				Match:     fmt.Sprintf("inport == @%s && ip4 && ip4.dst == 100.10.10.0/24", pg),
 				Priority:  100,
 			},
 		},
@@ -80,7 +80,7 @@ func TestRuleToACL(t *testing.T) {
 			acl: &ovn_nb.ACL{
 				Direction: aclDirFromLport,
 				Action:    "allow-related",
-				Match:     fmt.Sprintf("inport == %q && ip4", lport),
+				Match:     fmt.Sprintf("inport == @%s && ip4", pg),
 				Priority:  10,
 			},
 		},
@@ -99,7 +99,7 @@ func TestRuleToACL(t *testing.T) {
 			acl: &ovn_nb.ACL{
 				Direction: aclDirFromLport,
 				Action:    "allow-related",
-				Match:     fmt.Sprintf("inport == %q && (ip4 || ip6)", lport),
+				Match:     fmt.Sprintf("inport == @%s && (ip4 || ip6)", pg),
 				Priority:  10,
 			},
 		},
@@ -117,7 +117,7 @@ func TestRuleToACL(t *testing.T) {
 			acl: &ovn_nb.ACL{
 				Direction: aclDirToLport,
 				Action:    "drop",
-				Match:     fmt.Sprintf("outport == %q && ip4", lport),
+				Match:     fmt.Sprintf("outport == @%s && ip4", pg),
 				Priority:  100,
 			},
 		},
@@ -136,7 +136,7 @@ func TestRuleToACL(t *testing.T) {
 			acl: &ovn_nb.ACL{
 				Direction: aclDirToLport,
 				Action:    "allow-related",
-				Match:     fmt.Sprintf("outport == %q && ip4 && tcp && tcp.dst == 22", lport),
+				Match:     fmt.Sprintf("outport == @%s && ip4 && tcp && tcp.dst == 22", pg),
 				Priority:  100,
 			},
 		},
@@ -156,14 +156,100 @@ func TestRuleToACL(t *testing.T) {
 			acl: &ovn_nb.ACL{
 				Direction: aclDirToLport,
 				Action:    "allow-related",
-				Match:     fmt.Sprintf("outport == %q && (ip4 || ip6) && tcp && tcp.dst == 22", lport),
+				Match:     fmt.Sprintf("outport == @%s && (ip4 || ip6) && tcp && tcp.dst == 22", pg),
+				Priority:  100,
+			},
+		},
+		{
+			// ingress deny rdp with logging
+			rule: &agentmodels.SecurityGroupRule{
+				SSecurityGroupRule: models.SSecurityGroupRule{
+					Id:        "rule-rdp",
+					Direction: string(secrules.SecurityRuleIngress),
+					CIDR:      "",
+					Action:    string(secrules.SecurityRuleDeny),
+					Protocol:  secrules.PROTO_TCP,
+					Ports:     "3389",
+					Priority:  100,
+					AclLog:    true,
+				},
+			},
+			acl: &ovn_nb.ACL{
+				Direction: aclDirToLport,
+				Action:    "drop",
+				Match:     fmt.Sprintf("outport == @%s && ip4 && tcp && tcp.dst == 3389", pg),
+				Priority:  100,
+				Log:       true,
+				Name:      ptr("rule-rdp"),
+				Severity:  ptr("alert"),
+				Meter:     ptr(aclLogMeterName),
+			},
+		},
+		{
+			// implicit rule with logging
+			rule: &agentmodels.SecurityGroupRule{
+				SSecurityGroupRule: models.SSecurityGroupRule{
+					Direction: string(secrules.SecurityRuleIngress),
+					Action:    string(secrules.SecurityRuleAllow),
+					Protocol:  "arp",
+					Priority:  2,
+					AclLog:    true,
+				},
+			},
+			acl: &ovn_nb.ACL{
+				Direction: aclDirToLport,
+				Action:    "allow-related",
+				Match:     fmt.Sprintf("outport == @%s && arp", pg),
+				Priority:  2,
+				Log:       true,
+				Name:      ptr(aclLogNameDefault),
+				Severity:  ptr("info"),
+				Meter:     ptr(aclLogMeterName),
+			},
+		},
+		{
+			// ingress allow mysql from peer secgroup
+			rule: &agentmodels.SecurityGroupRule{
+				SSecurityGroupRule: models.SSecurityGroupRule{
+					Direction:      string(secrules.SecurityRuleIngress),
+					Action:         string(secrules.SecurityRuleAllow),
+					Protocol:       secrules.PROTO_TCP,
+					Ports:          "3306",
+					Priority:       100,
+					PeerSecgroupId: "peer-sg",
+				},
+			},
+			acl: &ovn_nb.ACL{
+				Direction: aclDirToLport,
+				Action:    "allow-related",
+				Match:     fmt.Sprintf("outport == @%s && ip4 && ip4.src == $as_vpc_peer_sg_ip4 && tcp && tcp.dst == 3306", pg),
+				Priority:  100,
+			},
+		},
+		{
+			// egress allow any to peer secgroup with ipv6
+			rule: &agentmodels.SecurityGroupRule{
+				SSecurityGroupRule: models.SSecurityGroupRule{
+					Direction:      string(secrules.SecurityRuleEgress),
+					Action:         string(secrules.SecurityRuleAllow),
+					Protocol:       secrules.PROTO_ANY,
+					CIDR:           "10.0.0.0/8",
+					Priority:       100,
+					PeerSecgroupId: "peer-sg",
+				},
+			},
+			ipv6: true,
+			acl: &ovn_nb.ACL{
+				Direction: aclDirFromLport,
+				Action:    "allow-related",
+				Match:     fmt.Sprintf("inport == @%s && (ip4 || ip6) && (ip4.dst == $as_vpc_peer_sg_ip4 || ip6.dst == $as_vpc_peer_sg_ip6)", pg),
 				Priority:  100,
 			},
 		},
 	}
 
 	for _, c := range cases {
-		got, err := ruleToAcl(lport, c.rule, c.ipv6)
+		got, err := ruleToAcl("vpc", pg, c.rule, c.ipv6)
 		if err != nil {
 			t.Errorf("ruleToACL fail %s", err)
 		} else {
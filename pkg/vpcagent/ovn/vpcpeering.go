@@ -0,0 +1,161 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovn
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"yunion.io/x/log"
+	"yunion.io/x/ovsdb/schema/ovn_nb"
+	"yunion.io/x/ovsdb/types"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/netutils"
+
+	apis "yunion.io/x/onecloud/pkg/apis/compute"
+	agentmodels "yunion.io/x/onecloud/pkg/vpcagent/models"
+	"yunion.io/x/onecloud/pkg/vpcagent/ovn/mac"
+)
+
+// ClaimVpcPeeringConnections connects routers of peered vpcs with a transit
+// logical switch and routes cidr blocks of each side to the other.
+//
+// Transit links are /30 subnets from VpcInterPeerCidr at the transit index
+// the region stores with the peering connection.  No address translation
+// happens on the way, so security group rules of destination guests match
+// on the original source addresses, and address sets of peer security
+// groups include members in peered vpcs
+func (keeper *OVNNorthboundKeeper) ClaimVpcPeeringConnections(ctx context.Context, peers agentmodels.VpcPeeringConnections) {
+	var (
+		transitCidr = apis.VpcInterPeerCidr()
+		maxIdx      = 1 << uint(apis.VpcInterPeerMask-int(transitCidr.MaskLen))
+	)
+	ids := make([]string, 0, len(peers))
+	for id := range peers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		peer := peers[id]
+		if peer.Vpc == nil || peer.PeerVpc == nil {
+			continue
+		}
+		if peer.Status != apis.VPC_PEERING_CONNECTION_STATUS_ACTIVE {
+			continue
+		}
+		if peer.TransitIndex < 0 || peer.TransitIndex >= maxIdx {
+			log.Errorf("vpc peering connection %s(%s): invalid transit index %d", peer.Name, peer.Id, peer.TransitIndex)
+			continue
+		}
+		if err := keeper.claimVpcPeeringConnection(ctx, peer); err != nil {
+			log.Errorf("claim vpc peering connection %s(%s): %v", peer.Name, peer.Id, err)
+		}
+	}
+}
+
+func (keeper *OVNNorthboundKeeper) claimVpcPeeringConnection(ctx context.Context, peer *agentmodels.VpcPeeringConnection) error {
+	var (
+		ocVersion = fmt.Sprintf("%s.%d", peer.UpdatedAt, peer.UpdateVersion)
+		ocRef     = fmt.Sprintf("peer/%s", peer.Id)
+		linkAddr  = uint32(apis.VpcInterPeerCidr().Address) + uint32(peer.TransitIndex*4)
+	)
+	peerLs := &ovn_nb.LogicalSwitch{
+		Name: vpcPeerLsName(peer.Id),
+	}
+
+	type peerSide struct {
+		vpc    *agentmodels.Vpc
+		other  *agentmodels.Vpc
+		ip     string
+		nextIp string
+		rp     *ovn_nb.LogicalRouterPort
+		pr     *ovn_nb.LogicalSwitchPort
+		routes []*ovn_nb.LogicalRouterStaticRoute
+	}
+	sides := []*peerSide{
+		{
+			vpc:    peer.Vpc,
+			other:  peer.PeerVpc,
+			ip:     netutils.IPV4Addr(linkAddr + 1).String(),
+			nextIp: netutils.IPV4Addr(linkAddr + 2).String(),
+		},
+		{
+			vpc:    peer.PeerVpc,
+			other:  peer.Vpc,
+			ip:     netutils.IPV4Addr(linkAddr + 2).String(),
+			nextIp: netutils.IPV4Addr(linkAddr + 1).String(),
+		},
+	}
+	irows := []types.IRow{peerLs}
+	for _, side := range sides {
+		side.rp = &ovn_nb.LogicalRouterPort{
+			Name:     vpcPeerRpName(peer.Id, side.vpc.Id),
+			Mac:      mac.HashVpcPeeringMac(peer.Id, side.vpc.Id),
+			Networks: []string{fmt.Sprintf("%s/%d", side.ip, apis.VpcInterPeerMask)},
+		}
+		side.pr = &ovn_nb.LogicalSwitchPort{
+			Name:      vpcPeerPrName(peer.Id, side.vpc.Id),
+			Type:      "router",
+			Addresses: []string{"router"},
+			Options: map[string]string{
+				"router-port": side.rp.Name,
+			},
+		}
+		for _, cidr := range strings.Split(side.other.CidrBlock, ",") {
+			cidr = strings.TrimSpace(cidr)
+			if cidr == "" {
+				continue
+			}
+			side.routes = append(side.routes, &ovn_nb.LogicalRouterStaticRoute{
+				Policy:     ptr("dst-ip"),
+				IpPrefix:   cidr,
+				Nexthop:    side.nextIp,
+				OutputPort: ptr(side.rp.Name),
+				ExternalIds: map[string]string{
+					externalKeyOcRef: ocRef,
+				},
+			})
+		}
+		if len(side.routes) == 0 {
+			return errors.Errorf("vpc %s(%s) has no cidr block", side.other.Name, side.other.Id)
+		}
+		irows = append(irows, side.rp, side.pr)
+		for _, route := range side.routes {
+			irows = append(irows, route)
+		}
+	}
+	allFound, args := cmp(&keeper.DB, ocVersion, irows...)
+	if allFound {
+		return nil
+	}
+
+	args = append(args, ovnCreateArgs(peerLs, peerLs.Name)...)
+	for i, side := range sides {
+		lrName := vpcLrName(side.vpc.Id)
+		args = append(args, ovnCreateArgs(side.rp, side.rp.Name)...)
+		args = append(args, ovnCreateArgs(side.pr, side.pr.Name)...)
+		args = append(args, "--", "add", "Logical_Switch", peerLs.Name, "ports", "@"+side.pr.Name)
+		args = append(args, "--", "add", "Logical_Router", lrName, "ports", "@"+side.rp.Name)
+		for j, route := range side.routes {
+			ref := fmt.Sprintf("peerRoute%d_%d", i, j)
+			args = append(args, ovnCreateArgs(route, ref)...)
+			args = append(args, "--", "add", "Logical_Router", lrName, "static_routes", "@"+ref)
+		}
+	}
+	keeper.cli.Must(ctx, "ClaimVpcPeeringConnection", args)
+	return nil
+}
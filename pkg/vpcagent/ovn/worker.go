@@ -130,6 +130,13 @@ func (w *Worker) run(ctx context.Context, mss *agentmodels.ModelSets) (err error
 	}
 
 	ovndb.Mark(ctx)
+	if err := ovndb.ClaimAclLogMeter(ctx, w.opts); err != nil {
+		log.Errorf("claim acl log meter: %v", err)
+	}
+	sgpgs := resolveSecgroupPortGroups(mss.Vpcs, mss.VpcPeeringConnections)
+	if err := ovndb.ClaimSecgroupPortGroups(ctx, sgpgs); err != nil {
+		log.Errorf("claim security group port groups: %v", err)
+	}
 	for _, vpc := range mss.Vpcs {
 		if vpc.Id == apis.DEFAULT_VPC_ID {
 			continue
@@ -176,7 +183,9 @@ func (w *Worker) run(ctx context.Context, mss *agentmodels.ModelSets) (err error
 
 					ovndb.ClaimVpcHost(ctx, vpc, host)
 				}
-				ovndb.ClaimGuestnetwork(ctx, guestnetwork, w.opts)
+				if err := ovndb.ClaimGuestnetwork(ctx, guestnetwork, w.opts); err != nil {
+					log.Errorf("claim guestnetwork %s(%s): %v", guestnetwork.GuestId, guestnetwork.Ifname, err)
+				}
 			}
 			for _, groupnetwork := range network.Groupnetworks {
 				ovndb.ClaimGroupnetwork(ctx, groupnetwork)
@@ -185,9 +194,15 @@ func (w *Worker) run(ctx context.Context, mss *agentmodels.ModelSets) (err error
 				ovndb.ClaimLoadbalancerNetwork(ctx, loadbalancerNetwork)
 			}
 		}
+		for _, natgw := range vpc.NatGateways {
+			if err := ovndb.ClaimNatGateway(ctx, natgw, mss.VpcPeeringConnections, w.opts); err != nil {
+				log.Errorf("claim nat gateway %s(%s): %v", natgw.Name, natgw.Id, err)
+			}
+		}
 		routes := resolveRoutes(vpc, mss)
 		ovndb.ClaimRoutes(ctx, vpc, routes)
 	}
+	ovndb.ClaimVpcPeeringConnections(ctx, mss.VpcPeeringConnections)
 	for _, vpc := range mss.Vpcs {
 		if vpc.Id == apis.DEFAULT_VPC_ID {
 			continue
@@ -195,6 +210,13 @@ func (w *Worker) run(ctx context.Context, mss *agentmodels.ModelSets) (err error
 		ovndb.ClaimVpcGuestDnsRecords(ctx, vpc)
 	}
 	ovndb.ClaimDnsRecords(ctx, mss.Vpcs, mss.DnsRecords)
+	var mirrors []*tapMirror
+	if w.opts.EnableOvnMirror {
+		mirrors = resolveTapMirrors(mss.NetTapFlows)
+	}
+	if err := ovndb.ClaimTapMirrors(ctx, mirrors); err != nil {
+		log.Errorf("claim tap mirrors: %v", err)
+	}
 	ovndb.Sweep(ctx)
 	return nil
 }
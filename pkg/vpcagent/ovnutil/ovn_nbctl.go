@@ -77,6 +77,12 @@ func (cli *OvnNbCtl) run(ctx context.Context, args []string) *CmdResult {
 	return res
 }
 
+// Run runs the command, the error is returned in the result instead of
+// panicking
+func (cli *OvnNbCtl) Run(ctx context.Context, args []string) *CmdResult {
+	return cli.run(ctx, args)
+}
+
 func (cli *OvnNbCtl) splitArgs(args []string) [][]string {
 	idx, ret, part := 0, [][]string{}, []string{}
 	for _, arg := range args {
@@ -189,9 +195,13 @@ func OvnNbctlArgsDestroy(irows []types.IRow) []string {
 			newArgs = []string{"--", "--if-exists", "lsp-del", irow.OvsdbUuid()}
 		case *ovn_nb.LogicalRouterPort:
 			newArgs = []string{"--", "--if-exists", "lrp-del", irow.OvsdbUuid()}
+		case *ovn_nb.LoadBalancer:
+			newArgs = []string{"--", "--if-exists", "lb-del", irow.OvsdbUuid()}
 		case *ovn_nb.LogicalRouterStaticRoute:
 		case *ovn_nb.ACL:
 		case *ovn_nb.QoS:
+		case *ovn_nb.NAT:
+		case *ovn_nb.GatewayChassis:
 		default:
 			if !irow.OvsdbIsRoot() {
 				panic(irow.OvsdbTableName())